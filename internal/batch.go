@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// runJob runs all stages of the job, like helmper without a subcommand
+func runJob(ctx context.Context, cmd *cobra.Command, j bootstrap.Job) output.JobSummary {
+	start := time.Now()
+	s := output.JobSummary{Name: j.Name, Config: j.Config}
+
+	slog.Info("job started", slog.String("job", j.Name), slog.String("config", j.Config))
+	viper, err := bootstrap.LoadViperConfigurationFile(cmd.Flags(), j.Config)
+	if err == nil {
+		p := pipeline.New(viper)
+		if err = attachEvents(p, viper, j.Name); err == nil {
+			s.Charts, s.Images, s.Patched, err = run(ctx, p)
+		}
+	}
+	s.Err = err
+	s.Duration = time.Since(start)
+
+	if err != nil {
+		slog.Error("job failed", slog.String("job", j.Name), slog.String("error", err.Error()))
+	} else {
+		slog.Info("job completed", slog.String("job", j.Name), slog.Duration("duration", s.Duration))
+	}
+	return s
+}
+
+// run runs the pipeline, or its groups one after another, and returns the number of charts, images and patched images
+func run(ctx context.Context, p *pipeline.Pipeline) (int, int, int, error) {
+	if len(p.Groups) == 0 {
+		err := p.Run(ctx)
+		return len(p.Import.Charts), len(p.Imgs), len(p.Patched), err
+	}
+	summaries, err := runGroups(ctx, p)
+	charts, images, patched := 0, 0, 0
+	for _, s := range summaries {
+		charts, images, patched = charts+s.Charts, images+s.Images, patched+s.Patched
+	}
+	return charts, images, patched, err
+}
+
+func batchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "batch PATH",
+		Short:   "Run the independent jobs of a jobs file, each with its own configuration file, and report the result of every job",
+		Example: "helmper batch jobs.yaml --parallel 2",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			conf, err := bootstrap.LoadJobs(args[0])
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("parallel") {
+				conf.Parallel, _ = cmd.Flags().GetInt("parallel")
+			}
+
+			// a failing job does not stop the other jobs
+			summaries := make([]output.JobSummary, len(conf.Jobs))
+			eg := errgroup.Group{}
+			eg.SetLimit(max(conf.Parallel, 1))
+			for i, j := range conf.Jobs {
+				eg.Go(func() error {
+					summaries[i] = runJob(cmd.Context(), cmd, j)
+					return nil
+				})
+			}
+			_ = eg.Wait()
+
+			output.RenderJobTable(summaries)
+
+			failed := 0
+			for _, s := range summaries {
+				if s.Err != nil {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("internal: %d of %d jobs failed", failed, len(summaries))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Int("parallel", 1, "number of jobs run at the same time. Overrides 'parallel' in the jobs file")
+	return cmd
+}
@@ -1,7 +1,12 @@
 package bootstrap
 
 import (
+	"fmt"
+	"log/slog"
+
 	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/spf13/viper"
+	"golang.org/x/xerrors"
 )
 
 // Add Helm repos to user's local helm configuration file, Optionupdate all existing repos and pulls charts
@@ -21,5 +26,44 @@ func SetupHelm(charts *helm.ChartCollection, setters ...helm.Option) (helm.Chart
 	return charts.SetupHelm(
 		helm.Update(args.Update),
 		helm.Verbose(args.Verbose),
+		helm.Registries(args.Registries),
 	)
 }
+
+// conditions reads the variables of the configuration and the --var flags, the Kubernetes version and the architecture
+func conditions(viper *viper.Viper) helm.Conditions {
+	vars := viper.GetStringMapString("variables")
+	for k, v := range viper.GetStringMapString("var") {
+		vars[k] = v
+	}
+	return helm.Conditions{
+		Vars:        vars,
+		KubeVersion: viper.GetString("k8s_version"),
+		Arch:        viper.GetString("import.architecture"),
+	}
+}
+
+// filterCharts removes the charts whose 'when' condition does not match the run
+func filterCharts(viper *viper.Viper, charts *helm.ChartCollection) error {
+	cond := conditions(viper)
+	included := make([]helm.Chart, 0, len(charts.Charts))
+	for _, c := range charts.Charts {
+		ok, err := c.Included(cond)
+		if err != nil {
+			s := fmt.Sprintf(`
+charts:
+- name: %s
+  version: "%s"
+  when: eq .Vars.cni "cilium"  <--- true or false
+`, c.Name, c.Version)
+			return xerrors.Errorf("You have configured chart '%s' with an invalid condition: %s. Please change the value and try again...\nExample config:\n%s", c.Name, err, s)
+		}
+		if !ok {
+			slog.Info("chart excluded by its condition", slog.String("chart", c.Name), slog.String("when", c.When))
+			continue
+		}
+		included = append(included, c)
+	}
+	charts.Charts = included
+	return nil
+}
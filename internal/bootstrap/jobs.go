@@ -0,0 +1,66 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
+)
+
+// Job is an independent run with its own configuration file
+type Job struct {
+	Name   string `yaml:"name"`
+	Config string `yaml:"config"`
+}
+
+// JobsConfig is a batch of jobs, e.g. one per environment
+type JobsConfig struct {
+	// Parallel is the number of jobs run at the same time. Jobs run sequentially by default
+	Parallel int   `yaml:"parallel"`
+	Jobs     []Job `yaml:"jobs"`
+}
+
+// LoadJobs reads the jobs file at path. Relative configuration paths are resolved from the directory of the jobs file
+func LoadJobs(path string) (JobsConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return JobsConfig{}, err
+	}
+
+	conf := JobsConfig{}
+	if err := yaml.Unmarshal(b, &conf); err != nil {
+		return JobsConfig{}, err
+	}
+	if conf.Parallel < 1 {
+		conf.Parallel = 1
+	}
+
+	if len(conf.Jobs) == 0 {
+		s := `
+jobs:            <---
+- name: production
+  config: production/helmper.yaml
+`
+		return JobsConfig{}, xerrors.Errorf("The jobs file %s does not contain any jobs. Please add a job and try again..\nExample config:\n%s", path, s)
+	}
+
+	seen := map[string]bool{}
+	for i, j := range conf.Jobs {
+		if j.Name == "" || j.Config == "" || seen[j.Name] {
+			s := `
+jobs:
+- name: production                  <--- unique
+  config: production/helmper.yaml   <---
+`
+			return JobsConfig{}, xerrors.Errorf("Every job needs a unique name and a configuration file. Please fix job #%d and try again..\nExample config:\n%s", i+1, s)
+		}
+		seen[j.Name] = true
+
+		if !filepath.IsAbs(j.Config) {
+			conf.Jobs[i].Config = filepath.Join(filepath.Dir(path), j.Config)
+		}
+	}
+
+	return conf, nil
+}
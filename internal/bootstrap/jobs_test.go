@@ -0,0 +1,53 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadJobs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.yaml")
+	if err := os.WriteFile(path, []byte(`
+parallel: 2
+jobs:
+- name: production
+  config: production/helmper.yaml
+- name: staging
+  config: /etc/helmper/staging.yaml
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := LoadJobs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Parallel != 2 || len(conf.Jobs) != 2 {
+		t.Fatalf("unexpected jobs %v", conf)
+	}
+	if want := filepath.Join(dir, "production/helmper.yaml"); conf.Jobs[0].Config != want {
+		t.Errorf("want '%s' got '%s'", want, conf.Jobs[0].Config)
+	}
+	if conf.Jobs[1].Config != "/etc/helmper/staging.yaml" {
+		t.Errorf("want absolute path to be kept, got '%s'", conf.Jobs[1].Config)
+	}
+}
+
+func TestLoadJobsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":     "jobs: []",
+		"no config": "jobs:\n- name: production",
+		"duplicate": "jobs:\n- name: a\n  config: a.yaml\n- name: a\n  config: b.yaml",
+	}
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "jobs.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadJobs(path); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
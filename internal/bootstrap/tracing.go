@@ -0,0 +1,76 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// TracingConfigSection exports OpenTelemetry traces of the pipeline stages to an OTLP endpoint
+type TracingConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host and port of the OTLP receiver. Defaults to the OTEL_EXPORTER_OTLP_ENDPOINT environment variable
+	Endpoint string `yaml:"endpoint"`
+	// Protocol is 'grpc' (default) or 'http'
+	Protocol string `yaml:"protocol"`
+	Insecure bool   `yaml:"insecure"`
+}
+
+// exporter creates the OTLP trace exporter of the protocol
+func (t TracingConfigSection) exporter(ctx context.Context) (*otlptrace.Exporter, error) {
+	switch t.Protocol {
+	case "grpc", "":
+		opts := []otlptracegrpc.Option{}
+		if t.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(t.Endpoint))
+		}
+		if t.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "http":
+		opts := []otlptracehttp.Option{}
+		if t.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(t.Endpoint))
+		}
+		if t.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("bootstrap: unsupported OTLP protocol '%s'", t.Protocol)
+	}
+}
+
+// SetupTracing registers a tracer provider exporting the spans to the OTLP endpoint.
+// The returned function flushes the remaining spans and must be called before exiting
+func SetupTracing(ctx context.Context, t TracingConfigSection) (func(context.Context) error, error) {
+	exp, err := t.exporter(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("helmper"),
+		semconv.ServiceVersion(version.Get().Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
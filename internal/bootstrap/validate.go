@@ -0,0 +1,352 @@
+package bootstrap
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/distribution/reference"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/xerrors"
+)
+
+// defaultBuildkitSocket and defaultDockerSocket are the daemons Copacetic detects when no Buildkit address is configured
+const (
+	defaultBuildkitSocket = "/run/buildkit/buildkitd.sock"
+	defaultDockerSocket   = "/var/run/docker.sock"
+)
+
+// creatable reports why the output folder cannot be created, or an empty string if it exists or can be created
+func creatable(folder string) string {
+	for dir := filepath.Clean(folder); ; dir = filepath.Dir(dir) {
+		fi, err := os.Stat(dir)
+		switch {
+		case err == nil && fi.IsDir():
+			return ""
+		case err == nil:
+			return fmt.Sprintf("'%s' is not a folder", dir)
+		case !os.IsNotExist(err):
+			return err.Error()
+		}
+		if dir == filepath.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+// registryHost reports whether the value is a registry host, optionally with a port, e.g. 'docker.io' or '0.0.0.0:5000'
+func registryHost(v string) bool {
+	if v == "" || strings.Contains(v, "://") {
+		return false
+	}
+	named, err := reference.ParseNormalizedNamed(v + "/probe")
+	return err == nil && reference.Domain(named) == v
+}
+
+// crossValidate checks the configuration sections against each other and the environment, and reports every problem at once before any work starts.
+// Dry-runs do not patch, so the Buildkit daemon and the container runtime starting it are not looked for
+func crossValidate(conf config, importConf ImportConfigSection, dryRun bool) error {
+	problems := []string{}
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	c := importConf.Import
+
+	if c.Copacetic.Enabled {
+		switch b := c.Copacetic.Buildkitd; {
+		case b.Container.Enabled && b.Addr != "":
+			add("import.copacetic.buildkitd.addr and import.copacetic.buildkitd.container are both set. Use addr to connect to a running Buildkit daemon, or container to start one")
+		case b.Container.Enabled:
+			switch b.Container.Runtime {
+			case "", "docker", "podman", "nerdctl":
+				runtime := b.Container.Runtime
+				if runtime == "" {
+					runtime = "docker"
+				}
+				if _, err := exec.LookPath(runtime); err != nil && !dryRun {
+					add("import.copacetic.buildkitd.container: %s is not installed to start the Buildkit daemon with", runtime)
+				}
+			default:
+				add("import.copacetic.buildkitd.container.runtime: '%s' is not docker, podman or nerdctl", b.Container.Runtime)
+			}
+		case b.Addr == "" && !dryRun:
+			_, docker := os.Stat(defaultDockerSocket)
+			_, buildkit := os.Stat(defaultBuildkitSocket)
+			if docker != nil && buildkit != nil && os.Getenv("DOCKER_HOST") == "" {
+				add("import.copacetic.buildkitd.addr is not set, and there is neither Docker at %s nor a local Buildkit daemon at %s. Set the address, or start a daemon with import.copacetic.buildkitd.container", defaultDockerSocket, defaultBuildkitSocket)
+			}
+		}
+		for key, folder := range map[string]string{
+			"import.copacetic.output.reports.folder": c.Copacetic.Output.Reports.Folder,
+			"import.copacetic.output.tars.folder":    c.Copacetic.Output.Tars.Folder,
+		} {
+			if folder == "" {
+				continue
+			}
+			if reason := creatable(folder); reason != "" {
+				add("%s cannot be created: %s", key, reason)
+			}
+		}
+		if c.Copacetic.Incremental && !conf.State.Enabled() {
+			add("import.copacetic.incremental compares the vulnerabilities with the earlier patches recorded in the state store, but state is not configured")
+		}
+		if t := c.Copacetic.Patched.Tag; t != "" {
+			if _, err := (registry.PatchedTag{Template: t}).Tag("1.0.0"); err != nil {
+				add("import.copacetic.patched.tag: %s", err)
+			}
+		}
+		if s := c.Copacetic.Patched.RepositorySuffix; s != "" {
+			if _, err := reference.ParseNormalizedNamed("helmper/patched" + s); err != nil {
+				add("import.copacetic.patched.repositorySuffix: '%s' is not valid in a repository name :: %s", s, err)
+			}
+			if c.ReplaceRegistryReferences {
+				add("import.copacetic.patched.repositorySuffix is not reflected in the charts modified by import.replaceRegistryReferences. Reference the patched repositories with the files of values.folder instead")
+			}
+		}
+	}
+
+	// without a Trivy server, the images are scanned in-process with the vulnerability database in the cache folder
+	if c.Copacetic.Trivy.Addr == "" && c.Copacetic.Trivy.CacheDir != "" && (c.Copacetic.Enabled || conf.Licenses.Enabled || c.SBOM.Enabled) {
+		if reason := creatable(c.Copacetic.Trivy.CacheDir); reason != "" {
+			add("import.copacetic.trivy.cacheDir cannot be created: %s", reason)
+		}
+	}
+	if t := c.Copacetic.Trivy; t.DBPath != "" {
+		switch {
+		case t.Addr != "":
+			add("import.copacetic.trivy.dbPath is only used without a Trivy server, but import.copacetic.trivy.addr is set")
+		case t.DBRepository != "":
+			add("import.copacetic.trivy.dbPath and import.copacetic.trivy.dbRepository are both set. Use dbPath for a pre-downloaded database, or dbRepository to download it")
+		}
+		if _, err := os.Stat(filepath.Join(t.DBPath, "trivy.db")); err != nil {
+			add("import.copacetic.trivy.dbPath: there is no vulnerability database (trivy.db) in %s", t.DBPath)
+		}
+	}
+	if f := c.Copacetic.Trivy.IgnoreFile; f != "" {
+		if _, err := os.Stat(f); err != nil {
+			add("import.copacetic.trivy.ignoreFile: %s", err)
+		}
+	}
+	for _, f := range c.Copacetic.Trivy.VEX {
+		if _, err := os.Stat(f); err != nil {
+			add("import.copacetic.trivy.vex: %s", err)
+		}
+	}
+	if c.Copacetic.Trivy.DBRepository != "" {
+		if _, err := name.ParseReference(c.Copacetic.Trivy.DBRepository); err != nil {
+			add("import.copacetic.trivy.dbRepository: '%s' is not a repository reference, e.g. registry.internal/aquasecurity/trivy-db:2 :: %s", c.Copacetic.Trivy.DBRepository, err)
+		}
+	}
+
+	if conf.Licenses.Enabled {
+		if reason := creatable(filepath.Dir(conf.Licenses.File)); reason != "" {
+			add("licenses.file cannot be created: %s", reason)
+		}
+	}
+	if conf.PullSecrets.Enabled {
+		ps := conf.PullSecrets
+		if len(ps.Registries) == 0 && len(ps.GitLab) == 0 && len(ps.Quay) == 0 {
+			add("pullSecrets is enabled, but pullSecrets lists no Harbor registries, GitLab groups or Quay organizations")
+		}
+		registered := func(n string) bool {
+			for _, r := range conf.Registries {
+				if r.Name == n {
+					return true
+				}
+			}
+			return false
+		}
+		for _, n := range ps.Registries {
+			if !registered(n) {
+				add("pullSecrets.registries: there is no registry named '%s'", n)
+			}
+		}
+		for _, g := range ps.GitLab {
+			if !registered(g.Registry) {
+				add("pullSecrets.gitlab: there is no registry named '%s'", g.Registry)
+			}
+			if g.URL == "" || g.Group == "" || g.Token == "" {
+				add("pullSecrets.gitlab: url, group and token are required for registry '%s'", g.Registry)
+			}
+		}
+		for _, q := range ps.Quay {
+			if !registered(q.Registry) {
+				add("pullSecrets.quay: there is no registry named '%s'", q.Registry)
+			}
+			if q.Organization == "" || q.Token == "" {
+				add("pullSecrets.quay: organization and token are required for registry '%s'", q.Registry)
+			}
+		}
+		if conf.PullSecrets.Duration == 0 || conf.PullSecrets.Duration < -1 {
+			add("pullSecrets.duration must be a number of days, or -1 to never expire")
+		}
+		if reason := creatable(filepath.Dir(conf.PullSecrets.File)); reason != "" {
+			add("pullSecrets.file cannot be created: %s", reason)
+		}
+	}
+	if c.SBOM.Enabled {
+		if c.SBOM.Folder != "" {
+			if reason := creatable(c.SBOM.Folder); reason != "" {
+				add("import.sbom.folder cannot be created: %s", reason)
+			}
+		}
+	}
+
+	if c.Architecture != nil && len(c.Architectures) > 0 {
+		add("import.architecture and import.architectures are both set. Use architecture to flatten images to one platform, or architectures to mirror an index of several")
+	}
+	for _, a := range c.Architectures {
+		if _, err := v1.ParsePlatform(a); err != nil {
+			add("import.architectures: '%s' is not a platform, e.g. linux/arm64 :: %s", a, err)
+		}
+	}
+
+	if c.Cosign.Enabled && c.Cosign.KeyRef == "" && !c.Cosign.Keyless {
+		add("import.cosign.keyRef is not set, and keyless signing is not enabled with import.cosign.keyless")
+	}
+
+	mirrored := map[string]bool{}
+	for _, m := range conf.Mirrors {
+		if m.From != "" || m.To != "" {
+			if m.Registry != "" || m.Mirror != "" {
+				add("mirrors: '%s%s' sets both registry/mirror and from/to, use one of them", m.Registry, m.From)
+				continue
+			}
+			if m.From == "" || m.To == "" {
+				add("mirrors: the rewrite '%s' -> '%s' needs both from and to", m.From, m.To)
+				continue
+			}
+			if err := m.rewrite().Validate(); err != nil {
+				add("mirrors: %s", strings.TrimPrefix(err.Error(), "registry: "))
+			}
+			continue
+		}
+		if !registryHost(m.Registry) {
+			add("mirrors: '%s' is not a registry host, e.g. docker.io", m.Registry)
+		}
+		if !registryHost(strings.SplitN(m.Mirror, "/", 2)[0]) {
+			add("mirrors: the mirror '%s' of %s is not a registry, e.g. harbor.internal/dockerhub", m.Mirror, m.Registry)
+		}
+		if mirrored[m.Registry] {
+			add("mirrors: %s is mirrored more than once", m.Registry)
+		}
+		mirrored[m.Registry] = true
+	}
+
+	names := map[string]bool{}
+	for _, r := range conf.Registries {
+		if r.URL == "" {
+			add("registries: '%s' has no url", r.Name)
+		}
+		if r.Name != "" && names[r.Name] {
+			add("registries: the name '%s' is used more than once", r.Name)
+		}
+		names[r.Name] = true
+		if p := strings.Trim(r.Prefix, "/"); p != "" {
+			if _, err := reference.ParseNormalizedNamed("docker.io/" + p + "/probe"); err != nil {
+				add("registries: the prefix '%s' of '%s' is not a repository path, e.g. mirror", r.Prefix, r.Name)
+			}
+		}
+		if r.Harbor.Public && !r.Harbor.CreateProjects {
+			add("registries: harbor.public of '%s' only applies to created projects, but harbor.createProjects is not enabled", r.Name)
+		}
+		if r.Harbor.URL != "" {
+			if u, err := url.Parse(r.Harbor.URL); err != nil || u.Scheme == "" || u.Host == "" {
+				add("registries: harbor.url of '%s' is not a URL, e.g. https://harbor.internal", r.Name)
+			}
+		}
+		if cr := r.ChartRepository; cr != nil {
+			switch cr.Type {
+			case "chartmuseum", "nexus", "artifactory":
+			default:
+				add("registries: chartRepository.type of '%s' is '%s', not chartmuseum, nexus or artifactory", r.Name, cr.Type)
+			}
+			if u, err := url.Parse(cr.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("registries: chartRepository.url of '%s' is not a URL, e.g. https://nexus.internal/repository/helm-hosted", r.Name)
+			}
+		}
+		if err := r.registry().ValidateTLS(); err != nil {
+			add("registries: %s", err)
+		}
+		for _, p := range slices.Concat(r.Route.Charts, r.Route.Images) {
+			if _, err := path.Match(p, ""); err != nil {
+				add("registries: the route pattern '%s' of '%s' is not a glob pattern :: %s", p, r.Name, err)
+			}
+		}
+	}
+	hosts := map[string]bool{}
+	for _, s := range conf.SourceRegistries {
+		switch {
+		case s.Host == "":
+			add("sourceRegistries: an entry has no host, e.g. docker.io")
+			continue
+		case hosts[s.Host]:
+			add("sourceRegistries: the host '%s' is configured more than once", s.Host)
+		}
+		hosts[s.Host] = true
+		if s.RateLimit.RequestsPerSecond < 0 || s.RateLimit.ConcurrentPulls < 0 {
+			add("sourceRegistries: the rate limit of '%s' can not be negative", s.Host)
+		}
+		if err := s.source().Validate(); err != nil {
+			add("sourceRegistries: %s", err)
+		}
+	}
+	for _, c := range conf.Caches {
+		if c.Flatten {
+			add("caches: '%s' can not be flattened, as pull-through caches keep the repositories of the upstream registry", c.Name)
+		}
+	}
+
+	if c.Harbor.Enabled {
+		harbor := ""
+		switch {
+		case c.Harbor.Registry != "":
+			for _, r := range conf.Registries {
+				if r.Name == c.Harbor.Registry {
+					harbor = r.URL
+				}
+			}
+			if !names[c.Harbor.Registry] {
+				add("import.harbor.registry: there is no registry named '%s'", c.Harbor.Registry)
+			}
+		case len(conf.Registries) > 0:
+			harbor = conf.Registries[0].URL
+		default:
+			add("import.harbor is enabled, but no registries are configured")
+		}
+		for _, r := range conf.Registries {
+			if r.Flatten && (r.Name == c.Harbor.Registry || c.Harbor.Registry == "" && r.URL == harbor) {
+				add("import.harbor: the registry '%s' can not be flattened, as Harbor replicates the repositories as they are", r.Name)
+			}
+		}
+		if _, project, _ := strings.Cut(harbor, "/"); harbor != "" && project == "" {
+			add("import.harbor: the registry '%s' has no project to replicate into, e.g. %s/mirror", harbor, harbor)
+		}
+		if c.Harbor.File != "" {
+			if reason := creatable(filepath.Dir(c.Harbor.File)); reason != "" {
+				add("import.harbor.file cannot be created: %s", reason)
+			}
+		}
+	}
+
+	if conf.Pinning.Enabled {
+		if conf.Pinning.Policy != "enforce" && conf.Pinning.Policy != "warn" {
+			add("pinning.policy: '%s' is not supported, use enforce or warn", conf.Pinning.Policy)
+		}
+		if conf.Pinning.Rewrite && !c.ReplaceRegistryReferences {
+			add("pinning.rewrite is enabled, but the values of the charts are only rewritten with import.replaceRegistryReferences")
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return xerrors.Errorf("Found %d problem(s) in the configuration. Please fix them and try again...\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+}
@@ -0,0 +1,198 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCrossValidate(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "reports")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	conf := config{
+		Mirrors: []MirrorConfigSection{
+			{Registry: "docker.io", Mirror: "harbor.internal/dockerhub"},
+			{Registry: "https://quay.io", Mirror: "harbor.internal/quay"},
+			{From: "ghcr.io/*", To: "harbor.internal/*/*"},
+		},
+		Registries: []registryConfigSection{
+			{Name: "registry", URL: "0.0.0.0:5000", ChartRepository: &chartRepositoryConfigSection{Type: "harbor", URL: "nexus.internal"}},
+			{Name: "registry"},
+		},
+		Pinning: PinningConfigSection{Enabled: true, Policy: "block", Rewrite: true},
+	}
+	importConf := ImportConfigSection{}
+	importConf.Import.Copacetic.Enabled = true
+	importConf.Import.Copacetic.Buildkitd.Addr = "tcp://0.0.0.0:8888"
+	importConf.Import.Copacetic.Output.Reports.Folder = filepath.Join(file, "nested")
+	importConf.Import.Copacetic.Output.Tars.Folder = filepath.Join(dir, "tars", "nested")
+	importConf.Import.Copacetic.Trivy.CacheDir = filepath.Join(file, "trivy")
+	importConf.Import.Copacetic.Trivy.DBPath = dir
+	importConf.Import.Copacetic.Trivy.VEX = []string{filepath.Join(dir, "openvex.json")}
+	importConf.Import.Cosign.Enabled = true
+
+	err := crossValidate(conf, importConf, false)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	for _, want := range []string{
+		"Found 13 problem(s)",
+		"import.copacetic.trivy.cacheDir",
+		"no vulnerability database (trivy.db)",
+		"import.copacetic.trivy.vex",
+		"import.copacetic.output.reports.folder",
+		"import.cosign.keyRef",
+		"'https://quay.io' is not a registry host",
+		"'registry' has no url",
+		"the rewrite to 'harbor.internal/*/*' has 2 wildcards",
+		"'registry' is used more than once",
+		"pinning.policy: 'block'",
+		"pinning.rewrite",
+		"chartRepository.type of 'registry' is 'harbor'",
+		"chartRepository.url of 'registry' is not a URL",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want %q in %s", want, err)
+		}
+	}
+
+	importConf.Import.Copacetic.Trivy.Addr = "http://0.0.0.0:8887"
+	importConf.Import.Copacetic.Trivy.DBPath = ""
+	importConf.Import.Copacetic.Trivy.VEX = nil
+	importConf.Import.Copacetic.Output.Reports.Folder = filepath.Join(dir, "reports-folder")
+	importConf.Import.Cosign.Keyless = true
+	if err := crossValidate(config{Mirrors: conf.Mirrors[:1]}, importConf, false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMirrorApply(t *testing.T) {
+	mirrors := []MirrorConfigSection{
+		{From: "docker.io/library/*", To: "registry.local/dockerhub/*"},
+		{Registry: "docker.io", Mirror: "harbor.internal/dockerhub"},
+	}
+	for in, want := range map[string]string{
+		"docker.io/library/nginx": "registry.local/dockerhub/nginx",
+		"docker.io/bitnami/nginx": "harbor.internal/dockerhub/bitnami/nginx",
+		"quay.io/prometheus/node": "",
+	} {
+		got := ""
+		for _, m := range mirrors {
+			r, ok, err := m.Apply(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok {
+				got = r
+				break
+			}
+		}
+		if got != want {
+			t.Errorf("%s: want '%s' got '%s'", in, want, got)
+		}
+	}
+}
+
+func TestImagePolicyAllowed(t *testing.T) {
+	policy := ImagePolicyConfigSection{
+		Allow: []string{"harbor.internal/*", "quay.io/*"},
+		Deny:  []string{"quay.io/unverified/*"},
+	}
+	for in, want := range map[string]bool{
+		"harbor.internal/dockerhub/library/nginx": true,
+		"quay.io/prometheus/node":                 true,
+		"quay.io/unverified/tool":                 false,
+		"docker.io/library/nginx":                 false,
+	} {
+		if got := policy.Allowed(in); got != want {
+			t.Errorf("%s: want %t got %t", in, want, got)
+		}
+	}
+
+	if !(ImagePolicyConfigSection{}).Allowed("docker.io/library/nginx") {
+		t.Error("want an empty policy to allow every image")
+	}
+}
+
+func TestCrossValidateBuildkitd(t *testing.T) {
+	importConf := ImportConfigSection{}
+	importConf.Import.Copacetic.Enabled = true
+	importConf.Import.Copacetic.Buildkitd.Addr = "tcp://0.0.0.0:8888"
+	importConf.Import.Copacetic.Buildkitd.Container.Enabled = true
+	err := crossValidate(config{}, importConf, false)
+	if err == nil || !strings.Contains(err.Error(), "are both set") {
+		t.Errorf("want error for both an address and a container, got %v", err)
+	}
+
+	importConf.Import.Copacetic.Buildkitd.Addr = ""
+	importConf.Import.Copacetic.Buildkitd.Container.Runtime = "lxc"
+	err = crossValidate(config{}, importConf, false)
+	if err == nil || !strings.Contains(err.Error(), "'lxc' is not docker, podman or nerdctl") {
+		t.Errorf("want error for an unsupported runtime, got %v", err)
+	}
+}
+
+func TestCrossValidatePatched(t *testing.T) {
+	importConf := ImportConfigSection{}
+	importConf.Import.Copacetic.Enabled = true
+	importConf.Import.Copacetic.Buildkitd.Container.Enabled = true
+	importConf.Import.Copacetic.Patched.Tag = "{{ .Tag }}+patched"
+	importConf.Import.Copacetic.Patched.RepositorySuffix = "-Patched"
+	importConf.Import.Copacetic.Incremental = true
+	importConf.Import.ReplaceRegistryReferences = true
+	err := crossValidate(config{}, importConf, false)
+	if err == nil {
+		t.Fatal("want errors for the patched names")
+	}
+	for _, want := range []string{"'1.0.0+patched', which is not a valid tag", "'-Patched' is not valid in a repository name", "not reflected in the charts", "but state is not configured"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCrossValidateRoute(t *testing.T) {
+	r := registryConfigSection{Name: "prod", URL: "registry.internal"}
+	r.Route.Charts = []string{"prometheus-[a"}
+	err := crossValidate(config{Registries: []registryConfigSection{r}}, ImportConfigSection{}, false)
+	if err == nil || !strings.Contains(err.Error(), "the route pattern 'prometheus-[a' of 'prod' is not a glob pattern") {
+		t.Errorf("want error for the route pattern, got %v", err)
+	}
+}
+
+func TestCrossValidateSourceRegistries(t *testing.T) {
+	conf := config{SourceRegistries: []sourceRegistryConfigSection{
+		{Host: "docker.io", Proxy: "http://proxy.internal:3128"},
+		{Host: "docker.io"},
+		{Proxy: "proxy"},
+		{Host: "quay.io", Proxy: "proxy"},
+		{Host: "ghcr.io"},
+	}}
+	conf.SourceRegistries[4].RateLimit.ConcurrentPulls = -1
+	err := crossValidate(conf, ImportConfigSection{}, false)
+	if err == nil {
+		t.Fatal("want errors for the source registries")
+	}
+	for _, want := range []string{"'docker.io' is configured more than once", "an entry has no host", "the proxy 'proxy' of registry quay.io is not a URL", "the rate limit of 'ghcr.io' can not be negative"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestCrossValidateDryRun(t *testing.T) {
+	importConf := ImportConfigSection{}
+	importConf.Import.Copacetic.Enabled = true
+	importConf.Import.Copacetic.Buildkitd.Container.Enabled = true
+	importConf.Import.Copacetic.Buildkitd.Container.Runtime = "nerdctl"
+	importConf.Import.Cosign.Enabled = true
+	err := crossValidate(config{}, importConf, true)
+	if err == nil || strings.Contains(err.Error(), "is not installed") || !strings.Contains(err.Error(), "import.cosign.keyRef") {
+		t.Errorf("want the configuration checked without the environment in dry-run, got %v", err)
+	}
+}
@@ -1,13 +1,32 @@
 package bootstrap
 
 import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/ChristofferNissen/helmper/pkg/discovery"
 	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/hooks"
+	"github.com/ChristofferNissen/helmper/pkg/notation"
+	"github.com/ChristofferNissen/helmper/pkg/policy"
 	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/sink"
+	"github.com/ChristofferNissen/helmper/pkg/source"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
 	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	dbTypes "github.com/aquasecurity/trivy-db/pkg/types"
 	"github.com/fsnotify/fsnotify"
+	"github.com/robfig/cron/v3"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"golang.org/x/xerrors"
@@ -15,22 +34,90 @@ import (
 
 type ImportConfigSection struct {
 	Import struct {
-		Enabled                   bool    `yaml:"enabled"`
-		Architecture              *string `yaml:"architecture"`
-		ReplaceRegistryReferences bool    `yaml:"replaceRegistryReferences"`
-		Copacetic                 struct {
+		Enabled      bool    `yaml:"enabled"`
+		Architecture *string `yaml:"architecture"`
+		// Architectures are the platforms of multi-arch images mirrored as a new index. All platforms are mirrored by default
+		Architectures []string `yaml:"architectures"`
+		// Referrers copies the signatures, attestations and SBOMs attached to the source images
+		Referrers                 bool `yaml:"referrers"`
+		ReplaceRegistryReferences bool `yaml:"replaceRegistryReferences"`
+		// Dependencies of the charts are imported with them. Rewrite replaces their repositories with the registry
+		Dependencies struct {
+			Rewrite bool `yaml:"rewrite"`
+		} `yaml:"dependencies"`
+		PinDigests bool `yaml:"pinDigests"`
+		// PinMovingTags pins images with moving tags, e.g. 'latest' or 'v1', to their current digest
+		PinMovingTags bool `yaml:"pinMovingTags"`
+		Concurrency   int  `yaml:"concurrency"`
+		Retries       int  `yaml:"retries"`
+		// Backoff is the delay before the first retry, doubled after each attempt up to MaxBackoff
+		Backoff    time.Duration `yaml:"backoff"`
+		MaxBackoff time.Duration `yaml:"maxBackoff"`
+		// ContinueOnError imports the other images when an image can not be pushed, and fails the run at the end
+		ContinueOnError bool `yaml:"continueOnError"`
+		// FailOn is the lowest severity (LOW, MEDIUM, HIGH or CRITICAL) found by the pre-scan that gates an image. FailAction is 'fail' (default), 'skip' or 'quarantine'
+		FailOn     string `yaml:"failOn"`
+		FailAction string `yaml:"failAction"`
+		// Quarantine is the repository prefix quarantined images are pushed under
+		Quarantine string `yaml:"quarantine"`
+		// Harbor replicates the images that are not patched into a Harbor registry with replication rules, instead of copying them
+		Harbor struct {
+			Enabled bool `yaml:"enabled"`
+			// Registry is the name of the Harbor registry. Defaults to the first registry
+			Registry string `yaml:"registry"`
+			// URL of the Harbor API. Defaults to the host of the registry
+			URL string `yaml:"url"`
+			// File the rules are written to
+			File string `yaml:"file"`
+			// Apply creates the rules in Harbor and waits for the replications. Without it the images are copied as usual
+			Apply   bool          `yaml:"apply"`
+			Timeout time.Duration `yaml:"timeout"`
+		} `yaml:"harbor"`
+		Copacetic struct {
 			Enabled      bool `yaml:"enabled"`
 			IgnoreErrors bool `yaml:"ignoreErrors"`
-			Buildkitd    struct {
+			// Incremental patches images again only for fixable vulnerabilities they were not patched for, as recorded in the state store
+			Incremental bool `yaml:"incremental"`
+			// OS allows and denies operating systems to patch, as 'family' or 'family:version', overriding the built-in list
+			OS struct {
+				Allow []string `yaml:"allow"`
+				Deny  []string `yaml:"deny"`
+			} `yaml:"os"`
+			// Patched names the patched images in the registries. By default they are pushed over the original tag
+			Patched struct {
+				Tag              string `yaml:"tag"`
+				RepositorySuffix string `yaml:"repositorySuffix"`
+			} `yaml:"patched"`
+			Buildkitd struct {
 				Addr       string `yaml:"addr"`
 				CACertPath string `yaml:"CACertPath"`
 				CertPath   string `yaml:"certPath"`
 				KeyPath    string `yaml:"keyPath"`
+				// Container starts a rootless Buildkit daemon in a container instead of connecting to Addr
+				Container struct {
+					Enabled bool   `yaml:"enabled"`
+					Image   string `yaml:"image"`
+					Name    string `yaml:"name"`
+					Runtime string `yaml:"runtime"`
+					Keep    bool   `yaml:"keep"`
+				} `yaml:"container"`
 			} `yaml:"buildkitd"`
 			Trivy struct {
 				Addr          string `yaml:"addr"`
 				Insecure      bool   `yaml:"insecure"`
+				CAFile        string `yaml:"caFile"`
+				CertFile      string `yaml:"certFile"`
+				KeyFile       string `yaml:"keyFile"`
 				IgnoreUnfixed bool   `yaml:"ignoreUnfixed"`
+				// CacheDir, DBRepository and DBPath configure the vulnerability database of the in-process scanner, used when Addr is not set
+				CacheDir     string `yaml:"cacheDir"`
+				DBRepository string `yaml:"dbRepository"`
+				DBPath       string `yaml:"dbPath"`
+				// MirrorDB copies the vulnerability databases into the registries on every run
+				MirrorDB bool `yaml:"mirrorDB"`
+				// IgnoreFile and VEX remove the accepted vulnerabilities from the scan results before patching and gating
+				IgnoreFile string   `yaml:"ignoreFile"`
+				VEX        []string `yaml:"vex"`
 			} `yaml:"trivy"`
 			Output struct {
 				Tars struct {
@@ -40,16 +127,57 @@ type ImportConfigSection struct {
 				Reports struct {
 					Clean  bool   `yaml:"clean"`
 					Folder string `yaml:"folder"`
+					// SARIF is the path of the SARIF file aggregating the latest reports of all images
+					SARIF string `yaml:"sarif"`
 				} `yaml:"reports"`
 			} `yaml:"output"`
 		} `yaml:"copacetic"`
+		SBOM struct {
+			Enabled bool   `yaml:"enabled"`
+			Format  string `yaml:"format"`
+			Folder  string `yaml:"folder"`
+		} `yaml:"sbom"`
+		// BlobCache keeps the layers pulled from source registries on disk between runs
+		BlobCache struct {
+			Enabled bool   `yaml:"enabled"`
+			Folder  string `yaml:"folder"`
+			// MaxAge prunes the blobs not used for longer at the start of the import. Zero keeps every blob
+			MaxAge time.Duration `yaml:"maxAge"`
+		} `yaml:"blobCache"`
 		Cosign struct {
 			Enabled           bool    `yaml:"enabled"`
 			KeyRef            string  `yaml:"keyRef"`
 			KeyRefPass        *string `yaml:"keyRefPass"`
 			AllowHTTPRegistry bool    `yaml:"allowHTTPRegistry"`
 			AllowInsecure     bool    `yaml:"allowInsecure"`
+			Keyless           bool    `yaml:"keyless"`
+			Attach            struct {
+				SBOM            bool `yaml:"sbom"`
+				Vulnerabilities bool `yaml:"vulnerabilities"`
+			} `yaml:"attach"`
+			Sigstore struct {
+				FulcioURL                string `yaml:"fulcioURL"`
+				RekorURL                 string `yaml:"rekorURL"`
+				TUFMirror                string `yaml:"tufMirror"`
+				TUFRoot                  string `yaml:"tufRoot"`
+				FulcioRoots              string `yaml:"fulcioRoots"`
+				RekorPublicKey           string `yaml:"rekorPublicKey"`
+				CTLogPublicKey           string `yaml:"ctLogPublicKey"`
+				IdentityToken            string `yaml:"identityToken"`
+				IdentityTokenFile        string `yaml:"identityTokenFile"`
+				OIDCIssuer               string `yaml:"oidcIssuer"`
+				OIDCClientID             string `yaml:"oidcClientID"`
+				TlogUpload               bool   `yaml:"tlogUpload"`
+				InsecureSkipFulcioVerify bool   `yaml:"insecureSkipFulcioVerify"`
+			} `yaml:"sigstore"`
 		} `yaml:"cosign"`
+		Notation struct {
+			Enabled         bool          `yaml:"enabled"`
+			KeyFile         string        `yaml:"keyFile"`
+			CertFile        string        `yaml:"certFile"`
+			SignatureFormat string        `yaml:"signatureFormat"`
+			Expiry          time.Duration `yaml:"expiry"`
+		} `yaml:"notation"`
 	} `yaml:"import"`
 }
 
@@ -58,39 +186,722 @@ type imageConfigSection struct {
 	Patch *bool  `yaml:"patch"`
 }
 
+type authConfigSection struct {
+	Username        string `yaml:"username"`
+	Password        string `yaml:"password"`
+	Token           string `yaml:"token"`
+	IdentityToken   string `yaml:"identityToken"`
+	CredentialsFile string `yaml:"credentialsFile"`
+}
+
+func (a authConfigSection) auth() registry.Auth {
+	return registry.Auth{
+		Username:        a.Username,
+		Password:        a.Password,
+		Token:           a.Token,
+		IdentityToken:   a.IdentityToken,
+		CredentialsFile: a.CredentialsFile,
+	}
+}
+
+// chartRepositoryConfigSection is a classic chart repository the charts are uploaded to instead of the registry, e.g. ChartMuseum
+type chartRepositoryConfigSection struct {
+	// Type is the upload API: 'chartmuseum', 'nexus' or 'artifactory'
+	Type     string            `yaml:"type"`
+	URL      string            `yaml:"url"`
+	Insecure bool              `yaml:"insecure"`
+	Auth     authConfigSection `yaml:"auth"`
+	// OCI pushes the charts to the registry too
+	OCI bool `yaml:"oci"`
+}
+
 type registryConfigSection struct {
-	Name      string `yaml:"name"`
-	URL       string `yaml:"url"`
-	Insecure  bool   `yaml:"insecure"`
-	PlainHTTP bool   `yaml:"plainHTTP"`
+	Name      string            `yaml:"name"`
+	URL       string            `yaml:"url"`
+	Insecure  bool              `yaml:"insecure"`
+	PlainHTTP bool              `yaml:"plainHTTP"`
+	Strict    bool              `yaml:"strict"`
+	Auth      authConfigSection `yaml:"auth"`
+	// CAFile is a PEM bundle of certificate authorities trusted for the registry
+	CAFile string `yaml:"caFile"`
+	// CertFile and KeyFile are the client certificate for registries requiring mutual TLS
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// Prefix is the path the charts and images are pushed under, e.g. 'mirror' for 'myregistry.io/mirror/<repository>'
+	Prefix string `yaml:"prefix"`
+	// Flatten drops the path of the source repositories of images, e.g. 'myregistry.io/prometheus' for 'quay.io/prometheus/prometheus'
+	Flatten bool `yaml:"flatten"`
+	// Harbor creates missing projects through the Harbor API before pushing, as pushes to missing projects fail
+	Harbor struct {
+		CreateProjects bool `yaml:"createProjects"`
+		// Public makes created projects public
+		Public bool `yaml:"public"`
+		// CheckQuota fails pushes to projects that have used their storage quota
+		CheckQuota bool `yaml:"checkQuota"`
+		// URL of the Harbor API. Defaults to the host of the registry
+		URL string `yaml:"url"`
+	} `yaml:"harbor"`
+	// Fallback is the registry images are pushed to when pushes to the registry fail after the retries
+	Fallback *registryConfigSection `yaml:"fallback"`
+	// ChartRepository uploads the charts to a classic chart repository instead of the registry
+	ChartRepository *chartRepositoryConfigSection `yaml:"chartRepository"`
+	// Route restricts the charts and images pushed to the registry. Empty pushes everything
+	Route struct {
+		// Charts are glob patterns of the chart names pushed to the registry with their images, e.g. 'prometheus-*'
+		Charts []string `yaml:"charts"`
+		// Images are glob patterns of images pushed to the registry regardless of their charts, e.g. 'docker.io/library/*'
+		Images []string `yaml:"images"`
+		// Releases only pushes release versions of charts
+		Releases bool `yaml:"releases"`
+	} `yaml:"route"`
+}
+
+// url is the URL of the registry with the prefix
+func (r registryConfigSection) url() string {
+	if p := strings.Trim(r.Prefix, "/"); p != "" {
+		return strings.TrimSuffix(r.URL, "/") + "/" + p
+	}
+	return r.URL
+}
+
+func (r registryConfigSection) registry() registry.Registry {
+	res := registry.Registry{
+		Name:      r.Name,
+		URL:       r.url(),
+		PlainHTTP: r.PlainHTTP,
+		Insecure:  r.Insecure,
+		Strict:    r.Strict,
+		Flatten:   r.Flatten,
+		HarborProjects: registry.HarborProjects{
+			Create: r.Harbor.CreateProjects,
+			Public: r.Harbor.Public,
+			Quota:  r.Harbor.CheckQuota,
+			URL:    r.Harbor.URL,
+			// the projects are checked once per run, as the configuration is loaded per run
+			Ensured: &sync.Map{},
+		},
+		Auth:     r.Auth.auth(),
+		CAFile:   r.CAFile,
+		CertFile: r.CertFile,
+		KeyFile:  r.KeyFile,
+		Route: registry.Route{
+			Charts:   r.Route.Charts,
+			Images:   r.Route.Images,
+			Releases: r.Route.Releases,
+		},
+	}
+	if c := r.ChartRepository; c != nil {
+		res.ChartRepository = &registry.ChartRepository{
+			Type:     c.Type,
+			URL:      c.URL,
+			Insecure: c.Insecure,
+			Auth:     c.Auth.auth(),
+			OCI:      c.OCI,
+		}
+	}
+	if r.Fallback != nil {
+		f := r.Fallback.registry()
+		if f.Name == "" {
+			f.Name = r.Name + "-fallback"
+		}
+		res.Fallback = &f
+	}
+	return res
+}
+
+// sourceRegistryConfigSection are the settings for pulling images from a source registry
+type sourceRegistryConfigSection struct {
+	// Host of the registry, e.g. 'docker.io'
+	Host      string            `yaml:"host"`
+	Auth      authConfigSection `yaml:"auth"`
+	CAFile    string            `yaml:"caFile"`
+	Insecure  bool              `yaml:"insecure"`
+	PlainHTTP bool              `yaml:"plainHTTP"`
+	// Proxy is the URL of the HTTP(S) proxy for the registry
+	Proxy string `yaml:"proxy"`
+	// RateLimit throttles the pulls from the registry, e.g. to stay within the Docker Hub pull quota
+	RateLimit struct {
+		RequestsPerSecond float64 `yaml:"requestsPerSecond"`
+		ConcurrentPulls   int     `yaml:"concurrentPulls"`
+	} `yaml:"rateLimit"`
+}
+
+func (s sourceRegistryConfigSection) source() registry.Source {
+	return registry.Source{
+		Host:      s.Host,
+		Auth:      s.Auth.auth(),
+		CAFile:    s.CAFile,
+		Insecure:  s.Insecure,
+		PlainHTTP: s.PlainHTTP,
+		Proxy:     s.Proxy,
+
+		RequestsPerSecond: s.RateLimit.RequestsPerSecond,
+		ConcurrentPulls:   s.RateLimit.ConcurrentPulls,
+	}
+}
+
+type cacheConfigSection struct {
+	registryConfigSection `yaml:",inline" mapstructure:",squash"`
+	Upstream              string `yaml:"upstream"`
+}
+
+type hookConfigSection struct {
+	Name        string            `yaml:"name"`
+	Stage       string            `yaml:"stage"`
+	Command     []string          `yaml:"command"`
+	URL         string            `yaml:"url"`
+	Headers     map[string]string `yaml:"headers"`
+	Timeout     time.Duration     `yaml:"timeout"`
+	FailOnError bool              `yaml:"failOnError"`
+}
+
+// hook validates the configuration of the hook
+func (c hookConfigSection) hook() (hooks.Hook, error) {
+	if !slices.Contains(hooks.Stages, c.Stage) {
+		s := `
+hooks:
+  - name: notify
+    stage: import  <--- parse, import, patch or sign
+    url: https://deploy.internal/hooks/helmper
+`
+		return hooks.Hook{}, xerrors.Errorf("You have configured the hook '%s' for the unsupported stage '%s'. Please change the value and try again...\nExample config:\n%s", c.Name, c.Stage, s)
+	}
+	if (len(c.Command) == 0) == (c.URL == "") {
+		got := "neither a command nor a url"
+		if c.URL != "" {
+			got = "both a command and a url"
+		}
+		s := `
+hooks:
+  - name: notify
+    stage: import
+    command: ["./notify.sh"]  <--- either a command
+    # url: https://deploy.internal/hooks/helmper  <--- or a url
+`
+		return hooks.Hook{}, xerrors.Errorf("You have configured the hook '%s' with %s. Please configure exactly one of the two and try again...\nExample config:\n%s", c.Name, got, s)
+	}
+	name := c.Name
+	if name == "" {
+		name = c.URL
+		if len(c.Command) > 0 {
+			name = c.Command[0]
+		}
+	}
+	return hooks.Hook{
+		Name:        name,
+		Stage:       c.Stage,
+		Command:     c.Command,
+		URL:         c.URL,
+		Headers:     c.Headers,
+		Timeout:     c.Timeout,
+		FailOnError: c.FailOnError,
+	}, nil
+}
+
+type sinkConfigSection struct {
+	Type    string            `yaml:"type"`
+	Path    string            `yaml:"path"`
+	Bucket  string            `yaml:"bucket"`
+	Prefix  string            `yaml:"prefix"`
+	Region  string            `yaml:"region"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	// Token is the API key of DefectDojo and Dependency-Track
+	Token string `yaml:"token"`
+	// Projects map image repositories to DefectDojo products or Dependency-Track projects, e.g. 'quay.io/prometheus/*' to 'prometheus'
+	Projects []struct {
+		From  string `yaml:"from"`
+		To    string `yaml:"to"`
+		Regex bool   `yaml:"regex"`
+	} `yaml:"projects"`
+	Engagement  string `yaml:"engagement"`
+	ProductType string `yaml:"productType"`
+	// When the sink receives runs: always, changes or failure
+	When string `yaml:"when"`
+}
+
+// sink validates the configuration of the sink
+func (c sinkConfigSection) sink() (sink.Config, error) {
+	var missing, s string
+	switch c.Type {
+	case sink.TypeFile:
+		if c.Path == "" {
+			missing, s = "path", `
+sinks:
+  - type: file
+    path: /workspace/.out/summary  <---
+`
+		}
+	case sink.TypeS3:
+		if c.Bucket == "" {
+			missing, s = "bucket", `
+sinks:
+  - type: s3
+    bucket: helmper-reports  <---
+    prefix: prod
+`
+		}
+	case sink.TypeWebhook:
+		if c.URL == "" {
+			missing, s = "url", `
+sinks:
+  - type: webhook
+    url: https://hooks.slack.com/services/${SLACK_WEBHOOK}  <---
+`
+		}
+	case sink.TypeSlack, sink.TypeTeams:
+		if c.URL == "" {
+			missing, s = "url", fmt.Sprintf(`
+sinks:
+  - type: %s
+    url: ${%s_WEBHOOK_URL}  <---
+    when: changes
+`, c.Type, strings.ToUpper(c.Type))
+		}
+	case sink.TypeStdout:
+	case sink.TypeDefectDojo, sink.TypeDependencyTrack:
+		switch {
+		case c.URL == "":
+			missing = "url"
+		case c.Token == "":
+			missing = "token"
+		}
+		s = fmt.Sprintf(`
+sinks:
+  - type: %s
+    url: https://%s.internal  <---
+    token: ${API_KEY}  <---
+`, c.Type, c.Type)
+	default:
+		s = `
+sinks:
+  - type: file  <--- file, s3, webhook, slack, teams, stdout, defectdojo or dependencytrack
+    path: /workspace/.out/summary
+`
+		return sink.Config{}, xerrors.Errorf("You have configured a sink of unsupported type '%s'. Please change the value and try again...\nExample config:\n%s", c.Type, s)
+	}
+	if missing != "" {
+		return sink.Config{}, xerrors.Errorf("You have configured a %s sink without the %s. Please add the value and try again...\nExample config:\n%s", c.Type, missing, s)
+	}
+
+	switch c.When {
+	case "", sink.WhenAlways, sink.WhenChanges, sink.WhenFailure:
+	default:
+		s = fmt.Sprintf(`
+sinks:
+  - type: %s
+    when: changes  <--- always, changes or failure
+`, c.Type)
+		return sink.Config{}, xerrors.Errorf("You have configured a %s sink with the unsupported value '%s' for when. Please change the value and try again...\nExample config:\n%s", c.Type, c.When, s)
+	}
+
+	projects := []registry.Rewrite{}
+	for _, p := range c.Projects {
+		r := registry.Rewrite{From: p.From, To: p.To, Regex: p.Regex}
+		if err := r.Validate(); err != nil {
+			return sink.Config{}, xerrors.Errorf("You have configured a %s sink with an invalid project mapping: %s", c.Type, err)
+		}
+		projects = append(projects, r)
+	}
+
+	return sink.Config{
+		Type:        c.Type,
+		Path:        c.Path,
+		Bucket:      c.Bucket,
+		Prefix:      c.Prefix,
+		Region:      c.Region,
+		URL:         c.URL,
+		Headers:     c.Headers,
+		Token:       c.Token,
+		Projects:    projects,
+		Engagement:  c.Engagement,
+		ProductType: c.ProductType,
+		When:        c.When,
+	}, nil
 }
 
 type ParserConfigSection struct {
 	DisableImageDetection bool `yaml:"disableImageDetection"`
 	UseCustomValues       bool `yaml:"useCustomValues"`
+	RenderedOnly          bool `yaml:"renderedOnly"`
+	// RenderedImages adds the images referenced in the rendered charts that are not found in the values
+	RenderedImages bool `yaml:"renderedImages"`
+	// Patterns extend the keys of the values images are detected by, e.g. 'imageName' and 'imageVersion'
+	Patterns helm.Patterns `yaml:"patterns"`
+	// Siblings discovers the variants of the images by tag convention, e.g. '1.25-alpine' for '1.25'
+	Siblings SiblingsConfigSection `yaml:"siblings"`
+}
+
+// SiblingsConfigSection discovers the variants of the images, reported for review, and imports them if Import is set
+type SiblingsConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	Import  bool `yaml:"import"`
+	// Variants extend the built-in tag suffixes of variants, e.g. 'perl' for '1.25-perl'
+	Variants []string `yaml:"variants"`
+}
+
+// StateConfigSection selects the state store backend: 'file' (default) and 'bolt' at Path, 'postgres' at DSN or 's3' in Bucket
+type StateConfigSection struct {
+	Type   string `yaml:"type"`
+	Path   string `yaml:"path"`
+	DSN    string `yaml:"dsn"`
+	Bucket string `yaml:"bucket"`
+	Prefix string `yaml:"prefix"`
+	Region string `yaml:"region"`
+}
+
+// Enabled reports whether a state store is configured
+func (s StateConfigSection) Enabled() bool {
+	return s.Path != "" || s.Type != ""
+}
+
+// Open opens the state store
+func (s StateConfigSection) Open(ctx context.Context) (*store.Store, error) {
+	b, err := store.New(ctx, store.Config{
+		Type:   s.Type,
+		Path:   s.Path,
+		DSN:    s.DSN,
+		Bucket: s.Bucket,
+		Prefix: s.Prefix,
+		Region: s.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return store.OpenBackend(ctx, b)
+}
+
+type ValuesConfigSection struct {
+	Folder string `yaml:"folder"`
+}
+
+type LineageConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+type LicensesConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	// File the license inventory is written to
+	File string `yaml:"file"`
+}
+
+// PullSecretsConfigSection creates a robot account allowed to pull the imported repositories in every listed Harbor registry,
+// a deploy token in every listed GitLab group and a robot account in every listed Quay organization,
+// and writes their credentials as an imagePullSecret
+type PullSecretsConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	// Registries are the names of the Harbor registries to create robot accounts in
+	Registries []string `yaml:"registries"`
+	// GitLab are the GitLab groups to create deploy tokens in
+	GitLab []GitLabPullSecretConfig `yaml:"gitlab"`
+	// Quay are the Quay organizations to create robot accounts in
+	Quay []QuayPullSecretConfig `yaml:"quay"`
+	// Name of the robot accounts and the Secret
+	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace"`
+	// Duration is the number of days the robot accounts are valid, -1 never expires
+	Duration int `yaml:"duration"`
+	// File the Secret is written to
+	File string `yaml:"file"`
+}
+
+// GitLabPullSecretConfig is a GitLab group whose deploy token pulls from the named registry
+type GitLabPullSecretConfig struct {
+	Registry string `yaml:"registry"`
+	// URL of the GitLab instance, e.g. https://gitlab.example.com
+	URL   string `yaml:"url"`
+	Group string `yaml:"group"`
+	// Token is a group access token with the api scope. Environment variables are expanded
+	Token string `yaml:"token"`
+}
+
+// QuayPullSecretConfig is a Quay organization whose robot account pulls from the named registry
+type QuayPullSecretConfig struct {
+	Registry string `yaml:"registry"`
+	// URL of the Quay API, defaults to the host of the registry
+	URL          string `yaml:"url"`
+	Organization string `yaml:"organization"`
+	// Token is an OAuth access token of the organization. Environment variables are expanded
+	Token string `yaml:"token"`
+}
+
+type VerifyConfigSection struct {
+	Enabled    bool          `yaml:"enabled"`
+	Kubeconfig string        `yaml:"kubeconfig"`
+	Namespace  string        `yaml:"namespace"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+// WatchConfigSection schedules the runs of 'helmper watch', with a cron expression or a fixed interval
+type WatchConfigSection struct {
+	Schedule string        `yaml:"schedule"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Next returns the time of the next run after t
+func (w WatchConfigSection) Next(t time.Time) (time.Time, error) {
+	if w.Schedule == "" {
+		return t.Add(w.Interval), nil
+	}
+	s, err := cron.ParseStandard(w.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.Next(t), nil
+}
+
+// StandbyConfigSection configures 'helmper standby', verifying that a disaster recovery registry mirrors every chart and image of the lockfile
+type StandbyConfigSection struct {
+	// Primary is the name of the registry whose digests in the lockfile are expected in the standby registry. Defaults to the first registry
+	Primary string `yaml:"primary"`
+	// Signatures verifies the Cosign signatures of the charts and images in the standby registry
+	Signatures BundleVerifyConfigSection `yaml:"signatures"`
+	// Schedule or Interval repeat the verification with --watch
+	WatchConfigSection `yaml:",inline" mapstructure:",squash"`
+	// Mirror is the standby registry
+	Mirror registry.Registry `yaml:"-" mapstructure:"-"`
+}
+
+type standbyConfigSection struct {
+	StandbyConfigSection `yaml:",inline" mapstructure:",squash"`
+	Registry             *registryConfigSection `yaml:"registry"`
+}
+
+// ServeConfigSection configures the REST API of 'helmper serve'
+type ServeConfigSection struct {
+	Address string `yaml:"address"`
+	// GRPCAddress is the address of the gRPC API. The gRPC API is disabled without an address
+	GRPCAddress string `yaml:"grpcAddress"`
+	// Token is the bearer token required by the API. Environment variables are expanded. Without a token, the API is open and
+	// only listens on the loopback interface
+	Token string `yaml:"token"`
+	// History is the number of finished runs kept
+	History int `yaml:"history"`
+}
+
+// ToolsConfigSection ships the external dependencies of the pipeline in the bundle of 'helmper export'
+type ToolsConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	// Tools override the pinned default tools with the same name, or add tools
+	Tools []registry.Tool `yaml:"tools"`
+	// Folder 'helmper load' writes the Buildkit and Trivy configuration to
+	Folder string `yaml:"folder"`
+}
+
+// List returns the default tools with the configured tools applied
+func (t ToolsConfigSection) List() []registry.Tool {
+	res := append([]registry.Tool{}, registry.DefaultTools...)
+	for _, c := range t.Tools {
+		found := false
+		for i := range res {
+			if res[i].Name == c.Name {
+				res[i], found = c, true
+			}
+		}
+		if !found {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+type IdentityConfigSection struct {
+	Issuer        string `yaml:"issuer"`
+	IssuerRegExp  string `yaml:"issuerRegExp"`
+	Subject       string `yaml:"subject"`
+	SubjectRegExp string `yaml:"subjectRegExp"`
+}
+
+type SourceSignaturesConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	// Policy is 'enforce' to fail the run on images without valid signatures, or 'warn' to only report them
+	Policy     string                  `yaml:"policy"`
+	KeyRef     string                  `yaml:"keyRef"`
+	Identities []IdentityConfigSection `yaml:"identities"`
+	RekorURL   string                  `yaml:"rekorURL"`
+	IgnoreTlog bool                    `yaml:"ignoreTlog"`
+}
+
+// PinningConfigSection checks that the values of the charts reference the images by pinned tags or digests
+type PinningConfigSection struct {
+	Enabled bool `yaml:"enabled"`
+	// Policy is 'enforce' to fail the run on charts with unpinned images, or 'warn' to only report them
+	Policy string `yaml:"policy"`
+	// RequireDigest flags every image referenced without a digest, not only images with moving tags
+	RequireDigest bool `yaml:"requireDigest"`
+	// Rewrite references the flagged images by digest in the values of the imported charts
+	Rewrite bool `yaml:"rewrite"`
+}
+
+// PolicyConfigSection are the Rego policies deciding which charts and images are imported, patched and signed
+type PolicyConfigSection struct {
+	// Paths are the files and directories of the policies, in 'package helmper'
+	Paths []string `yaml:"paths"`
+}
+
+// BundleConfigSection signs the bundles of 'helmper export' and verifies them in 'helmper load'
+type BundleConfigSection struct {
+	// Sign signs the bundle with the Cosign key, or keyless, of import.cosign
+	Sign   bool                      `yaml:"sign"`
+	Verify BundleVerifyConfigSection `yaml:"verify"`
+}
+
+// BundleVerifyConfigSection verifies the signature of bundles with a public key or keyless identities before they are loaded
+type BundleVerifyConfigSection struct {
+	Enabled    bool                    `yaml:"enabled"`
+	KeyRef     string                  `yaml:"keyRef"`
+	Identities []IdentityConfigSection `yaml:"identities"`
+	RekorURL   string                  `yaml:"rekorURL"`
+	IgnoreTlog bool                    `yaml:"ignoreTlog"`
+}
+
+type AttestationConfigSection struct {
+	Enabled bool   `yaml:"enabled"`
+	Report  string `yaml:"report"`
+}
+
+// GroupConfigSection is a group of charts imported as a stage. Groups run in the order they are configured
+type GroupConfigSection struct {
+	Name string `yaml:"name"`
+	// Gate stops the following groups if the group fails
+	Gate bool `yaml:"gate"`
+}
+
+// SourceConfigSection is an input of images besides the charts, a kustomization directory or plain manifests
+type SourceConfigSection struct {
+	Name      string   `yaml:"name"`
+	Kustomize string   `yaml:"kustomize"`
+	Manifests []string `yaml:"manifests"`
+}
+
+// DiscoveryConfigSection derives charts from the Flux HelmReleases and ArgoCD Applications in manifests or a live cluster
+type DiscoveryConfigSection struct {
+	Manifests  []string `yaml:"manifests"`
+	Cluster    bool     `yaml:"cluster"`
+	Kubeconfig string   `yaml:"kubeconfig"`
+	Context    string   `yaml:"context"`
+	Namespaces []string `yaml:"namespaces"`
 }
 
 type MirrorConfigSection struct {
 	Registry string `yaml:"registry"`
 	Mirror   string `yaml:"mirror"`
+	// From and To rewrite the repositories matching a glob, or a regular expression with Regex, instead of the registry host
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+	Regex bool   `yaml:"regex"`
+}
+
+// rewrite is the rewrite rule of the mirror
+func (m MirrorConfigSection) rewrite() registry.Rewrite {
+	return registry.Rewrite{From: m.From, To: m.To, Regex: m.Regex}
+}
+
+// Apply returns the repository, given with its registry, in the mirror, and if the mirror applies to it
+func (m MirrorConfigSection) Apply(repository string) (string, bool, error) {
+	if m.From != "" {
+		return m.rewrite().Apply(repository)
+	}
+	host, rest, _ := strings.Cut(repository, "/")
+	if host != m.Registry {
+		return repository, false, nil
+	}
+	return m.Mirror + "/" + rest, true, nil
+}
+
+// imagesConfigSection are the images to include in the import, and the policy on the images of all charts and sources.
+// A list of images is read as the images to include
+type imagesConfigSection struct {
+	ImagePolicyConfigSection `yaml:",inline" mapstructure:",squash"`
+	Include                  []imageConfigSection `yaml:"include"`
+}
+
+// ImagePolicyConfigSection allows and denies the source repositories of the images of all charts, after the mirrors are applied.
+// Patterns are globs of the repositories with their registry, e.g. 'docker.io/*'
+type ImagePolicyConfigSection struct {
+	// Allow only admits the images matching one of the patterns. All images are admitted if empty
+	Allow []string `yaml:"allow"`
+	// Deny rejects the images matching one of the patterns, even if they are allowed
+	Deny []string `yaml:"deny"`
+}
+
+// matchAny reports if the repository matches one of the glob patterns
+func matchAny(patterns []string, repository string) bool {
+	for _, p := range patterns {
+		if _, ok, _ := (registry.Rewrite{From: p}).Apply(repository); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports if the policy admits the repository, given with its registry, e.g. 'docker.io/library/nginx'
+func (p ImagePolicyConfigSection) Allowed(repository string) bool {
+	if len(p.Allow) > 0 && !matchAny(p.Allow, repository) {
+		return false
+	}
+	return !matchAny(p.Deny, repository)
 }
 
 type config struct {
-	Parser       ParserConfigSection     `yaml:"parser"`
-	ImportConfig ImportConfigSection     `yaml:"import"`
-	Images       []imageConfigSection    `yaml:"images"`
-	Registries   []registryConfigSection `yaml:"registries"`
-	Mirrors      []MirrorConfigSection   `yaml:"mirrors"`
+	Parser           ParserConfigSection           `yaml:"parser"`
+	ImportConfig     ImportConfigSection           `yaml:"import"`
+	Images           imagesConfigSection           `yaml:"images"`
+	Registries       []registryConfigSection       `yaml:"registries"`
+	Caches           []cacheConfigSection          `yaml:"caches"`
+	SourceRegistries []sourceRegistryConfigSection `yaml:"sourceRegistries"`
+	Sinks            []sinkConfigSection           `yaml:"sinks"`
+	Hooks            []hookConfigSection           `yaml:"hooks"`
+	Mirrors          []MirrorConfigSection         `yaml:"mirrors"`
+	Groups           []GroupConfigSection          `yaml:"groups"`
+	Sources          []SourceConfigSection         `yaml:"sources"`
+	Discovery        DiscoveryConfigSection        `yaml:"discovery"`
+	State            StateConfigSection            `yaml:"state"`
+	Attestation      AttestationConfigSection      `yaml:"attestation"`
+	Values           ValuesConfigSection           `yaml:"values"`
+	Lineage          LineageConfigSection          `yaml:"lineage"`
+	Licenses         LicensesConfigSection         `yaml:"licenses"`
+	PullSecrets      PullSecretsConfigSection      `yaml:"pullSecrets"`
+	Verify           VerifyConfigSection           `yaml:"verify"`
+	SourceSignatures SourceSignaturesConfigSection `yaml:"sourceSignatures"`
+	Pinning          PinningConfigSection          `yaml:"pinning"`
+	Bundle           BundleConfigSection           `yaml:"bundle"`
+	Policy           PolicyConfigSection           `yaml:"policy"`
+	Watch            WatchConfigSection            `yaml:"watch"`
+	Tools            ToolsConfigSection            `yaml:"tools"`
+	Standby          standbyConfigSection          `yaml:"standby"`
+	Serve            ServeConfigSection            `yaml:"serve"`
+	Tracing          TracingConfigSection          `yaml:"tracing"`
 }
 
-// Reads flags from user and sets state accordingly
-func LoadViperConfiguration(_ []string) (*viper.Viper, error) {
-	viper := viper.New()
+var watchOnce sync.Once
 
-	pflag.String("f", "unused", "path to configuration file")
+// progressPath is the default progress file of the configuration file, so batch jobs and configurations do not resume each other's runs
+func progressPath(config string) string {
+	abs, err := filepath.Abs(config)
+	if err != nil {
+		abs = config
+	}
+	name := strings.TrimSuffix(filepath.Base(config), filepath.Ext(config))
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(".out", fmt.Sprintf("progress-%s-%x.json", name, sum[:4]))
+}
 
-	pflag.Parse()
-	viper.BindPFlags(pflag.CommandLine)
+// Reads the parsed flags and the configuration file and sets state accordingly
+func LoadViperConfiguration(flags *pflag.FlagSet) (*viper.Viper, error) {
+	return LoadViperConfigurationFile(flags, "")
+}
+
+// LoadViperConfigurationFile reads the parsed flags and the configuration file at path, instead of the file given by the 'f' flag
+func LoadViperConfigurationFile(flags *pflag.FlagSet, path string) (*viper.Viper, error) {
+	viper := viper.New()
+
+	if err := viper.BindPFlags(flags); err != nil {
+		return nil, err
+	}
+	if path != "" {
+		viper.Set("f", path)
+	}
 
 	// Configure Viper configuration paths
 	viper.SetConfigName("helmper") // name of config file (without extension)
@@ -115,14 +926,82 @@ func LoadViperConfiguration(_ []string) (*viper.Viper, error) {
 	viper.SetDefault("verbose", false)
 	viper.SetDefault("update", false)
 	viper.SetDefault("k8s_version", "1.27.16")
+	viper.SetDefault("lockfile", "")
+	viper.SetDefault("progress", progressPath(viper.ConfigFileUsed()))
+	viper.SetDefault("import.concurrency", 10)
+	viper.SetDefault("import.retries", 3)
+	viper.SetDefault("import.backoff", "1s")
+	viper.SetDefault("verify.namespace", "helmper-verify")
+	viper.SetDefault("verify.timeout", "5m")
+	viper.SetDefault("import.harbor.timeout", "1h")
+	viper.SetDefault("tools.folder", ".out/tools")
+	viper.SetDefault("import.blobCache.folder", ".out/blobs")
+	viper.SetDefault("import.blobCache.maxAge", "720h")
+	viper.SetDefault("sourceSignatures.policy", "enforce")
+	viper.SetDefault("pinning.policy", "warn")
+	viper.SetDefault("licenses.file", ".out/licenses.json")
+	viper.SetDefault("pullSecrets.name", "helmper-pull")
+	viper.SetDefault("pullSecrets.namespace", "default")
+	viper.SetDefault("pullSecrets.duration", -1)
+	viper.SetDefault("pullSecrets.file", ".out/pull-secret.yaml")
+	viper.SetDefault("serve.address", "127.0.0.1:8080")
+	viper.SetDefault("serve.history", 100)
+
+	// API versions are read as []any from the configuration file
+	viper.Set("api_versions", viper.GetStringSlice("api_versions"))
 
 	// Unmarshal charts config section
 	inputConf := helm.ChartCollection{}
 	if err := viper.Unmarshal(&inputConf); err != nil {
 		return nil, err
 	}
+	// the problems of the configuration are collected, so they are reported at once before any work starts
+	problems := []error{}
+	for n, c := range inputConf.Charts {
+		pc, err := c.WithPreset()
+		if err != nil {
+			s := fmt.Sprintf(`
+charts:
+- name: %s
+  version: "%s"
+  preset: %s  <--- built-in preset, e.g. argo-cd or argo-cd@v1
+`, c.Name, c.Version, c.Preset)
+			problems = append(problems, xerrors.Errorf("You have configured chart '%s' with an unknown preset: %s. Please change the value and try again...\nExample config:\n%s", c.Name, err, s))
+			continue
+		}
+		inputConf.Charts[n] = pc
+
+		switch c.Resolve {
+		case "", helm.ResolveAll, helm.ResolveLatest, helm.ResolveNewer:
+		default:
+			s := fmt.Sprintf(`
+charts:
+- name: %s
+  version: "%s"
+  resolve: latest  <--- all, latest or newer
+`, c.Name, c.Version)
+			problems = append(problems, xerrors.Errorf("You have configured chart '%s' with the unsupported version resolution '%s'. Please change the value and try again...\nExample config:\n%s", c.Name, c.Resolve, s))
+		}
+		if c.Latest < 0 {
+			s := fmt.Sprintf(`
+charts:
+- name: %s
+  version: "%s"
+  latest: 5  <--- number of versions to import
+`, c.Name, c.Version)
+			problems = append(problems, xerrors.Errorf("You have configured chart '%s' to import the latest %d versions. Please change the value and try again...\nExample config:\n%s", c.Name, c.Latest, s))
+		}
+	}
+	if err := filterCharts(viper, &inputConf); err != nil {
+		return nil, err
+	}
 	viper.Set("input", inputConf)
 
+	// images is a list of the images to include, or a mapping with the images to include and the image policy
+	if is, ok := viper.Get("images").([]any); ok {
+		viper.Set("images", map[string]any{"include": is})
+	}
+
 	// Unmarshal registries config section
 	conf := config{}
 	if err := viper.Unmarshal(&conf); err != nil {
@@ -131,49 +1010,392 @@ func LoadViperConfiguration(_ []string) (*viper.Viper, error) {
 	viper.Set("config", conf)
 	viper.Set("parserConfig", conf.Parser)
 	viper.Set("mirrorConfig", conf.Mirrors)
+	viper.Set("imagePolicyConfig", conf.Images.ImagePolicyConfigSection)
+
+	groups := map[string]bool{}
+	for _, g := range conf.Groups {
+		if g.Name == "" || groups[g.Name] {
+			s := `
+groups:
+- name: core  <--- unique
+  gate: true
+`
+			problems = append(problems, xerrors.Errorf("Every chart group needs a unique name, but '%s' is not. Please fix the group and try again...\nExample config:\n%s", g.Name, s))
+		}
+		groups[g.Name] = true
+	}
+	for _, c := range inputConf.Charts {
+		if c.Group != "" && !groups[c.Group] {
+			s := fmt.Sprintf(`
+groups:
+- name: %s  <---
+charts:
+- name: %s
+  group: %s
+`, c.Group, c.Name, c.Group)
+			problems = append(problems, xerrors.Errorf("You have configured chart '%s' in the group '%s', which is not in the groups. Please add the group and try again...\nExample config:\n%s", c.Name, c.Group, s))
+		}
+	}
+	viper.Set("groupsConfig", conf.Groups)
+
+	sources := map[string]bool{}
+	srcs := []source.Source{}
+	for _, s := range conf.Sources {
+		if s.Name == "" || sources[s.Name] {
+			e := `
+sources:
+- name: web  <--- unique
+  kustomize: deploy/overlays/prod
+`
+			problems = append(problems, xerrors.Errorf("Every source needs a unique name, but '%s' is not. Please fix the source and try again...\nExample config:\n%s", s.Name, e))
+			continue
+		}
+		sources[s.Name] = true
+		if (s.Kustomize == "") == (len(s.Manifests) == 0) {
+			e := fmt.Sprintf(`
+sources:
+- name: %s
+  kustomize: deploy/overlays/prod  <--- either kustomize
+  manifests:                       <--- or manifests
+  - deploy/*.yaml
+`, s.Name)
+			problems = append(problems, xerrors.Errorf("You have configured source '%s' with both or none of a kustomization and manifests. Please fix the source and try again...\nExample config:\n%s", s.Name, e))
+			continue
+		}
+		srcs = append(srcs, source.Source{Name: s.Name, Kustomize: s.Kustomize, Manifests: s.Manifests})
+	}
+	state.SetValue(viper, "sources", srcs)
+	if !conf.Discovery.Cluster && (conf.Discovery.Kubeconfig != "" || conf.Discovery.Context != "" || len(conf.Discovery.Namespaces) > 0) {
+		e := `
+discovery:
+  cluster: true  <---
+  context: prod
+  namespaces:
+  - flux-system
+`
+		problems = append(problems, xerrors.Errorf("You have configured the cluster to discover charts in, but not enabled the discovery in the cluster. Please enable it and try again...\nExample config:\n%s", e))
+	}
+	state.SetValue(viper, "discovery", discovery.Discovery{
+		Manifests:  conf.Discovery.Manifests,
+		Cluster:    conf.Discovery.Cluster,
+		Kubeconfig: conf.Discovery.Kubeconfig,
+		Context:    conf.Discovery.Context,
+		Namespaces: conf.Discovery.Namespaces,
+	})
+	if conf.State.Enabled() {
+		missing := ""
+		switch conf.State.Type {
+		case store.TypeFile, store.TypeBolt, "":
+			if conf.State.Path == "" {
+				missing = "path: /workspace/.out/state.db  <---"
+			}
+		case store.TypePostgres:
+			if conf.State.DSN == "" {
+				missing = "dsn: postgres://helmper@db:5432/helmper  <---"
+			}
+		case store.TypeS3:
+			if conf.State.Bucket == "" {
+				missing = "bucket: helmper-state  <---"
+			}
+		default:
+			s := `
+state:
+  type: file  <--- file, bolt, postgres or s3
+`
+			problems = append(problems, xerrors.Errorf("You have configured the unsupported state store type '%s'. Please change the value and try again...\nExample config:\n%s", conf.State.Type, s))
+		}
+		if missing != "" {
+			s := fmt.Sprintf(`
+state:
+  type: %s
+  %s
+`, conf.State.Type, missing)
+			problems = append(problems, xerrors.Errorf("You have configured a '%s' state store without its location. Please add the value and try again...\nExample config:\n%s", conf.State.Type, s))
+		}
+	}
+	viper.Set("stateConfig", conf.State)
+	viper.Set("attestationConfig", conf.Attestation)
+	viper.Set("valuesConfig", conf.Values)
+	viper.Set("lineageConfig", conf.Lineage)
+	viper.Set("licensesConfig", conf.Licenses)
+	viper.Set("pullSecretsConfig", conf.PullSecrets)
+	viper.Set("verifyConfig", conf.Verify)
+
+	if conf.SourceSignatures.Enabled {
+		if conf.SourceSignatures.KeyRef == "" && len(conf.SourceSignatures.Identities) == 0 {
+			s := `
+sourceSignatures:
+  enabled: true
+  keyRef: cosign.pub  <--- or
+  identities:         <---
+    - issuer: https://token.actions.githubusercontent.com
+      subjectRegExp: ^https://github.com/prometheus/
+`
+			problems = append(problems, xerrors.Errorf("You have enabled source signature verification but did not specify a public key or keyless identities. Please add the value and try again...\nExample config:\n%s", s))
+		}
+		if conf.SourceSignatures.Policy != "enforce" && conf.SourceSignatures.Policy != "warn" {
+			s := `
+sourceSignatures:
+  enabled: true
+  policy: enforce  <--- enforce or warn
+`
+			problems = append(problems, xerrors.Errorf("You have enabled source signature verification with an unsupported policy '%s'. Please change the value and try again...\nExample config:\n%s", conf.SourceSignatures.Policy, s))
+		}
+	}
+	viper.Set("sourceSignaturesConfig", conf.SourceSignatures)
+
+	if conf.Bundle.Verify.Enabled && conf.Bundle.Verify.KeyRef == "" && len(conf.Bundle.Verify.Identities) == 0 {
+		s := `
+bundle:
+  verify:
+    enabled: true
+    keyRef: cosign.pub  <--- or
+    identities:         <---
+      - issuer: https://token.actions.githubusercontent.com
+        subjectRegExp: ^https://github.com/my-org/
+`
+		problems = append(problems, xerrors.Errorf("You have enabled bundle verification but did not specify a public key or keyless identities. Please add the value and try again...\nExample config:\n%s", s))
+	}
+	viper.Set("bundleConfig", conf.Bundle)
+
+	if len(conf.Policy.Paths) > 0 {
+		if _, err := policy.Load(context.Background(), conf.Policy.Paths); err != nil {
+			s := `
+policy:
+  paths:
+  - policies/  <--- Rego files in 'package helmper'
+`
+			problems = append(problems, xerrors.Errorf("You have configured policies that can not be compiled: %v. Please fix the policies and try again...\nExample config:\n%s", err, s))
+		}
+	}
+	viper.Set("policyConfig", conf.Policy)
+
+	if conf.Watch.Schedule != "" {
+		if _, err := cron.ParseStandard(conf.Watch.Schedule); err != nil {
+			s := `
+watch:
+  schedule: "0 */6 * * *"  <--- minute hour day-of-month month day-of-week
+`
+			problems = append(problems, xerrors.Errorf("You have scheduled the runs of 'helmper watch' with an invalid cron expression '%s' (%s). Please change the value and try again...\nExample config:\n%s", conf.Watch.Schedule, err, s))
+		}
+	}
+	viper.Set("watchConfig", conf.Watch)
+
+	if r := conf.Standby.Registry; r != nil {
+		if r.URL == "" {
+			s := `
+standby:
+  registry:
+    name: dr
+    url: dr.registry.io  <---
+`
+			problems = append(problems, xerrors.Errorf("You have configured a standby registry without its URL. Please add the value and try again...\nExample config:\n%s", s))
+		}
+		conf.Standby.Mirror = r.registry()
+		if conf.Standby.Mirror.Name == "" {
+			conf.Standby.Mirror.Name = "standby"
+		}
+	}
+	if v := conf.Standby.Signatures; v.Enabled && v.KeyRef == "" && len(v.Identities) == 0 {
+		s := `
+standby:
+  signatures:
+    enabled: true
+    keyRef: cosign.pub  <--- or
+    identities:         <---
+      - issuer: https://token.actions.githubusercontent.com
+        subjectRegExp: ^https://github.com/my-org/
+`
+		problems = append(problems, xerrors.Errorf("You have enabled signature verification in the standby registry but did not specify a public key or keyless identities. Please add the value and try again...\nExample config:\n%s", s))
+	}
+	if conf.Standby.Schedule != "" {
+		if _, err := cron.ParseStandard(conf.Standby.Schedule); err != nil {
+			s := `
+standby:
+  schedule: "*/30 * * * *"  <--- minute hour day-of-month month day-of-week
+`
+			problems = append(problems, xerrors.Errorf("You have scheduled the verifications of 'helmper standby' with an invalid cron expression '%s' (%s). Please change the value and try again...\nExample config:\n%s", conf.Standby.Schedule, err, s))
+		}
+	}
+	viper.Set("standbyConfig", conf.Standby.StandbyConfigSection)
+
+	conf.Serve.Token = os.ExpandEnv(conf.Serve.Token)
+	viper.Set("serveConfig", conf.Serve)
+	for _, t := range conf.Tools.Tools {
+		if t.Name == "" || t.Ref == "" {
+			s := `
+tools:
+  enabled: true
+  tools:
+  - name: buildkit                                    <---
+    ref: docker.io/moby/buildkit:v0.15.1-rootless     <---
+`
+			problems = append(problems, xerrors.Errorf("You have configured a tool without a name or reference. Please add the values and try again...\nExample config:\n%s", s))
+			continue
+		}
+		// the bundle holds the tools by tag, and pins them to the digest
+		if i, err := registry.RefToImage(t.Ref); err != nil || i.Tag == "" {
+			problems = append(problems, xerrors.Errorf("You have configured the tool '%s' with the reference '%s' without a tag. Please add a tag, optionally with a digest, e.g. docker.io/moby/buildkit:v0.16.0-rootless@sha256:..., and try again...", t.Name, t.Ref))
+		}
+	}
+	viper.Set("toolsConfig", conf.Tools)
+
+	if conf.Tracing.Protocol != "" && conf.Tracing.Protocol != "grpc" && conf.Tracing.Protocol != "http" {
+		s := `
+tracing:
+  enabled: true
+  endpoint: otel-collector:4317
+  protocol: grpc  <--- grpc or http
+`
+		problems = append(problems, xerrors.Errorf("You have configured tracing with the unsupported protocol '%s'. Please change the value and try again...\nExample config:\n%s", conf.Tracing.Protocol, s))
+	}
+	viper.Set("tracingConfig", conf.Tracing)
 
 	importConf := ImportConfigSection{}
 	if err := viper.Unmarshal(&importConf); err != nil {
 		return nil, err
 	}
 
-	if importConf.Import.Cosign.Enabled && importConf.Import.Cosign.KeyRef == "" {
+	if err := crossValidate(conf, importConf, viper.GetBool("dry-run") || viper.GetString("dry-run-script") != ""); err != nil {
+		problems = append(problems, err)
+	}
+
+	// the flagged images are rewritten by pinning them to their digest
+	if conf.Pinning.Enabled && conf.Pinning.Rewrite {
+		if conf.Pinning.RequireDigest {
+			importConf.Import.PinDigests = true
+		} else {
+			importConf.Import.PinMovingTags = true
+		}
+	}
+	viper.Set("pinningConfig", conf.Pinning)
+
+	if conf.Attestation.Enabled && importConf.Import.Cosign.Keyless {
 		s := `
 import:
   cosign:
     enabled: true
-    keyRef: ""     <---
+    keyless: true    <---
+    keyRef: cosign.key
+attestation:
+  enabled: true
 `
-		return nil, xerrors.Errorf("You have enabled cosign but did not specify any keyRef. Please specify a keyRef and try again..\nExample config:\n%s", s)
+		problems = append(problems, xerrors.Errorf("You have enabled attestations but attestations are signed with the Cosign key. Please disable keyless signing and try again..\nExample config:\n%s", s))
 	}
 
-	if importConf.Import.Cosign.Enabled && importConf.Import.Cosign.KeyRefPass == nil {
-		v := os.Getenv("COSIGN_PASSWORD")
-		slog.Info("KeyRefPass is nil, using value of COSIGN_PASSWORD environment variable")
-		importConf.Import.Cosign.KeyRefPass = &v
+	if conf.Attestation.Enabled && !importConf.Import.Cosign.Enabled {
+		s := `
+import:
+  cosign:
+    enabled: true    <---
+    keyRef: cosign.key
+attestation:
+  enabled: true
+`
+		problems = append(problems, xerrors.Errorf("You have enabled attestations but attestations are signed with Cosign. Please enable Cosign and try again..\nExample config:\n%s", s))
 	}
 
-	if importConf.Import.Copacetic.Enabled {
+	if importConf.Import.Cosign.Attach.SBOM && !importConf.Import.SBOM.Enabled {
+		s := `
+import:
+  sbom:
+    enabled: true    <---
+  cosign:
+    enabled: true
+    attach:
+      sbom: true
+`
+		problems = append(problems, xerrors.Errorf("You have enabled attaching SBOMs to the images but SBOM generation is disabled. Please enable SBOM generation and try again..\nExample config:\n%s", s))
+	}
 
-		if importConf.Import.Copacetic.Buildkitd.Addr == "" {
-			// use local socket by default
-			importConf.Import.Copacetic.Buildkitd.Addr = "unix:///run/buildkit/buildkitd.sock"
-		}
+	if importConf.Import.Cosign.Attach.Vulnerabilities && !importConf.Import.Copacetic.Enabled {
+		s := `
+import:
+  copacetic:
+    enabled: true    <---
+  cosign:
+    enabled: true
+    attach:
+      vulnerabilities: true
+`
+		problems = append(problems, xerrors.Errorf("You have enabled attaching vulnerability reports to the images but the images are only scanned with Copacetic enabled. Please enable Copacetic and try again..\nExample config:\n%s", s))
+	}
 
-		if importConf.Import.Copacetic.Trivy.Addr == "" {
+	if importConf.Import.FailOn != "" {
+		if !importConf.Import.Copacetic.Enabled {
 			s := `
 import:
+  failOn: CRITICAL
   copacetic:
+    enabled: true    <---
+`
+			problems = append(problems, xerrors.Errorf("You have enabled the severity gate but the images are only scanned with Copacetic enabled. Please enable Copacetic and try again..\nExample config:\n%s", s))
+		}
+		if _, err := dbTypes.NewSeverity(strings.ToUpper(importConf.Import.FailOn)); err != nil {
+			s := `
+import:
+  failOn: CRITICAL  <--- LOW, MEDIUM, HIGH or CRITICAL
+`
+			problems = append(problems, xerrors.Errorf("You have enabled the severity gate with an unknown severity '%s'. Please change the value and try again..\nExample config:\n%s", importConf.Import.FailOn, s))
+		}
+		switch importConf.Import.FailAction {
+		case "":
+			importConf.Import.FailAction = "fail"
+		case "fail", "skip", "quarantine":
+		default:
+			s := `
+import:
+  failOn: CRITICAL
+  failAction: quarantine  <--- fail, skip or quarantine
+`
+			problems = append(problems, xerrors.Errorf("You have enabled the severity gate with an unknown action '%s'. Please change the value and try again..\nExample config:\n%s", importConf.Import.FailAction, s))
+		}
+		if importConf.Import.Quarantine == "" {
+			importConf.Import.Quarantine = "quarantine"
+		}
+	}
+
+	if importConf.Import.Notation.Enabled {
+		if importConf.Import.Notation.KeyFile == "" || importConf.Import.Notation.CertFile == "" {
+			s := `
+import:
+  notation:
     enabled: true
-    trivy:
-      addr: http://0.0.0.0:8887  <---
+    keyFile: notation.key   <---
+    certFile: notation.crt  <---
 `
-			return nil, xerrors.Errorf("You have enabled copacetic patching but did not specify the path to the Trivy server. Please add the value and try again...\nExample config:\n%s", s)
+			problems = append(problems, xerrors.Errorf("You have enabled Notation but did not specify the signing key and certificate. Please add the values and try again..\nExample config:\n%s", s))
 		}
-		viper.OnConfigChange(func(e fsnotify.Event) {
-			slog.Info("Config file changed. It will not take effect before next run.", slog.String("config", e.Name))
-		})
-		viper.WatchConfig()
+		if _, err := notation.MediaType(importConf.Import.Notation.SignatureFormat); err != nil {
+			s := `
+import:
+  notation:
+    enabled: true
+    signatureFormat: jws  <--- jws or cose
+`
+			problems = append(problems, xerrors.Errorf("You have enabled Notation with an unsupported signature format '%s'. Please change the value and try again..\nExample config:\n%s", importConf.Import.Notation.SignatureFormat, s))
+		}
+	}
+
+	if conf.Bundle.Sign && !importConf.Import.Cosign.Enabled {
+		s := `
+bundle:
+  sign: true
+import:
+  cosign:
+    enabled: true  <---
+    keyRef: cosign.key
+`
+		problems = append(problems, xerrors.Errorf("You have enabled bundle signing but Cosign is disabled. Please enable Cosign and try again..\nExample config:\n%s", s))
+	}
+
+	if importConf.Import.Cosign.Enabled && importConf.Import.Cosign.KeyRefPass == nil {
+		v := os.Getenv("COSIGN_PASSWORD")
+		slog.Info("KeyRefPass is nil, using value of COSIGN_PASSWORD environment variable")
+		importConf.Import.Cosign.KeyRefPass = &v
+	}
+
+	if importConf.Import.Copacetic.Enabled {
 
 		if importConf.Import.Copacetic.Output.Reports.Folder == "" {
 			s := `
@@ -183,7 +1405,7 @@ copacetic:
     reports:
       folder: /workspace/.out/reports  <---
 `
-			return nil, xerrors.Errorf("You have enabled copacetic patching but did not specify the path to the reports output folder'. Please add the value and try again\nExample:\n%s", s)
+			problems = append(problems, xerrors.Errorf("You have enabled copacetic patching but did not specify the path to the reports output folder'. Please add the value and try again\nExample:\n%s", s))
 		}
 
 		if importConf.Import.Copacetic.Output.Tars.Folder == "" {
@@ -194,40 +1416,137 @@ copacetic:
     tars:
       folder: /workspace/.out/tars  <---
 `
-			return nil, xerrors.Errorf("You have enabled copacetic patching but did not specify the path to the tars output folder'. Please add the value and try again\nExample:\n%s", s)
+			problems = append(problems, xerrors.Errorf("You have enabled copacetic patching but did not specify the path to the tars output folder'. Please add the value and try again\nExample:\n%s", s))
+		}
+
+	}
+
+	if importConf.Import.SBOM.Enabled {
+		if importConf.Import.SBOM.Format == "" {
+			importConf.Import.SBOM.Format = trivy.FormatSPDX
+		}
+		if _, err := trivy.SBOMExtension(importConf.Import.SBOM.Format); err != nil {
+			s := `
+import:
+  sbom:
+    enabled: true
+    format: spdx  <--- spdx or cyclonedx
+`
+			problems = append(problems, xerrors.Errorf("You have enabled SBOM generation with an unsupported format '%s'. Please change the value and try again...\nExample config:\n%s", importConf.Import.SBOM.Format, s))
 		}
 
+		// SBOMs are stored alongside the vulnerability reports by default
+		if importConf.Import.SBOM.Folder == "" {
+			importConf.Import.SBOM.Folder = importConf.Import.Copacetic.Output.Reports.Folder
+		}
+		if importConf.Import.SBOM.Folder == "" {
+			s := `
+import:
+  sbom:
+    enabled: true
+    folder: /workspace/.out/sboms  <---
+`
+			problems = append(problems, xerrors.Errorf("You have enabled SBOM generation but did not specify the path to the SBOM output folder. Please add the value and try again\nExample:\n%s", s))
+		}
 	}
 
 	viper.Set("importConfig", importConf)
 
+	pulls := []registry.Source{}
+	for _, s := range conf.SourceRegistries {
+		pulls = append(pulls, s.source())
+	}
+	pullSources := registry.NewSources(pulls)
+	state.SetValue(viper, "sourceRegistries", pullSources)
+
 	rs := []registry.Registry{}
 	for _, r := range conf.Registries {
-		rs = append(rs,
-			registry.Registry{
-				Name:      r.Name,
-				URL:       r.URL,
-				PlainHTTP: r.PlainHTTP,
-				Insecure:  r.Insecure,
-			})
+		if r.Fallback != nil && r.Fallback.URL == "" {
+			s := fmt.Sprintf(`
+registries:
+- name: %s
+  url: %s
+  fallback:
+    url: registry.site-b.example.com  <---
+`, r.Name, r.URL)
+			problems = append(problems, xerrors.Errorf("You have configured a fallback for registry '%s' without a URL. Please add the value and try again...\nExample config:\n%s", r.Name, s))
+			continue
+		}
+		// images are pushed from the source registries, also to the fallback
+		reg := r.registry()
+		reg.Sources = pullSources
+		if c := importConf.Import.BlobCache; c.Enabled {
+			reg.BlobCache = c.Folder
+		}
+		if reg.Fallback != nil {
+			reg.Fallback.Sources = pullSources
+			reg.Fallback.BlobCache = reg.BlobCache
+		}
+		rs = append(rs, reg)
 	}
 	state.SetValue(viper, "registries", rs)
 
+	cs := []registry.Cache{}
+	for _, c := range conf.Caches {
+		if c.Upstream == "" {
+			s := `
+caches:
+  - name: dockerhub
+    url: harbor.internal/dockerhub
+    upstream: docker.io  <---
+`
+			problems = append(problems, xerrors.Errorf("You have configured the pull-through cache '%s' without the registry it proxies. Please add the value and try again...\nExample config:\n%s", c.URL, s))
+			continue
+		}
+		cs = append(cs, registry.Cache{Registry: c.registry(), Upstream: c.Upstream})
+	}
+	state.SetValue(viper, "caches", cs)
+
+	ss := []sink.Config{}
+	for _, c := range conf.Sinks {
+		sc, err := c.sink()
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		ss = append(ss, sc)
+	}
+	state.SetValue(viper, "sinks", ss)
+
+	hs := []hooks.Hook{}
+	for _, c := range conf.Hooks {
+		h, err := c.hook()
+		if err != nil {
+			problems = append(problems, err)
+			continue
+		}
+		hs = append(hs, h)
+	}
+	state.SetValue(viper, "hooksConfig", hs)
+
 	// TODO. Concert config.Images to Image{}
 	is := []registry.Image{}
-	for _, i := range conf.Images {
+	for _, i := range conf.Images.Include {
 		img, err := registry.RefToImage(i.Ref)
 		if err != nil {
-			return viper, err
+			problems = append(problems, err)
+			continue
 		}
 		is = append(is, img)
 	}
 	state.SetValue(viper, "images", is)
 
-	viper.OnConfigChange(func(e fsnotify.Event) {
-		slog.Info("Config file changed. It will not take effect before next run.", slog.String("config", e.Name))
+	if len(problems) > 0 {
+		return nil, errors.Join(problems...)
+	}
+
+	// the configuration is loaded again for every run of 'helmper watch', but watched once
+	watchOnce.Do(func() {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			slog.Info("Config file changed. It will not take effect before next run.", slog.String("config", e.Name))
+		})
+		viper.WatchConfig()
 	})
-	viper.WatchConfig()
 
 	return viper, nil
 }
@@ -0,0 +1,488 @@
+package bootstrap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/discovery"
+	"github.com/ChristofferNissen/helmper/pkg/hooks"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/source"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/pflag"
+)
+
+func TestLoadCaches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+caches:
+- name: dockerhub
+  url: harbor.internal/dockerhub
+  upstream: docker.io
+  plainHTTP: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := state.GetValue[[]registry.Cache](v, "caches")
+	if len(cs) != 1 {
+		t.Fatalf("want 1 cache got %d", len(cs))
+	}
+	if c := cs[0]; c.URL != "harbor.internal/dockerhub" || c.Upstream != "docker.io" || !c.PlainHTTP || c.Name != "dockerhub" {
+		t.Errorf("unexpected cache %+v", c)
+	}
+}
+
+func TestLoadRegistryPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+registries:
+- name: mirror
+  url: myregistry.io/
+  prefix: /mirror/
+  flatten: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs := state.GetValue[[]registry.Registry](v, "registries")
+	if len(rs) != 1 {
+		t.Fatalf("want 1 registry got %d", len(rs))
+	}
+	if r := rs[0]; r.URL != "myregistry.io/mirror" || !r.Flatten {
+		t.Errorf("unexpected registry %+v", r)
+	}
+}
+
+func TestLoadVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+verify:
+  enabled: true
+  timeout: 90s
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := state.GetValue[VerifyConfigSection](v, "verifyConfig")
+	if !c.Enabled || c.Timeout != 90*time.Second || c.Namespace != "helmper-verify" {
+		t.Errorf("unexpected verify config %+v", c)
+	}
+}
+
+func TestLoadSourceSignatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+sourceSignatures:
+  enabled: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error without keyRef or identities")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+sourceSignatures:
+  enabled: true
+  identities:
+  - issuer: https://token.actions.githubusercontent.com
+    subjectRegExp: ^https://github.com/prometheus/
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := state.GetValue[SourceSignaturesConfigSection](v, "sourceSignaturesConfig")
+	if c.Policy != "enforce" || len(c.Identities) != 1 || c.Identities[0].SubjectRegExp != "^https://github.com/prometheus/" {
+		t.Errorf("unexpected source signatures config %+v", c)
+	}
+}
+
+func TestLoadFailOn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+import:
+  enabled: true
+  failOn: CRITICAL
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error without copacetic")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+import:
+  enabled: true
+  failOn: high
+  copacetic:
+    enabled: true
+    buildkitd:
+      addr: tcp://0.0.0.0:8888
+    trivy:
+      addr: http://0.0.0.0:8887
+    output:
+      tars:
+        folder: /tmp/tars
+      reports:
+        folder: /tmp/reports
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := state.GetValue[ImportConfigSection](v, "importConfig")
+	if c.Import.FailAction != "fail" || c.Import.Quarantine != "quarantine" {
+		t.Errorf("unexpected severity gate config %+v", c.Import)
+	}
+}
+
+func TestLoadWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+watch:
+  schedule: "every day"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error for invalid cron expression")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+watch:
+  schedule: "0 */6 * * *"
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := state.GetValue[WatchConfigSection](v, "watchConfig")
+	start := time.Date(2024, 1, 1, 7, 30, 0, 0, time.UTC)
+	if next, err := w.Next(start); err != nil || !next.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next run %v %v", next, err)
+	}
+
+	w = WatchConfigSection{Interval: time.Hour}
+	if next, _ := w.Next(start); !next.Equal(start.Add(time.Hour)) {
+		t.Errorf("unexpected next run %v", next)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+state:
+  type: postgres
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error without dsn")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+state:
+  type: s3
+  bucket: helmper-state
+  prefix: production
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := state.GetValue[StateConfigSection](v, "stateConfig"); !c.Enabled() || c.Bucket != "helmper-state" {
+		t.Errorf("unexpected state config %+v", c)
+	}
+}
+
+func TestToolsList(t *testing.T) {
+	c := ToolsConfigSection{Tools: []registry.Tool{
+		{Name: "buildkit", Ref: "docker.io/moby/buildkit:v0.16.0"},
+		{Name: "copa-ubuntu", Ref: "docker.io/library/ubuntu:22.04"},
+	}}
+	ts := c.List()
+	if len(ts) != len(registry.DefaultTools)+1 {
+		t.Fatalf("want %d tools got %d", len(registry.DefaultTools)+1, len(ts))
+	}
+	for _, tool := range ts {
+		if tool.Name == "buildkit" && tool.Ref != "docker.io/moby/buildkit:v0.16.0" {
+			t.Errorf("want buildkit to be overridden got %s", tool.Ref)
+		}
+	}
+	if registry.DefaultTools[2].Ref != "docker.io/moby/buildkit:v0.15.1-rootless" {
+		t.Error("defaults must not be modified")
+	}
+}
+
+func TestLoadGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	conf := `
+groups:
+- name: core
+  gate: true
+- name: apps
+charts:
+- name: cilium
+  version: 1.15.6
+  group: core
+  repo:
+    name: cilium
+    url: https://helm.cilium.io/
+`
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := state.GetValue[[]GroupConfigSection](v, "groupsConfig")
+	if len(gs) != 2 || gs[0].Name != "core" || !gs[0].Gate || gs[1].Gate {
+		t.Errorf("unexpected groups %+v", gs)
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Replace(conf, "group: core", "group: observability", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil || !strings.Contains(err.Error(), "'observability'") {
+		t.Errorf("want error for a chart in an unknown group got %v", err)
+	}
+}
+
+func TestLoadImages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	for _, conf := range []string{`
+images:
+- ref: docker.io/library/nginx:1.27.0
+`, `
+images:
+  allow:
+  - harbor.internal/*
+  deny:
+  - docker.io/*
+  include:
+  - ref: docker.io/library/nginx:1.27.0
+`} {
+		if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if is := state.GetValue[[]registry.Image](v, "images"); len(is) != 1 || is[0].Repository != "library/nginx" {
+			t.Errorf("want the included image got %+v", is)
+		}
+		policy := state.GetValue[ImagePolicyConfigSection](v, "imagePolicyConfig")
+		if strings.Contains(conf, "allow") && (policy.Allowed("docker.io/library/nginx") || !policy.Allowed("harbor.internal/nginx")) {
+			t.Errorf("unexpected image policy %+v", policy)
+		}
+	}
+}
+
+func TestLoadSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	conf := `
+sources:
+- name: web
+  kustomize: deploy/overlays/prod
+- name: jobs
+  manifests:
+  - deploy/jobs/*.yaml
+`
+	if err := os.WriteFile(path, []byte(conf), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := state.GetValue[[]source.Source](v, "sources")
+	if len(ss) != 2 || ss[0].Kustomize != "deploy/overlays/prod" || len(ss[1].Manifests) != 1 {
+		t.Errorf("unexpected sources %+v", ss)
+	}
+
+	if err := os.WriteFile(path, []byte(conf+"  kustomize: deploy/jobs\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil || !strings.Contains(err.Error(), "'jobs'") {
+		t.Errorf("want error for a source with a kustomization and manifests got %v", err)
+	}
+}
+
+func TestLoadHooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+hooks:
+- stage: import
+  command: ["./notify.sh", "--all"]
+- stage: publish
+  url: https://deploy.internal/hooks/helmper
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error for unsupported stage")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+hooks:
+- stage: import
+  command: ["./notify.sh", "--all"]
+- name: deploy
+  stage: sign
+  url: https://deploy.internal/hooks/helmper
+  failOnError: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := state.GetValue[[]hooks.Hook](v, "hooksConfig")
+	if len(hs) != 2 {
+		t.Fatalf("want 2 hooks got %d", len(hs))
+	}
+	if h := hs[0]; h.Name != "./notify.sh" || len(h.Command) != 2 {
+		t.Errorf("unexpected hook %+v", h)
+	}
+	if h := hs[1]; h.Name != "deploy" || h.Stage != hooks.StageSign || !h.FailOnError {
+		t.Errorf("unexpected hook %+v", h)
+	}
+}
+
+func TestLoadStandby(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+standby:
+  registry:
+    url: dr.registry.io/
+    prefix: mirror
+  primary: harbor
+  interval: 30m
+  signatures:
+    enabled: true
+    keyRef: cosign.pub
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := state.GetValue[StandbyConfigSection](v, "standbyConfig")
+	if c.Mirror.URL != "dr.registry.io/mirror" || c.Mirror.Name != "standby" || c.Primary != "harbor" || c.Interval != 30*time.Minute || c.Signatures.KeyRef != "cosign.pub" {
+		t.Errorf("unexpected standby config %+v", c)
+	}
+
+	if err := os.WriteFile(path, []byte(`
+standby:
+  registry:
+    url: dr.registry.io
+  signatures:
+    enabled: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error without keyRef or identities")
+	}
+}
+
+func TestLoadDiscovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+discovery:
+  manifests:
+  - clusters/prod/*.yaml
+  cluster: true
+  context: prod
+  namespaces:
+  - flux-system
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	v, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := state.GetValue[discovery.Discovery](v, "discovery")
+	if !d.Enabled() || !d.Cluster || d.Context != "prod" || len(d.Namespaces) != 1 || len(d.Manifests) != 1 {
+		t.Errorf("unexpected discovery %+v", d)
+	}
+
+	if err := os.WriteFile(path, []byte(`
+discovery:
+  namespaces:
+  - flux-system
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path); err == nil {
+		t.Error("want error for namespaces without cluster")
+	}
+}
+
+func TestProgressPath(t *testing.T) {
+	a, b := progressPath("prod/helmper.yaml"), progressPath("staging/helmper.yaml")
+	if a == b {
+		t.Errorf("want a progress file per configuration, got %s for both", a)
+	}
+	if !strings.HasPrefix(filepath.Base(a), "progress-helmper-") {
+		t.Errorf("want the progress file named after the configuration, got %s", a)
+	}
+	if a != progressPath("prod/helmper.yaml") {
+		t.Error("want the same progress file for the same configuration")
+	}
+}
+
+func TestLoadProblems(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+watch:
+  schedule: "every day"
+tracing:
+  protocol: udp
+import:
+  cosign:
+    enabled: true
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadViperConfigurationFile(pflag.NewFlagSet("test", pflag.ContinueOnError), path)
+	if err == nil {
+		t.Fatal("want error")
+	}
+	for _, want := range []string{"invalid cron expression", "unsupported protocol 'udp'", "import.cosign.keyRef"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want every problem reported, missing %q in %v", want, err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package internal
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func exportCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "export PATH",
+		Short:   "Store the charts and images in an OCI image layout (or a '.tar' archive of it) for transfer across an air gap",
+		Example: "helmper export bundle.tar",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := p.Analyze(ctx); err != nil {
+				return err
+			}
+			return p.Export(ctx, args[0])
+		},
+	}
+}
+
+func loadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "load PATH",
+		Short:   "Push the charts and images of a bundle created with 'helmper export' to the registries",
+		Example: "helmper load bundle.tar",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+
+			if err := p.Load(ctx, args[0]); err != nil {
+				return err
+			}
+			if p.DryRun {
+				return p.Finish()
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func scanClusterCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "scan-cluster",
+		Short: "Import, scan and patch the images of the pods running in a cluster instead of the charts in the configuration",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+			// the flags override the cluster of the chart discovery in the configuration
+			if cmd.Flags().Changed("kubeconfig") {
+				p.Discovery.Kubeconfig, _ = cmd.Flags().GetString("kubeconfig")
+			}
+			if cmd.Flags().Changed("context") {
+				p.Discovery.Context, _ = cmd.Flags().GetString("context")
+			}
+			if cmd.Flags().Changed("namespace") {
+				p.Discovery.Namespaces, _ = cmd.Flags().GetStringSlice("namespace")
+			}
+
+			// only the images running in the cluster and the images of the configuration are imported
+			p.Cluster = true
+			p.Charts.Charts = nil
+			p.Sources = nil
+			p.Groups = nil
+			return p.Run(cmd.Context())
+		},
+	}
+	cmd.Flags().String("kubeconfig", "", "kubeconfig of the cluster. Defaults to discovery.kubeconfig, $KUBECONFIG or ~/.kube/config")
+	cmd.Flags().String("context", "", "context of the kubeconfig. Defaults to discovery.context or the current context")
+	cmd.Flags().StringSlice("namespace", nil, "namespaces to list the pods in, e.g. --namespace monitoring,ingress. Defaults to discovery.namespaces or all namespaces")
+	return cmd
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func cveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:     "cve CVE-ID...",
+		Short:   "Re-scan, re-patch and re-push only the imported images affected by the given vulnerabilities",
+		Example: "helmper cve CVE-2024-1234 CVE-2024-5678",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, ids []string) error {
+			return cve(cmd, ids)
+		},
+	}
+}
+
+// cve re-scans, re-patches and re-pushes only the imported images affected by the given vulnerability ids
+func cve(cmd *cobra.Command, ids []string) error {
+	ctx := cmd.Context()
+
+	p, err := load(cmd)
+	if err != nil {
+		return err
+	}
+
+	if !p.StateConfig.Enabled() {
+		s := `
+state:
+  path: /workspace/.out/state.json  <---
+`
+		return xerrors.Errorf("The cve command requires a state store. Please specify the path to the state store and try again..\nExample config:\n%s", s)
+	}
+
+	if !p.ImportConfig.Import.Enabled || !p.ImportConfig.Import.Copacetic.Enabled {
+		s := `
+import:
+  enabled: true      <---
+  copacetic:
+    enabled: true    <---
+`
+		return xerrors.Errorf("The cve command re-patches images with Copacetic. Please enable import and Copacetic and try again..\nExample config:\n%s", s)
+	}
+
+	s, err := p.StateConfig.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	// the same source image is recorded once per registry
+	seen := map[string]bool{}
+	imgs := []registry.Image{}
+	for _, r := range s.Affected(ids) {
+		if r.Source == "" || seen[r.Source] {
+			continue
+		}
+		seen[r.Source] = true
+
+		i, err := registry.RefToImage(r.Source)
+		if err != nil {
+			return err
+		}
+		imgs = append(imgs, i)
+		slog.Info("image affected by vulnerability", slog.String("image", r.Source))
+	}
+
+	if len(imgs) == 0 {
+		slog.Info("no imported images are affected", slog.Any("vulnerabilities", ids))
+		return nil
+	}
+
+	// re-import the affected images only
+	p.Imgs = imgs
+	p.All = true
+	defer p.Cleanup()
+
+	if err := p.Scan(ctx); err != nil {
+		return err
+	}
+	if err := p.ImportImages(ctx); err != nil {
+		return err
+	}
+	if err := p.Patch(ctx); err != nil {
+		return err
+	}
+	if err := p.SignImages(ctx); err != nil {
+		return err
+	}
+
+	if p.DryRun {
+		return p.Finish()
+	}
+	return p.RecordState(ctx)
+}
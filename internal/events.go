@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"log/slog"
+	"sync"
+
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"github.com/spf13/viper"
+)
+
+// emitter receives the progress events of every pipeline of the command, when --events is set
+var emitter struct {
+	mu sync.Mutex
+	e  *events.Emitter
+}
+
+// attachEvents opens the target of the progress events on first use, and emits the events of the pipeline to it.
+// The events of the jobs of 'helmper batch' are named by the job
+func attachEvents(p *pipeline.Pipeline, v *viper.Viper, job string) error {
+	target := v.GetString("events")
+	if target == "" {
+		return nil
+	}
+
+	emitter.mu.Lock()
+	defer emitter.mu.Unlock()
+	if emitter.e == nil {
+		e, err := events.Open(target)
+		if err != nil {
+			return err
+		}
+		emitter.e = e
+	}
+	p.Events = emitter.e
+	if job != "" {
+		p.Events = emitter.e.Job(job)
+	}
+	return nil
+}
+
+// closeEvents closes the target of the progress events
+func closeEvents() {
+	emitter.mu.Lock()
+	defer emitter.mu.Unlock()
+	if err := emitter.e.Close(); err != nil {
+		slog.Warn("could not close progress events", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+)
+
+// runGroups runs all stages once per chart group, in the order of the groups. A failing gated group skips the following groups,
+// failures of other groups are reported after all groups ran
+func runGroups(ctx context.Context, p *pipeline.Pipeline) ([]output.GroupSummary, error) {
+	stages := p.Stages()
+	summaries := make([]output.GroupSummary, 0, len(stages))
+	gate := ""
+	failed := 0
+	for n, g := range stages {
+		s := output.GroupSummary{Name: g.Name, Gate: g.Gate}
+		if gate != "" {
+			s.Skipped = true
+			summaries = append(summaries, s)
+			continue
+		}
+
+		start := time.Now()
+		slog.Info("group started", slog.String("group", g.Name))
+		sp := p.Stage(g.Name, n == 0)
+		err := sp.Run(ctx)
+		if rerr := sp.WriteRunReport(err); rerr != nil {
+			slog.Warn("could not write run report", slog.String("group", g.Name), slog.String("error", rerr.Error()))
+		}
+		s.Charts, s.Images, s.Patched = len(sp.Import.Charts), len(sp.Imgs), len(sp.Patched)
+		s.Err = err
+		s.Duration = time.Since(start)
+
+		if err != nil {
+			failed++
+			slog.Error("group failed", slog.String("group", g.Name), slog.String("error", err.Error()))
+			if g.Gate {
+				gate = g.Name
+			}
+		} else {
+			slog.Info("group completed", slog.String("group", g.Name), slog.Duration("duration", s.Duration))
+		}
+		summaries = append(summaries, s)
+	}
+
+	output.RenderGroupTable(summaries)
+
+	if gate != "" {
+		return summaries, fmt.Errorf("internal: the gated group '%s' failed, so the groups after it were skipped", gate)
+	}
+	if failed > 0 {
+		return summaries, fmt.Errorf("internal: %d of %d groups failed", failed, len(stages))
+	}
+	return summaries, nil
+}
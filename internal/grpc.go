@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	apiv1 "github.com/ChristofferNissen/helmper/pkg/api/v1"
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// eventLog records the progress events of a run, so clients watching the run receive them from its start
+type eventLog struct {
+	mu     sync.Mutex
+	events []events.Event
+	done   bool
+	// changed is closed and replaced when an event is added or the run finishes
+	changed chan struct{}
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{changed: make(chan struct{})}
+}
+
+func (l *eventLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *eventLog) add(ev events.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, ev)
+	l.notify()
+}
+
+func (l *eventLog) finish() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done = true
+	l.notify()
+}
+
+// since returns the events after the first n, whether the run has finished, and a channel closed on the next change
+func (l *eventLog) since(n int) ([]events.Event, bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]events.Event{}, l.events[n:]...), l.done, l.changed
+}
+
+// grpcServer serves the runs of the server over gRPC
+type grpcServer struct {
+	apiv1.UnimplementedRunServiceServer
+	s *server
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func (r apiRun) proto() *apiv1.Run {
+	return &apiv1.Run{
+		Id:        r.ID,
+		Status:    r.Status,
+		Charts:    r.Charts,
+		DryRun:    r.DryRun,
+		Submitted: timestamppb.New(r.Submitted),
+		Started:   timestamp(r.Started),
+		Finished:  timestamp(r.Finished),
+		Error:     r.Error,
+	}
+}
+
+func (g grpcServer) SubmitRun(_ context.Context, req *apiv1.SubmitRunRequest) (*apiv1.Run, error) {
+	rr := runRequest{DryRun: req.GetDryRun()}
+	for _, c := range req.GetCharts() {
+		rr.Charts = append(rr.Charts, c.AsMap())
+	}
+	r, err := g.s.enqueue(rr)
+	switch {
+	case errors.Is(err, errQueueFull):
+		return nil, grpcstatus.Error(codes.ResourceExhausted, err.Error())
+	case err != nil:
+		return nil, grpcstatus.Error(codes.InvalidArgument, err.Error())
+	}
+	return r.proto(), nil
+}
+
+// run returns a copy of the run with the id, and its events
+func (g grpcServer) run(id string) (apiRun, *eventLog, error) {
+	r, ok := g.s.get(id)
+	if !ok {
+		return apiRun{}, nil, grpcstatus.Errorf(codes.NotFound, "run %s not found", id)
+	}
+	g.s.mu.Lock()
+	defer g.s.mu.Unlock()
+	return *r, r.log, nil
+}
+
+func (g grpcServer) GetRun(_ context.Context, req *apiv1.GetRunRequest) (*apiv1.Run, error) {
+	r, _, err := g.run(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	return r.proto(), nil
+}
+
+func (g grpcServer) WatchRun(req *apiv1.WatchRunRequest, stream grpc.ServerStreamingServer[apiv1.Event]) error {
+	_, log, err := g.run(req.GetId())
+	if err != nil {
+		return err
+	}
+	for sent := 0; ; {
+		evs, done, changed := log.since(sent)
+		for _, ev := range evs {
+			if err := stream.Send(&apiv1.Event{
+				Time:  timestamppb.New(ev.Time),
+				Type:  string(ev.Type),
+				Stage: ev.Stage,
+				Item:  ev.Item,
+				Step:  ev.Step,
+				Done:  int32(ev.Done),
+				Total: int32(ev.Total),
+				Error: ev.Error,
+			}); err != nil {
+				return err
+			}
+		}
+		sent += len(evs)
+		if done {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-changed:
+		}
+	}
+}
+
+// authorized checks the bearer token in the metadata of the call, if a token is configured
+func (g grpcServer) authorized(ctx context.Context) error {
+	if g.s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		if bearer(v, g.s.token) {
+			return nil
+		}
+	}
+	return grpcstatus.Error(codes.Unauthenticated, "missing or invalid bearer token")
+}
+
+// newGRPCServer returns the gRPC server of the runs, requiring the bearer token on every call if configured
+func (s *server) newGRPCServer() *grpc.Server {
+	g := grpcServer{s: s}
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := g.authorized(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := g.authorized(ss.Context()); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	)
+	apiv1.RegisterRunServiceServer(srv, g)
+	return srv
+}
@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+	apiv1 "github.com/ChristofferNissen/helmper/pkg/api/v1"
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	grpcstatus "google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGRPCWatchRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+registries:
+- name: registry
+  url: localhost:5000
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(path, pflag.NewFlagSet("test", pflag.ContinueOnError), bootstrap.ServeConfigSection{Token: "secret", History: 10})
+	// runs are started once the client watches them
+	start := make(chan struct{})
+	s.run = func(_ context.Context, _ *viper.Viper, e *events.Emitter) (pipeline.RunReport, error) {
+		<-start
+		e.Emit(events.Event{Type: events.RunStarted})
+		e.Emit(events.Event{Type: events.ItemCompleted, Stage: "import images", Item: "docker.io/library/nginx:1.25", Step: "pushed", Done: 1, Total: 1})
+		e.Emit(events.Event{Type: events.RunCompleted})
+		return pipeline.RunReport{}, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.work(ctx)
+
+	l := bufconn.Listen(1 << 20)
+	gs := s.newGRPCServer()
+	go func() { _ = gs.Serve(l) }()
+	defer gs.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := apiv1.NewRunServiceClient(conn)
+
+	chart, err := structpb.NewStruct(map[string]any{"name": "prometheus", "version": "25.8.0", "repo": map[string]any{"name": "prometheus-community", "url": "https://prometheus-community.github.io/helm-charts/"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &apiv1.SubmitRunRequest{Charts: []*structpb.Struct{chart}}
+	if _, err := client.SubmitRun(ctx, req); grpcstatus.Code(err) != codes.Unauthenticated {
+		t.Errorf("want unauthenticated without token got %v", err)
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	if _, err := client.SubmitRun(ctx, &apiv1.SubmitRunRequest{}); grpcstatus.Code(err) != codes.InvalidArgument {
+		t.Errorf("want invalid argument without charts got %v", err)
+	}
+	r, err := client.SubmitRun(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.GetId() != "1" || r.GetCharts()[0] != "prometheus:25.8.0" {
+		t.Errorf("unexpected run %+v", r)
+	}
+
+	stream, err := client.WatchRun(ctx, &apiv1.WatchRunRequest{Id: r.GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(start)
+	var evs []*apiv1.Event
+	for {
+		ev, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+	}
+	if len(evs) != 3 || evs[1].GetStep() != "pushed" || evs[1].GetItem() != "docker.io/library/nginx:1.25" || evs[2].GetType() != string(events.RunCompleted) {
+		t.Errorf("unexpected events %+v", evs)
+	}
+
+	r, err = client.GetRun(ctx, &apiv1.GetRunRequest{Id: r.GetId()})
+	if err != nil || r.GetStatus() != runSucceeded || r.GetFinished() == nil {
+		t.Errorf("unexpected run %+v: %v", r, err)
+	}
+	if _, err := client.GetRun(ctx, &apiv1.GetRunRequest{Id: "2"}); grpcstatus.Code(err) != codes.NotFound {
+		t.Errorf("want not found for unknown run got %v", err)
+	}
+}
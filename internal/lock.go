@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func lockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Work with lockfiles",
+		// print without header, so the output can be parsed
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+			setupLogger()
+		},
+	}
+
+	diff := &cobra.Command{
+		Use:     "diff OLD NEW",
+		Short:   "Show the chart versions, image tags and digests that changed between two lockfiles",
+		Example: "helmper lock diff old.lock new.lock -o markdown",
+		Args:    cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, err := cmd.Flags().GetString("output")
+			if err != nil {
+				return err
+			}
+			return lockDiff(args[0], args[1], format)
+		},
+	}
+	diff.Flags().StringP("output", "o", "text", "output format: text, markdown, json or yaml")
+
+	cmd.AddCommand(diff)
+	return cmd
+}
+
+// lockDiff prints the differences between the old and the new lockfile in the format
+func lockDiff(oldPath string, newPath string, format string) error {
+	old, err := lock.Load(oldPath)
+	if err != nil {
+		return fmt.Errorf("internal: error reading lockfile %s :: %w", oldPath, err)
+	}
+	new, err := lock.Load(newPath)
+	if err != nil {
+		return fmt.Errorf("internal: error reading lockfile %s :: %w", newPath, err)
+	}
+	ds := lock.Diff(old, new)
+
+	switch format {
+	case "text", "":
+		output.RenderLockDiffTable(ds, false)
+	case "markdown", "md":
+		output.RenderLockDiffTable(ds, true)
+	case "json":
+		b, err := json.MarshalIndent(ds, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+	case "yaml":
+		b, err := yaml.Marshal(ds)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(b))
+	default:
+		return fmt.Errorf("internal: unsupported output format '%s', use text, markdown, json or yaml", format)
+	}
+	return nil
+}
@@ -1,14 +1,13 @@
 package output
 
 import (
-	"fmt"
-
 	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/version"
 	"github.com/common-nighthawk/go-figure"
 )
 
-func Header(version, commit, date string) {
+func Header(i version.Info) {
 	myFigure := figure.NewFigure("helmper", "rectangles", true)
-	myFigure.Print()
-	terminal.PrintYellow(fmt.Sprintf("version %s (commit %s, built at %s)\n", version, commit, date))
+	figure.Write(terminal.Stdout, myFigure)
+	terminal.PrintYellow(i.String() + "\n")
 }
@@ -4,14 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
+	"sort"
 	"strings"
+	"time"
 
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/dustin/go-humanize"
 	"github.com/spf13/viper"
 
 	"github.com/ChristofferNissen/helmper/internal/bootstrap"
 	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/plan"
 	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
 	"github.com/ChristofferNissen/helmper/pkg/util/counter"
 	"github.com/ChristofferNissen/helmper/pkg/util/file"
 	"github.com/ChristofferNissen/helmper/pkg/util/state"
@@ -21,11 +27,11 @@ import (
 
 var sc counter.SafeCounter = counter.NewSafeCounter()
 
-// create a new table.writer with header and os.Stdout output mirror
+// create a new table.writer with header and the coordinated stdout as output mirror
 func newTable(title string, header table.Row) table.Writer {
 	t := table.NewWriter()
 	t.SetTitle(title)
-	t.SetOutputMirror(os.Stdout)
+	t.SetOutputMirror(terminal.Stdout)
 	t.AppendHeader(header)
 	return t
 }
@@ -113,19 +119,33 @@ func RenderChartTable(charts *helm.ChartCollection, setters ...Option) {
 
 func RenderHelmValuePathToImageTable(chartImageHelmValuesMap map[helm.Chart]map[*registry.Image][]string) {
 	// Print Helm values to be set for each chart
-	t := newTable("Helm Values Paths Per Image", table.Row{"#", "Helm Chart", "Chart Version", "Image", "Helm Value Path(s)"})
+	t := newTable("Helm Values Paths Per Image", table.Row{"#", "Helm Chart", "Chart Version", "Image", "Helm Value Path(s)", "Workloads", "Confidence"})
 	id := 0
 	for c, v := range chartImageHelmValuesMap {
 		for i, paths := range v {
 			ref, _ := i.String()
 			noSHA := strings.SplitN(ref, "@", 2)[0]
-			t.AppendRow(table.Row{id, c.Name, c.Version, noSHA, strings.Join(paths, "\n")})
+			t.AppendRow(table.Row{id, c.Name, c.Version, noSHA, strings.Join(paths, "\n"), strings.Join(i.Workloads, "\n"), i.Confidence.String()})
 			id = id + 1
 		}
 	}
 	t.Render()
 }
 
+func RenderSkippedImageTable(skipped map[helm.Chart]map[*registry.Image][]string) {
+	t := newTable("Images Skipped By Values", table.Row{"#", "Helm Chart", "Chart Version", "Image", "Helm Value Path(s)"})
+	id := 0
+	for c, v := range skipped {
+		for i, paths := range v {
+			ref, _ := i.String()
+			t.AppendRow(table.Row{id, c.Name, c.Version, ref, strings.Join(paths, "\n")})
+			id = id + 1
+		}
+	}
+	t.AppendFooter(table.Row{"", "", "", "", id})
+	t.Render()
+}
+
 func getImportTableRow(_ context.Context, viper *viper.Viper, c helm.Chart, image string, keys []string, m map[string]bool) table.Row {
 	row := table.Row{}
 	row = append(row, sc.Value("index_import"), c.Name, c.Version, image)
@@ -219,7 +239,34 @@ func RenderImageOverviewTable(ctx context.Context, viper *viper.Viper, missing i
 	return nil
 }
 
-func RenderChartOverviewTable(ctx context.Context, viper *viper.Viper, missing int, registries []registry.Registry, charts helm.ChartCollection) error {
+// rootChart returns the top-level chart of subcharts
+func rootChart(c helm.Chart) helm.Chart {
+	for c.Parent != nil {
+		c = *c.Parent
+	}
+	return c
+}
+
+// chartImages returns the images pulled by the chart and its subcharts, by reference
+func chartImages(c helm.Chart, chartImageValuesMap map[helm.Chart]map[*registry.Image][]string) map[string]*registry.Image {
+	res := map[string]*registry.Image{}
+	for k, m := range chartImageValuesMap {
+		r := rootChart(k)
+		if r.Name != c.Name || r.Version != c.Version {
+			continue
+		}
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				continue
+			}
+			res[ref] = i
+		}
+	}
+	return res
+}
+
+func RenderChartOverviewTable(ctx context.Context, viper *viper.Viper, missing int, registries []registry.Registry, sources registry.Sources, charts helm.ChartCollection, chartImageValuesMap map[helm.Chart]map[*registry.Image][]string) error {
 
 	// Create collection of registry names as keys for iterating registries
 	keys := make([]string, 0)
@@ -227,16 +274,47 @@ func RenderChartOverviewTable(ctx context.Context, viper *viper.Viper, missing i
 		keys = append(keys, r.URL)
 	}
 
+	// Sizes of images shared by charts are fetched once, and only with --image-sizes, as every image is fetched from its source registry
+	withSizes := state.GetValue[bool](viper, "image-sizes")
+	sizes := map[string]registry.ImageSize{}
+	if withSizes {
+		all := map[string]*registry.Image{}
+		for _, c := range charts.Charts {
+			for ref, i := range chartImages(c, chartImageValuesMap) {
+				all[ref] = i
+			}
+		}
+		sizes = registry.Sizes(ctx, sources, all)
+	}
+
 	// Combine results
 	rows := make([]table.Row, 0)
 	for _, c := range charts.Charts {
 		// check if image exists in registry
-		m := registry.Exists(ctx, fmt.Sprintf("charts/%s", c.Name), c.Version, registries)
+		m := registry.Exists(ctx, fmt.Sprintf("charts/%s", c.Name), registry.OCITag(c.Version), registries)
+
+		size, err := c.PackageSize()
+		if err != nil {
+			slog.Debug("Could not determine size of chart package", slog.String("chart", c.Name), slog.Any("error", err))
+		}
+		deps, err := c.CountDependencies()
+		if err != nil {
+			slog.Debug("Could not count dependencies of chart", slog.String("chart", c.Name), slog.Any("error", err))
+		}
+
+		imgs := chartImages(c, chartImageValuesMap)
+		var imgSize int64
+		for ref := range imgs {
+			imgSize += sizes[ref].Total()
+		}
 
 		// add row to overview table
 		row := func() table.Row {
 			row := table.Row{}
-			row = append(row, sc.Value("index_import_charts"), c.Name, c.Version)
+			row = append(row, sc.Value("index_import_charts"), c.Name, c.Version, humanize.Bytes(uint64(size)), deps, len(imgs))
+			if withSizes {
+				row = append(row, humanize.Bytes(uint64(imgSize)))
+			}
 
 			for _, key := range keys {
 				row = append(row, terminal.StatusEmoji(m[key]))
@@ -261,8 +339,12 @@ func RenderChartOverviewTable(ctx context.Context, viper *viper.Viper, missing i
 	footer := table.Row{}
 
 	// first static part of header
-	header = append(header, "#", "Helm Chart", "Chart Version")
-	footer = append(footer, "", "", "")
+	header = append(header, "#", "Helm Chart", "Chart Version", "Size", "Dependencies", "Images")
+	footer = append(footer, "", "", "", "", "", "")
+	if withSizes {
+		header = append(header, "Image Size")
+		footer = append(footer, "")
+	}
 
 	ic := state.GetValue[bootstrap.ImportConfigSection](viper, "importConfig")
 
@@ -284,5 +366,358 @@ func RenderChartOverviewTable(ctx context.Context, viper *viper.Viper, missing i
 	t.AppendFooter(footer)
 	t.Render()
 
+	if withSizes {
+		renderImageSizeTable(sizes)
+	}
+
 	return nil
 }
+
+// renderImageSizeTable renders the layer breakdown of the images, largest first
+func renderImageSizeTable(sizes map[string]registry.ImageSize) {
+	if len(sizes) == 0 {
+		return
+	}
+	refs := make([]string, 0, len(sizes))
+	for ref := range sizes {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if sizes[refs[i]].Total() != sizes[refs[j]].Total() {
+			return sizes[refs[i]].Total() > sizes[refs[j]].Total()
+		}
+		return refs[i] < refs[j]
+	})
+
+	t := newTable("Image Sizes", table.Row{"#", "Image", "Layers", "Largest Layer", "Config", "Size"})
+	for n, ref := range refs {
+		s := sizes[ref]
+		t.AppendRow(table.Row{n, ref, len(s.Layers), humanize.Bytes(uint64(s.Largest())), humanize.Bytes(uint64(s.Config)), humanize.Bytes(uint64(s.Total()))})
+	}
+	t.Render()
+}
+
+func RenderPlanTable(p *plan.Plan) {
+	t := newTable("Planned Actions (dry-run)", table.Row{"#", "Action", "Source", "Target"})
+	for id, a := range p.Actions() {
+		source := a.Source
+		if a.Kind == plan.PushChart {
+			source = fmt.Sprintf("%s:%s", a.Source, a.Version)
+		}
+		t.AppendRow(table.Row{id, a.Kind, source, a.Target})
+	}
+	t.AppendFooter(table.Row{"", "", "", p.Len()})
+	t.Render()
+}
+
+func RenderStatusTable(is []store.Inconsistency) {
+	t := newTable("State Store Status", table.Row{"#", "Kind", "Registry", "Artifact", "Problem", "Recorded Digest", "Actual Digest"})
+	for id, i := range is {
+		r := i.Record
+		t.AppendRow(table.Row{id, r.Kind, r.Registry, fmt.Sprintf("%s:%s", r.Name, r.Reference), i.Problem, r.Digest, i.Actual})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", terminal.StatusEmoji(len(is) == 0), "", len(is)})
+	t.Render()
+}
+
+// JobSummary is the result of a job run by 'helmper batch'
+type JobSummary struct {
+	Name     string
+	Config   string
+	Charts   int
+	Images   int
+	Patched  int
+	Duration time.Duration
+	Err      error
+}
+
+type GroupSummary struct {
+	Name     string
+	Gate     bool
+	Charts   int
+	Images   int
+	Patched  int
+	Duration time.Duration
+	Err      error
+	// Skipped groups did not run, as a gated group before them failed
+	Skipped bool
+}
+
+func RenderGroupTable(gs []GroupSummary) {
+	t := newTable("Groups", table.Row{"#", "Group", "Gate", "Charts", "Images", "Patched", "Duration", "Status", "Error"})
+	failed := 0
+	for id, g := range gs {
+		gate := ""
+		if g.Gate {
+			gate = "yes"
+		}
+		status, msg := terminal.StatusEmoji(g.Err == nil), ""
+		switch {
+		case g.Skipped:
+			status, msg = "skipped", "a gated group before it failed"
+		case g.Err != nil:
+			failed++
+			msg = g.Err.Error()
+		}
+		t.AppendRow(table.Row{id, g.Name, gate, g.Charts, g.Images, g.Patched, g.Duration.Round(time.Second), status, msg})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", "", "", terminal.StatusEmoji(failed == 0), fmt.Sprintf("%d failed", failed)})
+	t.Render()
+}
+
+func RenderJobTable(js []JobSummary) {
+	t := newTable("Jobs", table.Row{"#", "Job", "Config", "Charts", "Images", "Patched", "Duration", "Status", "Error"})
+	failed := 0
+	for id, j := range js {
+		msg := ""
+		if j.Err != nil {
+			failed++
+			msg = j.Err.Error()
+		}
+		t.AppendRow(table.Row{id, j.Name, j.Config, j.Charts, j.Images, j.Patched, j.Duration.Round(time.Second), terminal.StatusEmoji(j.Err == nil), msg})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", "", "", terminal.StatusEmoji(failed == 0), fmt.Sprintf("%d failed", failed)})
+	t.Render()
+}
+
+func RenderBaseImageTable(ls map[string]registry.Lineage) {
+	type group struct {
+		images  []string
+		sources map[string]bool
+	}
+	groups := map[string]*group{}
+	for ref, l := range ls {
+		base := l.Base
+		if base == "" {
+			base = "unknown"
+		}
+		g, ok := groups[base]
+		if !ok {
+			g = &group{sources: map[string]bool{}}
+			groups[base] = g
+		}
+		g.images = append(g.images, ref)
+		if l.Source != "" {
+			g.sources[l.Source] = true
+		}
+	}
+
+	bases := make([]string, 0, len(groups))
+	for b := range groups {
+		bases = append(bases, b)
+	}
+	// most used base images first
+	sort.Slice(bases, func(i, j int) bool {
+		if len(groups[bases[i]].images) == len(groups[bases[j]].images) {
+			return bases[i] < bases[j]
+		}
+		return len(groups[bases[i]].images) > len(groups[bases[j]].images)
+	})
+
+	t := newTable("Base Images", table.Row{"#", "Base Image", "Inferred From", "Images", "Count"})
+	for id, b := range bases {
+		g := groups[b]
+		sort.Strings(g.images)
+		sources := make([]string, 0, len(g.sources))
+		for s := range g.sources {
+			sources = append(sources, s)
+		}
+		sort.Strings(sources)
+		t.AppendRow(table.Row{id, b, strings.Join(sources, ", "), strings.Join(g.images, "\n"), len(g.images)})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", len(ls)})
+	t.Render()
+}
+
+func RenderWarmTable(ws []registry.Warmed) {
+	t := newTable("Cache Warm-up", table.Row{"#", "Image", "Cache", "Digest", "Status", "Error"})
+	failed, skipped := 0, 0
+	for id, w := range ws {
+		cache, msg := w.Cache, ""
+		if cache == "" {
+			skipped++
+			cache = "no cache"
+		}
+		if w.Err != nil {
+			failed++
+			msg = w.Err.Error()
+		}
+		t.AppendRow(table.Row{id, w.Image, cache, w.Digest, terminal.StatusEmoji(w.Err == nil), msg})
+	}
+	t.AppendFooter(table.Row{"", "", fmt.Sprintf("%d skipped", skipped), "", terminal.StatusEmoji(failed == 0), fmt.Sprintf("%d failed", failed)})
+	t.Render()
+}
+
+func RenderVerifyTable(vs []helm.Verification) {
+	t := newTable("Mirror Verification", table.Row{"#", "Chart", "Version", "Registry", "Lint", "Template", "Images", "Test", "Error"})
+	failed := 0
+	for id, v := range vs {
+		if !v.OK() {
+			failed++
+		}
+		errs := []string{}
+		for _, err := range []error{v.Lint, v.Render, v.Test} {
+			if err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(v.Missing) > 0 {
+			errs = append(errs, "missing images: "+strings.Join(v.Missing, ", "))
+		}
+		test := "skipped"
+		if v.Tested {
+			test = terminal.StatusEmoji(v.Test == nil)
+		}
+		t.AppendRow(table.Row{id, v.Chart.Name, v.Chart.Version, v.Registry, terminal.StatusEmoji(v.Lint == nil), terminal.StatusEmoji(v.Render == nil), terminal.StatusEmoji(v.Render == nil && len(v.Missing) == 0), test, strings.Join(errs, "; ")})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", "", "", terminal.StatusEmoji(failed == 0), fmt.Sprintf("%d failed", failed)})
+	t.Render()
+}
+
+func RenderSourceSignatureTable(vs []mySign.Verified) {
+	t := newTable("Source Signatures", table.Row{"#", "Image", "Signed", "Error"})
+	unsigned, invalid := 0, 0
+	for id, v := range vs {
+		msg := ""
+		if v.Err != nil {
+			msg = v.Err.Error()
+			if v.Unsigned() {
+				unsigned++
+			} else {
+				invalid++
+			}
+		}
+		t.AppendRow(table.Row{id, v.Image, terminal.StatusEmoji(v.Signed), msg})
+	}
+	t.AppendFooter(table.Row{"", "", terminal.StatusEmoji(unsigned+invalid == 0), fmt.Sprintf("%d unsigned, %d invalid", unsigned, invalid)})
+	t.Render()
+}
+
+// RenderLockDiffTable renders the differences between two lockfiles, as Markdown for release notes if markdown is set
+func RenderLockDiffTable(ds []lock.Difference, markdown bool) {
+	t := newTable("Lockfile Differences", table.Row{"#", "Kind", "Name", "Change", "From", "To", "Registry"})
+	for id, d := range ds {
+		from, to := d.From, d.To
+		if d.Change == lock.Changed {
+			from, to = d.From+"@"+d.FromDigest, d.To+"@"+d.ToDigest
+		}
+		t.AppendRow(table.Row{id, d.Kind, d.Name, d.Change, from, to, d.Registry})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", "", len(ds)})
+	if markdown {
+		t.RenderMarkdown()
+		return
+	}
+	t.Render()
+}
+
+func RenderPinningTable(us []helm.Unpinned) {
+	t := newTable("Unpinned Images", table.Row{"#", "Chart", "Version", "Image", "Value Paths", "Reason"})
+	for id, u := range us {
+		t.AppendRow(table.Row{id, u.Chart, u.Version, u.Image, strings.Join(u.Paths, "\n"), u.Reason})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", len(us)})
+	t.Render()
+}
+
+func RenderFailedImageTable(fs []registry.Failure) {
+	t := newTable("Failed Images", table.Row{"#", "Image", "Registry", "Error"})
+	for id, f := range fs {
+		t.AppendRow(table.Row{id, f.Image, f.Registry, f.Err.Error()})
+	}
+	t.AppendFooter(table.Row{"", "", "", fmt.Sprintf("%d failed", len(fs))})
+	t.Render()
+}
+
+func RenderSiblingTable(ss []registry.Image, imported bool) {
+	t := newTable("Sibling Images", table.Row{"#", "Image", "Sibling", "Import"})
+	for id, s := range ss {
+		ref, _ := s.String()
+		t.AppendRow(table.Row{id, s.SiblingOf, ref, terminal.StatusEmoji(imported)})
+	}
+	t.AppendFooter(table.Row{"", "", "", fmt.Sprintf("%d siblings", len(ss))})
+	t.Render()
+}
+
+func RenderFallbackTable(fs []registry.Fallback) {
+	t := newTable("Pushed To Fallback Registries", table.Row{"#", "Chart Or Image", "Registry", "Fallback", "Error"})
+	for id, f := range fs {
+		t.AppendRow(table.Row{id, f.Image, f.Registry, f.Fallback, f.Err.Error()})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", fmt.Sprintf("%d pushed to fallbacks", len(fs))})
+	t.Render()
+}
+
+// PolicyDecision is the decision of the policies on a chart or image
+type PolicyDecision struct {
+	Kind  string
+	Name  string
+	Deny  []string
+	Patch *bool
+	Sign  *bool
+}
+
+func RenderPolicyTable(ds []PolicyDecision) {
+	flag := func(b *bool) string {
+		if b == nil {
+			return ""
+		}
+		return terminal.StatusEmoji(*b)
+	}
+	t := newTable("Policy Decisions", table.Row{"#", "Kind", "Name", "Import", "Patch", "Sign", "Reasons"})
+	skipped := 0
+	for id, d := range ds {
+		if len(d.Deny) > 0 {
+			skipped++
+		}
+		t.AppendRow(table.Row{id, d.Kind, d.Name, terminal.StatusEmoji(len(d.Deny) == 0), flag(d.Patch), flag(d.Sign), strings.Join(d.Deny, "\n")})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", "", fmt.Sprintf("%d skipped", skipped)})
+	t.Render()
+}
+
+// LicenseSummary are the charts and images under a license
+type LicenseSummary struct {
+	License  string
+	Category string
+	Charts   []string
+	Images   []string
+}
+
+func RenderLicenseTable(ls []LicenseSummary, unknown int) {
+	// most used licenses first
+	sort.Slice(ls, func(i, j int) bool {
+		ni, nj := len(ls[i].Charts)+len(ls[i].Images), len(ls[j].Charts)+len(ls[j].Images)
+		if ni == nj {
+			return ls[i].License < ls[j].License
+		}
+		return ni > nj
+	})
+
+	t := newTable("Licenses", table.Row{"#", "License", "Category", "Charts", "Images", "Count"})
+	for id, l := range ls {
+		sort.Strings(l.Charts)
+		sort.Strings(l.Images)
+		t.AppendRow(table.Row{id, l.License, l.Category, strings.Join(l.Charts, "\n"), strings.Join(l.Images, "\n"), len(l.Charts) + len(l.Images)})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", fmt.Sprintf("%d unknown", unknown)})
+	t.Render()
+}
+
+// StandbyDrift is a chart or image of the lockfile the standby registry does not mirror like the primary registry
+type StandbyDrift struct {
+	Kind     string
+	Name     string
+	Expected string
+	Actual   string
+	Reason   string
+}
+
+func RenderStandbyTable(registry string, ds []StandbyDrift, total int) {
+	t := newTable(fmt.Sprintf("Standby Registry %s", registry), table.Row{"#", "Kind", "Name", "Expected Digest", "Actual Digest", "Reason"})
+	for id, d := range ds {
+		t.AppendRow(table.Row{id, d.Kind, d.Name, d.Expected, d.Actual, d.Reason})
+	}
+	t.AppendFooter(table.Row{"", "", "", "", "", fmt.Sprintf("%d of %d drifted", len(ds), total)})
+	t.Render()
+}
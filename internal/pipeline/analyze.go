@@ -0,0 +1,331 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/discovery"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/layout"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func modify(cm *helm.ChartData, mirrorConfig []bootstrap.MirrorConfigSection) error {
+
+	// modify images according to user specification
+	for c, m := range *cm {
+		for i, vs := range m {
+			r, err := i.String()
+			if err != nil {
+				return err
+			}
+
+			if c.Images != nil {
+				for _, e := range c.Images.Exclude {
+					if strings.HasPrefix(r, e.Ref) {
+						delete(m, i)
+						slog.Info("excluded image", slog.String("image", r))
+						break
+					}
+				}
+				for _, ec := range c.Images.ExcludeCopacetic {
+					if strings.HasPrefix(r, ec.Ref) {
+						slog.Info("excluded image from copacetic patching", slog.String("image", r))
+						f := false
+						i.Patch = &f
+						break
+					}
+				}
+				for _, modify := range c.Images.Modify {
+					if modify.From != "" {
+
+						if strings.HasPrefix(r, modify.From) {
+							delete(m, i)
+
+							img, err := registry.RefToImage(
+								strings.Replace(r, modify.From, modify.To, 1),
+							)
+							if err != nil {
+								return err
+							}
+
+							img.Digest = i.Digest
+							img.UseDigest = i.UseDigest
+							img.Tag = i.Tag
+							img.Patch = i.Patch
+							img.Workloads = i.Workloads
+							img.Confidence = i.Confidence
+
+							m[&img] = vs
+
+							newR, err := img.String()
+							if err != nil {
+								return err
+							}
+							slog.Info("modified image reference", slog.String("old_image", r), slog.String("new_image", newR))
+						}
+					}
+				}
+			}
+
+			// Replace mirrors, the first mirror of the registry or rewrite of the repository applies
+			for _, mc := range mirrorConfig {
+				repo, ok, err := mc.Apply(i.Registry + "/" + i.Repository)
+				if err != nil {
+					return err
+				}
+				if ok {
+					i.Registry, i.Repository, _ = strings.Cut(repo, "/")
+					slog.Debug("mirrored image", slog.String("image", r), slog.String("mirror", repo))
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// enforce returns an error if the image policy denies the repositories the images are imported from
+func enforce(cm helm.ChartData, policy bootstrap.ImagePolicyConfigSection) error {
+	denied := []string{}
+	for c, m := range cm {
+		for i := range m {
+			if !policy.Allowed(i.Registry + "/" + i.Repository) {
+				denied = append(denied, fmt.Sprintf("%s (%s)", i.Registry+"/"+i.Repository, c.Name))
+			}
+		}
+	}
+	if len(denied) > 0 {
+		sort.Strings(denied)
+		return fmt.Errorf("internal: the image policy denies the images %s. Mirror or exclude them and try again", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
+// newLayout assigns every image to the folder of the first chart (by name and version) it is found in
+func newLayout(data helm.ChartData) (*layout.Layout, error) {
+	cs := make([]helm.Chart, 0, len(data))
+	for c := range data {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Name == cs[j].Name {
+			return cs[i].Version < cs[j].Version
+		}
+		return cs[i].Name < cs[j].Name
+	})
+
+	l := layout.New()
+	for _, c := range cs {
+		for i := range data[c] {
+			ref, err := i.String()
+			if err != nil {
+				return nil, err
+			}
+			l.Assign(ref, c.Name, c.Version)
+		}
+	}
+	return l, nil
+}
+
+// Analyze finds the images in the charts and determines which charts and images to import
+func (p *Pipeline) Analyze(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "analyze")
+	defer func() { done(err) }()
+
+	// Add the charts deployed by the Flux HelmReleases and ArgoCD Applications
+	if p.Discovery.Enabled() && !p.Cluster {
+		found, err := p.Discovery.Charts(ctx)
+		if err != nil {
+			return err
+		}
+		slog.Debug("Discovered charts", slog.Int("count", len(found)))
+		p.Charts.Charts = discovery.Merge(p.Charts.Charts, found)
+	}
+
+	// OCI charts are pulled with the settings of their source registry
+	for i, c := range p.Charts.Charts {
+		if !c.IsOCI() {
+			continue
+		}
+		host, _, _ := strings.Cut(c.OCIReference(), "/")
+		if s, ok := p.SourceRegistries.Lookup(host); ok {
+			p.Charts.Charts[i].Source = s
+		}
+	}
+
+	// Find input charts in configuration
+	slog.Debug(
+		"Found charts in config",
+		slog.Int("count", len(p.Charts.Charts)),
+	)
+
+	// STEP 1: Setup Helm
+	charts, err := bootstrap.SetupHelm(
+		&p.Charts,
+		p.Opts...,
+	)
+	if err != nil {
+		return err
+	}
+	p.Charts = charts
+	// Output overview table of charts and subcharts
+	go output.RenderChartTable(
+		&charts,
+		output.Update(p.Update),
+	)
+
+	// STEP 2: Find images in Helm Charts and dependencies
+	slog.Debug("Starting parsing user specified chart(s) for images..")
+	skipped := helm.ChartData{}
+	co := helm.ChartOption{
+		ChartCollection: &charts,
+		IdentifyImages:  !p.ParserConfig.DisableImageDetection,
+		UseCustomValues: p.ParserConfig.UseCustomValues,
+		RenderedOnly:    p.ParserConfig.RenderedOnly,
+		RenderedImages:  p.ParserConfig.RenderedImages,
+		Skipped:         &skipped,
+		Sources:         p.SourceRegistries,
+	}
+	chartImageHelmValuesMap, err := co.Run(
+		ctx,
+		p.Opts...,
+	)
+	if err != nil {
+		return err
+	}
+
+	if len(skipped) > 0 {
+		output.RenderSkippedImageTable(skipped)
+	}
+
+	// Add in images from kustomizations, manifests and the cluster. The mirrors are applied to them like to the images of charts,
+	// but the placeholder chart has no images configuration, so no excludes or modifications are applied
+	placeHolder := helm.Chart{
+		Name:    "images",
+		Version: "0.0.0",
+	}
+	m := map[*registry.Image][]string{}
+	for _, s := range p.Sources {
+		is, err := s.Images()
+		if err != nil {
+			return err
+		}
+		slog.Debug("Found images in source", slog.String("source", s.Name), slog.Int("count", len(is)))
+		for i, paths := range is {
+			m[i] = paths
+		}
+	}
+	if p.Cluster {
+		if err := p.clusterImages(ctx, m); err != nil {
+			return err
+		}
+	}
+	chartImageHelmValuesMap[placeHolder] = m
+
+	err = modify(&chartImageHelmValuesMap, p.MirrorConfig)
+	if err != nil {
+		return err
+	}
+
+	// Add in images from config
+	for _, i := range p.Images {
+		m[&i] = []string{}
+	}
+
+	// the images from config are admitted like the images of charts, after the mirrors are applied
+	if err := enforce(chartImageHelmValuesMap, p.ImagePolicy); err != nil {
+		return err
+	}
+
+	if err := p.checkPinning(chartImageHelmValuesMap); err != nil {
+		return err
+	}
+
+	if p.ParserConfig.Siblings.Enabled {
+		if err := p.discoverSiblings(ctx, chartImageHelmValuesMap); err != nil {
+			return err
+		}
+	}
+
+	if err := p.admit(ctx, chartImageHelmValuesMap); err != nil {
+		return err
+	}
+
+	// Pin images from registries with frequently rebuilt tags, or all images if configured, to digests
+	for c, m := range chartImageHelmValuesMap {
+		for i := range m {
+			moving := i.Digest == "" && registry.MovingTag(i.Tag)
+			if moving {
+				slog.Warn("Image uses a moving tag. The image imported may differ between runs",
+					slog.String("chart", c.Name),
+					slog.String("image", i.Registry+"/"+i.Repository),
+					slog.String("tag", i.Tag),
+					slog.Bool("pinned", p.ImportConfig.Import.PinMovingTags || p.ImportConfig.Import.PinDigests),
+				)
+			}
+			if err := registry.PinDigest(ctx, p.SourceRegistries, i, p.ImportConfig.Import.PinDigests || (moving && p.ImportConfig.Import.PinMovingTags)); err != nil {
+				return err
+			}
+		}
+	}
+	p.Data = chartImageHelmValuesMap
+
+	// Output table of image to helm chart value path
+	go func() {
+		output.RenderHelmValuePathToImageTable(chartImageHelmValuesMap)
+		slog.Debug("Parsing of user specified chart(s) completed")
+	}()
+
+	// STEP 3: Validate and correct image references from charts
+	slog.Debug("Checking presence of images from chart(s) in registries...")
+	unrouted := p.route(chartImageHelmValuesMap)
+	cs, imgs, err := helm.IdentifyImportCandidates(
+		ctx,
+		p.Registries,
+		chartImageHelmValuesMap,
+		p.All,
+	)
+	if err != nil {
+		return err
+	}
+	p.Import = cs
+	p.Imgs = imgs
+	p.drop(unrouted)
+	for _, i := range imgs {
+		if ref, err := i.String(); err == nil {
+			p.item("analyze", ref, len(imgs), nil)
+		}
+	}
+
+	if err := p.WriteValues(); err != nil {
+		return err
+	}
+
+	_ = output.RenderChartOverviewTable(
+		ctx,
+		p.viper,
+		len(charts.Charts),
+		p.Registries,
+		p.SourceRegistries,
+		charts,
+		chartImageHelmValuesMap,
+	)
+	// Output table of image status in registries
+	_ = output.RenderImageOverviewTable(
+		ctx,
+		p.viper,
+		len(imgs),
+		p.Registries,
+		chartImageHelmValuesMap,
+	)
+	slog.Debug("Finished checking image availability in registries")
+
+	p.Layout, err = newLayout(chartImageHelmValuesMap)
+	return err
+}
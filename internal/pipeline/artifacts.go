@@ -0,0 +1,26 @@
+package pipeline
+
+import (
+	"sort"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// reportArtifacts are the reports and SBOMs written about the images, published to the sinks
+func (p *Pipeline) reportArtifacts() []registry.Artifact {
+	as := []registry.Artifact{}
+	for subject, path := range p.reports {
+		as = append(as, registry.Artifact{Kind: registry.ReportArtifact, Path: path, Subject: subject})
+	}
+	for subject, path := range p.sboms {
+		as = append(as, registry.Artifact{Kind: registry.SBOMArtifact, Path: path, Subject: subject})
+	}
+
+	sort.SliceStable(as, func(i, j int) bool {
+		if as[i].Kind != as[j].Kind {
+			return as[i].Kind < as[j].Kind
+		}
+		return as[i].Path < as[j].Path
+	})
+	return as
+}
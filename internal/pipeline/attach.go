@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+)
+
+// vulnPredicate wraps the scan report of the image in the Cosign vulnerability predicate, written next to the report
+func (p *Pipeline) vulnPredicate(i registry.Image, report string) (string, error) {
+	b, err := os.ReadFile(report)
+	if err != nil {
+		return "", err
+	}
+	var r struct {
+		CreatedAt time.Time
+	}
+	if err := json.Unmarshal(b, &r); err != nil {
+		return "", fmt.Errorf("internal: error reading scan report %s :: %w", report, err)
+	}
+
+	predicate, err := mySign.VulnPredicate(json.RawMessage(b), r.CreatedAt)
+	if err != nil {
+		return "", err
+	}
+	path, err := p.outputFile(p.ImportConfig.Import.Copacetic.Output.Reports.Folder, "vuln", i, ".json")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, predicate, 0o644)
+}
+
+// imageRefs references the image in every registry it is routed to, by digest or by tag in dry-run
+func (p *Pipeline) imageRefs(ctx context.Context, i registry.Image, name string) []string {
+	refs, tag, registries := []string{}, i.Tag, i.RoutedTo(p.Registries)
+	if p.DryRun {
+		for _, r := range registries {
+			refs = append(refs, r.Ref(name, tag))
+		}
+		return refs
+	}
+	ds := digests(ctx, name, tag, registries)
+	for _, r := range registries {
+		if d, ok := ds[r.URL]; ok {
+			refs = append(refs, r.Ref(name, d))
+		}
+	}
+	return refs
+}
+
+// AttachReports attaches the SBOM and the latest vulnerability report of every imported image to the image in the registries as signed in-toto attestations, if enabled
+func (p *Pipeline) AttachReports(ctx context.Context) error {
+	c := p.ImportConfig.Import.Cosign
+	if !c.Enabled || !(c.Attach.SBOM || c.Attach.Vulnerabilities) {
+		return nil
+	}
+
+	sbomType := mySign.PredicateSPDX
+	if p.ImportConfig.Import.SBOM.Format == trivy.FormatCycloneDX {
+		sbomType = mySign.PredicateCycloneDX
+	}
+
+	ps := []mySign.Predicate{}
+	for _, i := range p.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return err
+		}
+		name, err := i.ImageName()
+		if err != nil {
+			return err
+		}
+
+		documents := map[string]string{}
+		if path, ok := p.sboms[ref]; ok && c.Attach.SBOM {
+			documents[sbomType] = path
+		}
+		if report, ok := p.reports[ref]; ok && c.Attach.Vulnerabilities {
+			path, err := p.vulnPredicate(i, report)
+			if err != nil {
+				return err
+			}
+			documents[mySign.PredicateVuln] = path
+		}
+
+		for _, target := range p.imageRefs(ctx, i, name) {
+			for t, path := range documents {
+				ps = append(ps, mySign.Predicate{Ref: target, Path: path, Type: t})
+			}
+		}
+	}
+
+	return p.signOption().Attest(ctx, ps)
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/attest"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+)
+
+func attestTargets(m map[string]string) []attest.Target {
+	ts := make([]attest.Target, 0, len(m))
+	for url, d := range m {
+		ts = append(ts, attest.Target{Registry: url, Digest: d})
+	}
+	return ts
+}
+
+// policies evaluates the import policies for an artifact present in the registries of ts
+func (p *Pipeline) policies(ts []attest.Target) []attest.Policy {
+	ps := []attest.Policy{{
+		Name:    "present",
+		Passed:  len(ts) == len(p.Registries),
+		Message: fmt.Sprintf("present in %d of %d registries", len(ts), len(p.Registries)),
+	}}
+	if p.ImportConfig.Import.Cosign.Enabled {
+		ps = append(ps, attest.Policy{Name: "signed", Passed: p.signed})
+	}
+	return ps
+}
+
+// artifacts imported by the run, with the digests in each registry and the policy results
+func (p *Pipeline) artifacts(ctx context.Context) ([]attest.Artifact, error) {
+	as := []attest.Artifact{}
+
+	for _, c := range p.Import.Charts {
+		name := fmt.Sprintf("charts/%s", c.Name)
+		ts := attestTargets(digests(ctx, name, registry.OCITag(c.Version), p.Registries))
+		as = append(as, attest.Artifact{
+			Kind:      attest.Chart,
+			Name:      name,
+			Reference: registry.OCITag(c.Version),
+			Source:    c.Repo.URL,
+			Targets:   ts,
+			Signed:    p.signed,
+			Policies:  p.policies(ts),
+		})
+	}
+
+	for _, i := range p.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return nil, err
+		}
+		name, err := i.ImageName()
+		if err != nil {
+			return nil, err
+		}
+		ts := attestTargets(digests(ctx, name, i.Tag, p.Registries))
+
+		a := attest.Artifact{
+			Kind:            attest.Image,
+			Name:            name,
+			Reference:       i.Tag,
+			Source:          ref,
+			SourceDigest:    i.Digest,
+			Targets:         ts,
+			Signed:          p.signed,
+			Vulnerabilities: p.Vulns[ref],
+			Workloads:       i.Workloads,
+			Policies:        p.policies(ts),
+		}
+		for _, pi := range p.Patched {
+			if pi.Registry == i.Registry && pi.Repository == i.Repository && pi.Tag == i.Tag {
+				a.Patched = true
+				break
+			}
+		}
+		// images Copacetic can patch must have been patched
+		for _, pi := range p.patch {
+			if pi.Registry == i.Registry && pi.Repository == i.Repository && pi.Tag == i.Tag {
+				a.Policies = append(a.Policies, attest.Policy{Name: "patched", Passed: a.Patched})
+				break
+			}
+		}
+		as = append(as, a)
+	}
+
+	return as, nil
+}
+
+// Attest stores a signed in-toto attestation of the imported artifacts in the registries, and writes the evidence pack, if enabled
+func (p *Pipeline) Attest(ctx context.Context) error {
+	if !p.Attestation.Enabled {
+		return nil
+	}
+
+	as, err := p.artifacts(ctx)
+	if err != nil {
+		return err
+	}
+	s := attest.New(version.UserAgent(), time.Now(), as)
+
+	envelope, err := s.Sign(ctx, p.ImportConfig.Import.Cosign.KeyRef, *p.ImportConfig.Import.Cosign.KeyRefPass)
+	if err != nil {
+		return err
+	}
+
+	locations := []string{}
+	for _, r := range p.Registries {
+		d, err := r.PushArtifact(ctx, attest.Repository, s.Tag(), attest.ArtifactType, attest.EnvelopeMediaType, envelope)
+		if err != nil {
+			return fmt.Errorf("internal: error storing attestation in registry %s: %w", r.URL, err)
+		}
+		l := fmt.Sprintf("%s/%s:%s@%s", r.URL, attest.Repository, s.Tag(), d.Digest)
+		locations = append(locations, l)
+		slog.Info("stored import attestation", slog.String("attestation", l))
+	}
+
+	if !s.Passed() {
+		slog.Warn("import policy violations found. See the attestation for details", slog.String("tag", s.Tag()))
+	}
+
+	if p.Attestation.Report == "" {
+		return nil
+	}
+	f, err := os.Create(p.Attestation.Report)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := s.WriteHTML(f, locations); err != nil {
+		return fmt.Errorf("internal: error writing evidence pack %s: %w", p.Attestation.Report, err)
+	}
+	slog.Info("wrote evidence pack", slog.String("path", p.Attestation.Report))
+
+	return f.Close()
+}
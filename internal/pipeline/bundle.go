@@ -0,0 +1,191 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// Export stores all charts and images found by Analyze in the bundle at path, for transfer across an air gap
+func (p *Pipeline) Export(ctx context.Context, path string) error {
+	b, err := registry.OpenBundle(path)
+	if err != nil {
+		return err
+	}
+	b.Sources = p.SourceRegistries
+
+	if err := p.export(ctx, b); err != nil {
+		_ = b.Close(false)
+		return err
+	}
+	if p.BundleConfig.Sign {
+		if err := b.Sign(p.signOption().SignBlob); err != nil {
+			_ = b.Close(false)
+			return fmt.Errorf("internal: error signing bundle: %w", err)
+		}
+		slog.Info("signed bundle", slog.String("bundle", path))
+	}
+	if err := b.Close(true); err != nil {
+		return err
+	}
+
+	slog.Info("exported charts and images to bundle", slog.String("bundle", path))
+	return nil
+}
+
+func (p *Pipeline) export(ctx context.Context, b *registry.Bundle) error {
+	err := helm.ChartExportOption{
+		ChartCollection: &p.Charts,
+		Bundle:          b,
+	}.Run(ctx, p.Opts...)
+	if err != nil {
+		return fmt.Errorf("internal: error exporting charts to bundle: %w", err)
+	}
+
+	// the same image can be used by several charts
+	seen := map[string]bool{}
+	imgs := []*registry.Image{}
+	for _, m := range p.Data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			imgs = append(imgs, i)
+		}
+	}
+
+	err = registry.ExportOption{
+		Imgs:         imgs,
+		Bundle:       b,
+		Architecture: p.ImportConfig.Import.Architecture,
+	}.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("internal: error exporting images to bundle: %w", err)
+	}
+
+	if p.ToolsConfig.Enabled {
+		if err := b.AddTools(ctx, p.ToolsConfig.List(), p.ImportConfig.Import.Architecture); err != nil {
+			return err
+		}
+		slog.Info("exported tools to bundle", slog.Int("tools", len(p.ToolsConfig.List())))
+	}
+
+	return nil
+}
+
+// Load pushes the charts and images of the bundle at path to the registries
+func (p *Pipeline) Load(ctx context.Context, path string) error {
+	b, err := registry.OpenBundle(path)
+	if err != nil {
+		return err
+	}
+	defer b.Close(false)
+
+	if c := p.BundleConfig.Verify; c.Enabled {
+		err := mySign.VerifyOption{
+			KeyRef:     c.KeyRef,
+			Identities: identities(c.Identities),
+			RekorURL:   c.RekorURL,
+			IgnoreTlog: c.IgnoreTlog,
+		}.VerifyBlob(ctx, b.Index())
+		if err != nil {
+			return fmt.Errorf("internal: error verifying bundle %s: %w", path, err)
+		}
+		slog.Info("verified bundle signature", slog.String("bundle", path))
+	}
+
+	err = registry.LoadOption{
+		Bundle:     b,
+		Registries: p.Registries,
+		All:        p.All,
+		DryRun:     p.DryRun,
+		Plan:       p.Plan,
+	}.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("internal: error loading bundle into registries: %w", err)
+	}
+
+	if p.ToolsConfig.Enabled && !p.DryRun {
+		return p.writeToolsConfig(ctx, b)
+	}
+	return nil
+}
+
+// writeToolsConfig writes the configuration of Buildkit, the Trivy server and Helmper to use the tools loaded into the first registry,
+// referenced by the digest in the bundle
+func (p *Pipeline) writeToolsConfig(ctx context.Context, b *registry.Bundle) error {
+	if len(p.Registries) == 0 {
+		return nil
+	}
+	r := p.Registries[0]
+	tools, err := b.PinTools(ctx, p.ToolsConfig.List())
+	if err != nil {
+		return err
+	}
+
+	buildkit, err := registry.BuildkitConfig(tools, r)
+	if err != nil {
+		return err
+	}
+	trivy, err := registry.TrivyEnv(tools, r)
+	if err != nil {
+		return err
+	}
+	helmper, err := toolsHelmperConfig(tools, r)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(p.ToolsConfig.Folder, 0o755); err != nil {
+		return err
+	}
+	for name, content := range map[string]string{"buildkitd.toml": buildkit, "trivy.env": trivy, "helmper.yaml": helmper} {
+		path := filepath.Join(p.ToolsConfig.Folder, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return fmt.Errorf("internal: error writing tools configuration %s :: %w", path, err)
+		}
+	}
+	slog.Info("wrote Buildkit, Trivy and Helmper configuration for the loaded tools", slog.String("folder", p.ToolsConfig.Folder), slog.String("registry", r.URL))
+	return nil
+}
+
+// toolsHelmperConfig returns the configuration of Helmper to scan with the Trivy database and patch with the Buildkit image
+// loaded into the registry, to merge into the configuration file on the disconnected side
+func toolsHelmperConfig(tools []registry.Tool, r registry.Registry) (string, error) {
+	refs := map[string]string{}
+	for _, t := range tools {
+		if t.Name != registry.TrivyDBTool && t.Name != registry.BuildkitTool {
+			continue
+		}
+		ref, err := r.ToolRef(t)
+		if err != nil {
+			return "", err
+		}
+		refs[t.Name] = ref
+	}
+
+	copacetic := map[string]any{}
+	if ref, ok := refs[registry.TrivyDBTool]; ok {
+		copacetic["trivy"] = map[string]any{"dbRepository": ref}
+	}
+	if ref, ok := refs[registry.BuildkitTool]; ok {
+		copacetic["buildkitd"] = map[string]any{"container": map[string]any{"image": ref}}
+	}
+	b, err := yaml.Marshal(map[string]any{"import": map[string]any{"copacetic": copacetic}})
+	if err != nil {
+		return "", err
+	}
+	return "# Generated by helmper: scan and patch with the tools loaded into " + r.URL + "\n" + string(b), nil
+}
@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/notation"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// ImportCharts pushes the charts and their dependencies to the registries
+func (p *Pipeline) ImportCharts(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "import charts")
+	defer func() { done(err) }()
+
+	if len(p.Import.Charts) == 0 {
+		return nil
+	}
+
+	opt := helm.ChartImportOption{
+		Registries:          p.Registries,
+		ChartCollection:     &p.Import,
+		All:                 p.All,
+		ModifyRegistry:      p.ImportConfig.Import.ReplaceRegistryReferences,
+		RewriteDependencies: p.ImportConfig.Import.Dependencies.Rewrite,
+		// charts pushed to a fallback are not in the registry, so they are not signed
+		OnFallback: func(f registry.Fallback) {
+			p.fallbacks = append(p.fallbacks, f)
+			if p.unsigned == nil {
+				p.unsigned = map[string]bool{}
+			}
+			p.unsigned[f.Image] = true
+		},
+		DryRun: p.DryRun,
+		Plan:   p.Plan,
+	}
+	// patched images are pinned as named in the registries
+	data, err := p.patchedData(p.Data)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.ImportConfig.Import.PinDigests:
+		opt.PinImages = data
+	case p.ImportConfig.Import.PinMovingTags:
+		opt.PinImages = movingTagImages(data)
+	}
+
+	if err := opt.Run(ctx, p.Opts...); err != nil {
+		return fmt.Errorf("internal: error importing chart to registry: %w", err)
+	}
+	p.chartsImported = true
+
+	return nil
+}
+
+// movingTagImages are the images of each chart with moving tags, pinned to digests by Analyze
+func movingTagImages(data helm.ChartData) helm.ChartData {
+	res := helm.ChartData{}
+	for c, m := range data {
+		for i, paths := range m {
+			if !i.UseDigest || !registry.MovingTag(i.Tag) {
+				continue
+			}
+			if res[c] == nil {
+				res[c] = map[*registry.Image][]string{}
+			}
+			res[c][i] = paths
+		}
+	}
+	return res
+}
+
+// signer returns the key and the Sigstore deployment to sign with. The key is empty when signing keyless
+func (p *Pipeline) signer() (string, mySign.Sigstore) {
+	c := p.ImportConfig.Import.Cosign
+	keyRef := c.KeyRef
+	if c.Keyless {
+		keyRef = ""
+	}
+	return keyRef, mySign.Sigstore{
+		FulcioURL:                c.Sigstore.FulcioURL,
+		RekorURL:                 c.Sigstore.RekorURL,
+		TUFMirror:                c.Sigstore.TUFMirror,
+		TUFRoot:                  c.Sigstore.TUFRoot,
+		FulcioRoots:              c.Sigstore.FulcioRoots,
+		RekorPublicKey:           c.Sigstore.RekorPublicKey,
+		CTLogPublicKey:           c.Sigstore.CTLogPublicKey,
+		IdentityToken:            c.Sigstore.IdentityToken,
+		IdentityTokenFile:        c.Sigstore.IdentityTokenFile,
+		OIDCIssuer:               c.Sigstore.OIDCIssuer,
+		OIDCClientID:             c.Sigstore.OIDCClientID,
+		TlogUpload:               c.Sigstore.TlogUpload,
+		InsecureSkipFulcioVerify: c.Sigstore.InsecureSkipFulcioVerify,
+	}
+}
+
+// signOption configures Cosign to sign artifacts outside the charts and images of the run
+func (p *Pipeline) signOption() mySign.SignOption {
+	keyRef, sigstore := p.signer()
+	return mySign.SignOption{
+		KeyRef:            keyRef,
+		KeyRefPass:        *p.ImportConfig.Import.Cosign.KeyRefPass,
+		AllowInsecure:     p.ImportConfig.Import.Cosign.AllowInsecure,
+		AllowHTTPRegistry: p.ImportConfig.Import.Cosign.AllowHTTPRegistry,
+		Sigstore:          sigstore,
+
+		DryRun: p.DryRun,
+		Plan:   p.Plan,
+	}
+}
+
+// notationSigner configures Notation to sign the artifacts
+func (p *Pipeline) notationSigner() notation.SignOption {
+	c := p.ImportConfig.Import.Notation
+	return notation.SignOption{
+		Registries: p.Registries,
+		KeyPath:    c.KeyFile,
+		CertPath:   c.CertFile,
+		Format:     c.SignatureFormat,
+		Expiry:     c.Expiry,
+
+		DryRun: p.DryRun,
+		Plan:   p.Plan,
+	}
+}
+
+// signers are the signers enabled in the configuration
+func (p *Pipeline) signers() []registry.Signer {
+	ss := []registry.Signer{}
+	if p.ImportConfig.Import.Cosign.Enabled {
+		ss = append(ss, p.signOption())
+	}
+	if p.ImportConfig.Import.Notation.Enabled {
+		ss = append(ss, p.notationSigner())
+	}
+	return ss
+}
+
+// SignCharts signs the charts in the registries with Cosign and Notation, if enabled
+func (p *Pipeline) SignCharts(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "sign charts")
+	defer func() { done(err) }()
+
+	// sign the charts, except the charts excluded from signing by the policies
+	charts := helm.ChartCollection{}
+	for _, c := range p.Import.Charts {
+		if !p.unsigned[chartKey(c)] {
+			charts.Charts = append(charts.Charts, c)
+		}
+	}
+	// charts uploaded to classic chart repositories can not be signed in the registry
+	registries := slices.DeleteFunc(slices.Clone(p.Registries), func(r registry.Registry) bool { return !r.OCICharts() })
+	if len(charts.Charts) == 0 || len(registries) == 0 {
+		return nil
+	}
+
+	if p.ImportConfig.Import.Notation.Enabled {
+		for _, r := range registries {
+			refs, err := charts.Refs(ctx, r, p.DryRun)
+			if err != nil {
+				return err
+			}
+			if err := p.notationSigner().Sign(registry.Artifacts(registry.ChartArtifact, refs...)); err != nil {
+				return err
+			}
+		}
+		p.signed = true
+	}
+
+	if !p.ImportConfig.Import.Cosign.Enabled {
+		return nil
+	}
+
+	slog.Debug("Cosign enabled")
+	keyRef, sigstore := p.signer()
+	signo := mySign.SignChartOption{
+		ChartCollection: &charts,
+		Registries:      registries,
+
+		KeyRef:            keyRef,
+		KeyRefPass:        *p.ImportConfig.Import.Cosign.KeyRefPass,
+		AllowInsecure:     p.ImportConfig.Import.Cosign.AllowInsecure,
+		AllowHTTPRegistry: p.ImportConfig.Import.Cosign.AllowHTTPRegistry,
+		Sigstore:          sigstore,
+
+		DryRun: p.DryRun,
+		Plan:   p.Plan,
+	}
+	if err := signo.Run(); err != nil {
+		slog.Error("Error signing with Cosign")
+		return err
+	}
+	p.signed = true
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// clusterImages adds the images of the pods running in the cluster to m. Images running from the registries are already mirrored and skipped
+func (p *Pipeline) clusterImages(ctx context.Context, m map[*registry.Image][]string) error {
+	is, err := p.Discovery.Images(ctx)
+	if err != nil {
+		return err
+	}
+	skipped := 0
+	for i, paths := range is {
+		if p.mirrored(i) {
+			skipped++
+			continue
+		}
+		m[i] = paths
+	}
+	slog.Debug("Found images in cluster", slog.Int("count", len(is)), slog.Int("mirrored", skipped))
+	return nil
+}
+
+// mirrored reports if the image is pulled from one of the registries
+func (p *Pipeline) mirrored(i *registry.Image) bool {
+	ref := i.Registry + "/" + i.Repository
+	for _, r := range p.Registries {
+		u := strings.TrimSuffix(r.URL, "/")
+		if _, h, ok := strings.Cut(u, "://"); ok {
+			u = h
+		}
+		if strings.HasPrefix(ref, u+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,4 @@
+/*
+Package pipeline implements the stages of a Helmper run: analyzing charts for images, scanning, patching, importing and signing charts and images, and recording the result. Each stage can be run on its own, or all stages in sequence with Run. Signers sign charts and images as registry.Artifact, and the reports and SBOMs listed by reportArtifacts are published to the sinks.
+*/
+package pipeline
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// backoff is the delay between retries of failed copies
+func (p *Pipeline) backoff() registry.Backoff {
+	return registry.Backoff{
+		Initial: p.ImportConfig.Import.Backoff,
+		Max:     p.ImportConfig.Import.MaxBackoff,
+	}
+}
+
+// skipFailed removes the images that could not be pushed by the stage from the images of the later stages. The failures are reported by Finish
+func (p *Pipeline) skipFailed(stage string, fs []registry.Failure) {
+	p.failures = append(p.failures, fs...)
+	failed := make(map[string]bool, len(fs))
+	for _, f := range fs {
+		failed[f.Image] = true
+		p.item(stage, f.Image, 0, f.Err)
+	}
+	p.drop(failed)
+}
+
+// skipFallbacks removes the images pushed to the fallback of a registry from the images of the later stages, as they are not in the registry.
+// They are pushed to the registry again by the next run. The fallbacks are reported by Finish
+func (p *Pipeline) skipFallbacks(fs []registry.Fallback) {
+	p.fallbacks = append(p.fallbacks, fs...)
+	images := make(map[string]bool, len(fs))
+	for _, f := range fs {
+		images[f.Image] = true
+	}
+	p.drop(images)
+}
+
+// drop removes the images from the images of the later stages
+func (p *Pipeline) drop(images map[string]bool) {
+	p.push = slices.DeleteFunc(p.push, func(i *registry.Image) bool {
+		ref, err := i.String()
+		return err == nil && images[ref]
+	})
+	p.patch = slices.DeleteFunc(p.patch, func(i *registry.Image) bool {
+		ref, err := i.String()
+		return err == nil && images[ref]
+	})
+	p.Imgs = slices.DeleteFunc(p.Imgs, func(i registry.Image) bool {
+		ref, err := i.String()
+		return err == nil && images[ref]
+	})
+}
+
+// reportFallbacks renders the charts and images pushed to the fallback of a registry
+func (p *Pipeline) reportFallbacks() {
+	if len(p.fallbacks) == 0 {
+		return
+	}
+	sort.Slice(p.fallbacks, func(i, j int) bool {
+		return p.fallbacks[i].Image+p.fallbacks[i].Registry < p.fallbacks[j].Image+p.fallbacks[j].Registry
+	})
+	output.RenderFallbackTable(p.fallbacks)
+	slog.Warn("charts and images were pushed to fallback registries. the next run pushes them to the registries again", slog.Int("artifacts", len(p.fallbacks)))
+}
+
+// reportFailures renders the images that could not be pushed, and fails the run if there are any
+func (p *Pipeline) reportFailures() error {
+	if len(p.failures) == 0 {
+		return nil
+	}
+	output.RenderFailedImageTable(p.failures)
+	images := map[string]bool{}
+	for _, f := range p.failures {
+		images[f.Image] = true
+	}
+	return fmt.Errorf("internal: %d image(s) could not be pushed to the registries", len(images))
+}
@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+)
+
+// Finish reports the planned actions in dry-run, or a summary of the run, also published to the sinks
+func (p *Pipeline) Finish() error {
+	if err := p.WriteSARIF(context.Background()); err != nil {
+		return err
+	}
+	if len(p.decisions) > 0 {
+		output.RenderPolicyTable(p.decisions)
+	}
+
+	if p.DryRun {
+		return reportPlan(p.Plan, p.DryRunScript)
+	}
+	p.reportFallbacks()
+	if err := p.reportFailures(); err != nil {
+		return err
+	}
+
+	v := version.Get()
+	slog.Info("helmper run completed",
+		slog.String("version", v.Version),
+		slog.String("commit", v.Commit),
+		slog.String("date", v.Date),
+		slog.Int("charts", len(p.Import.Charts)),
+		slog.Int("images", len(p.Imgs)),
+		slog.Int("patched", len(p.Patched)),
+	)
+	// the run succeeded even if it could not be published
+	if err := p.Publish(context.Background(), nil); err != nil {
+		slog.Warn("could not publish run", slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// reportPlan renders the actions recorded in dry-run, and writes them as a shell script if path is set
+func reportPlan(p *plan.Plan, path string) error {
+	output.RenderPlanTable(p)
+
+	if path != "" {
+		if err := writeScript(p, path); err != nil {
+			return fmt.Errorf("internal: error writing dry-run script: %w", err)
+		}
+		slog.Info("wrote dry-run script", slog.String("path", path))
+	}
+
+	slog.Info("dry-run enabled. no changes have been made to the registries", slog.Int("actions", p.Len()))
+	return nil
+}
+
+// write plan as shell script to path. '-' writes to stdout
+func writeScript(p *plan.Plan, path string) error {
+	if path == "-" {
+		return p.WriteScript(terminal.Stdout)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return p.WriteScript(f)
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+// gate applies the severity gate to the pre-scan report of the image, and reports whether the image is held back from the import
+func (p *Pipeline) gate(i registry.Image, ref string, r types.Report) (bool, error) {
+	failOn := p.ImportConfig.Import.FailOn
+	if failOn == "" {
+		return false, nil
+	}
+	ids, err := trivy.AtOrAbove(r, failOn)
+	if err != nil {
+		return false, err
+	}
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	if p.gated == nil {
+		p.gated = map[string][]string{}
+	}
+	p.gated[ref] = ids
+	if p.ImportConfig.Import.FailAction == "quarantine" {
+		p.quarantined = append(p.quarantined, &i)
+	}
+	slog.Warn("Image has vulnerabilities at or above the severity gate",
+		slog.String("image", ref),
+		slog.String("fail_on", failOn),
+		slog.String("action", p.ImportConfig.Import.FailAction),
+		slog.Int("vulnerabilities", len(ids)),
+	)
+	return true, nil
+}
+
+// enforceGate fails the run if images were held back by the severity gate, or removes them from the images to import
+func (p *Pipeline) enforceGate() error {
+	if len(p.gated) == 0 {
+		return nil
+	}
+
+	if p.ImportConfig.Import.FailAction == "fail" {
+		refs := make([]string, 0, len(p.gated))
+		for ref, ids := range p.gated {
+			refs = append(refs, fmt.Sprintf("%s (%s)", ref, strings.Join(ids, ", ")))
+		}
+		slices.Sort(refs)
+		return fmt.Errorf("internal: %d image(s) have vulnerabilities at or above %s: %s", len(refs), p.ImportConfig.Import.FailOn, strings.Join(refs, "; "))
+	}
+
+	p.Imgs = slices.DeleteFunc(p.Imgs, func(i registry.Image) bool {
+		ref, err := i.String()
+		return err == nil && p.gated[ref] != nil
+	})
+	return nil
+}
+
+// quarantineRegistries are the registries with the quarantine repository prefix
+func (p *Pipeline) quarantineRegistries() []registry.Registry {
+	rs := make([]registry.Registry, 0, len(p.Registries))
+	for _, r := range p.Registries {
+		r.URL = r.URL + "/" + p.ImportConfig.Import.Quarantine
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+// ImportQuarantined pushes the images held back by the severity gate to the quarantine repositories, unpatched and unsigned
+func (p *Pipeline) ImportQuarantined(ctx context.Context) error {
+	if len(p.quarantined) == 0 {
+		return nil
+	}
+	slog.Info("Importing images to quarantine", slog.Int("images", len(p.quarantined)), slog.String("prefix", p.ImportConfig.Import.Quarantine))
+
+	return registry.ImportOption{
+		Registries:   p.quarantineRegistries(),
+		Imgs:         p.quarantined,
+		All:          p.All,
+		Architecture: p.ImportConfig.Import.Architecture,
+		Concurrency:  p.ImportConfig.Import.Concurrency,
+		Retries:      p.ImportConfig.Import.Retries,
+		Backoff:      p.backoff(),
+		DryRun:       p.DryRun,
+		Plan:         p.Plan,
+	}.Run(ctx)
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+)
+
+// DefaultGroup holds the charts without a group, run after the configured groups
+const DefaultGroup = "default"
+
+// Stages returns the groups of the run in order, with the default group if any chart has no group
+func (p *Pipeline) Stages() []bootstrap.GroupConfigSection {
+	gs := append([]bootstrap.GroupConfigSection{}, p.Groups...)
+	for _, c := range p.Charts.Charts {
+		if c.Group == "" {
+			return append(gs, bootstrap.GroupConfigSection{Name: DefaultGroup})
+		}
+	}
+	return gs
+}
+
+// Stage returns a pipeline for the charts of the group. The images of the configuration and sources are imported with the first group.
+// The files written per run, and the name of the pull secret, are suffixed with the group, so groups do not overwrite each other
+func (p *Pipeline) Stage(group string, first bool) *Pipeline {
+	s := New(p.viper)
+	s.Command = p.Command
+	s.Events = p.Events
+	s.Opts = p.Opts
+
+	cs := []helm.Chart{}
+	for _, c := range p.Charts.Charts {
+		if c.Group == group || c.Group == "" && group == DefaultGroup {
+			cs = append(cs, c)
+		}
+	}
+	s.Charts = helm.ChartCollection{Charts: cs}
+	if !first {
+		s.Images = nil
+		s.Sources = nil
+	}
+
+	s.LockPath = groupPath(s.LockPath, group)
+	s.ProgressPath = groupPath(s.ProgressPath, group)
+	s.ReportPath = groupPath(s.ReportPath, group)
+	s.LicensesConfig.File = groupPath(s.LicensesConfig.File, group)
+	s.PullSecrets.File = groupPath(s.PullSecrets.File, group)
+	s.PullSecrets.Name = s.PullSecrets.Name + "-" + group
+	return s
+}
+
+// groupPath inserts the group before the extension of the path, e.g. 'helmper.core.lock'
+func groupPath(path string, group string) string {
+	if path == "" || path == "-" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + group + ext
+}
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// harborRegistry returns the Harbor registry the images are replicated into
+func (p *Pipeline) harborRegistry() (registry.Registry, error) {
+	for _, r := range p.Registries {
+		if p.ImportConfig.Import.Harbor.Registry == "" || r.Name == p.ImportConfig.Import.Harbor.Registry {
+			return r, nil
+		}
+	}
+	return registry.Registry{}, fmt.Errorf("internal: no Harbor registry '%s' configured", p.ImportConfig.Import.Harbor.Registry)
+}
+
+// Replicate generates the Harbor replication rules for the images and writes them to the configured file.
+// With apply, Harbor replicates the images instead of copying them. It returns the registries the images are still copied to
+func (p *Pipeline) Replicate(ctx context.Context, imgs []*registry.Image) ([]registry.Registry, error) {
+	c := p.ImportConfig.Import.Harbor
+	if !c.Enabled || len(imgs) == 0 {
+		return p.Registries, nil
+	}
+
+	harbor, err := p.harborRegistry()
+	if err != nil {
+		return nil, err
+	}
+	rules, err := registry.ReplicationRules(imgs, harbor)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.File != "" {
+		b, err := json.MarshalIndent(rules, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(c.File, b, 0o644); err != nil {
+			return nil, fmt.Errorf("internal: error writing Harbor replication rules to %s :: %w", c.File, err)
+		}
+		slog.Info("Wrote Harbor replication rules", slog.String("file", c.File), slog.Int("rules", len(rules)))
+	}
+
+	if !c.Apply {
+		return p.Registries, nil
+	}
+
+	rest := make([]registry.Registry, 0, len(p.Registries))
+	for _, r := range p.Registries {
+		if r.URL != harbor.URL {
+			rest = append(rest, r)
+		}
+	}
+
+	if p.DryRun {
+		for _, i := range imgs {
+			src, err := i.String()
+			if err != nil {
+				return nil, err
+			}
+			name, err := i.ImageName()
+			if err != nil {
+				return nil, err
+			}
+			p.Plan.Add(plan.Action{
+				Kind:      plan.ReplicateImage,
+				Source:    src,
+				Target:    fmt.Sprintf("%s/%s:%s", harbor.URL, name, i.Tag),
+				Insecure:  harbor.Insecure,
+				PlainHTTP: harbor.PlainHTTP,
+			})
+		}
+		return rest, nil
+	}
+
+	h := registry.Harbor{Registry: harbor, URL: c.URL}
+	executions, err := h.Apply(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Waiting for Harbor to replicate the images", slog.String("registry", harbor.URL), slog.Int("rules", len(rules)))
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	if err := h.Wait(ctx, executions); err != nil {
+		return nil, err
+	}
+	return rest, nil
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ChristofferNissen/helmper/pkg/hooks"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// RunHooks runs the hooks of the stage with the charts and images of the stage. Hooks are not run in dry-run
+func (p *Pipeline) RunHooks(ctx context.Context, stage string) error {
+	if len(p.Hooks) == 0 || p.DryRun {
+		return nil
+	}
+
+	payload := hooks.Payload{Stage: stage, Charts: []string{}, Images: []string{}}
+	addImages := func(imgs []*registry.Image) {
+		for _, i := range imgs {
+			ref, err := i.String()
+			if err != nil || (stage == hooks.StageSign && p.unsigned[ref]) {
+				continue
+			}
+			payload.Images = append(payload.Images, ref)
+		}
+	}
+	addCharts := func() {
+		for _, c := range p.Import.Charts {
+			if stage == hooks.StageSign && p.unsigned[chartKey(c)] {
+				continue
+			}
+			payload.Charts = append(payload.Charts, c.Name+":"+c.Version)
+		}
+	}
+
+	switch stage {
+	case hooks.StageParse:
+		addCharts()
+		imgs := []*registry.Image{}
+		for i := range p.Imgs {
+			imgs = append(imgs, &p.Imgs[i])
+		}
+		addImages(imgs)
+	case hooks.StageImport, hooks.StageSign:
+		addCharts()
+		patch, push := p.targets()
+		addImages(patch)
+		addImages(push)
+	case hooks.StagePatch:
+		addImages(p.Patched)
+	}
+
+	if err := hooks.Run(ctx, p.Hooks, payload); err != nil {
+		return fmt.Errorf("internal: error running %s hooks :: %w", stage, err)
+	}
+	return nil
+}
@@ -0,0 +1,614 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ChristofferNissen/helmper/pkg/copa"
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/util/tracing"
+	"github.com/schollz/progressbar/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// outputFile returns the path of a file written for the image in the per-chart output layout
+func (p *Pipeline) outputFile(root string, kind string, i registry.Image, ext string) (string, error) {
+	ref, err := i.String()
+	if err != nil {
+		return "", err
+	}
+	name, err := i.ImageName()
+	if err != nil {
+		return "", err
+	}
+	path, err := p.Layout.Path(root, kind, ref, name, i.Tag, ext)
+	if err != nil {
+		return "", err
+	}
+	p.files = append(p.files, path)
+	return path, nil
+}
+
+func (p *Pipeline) scanOption() trivy.ScanOption {
+	return trivy.ScanOption{
+		DockerHost:    p.ImportConfig.Import.Copacetic.Buildkitd.Addr,
+		TrivyServer:   p.ImportConfig.Import.Copacetic.Trivy.Addr,
+		Insecure:      p.ImportConfig.Import.Copacetic.Trivy.Insecure,
+		CAFile:        p.ImportConfig.Import.Copacetic.Trivy.CAFile,
+		CertFile:      p.ImportConfig.Import.Copacetic.Trivy.CertFile,
+		KeyFile:       p.ImportConfig.Import.Copacetic.Trivy.KeyFile,
+		IgnoreUnfixed: p.ImportConfig.Import.Copacetic.Trivy.IgnoreUnfixed,
+		CacheDir:      p.ImportConfig.Import.Copacetic.Trivy.CacheDir,
+		DBRepository:  p.ImportConfig.Import.Copacetic.Trivy.DBRepository,
+		DBPath:        p.ImportConfig.Import.Copacetic.Trivy.DBPath,
+		IgnoreFile:    p.ImportConfig.Import.Copacetic.Trivy.IgnoreFile,
+		VEX:           p.ImportConfig.Import.Copacetic.Trivy.VEX,
+		Architecture:  p.ImportConfig.Import.Architecture,
+		Sources:       p.SourceRegistries,
+	}
+}
+
+// patcher returns the configured patcher, or Copacetic configured from the import config
+func (p *Pipeline) patcher() registry.Patcher {
+	if p.Patcher != nil {
+		return p.Patcher
+	}
+	return copa.PatchOption{
+		Registries: p.Registries,
+		Sources:    p.SourceRegistries,
+		Scanner:    p.scanOption(),
+		Buildkit: struct {
+			Addr       string
+			CACertPath string
+			CertPath   string
+			KeyPath    string
+			Container  copa.Buildkitd
+		}{
+			Addr:       p.ImportConfig.Import.Copacetic.Buildkitd.Addr,
+			CACertPath: p.ImportConfig.Import.Copacetic.Buildkitd.CACertPath,
+			CertPath:   p.ImportConfig.Import.Copacetic.Buildkitd.CertPath,
+			KeyPath:    p.ImportConfig.Import.Copacetic.Buildkitd.KeyPath,
+			Container:  copa.Buildkitd(p.ImportConfig.Import.Copacetic.Buildkitd.Container),
+		},
+		IgnoreErrors: p.ImportConfig.Import.Copacetic.IgnoreErrors,
+		Architecture: p.ImportConfig.Import.Architecture,
+		Platforms:    p.ImportConfig.Import.Architectures,
+		AllowOS:      p.ImportConfig.Import.Copacetic.OS.Allow,
+		DenyOS:       p.ImportConfig.Import.Copacetic.OS.Deny,
+		Tag:          p.patchedTag(),
+		Done: func(i *registry.Image) {
+			p.complete(i, store.Patched)
+			ref, _ := i.String()
+			p.item("patch", ref, len(p.patch), nil)
+		},
+		OnFallback: func(f registry.Fallback) {
+			p.patchFallbacks = append(p.patchFallbacks, f)
+		},
+		ContinueOnError: p.ImportConfig.Import.ContinueOnError,
+		DryRun:          p.DryRun,
+		Plan:            p.Plan,
+	}
+}
+
+// targets returns the images to patch and the images to push as-is. Without a scan no images are patched
+func (p *Pipeline) targets() ([]*registry.Image, []*registry.Image) {
+	if p.patch == nil && p.push == nil {
+		p.patch = make([]*registry.Image, 0)
+		p.push = make([]*registry.Image, 0)
+		for _, i := range p.Imgs {
+			p.push = append(p.push, &i)
+		}
+	}
+	return p.patch, p.push
+}
+
+// writeReport writes the scan report of the image to the reports folder
+func (p *Pipeline) writeReport(kind string, i registry.Image, r any) error {
+	fileName, err := p.outputFile(p.ImportConfig.Import.Copacetic.Output.Reports.Folder, kind, i, ".json")
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(fileName, b, os.ModePerm); err != nil {
+		return err
+	}
+
+	ref, err := i.String()
+	if err != nil {
+		return err
+	}
+	if p.reports == nil {
+		p.reports = map[string]string{}
+	}
+	p.reports[ref] = fileName
+	return nil
+}
+
+// Scan scans the images with Trivy and splits them into images the patcher can patch, and images to push as-is
+func (p *Pipeline) Scan(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "scan")
+	defer func() { done(err) }()
+
+	slog.Debug("Scanning images before patching")
+	p.patch = make([]*registry.Image, 0)
+	p.push = make([]*registry.Image, 0)
+	p.unchanged = nil
+
+	// earlier patches, to patch images only for new fixable vulnerabilities
+	state, err := p.incremental(ctx)
+	if err != nil {
+		return err
+	}
+	if state != nil {
+		defer state.Close()
+	}
+
+	bar := terminal.NewBar(len(p.Imgs), "Scanning images before patching...\r", progressbar.OptionSetRenderBlankState(true))
+	so := p.scanOption()
+	patcher := p.patcher()
+	// images denied by the policies once their vulnerabilities are known
+	denied := map[string]bool{}
+
+	for _, i := range p.Imgs {
+
+		if i.Patch != nil {
+			if !*i.Patch {
+				ref, err := i.String()
+				if err != nil {
+					return err
+				}
+				slog.Debug("image should not be patched",
+					slog.String("image", ref))
+				p.push = append(p.push, &i)
+				continue
+			}
+		}
+
+		ref, err := i.String()
+		if err != nil {
+			return err
+		}
+		_, scan := tracer.Start(ctx, "trivy.scan", trace.WithAttributes(attribute.String("image", ref)))
+		r, err := so.Scan(ref)
+		tracing.End(scan, err)
+		if err != nil {
+			return err
+		}
+		if p.prescan == nil {
+			p.prescan = map[string]int{}
+		}
+		p.prescan[ref] = len(trivy.VulnerabilityIDs(r))
+
+		skip, patch, err := p.admitScanned(ctx, i, ref, r)
+		if err != nil {
+			return err
+		}
+		if skip {
+			denied[ref] = true
+			p.item("scan", ref, len(p.Imgs), nil)
+			_ = bar.Add(1)
+			continue
+		}
+
+		gated, err := p.gate(i, ref, r)
+		if err != nil {
+			return err
+		}
+		if gated {
+			if err := p.writeReport("prescan", i, r); err != nil {
+				return err
+			}
+			p.item("scan", ref, len(p.Imgs), nil)
+			_ = bar.Add(1)
+			continue
+		}
+
+		family, version := "", ""
+		if r.Metadata.OS != nil {
+			family, version = string(r.Metadata.OS.Family), r.Metadata.OS.Name
+			if p.osBases == nil {
+				p.osBases = map[string]string{}
+			}
+			p.osBases[ref] = registry.OSBase(family, r.Metadata.OS.Name)
+		}
+
+		switch {
+		case !patch:
+			slog.Debug("image should not be patched by policy",
+				slog.String("image", ref))
+			p.push = append(p.push, &i)
+
+		case patcher.SupportsOS(family, version):
+			// filter images with no os-pkgs as there is nothing to patch
+			switch trivy.ContainsOsPkgs(r.Results) {
+			case true:
+				fixed := trivy.FixableOSVulnerabilityIDs(r)
+				if p.fixed == nil {
+					p.fixed = map[string][]string{}
+				}
+				p.fixed[ref] = fixed
+				if before, ok := p.patchedBefore(ctx, state, i, fixed); ok {
+					slog.Info("Image has no new fixable vulnerabilities since it was patched. The image will not be patched again.",
+						slog.String("image", ref))
+					p.fixed[ref] = before
+					p.unchanged = append(p.unchanged, &i)
+				} else {
+					slog.Debug("Image does contain os-pkgs vulnerabilities",
+						slog.String("image", ref))
+					p.patch = append(p.patch, &i)
+				}
+			case false:
+				slog.Warn("Image does not contain os-pkgs. The image will not be patched.",
+					slog.String("image", ref),
+				)
+				p.push = append(p.push, &i)
+			}
+
+		default:
+			slog.Warn("Image contains an unsupported OS. The image will not be patched.",
+				slog.String("image", ref),
+			)
+			p.push = append(p.push, &i)
+		}
+
+		// Write report to filesystem
+		if err := p.writeReport("prescan", i, r); err != nil {
+			return err
+		}
+		p.item("scan", ref, len(p.Imgs), nil)
+
+		_ = bar.Add(1)
+	}
+	if err := bar.Finish(); err != nil {
+		return err
+	}
+	p.drop(denied)
+
+	return p.enforceGate()
+}
+
+// ImportImages pushes the images that are not patched to the registries
+func (p *Pipeline) ImportImages(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "import images")
+	defer func() { done(err) }()
+
+	_, push := p.targets()
+
+	if c := p.ImportConfig.Import.BlobCache; c.Enabled && !p.DryRun {
+		n, err := registry.PruneBlobCache(c.Folder, c.MaxAge)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			slog.Info("pruned blob cache", slog.String("folder", c.Folder), slog.Int("blobs", n), slog.Duration("maxAge", c.MaxAge))
+		}
+	}
+
+	for _, r := range p.Registries {
+		cs := r.Collisions(p.Imgs)
+		ts := make([]string, 0, len(cs))
+		for t := range cs {
+			ts = append(ts, t)
+		}
+		if len(ts) > 0 {
+			sort.Strings(ts)
+			return fmt.Errorf("internal: the images %s are all mirrored to %s/%s in the flattened registry %s", strings.Join(cs[ts[0]], ", "), r.URL, ts[0], r.GetName())
+		}
+	}
+
+	if err := p.ImportQuarantined(ctx); err != nil {
+		return err
+	}
+
+	registries, err := p.Replicate(ctx, push)
+	if err != nil {
+		return err
+	}
+
+	push, err = p.remaining(push, store.Pushed)
+	if err != nil {
+		return err
+	}
+	var fmu sync.Mutex
+	fallbacks := []registry.Fallback{}
+	err = registry.ImportOption{
+		Registries:   registries,
+		Imgs:         push,
+		All:          p.All,
+		Architecture: p.ImportConfig.Import.Architecture,
+		Platforms:    p.ImportConfig.Import.Architectures,
+		Referrers:    p.ImportConfig.Import.Referrers,
+		Concurrency:  p.ImportConfig.Import.Concurrency,
+		Retries:      p.ImportConfig.Import.Retries,
+		Backoff:      p.backoff(),
+		Done: func(i *registry.Image) {
+			p.complete(i, store.Pushed)
+			ref, _ := i.String()
+			p.item("import images", ref, len(push), nil)
+		},
+		Copied: func(i *registry.Image) {
+			ref, _ := i.String()
+			fmu.Lock()
+			p.copied = append(p.copied, ref)
+			fmu.Unlock()
+		},
+		OnFallback: func(f registry.Fallback) {
+			fmu.Lock()
+			fallbacks = append(fallbacks, f)
+			fmu.Unlock()
+		},
+		DryRun: p.DryRun,
+		Plan:   p.Plan,
+
+		ContinueOnError: p.ImportConfig.Import.ContinueOnError,
+	}.Run(ctx)
+	p.skipFallbacks(fallbacks)
+	var fe *registry.FailedError
+	if errors.As(err, &fe) {
+		p.skipFailed("import images", fe.Failures)
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	p.imagesImported = true
+	return nil
+}
+
+// Patch patches the images found by Scan, pushes them to the registries and scans them again
+func (p *Pipeline) Patch(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "patch")
+	defer func() { done(err) }()
+
+	patch, _ := p.targets()
+	remaining, err := p.remaining(patch, store.Patched)
+	if err != nil {
+		return err
+	}
+
+	// determine fully qualified output path for images
+	reportFilePaths := make(map[*registry.Image]string)
+	outFilePaths := make(map[*registry.Image]string)
+	for _, i := range remaining {
+		var err error
+		reportFilePaths[i], err = p.outputFile(p.ImportConfig.Import.Copacetic.Output.Reports.Folder, "prescan", *i, ".json")
+		if err != nil {
+			return err
+		}
+		outFilePaths[i], err = p.outputFile(p.ImportConfig.Import.Copacetic.Output.Tars.Folder, "tar", *i, ".tar")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.patcher().Patch(ctx, remaining, reportFilePaths, outFilePaths)
+	var fe *registry.FailedError
+	if errors.As(err, &fe) {
+		err = nil
+	}
+	// the patched images pushed to a fallback or failed with continueOnError are patched again by the next run. remaining may
+	// share its array with the images to patch, so it is filtered before they are removed from them
+	if len(p.patchFallbacks) > 0 || fe != nil {
+		skipped := map[string]bool{}
+		for _, f := range p.patchFallbacks {
+			skipped[f.Image] = true
+		}
+		if fe != nil {
+			for _, f := range fe.Failures {
+				skipped[f.Image] = true
+			}
+		}
+		patched := make([]*registry.Image, 0, len(remaining))
+		for _, i := range remaining {
+			if ref, err := i.String(); err != nil || !skipped[ref] {
+				patched = append(patched, i)
+			}
+		}
+		remaining = patched
+		p.skipFallbacks(p.patchFallbacks)
+		p.patchFallbacks = nil
+		if fe != nil {
+			p.skipFailed("patch", fe.Failures)
+		}
+		patch = p.patch
+	}
+	if err != nil {
+		return err
+	}
+	if !p.DryRun {
+		p.completeAll(remaining, store.Patched)
+	}
+	// images patched in an earlier run are still patched in the registries
+	p.Patched = slices.Concat(patch, p.unchanged)
+	// the values files written by Analyze reference the images before patching
+	if err := p.WriteValues(); err != nil {
+		return err
+	}
+
+	// images are not patched in dry-run, so there is nothing to scan
+	if !p.DryRun {
+		bar := terminal.NewBar(len(p.Imgs), "Scanning images after patching...\r", progressbar.OptionSetRenderBlankState(true))
+		so := p.scanOption()
+		// the images are scanned as pushed to the registries, so the patched images are scanned instead of their sources
+		so.Sources = maps.Clone(so.Sources)
+		if so.Sources == nil {
+			so.Sources = registry.Sources{}
+		}
+		for _, r := range p.Registries {
+			so.Sources[r.Host()] = r.Source()
+		}
+		imgs := make([]*registry.Image, len(p.Imgs))
+		for n := range p.Imgs {
+			imgs[n] = &p.Imgs[n]
+		}
+		targets, err := p.patchedImages(imgs)
+		if err != nil {
+			return err
+		}
+		for n, i := range p.Imgs {
+			ref, _ := i.String()
+			target, err := p.pushedRef(targets[n])
+			if err != nil {
+				return err
+			}
+			_, scan := tracer.Start(ctx, "trivy.scan", trace.WithAttributes(attribute.String("image", target)))
+			r, err := so.Scan(target)
+			tracing.End(scan, err)
+			if err != nil {
+				return err
+			}
+			p.Vulns[ref] = trivy.VulnerabilityIDs(r)
+
+			// Write report to filesystem
+			if err := p.writeReport("postscan", i, r); err != nil {
+				return err
+			}
+
+			_ = bar.Add(1)
+		}
+		_ = bar.Finish()
+	}
+
+	if !p.ImportConfig.Import.Copacetic.Output.Reports.Clean {
+		return p.Layout.WriteIndex()
+	}
+	return nil
+}
+
+// pushedRef references the image in the first registry it is pushed to, or at its source without registries
+func (p *Pipeline) pushedRef(i *registry.Image) (string, error) {
+	rs := i.RoutedTo(p.Registries)
+	if len(rs) == 0 {
+		return i.String()
+	}
+	name, err := i.ImageName()
+	if err != nil {
+		return "", err
+	}
+	return rs[0].Ref(name, i.Tag), nil
+}
+
+// SignImages signs the images in the registries with Cosign, if enabled
+func (p *Pipeline) SignImages(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "sign images")
+	defer func() { done(err) }()
+
+	if !p.ImportConfig.Import.Cosign.Enabled && !p.ImportConfig.Import.Notation.Enabled {
+		return nil
+	}
+
+	patch, push := p.targets()
+	imgs, err := p.remaining(append(append([]*registry.Image{}, patch...), push...), store.Signed)
+	if err != nil {
+		return err
+	}
+	imgs = slices.DeleteFunc(imgs, func(i *registry.Image) bool {
+		ref, err := i.String()
+		return err == nil && p.unsigned[ref]
+	})
+	// patched images are signed as named in the registries
+	targets, err := p.patchedImages(imgs)
+	if err != nil {
+		return err
+	}
+
+	// images pushed in an earlier run are signed by the digest in the registry
+	if !p.DryRun && len(p.Registries) > 0 {
+		for _, i := range targets {
+			if i.Digest != "" {
+				continue
+			}
+			name, err := i.ImageName()
+			if err != nil {
+				return err
+			}
+			r := i.RoutedTo(p.Registries)[0]
+			d, err := r.Fetch(ctx, name, i.Tag)
+			if err != nil {
+				return fmt.Errorf("internal: error resolving digest of %s:%s in registry %s :: %w", name, i.Tag, r.URL, err)
+			}
+			i.Digest = d.Digest.String()
+		}
+	}
+
+	if p.ImportConfig.Import.Notation.Enabled {
+		refs := []string{}
+		for _, r := range p.Registries {
+			for _, i := range targets {
+				if !r.Routes(*i) {
+					continue
+				}
+				name, err := i.ImageName()
+				if err != nil {
+					return err
+				}
+				// images are not pushed in dry-run, so they are referenced by tag
+				ref := r.Ref(name, i.Digest)
+				if p.DryRun {
+					ref = r.Ref(name, i.Tag)
+				}
+				refs = append(refs, ref)
+			}
+		}
+		if err := p.notationSigner().Sign(registry.Artifacts(registry.ImageArtifact, refs...)); err != nil {
+			return err
+		}
+		p.signed = true
+	}
+
+	if !p.ImportConfig.Import.Cosign.Enabled {
+		if !p.DryRun {
+			p.signedImages(imgs)
+		}
+		return nil
+	}
+
+	keyRef, sigstore := p.signer()
+	signo := mySign.SignOption{
+		Imgs:       targets,
+		Registries: p.Registries,
+
+		KeyRef:            keyRef,
+		KeyRefPass:        *p.ImportConfig.Import.Cosign.KeyRefPass,
+		AllowInsecure:     p.ImportConfig.Import.Cosign.AllowInsecure,
+		AllowHTTPRegistry: p.ImportConfig.Import.Cosign.AllowHTTPRegistry,
+		Sigstore:          sigstore,
+
+		DryRun: p.DryRun,
+		Plan:   p.Plan,
+	}
+	if err := signo.Run(); err != nil {
+		return err
+	}
+	if !p.DryRun {
+		p.signedImages(imgs)
+	}
+	p.signed = true
+	return nil
+}
+
+// signedImages records the images as signed and emits their progress events
+func (p *Pipeline) signedImages(imgs []*registry.Image) {
+	p.completeAll(imgs, store.Signed)
+	for _, i := range imgs {
+		ref, _ := i.String()
+		p.item("sign images", ref, len(imgs), nil)
+	}
+}
@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+)
+
+// incremental opens the state store with the earlier patches, if images are only patched for new fixable vulnerabilities
+func (p *Pipeline) incremental(ctx context.Context) (*store.Store, error) {
+	if !p.ImportConfig.Import.Copacetic.Incremental || !p.StateConfig.Enabled() || p.All || len(p.Registries) == 0 {
+		return nil, nil
+	}
+	return p.StateConfig.Open(ctx)
+}
+
+// sourceDigest returns the digest the source image resolves to, resolved once per run
+func (p *Pipeline) sourceDigest(ctx context.Context, i registry.Image) (string, error) {
+	ref, err := i.String()
+	if err != nil {
+		return "", err
+	}
+	if d, ok := p.sourceDigests[ref]; ok {
+		return d, nil
+	}
+	d := i.Digest
+	if d == "" {
+		d, err = registry.Digest(ctx, p.SourceRegistries, i.Registry+"/"+i.Repository, i.Tag, false)
+		if err != nil {
+			return "", err
+		}
+	}
+	if p.sourceDigests == nil {
+		p.sourceDigests = map[string]string{}
+	}
+	p.sourceDigests[ref] = d
+	return d, nil
+}
+
+// patchedBefore reports whether the image was patched in an earlier run for all the fixable vulnerabilities in every registry, from the
+// source image it resolves to now, and the vulnerabilities it was patched for. A rebuilt source tag is patched again
+func (p *Pipeline) patchedBefore(ctx context.Context, s *store.Store, i registry.Image, fixed []string) ([]string, bool) {
+	if s == nil {
+		return nil, false
+	}
+	source, err := p.sourceDigest(ctx, i)
+	if err != nil {
+		slog.Debug("could not resolve the digest of the source image, patching it again", slog.String("image", i.Repository), slog.String("error", err.Error()))
+		return nil, false
+	}
+	target, err := p.patchedTag().Image(i)
+	if err != nil {
+		return nil, false
+	}
+	name, err := target.ImageName()
+	if err != nil {
+		return nil, false
+	}
+	var before []string
+	for _, r := range p.Registries {
+		rec, ok := s.Get(store.Key(store.Image, r.URL, name, target.Tag))
+		if !ok || rec.SourceDigest != source || !rec.Patches(fixed) {
+			return nil, false
+		}
+		before = rec.Fixed
+	}
+	return before, true
+}
@@ -0,0 +1,182 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+)
+
+// LicenseInventory lists the licenses of the charts and images of the run, written to the licenses file
+type LicenseInventory struct {
+	Time   time.Time      `json:"time"`
+	Charts []ChartLicense `json:"charts"`
+	Images []ImageLicense `json:"images"`
+	// Licenses counts the charts and images under every license
+	Licenses map[string]int `json:"licenses"`
+	// Unknown are the charts and images without a license, or with a license that is not a known SPDX identifier
+	Unknown []UnknownLicense `json:"unknown"`
+}
+
+// ChartLicense is the license of a chart, from its Artifact Hub annotation or its LICENSE file
+type ChartLicense struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	License  string `json:"license"`
+	Category string `json:"category"`
+}
+
+// ImageLicense are the licenses of the packages and license files in an image
+type ImageLicense struct {
+	Image    string          `json:"image"`
+	Licenses []trivy.License `json:"licenses"`
+}
+
+// UnknownLicense is a chart or image without a license, or with a license that is not a known SPDX identifier
+type UnknownLicense struct {
+	Artifact string `json:"artifact"`
+	License  string `json:"license,omitempty"`
+}
+
+// Licenses collects the licenses of the charts and scans the images for the licenses of their packages, if enabled.
+// The inventory is written to the licenses file, also in dry-run, so new third-party software can be reviewed before it is imported
+func (p *Pipeline) Licenses(ctx context.Context) error {
+	if !p.LicensesConfig.Enabled {
+		return nil
+	}
+
+	inv := LicenseInventory{
+		Time:     time.Now().UTC(),
+		Charts:   []ChartLicense{},
+		Images:   []ImageLicense{},
+		Licenses: map[string]int{},
+		Unknown:  []UnknownLicense{},
+	}
+	summaries := map[string]*output.LicenseSummary{}
+	count := func(license string, category string, artifact string, chart bool) {
+		inv.Licenses[license]++
+		s, ok := summaries[license]
+		if !ok {
+			s = &output.LicenseSummary{License: license, Category: category}
+			summaries[license] = s
+		}
+		if chart {
+			s.Charts = append(s.Charts, artifact)
+		} else {
+			s.Images = append(s.Images, artifact)
+		}
+	}
+
+	for c := range p.Data {
+		if c.Name == "images" {
+			continue
+		}
+		cl, err := chartLicense(c)
+		if err != nil {
+			return err
+		}
+		inv.Charts = append(inv.Charts, cl)
+		artifact := fmt.Sprintf("%s:%s", c.Name, c.Version)
+		if cl.License == "" || cl.Category == "unknown" {
+			inv.Unknown = append(inv.Unknown, UnknownLicense{Artifact: artifact, License: cl.License})
+		}
+		if cl.License != "" {
+			count(cl.License, cl.Category, artifact, true)
+		}
+	}
+
+	so := p.scanOption()
+	seen := map[string]bool{}
+	for _, m := range p.Data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+
+			ls, err := so.Licenses(ref)
+			if err != nil {
+				// the inventory is informational, so images that can not be scanned are reported without licenses
+				slog.Warn("could not scan image for licenses", slog.String("image", ref), slog.String("error", err.Error()))
+			}
+			inv.Images = append(inv.Images, ImageLicense{Image: ref, Licenses: ls})
+			if len(ls) == 0 {
+				inv.Unknown = append(inv.Unknown, UnknownLicense{Artifact: ref})
+			}
+			for _, l := range ls {
+				if l.Category == "unknown" {
+					inv.Unknown = append(inv.Unknown, UnknownLicense{Artifact: ref, License: l.Name})
+				}
+				count(l.Name, l.Category, ref, false)
+			}
+		}
+	}
+
+	sort.Slice(inv.Charts, func(i, j int) bool {
+		return inv.Charts[i].Name+":"+inv.Charts[i].Version < inv.Charts[j].Name+":"+inv.Charts[j].Version
+	})
+	sort.Slice(inv.Images, func(i, j int) bool { return inv.Images[i].Image < inv.Images[j].Image })
+	sort.Slice(inv.Unknown, func(i, j int) bool {
+		return inv.Unknown[i].Artifact+inv.Unknown[i].License < inv.Unknown[j].Artifact+inv.Unknown[j].License
+	})
+
+	if err := writeLicenseInventory(p.LicensesConfig.File, inv); err != nil {
+		return err
+	}
+	slog.Info("wrote license inventory", slog.String("path", p.LicensesConfig.File), slog.Int("licenses", len(inv.Licenses)), slog.Int("unknown", len(inv.Unknown)))
+
+	ss := make([]output.LicenseSummary, 0, len(summaries))
+	for _, s := range summaries {
+		ss = append(ss, *s)
+	}
+	output.RenderLicenseTable(ss, len(inv.Unknown))
+	return nil
+}
+
+// chartLicense reads the license of the chart, classifying its LICENSE file without an Artifact Hub annotation
+func chartLicense(c helm.Chart) (ChartLicense, error) {
+	_, ch, _, err := c.Read(false)
+	if err != nil {
+		return ChartLicense{}, fmt.Errorf("internal: error reading chart %s :: %w", c.Name, err)
+	}
+	l, text := helm.License(ch)
+	if l == "" && text != nil {
+		l, err = trivy.ClassifyLicense(c.Name+"/LICENSE", text)
+		if err != nil {
+			slog.Warn("could not classify license of chart", slog.String("chart", c.Name), slog.String("error", err.Error()))
+		}
+	}
+
+	res := ChartLicense{Name: c.Name, Version: c.Version, Category: "unknown"}
+	if l != "" {
+		res.License, res.Category = trivy.LicenseCategory(l)
+	}
+	return res, nil
+}
+
+// writeLicenseInventory writes the inventory as JSON to path
+func writeLicenseInventory(path string, inv LicenseInventory) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("internal: error writing license inventory %s :: %w", path, err)
+	}
+	return nil
+}
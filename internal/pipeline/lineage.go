@@ -0,0 +1,44 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// Lineage infers the probable base image of every image in the charts and renders the images grouped by base image, if enabled.
+// Images without base image metadata are named after the operating system found by Scan, or inherit the base image of images sharing their bottom layer
+func (p *Pipeline) Lineage(ctx context.Context) error {
+	if !p.LineageConfig.Enabled {
+		return nil
+	}
+
+	p.Bases = map[string]registry.Lineage{}
+	for _, m := range p.Data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			if _, ok := p.Bases[ref]; ok {
+				continue
+			}
+
+			l, err := i.Lineage(ctx, p.SourceRegistries, p.ImportConfig.Import.Architecture)
+			if err != nil {
+				// the lineage is informational, so unreachable images are reported with an unknown base image
+				slog.Warn("could not infer base image", slog.String("image", ref), slog.String("error", err.Error()))
+			}
+			if l.Base == "" && p.osBases[ref] != "" {
+				l.Base, l.Source = p.osBases[ref], "os"
+			}
+			p.Bases[ref] = l
+		}
+	}
+	registry.ShareLineage(p.Bases)
+
+	output.RenderBaseImageTable(p.Bases)
+	return nil
+}
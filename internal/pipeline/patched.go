@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// patchedTag names the patched images in the registries
+func (p *Pipeline) patchedTag() registry.PatchedTag {
+	c := p.ImportConfig.Import.Copacetic.Patched
+	return registry.PatchedTag{Template: c.Tag, RepositorySuffix: c.RepositorySuffix, Date: p.date}
+}
+
+// patchedKey identifies an image independent of the digest, which changes when patched
+func patchedKey(i registry.Image) string {
+	return i.Registry + "/" + i.Repository + ":" + i.Tag
+}
+
+// patchedImages returns the images with the patched images named as pushed by Patch
+func (p *Pipeline) patchedImages(imgs []*registry.Image) ([]*registry.Image, error) {
+	t := p.patchedTag()
+	if !t.Renames() || len(p.Patched) == 0 {
+		return imgs, nil
+	}
+	patched := make(map[string]bool, len(p.Patched))
+	for _, i := range p.Patched {
+		patched[patchedKey(*i)] = true
+	}
+	res := make([]*registry.Image, 0, len(imgs))
+	for _, i := range imgs {
+		if !patched[patchedKey(*i)] {
+			res = append(res, i)
+			continue
+		}
+		target, err := t.Image(*i)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &target)
+	}
+	return res, nil
+}
+
+// patchedData returns the images of the charts with the patched images named as pushed by Patch, for referencing them in values
+func (p *Pipeline) patchedData(data helm.ChartData) (helm.ChartData, error) {
+	if !p.patchedTag().Renames() || len(p.Patched) == 0 {
+		return data, nil
+	}
+	res := make(helm.ChartData, len(data))
+	for c, m := range data {
+		imgs := make([]*registry.Image, 0, len(m))
+		for i := range m {
+			imgs = append(imgs, i)
+		}
+		targets, err := p.patchedImages(imgs)
+		if err != nil {
+			return nil, err
+		}
+		res[c] = make(map[*registry.Image][]string, len(m))
+		for n, i := range imgs {
+			res[c][targets[n]] = m[i]
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,40 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+)
+
+// checkPinning reports the images the values of the charts reference by a moving tag, or without a digest if required.
+// Charts with unpinned images fail the run with the 'enforce' policy, unless the images are rewritten to digests
+func (p *Pipeline) checkPinning(data helm.ChartData) error {
+	c := p.PinningConfig
+	if !c.Enabled {
+		return nil
+	}
+
+	us := helm.CheckPinning(data, c.RequireDigest)
+	if len(us) == 0 {
+		return nil
+	}
+
+	output.RenderPinningTable(us)
+	charts := map[string]bool{}
+	for _, u := range us {
+		charts[u.Chart+":"+u.Version] = true
+		slog.Warn("chart references an unpinned image",
+			slog.String("chart", u.Chart),
+			slog.String("version", u.Version),
+			slog.String("image", u.Image),
+			slog.String("reason", u.Reason),
+			slog.Bool("rewritten", c.Rewrite),
+		)
+	}
+	if c.Policy == "enforce" && !c.Rewrite {
+		return fmt.Errorf("internal: %d chart(s) reference %d image(s) by a moving tag or without a digest", len(charts), len(us))
+	}
+	return nil
+}
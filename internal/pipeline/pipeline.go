@@ -0,0 +1,372 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/discovery"
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/hooks"
+	"github.com/ChristofferNissen/helmper/pkg/layout"
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/policy"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/sink"
+	"github.com/ChristofferNissen/helmper/pkg/source"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/viper"
+)
+
+// Pipeline holds the configuration of a run and the results of the stages run so far
+type Pipeline struct {
+	viper *viper.Viper
+
+	Update       bool
+	All          bool
+	DryRun       bool
+	DryRunScript string
+	// ReportPath is where the machine-readable report of the run is written. Command is the command reported
+	ReportPath string
+	Command    string
+	LockPath   string
+	// ProgressPath is where the images pushed, patched and signed are recorded during the run. Resume continues the progress of a failed run
+	ProgressPath     string
+	Resume           bool
+	StateConfig      bootstrap.StateConfigSection
+	Attestation      bootstrap.AttestationConfigSection
+	ValuesConfig     bootstrap.ValuesConfigSection
+	LineageConfig    bootstrap.LineageConfigSection
+	LicensesConfig   bootstrap.LicensesConfigSection
+	PullSecrets      bootstrap.PullSecretsConfigSection
+	VerifyConfig     bootstrap.VerifyConfigSection
+	SignaturesConfig bootstrap.SourceSignaturesConfigSection
+	PinningConfig    bootstrap.PinningConfigSection
+	BundleConfig     bootstrap.BundleConfigSection
+	PolicyConfig     bootstrap.PolicyConfigSection
+	StandbyConfig    bootstrap.StandbyConfigSection
+	ToolsConfig      bootstrap.ToolsConfigSection
+	ParserConfig     bootstrap.ParserConfigSection
+	ImportConfig     bootstrap.ImportConfigSection
+	MirrorConfig     []bootstrap.MirrorConfigSection
+	ImagePolicy      bootstrap.ImagePolicyConfigSection
+	Groups           []bootstrap.GroupConfigSection
+	Registries       []registry.Registry
+	Caches           []registry.Cache
+	Sinks            []sink.Config
+	Hooks            []hooks.Hook
+	Images           []registry.Image
+	Sources          []source.Source
+	// SourceRegistries are the settings of the registries the images are pulled from
+	SourceRegistries registry.Sources
+	Discovery        discovery.Discovery
+	Charts           helm.ChartCollection
+	Opts             []helm.Option
+
+	// Cluster imports the images of the pods running in the cluster of Discovery instead of the charts and sources. Set by 'helmper scan-cluster'
+	Cluster bool
+
+	// Data maps every chart to the images found in it. Set by Analyze
+	Data helm.ChartData
+	// Import is the charts to import. Set by Analyze
+	Import helm.ChartCollection
+	// Imgs is the images to import. Set by Analyze
+	Imgs []registry.Image
+
+	// Patched images and the vulnerabilities found in each image after patching. Set by Patch
+	Patched []*registry.Image
+	Vulns   map[string][]string
+
+	// Bases maps the images to their probable base image. Set by Lineage
+	Bases map[string]registry.Lineage
+
+	// Patcher patches the images found by Scan. Defaults to Copacetic
+	Patcher registry.Patcher
+
+	Layout *layout.Layout
+	Plan   *plan.Plan
+	// Events receives the progress events of the run. Nil discards them
+	Events *events.Emitter
+
+	// images split by Scan into images to patch and images to push as-is
+	patch []*registry.Image
+	push  []*registry.Image
+	// images patched in an earlier run for all their fixable vulnerabilities, and the fixable vulnerabilities of the patched images
+	unchanged []*registry.Image
+	fixed     map[string][]string
+	// digests the source images of the patched images resolved to, recorded so rebuilt source tags are patched again
+	sourceDigests map[string]string
+	// images held back by the severity gate with the vulnerabilities at or above the gate, and the images to quarantine
+	gated       map[string][]string
+	quarantined []*registry.Image
+	// base images named after the operating system found by Scan
+	osBases map[string]string
+	// latest scan report and SBOM written for each image, attached by AttachReports
+	reports map[string]string
+	sboms   map[string]string
+	// set when the artifacts have been signed, and when the charts and images have been imported
+	signed         bool
+	chartsImported bool
+	imagesImported bool
+
+	// compiled policies, their decisions reported by Finish, and the charts and images they exclude from signing
+	policy    *policy.Policy
+	decisions []output.PolicyDecision
+	unsigned  map[string]bool
+
+	// images copied to the registries by ImportImages, and the number of vulnerabilities found in the images before patching, reported to the sinks
+	copied  []string
+	prescan map[string]int
+
+	// images that could not be pushed with continueOnError, reported by Finish
+	failures []registry.Failure
+	// images pushed to the fallback of a registry, reported by Finish
+	fallbacks []registry.Fallback
+	// patched images pushed to the fallback of a registry by the patcher
+	patchFallbacks []registry.Fallback
+	// progress of the run, recorded once opened by OpenProgress
+	progress *store.Progress
+
+	// items processed by each stage, counted for the progress events
+	itemsMu sync.Mutex
+	items   map[string]int
+
+	// output files removed by Cleanup
+	files []string
+	// date of the run, stamped on the tags of patched images
+	date time.Time
+}
+
+// New reads the configuration of a run from viper
+func New(viper *viper.Viper) *Pipeline {
+	var (
+		k8sVersion string = state.GetValue[string](viper, "k8s_version")
+		verbose    bool   = state.GetValue[bool](viper, "verbose")
+		update     bool   = state.GetValue[bool](viper, "update")
+		dryRun     bool   = state.GetValue[bool](viper, "dry-run")
+		script     string = state.GetValue[string](viper, "dry-run-script")
+	)
+
+	if verbose {
+		slog.SetLogLoggerLevel(slog.LevelDebug)
+	}
+
+	importConfig := state.GetValue[bootstrap.ImportConfigSection](viper, "importConfig")
+
+	return &Pipeline{
+		viper: viper,
+
+		Update: update,
+		All:    state.GetValue[bool](viper, "all"),
+		// a script can only be generated from a plan
+		DryRun:           dryRun || script != "",
+		DryRunScript:     script,
+		ReportPath:       state.GetValue[string](viper, "report"),
+		LockPath:         state.GetValue[string](viper, "lockfile"),
+		ProgressPath:     state.GetValue[string](viper, "progress"),
+		Resume:           state.GetValue[bool](viper, "resume"),
+		StateConfig:      state.GetValue[bootstrap.StateConfigSection](viper, "stateConfig"),
+		Attestation:      state.GetValue[bootstrap.AttestationConfigSection](viper, "attestationConfig"),
+		ValuesConfig:     state.GetValue[bootstrap.ValuesConfigSection](viper, "valuesConfig"),
+		LineageConfig:    state.GetValue[bootstrap.LineageConfigSection](viper, "lineageConfig"),
+		LicensesConfig:   state.GetValue[bootstrap.LicensesConfigSection](viper, "licensesConfig"),
+		PullSecrets:      state.GetValue[bootstrap.PullSecretsConfigSection](viper, "pullSecretsConfig"),
+		VerifyConfig:     state.GetValue[bootstrap.VerifyConfigSection](viper, "verifyConfig"),
+		SignaturesConfig: state.GetValue[bootstrap.SourceSignaturesConfigSection](viper, "sourceSignaturesConfig"),
+		PinningConfig:    state.GetValue[bootstrap.PinningConfigSection](viper, "pinningConfig"),
+		BundleConfig:     state.GetValue[bootstrap.BundleConfigSection](viper, "bundleConfig"),
+		PolicyConfig:     state.GetValue[bootstrap.PolicyConfigSection](viper, "policyConfig"),
+		StandbyConfig:    state.GetValue[bootstrap.StandbyConfigSection](viper, "standbyConfig"),
+		ToolsConfig:      state.GetValue[bootstrap.ToolsConfigSection](viper, "toolsConfig"),
+		ParserConfig:     state.GetValue[bootstrap.ParserConfigSection](viper, "parserConfig"),
+		ImportConfig:     importConfig,
+		MirrorConfig:     state.GetValue[[]bootstrap.MirrorConfigSection](viper, "mirrorConfig"),
+		ImagePolicy:      state.GetValue[bootstrap.ImagePolicyConfigSection](viper, "imagePolicyConfig"),
+		Groups:           state.GetValue[[]bootstrap.GroupConfigSection](viper, "groupsConfig"),
+		Registries:       state.GetValue[[]registry.Registry](viper, "registries"),
+		Caches:           state.GetValue[[]registry.Cache](viper, "caches"),
+		Sinks:            state.GetValue[[]sink.Config](viper, "sinks"),
+		Hooks:            state.GetValue[[]hooks.Hook](viper, "hooksConfig"),
+		Images:           state.GetValue[[]registry.Image](viper, "images"),
+		Sources:          state.GetValue[[]source.Source](viper, "sources"),
+		SourceRegistries: state.GetValue[registry.Sources](viper, "sourceRegistries"),
+		Discovery:        state.GetValue[discovery.Discovery](viper, "discovery"),
+		Charts:           state.GetValue[helm.ChartCollection](viper, "input"),
+		Opts: []helm.Option{
+			helm.K8SVersion(k8sVersion),
+			helm.APIVersions(state.GetValue[[]string](viper, "api_versions")),
+			helm.Verbose(verbose),
+			helm.Update(update),
+			helm.Registries(state.GetValue[[]registry.Registry](viper, "registries")),
+			helm.ImagePatterns(state.GetValue[bootstrap.ParserConfigSection](viper, "parserConfig").Patterns),
+		},
+
+		Vulns:  make(map[string][]string),
+		Layout: layout.New(),
+		Plan:   plan.New(),
+		date:   time.Now(),
+	}
+}
+
+// ChartsAfterImages reports whether the charts must be imported after the images, as their values reference the images by the digest in the registries
+func (p *Pipeline) ChartsAfterImages() bool {
+	return (p.ImportConfig.Import.PinDigests || p.ImportConfig.Import.PinMovingTags) && p.ImportConfig.Import.ReplaceRegistryReferences
+}
+
+// Run runs all stages enabled in the configuration in sequence
+func (p *Pipeline) Run(ctx context.Context) (err error) {
+	defer p.Cleanup()
+	p.Events.Emit(events.Event{Type: events.RunStarted})
+	defer func() {
+		if err != nil {
+			p.Events.Emit(events.Event{Type: events.RunFailed, Error: err.Error()})
+		} else {
+			p.Events.Emit(events.Event{Type: events.RunCompleted})
+		}
+	}()
+	defer func() {
+		// successful runs are published by Finish
+		if err != nil && !p.DryRun {
+			if perr := p.Publish(ctx, err); perr != nil {
+				slog.Warn("could not publish failed run", slog.String("error", perr.Error()))
+			}
+			if p.progress != nil && p.progress.Len() > 0 {
+				slog.Info("run with --resume to continue from the images already pushed, patched and signed", slog.String("progress", p.ProgressPath))
+			}
+		}
+	}()
+
+	if err := p.OpenProgress(); err != nil {
+		return err
+	}
+
+	if err := p.Analyze(ctx); err != nil {
+		return err
+	}
+	if err := p.RunHooks(ctx, hooks.StageParse); err != nil {
+		return err
+	}
+
+	if p.ImportConfig.Import.Enabled {
+		if err := p.VerifySources(ctx); err != nil {
+			return err
+		}
+		if err := p.MirrorTrivyDB(ctx); err != nil {
+			return err
+		}
+
+		charts := func() error {
+			if err := p.ImportCharts(ctx); err != nil {
+				return err
+			}
+			return p.SignCharts(ctx)
+		}
+
+		if !p.ChartsAfterImages() {
+			if err := charts(); err != nil {
+				return err
+			}
+		}
+
+		if p.ImportConfig.Import.Copacetic.Enabled {
+			if err := p.Scan(ctx); err != nil {
+				return err
+			}
+		}
+		if err := p.ImportImages(ctx); err != nil {
+			return err
+		}
+		// charts imported after the images are reported with them
+		if !p.ChartsAfterImages() {
+			if err := p.RunHooks(ctx, hooks.StageImport); err != nil {
+				return err
+			}
+		}
+		if p.ImportConfig.Import.Copacetic.Enabled {
+			if err := p.Patch(ctx); err != nil {
+				return err
+			}
+			if err := p.RunHooks(ctx, hooks.StagePatch); err != nil {
+				return err
+			}
+		}
+		if err := p.GenerateSBOMs(ctx); err != nil {
+			return err
+		}
+		if err := p.SignImages(ctx); err != nil {
+			return err
+		}
+		if err := p.AttachReports(ctx); err != nil {
+			return err
+		}
+
+		if p.ChartsAfterImages() {
+			if err := charts(); err != nil {
+				return err
+			}
+			if err := p.RunHooks(ctx, hooks.StageImport); err != nil {
+				return err
+			}
+		}
+
+		if p.ImportConfig.Import.Cosign.Enabled || p.ImportConfig.Import.Notation.Enabled {
+			if err := p.RunHooks(ctx, hooks.StageSign); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := p.Lineage(ctx); err != nil {
+		return err
+	}
+	if err := p.Licenses(ctx); err != nil {
+		return err
+	}
+
+	if !p.DryRun {
+		if err := p.WriteLock(ctx); err != nil {
+			return err
+		}
+		if p.ImportConfig.Import.Enabled {
+			if err := p.RecordState(ctx); err != nil {
+				return err
+			}
+			if err := p.Attest(ctx); err != nil {
+				return err
+			}
+			if err := p.WritePullSecrets(ctx); err != nil {
+				return err
+			}
+			if p.VerifyConfig.Enabled {
+				if err := p.Verify(ctx); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if err := p.Finish(); err != nil {
+		return err
+	}
+	p.FinishProgress()
+	return nil
+}
+
+// Cleanup removes the reports and tars written during the run, if configured. Reports are kept in dry-run as the planned patches refer to them
+func (p *Pipeline) Cleanup() {
+	if p.DryRun {
+		return
+	}
+	if !p.ImportConfig.Import.Copacetic.Output.Reports.Clean {
+		return
+	}
+	for _, f := range p.files {
+		_ = os.RemoveAll(f)
+	}
+}
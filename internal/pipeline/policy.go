@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/policy"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+// chartKey is the key of charts in the artifacts not to sign, named like in the registries
+func chartKey(c helm.Chart) string {
+	return "charts/" + c.Name + ":" + c.Version
+}
+
+// merge combines the decisions on an image found in several charts, or evaluated again with its vulnerabilities.
+// The reasons to deny add up, and not patching or signing wins
+func merge(a policy.Decision, b policy.Decision) policy.Decision {
+	for _, r := range b.Deny {
+		if !slices.Contains(a.Deny, r) {
+			a.Deny = append(a.Deny, r)
+		}
+	}
+	if b.Patch != nil && (a.Patch == nil || *a.Patch) {
+		a.Patch = b.Patch
+	}
+	if b.Sign != nil && (a.Sign == nil || *a.Sign) {
+		a.Sign = b.Sign
+	}
+	return a
+}
+
+// decide records the decision of the policies on the chart or image, and whether it is signed. Charts and images have one
+// decision, merged with the decisions recorded before
+func (p *Pipeline) decide(kind string, name string, d policy.Decision) {
+	if d.Sign != nil && !*d.Sign {
+		if p.unsigned == nil {
+			p.unsigned = map[string]bool{}
+		}
+		p.unsigned[name] = true
+	}
+	if !d.Skip() && d.Patch == nil && d.Sign == nil {
+		return
+	}
+	if d.Skip() {
+		slog.Info("skipped by policy", slog.String(kind, name), slog.Any("reasons", d.Deny))
+	}
+	for n, e := range p.decisions {
+		if e.Kind == kind && e.Name == name {
+			d = merge(policy.Decision{Deny: e.Deny, Patch: e.Patch, Sign: e.Sign}, d)
+			p.decisions[n] = output.PolicyDecision{Kind: kind, Name: name, Deny: d.Deny, Patch: d.Patch, Sign: d.Sign}
+			return
+		}
+	}
+	p.decisions = append(p.decisions, output.PolicyDecision{Kind: kind, Name: name, Deny: d.Deny, Patch: d.Patch, Sign: d.Sign})
+}
+
+// admit evaluates the policies against the charts and the images found in them. Denied charts are removed with their
+// subcharts and images, and denied images from the charts they are found in. Images are not patched if the policies say so
+func (p *Pipeline) admit(ctx context.Context, data helm.ChartData) error {
+	if len(p.PolicyConfig.Paths) == 0 {
+		return nil
+	}
+	pol, err := policy.Load(ctx, p.PolicyConfig.Paths)
+	if err != nil {
+		return err
+	}
+	p.policy = pol
+
+	denied := map[string]bool{}
+	for c := range data {
+		if c.Parent != nil || c.Name == "images" {
+			continue
+		}
+		in := policy.Chart{Name: c.Name, Version: c.Version, Repo: c.Repo.URL}
+		_, chartRef, _, err := c.Read(false)
+		if err != nil {
+			return err
+		}
+		for _, m := range chartRef.Metadata.Maintainers {
+			in.Maintainers = append(in.Maintainers, m.Name)
+		}
+		d, err := pol.EvalChart(ctx, in)
+		if err != nil {
+			return err
+		}
+		p.decide("chart", chartKey(c), d)
+		if d.Skip() {
+			denied[chartKey(c)] = true
+		}
+	}
+	for c := range data {
+		r := c
+		for r.Parent != nil {
+			r = *r.Parent
+		}
+		if denied[chartKey(r)] {
+			delete(data, c)
+		}
+	}
+
+	for c, m := range data {
+		in := &policy.Chart{Name: c.Name, Version: c.Version, Repo: c.Repo.URL}
+		if c.Name == "images" {
+			in = nil
+		}
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			d, err := pol.EvalImage(ctx, policy.Image{Registry: i.Registry, Repository: i.Repository, Tag: i.Tag, Digest: i.Digest, Chart: in})
+			if err != nil {
+				return err
+			}
+			p.decide("image", ref, d)
+			if d.Skip() {
+				delete(m, i)
+				continue
+			}
+			if d.Patch != nil {
+				i.Patch = d.Patch
+			}
+		}
+	}
+	return nil
+}
+
+// admitScanned evaluates the policies against the image with the vulnerabilities found by the scan, once for every chart the
+// image is found in, and reports whether the image is skipped and whether it is patched
+func (p *Pipeline) admitScanned(ctx context.Context, i registry.Image, ref string, r types.Report) (bool, bool, error) {
+	if p.policy == nil {
+		return false, true, nil
+	}
+	scan := trivy.Severities(r)
+
+	var d policy.Decision
+	evaluated := false
+	for c, m := range p.Data {
+		found := false
+		for j := range m {
+			if s, err := j.String(); err == nil && s == ref {
+				found = true
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+		in := &policy.Chart{Name: c.Name, Version: c.Version, Repo: c.Repo.URL}
+		if c.Name == "images" {
+			in = nil
+		}
+		cd, err := p.policy.EvalImage(ctx, policy.Image{Registry: i.Registry, Repository: i.Repository, Tag: i.Tag, Digest: i.Digest, Chart: in, Scan: scan})
+		if err != nil {
+			return false, false, err
+		}
+		d, evaluated = merge(d, cd), true
+	}
+	if !evaluated {
+		cd, err := p.policy.EvalImage(ctx, policy.Image{Registry: i.Registry, Repository: i.Repository, Tag: i.Tag, Digest: i.Digest, Scan: scan})
+		if err != nil {
+			return false, false, err
+		}
+		d = cd
+	}
+	p.decide("image", ref, d)
+	return d.Skip(), d.Patch == nil || *d.Patch, nil
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+)
+
+// OpenProgress starts recording the images pushed, patched and signed, continuing the progress of the previous run with Resume.
+// It is called by Run, and by the commands running single stages
+func (p *Pipeline) OpenProgress() error {
+	if p.DryRun || p.ProgressPath == "" {
+		return nil
+	}
+
+	if !p.Resume {
+		if _, err := os.Stat(p.ProgressPath); err == nil {
+			slog.Warn("the previous run did not complete. Its progress is discarded, run with --resume to continue it instead", slog.String("path", p.ProgressPath))
+		}
+		p.progress = store.NewProgress(p.ProgressPath)
+		return nil
+	}
+
+	pr, err := store.OpenProgress(p.ProgressPath)
+	if err != nil {
+		return fmt.Errorf("internal: error reading progress of the previous run :: %w", err)
+	}
+	slog.Info("resuming the previous run", slog.String("path", p.ProgressPath), slog.Int("images", pr.Len()))
+	p.progress = pr
+	return nil
+}
+
+// remaining returns the images the stage has not been completed for. The digests of completed images are restored
+func (p *Pipeline) remaining(imgs []*registry.Image, s store.Stage) ([]*registry.Image, error) {
+	if p.progress == nil {
+		return imgs, nil
+	}
+	res := make([]*registry.Image, 0, len(imgs))
+	for _, i := range imgs {
+		ref, err := i.String()
+		if err != nil {
+			return nil, err
+		}
+		d, ok := p.progress.Done(ref, s)
+		if !ok {
+			res = append(res, i)
+			continue
+		}
+		if d != "" {
+			i.Digest = d
+		}
+		slog.Debug("skipping image completed in the previous run", slog.String("image", ref), slog.String("stage", string(s)))
+	}
+	return res, nil
+}
+
+// complete records the stage as completed for the image. A failure to save the progress does not fail the run
+func (p *Pipeline) complete(i *registry.Image, s store.Stage) {
+	if p.progress == nil {
+		return
+	}
+	ref, err := i.String()
+	if err == nil {
+		err = p.progress.Complete(ref, s, i.Digest)
+	}
+	if err != nil {
+		slog.Warn("could not save progress", slog.String("stage", string(s)), slog.String("error", err.Error()))
+	}
+}
+
+// completeAll records the stage as completed for the images not recorded yet
+func (p *Pipeline) completeAll(imgs []*registry.Image, s store.Stage) {
+	if p.progress == nil {
+		return
+	}
+	for _, i := range imgs {
+		if ref, err := i.String(); err == nil {
+			if _, ok := p.progress.Done(ref, s); ok {
+				continue
+			}
+		}
+		p.complete(i, s)
+	}
+}
+
+// FinishProgress removes the progress once the run has completed
+func (p *Pipeline) FinishProgress() {
+	if p.progress == nil {
+		return
+	}
+	if err := p.progress.Remove(); err != nil {
+		slog.Warn("could not remove progress", slog.String("path", p.ProgressPath), slog.String("error", err.Error()))
+	}
+}
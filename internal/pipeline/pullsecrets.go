@@ -0,0 +1,170 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"gopkg.in/yaml.v3"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// WritePullSecrets creates a robot account allowed to pull the charts and images routed to the registry in every configured Harbor registry,
+// a deploy token in every configured GitLab group and a robot account in every configured Quay organization, and writes their credentials as a kubernetes.io/dockerconfigjson Secret for the imagePullSecrets of clusters
+func (p *Pipeline) WritePullSecrets(ctx context.Context) error {
+	c := p.PullSecrets
+	if !c.Enabled {
+		return nil
+	}
+
+	lookup := func(n string) (*registry.Registry, error) {
+		for i := range p.Registries {
+			if p.Registries[i].Name == n {
+				return &p.Registries[i], nil
+			}
+		}
+		return nil, fmt.Errorf("internal: no registry '%s' configured for pull secrets", n)
+	}
+
+	// the credentials of the last run are reused until they expire
+	previous := previousPullSecret(c.File)
+
+	creds := map[string]auth.Credential{}
+	for _, n := range c.Registries {
+		r, err := lookup(n)
+		if err != nil {
+			return err
+		}
+		names, err := p.pullNames(*r)
+		if err != nil {
+			return err
+		}
+		h := registry.Harbor{Registry: *r, URL: r.HarborProjects.URL}
+		cred, err := h.PullRobot(ctx, c.Name, r.HarborProjectsOf(names), c.Duration, previous[r.Host()])
+		if err != nil {
+			return err
+		}
+		creds[r.Host()] = cred
+	}
+	for _, gc := range c.GitLab {
+		r, err := lookup(gc.Registry)
+		if err != nil {
+			return err
+		}
+		g := registry.GitLab{Registry: *r, URL: gc.URL, Group: gc.Group, Token: gc.Token}
+		cred, err := g.DeployToken(ctx, c.Name, c.Duration, previous[r.Host()])
+		if err != nil {
+			return err
+		}
+		creds[r.Host()] = cred
+	}
+	for _, qc := range c.Quay {
+		r, err := lookup(qc.Registry)
+		if err != nil {
+			return err
+		}
+		names, err := p.pullNames(*r)
+		if err != nil {
+			return err
+		}
+		q := registry.Quay{Registry: *r, URL: qc.URL, Organization: qc.Organization, Token: qc.Token}
+		cred, err := q.PullRobot(ctx, c.Name, names)
+		if err != nil {
+			return err
+		}
+		creds[r.Host()] = cred
+	}
+
+	config, err := registry.DockerConfigJSON(creds)
+	if err != nil {
+		return err
+	}
+	secret := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]string{
+			"name":      c.Name,
+			"namespace": c.Namespace,
+		},
+		"type": "kubernetes.io/dockerconfigjson",
+		"data": map[string]string{
+			".dockerconfigjson": base64.StdEncoding.EncodeToString(config),
+		},
+	}
+	b, err := yaml.Marshal(secret)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.File), os.ModePerm); err != nil {
+		return err
+	}
+	// the Secret holds credentials, so it is only readable by the owner
+	if err := os.WriteFile(c.File, b, 0600); err != nil {
+		return fmt.Errorf("internal: error writing pull secret %s :: %w", c.File, err)
+	}
+	slog.Info("wrote pull secret", slog.String("path", c.File), slog.Int("registries", len(creds)))
+	return nil
+}
+
+// pullNames are the repositories of all charts and images routed to the registry, not only the ones imported by this run,
+// as the permissions of the robot accounts are replaced by every run
+func (p *Pipeline) pullNames(r registry.Registry) ([]string, error) {
+	seen := map[string]bool{}
+	names := []string{}
+	add := func(n string) {
+		if !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	for c, m := range p.Data {
+		for i := range m {
+			if !routes(r, c) && !r.Route.Image(i.Registry+"/"+i.Repository) {
+				continue
+			}
+			n, err := i.ImageName()
+			if err != nil {
+				return nil, err
+			}
+			add(n)
+		}
+	}
+	for _, c := range p.Charts.Charts {
+		if r.Route.Chart(c.Name, c.Version) {
+			add("charts/" + c.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// previousPullSecret reads the credentials of the Secret written by the last run. A missing or unreadable Secret has no credentials
+func previousPullSecret(file string) map[string]auth.Credential {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var secret struct {
+		Data map[string]string `yaml:"data"`
+	}
+	if err := yaml.Unmarshal(b, &secret); err != nil {
+		slog.Warn("could not read the previous pull secret", slog.String("path", file), slog.String("error", err.Error()))
+		return nil
+	}
+	config, err := base64.StdEncoding.DecodeString(secret.Data[".dockerconfigjson"])
+	if err != nil {
+		return nil
+	}
+	creds, err := registry.ParseDockerConfigJSON(config)
+	if err != nil {
+		slog.Warn("could not read the previous pull secret", slog.String("path", file), slog.String("error", err.Error()))
+		return nil
+	}
+	return creds
+}
@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+)
+
+// digests of the artifact in each registry it is present in
+func digests(ctx context.Context, name string, ref string, registries []registry.Registry) map[string]string {
+	m := make(map[string]string, len(registries))
+	for _, r := range registries {
+		d, err := r.Fetch(ctx, name, ref)
+		if err != nil {
+			slog.Debug("artifact not found in registry", slog.String("name", name), slog.String("reference", ref), slog.String("registry", r.URL))
+			continue
+		}
+		m[r.URL] = d.Digest.String()
+	}
+	return m
+}
+
+// WriteLock pins every chart and image of the run to the digests found in the registries, if a lockfile is configured
+func (p *Pipeline) WriteLock(ctx context.Context) error {
+	if p.LockPath == "" {
+		return nil
+	}
+	l := lock.New()
+	l.GeneratedBy = version.UserAgent()
+
+	for _, c := range p.Charts.Charts {
+		l.AddChart(lock.Chart{
+			Name:    c.Name,
+			Version: c.Version,
+			Repo:    c.Repo.URL,
+			Digests: digests(ctx, fmt.Sprintf("charts/%s", c.Name), registry.OCITag(c.Version), p.Registries),
+		})
+	}
+
+	for _, m := range p.Data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			name, err := i.ImageName()
+			if err != nil {
+				return err
+			}
+			l.AddImage(lock.Image{
+				Source:  ref,
+				Name:    name,
+				Tag:     i.Tag,
+				Digests: digests(ctx, name, i.Tag, p.Registries),
+			})
+		}
+	}
+
+	if err := l.Write(p.LockPath); err != nil {
+		return fmt.Errorf("internal: error writing lockfile %s :: %w", p.LockPath, err)
+	}
+	slog.Info("wrote lockfile", slog.String("path", p.LockPath))
+
+	return nil
+}
+
+// RecordState adds the imported artifacts to the state store, if a state store is configured
+func (p *Pipeline) RecordState(ctx context.Context) error {
+	if !p.StateConfig.Enabled() {
+		return nil
+	}
+
+	s, err := p.StateConfig.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := p.record(ctx, s); err != nil {
+		return fmt.Errorf("internal: error recording imports in state store: %w", err)
+	}
+	return nil
+}
+
+// record the imported charts and images in the state store
+func (p *Pipeline) record(ctx context.Context, s *store.Store) error {
+	signed := p.signed
+
+	for _, c := range p.Import.Charts {
+		name := fmt.Sprintf("charts/%s", c.Name)
+		for url, d := range digests(ctx, name, registry.OCITag(c.Version), p.Registries) {
+			s.Put(store.Record{
+				Kind:      store.Chart,
+				Registry:  url,
+				Name:      name,
+				Reference: registry.OCITag(c.Version),
+				Digest:    d,
+				Source:    c.Repo.URL,
+				Signed:    signed,
+			})
+		}
+	}
+
+	for _, i := range p.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return err
+		}
+		isPatched := false
+		for _, pi := range p.Patched {
+			if pi.Registry == i.Registry && pi.Repository == i.Repository && pi.Tag == i.Tag {
+				isPatched = true
+				break
+			}
+		}
+		var fixed []string
+		var source string
+		if isPatched {
+			fixed = p.fixed[ref]
+			if source, err = p.sourceDigest(ctx, i); err != nil {
+				slog.Warn("could not resolve the digest of the source image. It will be patched again by incremental runs", slog.String("image", ref), slog.String("error", err.Error()))
+			}
+			// patched images are recorded as named in the registries
+			if i, err = p.patchedTag().Image(i); err != nil {
+				return err
+			}
+		}
+		name, err := i.ImageName()
+		if err != nil {
+			return err
+		}
+		for url, d := range digests(ctx, name, i.Tag, p.Registries) {
+			s.Put(store.Record{
+				Kind:            store.Image,
+				Registry:        url,
+				Name:            name,
+				Reference:       i.Tag,
+				Digest:          d,
+				Source:          ref,
+				SourceDigest:    source,
+				Patched:         isPatched,
+				Signed:          signed,
+				Vulnerabilities: p.Vulns[ref],
+				Fixed:           fixed,
+			})
+		}
+	}
+
+	return s.Save()
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// lockedRefs references the artifact by its digest in each registry pinned in the lockfile
+func (p *Pipeline) lockedRefs(name string, reference string, digests map[string]string) []string {
+	refs := []string{}
+	for _, r := range p.Registries {
+		d, ok := digests[r.URL]
+		if !ok {
+			slog.Warn("artifact not pinned in lockfile for registry. It will not be signed", slog.String("name", name), slog.String("reference", reference), slog.String("registry", r.URL))
+			continue
+		}
+		refs = append(refs, r.Ref(name, d))
+	}
+	return refs
+}
+
+// SignFromLock signs the charts and images by the digests pinned in the lockfile, without analyzing, copying or scanning them.
+// The artifacts become the charts and images of the run, so Attest attests them with the patch state and vulnerabilities recorded in the state store, if any
+func (p *Pipeline) SignFromLock(ctx context.Context, path string) error {
+	l, err := lock.Load(path)
+	if err != nil {
+		return fmt.Errorf("internal: error reading lockfile %s :: %w", path, err)
+	}
+
+	var s *store.Store
+	if p.StateConfig.Enabled() {
+		s, err = p.StateConfig.Open(ctx)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	charts, images := []string{}, []string{}
+	for _, c := range l.Charts {
+		name := fmt.Sprintf("charts/%s", c.Name)
+		charts = append(charts, p.lockedRefs(name, c.Version, c.Digests)...)
+		p.Import.Charts = append(p.Import.Charts, helm.Chart{
+			Name:    c.Name,
+			Version: c.Version,
+			Repo:    repo.Entry{URL: c.Repo},
+		})
+	}
+	for _, i := range l.Images {
+		images = append(images, p.lockedRefs(i.Name, i.Tag, i.Digests)...)
+
+		img, err := registry.RefToImage(i.Source)
+		if err != nil {
+			return fmt.Errorf("internal: error parsing source '%s' of %s:%s in lockfile :: %w", i.Source, i.Name, i.Tag, err)
+		}
+		p.Imgs = append(p.Imgs, img)
+
+		if s == nil {
+			continue
+		}
+		for _, r := range p.Registries {
+			rec, ok := s.Get(store.Key(store.Image, r.URL, i.Name, i.Tag))
+			if !ok {
+				continue
+			}
+			if rec.Patched {
+				p.Patched = append(p.Patched, &img)
+			}
+			p.Vulns[i.Source] = rec.Vulnerabilities
+			break
+		}
+	}
+
+	for _, so := range p.signers() {
+		if err := so.Sign(registry.Artifacts(registry.ChartArtifact, charts...)); err != nil {
+			return err
+		}
+		if err := so.Sign(registry.Artifacts(registry.ImageArtifact, images...)); err != nil {
+			return err
+		}
+	}
+	p.signed = true
+	slog.Info("signed artifacts from lockfile", slog.String("lockfile", path), slog.Int("charts", len(charts)), slog.Int("images", len(images)))
+
+	if s == nil || p.DryRun {
+		return nil
+	}
+	// mark the signed artifacts in the state store
+	for _, r := range s.Records() {
+		digests := map[string]string{}
+		switch r.Kind {
+		case store.Chart:
+			for _, c := range l.Charts {
+				if fmt.Sprintf("charts/%s", c.Name) == r.Name && registry.OCITag(c.Version) == r.Reference {
+					digests = c.Digests
+				}
+			}
+		case store.Image:
+			for _, i := range l.Images {
+				if i.Name == r.Name && i.Tag == r.Reference {
+					digests = i.Digests
+				}
+			}
+		}
+		if d, ok := digests[r.Registry]; ok && d == r.Digest {
+			r.Signed = true
+			s.Put(r)
+		}
+	}
+	if err := s.Save(); err != nil {
+		return fmt.Errorf("internal: error recording signatures in state store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package pipeline
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// routes reports whether the chart is routed to the registry. Dependencies follow the routes of the charts depending on them, and
+// images from the configuration are routed to registries without chart restrictions
+func routes(r registry.Registry, c helm.Chart) bool {
+	if c.Name == "images" {
+		return len(r.Route.Charts) == 0
+	}
+	root := c.Root()
+	return r.Route.Chart(root.Name, root.Version)
+}
+
+// route sets the registries the images of the charts are routed to, and returns the images routed to no registry
+func (p *Pipeline) route(data helm.ChartData) map[string]bool {
+	if !slices.ContainsFunc(p.Registries, func(r registry.Registry) bool { return !r.Route.All() }) {
+		return nil
+	}
+
+	routed := map[string][]string{}
+	for c, m := range data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				continue
+			}
+			if _, ok := routed[ref]; !ok {
+				routed[ref] = []string{}
+			}
+			for _, r := range p.Registries {
+				if slices.Contains(routed[ref], r.Name) {
+					continue
+				}
+				if routes(r, c) || r.Route.Image(i.Registry+"/"+i.Repository) {
+					routed[ref] = append(routed[ref], r.Name)
+				}
+			}
+		}
+	}
+
+	unrouted := map[string]bool{}
+	for _, m := range data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				continue
+			}
+			i.Registries = routed[ref]
+			if len(i.Registries) == 0 {
+				unrouted[ref] = true
+			}
+		}
+	}
+	for ref := range unrouted {
+		slog.Warn("image is routed to no registry. skipping..", slog.String("image", ref))
+	}
+	return unrouted
+}
@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ChristofferNissen/helmper/pkg/sink"
+	"gopkg.in/yaml.v3"
+)
+
+// RunReport is the machine-readable result of a run, written to ReportPath
+type RunReport struct {
+	// Summary is the summary of the run sent to the sinks
+	Summary sink.Summary `json:"summary" yaml:"summary"`
+	Command string       `json:"command" yaml:"command"`
+	DryRun  bool         `json:"dryRun" yaml:"dryRun"`
+	// PlannedActions is the number of actions planned in dry-run
+	PlannedActions int           `json:"plannedActions,omitempty" yaml:"plannedActions,omitempty"`
+	Charts         []ChartResult `json:"charts" yaml:"charts"`
+	Images         []ImageResult `json:"images" yaml:"images"`
+	Signed         bool          `json:"signed" yaml:"signed"`
+	// Fallbacks are the images pushed to the fallback of a registry, as the pushes to the registry failed
+	Fallbacks []FallbackResult `json:"fallbacks,omitempty" yaml:"fallbacks,omitempty"`
+}
+
+// FallbackResult is an image or chart pushed to the fallback of a registry. Charts are named 'charts/<name>:<version>'
+type FallbackResult struct {
+	Image    string `json:"image" yaml:"image"`
+	Registry string `json:"registry" yaml:"registry"`
+	Fallback string `json:"fallback" yaml:"fallback"`
+}
+
+// ChartResult is the outcome of a chart. Status is 'found', 'planned' or 'imported'
+type ChartResult struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+	Repo    string `json:"repo" yaml:"repo"`
+	Images  int    `json:"images" yaml:"images"`
+	Status  string `json:"status" yaml:"status"`
+}
+
+// ImageResult is the outcome of an image. Status is 'found', 'planned', 'imported', 'patched', 'skipped' or 'quarantined'
+type ImageResult struct {
+	Source string `json:"source" yaml:"source"`
+	Status string `json:"status" yaml:"status"`
+	// Vulnerabilities left after patching, or the vulnerabilities at or above the severity gate of skipped and quarantined images
+	Vulnerabilities []string `json:"vulnerabilities,omitempty" yaml:"vulnerabilities,omitempty"`
+	Signed          bool     `json:"signed" yaml:"signed"`
+}
+
+// status of an artifact that passed the stage
+func (p *Pipeline) status(done bool) string {
+	switch {
+	case p.DryRun:
+		return "planned"
+	case done:
+		return "imported"
+	default:
+		return "found"
+	}
+}
+
+// RunReport reports the result of the run. runErr is the error the run failed with, if any
+func (p *Pipeline) RunReport(runErr error) (RunReport, error) {
+	r := RunReport{
+		Summary:        p.summary(runErr),
+		Command:        p.Command,
+		DryRun:         p.DryRun,
+		PlannedActions: p.Plan.Len(),
+		Charts:         []ChartResult{},
+		Images:         []ImageResult{},
+		Signed:         p.signed,
+	}
+
+	for _, c := range p.Import.Charts {
+		cr := ChartResult{Name: c.Name, Version: c.Version, Repo: c.Repo.URL, Status: p.status(p.chartsImported)}
+		for dc, imgs := range p.Data {
+			if dc.Name == c.Name && dc.Version == c.Version {
+				cr.Images += len(imgs)
+			}
+		}
+		r.Charts = append(r.Charts, cr)
+	}
+
+	patched := map[string]bool{}
+	for _, i := range p.Patched {
+		ref, err := i.String()
+		if err != nil {
+			return RunReport{}, err
+		}
+		patched[ref] = true
+	}
+	for _, i := range p.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return RunReport{}, err
+		}
+		ir := ImageResult{Source: ref, Status: p.status(p.imagesImported), Vulnerabilities: p.Vulns[ref]}
+		if patched[ref] && !p.DryRun {
+			ir.Status = "patched"
+		}
+		ir.Signed = p.signed && !p.DryRun && ir.Status != "found"
+		r.Images = append(r.Images, ir)
+	}
+	for ref, ids := range p.gated {
+		status := "skipped"
+		if p.ImportConfig.Import.FailAction == "quarantine" {
+			status = "quarantined"
+		}
+		r.Images = append(r.Images, ImageResult{Source: ref, Status: status, Vulnerabilities: ids})
+	}
+	sort.Slice(r.Images, func(i, j int) bool { return r.Images[i].Source < r.Images[j].Source })
+	for _, f := range p.fallbacks {
+		r.Fallbacks = append(r.Fallbacks, FallbackResult{Image: f.Image, Registry: f.Registry, Fallback: f.Fallback})
+	}
+
+	return r, nil
+}
+
+// WriteRunReport writes the report of the run to ReportPath, as YAML for '.yaml' and '.yml' files and JSON otherwise
+func (p *Pipeline) WriteRunReport(runErr error) error {
+	if p.ReportPath == "" {
+		return nil
+	}
+
+	r, err := p.RunReport(runErr)
+	if err != nil {
+		return fmt.Errorf("internal: error creating run report :: %w", err)
+	}
+
+	var b []byte
+	switch filepath.Ext(p.ReportPath) {
+	case ".yaml", ".yml":
+		b, err = yaml.Marshal(r)
+	default:
+		b, err = json.MarshalIndent(r, "", "  ")
+	}
+	if err != nil {
+		return fmt.Errorf("internal: error encoding run report :: %w", err)
+	}
+	if err := os.WriteFile(p.ReportPath, b, 0o644); err != nil {
+		return fmt.Errorf("internal: error writing run report to %s :: %w", p.ReportPath, err)
+	}
+	slog.Info("wrote run report", slog.String("path", p.ReportPath))
+	return nil
+}
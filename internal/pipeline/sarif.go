@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+// WriteSARIF writes the latest scan report of every image to one SARIF file, if configured
+func (p *Pipeline) WriteSARIF(ctx context.Context) error {
+	path := p.ImportConfig.Import.Copacetic.Output.Reports.SARIF
+	if path == "" || len(p.reports) == 0 {
+		return nil
+	}
+
+	refs := make([]string, 0, len(p.reports))
+	for ref := range p.reports {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+
+	reports := make([]types.Report, 0, len(refs))
+	for _, ref := range refs {
+		b, err := os.ReadFile(p.reports[ref])
+		if err != nil {
+			return fmt.Errorf("internal: error reading scan report of %s :: %w", ref, err)
+		}
+		var r types.Report
+		if err := json.Unmarshal(b, &r); err != nil {
+			return fmt.Errorf("internal: error decoding scan report of %s :: %w", ref, err)
+		}
+		reports = append(reports, r)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("internal: error writing SARIF file :: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("internal: error writing SARIF file :: %w", err)
+	}
+	defer f.Close()
+	if err := trivy.WriteSARIF(ctx, f, reports); err != nil {
+		return fmt.Errorf("internal: error writing SARIF file :: %w", err)
+	}
+
+	slog.Info("wrote SARIF file", slog.String("path", path), slog.Int("images", len(reports)))
+	return nil
+}
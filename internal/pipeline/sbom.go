@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/schollz/progressbar/v3"
+)
+
+// GenerateSBOMs writes an SPDX or CycloneDX document listing the packages of every image to import, if enabled.
+// The documents are written in the per-chart output layout and are kept when the scan reports are cleaned
+func (p *Pipeline) GenerateSBOMs(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "generate sboms")
+	defer func() { done(err) }()
+
+	conf := p.ImportConfig.Import.SBOM
+	if !conf.Enabled || p.DryRun {
+		return nil
+	}
+
+	ext, err := trivy.SBOMExtension(conf.Format)
+	if err != nil {
+		return err
+	}
+
+	bar := terminal.NewBar(len(p.Imgs), "Generating SBOMs...\r", progressbar.OptionSetRenderBlankState(true))
+	so := p.scanOption()
+	for _, i := range p.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return err
+		}
+		name, err := i.ImageName()
+		if err != nil {
+			return err
+		}
+
+		r, err := so.SBOM(ref)
+		if err != nil {
+			return err
+		}
+
+		path, err := p.Layout.Path(conf.Folder, "sbom", ref, name, i.Tag, ext)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("internal: error creating SBOM %s :: %w", path, err)
+		}
+		if err := trivy.WriteSBOM(ctx, f, r, conf.Format); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		slog.Debug("wrote SBOM", slog.String("image", ref), slog.String("path", path))
+		if p.sboms == nil {
+			p.sboms = map[string]string{}
+		}
+		p.sboms[ref] = path
+
+		_ = bar.Add(1)
+	}
+	if err := bar.Finish(); err != nil {
+		return err
+	}
+
+	return p.Layout.WriteIndex()
+}
@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// discoverSiblings finds the variants of the images by tag convention and reports them. With import, the variants are added
+// to the config images, so they are imported without being referenced by any chart
+func (p *Pipeline) discoverSiblings(ctx context.Context, data helm.ChartData) error {
+	c := p.ParserConfig.Siblings
+
+	known := map[string]bool{}
+	imgs := []*registry.Image{}
+	for _, m := range data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			if !known[ref] {
+				known[ref] = true
+				imgs = append(imgs, i)
+			}
+		}
+	}
+
+	siblings := []registry.Image{}
+	for _, i := range imgs {
+		ss, err := i.Siblings(ctx, p.SourceRegistries, c.Variants)
+		if err != nil {
+			slog.Warn("could not list tags of image. skipping sibling discovery", slog.String("image", i.Registry+"/"+i.Repository), slog.String("error", err.Error()))
+			continue
+		}
+		for _, s := range ss {
+			ref, err := s.String()
+			if err != nil {
+				return err
+			}
+			if known[ref] {
+				continue
+			}
+			known[ref] = true
+			siblings = append(siblings, s)
+		}
+	}
+	if len(siblings) == 0 {
+		return nil
+	}
+
+	output.RenderSiblingTable(siblings, c.Import)
+	if !c.Import {
+		return nil
+	}
+	m := data[helm.Chart{Name: "images", Version: "0.0.0"}]
+	for i := range siblings {
+		m[&siblings[i]] = []string{}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/output"
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// identities converts the configured keyless identities
+func identities(c []bootstrap.IdentityConfigSection) []mySign.Identity {
+	ids := make([]mySign.Identity, 0, len(c))
+	for _, id := range c {
+		ids = append(ids, mySign.Identity{
+			Issuer:        id.Issuer,
+			IssuerRegExp:  id.IssuerRegExp,
+			Subject:       id.Subject,
+			SubjectRegExp: id.SubjectRegExp,
+		})
+	}
+	return ids
+}
+
+// VerifySources verifies the Cosign signatures of the images in their source registries before they are imported.
+// Images without valid signatures fail the run with the 'enforce' policy, and are only reported with the 'warn' policy
+func (p *Pipeline) VerifySources(ctx context.Context) error {
+	c := p.SignaturesConfig
+	if !c.Enabled || len(p.Imgs) == 0 {
+		return nil
+	}
+
+	imgs := make([]*registry.Image, 0, len(p.Imgs))
+	for i := range p.Imgs {
+		imgs = append(imgs, &p.Imgs[i])
+	}
+	vs, err := mySign.VerifyOption{
+		Imgs:        imgs,
+		KeyRef:      c.KeyRef,
+		Identities:  identities(c.Identities),
+		RekorURL:    c.RekorURL,
+		IgnoreTlog:  c.IgnoreTlog,
+		Concurrency: p.ImportConfig.Import.Concurrency,
+	}.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("internal: error verifying source signatures :: %w", err)
+	}
+
+	output.RenderSourceSignatureTable(vs)
+	failed := 0
+	for _, v := range vs {
+		if !v.Signed {
+			failed++
+			slog.Warn("source image signature not verified", slog.String("image", v.Image), slog.String("error", v.Err.Error()))
+		}
+	}
+	if failed > 0 && c.Policy == "enforce" {
+		return fmt.Errorf("internal: %d of %d images do not have a valid signature in their source registry", failed, len(vs))
+	}
+	return nil
+}
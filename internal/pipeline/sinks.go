@@ -0,0 +1,174 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/sink"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+)
+
+// summary of the run. runErr is the error the run failed with, if any
+func (p *Pipeline) summary(runErr error) sink.Summary {
+	v := version.Get()
+	s := sink.Summary{
+		Version: v.Version,
+		Commit:  v.Commit,
+		Date:    v.Date,
+		Time:    time.Now().UTC(),
+		Charts:  []string{},
+		Images:  len(p.Imgs),
+		Patched: len(p.Patched),
+	}
+	for _, c := range p.Import.Charts {
+		s.Charts = append(s.Charts, c.Name+":"+c.Version)
+	}
+	for _, vs := range p.Vulns {
+		s.Vulnerabilities += len(vs)
+	}
+	for _, i := range p.Patched {
+		ref, err := i.String()
+		if err != nil {
+			continue
+		}
+		if vs, ok := p.Vulns[ref]; ok && p.prescan[ref] > len(vs) {
+			s.Fixed += p.prescan[ref] - len(vs)
+		}
+	}
+	s.New = slices.Clone(p.copied)
+	sort.Strings(s.New)
+	for _, f := range p.failures {
+		s.Failures = append(s.Failures, fmt.Sprintf("%s to %s: %s", f.Image, f.Registry, f.Err))
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+	return s
+}
+
+// reportFiles maps the names of the reports and SBOMs written during the run, relative to their output folder, to their artifacts
+func (p *Pipeline) reportFiles() map[string]registry.Artifact {
+	folders := map[registry.ArtifactKind]string{
+		registry.ReportArtifact: p.ImportConfig.Import.Copacetic.Output.Reports.Folder,
+		registry.SBOMArtifact:   p.ImportConfig.Import.SBOM.Folder,
+	}
+	fs := map[string]registry.Artifact{}
+	for _, a := range p.reportArtifacts() {
+		name, err := filepath.Rel(folders[a.Kind], a.Path)
+		if err != nil {
+			name = filepath.Base(a.Path)
+		}
+		fs[filepath.ToSlash(name)] = a
+	}
+	return fs
+}
+
+// Publish writes the summary and the reports of the run to the configured sinks, and notifies them. runErr is the error the run failed with, if any.
+// Every sink is tried, even if others fail
+func (p *Pipeline) Publish(ctx context.Context, runErr error) error {
+	if len(p.Sinks) == 0 {
+		return nil
+	}
+
+	s := p.summary(runErr)
+	files := p.reportFiles()
+	names := make([]string, 0, len(files))
+	for n := range files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, c := range p.Sinks {
+		if !c.Wants(s) {
+			continue
+		}
+		snk, err := sink.New(ctx, c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := snk.WriteSummary(ctx, s); err != nil {
+			errs = append(errs, err)
+		}
+		// failed runs have no complete reports
+		if runErr == nil {
+			for _, n := range names {
+				if err := publishReport(ctx, snk, n, files[n]); err != nil {
+					errs = append(errs, err)
+				}
+				if w, ok := snk.(sink.ImageReportWriter); ok {
+					if err := publishImageReport(ctx, w, files[n]); err != nil {
+						errs = append(errs, err)
+					}
+				}
+			}
+		}
+		if err := snk.Notify(ctx, s.String()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("internal: error publishing to sinks :: %w", err)
+	}
+	slog.Debug("published run to sinks", slog.Int("sinks", len(p.Sinks)), slog.Int("reports", len(names)))
+	return nil
+}
+
+// alert writes the summary to the configured sinks and notifies them, without reports. Every sink is tried, even if others fail
+func (p *Pipeline) alert(ctx context.Context, s sink.Summary) error {
+	var errs []error
+	for _, c := range p.Sinks {
+		if !c.Wants(s) {
+			continue
+		}
+		snk, err := sink.New(ctx, c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := snk.WriteSummary(ctx, s); err != nil {
+			errs = append(errs, err)
+		}
+		if err := snk.Notify(ctx, s.String()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("internal: error alerting sinks :: %w", err)
+	}
+	return nil
+}
+
+func publishReport(ctx context.Context, snk sink.Sink, name string, a registry.Artifact) error {
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return snk.WriteReport(ctx, name, f)
+}
+
+// publishImageReport writes the report with the image it describes to sinks storing reports by image
+func publishImageReport(ctx context.Context, w sink.ImageReportWriter, a registry.Artifact) error {
+	f, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	kind := sink.KindVulnerabilities
+	if a.Kind == registry.SBOMArtifact {
+		kind = sink.KindSBOM
+	}
+	return w.WriteImageReport(ctx, sink.ImageReport{Image: a.Subject, Kind: kind}, f)
+}
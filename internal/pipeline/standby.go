@@ -0,0 +1,155 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/sink"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"golang.org/x/sync/errgroup"
+	"oras.land/oras-go/v2/errdef"
+)
+
+// standbyEntry is a chart or image of the lockfile, with the digest of the primary registry
+type standbyEntry struct {
+	kind      string
+	name      string
+	reference string
+	digest    string
+}
+
+// primary is the registry whose digests are expected in the standby registry
+func (p *Pipeline) primary() (registry.Registry, error) {
+	for _, r := range p.Registries {
+		if p.StandbyConfig.Primary == "" || r.GetName() == p.StandbyConfig.Primary {
+			return r, nil
+		}
+	}
+	return registry.Registry{}, fmt.Errorf("internal: the primary registry %s of the standby registry is not configured", p.StandbyConfig.Primary)
+}
+
+// Standby verifies that the standby registry holds every chart and image of the lockfile with the digest in the primary registry,
+// and that their signatures are valid, if configured. Drift is reported to the sinks and fails the verification
+func (p *Pipeline) Standby(ctx context.Context) (err error) {
+	ctx, done := p.startStage(ctx, "standby")
+	defer func() { done(err) }()
+
+	primary, err := p.primary()
+	if err != nil {
+		return err
+	}
+	standby := p.StandbyConfig.Mirror
+	l, err := lock.Load(p.LockPath)
+	if err != nil {
+		return fmt.Errorf("internal: error reading lockfile %s :: %w", p.LockPath, err)
+	}
+
+	es := []standbyEntry{}
+	for _, c := range l.Charts {
+		es = append(es, standbyEntry{kind: "chart", name: "charts/" + c.Name, reference: registry.OCITag(c.Version), digest: c.Digests[primary.URL]})
+	}
+	for _, i := range l.Images {
+		es = append(es, standbyEntry{kind: "image", name: i.Name, reference: i.Tag, digest: i.Digests[primary.URL]})
+	}
+
+	var mu sync.Mutex
+	drifts := []output.StandbyDrift{}
+	mirrored := []*registry.Image{}
+	// names of the mirrored artifacts by their reference in the standby registry
+	names := map[string]string{}
+	eg, egCtx := errgroup.WithContext(ctx)
+	if p.ImportConfig.Import.Concurrency > 0 {
+		eg.SetLimit(p.ImportConfig.Import.Concurrency)
+	}
+	for _, e := range es {
+		if e.digest == "" {
+			slog.Debug("artifact not in primary registry. skipping", slog.String("name", e.name), slog.String("reference", e.reference), slog.String("registry", primary.URL))
+			continue
+		}
+		eg.Go(func() error {
+			d := output.StandbyDrift{Kind: e.kind, Name: e.name + ":" + e.reference, Expected: e.digest}
+			desc, err := standby.Fetch(egCtx, e.name, e.reference)
+			switch {
+			case errors.Is(err, errdef.ErrNotFound):
+				d.Reason = "missing"
+			case err != nil:
+				d.Reason = err.Error()
+			case desc.Digest.String() != e.digest:
+				d.Actual, d.Reason = desc.Digest.String(), "digest differs from primary"
+			default:
+				i, err := registry.RefToImage(standby.Ref(e.name, e.digest))
+				if err != nil {
+					return err
+				}
+				ref, err := i.String()
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				mirrored = append(mirrored, &i)
+				names[ref] = d.Name
+				mu.Unlock()
+				return nil
+			}
+			mu.Lock()
+			drifts = append(drifts, d)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+
+	if c := p.StandbyConfig.Signatures; c.Enabled {
+		vs, err := mySign.VerifyOption{
+			Imgs:        mirrored,
+			KeyRef:      c.KeyRef,
+			Identities:  identities(c.Identities),
+			RekorURL:    c.RekorURL,
+			IgnoreTlog:  c.IgnoreTlog,
+			Concurrency: p.ImportConfig.Import.Concurrency,
+		}.Run(ctx)
+		if err != nil {
+			return fmt.Errorf("internal: error verifying signatures in standby registry :: %w", err)
+		}
+		for _, v := range vs {
+			if v.Signed {
+				continue
+			}
+			drifts = append(drifts, output.StandbyDrift{Kind: "signature", Name: names[v.Image], Reason: v.Err.Error()})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool {
+		if drifts[i].Name == drifts[j].Name {
+			return drifts[i].Kind < drifts[j].Kind
+		}
+		return drifts[i].Name < drifts[j].Name
+	})
+	output.RenderStandbyTable(standby.URL, drifts, len(es))
+	if len(drifts) == 0 {
+		slog.Info("standby registry mirrors the primary registry", slog.String("standby", standby.URL), slog.String("primary", primary.URL), slog.Int("artifacts", len(es)))
+		return nil
+	}
+
+	err = fmt.Errorf("internal: %d of %d artifacts of the lockfile drifted in the standby registry %s", len(drifts), len(es), standby.URL)
+	v := version.Get()
+	s := sink.Summary{Version: v.Version, Commit: v.Commit, Date: v.Date, Time: time.Now().UTC(), Charts: []string{}, Error: err.Error()}
+	for _, d := range drifts {
+		s.Failures = append(s.Failures, fmt.Sprintf("%s %s: %s", d.Kind, d.Name, d.Reason))
+	}
+	if aerr := p.alert(ctx, s); aerr != nil {
+		slog.Warn("could not alert sinks of standby drift", slog.String("error", aerr.Error()))
+	}
+	return err
+}
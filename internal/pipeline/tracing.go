@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"github.com/ChristofferNissen/helmper/pkg/util/tracing"
+	"go.opentelemetry.io/otel"
+)
+
+// tracer traces the stages of the pipeline. Spans are only exported when tracing is enabled
+var tracer = otel.Tracer("github.com/ChristofferNissen/helmper/internal/pipeline")
+
+// startStage starts the span of the stage and emits a progress event. The returned func ends the stage with its error
+func (p *Pipeline) startStage(ctx context.Context, name string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, name)
+	p.Events.Emit(events.Event{Type: events.StageStarted, Stage: name})
+	return ctx, func(err error) {
+		tracing.End(span, err)
+		if err != nil {
+			p.Events.Emit(events.Event{Type: events.StageFailed, Stage: name, Error: err.Error()})
+			return
+		}
+		p.Events.Emit(events.Event{Type: events.StageCompleted, Stage: name})
+	}
+}
+
+// steps are what happened to the items of the stages
+var steps = map[string]string{
+	"analyze":       "discovered",
+	"scan":          "scanned",
+	"import images": "pushed",
+	"patch":         "patched",
+	"sign images":   "signed",
+}
+
+// item emits a progress event for an item of the stage, counting the items processed so far
+func (p *Pipeline) item(stage string, ref string, total int, err error) {
+	if p.Events == nil {
+		return
+	}
+	p.itemsMu.Lock()
+	if p.items == nil {
+		p.items = map[string]int{}
+	}
+	p.items[stage]++
+	done := p.items[stage]
+	p.itemsMu.Unlock()
+
+	ev := events.Event{Type: events.ItemCompleted, Stage: stage, Item: ref, Step: steps[stage], Done: done, Total: total}
+	if err != nil {
+		ev.Type, ev.Error = events.ItemFailed, err.Error()
+	}
+	p.Events.Emit(ev)
+}
@@ -0,0 +1,43 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// MirrorTrivyDB copies the Trivy vulnerability databases into the registries, so scanners in offline environments download them from there
+func (p *Pipeline) MirrorTrivyDB(ctx context.Context) (err error) {
+	if !p.ImportConfig.Import.Copacetic.Trivy.MirrorDB {
+		return nil
+	}
+	ctx, done := p.startStage(ctx, "mirror trivy db")
+	defer func() { done(err) }()
+
+	for _, r := range p.Registries {
+		for _, t := range registry.TrivyDBs(p.ToolsConfig.List()) {
+			ref, err := r.ToolRef(t)
+			if err != nil {
+				return err
+			}
+			if p.DryRun {
+				p.Plan.Add(plan.Action{
+					Kind:      plan.CopyImage,
+					Source:    t.Ref,
+					Target:    ref,
+					Insecure:  r.Insecure,
+					PlainHTTP: r.PlainHTTP,
+				})
+				continue
+			}
+			if err := r.PushTool(ctx, t, nil); err != nil {
+				return fmt.Errorf("internal: error mirroring the Trivy database :: %w", err)
+			}
+			slog.Info("mirrored Trivy database", slog.String("database", t.Ref), slog.String("target", ref))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+)
+
+// WriteValues writes a values file per chart and registry pointing the images of the chart to the registry, if a values folder is configured.
+// The files are written to <folder>/<registry>/<chart>/<version>/values.yaml. Values of images found with low confidence are commented for review.
+// Written by Analyze, and again by Patch to reference the patched images
+func (p *Pipeline) WriteValues() error {
+	if p.ValuesConfig.Folder == "" {
+		return nil
+	}
+
+	data, err := p.patchedData(p.Data)
+	if err != nil {
+		return err
+	}
+	for c, m := range data {
+		// images from the configuration are not part of a chart
+		if c.Name == "images" {
+			continue
+		}
+		for _, r := range p.Registries {
+			if !routes(r, c) {
+				continue
+			}
+			b, err := helm.OverrideValuesYAML(m, r, helm.DefaultPatterns().With(p.ParserConfig.Patterns))
+			if err != nil {
+				return err
+			}
+
+			path := filepath.Join(p.ValuesConfig.Folder, r.GetName(), c.Name, c.Version, "values.yaml")
+			if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+				return err
+			}
+			if err := os.WriteFile(path, b, 0o644); err != nil {
+				return fmt.Errorf("internal: error writing values file %s :: %w", path, err)
+			}
+			slog.Debug("wrote values file", slog.String("chart", c.Name), slog.String("version", c.Version), slog.String("registry", r.URL), slog.String("path", path))
+		}
+	}
+
+	slog.Info("wrote values files", slog.String("folder", p.ValuesConfig.Folder))
+	return nil
+}
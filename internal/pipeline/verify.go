@@ -0,0 +1,46 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+)
+
+// Verify lints and renders the imported charts using only the charts and images in the registries, and runs 'helm test' in a cluster if configured.
+// It fails the run if a chart cannot be deployed from the registries alone
+func (p *Pipeline) Verify(ctx context.Context) error {
+	if len(p.Import.Charts) == 0 {
+		return nil
+	}
+
+	vs, err := helm.VerifyOption{
+		Registries:     p.Registries,
+		Charts:         p.Import,
+		Data:           p.Data,
+		ModifyRegistry: p.ImportConfig.Import.ReplaceRegistryReferences,
+		Patterns:       p.ParserConfig.Patterns,
+		K8SVersion:     state.GetValue[string](p.viper, "k8s_version"),
+		APIVersions:    state.GetValue[[]string](p.viper, "api_versions"),
+		Kubeconfig:     p.VerifyConfig.Kubeconfig,
+		Namespace:      p.VerifyConfig.Namespace,
+		Timeout:        p.VerifyConfig.Timeout,
+	}.Run(ctx)
+	if err != nil {
+		return fmt.Errorf("internal: error verifying charts :: %w", err)
+	}
+
+	output.RenderVerifyTable(vs)
+	failed := 0
+	for _, v := range vs {
+		if !v.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("internal: %d of %d charts cannot be deployed from the registries alone", failed, len(vs))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// Warm pulls every image found in the charts through the pull-through cache proxying its registry, so the caches hold the images before clusters pull them.
+// Nothing is pushed to the registries
+func (p *Pipeline) Warm(ctx context.Context) error {
+	seen := map[string]bool{}
+	imgs := []*registry.Image{}
+	for _, m := range p.Data {
+		for i := range m {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			imgs = append(imgs, i)
+		}
+	}
+
+	ws, err := registry.WarmOption{
+		Imgs:         imgs,
+		Caches:       p.Caches,
+		Architecture: p.ImportConfig.Import.Architecture,
+		Concurrency:  p.ImportConfig.Import.Concurrency,
+		Retries:      p.ImportConfig.Import.Retries,
+		Backoff:      p.backoff(),
+		DryRun:       p.DryRun,
+		Plan:         p.Plan,
+	}.Run(ctx)
+	if err != nil {
+		return err
+	}
+	if p.DryRun {
+		return nil
+	}
+
+	output.RenderWarmTable(ws)
+	failed := 0
+	for _, w := range ws {
+		if w.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("internal: %d of %d images could not be pulled through the caches", failed, len(ws))
+	}
+	return nil
+}
@@ -2,523 +2,423 @@ package internal
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"log"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"strings"
+	"slices"
 
 	"github.com/ChristofferNissen/helmper/internal/bootstrap"
 	"github.com/ChristofferNissen/helmper/internal/output"
-	"github.com/ChristofferNissen/helmper/pkg/copa"
-	mySign "github.com/ChristofferNissen/helmper/pkg/cosign"
-	"github.com/ChristofferNissen/helmper/pkg/helm"
-	"github.com/ChristofferNissen/helmper/pkg/registry"
-	"github.com/ChristofferNissen/helmper/pkg/trivy"
-	"github.com/ChristofferNissen/helmper/pkg/util/state"
-	"github.com/bobg/go-generics/slices"
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+	"github.com/ChristofferNissen/helmper/pkg/hooks"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
 )
 
-var (
-	version = "dev"
-	commit  = "none"
-	date    = "unknown"
-)
-
-func modify(cm *helm.ChartData, mirrorConfig []bootstrap.MirrorConfigSection) error {
-
-	// modify images according to user specification
-	for c, m := range *cm {
-		for i, vs := range m {
-			r, err := i.String()
-			if err != nil {
-				return err
-			}
-
-			if c.Images != nil {
-				for _, e := range c.Images.Exclude {
-					if strings.HasPrefix(r, e.Ref) {
-						delete(m, i)
-						slog.Info("excluded image", slog.String("image", r))
-						break
-					}
-				}
-				for _, ec := range c.Images.ExcludeCopacetic {
-					if strings.HasPrefix(r, ec.Ref) {
-						slog.Info("excluded image from copacetic patching", slog.String("image", r))
-						f := false
-						i.Patch = &f
-						break
-					}
-				}
-				for _, modify := range c.Images.Modify {
-					if modify.From != "" {
-
-						if strings.HasPrefix(r, modify.From) {
-							delete(m, i)
-
-							img, err := registry.RefToImage(
-								strings.Replace(r, modify.From, modify.To, 1),
-							)
-							if err != nil {
-								return err
-							}
-
-							img.Digest = i.Digest
-							img.UseDigest = i.UseDigest
-							img.Tag = i.Tag
-							img.Patch = i.Patch
-
-							m[&img] = vs
-
-							newR, err := img.String()
-							if err != nil {
-								return err
-							}
-							slog.Info("modified image reference", slog.String("old_image", r), slog.String("new_image", newR))
-						}
-					}
-				}
-			}
-
-			// Replace mirrors
-			ms, err := slices.Filter(mirrorConfig, func(m bootstrap.MirrorConfigSection) (bool, error) {
-				return m.Registry == i.Registry, nil
-			})
-			if err != nil {
-				return err
-			}
-
-			if len(ms) > 0 {
-				i.Registry = ms[0].Mirror
-			}
-		}
-	}
-	return nil
-}
-
-func Program(args []string) error {
-	ctx := context.TODO()
-
+func setupLogger() {
 	slogHandlerOpts := &slog.HandlerOptions{}
 	if os.Getenv("HELMPER_LOG_LEVEL") == "DEBUG" {
 		slogHandlerOpts.Level = slog.LevelDebug
 	}
-	logger := slog.New(slog.NewJSONHandler(os.Stdout, slogHandlerOpts))
+	logger := slog.New(slog.NewJSONHandler(terminal.Stdout, slogHandlerOpts))
 	slog.SetDefault(logger)
+	log.SetOutput(terminal.Stderr)
+}
 
-	output.Header(version, commit, date)
-
-	viper, err := bootstrap.LoadViperConfiguration(args)
-	if err != nil {
-		return err
-	}
-	var (
-		k8sVersion   string                          = state.GetValue[string](viper, "k8s_version")
-		verbose      bool                            = state.GetValue[bool](viper, "verbose")
-		update       bool                            = state.GetValue[bool](viper, "update")
-		all          bool                            = state.GetValue[bool](viper, "all")
-		parserConfig bootstrap.ParserConfigSection   = state.GetValue[bootstrap.ParserConfigSection](viper, "parserConfig")
-		importConfig bootstrap.ImportConfigSection   = state.GetValue[bootstrap.ImportConfigSection](viper, "importConfig")
-		mirrorConfig []bootstrap.MirrorConfigSection = state.GetValue[[]bootstrap.MirrorConfigSection](viper, "mirrorConfig")
-		registries   []registry.Registry             = state.GetValue[[]registry.Registry](viper, "registries")
-		images       []registry.Image                = state.GetValue[[]registry.Image](viper, "images")
-		charts       helm.ChartCollection            = state.GetValue[helm.ChartCollection](viper, "input")
-		opts         []helm.Option                   = []helm.Option{
-			helm.K8SVersion(k8sVersion),
-			helm.Verbose(verbose),
-			helm.Update(update),
-		}
-	)
+// reportKey is the context key of the run the command reports on when it exits
+type reportKey struct{}
 
-	if verbose {
-		slog.SetLogLoggerLevel(slog.LevelDebug)
-	}
+// reported is the pipeline loaded by the command, reported on when the command exits. Commands running several pipelines,
+// e.g. the groups of a configuration, leave it empty, as every pipeline writes its own run report
+type reported struct {
+	p *pipeline.Pipeline
+}
 
-	// Find input charts in configuration
-	slog.Debug(
-		"Found charts in config",
-		slog.Int("count", len(charts.Charts)),
-	)
+// resumable are the commands recording the images they pushed, patched and signed, so they can be resumed with --resume
+var resumable = []string{"helmper", "import", "patch", "sign", "watch"}
 
-	// STEP 1: Setup Helm
-	charts, err = bootstrap.SetupHelm(
-		&charts,
-		opts...,
-	)
+// load reads the flags of the command and the configuration file
+func load(cmd *cobra.Command) (*pipeline.Pipeline, error) {
+	if resume, _ := cmd.Flags().GetBool("resume"); resume && !slices.Contains(resumable, cmd.Name()) {
+		return nil, xerrors.Errorf("The %s command records no progress, so it can not be resumed. Please remove --resume and try again..", cmd.Name())
+	}
+	viper, err := bootstrap.LoadViperConfiguration(cmd.Flags())
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// Output overview table of charts and subcharts
-	go output.RenderChartTable(
-		&charts,
-		output.Update(update),
-	)
-
-	// STEP 2: Find images in Helm Charts and dependencies
-	slog.Debug("Starting parsing user specified chart(s) for images..")
-	co := helm.ChartOption{
-		ChartCollection: &charts,
-		IdentifyImages:  !parserConfig.DisableImageDetection,
-		UseCustomValues: parserConfig.UseCustomValues,
+	if err := startTracing(cmd, viper); err != nil {
+		return nil, err
 	}
-	chartImageHelmValuesMap, err := co.Run(
-		ctx,
-		opts...,
-	)
-	if err != nil {
-		return err
+	p := pipeline.New(viper)
+	p.Command = cmd.CommandPath()
+	if err := attachEvents(p, viper, ""); err != nil {
+		return nil, err
 	}
-
-	err = modify(&chartImageHelmValuesMap, mirrorConfig)
-	if err != nil {
-		return err
+	if r, ok := cmd.Context().Value(reportKey{}).(*reported); ok {
+		r.p = nil
+		if len(p.Groups) == 0 {
+			r.p = p
+		}
 	}
+	return p, nil
+}
 
-	// Add in images from config
-	placeHolder := helm.Chart{
-		Name:    "images",
-		Version: "0.0.0",
-	}
-	m := map[*registry.Image][]string{}
-	for _, i := range images {
-		m[&i] = []string{}
+func requireCopacetic(cmd string, p *pipeline.Pipeline) error {
+	if p.ImportConfig.Import.Copacetic.Enabled {
+		return nil
 	}
-	chartImageHelmValuesMap[placeHolder] = m
+	s := `
+import:
+  copacetic:
+    enabled: true    <---
+`
+	return xerrors.Errorf("The %s command requires Copacetic. Please enable Copacetic and try again..\nExample config:\n%s", cmd, s)
+}
 
-	// Output table of image to helm chart value path
-	go func() {
-		output.RenderHelmValuePathToImageTable(chartImageHelmValuesMap)
-		slog.Debug("Parsing of user specified chart(s) completed")
-	}()
+func requireSigner(cmd string, p *pipeline.Pipeline) error {
+	if p.ImportConfig.Import.Cosign.Enabled || p.ImportConfig.Import.Notation.Enabled {
+		return nil
+	}
+	s := `
+import:
+  cosign:
+    enabled: true    <--- or notation
+    keyRef: cosign.key
+`
+	return xerrors.Errorf("The %s command requires Cosign or Notation. Please enable a signer and try again..\nExample config:\n%s", cmd, s)
+}
 
-	// STEP 3: Validate and correct image references from charts
-	slog.Debug("Checking presence of images from chart(s) in registries...")
-	cs, imgs, err := helm.IdentifyImportCandidates(
-		ctx,
-		registries,
-		chartImageHelmValuesMap,
-		all,
-	)
-	if err != nil {
+// finish reports the run of the stages, and removes its progress once they have completed
+func finish(p *pipeline.Pipeline) error {
+	if err := p.Finish(); err != nil {
 		return err
 	}
-	_ = output.RenderChartOverviewTable(
-		ctx,
-		viper,
-		len(charts.Charts),
-		registries,
-		charts,
-	)
-	// Output table of image status in registries
-	_ = output.RenderImageOverviewTable(
-		ctx,
-		viper,
-		len(imgs),
-		registries,
-		chartImageHelmValuesMap,
-	)
-	slog.Debug("Finished checking image availability in registries")
-
-	// Import charts to registries
-	switch {
-	case importConfig.Import.Enabled && len(cs.Charts) > 0:
-		err := helm.ChartImportOption{
-			Registries:      registries,
-			ChartCollection: &cs,
-			All:             all,
-			ModifyRegistry:  importConfig.Import.ReplaceRegistryReferences,
-		}.Run(ctx, opts...)
-		if err != nil {
-			return fmt.Errorf("internal: error importing chart to registry: %w", err)
-		}
-
-		if importConfig.Import.Cosign.Enabled {
-			slog.Debug("Cosign enabled")
-			signo := mySign.SignChartOption{
-				ChartCollection: &cs,
-				Registries:      registries,
+	p.FinishProgress()
+	return nil
+}
 
-				KeyRef:            importConfig.Import.Cosign.KeyRef,
-				KeyRefPass:        *importConfig.Import.Cosign.KeyRefPass,
-				AllowInsecure:     importConfig.Import.Cosign.AllowInsecure,
-				AllowHTTPRegistry: importConfig.Import.Cosign.AllowHTTPRegistry,
+func analyzeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "analyze",
+		Short: "Find the images in the charts and report which charts and images are missing in the registries",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := load(cmd)
+			if err != nil {
+				return err
 			}
-			if err := signo.Run(); err != nil {
-				slog.Error("Error signing with Cosign")
+			if err := p.Analyze(cmd.Context()); err != nil {
 				return err
 			}
-		}
+			if err := p.Lineage(cmd.Context()); err != nil {
+				return err
+			}
+			return p.Licenses(cmd.Context())
+		},
 	}
+}
 
-	switch {
-	case importConfig.Import.Enabled && importConfig.Import.Copacetic.Enabled:
-		slog.Debug("Import enabled and Copacetic enabled")
-		patch := make([]*registry.Image, 0)
-		push := make([]*registry.Image, 0)
-
-		bar := progressbar.NewOptions(len(imgs), progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowCount(),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionSetWidth(15),
-			progressbar.OptionSetDescription("Scanning images before patching...\r"),
-			progressbar.OptionShowDescriptionAtLineEnd(),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}))
-
-		so := trivy.ScanOption{
-			DockerHost:    importConfig.Import.Copacetic.Buildkitd.Addr,
-			TrivyServer:   importConfig.Import.Copacetic.Trivy.Addr,
-			Insecure:      importConfig.Import.Copacetic.Trivy.Insecure,
-			IgnoreUnfixed: importConfig.Import.Copacetic.Trivy.IgnoreUnfixed,
-			Architecture:  importConfig.Import.Architecture,
-		}
-
-		for _, i := range imgs {
-
-			if i.Patch != nil {
-				if !*i.Patch {
-					ref, err := i.String()
-					if err != nil {
-						return err
-					}
-					slog.Debug("image should not be patched",
-						slog.String("image", ref))
-					push = append(push, &i)
-					continue
-				}
+func scanCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "scan",
+		Short: "Scan the images with Trivy and write the reports to the reports folder",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+			if err := requireCopacetic("scan", p); err != nil {
+				return err
 			}
+			if err := p.Analyze(cmd.Context()); err != nil {
+				return err
+			}
+			if err := p.Scan(cmd.Context()); err != nil {
+				return err
+			}
+			if err := p.WriteSARIF(cmd.Context()); err != nil {
+				return err
+			}
+			return p.Layout.WriteIndex()
+		},
+	}
+}
 
-			ref, err := i.String()
+func patchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "patch",
+		Short: "Scan the images, patch them with Copacetic and push the patched images to the registries",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
 			if err != nil {
 				return err
 			}
-			r, err := so.Scan(ref)
-			if err != nil {
+			if err := requireCopacetic("patch", p); err != nil {
 				return err
 			}
+			if err := p.OpenProgress(); err != nil {
+				return err
+			}
+			defer p.Cleanup()
 
-			switch copa.SupportedOS(r.Metadata.OS) {
-			case true:
-				// filter images with no os-pkgs as copa has nothing to do
-				switch trivy.ContainsOsPkgs(r.Results) {
-				case true:
-					slog.Debug("Image does contain os-pkgs vulnerabilities",
-						slog.String("image", ref))
-					patch = append(patch, &i)
-				case false:
-					slog.Warn("Image does not contain os-pkgs. The image will not be patched.",
-						slog.String("image", ref),
-					)
-					push = append(push, &i)
+			if err := p.Analyze(ctx); err != nil {
+				return err
+			}
+			if err := p.Scan(ctx); err != nil {
+				return err
+			}
+			if err := p.Patch(ctx); err != nil {
+				return err
+			}
+			if err := p.RunHooks(ctx, hooks.StagePatch); err != nil {
+				return err
+			}
+			if !p.DryRun {
+				if err := p.RecordState(ctx); err != nil {
+					return err
+				}
+				if err := p.Attest(ctx); err != nil {
+					return err
 				}
-
-			case false:
-				slog.Warn("Image contains an unsupported OS. The image will not be patched.",
-					slog.String("image", ref),
-				)
-				push = append(push, &i)
 			}
+			return finish(p)
+		},
+	}
+}
 
-			// Write report to filesystem
-			name, _ := i.ImageName()
-			fileName := fmt.Sprintf("%s:%s.json", name, i.Tag)
-			fileName = filepath.Join(importConfig.Import.Copacetic.Output.Reports.Folder, "prescan-"+strings.ReplaceAll(fileName, "/", "-"))
-			b, err := json.MarshalIndent(r, "", "  ")
+func importCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "import",
+		Short: "Push the charts and images to the registries without patching or signing",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
 			if err != nil {
 				return err
 			}
-			if err := os.WriteFile(fileName, b, os.ModePerm); err != nil {
+			if err := p.OpenProgress(); err != nil {
 				return err
 			}
 
-			_ = bar.Add(1)
-		}
-
-		_ = bar.Finish()
-
-		// determine fully qualified output path for images
-		reportFilePaths := make(map[*registry.Image]string)
-		reportPostFilePaths := make(map[*registry.Image]string)
-		outFilePaths := make(map[*registry.Image]string)
-		for _, i := range append(patch, push...) {
-			name, _ := i.ImageName()
-			fileName := fmt.Sprintf("prescan-%s:%s.json", name, i.Tag)
-			reportFilePaths[i] = filepath.Join(
-				importConfig.Import.Copacetic.Output.Reports.Folder,
-				strings.ReplaceAll(fileName, "/", "-"),
-			)
-			fileName = fmt.Sprintf("postscan-%s:%s.json", name, i.Tag)
-			reportPostFilePaths[i] = filepath.Join(
-				importConfig.Import.Copacetic.Output.Reports.Folder,
-				strings.ReplaceAll(fileName, "/", "-"),
-			)
-			out := fmt.Sprintf("%s:%s.tar", name, i.Tag)
-			outFilePaths[i] = filepath.Join(
-				importConfig.Import.Copacetic.Output.Tars.Folder,
-				strings.ReplaceAll(out, "/", "-"),
-			)
-		}
-
-		// Clean up files
-		defer func() {
-			if importConfig.Import.Copacetic.Output.Reports.Clean {
-				for _, v := range reportFilePaths {
-					_ = os.RemoveAll(v)
+			if err := p.Analyze(ctx); err != nil {
+				return err
+			}
+			if err := p.VerifySources(ctx); err != nil {
+				return err
+			}
+			if !p.ChartsAfterImages() {
+				if err := p.ImportCharts(ctx); err != nil {
+					return err
 				}
-				for _, v := range reportPostFilePaths {
-					_ = os.RemoveAll(v)
+			}
+			if err := p.ImportImages(ctx); err != nil {
+				return err
+			}
+			if p.ChartsAfterImages() {
+				if err := p.ImportCharts(ctx); err != nil {
+					return err
 				}
 			}
-			if importConfig.Import.Copacetic.Output.Reports.Clean {
-				for _, v := range outFilePaths {
-					_ = os.RemoveAll(v)
+			if err := p.RunHooks(ctx, hooks.StageImport); err != nil {
+				return err
+			}
+			if !p.DryRun {
+				if err := p.WriteLock(ctx); err != nil {
+					return err
+				}
+				if err := p.RecordState(ctx); err != nil {
+					return err
+				}
+				if err := p.Attest(ctx); err != nil {
+					return err
 				}
 			}
-		}()
-
-		// Import images without os-pkgs vulnerabilities
-		iOpts := registry.ImportOption{
-			Registries:   registries,
-			Imgs:         push,
-			All:          all,
-			Architecture: importConfig.Import.Architecture,
-		}
-		err = iOpts.Run(ctx)
-		if err != nil {
-			return err
-		}
+			return finish(p)
+		},
+	}
+}
 
-		// Patch image and save to tar
-		po := copa.PatchOption{
-			Imgs:       patch,
-			Registries: registries,
-			Buildkit: struct {
-				Addr       string
-				CACertPath string
-				CertPath   string
-				KeyPath    string
-			}{
-				Addr:       importConfig.Import.Copacetic.Buildkitd.Addr,
-				CACertPath: importConfig.Import.Copacetic.Buildkitd.CACertPath,
-				CertPath:   importConfig.Import.Copacetic.Buildkitd.CertPath,
-				KeyPath:    importConfig.Import.Copacetic.Buildkitd.KeyPath,
-			},
-			IgnoreErrors: importConfig.Import.Copacetic.IgnoreErrors,
-			Architecture: importConfig.Import.Architecture,
-		}
-		err = po.Run(ctx, reportFilePaths, outFilePaths)
-		if err != nil {
-			return err
-		}
+func signCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sign",
+		Short: "Sign the charts and images in the registries with Cosign or Notation",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+			if err := requireSigner("sign", p); err != nil {
+				return err
+			}
+			if err := p.OpenProgress(); err != nil {
+				return err
+			}
 
-		bar = progressbar.NewOptions(len(imgs), progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowCount(),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetRenderBlankState(true),
-			progressbar.OptionSetWidth(15),
-			progressbar.OptionSetDescription("Scanning images after patching...\r"),
-			progressbar.OptionShowDescriptionAtLineEnd(),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}))
-		err = func(out string, prefix string) error {
-			for _, i := range imgs {
-				ref, _ := i.String()
-				r, err := so.Scan(ref)
-				if err != nil {
+			// re-sign imported artifacts without analyzing the charts again
+			if path, _ := cmd.Flags().GetString("from-lock"); path != "" {
+				if err := p.SignFromLock(ctx, path); err != nil {
+					return err
+				}
+				if err := p.RunHooks(ctx, hooks.StageSign); err != nil {
 					return err
 				}
+				if !p.DryRun {
+					if err := p.Attest(ctx); err != nil {
+						return err
+					}
+				}
+				return finish(p)
+			}
 
-				// Write report to filesystem
-				name, _ := i.ImageName()
-				fileName := fmt.Sprintf("%s:%s.json", name, i.Tag)
-				fileName = filepath.Join(out, prefix+strings.ReplaceAll(fileName, "/", "-"))
-				b, err := json.MarshalIndent(r, "", "  ")
-				if err != nil {
+			if err := p.Analyze(ctx); err != nil {
+				return err
+			}
+			if err := p.SignCharts(ctx); err != nil {
+				return err
+			}
+			if err := p.SignImages(ctx); err != nil {
+				return err
+			}
+			if err := p.RunHooks(ctx, hooks.StageSign); err != nil {
+				return err
+			}
+			if !p.DryRun {
+				if err := p.RecordState(ctx); err != nil {
 					return err
 				}
-				if err := os.WriteFile(fileName, b, os.ModePerm); err != nil {
+				if err := p.Attest(ctx); err != nil {
 					return err
 				}
-
-				_ = bar.Add(1)
 			}
-			return nil
-		}(importConfig.Import.Copacetic.Output.Reports.Folder, "postscan-")
-		if err != nil {
-			return err
-		}
-
-		_ = bar.Finish()
+			return finish(p)
+		},
+	}
+	cmd.Flags().String("from-lock", "", "sign the charts and images pinned in this lockfile by digest, without analyzing, copying or scanning them")
+	return cmd
+}
 
-		if importConfig.Import.Cosign.Enabled {
-			signo := mySign.SignOption{
-				Imgs:       append(patch, push...),
-				Registries: registries,
+func warmCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "warm",
+		Short: "Pull the images through the pull-through caches proxying their registries, without pushing them anywhere",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+			if len(p.Caches) == 0 {
+				s := `
+caches:             <---
+  - name: dockerhub
+    url: harbor.internal/dockerhub
+    upstream: docker.io
+`
+				return xerrors.Errorf("The warm command requires pull-through caches. Please add the caches and try again..\nExample config:\n%s", s)
+			}
 
-				KeyRef:            importConfig.Import.Cosign.KeyRef,
-				KeyRefPass:        *importConfig.Import.Cosign.KeyRefPass,
-				AllowInsecure:     importConfig.Import.Cosign.AllowInsecure,
-				AllowHTTPRegistry: importConfig.Import.Cosign.AllowHTTPRegistry,
+			if err := p.Analyze(ctx); err != nil {
+				return err
 			}
-			if err := signo.Run(); err != nil {
+			if err := p.Warm(ctx); err != nil {
 				return err
 			}
-		}
-
-	case importConfig.Import.Enabled:
-		slog.Debug("Only import enabled")
-		// convert to pointer array to enable mutable values
-		imgPs := make([]*registry.Image, 0)
-		for _, i := range imgs {
-			imgPs = append(imgPs, &i)
-		}
-
-		err := registry.ImportOption{
-			Registries:   registries,
-			Imgs:         imgPs,
-			All:          all,
-			Architecture: importConfig.Import.Architecture,
-		}.Run(ctx)
-		if err != nil {
-			return err
-		}
+			return p.Finish()
+		},
+	}
+}
 
-		if importConfig.Import.Cosign.Enabled {
-			signo := mySign.SignOption{
-				Imgs:       imgPs,
-				Registries: registries,
+func verifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Lint and render the imported charts using only the charts and images in the registries, and run 'helm test' in a cluster if configured",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx := cmd.Context()
+			p, err := load(cmd)
+			if err != nil {
+				return err
+			}
+			if err := p.Analyze(ctx); err != nil {
+				return err
+			}
+			if err := p.Verify(ctx); err != nil {
+				return err
+			}
+			return p.Finish()
+		},
+	}
+}
 
-				KeyRef:            importConfig.Import.Cosign.KeyRef,
-				KeyRefPass:        *importConfig.Import.Cosign.KeyRefPass,
-				AllowInsecure:     importConfig.Import.Cosign.AllowInsecure,
-				AllowHTTPRegistry: importConfig.Import.Cosign.AllowHTTPRegistry,
+func rootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "helmper",
+		Short: "Import Helm charts and their images into OCI registries",
+		Long:  "Helmper imports Helm charts and the images they reference into OCI registries. Without a subcommand, all stages enabled in the configuration are run.",
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {
+			setupLogger()
+			output.Header(version.Get())
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			p, err := load(cmd)
+			if err != nil {
+				return err
 			}
-			if err := signo.Run(); err != nil {
+			if len(p.Groups) > 0 {
+				_, err := runGroups(cmd.Context(), p)
 				return err
 			}
-		}
+			return p.Run(cmd.Context())
+		},
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
+	root.PersistentFlags().String("f", "unused", "path to configuration file")
+	root.PersistentFlags().Bool("dry-run", false, "report planned actions without writing to any registry")
+	root.PersistentFlags().String("dry-run-script", "", "write shell commands equivalent to the planned actions to this path ('-' for stdout). Implies --dry-run")
+	root.PersistentFlags().StringToString("var", nil, "set a variable the 'when' conditions of the charts are evaluated against, e.g. --var cni=cilium. Overrides 'variables' in the configuration")
+	root.PersistentFlags().String("events", "", "emit progress events as JSON lines to this path, a Unix socket ('unix:///path') or stderr ('-')")
+	root.PersistentFlags().Bool("resume", false, "continue a failed run from the progress file, skipping the images it already pushed, patched and signed")
+	root.PersistentFlags().Bool("image-sizes", false, "fetch the sizes of the images from the source registries, and show them by chart and by layer in the overview")
+	root.PersistentFlags().String("report", "", "write a machine-readable report of the run to this path, as YAML for .yaml and .yml files and JSON otherwise")
+
+	root.AddCommand(
+		analyzeCmd(),
+		scanCmd(),
+		patchCmd(),
+		importCmd(),
+		signCmd(),
+		warmCmd(),
+		verifyCmd(),
+		exportCmd(),
+		batchCmd(),
+		watchCmd(),
+		loadCmd(),
+		statusCmd(),
+		standbyCmd(),
+		scanClusterCmd(),
+		serveCmd(),
+		lockCmd(),
+		cveCmd(),
+		versionCmd(),
+	)
 
-	return nil
+	return root
+}
+
+func Program(args []string) error {
+	root := rootCmd()
+	root.SetArgs(args)
+	r := &reported{}
+	err := root.ExecuteContext(context.WithValue(context.TODO(), reportKey{}, r))
+	if r.p != nil {
+		if rerr := r.p.WriteRunReport(err); rerr != nil {
+			slog.Warn("could not write run report", slog.String("error", rerr.Error()))
+		}
+	}
+	stopTracing(err)
+	closeEvents()
+	return err
 }
@@ -0,0 +1,426 @@
+package internal
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// States of the runs submitted to the REST API
+const (
+	runQueued    = "queued"
+	runRunning   = "running"
+	runSucceeded = "succeeded"
+	runFailed    = "failed"
+)
+
+// apiRun is a run submitted to the REST API of 'helmper serve'
+type apiRun struct {
+	ID        string     `json:"id"`
+	Status    string     `json:"status"`
+	Charts    []string   `json:"charts"`
+	DryRun    bool       `json:"dryRun"`
+	Submitted time.Time  `json:"submitted"`
+	Started   *time.Time `json:"started,omitempty"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Error     string     `json:"error,omitempty"`
+
+	viper  *viper.Viper
+	report *pipeline.RunReport
+	log    *eventLog
+}
+
+// runRequest submits charts in the format of 'charts' in the configuration file
+type runRequest struct {
+	Charts []map[string]any `json:"charts"`
+	DryRun bool             `json:"dryRun"`
+}
+
+// server runs the charts submitted to the REST API with the configuration file, one run at a time
+type server struct {
+	// config is the configuration file whose charts are replaced by the submitted charts
+	config  string
+	flags   *pflag.FlagSet
+	token   string
+	history int
+	// run runs all stages enabled in the configuration, emitting the progress events of the run, and reports the result
+	run func(ctx context.Context, v *viper.Viper, e *events.Emitter) (pipeline.RunReport, error)
+
+	mu    sync.Mutex
+	runs  []*apiRun
+	ids   int
+	queue chan *apiRun
+}
+
+func newServer(config string, flags *pflag.FlagSet, c bootstrap.ServeConfigSection) *server {
+	return &server{
+		config:  config,
+		flags:   flags,
+		token:   c.Token,
+		history: c.History,
+		run:     runPipeline,
+		queue:   make(chan *apiRun, 100),
+	}
+}
+
+// runPipeline runs all stages enabled in the configuration, like helmper without a subcommand
+func runPipeline(ctx context.Context, v *viper.Viper, e *events.Emitter) (pipeline.RunReport, error) {
+	p := pipeline.New(v)
+	p.Command = "helmper serve"
+	p.Events = e
+	var err error
+	if len(p.Groups) > 0 {
+		_, err = runGroups(ctx, p)
+	} else {
+		err = p.Run(ctx)
+	}
+	r, rerr := p.RunReport(err)
+	if rerr != nil {
+		slog.Warn("could not report run", slog.String("error", rerr.Error()))
+	}
+	return r, err
+}
+
+// configure loads the configuration file with the charts of the request, validating the charts like the configuration file
+func (s *server) configure(req runRequest) (*viper.Viper, error) {
+	b, err := os.ReadFile(s.config)
+	if err != nil {
+		return nil, err
+	}
+	conf := map[string]any{}
+	if err := yaml.Unmarshal(b, &conf); err != nil {
+		return nil, err
+	}
+	conf["charts"] = req.Charts
+	b, err = yaml.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.CreateTemp("", "helmper-serve-*.yaml")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	v, err := bootstrap.LoadViperConfigurationFile(s.flags, f.Name())
+	if err != nil {
+		return nil, err
+	}
+	if req.DryRun {
+		v.Set("dry-run", true)
+	}
+	return v, nil
+}
+
+// get returns the run with the id
+func (s *server) get(id string) (*apiRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.runs {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// update changes the run under the lock, so handlers see a consistent run
+func (s *server) update(r *apiRun, f func(r *apiRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f(r)
+}
+
+// prune removes the oldest finished runs beyond the history
+func (s *server) prune() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finished := 0
+	for _, r := range s.runs {
+		if r.Finished != nil {
+			finished++
+		}
+	}
+	kept := s.runs[:0]
+	for _, r := range s.runs {
+		if r.Finished != nil && finished > s.history {
+			finished--
+			continue
+		}
+		kept = append(kept, r)
+	}
+	s.runs = kept
+}
+
+// work runs the queued runs one at a time until the context is cancelled
+func (s *server) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-s.queue:
+			start := time.Now().UTC()
+			s.update(r, func(r *apiRun) { r.Status, r.Started = runRunning, &start })
+			slog.Info("api run started", slog.String("run", r.ID))
+
+			report, err := s.run(ctx, r.viper, events.Func(r.log.add))
+
+			end := time.Now().UTC()
+			s.update(r, func(r *apiRun) {
+				r.Finished, r.report, r.viper = &end, &report, nil
+				r.Status = runSucceeded
+				if err != nil {
+					r.Status, r.Error = runFailed, err.Error()
+				}
+			})
+			r.log.finish()
+			if err != nil {
+				slog.Error("api run failed", slog.String("run", r.ID), slog.String("error", err.Error()))
+			} else {
+				slog.Info("api run completed", slog.String("run", r.ID), slog.Duration("duration", end.Sub(start)))
+			}
+			s.prune()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// bearer reports whether the authorization header carries the token, in constant time so the token can not be guessed byte by byte
+func bearer(authorization string, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(authorization), []byte("Bearer "+token)) == 1
+}
+
+// loopback reports whether the address only listens on the loopback interface
+func loopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// authorize requires the bearer token on every request, if a token is configured
+func (s *server) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && !bearer(r.Header.Get("Authorization"), s.token) {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// errQueueFull is returned for runs submitted while too many runs are queued
+var errQueueFull = errors.New("too many queued runs")
+
+// enqueue validates the request and queues its run. Invalid requests are rejected with the reason, and runs over the capacity of the queue with errQueueFull
+func (s *server) enqueue(rr runRequest) (apiRun, error) {
+	if len(rr.Charts) == 0 {
+		return apiRun{}, errors.New("the run request has no charts")
+	}
+	v, err := s.configure(rr)
+	if err != nil {
+		return apiRun{}, err
+	}
+
+	r := &apiRun{Status: runQueued, Charts: []string{}, DryRun: rr.DryRun, Submitted: time.Now().UTC(), viper: v, log: newEventLog()}
+	for _, c := range rr.Charts {
+		r.Charts = append(r.Charts, fmt.Sprintf("%v:%v", c["name"], c["version"]))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- r:
+		s.ids++
+		r.ID = strconv.Itoa(s.ids)
+		s.runs = append(s.runs, r)
+	default:
+		return apiRun{}, errQueueFull
+	}
+	slog.Info("api run queued", slog.String("run", r.ID), slog.Any("charts", r.Charts))
+	return *r, nil
+}
+
+func (s *server) submit(w http.ResponseWriter, req *http.Request) {
+	var rr runRequest
+	if err := json.NewDecoder(req.Body).Decode(&rr); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid run request: %w", err))
+		return
+	}
+	r, err := s.enqueue(rr)
+	switch {
+	case errors.Is(err, errQueueFull):
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/runs/"+r.ID)
+	writeJSON(w, http.StatusAccepted, r)
+}
+
+func (s *server) list(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	rs := make([]apiRun, 0, len(s.runs))
+	for _, r := range s.runs {
+		rs = append(rs, *r)
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, rs)
+}
+
+func (s *server) status(w http.ResponseWriter, req *http.Request) {
+	r, ok := s.get(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", req.PathValue("id")))
+		return
+	}
+	s.mu.Lock()
+	res := *r
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *server) report(w http.ResponseWriter, req *http.Request) {
+	r, ok := s.get(req.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %s not found", req.PathValue("id")))
+		return
+	}
+	s.mu.Lock()
+	report := r.report
+	s.mu.Unlock()
+	if report == nil {
+		writeError(w, http.StatusConflict, fmt.Errorf("run %s has not finished", r.ID))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handler routes the endpoints of the REST API
+func (s *server) handler() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("POST /api/v1/runs", s.submit)
+	api.HandleFunc("GET /api/v1/runs", s.list)
+	api.HandleFunc("GET /api/v1/runs/{id}", s.status)
+	api.HandleFunc("GET /api/v1/runs/{id}/report", s.report)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.Handle("/api/", s.authorize(api))
+	return mux
+}
+
+func serveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve a REST API, and optionally a gRPC API, to submit charts, query the status of runs, fetch their reports and stream their progress",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			v, err := bootstrap.LoadViperConfiguration(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			c := state.GetValue[bootstrap.ServeConfigSection](v, "serveConfig")
+			if cmd.Flags().Changed("address") {
+				c.Address, _ = cmd.Flags().GetString("address")
+			}
+			if cmd.Flags().Changed("grpc-address") {
+				c.GRPCAddress, _ = cmd.Flags().GetString("grpc-address")
+			}
+
+			// without a token anyone reaching the address can run charts, so only the loopback interface is served
+			for _, a := range []string{c.Address, c.GRPCAddress} {
+				if a != "" && c.Token == "" && !loopback(a) {
+					return fmt.Errorf("internal: serve.token is required to listen on %s. Set a token, or listen on 127.0.0.1", a)
+				}
+			}
+
+			s := newServer(v.ConfigFileUsed(), cmd.Flags(), c)
+			go s.work(ctx)
+
+			if c.GRPCAddress != "" {
+				l, err := net.Listen("tcp", c.GRPCAddress)
+				if err != nil {
+					return fmt.Errorf("internal: error listening on %s :: %w", c.GRPCAddress, err)
+				}
+				gs := s.newGRPCServer()
+				go func() {
+					<-ctx.Done()
+					gs.GracefulStop()
+				}()
+				go func() {
+					slog.Info("serving gRPC API", slog.String("address", c.GRPCAddress))
+					if err := gs.Serve(l); err != nil {
+						slog.Error("gRPC API stopped", slog.String("error", err.Error()))
+					}
+				}()
+			}
+
+			srv := &http.Server{Addr: c.Address, Handler: s.handler(), ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				<-ctx.Done()
+				sctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				_ = srv.Shutdown(sctx)
+			}()
+
+			slog.Info("serving REST API", slog.String("address", c.Address), slog.Bool("authenticated", c.Token != ""))
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return fmt.Errorf("internal: error serving REST API :: %w", err)
+			}
+			slog.Info("REST API stopped")
+			return nil
+		},
+	}
+	cmd.Flags().String("address", "127.0.0.1:8080", "address the REST API listens on. Overrides 'serve.address' in the configuration")
+	cmd.Flags().String("grpc-address", "", "address the gRPC API listens on, e.g. '127.0.0.1:9090'. Overrides 'serve.grpcAddress' in the configuration")
+	return cmd
+}
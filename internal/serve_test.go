@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/pipeline"
+	"github.com/ChristofferNissen/helmper/pkg/events"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestServe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.yaml")
+	if err := os.WriteFile(path, []byte(`
+charts:
+- name: loki
+  version: 5.38.0
+  repo:
+    name: grafana
+    url: https://grafana.github.io/helm-charts/
+registries:
+- name: registry
+  url: localhost:5000
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(path, pflag.NewFlagSet("test", pflag.ContinueOnError), bootstrap.ServeConfigSection{Token: "secret", History: 1})
+	var got helm.ChartCollection
+	s.run = func(_ context.Context, v *viper.Viper, _ *events.Emitter) (pipeline.RunReport, error) {
+		got = state.GetValue[helm.ChartCollection](v, "input")
+		return pipeline.RunReport{Charts: []pipeline.ChartResult{{Name: "prometheus", Status: "imported"}}}, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.work(ctx)
+	srv := httptest.NewServer(s.handler())
+	defer srv.Close()
+
+	do := func(method, path, body string) *http.Response {
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer secret")
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res, _ := http.Get(srv.URL + "/api/v1/runs"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want 401 without token got %d", res.StatusCode)
+	}
+	if res := do(http.MethodPost, "/api/v1/runs", `{"charts": []}`); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("want 400 without charts got %d", res.StatusCode)
+	}
+
+	res := do(http.MethodPost, "/api/v1/runs", `{"charts": [{"name": "prometheus", "version": "25.8.0", "repo": {"name": "prometheus-community", "url": "https://prometheus-community.github.io/helm-charts/"}}]}`)
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("want 202 got %d", res.StatusCode)
+	}
+	var r apiRun
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != "1" || r.Charts[0] != "prometheus:25.8.0" {
+		t.Errorf("unexpected run %+v", r)
+	}
+
+	for i := 0; r.Status != runSucceeded; i++ {
+		if i == 50 {
+			t.Fatalf("run did not finish: %+v", r)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := json.NewDecoder(do(http.MethodGet, "/api/v1/runs/1", "").Body).Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(got.Charts) != 1 || got.Charts[0].Name != "prometheus" {
+		t.Errorf("want the submitted charts in the configuration got %+v", got.Charts)
+	}
+
+	var report pipeline.RunReport
+	if err := json.NewDecoder(do(http.MethodGet, "/api/v1/runs/1/report", "").Body).Decode(&report); err != nil || len(report.Charts) != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if res := do(http.MethodGet, "/api/v1/runs/2", ""); res.StatusCode != http.StatusNotFound {
+		t.Errorf("want 404 for unknown run got %d", res.StatusCode)
+	}
+}
+
+func TestLoopback(t *testing.T) {
+	for address, want := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"localhost:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.4:9090":  false,
+	} {
+		if got := loopback(address); got != want {
+			t.Errorf("%s: want %v got %v", address, want, got)
+		}
+	}
+	if !bearer("Bearer s3cret", "s3cret") || bearer("Bearer s3cre", "s3cret") || bearer("", "s3cret") {
+		t.Error("unexpected bearer comparison")
+	}
+}
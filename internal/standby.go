@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func standbyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "standby",
+		Short: "Verify that the standby registry mirrors every chart and image of the lockfile like the primary registry, without importing anything",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return standby(ctx, cmd)
+		},
+	}
+	cmd.Flags().Bool("watch", false, "keep running and verify the standby registry on the schedule in the configuration")
+	return cmd
+}
+
+// standby verifies the standby registry, once or on the schedule with --watch. Drift found by scheduled verifications is alerted, and does not stop the following verifications
+func standby(ctx context.Context, cmd *cobra.Command) error {
+	p, err := load(cmd)
+	if err != nil {
+		return err
+	}
+	switch {
+	case p.StandbyConfig.Mirror.URL == "":
+		s := `
+standby:
+  registry:          <---
+    name: dr
+    url: dr.registry.io
+`
+		return xerrors.Errorf("The standby command requires a standby registry. Please add the registry and try again..\nExample config:\n%s", s)
+	case p.LockPath == "" || len(p.Registries) == 0:
+		s := `
+lockfile: helmper.lock  <---
+registries:             <---
+  - name: primary
+    url: registry.io
+`
+		return xerrors.Errorf("The standby command compares the standby registry to the digests of the primary registry in the lockfile. Please add the lockfile and the registries and try again..\nExample config:\n%s", s)
+	}
+
+	watch, _ := cmd.Flags().GetBool("watch")
+	if !watch {
+		return p.Standby(ctx)
+	}
+	if p.StandbyConfig.Schedule == "" && p.StandbyConfig.Interval <= 0 {
+		s := `
+standby:
+  schedule: "*/30 * * * *"  <--- or
+  interval: 30m             <---
+`
+		return xerrors.Errorf("The standby command with --watch requires a schedule. Please specify a cron expression or an interval and try again..\nExample config:\n%s", s)
+	}
+
+	for run := 1; ; run++ {
+		// the configuration and the lockfile are read again, so changes take effect on the next verification.
+		// The previous configuration is kept if it can not be read
+		if run > 1 {
+			if np, err := load(cmd); err != nil {
+				slog.Error("could not reload configuration", slog.Int("run", run), slog.String("error", err.Error()))
+			} else {
+				p = np
+			}
+		}
+		if err := p.Standby(ctx); err != nil {
+			slog.Error("standby verification failed", slog.Int("run", run), slog.String("error", err.Error()))
+		}
+
+		next, err := p.StandbyConfig.Next(time.Now())
+		if err != nil {
+			return err
+		}
+		slog.Info("next standby verification scheduled", slog.Time("at", next))
+
+		select {
+		case <-ctx.Done():
+			slog.Info("standby watch stopped")
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
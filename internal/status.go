@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/internal/output"
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/store"
+	"github.com/ChristofferNissen/helmper/pkg/util/file"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+	"oras.land/oras-go/v2/errdef"
+)
+
+// records the lockfile expects to be present in the registries. Charts and images without a digest in a registry were routed
+// away from it, e.g. pre-releases kept out of a release registry, so they are not expected there
+func expectedRecords(l *lock.Lock, registries []registry.Registry) []store.Record {
+	rs := []store.Record{}
+	for _, r := range registries {
+		for _, c := range l.Charts {
+			if c.Digests[r.URL] == "" {
+				continue
+			}
+			rs = append(rs, store.Record{
+				Kind:      store.Chart,
+				Registry:  r.URL,
+				Name:      fmt.Sprintf("charts/%s", c.Name),
+				Reference: registry.OCITag(c.Version),
+				Digest:    c.Digests[r.URL],
+				Source:    c.Repo,
+			})
+		}
+		for _, i := range l.Images {
+			if i.Digests[r.URL] == "" {
+				continue
+			}
+			rs = append(rs, store.Record{
+				Kind:      store.Image,
+				Registry:  r.URL,
+				Name:      i.Name,
+				Reference: i.Tag,
+				Digest:    i.Digests[r.URL],
+				Source:    i.Source,
+			})
+		}
+	}
+	return rs
+}
+
+func resolver(registries []registry.Registry) store.Resolver {
+	m := make(map[string]registry.Registry, len(registries))
+	for _, r := range registries {
+		m[r.URL] = r
+	}
+
+	return func(ctx context.Context, rec store.Record) (string, bool, error) {
+		r, ok := m[rec.Registry]
+		if !ok {
+			slog.Warn("registry of record is not configured. skipping check", slog.String("registry", rec.Registry), slog.String("name", rec.Name))
+			return rec.Digest, true, nil
+		}
+
+		d, err := r.Fetch(ctx, rec.Name, rec.Reference)
+		switch {
+		case errors.Is(err, errdef.ErrNotFound):
+			return "", false, nil
+		case err != nil:
+			return "", false, fmt.Errorf("internal: error resolving %s/%s:%s :: %w", rec.Registry, rec.Name, rec.Reference, err)
+		}
+
+		return d.Digest.String(), true, nil
+	}
+}
+
+func statusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Cross-check the state store, the lockfile and the registries and report inconsistencies",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return status(cmd)
+		},
+	}
+	cmd.Flags().Bool("repair", false, "repair inconsistencies found in the state store")
+	return cmd
+}
+
+// status cross-checks the state store, the lockfile and the registries and reports inconsistencies
+func status(cmd *cobra.Command) error {
+	ctx := cmd.Context()
+
+	viper, err := bootstrap.LoadViperConfiguration(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	var (
+		registries  []registry.Registry          = state.GetValue[[]registry.Registry](viper, "registries")
+		lockPath    string                       = state.GetValue[string](viper, "lockfile")
+		stateConfig bootstrap.StateConfigSection = state.GetValue[bootstrap.StateConfigSection](viper, "stateConfig")
+		repair      bool                         = state.GetValue[bool](viper, "repair")
+	)
+
+	if !stateConfig.Enabled() {
+		s := `
+state:
+  path: /workspace/.out/state.json  <---
+`
+		return xerrors.Errorf("The status command requires a state store. Please specify the path to the state store and try again..\nExample config:\n%s", s)
+	}
+
+	s, err := stateConfig.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	expected := []store.Record{}
+	if lockPath != "" && file.Exists(lockPath) {
+		l, err := lock.Load(lockPath)
+		if err != nil {
+			return err
+		}
+		expected = expectedRecords(l, registries)
+	}
+
+	is, err := s.Reconcile(ctx, expected, resolver(registries))
+	if err != nil {
+		return err
+	}
+	output.RenderStatusTable(is)
+
+	if !repair {
+		if len(is) > 0 {
+			slog.Info("state store is inconsistent with registries. Run with --repair to update the state store", slog.Int("count", len(is)))
+		}
+		return nil
+	}
+
+	count := s.Repair(is)
+	if err := s.Save(); err != nil {
+		return err
+	}
+	slog.Info("repaired state store", slog.Int("repaired", count), slog.Int("unrepairable", len(is)-count))
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/lock"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestExpectedRecords(t *testing.T) {
+	l := &lock.Lock{
+		Charts: []lock.Chart{
+			{Name: "prometheus", Version: "25.0.0", Digests: map[string]string{"oci://prod": "sha256:a", "oci://dev": "sha256:a"}},
+			{Name: "prometheus", Version: "25.1.0-rc.1", Digests: map[string]string{"oci://dev": "sha256:b"}},
+		},
+		Images: []lock.Image{
+			{Name: "library/nginx", Tag: "1.25", Digests: map[string]string{"oci://prod": "sha256:c", "oci://dev": "sha256:c"}},
+		},
+	}
+	rs := expectedRecords(l, []registry.Registry{{URL: "oci://prod"}, {URL: "oci://dev"}})
+
+	// the pre-release was routed away from prod, so it is only expected in dev
+	if len(rs) != 5 {
+		t.Fatalf("want 5 records got %d: %+v", len(rs), rs)
+	}
+	for _, r := range rs {
+		if r.Registry == "oci://prod" && r.Reference == "25.1.0-rc.1" {
+			t.Errorf("want the pre-release not expected in prod got %+v", r)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracing is the span of the command and the shutdown of the tracer provider, when tracing is enabled
+var tracing struct {
+	span     trace.Span
+	shutdown func(context.Context) error
+}
+
+// startTracing sets up tracing, if enabled, and starts the span of the command all stages are traced under
+func startTracing(cmd *cobra.Command, v *viper.Viper) error {
+	c := state.GetValue[bootstrap.TracingConfigSection](v, "tracingConfig")
+	if !c.Enabled || tracing.shutdown != nil {
+		return nil
+	}
+
+	shutdown, err := bootstrap.SetupTracing(cmd.Context(), c)
+	if err != nil {
+		return err
+	}
+	tracing.shutdown = shutdown
+
+	ctx, span := otel.Tracer("github.com/ChristofferNissen/helmper/internal").Start(cmd.Context(), cmd.CommandPath())
+	tracing.span = span
+	cmd.SetContext(ctx)
+	return nil
+}
+
+// stopTracing ends the span of the command with its error and flushes the spans to the OTLP endpoint
+func stopTracing(err error) {
+	if tracing.shutdown == nil {
+		return
+	}
+	if err != nil {
+		tracing.span.RecordError(err)
+		tracing.span.SetStatus(codes.Error, err.Error())
+	}
+	tracing.span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := tracing.shutdown(ctx); err != nil {
+		slog.Warn("could not export traces", slog.String("error", err.Error()))
+	}
+}
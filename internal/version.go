@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+func versionCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Print the version of Helmper",
+		// print version without header, so the output can be parsed
+		PersistentPreRun: func(_ *cobra.Command, _ []string) {},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			asJSON, err := cmd.Flags().GetBool("json")
+			if err != nil {
+				return err
+			}
+			return printVersion(asJSON)
+		},
+	}
+	cmd.Flags().Bool("json", false, "print version information as JSON")
+	return cmd
+}
+
+// printVersion prints the version of Helmper. With asJSON the build information is printed as JSON
+func printVersion(asJSON bool) error {
+	i := version.Get()
+	if !asJSON {
+		fmt.Println(i.String())
+		return nil
+	}
+
+	b, err := i.JSON()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
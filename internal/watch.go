@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/internal/bootstrap"
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/util/state"
+	"github.com/spf13/cobra"
+	"golang.org/x/xerrors"
+)
+
+func watchCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "watch",
+		Short: "Keep running and re-run all stages enabled in the configuration on the schedule in the configuration",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			return watch(ctx, cmd)
+		},
+	}
+}
+
+// watch runs the pipeline on the schedule until the context is cancelled. Failed runs are logged, and do not stop the following runs
+func watch(ctx context.Context, cmd *cobra.Command) error {
+	viper, err := bootstrap.LoadViperConfiguration(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	w := state.GetValue[bootstrap.WatchConfigSection](viper, "watchConfig")
+	if w.Schedule == "" && w.Interval <= 0 {
+		s := `
+watch:
+  schedule: "0 */6 * * *"  <--- or
+  interval: 6h             <---
+`
+		return xerrors.Errorf("The watch command requires a schedule. Please specify a cron expression or an interval and try again..\nExample config:\n%s", s)
+	}
+
+	for run := 1; ; run++ {
+		start := time.Now()
+		slog.Info("watch run started", slog.Int("run", run))
+
+		// the configuration is read again, so changes take effect on the next run
+		p, err := load(cmd)
+		if err == nil {
+			// chart version ranges are resolved against the latest repository indexes
+			p.Opts = append(p.Opts, helm.Update(true))
+			if len(p.Groups) > 0 {
+				_, err = runGroups(ctx, p)
+			} else {
+				err = p.Run(ctx)
+			}
+		}
+		if err != nil {
+			slog.Error("watch run failed", slog.Int("run", run), slog.String("error", err.Error()))
+		} else {
+			slog.Info("watch run completed", slog.Int("run", run), slog.Duration("duration", time.Since(start)))
+		}
+
+		next, err := w.Next(time.Now())
+		if err != nil {
+			return err
+		}
+		slog.Info("next watch run scheduled", slog.Time("at", next))
+
+		select {
+		case <-ctx.Done():
+			slog.Info("watch stopped")
+			return nil
+		case <-time.After(time.Until(next)):
+		}
+	}
+}
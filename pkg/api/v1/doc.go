@@ -0,0 +1,6 @@
+/*
+Package apiv1 is the gRPC API of 'helmper serve', generated from helmper.proto with protoc-gen-go and protoc-gen-go-grpc.
+*/
+package apiv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative helmper.proto
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.1
+// source: helmper.proto
+
+package apiv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RunService_SubmitRun_FullMethodName = "/helmper.v1.RunService/SubmitRun"
+	RunService_GetRun_FullMethodName    = "/helmper.v1.RunService/GetRun"
+	RunService_WatchRun_FullMethodName  = "/helmper.v1.RunService/WatchRun"
+)
+
+// RunServiceClient is the client API for RunService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RunService runs charts with the configuration of 'helmper serve' and streams the progress of the runs
+type RunServiceClient interface {
+	// SubmitRun queues a run of the charts
+	SubmitRun(ctx context.Context, in *SubmitRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// GetRun returns the status of a run
+	GetRun(ctx context.Context, in *GetRunRequest, opts ...grpc.CallOption) (*Run, error)
+	// WatchRun streams the progress events of a run from its start, and ends when the run has finished
+	WatchRun(ctx context.Context, in *WatchRunRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error)
+}
+
+type runServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRunServiceClient(cc grpc.ClientConnInterface) RunServiceClient {
+	return &runServiceClient{cc}
+}
+
+func (c *runServiceClient) SubmitRun(ctx context.Context, in *SubmitRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, RunService_SubmitRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runServiceClient) GetRun(ctx context.Context, in *GetRunRequest, opts ...grpc.CallOption) (*Run, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Run)
+	err := c.cc.Invoke(ctx, RunService_GetRun_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *runServiceClient) WatchRun(ctx context.Context, in *WatchRunRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Event], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RunService_ServiceDesc.Streams[0], RunService_WatchRun_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRunRequest, Event]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RunService_WatchRunClient = grpc.ServerStreamingClient[Event]
+
+// RunServiceServer is the server API for RunService service.
+// All implementations must embed UnimplementedRunServiceServer
+// for forward compatibility.
+//
+// RunService runs charts with the configuration of 'helmper serve' and streams the progress of the runs
+type RunServiceServer interface {
+	// SubmitRun queues a run of the charts
+	SubmitRun(context.Context, *SubmitRunRequest) (*Run, error)
+	// GetRun returns the status of a run
+	GetRun(context.Context, *GetRunRequest) (*Run, error)
+	// WatchRun streams the progress events of a run from its start, and ends when the run has finished
+	WatchRun(*WatchRunRequest, grpc.ServerStreamingServer[Event]) error
+	mustEmbedUnimplementedRunServiceServer()
+}
+
+// UnimplementedRunServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRunServiceServer struct{}
+
+func (UnimplementedRunServiceServer) SubmitRun(context.Context, *SubmitRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitRun not implemented")
+}
+func (UnimplementedRunServiceServer) GetRun(context.Context, *GetRunRequest) (*Run, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRun not implemented")
+}
+func (UnimplementedRunServiceServer) WatchRun(*WatchRunRequest, grpc.ServerStreamingServer[Event]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchRun not implemented")
+}
+func (UnimplementedRunServiceServer) mustEmbedUnimplementedRunServiceServer() {}
+func (UnimplementedRunServiceServer) testEmbeddedByValue()                    {}
+
+// UnsafeRunServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RunServiceServer will
+// result in compilation errors.
+type UnsafeRunServiceServer interface {
+	mustEmbedUnimplementedRunServiceServer()
+}
+
+func RegisterRunServiceServer(s grpc.ServiceRegistrar, srv RunServiceServer) {
+	// If the following call pancis, it indicates UnimplementedRunServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RunService_ServiceDesc, srv)
+}
+
+func _RunService_SubmitRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubmitRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunServiceServer).SubmitRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RunService_SubmitRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunServiceServer).SubmitRun(ctx, req.(*SubmitRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RunService_GetRun_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRunRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RunServiceServer).GetRun(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RunService_GetRun_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RunServiceServer).GetRun(ctx, req.(*GetRunRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RunService_WatchRun_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRunRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RunServiceServer).WatchRun(m, &grpc.GenericServerStream[WatchRunRequest, Event]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type RunService_WatchRunServer = grpc.ServerStreamingServer[Event]
+
+// RunService_ServiceDesc is the grpc.ServiceDesc for RunService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RunService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "helmper.v1.RunService",
+	HandlerType: (*RunServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SubmitRun",
+			Handler:    _RunService_SubmitRun_Handler,
+		},
+		{
+			MethodName: "GetRun",
+			Handler:    _RunService_GetRun_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchRun",
+			Handler:       _RunService_WatchRun_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "helmper.proto",
+}
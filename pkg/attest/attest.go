@@ -0,0 +1,158 @@
+package attest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	"github.com/sigstore/cosign/v2/pkg/signature"
+	"github.com/sigstore/cosign/v2/pkg/types"
+	"github.com/sigstore/sigstore/pkg/signature/dsse"
+)
+
+const (
+	StatementType = "https://in-toto.io/Statement/v1"
+	PredicateType = "https://github.com/ChristofferNissen/helmper/import/v1"
+
+	// Media types of the attestation stored in the registries
+	ArtifactType      = "application/vnd.in-toto+json"
+	EnvelopeMediaType = "application/vnd.dsse.envelope.v1+json"
+
+	// Repository the attestations are stored in, in each registry
+	Repository = "helmper/attestations"
+)
+
+type Kind string
+
+const (
+	Chart Kind = "chart"
+	Image Kind = "image"
+)
+
+// Policy is the result of an import policy for an artifact
+type Policy struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// Target is the artifact as imported into a registry
+type Target struct {
+	Registry string `json:"registry"`
+	Digest   string `json:"digest"`
+}
+
+// Artifact is a chart or image imported by the run
+type Artifact struct {
+	Kind            Kind     `json:"kind"`
+	Name            string   `json:"name"`
+	Reference       string   `json:"reference"`
+	Source          string   `json:"source"`
+	SourceDigest    string   `json:"sourceDigest,omitempty"`
+	Targets         []Target `json:"targets"`
+	Patched         bool     `json:"patched"`
+	Signed          bool     `json:"signed"`
+	Vulnerabilities []string `json:"vulnerabilities,omitempty"`
+	Workloads       []string `json:"workloads,omitempty"`
+	Policies        []Policy `json:"policies"`
+}
+
+// Passed reports whether the artifact passed all policies
+func (a Artifact) Passed() bool {
+	for _, p := range a.Policies {
+		if !p.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+type Predicate struct {
+	GeneratedBy string     `json:"generatedBy"`
+	Timestamp   time.Time  `json:"timestamp"`
+	Artifacts   []Artifact `json:"artifacts"`
+}
+
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Statement is an in-toto statement with the imported artifacts as subjects
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// New returns the statement for the artifacts imported by a run. Every artifact in every registry is a subject
+func New(generatedBy string, timestamp time.Time, artifacts []Artifact) Statement {
+	subjects := []Subject{}
+	for _, a := range artifacts {
+		for _, t := range a.Targets {
+			alg, hex, ok := strings.Cut(t.Digest, ":")
+			if !ok {
+				continue
+			}
+			subjects = append(subjects, Subject{
+				Name:   fmt.Sprintf("%s/%s:%s", t.Registry, a.Name, a.Reference),
+				Digest: map[string]string{alg: hex},
+			})
+		}
+	}
+	sort.Slice(subjects, func(i, j int) bool { return subjects[i].Name < subjects[j].Name })
+
+	return Statement{
+		Type:          StatementType,
+		Subject:       subjects,
+		PredicateType: PredicateType,
+		Predicate: Predicate{
+			GeneratedBy: generatedBy,
+			Timestamp:   timestamp.UTC(),
+			Artifacts:   artifacts,
+		},
+	}
+}
+
+// Tag of the attestation of the run in the attestation repository
+func (s Statement) Tag() string {
+	return s.Predicate.Timestamp.Format("20060102T150405Z")
+}
+
+// Passed reports whether all artifacts passed all policies
+func (s Statement) Passed() bool {
+	for _, a := range s.Predicate.Artifacts {
+		if !a.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Sign wraps the statement in a DSSE envelope signed with the Cosign key
+func (s Statement) Sign(ctx context.Context, keyRef string, keyRefPass string) ([]byte, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	pf := cosign.PassFunc(func(bool) ([]byte, error) {
+		return []byte(keyRefPass), nil
+	})
+	sv, err := signature.SignerVerifierFromKeyRef(ctx, keyRef, pf)
+	if err != nil {
+		return nil, fmt.Errorf("attest: error loading key %s :: %w", keyRef, err)
+	}
+
+	envelope, err := dsse.WrapSigner(sv, types.IntotoPayloadType).SignMessage(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("attest: error signing attestation :: %w", err)
+	}
+	return envelope, nil
+}
@@ -0,0 +1,107 @@
+package attest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+)
+
+func artifacts() []Artifact {
+	return []Artifact{
+		{
+			Kind:      Image,
+			Name:      "library/nginx",
+			Reference: "1.25",
+			Source:    "docker.io/library/nginx:1.25",
+			Targets: []Target{
+				{Registry: "0.0.0.0:5000", Digest: "sha256:abc"},
+				{Registry: "0.0.0.0:5001", Digest: "sha256:def"},
+			},
+			Policies: []Policy{{Name: "present", Passed: true}},
+		},
+		{
+			Kind:      Chart,
+			Name:      "charts/nginx",
+			Reference: "18.1.0",
+			Source:    "oci://registry-1.docker.io/bitnamicharts",
+			Targets:   []Target{{Registry: "0.0.0.0:5000", Digest: "sha256:123"}},
+			Policies:  []Policy{{Name: "signed", Passed: false, Message: "signing disabled"}},
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	ts := time.Date(2024, 10, 15, 4, 23, 47, 0, time.UTC)
+	s := New("helmper/dev", ts, artifacts())
+
+	if len(s.Subject) != 3 {
+		t.Fatalf("want 3 subjects, got %d", len(s.Subject))
+	}
+	if s.Subject[0].Name != "0.0.0.0:5000/charts/nginx:18.1.0" || s.Subject[0].Digest["sha256"] != "123" {
+		t.Errorf("unexpected subject %v", s.Subject[0])
+	}
+	if s.Tag() != "20241015T042347Z" {
+		t.Errorf("unexpected tag %s", s.Tag())
+	}
+	if s.Passed() {
+		t.Error("want statement with failed policy to not pass")
+	}
+}
+
+func TestSign(t *testing.T) {
+	pass := func(bool) ([]byte, error) { return []byte("secret"), nil }
+	keys, err := cosign.GenerateKeyPair(pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := filepath.Join(t.TempDir(), "cosign.key")
+	if err := os.WriteFile(key, keys.PrivateBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New("helmper/dev", time.Now(), artifacts())
+	b, err := s.Sign(context.Background(), key, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+		Signatures  []any  `json:"signatures"`
+	}
+	if err := json.Unmarshal(b, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	if envelope.PayloadType != "application/vnd.in-toto+json" || len(envelope.Signatures) != 1 {
+		t.Errorf("unexpected envelope %s", b)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(payload), StatementType) {
+		t.Errorf("payload is not an in-toto statement: %s", payload)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	s := New("helmper/dev", time.Now(), artifacts())
+	var buf bytes.Buffer
+	if err := s.WriteHTML(&buf, []string{"0.0.0.0:5000/helmper/attestations:" + s.Tag()}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"docker.io/library/nginx:1.25", "sha256:def", "policy violations found", "signing disabled"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("want evidence to contain '%s'", want)
+		}
+	}
+}
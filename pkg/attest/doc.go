@@ -0,0 +1,4 @@
+/*
+Package attest records what a Helmper run imported as a signed in-toto attestation. The attestation lists every imported chart and image with the source and target digests and the results of the import policies, and can be rendered as an HTML compliance evidence pack.
+*/
+package attest
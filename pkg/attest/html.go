@@ -0,0 +1,66 @@
+package attest
+
+import (
+	"html/template"
+	"io"
+	"strings"
+)
+
+var evidence = template.Must(template.New("evidence").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Helmper import evidence {{ .Statement.Tag }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; font-size: 0.9em; }
+th { background: #eee; }
+.passed { color: #1a7f37; }
+.failed { color: #cf222e; }
+code { word-break: break-all; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>Helmper import evidence</h1>
+<table>
+<tr><th>Generated by</th><td>{{ .Statement.Predicate.GeneratedBy }}</td></tr>
+<tr><th>Timestamp</th><td>{{ .Statement.Predicate.Timestamp.Format "2006-01-02T15:04:05Z07:00" }}</td></tr>
+<tr><th>Predicate type</th><td><code>{{ .Statement.PredicateType }}</code></td></tr>
+<tr><th>Attestation</th><td>{{ range .Locations }}<code>{{ . }}</code><br>{{ else }}not stored in a registry{{ end }}</td></tr>
+<tr><th>Artifacts</th><td>{{ len .Statement.Predicate.Artifacts }}</td></tr>
+<tr><th>Result</th><td>{{ if .Statement.Passed }}<span class="passed">all policies passed</span>{{ else }}<span class="failed">policy violations found</span>{{ end }}</td></tr>
+</table>
+
+<h2>Artifacts</h2>
+<table>
+<tr><th>#</th><th>Kind</th><th>Artifact</th><th>Source</th><th>Targets</th><th>Patched</th><th>Signed</th><th>Workloads</th><th>Vulnerabilities</th><th>Policies</th></tr>
+{{ range $i, $a := .Statement.Predicate.Artifacts }}
+<tr>
+<td>{{ $i }}</td>
+<td>{{ $a.Kind }}</td>
+<td>{{ $a.Name }}:{{ $a.Reference }}</td>
+<td>{{ $a.Source }}{{ if $a.SourceDigest }}<br><code>{{ $a.SourceDigest }}</code>{{ end }}</td>
+<td>{{ range $a.Targets }}{{ .Registry }}<br><code>{{ .Digest }}</code><br>{{ end }}</td>
+<td>{{ $a.Patched }}</td>
+<td>{{ $a.Signed }}</td>
+<td>{{ join $a.Workloads ", " }}</td>
+<td>{{ join $a.Vulnerabilities ", " }}</td>
+<td>{{ range $a.Policies }}<span class="{{ if .Passed }}passed{{ else }}failed{{ end }}">{{ .Name }}</span>{{ if .Message }}: {{ .Message }}{{ end }}<br>{{ end }}</td>
+</tr>
+{{ end }}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML renders the statement as an HTML evidence pack. Locations are the references the signed attestation is stored at
+func (s Statement) WriteHTML(w io.Writer, locations []string) error {
+	return evidence.Execute(w, struct {
+		Statement Statement
+		Locations []string
+	}{s, locations})
+}
@@ -0,0 +1,133 @@
+package copa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/moby/buildkit/client"
+
+	// connection helpers of the Buildkit addresses, e.g. 'docker-container://buildkitd'
+	_ "github.com/moby/buildkit/client/connhelper/dockercontainer"
+	_ "github.com/moby/buildkit/client/connhelper/kubepod"
+	_ "github.com/moby/buildkit/client/connhelper/nerdctlcontainer"
+	_ "github.com/moby/buildkit/client/connhelper/podmancontainer"
+	_ "github.com/moby/buildkit/client/connhelper/ssh"
+)
+
+const (
+	// DefaultBuildkitdImage is the rootless Buildkit daemon started when no image is configured
+	DefaultBuildkitdImage = "docker.io/moby/buildkit:v0.15.1-rootless"
+	// DefaultBuildkitdName is the name of the container of the Buildkit daemon
+	DefaultBuildkitdName = "helmper-buildkitd"
+)
+
+// Buildkitd is a rootless Buildkit daemon started in a container for the patches, so no Buildkit daemon has to be provisioned
+type Buildkitd struct {
+	Enabled bool
+	// Image of the daemon. Defaults to DefaultBuildkitdImage
+	Image string
+	// Name of the container. Defaults to DefaultBuildkitdName
+	Name string
+	// Runtime is the CLI running the container: docker (default), podman or nerdctl
+	Runtime string
+	// Keep leaves the container running after the patches, to reuse it in the next run
+	Keep bool
+}
+
+func (b Buildkitd) image() string {
+	if b.Image != "" {
+		return b.Image
+	}
+	return DefaultBuildkitdImage
+}
+
+func (b Buildkitd) name() string {
+	if b.Name != "" {
+		return b.Name
+	}
+	return DefaultBuildkitdName
+}
+
+func (b Buildkitd) runtime() string {
+	if b.Runtime != "" {
+		return b.Runtime
+	}
+	return "docker"
+}
+
+// Addr is the address of the daemon in the container, e.g. 'docker-container://helmper-buildkitd'
+func (b Buildkitd) Addr() string {
+	return b.runtime() + "-container://" + b.name()
+}
+
+// run runs the container runtime CLI with the arguments and returns its output
+func (b Buildkitd) run(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, b.runtime(), args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("copa: error running '%s %s' :: %w: %s", b.runtime(), strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Start starts the container of the daemon, unless it is already running, and waits until the daemon accepts connections.
+// The returned stop removes the container again, unless Keep is set
+func (b Buildkitd) Start(ctx context.Context, timeout time.Duration) (stop func(), err error) {
+	stop = func() {
+		if b.Keep {
+			return
+		}
+		if _, err := b.run(context.Background(), "rm", "--force", b.name()); err != nil {
+			slog.Warn("could not remove the Buildkit daemon", slog.String("container", b.name()), slog.String("error", err.Error()))
+		}
+	}
+
+	running, err := b.run(ctx, "inspect", "--format", "{{.State.Running}}", b.name())
+	if err != nil || running != "true" {
+		// remove a stopped container of an earlier run
+		_, _ = b.run(ctx, "rm", "--force", b.name())
+		slog.Info("Starting rootless Buildkit daemon", slog.String("container", b.name()), slog.String("image", b.image()))
+		_, err := b.run(ctx, "run", "--detach", "--name", b.name(),
+			"--security-opt", "seccomp=unconfined",
+			"--security-opt", "apparmor=unconfined",
+			"--env", "BUILDKITD_FLAGS=--oci-worker-no-process-sandbox",
+			b.image(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.wait(ctx, timeout); err != nil {
+		stop()
+		return nil, err
+	}
+	return stop, nil
+}
+
+// wait waits until the daemon lists its workers
+func (b Buildkitd) wait(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		c, err := client.New(ctx, b.Addr())
+		if err == nil {
+			_, err = c.ListWorkers(ctx)
+			c.Close()
+			if err == nil {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("copa: the Buildkit daemon %s did not start in %s :: %w", b.Addr(), timeout, err)
+		case <-time.After(time.Second):
+		}
+	}
+}
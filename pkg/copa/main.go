@@ -3,73 +3,207 @@ package copa
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/ChristofferNissen/helmper/pkg/plan"
 	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/trivy"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/util/tracing"
 	"github.com/aquasecurity/trivy/pkg/fanal/types"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
-	"github.com/k0kubun/go-ansi"
 	v1_spec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/project-copacetic/copacetic/pkg/buildkit"
 	"github.com/schollz/progressbar/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content/oci"
-	"oras.land/oras-go/v2/registry/remote"
-	"oras.land/oras-go/v2/registry/remote/auth"
-	"oras.land/oras-go/v2/registry/remote/credentials"
-	"oras.land/oras-go/v2/registry/remote/retry"
 )
 
 type PatchOption struct {
 	Imgs       []*registry.Image
 	Registries []registry.Registry
+	// Sources are the settings of the registries the images are pulled from
+	Sources registry.Sources
+	// Scanner scans each platform of the images patched per platform, as the report of an image covers a single platform
+	Scanner trivy.ScanOption
 
 	TarFolder    string
 	ReportFolder string
 
+	// Buildkit is the daemon patching the images. Without an address, the daemon of Docker, the current buildx builder or the
+	// local Buildkit daemon is used, like the Copacetic CLI, unless a daemon is started in a container
 	Buildkit struct {
 		Addr       string
 		CACertPath string
 		CertPath   string
 		KeyPath    string
+		Container  Buildkitd
 	}
 
 	IgnoreErrors bool
 	Architecture *string
+	// Platforms of multi-arch images patched separately and pushed as a new index, e.g. 'linux/amd64' and 'linux/arm64'. Ignored when Architecture is set
+	Platforms []string
+
+	// AllowOS and DenyOS override the operating systems Copacetic is known to patch, as 'family' or 'family:version', e.g. 'alpine:3.19'.
+	// Denied operating systems take precedence
+	AllowOS []string
+	DenyOS  []string
+
+	// Tag names the patched images in the registries. By default they are pushed over the tag of the image
+	Tag registry.PatchedTag
+
+	// Done is called when a patched image has been pushed to all registries. It is not called in dry-run
+	Done func(*registry.Image)
+	// OnFallback is called when a patched image is pushed to the fallback of a registry instead of the registry. Done is not called
+	// for the image, so it is patched again by the next run
+	OnFallback func(registry.Fallback)
+	// ContinueOnError pushes the other patched images when an image can not be pushed, and returns the failed pushes in a
+	// *registry.FailedError. Done is not called for the failed images
+	ContinueOnError bool
+
+	// DryRun records the patches in Plan instead of performing them
+	DryRun bool
+	Plan   *plan.Plan
+}
+
+var _ registry.Patcher = PatchOption{}
+
+// matchOS reports whether the OS matches one of the rules. A version matches itself and the versions below it, e.g. 'alpine:3' matches alpine 3.19.1
+func matchOS(rules []string, family string, version string) bool {
+	for _, r := range rules {
+		f, v, _ := strings.Cut(r, ":")
+		if f != family {
+			continue
+		}
+		if v == "" || version == v || strings.HasPrefix(version, v+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsOS reports whether Copacetic can patch images of the OS family and version, by the configured and the built-in operating systems
+func (o PatchOption) SupportsOS(family string, version string) bool {
+	switch {
+	case matchOS(o.DenyOS, family, version):
+		return false
+	case matchOS(o.AllowOS, family, version):
+		return true
+	}
+	return SupportedOS(&types.OS{Family: types.OSType(family), Name: version})
+}
+
+// tracer traces the patches of images. Spans are only exported when tracing is enabled
+var tracer = otel.Tracer("github.com/ChristofferNissen/helmper/pkg/copa")
+
+// Patch patches the images with Copacetic, writing the patched images to the output tars before pushing them
+func (o PatchOption) Patch(ctx context.Context, imgs []*registry.Image, reports map[*registry.Image]string, outputs map[*registry.Image]string) error {
+	o.Imgs = imgs
+	return o.Run(ctx, reports, outputs)
 }
 
 func (o PatchOption) Run(ctx context.Context, reportFilePaths map[*registry.Image]string, outFilePaths map[*registry.Image]string) error {
 
-	bar := progressbar.NewOptions(len(o.Imgs),
-		progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetElapsedTime(true),
-		progressbar.OptionSetDescription("Patching images...\r"),
-		progressbar.OptionShowDescriptionAtLineEnd(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
+	if o.Buildkit.Container.Enabled {
+		o.Buildkit.Addr = o.Buildkit.Container.Addr()
+		if !o.DryRun && len(o.Imgs) > 0 {
+			stop, err := o.Buildkit.Container.Start(ctx, 2*time.Minute)
+			if err != nil {
+				return err
+			}
+			defer stop()
+		}
+	}
+
+	if o.DryRun {
+		for _, i := range o.Imgs {
+			ref, err := i.String()
+			if err != nil {
+				return err
+			}
+			target, err := o.Tag.Image(*i)
+			if err != nil {
+				return err
+			}
+			name, err := target.ImageName()
+			if err != nil {
+				return err
+			}
+			for _, r := range i.RoutedTo(o.Registries) {
+				o.Plan.Add(plan.Action{
+					Kind:      plan.PatchImage,
+					Source:    ref,
+					Target:    r.Ref(name, target.Tag),
+					Report:    reportFilePaths[i],
+					Buildkit:  o.Buildkit.Addr,
+					Insecure:  r.Insecure,
+					PlainHTTP: r.PlainHTTP,
+				})
+			}
+		}
+		return nil
+	}
+
+	bar := terminal.NewBar(len(o.Imgs), "Patching images...\r", progressbar.OptionSetRenderBlankState(true), progressbar.OptionSetElapsedTime(true))
+
+	platforms, err := o.platforms(ctx)
+	if err != nil {
+		return err
+	}
+
+	targets := make(map[*registry.Image]registry.Image, len(o.Imgs))
+	for _, i := range o.Imgs {
+		target, err := o.Tag.Image(*i)
+		if err != nil {
+			return err
+		}
+		targets[i] = target
+	}
 
 	for _, i := range o.Imgs {
 		ref, _ := i.String()
 
-		if err := Patch(ctx, 30*time.Minute, ref, reportFilePaths[i], i.Tag, "", "trivy", "openvex", "", o.IgnoreErrors, buildkit.Opts{
+		ctx, span := tracer.Start(ctx, "copa.patch", trace.WithAttributes(attribute.String("image", ref)))
+		bkOpts := buildkit.Opts{
 			Addr:       o.Buildkit.Addr,
 			CACertPath: o.Buildkit.CACertPath,
 			CertPath:   o.Buildkit.CertPath,
 			KeyPath:    o.Buildkit.KeyPath,
-		}, outFilePaths[i]); err != nil {
+		}
+		var err error
+		if ps := platforms[i]; len(ps) > 0 {
+			// Copacetic patches a single platform, so each platform is patched separately
+			err = os.MkdirAll(outFilePaths[i], os.ModePerm)
+			for _, p := range ps {
+				if err != nil {
+					break
+				}
+				span.AddEvent("patch platform", trace.WithAttributes(attribute.String("platform", p)))
+				// the report of the image covers a single platform, so each platform is scanned for its own vulnerabilities
+				var report string
+				report, err = o.scanPlatform(ref, reportFilePaths[i], p)
+				if err != nil {
+					break
+				}
+				err = o.patch(ctx, *i, func() error {
+					return Patch(ctx, 30*time.Minute, ref, report, targets[i].Tag, p, "", "trivy", "openvex", "", o.IgnoreErrors, bkOpts, platformTar(outFilePaths[i], p))
+				})
+			}
+		} else {
+			err = o.patch(ctx, *i, func() error {
+				return Patch(ctx, 30*time.Minute, ref, reportFilePaths[i], targets[i].Tag, "", "", "trivy", "openvex", "", o.IgnoreErrors, bkOpts, outFilePaths[i])
+			})
+		}
+		tracing.End(span, err)
+		if err != nil {
 			return fmt.Errorf("error patching image %s :: %w ", ref, err)
 		}
 
@@ -78,84 +212,83 @@ func (o PatchOption) Run(ctx context.Context, reportFilePaths map[*registry.Imag
 
 	_ = bar.Finish()
 
-	bar = progressbar.NewOptions(len(o.Imgs),
-		progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetElapsedTime(true),
-		progressbar.OptionSetDescription("Pushing images from tar...\r"),
-		progressbar.OptionShowDescriptionAtLineEnd(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
+	bar = terminal.NewBar(len(o.Imgs), "Pushing images from tar...\r", progressbar.OptionSetRenderBlankState(true), progressbar.OptionSetElapsedTime(true))
+
+	failures := []registry.Failure{}
 
 	for _, i := range o.Imgs {
-		name, _ := i.ImageName()
+		tag := targets[i].Tag
+		name, _ := targets[i].ImageName()
+
+		if ps := platforms[i]; len(ps) > 0 {
+			skipped, err := o.pushPlatforms(ctx, i, name, tag, outFilePaths[i], ps, &failures)
+			if err != nil {
+				return err
+			}
+			if o.Done != nil && !skipped {
+				o.Done(i)
+			}
+			_ = bar.Add(1)
+			continue
+		}
 
 		store, err := oci.NewFromTar(ctx, outFilePaths[i])
 		if err != nil {
 			return err
 		}
-		manifest, err := store.Resolve(ctx, i.Tag)
+		manifest, err := store.Resolve(ctx, tag)
 		if err != nil {
 			return err
 		}
 		i.Digest = manifest.Digest.String()
 
-		for _, r := range o.Registries {
-			// Connect to a remote repository
-			repo, err := remote.NewRepository(r.URL + "/" + name)
-			if err != nil {
-				return err
-			}
-
-			repo.PlainHTTP = r.PlainHTTP
-
-			// Prepare authentication using Docker credentials
-			storeOpts := credentials.StoreOptions{}
-			credStore, err := credentials.NewStoreFromDocker(storeOpts)
-			if err != nil {
-				return err
-			}
-			repo.Client = &auth.Client{
-				Client:     retry.DefaultClient,
-				Cache:      auth.NewCache(),
-				Credential: credentials.Credential(credStore), // Use the credentials store
-			}
+		skipped := false
+		for _, r := range i.RoutedTo(o.Registries) {
+			s, err := o.push(i, r, &failures, func(r registry.Registry) error {
+				// Connect to a remote repository with the credentials of the registry
+				repo, err := r.Repository(name)
+				if err != nil {
+					return err
+				}
+				if err := r.EnsureRepository(ctx, name); err != nil {
+					return err
+				}
 
-			// Copy from the file store to the remote repository
-			opts := oras.DefaultCopyOptions
-			if o.Architecture != nil {
-				v, err := v1.ParsePlatform(*o.Architecture)
+				// Copy from the file store to the remote repository
+				opts := oras.DefaultCopyOptions
+				if o.Architecture != nil {
+					v, err := v1.ParsePlatform(*o.Architecture)
+					if err != nil {
+						return err
+					}
+					opts.WithTargetPlatform(
+						&v1_spec.Platform{
+							Architecture: v.Architecture,
+							OS:           v.OS,
+							OSVersion:    v.OSVersion,
+							OSFeatures:   v.OSFeatures,
+							Variant:      v.Variant,
+						},
+					)
+				}
+				if _, err := oras.Copy(ctx, store, tag, repo, tag, opts); err != nil {
+					return err
+				}
+				manifest, err = r.Annotate(ctx, name, tag)
 				if err != nil {
 					return err
 				}
-				opts.WithTargetPlatform(
-					&v1_spec.Platform{
-						Architecture: v.Architecture,
-						OS:           v.OS,
-						OSVersion:    v.OSVersion,
-						OSFeatures:   v.OSFeatures,
-						Variant:      v.Variant,
-					},
-				)
-			}
-			manifest, err = oras.Copy(ctx, store, i.Tag, repo, i.Tag, opts)
+
+				i.Digest = manifest.Digest.String()
+				return nil
+			})
 			if err != nil {
 				return err
 			}
-
-			i.Digest = manifest.Digest.String()
-
+			skipped = skipped || s
+		}
+		if o.Done != nil && !skipped {
+			o.Done(i)
 		}
 
 		_ = bar.Add(1)
@@ -163,9 +296,46 @@ func (o PatchOption) Run(ctx context.Context, reportFilePaths map[*registry.Imag
 
 	_ = bar.Finish()
 
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Image+failures[i].Registry < failures[j].Image+failures[j].Registry
+		})
+		return &registry.FailedError{Failures: failures}
+	}
 	return nil
 }
 
+// push pushes the patched image to the registry with withFallback. With ContinueOnError, a failed push is added to failures
+// instead of returned. It reports whether the image was pushed to the fallback or failed, so Done is not called for it
+func (o PatchOption) push(i *registry.Image, r registry.Registry, failures *[]registry.Failure, push func(registry.Registry) error) (bool, error) {
+	fell, err := o.withFallback(i, r, push)
+	if err == nil || !o.ContinueOnError {
+		return fell, err
+	}
+	src, _ := i.String()
+	slog.Warn("could not push patched image. continuing with the other images", slog.String("image", src), slog.String("registry", r.URL), slog.String("error", err.Error()))
+	*failures = append(*failures, registry.Failure{Image: src, Registry: r.URL, Err: err})
+	return true, nil
+}
+
+// withFallback pushes the patched image to the registry with push, or to the fallback of the registry when the push fails.
+// It reports whether the image was pushed to the fallback
+func (o PatchOption) withFallback(i *registry.Image, r registry.Registry, push func(registry.Registry) error) (bool, error) {
+	err := push(r)
+	if err == nil || r.Fallback == nil {
+		return false, err
+	}
+	if ferr := push(*r.Fallback); ferr != nil {
+		return false, fmt.Errorf("%w, and to the fallback registry %s :: %w", err, r.Fallback.URL, ferr)
+	}
+	src, _ := i.String()
+	slog.Warn("pushed patched image to the fallback registry", slog.String("image", src), slog.String("registry", r.URL), slog.String("fallback", r.Fallback.URL), slog.String("error", err.Error()))
+	if o.OnFallback != nil {
+		o.OnFallback(registry.Fallback{Image: src, Registry: r.URL, Fallback: r.Fallback.URL, Err: err})
+	}
+	return true, nil
+}
+
 func SupportedOS(os *types.OS) bool {
 	if os == nil {
 		return true
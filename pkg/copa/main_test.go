@@ -0,0 +1,80 @@
+package copa
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestSupportsOS(t *testing.T) {
+	tests := map[string]bool{
+		"":       true,
+		"debian": true,
+		"alpine": true,
+		"photon": false,
+	}
+	for family, want := range tests {
+		if got := (PatchOption{}).SupportsOS(family, ""); got != want {
+			t.Errorf("%s: want %v got %v", family, want, got)
+		}
+	}
+
+	o := PatchOption{AllowOS: []string{"photon:5"}, DenyOS: []string{"alpine:3.12", "debian:9"}}
+	configured := []struct {
+		family  string
+		version string
+		want    bool
+	}{
+		{"photon", "5.0", true},
+		{"photon", "4.0", false},
+		{"alpine", "3.12.12", false},
+		{"alpine", "3.19.1", true},
+		{"debian", "9.13", false},
+		{"debian", "12.5", true},
+	}
+	for _, tt := range configured {
+		if got := o.SupportsOS(tt.family, tt.version); got != tt.want {
+			t.Errorf("%s %s: want %v got %v", tt.family, tt.version, tt.want, got)
+		}
+	}
+}
+
+func TestBuildkitdAddr(t *testing.T) {
+	if addr := (Buildkitd{}).Addr(); addr != "docker-container://helmper-buildkitd" {
+		t.Errorf("got %s", addr)
+	}
+	if addr := (Buildkitd{Runtime: "podman", Name: "bk"}).Addr(); addr != "podman-container://bk" {
+		t.Errorf("got %s", addr)
+	}
+}
+
+func TestPlatformTar(t *testing.T) {
+	if got, want := platformTar("out/tars/nginx.tar", "linux/arm64/v8"), "out/tars/nginx.tar/linux-arm64-v8.tar"; got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+func TestPlatformReport(t *testing.T) {
+	if got, want := platformReport("out/reports/nginx.json", "linux/arm64/v8"), "out/reports/nginx-linux-arm64-v8.json"; got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+func TestPushContinueOnError(t *testing.T) {
+	i := &registry.Image{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"}
+	r := registry.Registry{URL: "oci://registry.example.com"}
+	fail := func(registry.Registry) error { return errors.New("unauthorized") }
+
+	failures := []registry.Failure{}
+	if _, err := (PatchOption{}).push(i, r, &failures, fail); err == nil {
+		t.Error("want the failed push returned")
+	}
+	skipped, err := (PatchOption{ContinueOnError: true}).push(i, r, &failures, fail)
+	if err != nil || !skipped {
+		t.Errorf("want the failed push skipped, got %v %v", skipped, err)
+	}
+	if len(failures) != 1 || failures[0].Registry != r.URL {
+		t.Errorf("want the failed push recorded, got %v", failures)
+	}
+}
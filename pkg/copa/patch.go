@@ -13,6 +13,8 @@ import (
 	"github.com/containerd/platforms"
 	"github.com/docker/buildx/build"
 	"github.com/docker/cli/cli/config"
+	"github.com/moby/buildkit/client/llb/sourceresolver"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/quay/claircore/osrelease"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
@@ -43,8 +45,9 @@ const (
 	defaultTag              = "latest"
 )
 
-// Patch command applies package updates to an OCI image given a vulnerability report.
-func Patch(ctx context.Context, timeout time.Duration, image, reportFile, patchedTag, workingFolder, scanner, format, output string, ignoreError bool, bkOpts buildkit.Opts, out string) error {
+// Patch command applies package updates to an OCI image given a vulnerability report. The platform of the image is patched,
+// e.g. 'linux/arm64', or the platform of the host if empty
+func Patch(ctx context.Context, timeout time.Duration, image, reportFile, patchedTag, platform, workingFolder, scanner, format, output string, ignoreError bool, bkOpts buildkit.Opts, out string) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -53,7 +56,7 @@ func Patch(ctx context.Context, timeout time.Duration, image, reportFile, patche
 
 	ch := make(chan error)
 	go func() {
-		ch <- patchWithContext(timeoutCtx, ch, image, reportFile, patchedTag, workingFolder, scanner, format, output, ignoreError, bkOpts, out)
+		ch <- patchWithContext(timeoutCtx, ch, image, reportFile, patchedTag, platform, workingFolder, scanner, format, output, ignoreError, bkOpts, out)
 	}()
 
 	select {
@@ -81,11 +84,24 @@ func removeIfNotDebug(workingFolder string) {
 	}
 }
 
-func patchWithContext(ctx context.Context, ch chan error, image, reportFile, patchedTag, workingFolder, scanner, format, output string, ignoreError bool, bkOpts buildkit.Opts, out string) error {
+func patchWithContext(ctx context.Context, ch chan error, image, reportFile, patchedTag, targetPlatform, workingFolder, scanner, format, output string, ignoreError bool, bkOpts buildkit.Opts, out string) error {
 	imageName, err := reference.ParseNormalizedNamed(image)
 	if err != nil {
 		return err
 	}
+
+	// since platform is obtained from host, override it in the case of Darwin
+	platform := platforms.Normalize(platforms.DefaultSpec())
+	if targetPlatform != "" {
+		p, err := platforms.Parse(targetPlatform)
+		if err != nil {
+			return fmt.Errorf("copa: error parsing platform %s :: %w", targetPlatform, err)
+		}
+		platform = platforms.Normalize(p)
+	}
+	if platform.OS != "linux" {
+		platform.OS = "linux"
+	}
 	if reference.IsNameOnly(imageName) {
 		log.Warnf("Image name has no tag or digest, using latest as tag")
 		imageName = reference.TagNameOnly(imageName)
@@ -175,7 +191,7 @@ func patchWithContext(ctx context.Context, ch chan error, image, reportFile, pat
 	eg.Go(func() error {
 		_, err := bkClient.Build(ctx, solveOpt, copaProduct, func(ctx context.Context, c gwclient.Client) (*gwclient.Result, error) {
 			// Configure buildctl/client for use by package manager
-			config, err := buildkit.InitializeBuildkitConfig(ctx, c, imageName.String())
+			config, err := initializeConfig(ctx, c, imageName.String(), platform)
 			if err != nil {
 				ch <- err
 				return nil, fmt.Errorf("copa: error initializing buildkit config for image %s :: %w", imageName.String(), err)
@@ -230,11 +246,6 @@ func patchWithContext(ctx context.Context, ch chan error, image, reportFile, pat
 				return nil, nil
 			}
 
-			platform := platforms.Normalize(platforms.DefaultSpec())
-			if platform.OS != "linux" {
-				platform.OS = "linux"
-			}
-
 			def, err := patchedImageState.Marshal(ctx, llb.Platform(platform))
 			if err != nil {
 				ch <- err
@@ -319,6 +330,37 @@ func patchWithContext(ctx context.Context, ch chan error, image, reportFile, pat
 	return eg.Wait()
 }
 
+// initializeConfig is buildkit.InitializeBuildkitConfig resolving the image for the platform instead of the platform of the Buildkit worker
+func initializeConfig(ctx context.Context, c gwclient.Client, image string, platform ocispec.Platform) (*buildkit.Config, error) {
+	config := buildkit.Config{
+		ImageName: image,
+		Platform:  &platform,
+	}
+
+	_, _, configData, err := c.ResolveImageConfig(ctx, image, sourceresolver.Opt{
+		Platform: &platform,
+		ImageOpt: &sourceresolver.ResolveImageOpt{
+			ResolveMode: llb.ResolveModePreferLocal.String(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	config.ConfigData = configData
+
+	config.ImageState, err = llb.Image(image,
+		llb.Platform(platform),
+		llb.ResolveModePreferLocal,
+		llb.WithMetaResolver(c),
+	).WithImageConfig(config.ConfigData)
+	if err != nil {
+		return nil, err
+	}
+	config.Client = c
+
+	return &config, nil
+}
+
 func getOSType(ctx context.Context, osreleaseBytes []byte) (string, error) {
 	r := bytes.NewReader(osreleaseBytes)
 	osData, err := osrelease.Parse(ctx, r)
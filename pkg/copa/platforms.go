@@ -0,0 +1,133 @@
+package copa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	v1_spec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+)
+
+// platformTar is the path of the tar of the patched platform of an image. The tars of the platforms are written to a folder at the path of the tar of the image
+func platformTar(out string, platform string) string {
+	return filepath.Join(out, strings.ReplaceAll(platform, "/", "-")+".tar")
+}
+
+// platforms returns the platforms of each image to patch separately. Images without an index, and all images without Platforms or
+// with Architecture, are patched for a single platform
+func (o PatchOption) platforms(ctx context.Context) (map[*registry.Image][]string, error) {
+	res := make(map[*registry.Image][]string, len(o.Imgs))
+	if o.Architecture != nil || len(o.Platforms) == 0 {
+		return res, nil
+	}
+	for _, i := range o.Imgs {
+		ps, err := registry.SourcePlatforms(ctx, o.Sources, *i, o.Platforms)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = ps
+	}
+	return res, nil
+}
+
+// pushPlatforms pushes the patched platforms of the image to the registries, and a new index referencing them with the tag.
+// It reports whether the image was pushed to the fallback of a registry or failed with ContinueOnError
+func (o PatchOption) pushPlatforms(ctx context.Context, i *registry.Image, name string, tag string, out string, platforms []string, failures *[]registry.Failure) (bool, error) {
+	stores := make(map[string]*oci.ReadOnlyStore, len(platforms))
+	manifests := make([]v1_spec.Descriptor, 0, len(platforms))
+	for _, p := range platforms {
+		store, err := oci.NewFromTar(ctx, platformTar(out, p))
+		if err != nil {
+			return false, err
+		}
+		desc, err := store.Resolve(ctx, tag)
+		if err != nil {
+			return false, err
+		}
+		platform, err := v1.ParsePlatform(p)
+		if err != nil {
+			return false, err
+		}
+		stores[p] = store
+		manifests = append(manifests, v1_spec.Descriptor{
+			MediaType: desc.MediaType,
+			Digest:    desc.Digest,
+			Size:      desc.Size,
+			Platform: &v1_spec.Platform{
+				Architecture: platform.Architecture,
+				OS:           platform.OS,
+				Variant:      platform.Variant,
+			},
+		})
+	}
+
+	skipped := false
+	for _, r := range i.RoutedTo(o.Registries) {
+		s, err := o.push(i, r, failures, func(r registry.Registry) error {
+			if err := r.EnsureRepository(ctx, name); err != nil {
+				return err
+			}
+			repo, err := r.Repository(name)
+			if err != nil {
+				return err
+			}
+			for n, p := range platforms {
+				if err := oras.CopyGraph(ctx, stores[p], repo, manifests[n], oras.DefaultCopyGraphOptions); err != nil {
+					return err
+				}
+			}
+			desc, err := r.PushIndex(ctx, name, tag, manifests)
+			if err != nil {
+				return err
+			}
+			i.Digest = desc.Digest.String()
+			return nil
+		})
+		if err != nil {
+			return false, err
+		}
+		skipped = skipped || s
+	}
+	return skipped, nil
+}
+
+// platformReport is the path of the scan report of the platform of an image, next to the report of the image
+func platformReport(report string, platform string) string {
+	return strings.TrimSuffix(report, filepath.Ext(report)) + "-" + strings.ReplaceAll(platform, "/", "-") + ".json"
+}
+
+// scanPlatform scans the platform of the image, and writes the report next to the report of the image
+func (o PatchOption) scanPlatform(ref string, report string, platform string) (string, error) {
+	so := o.Scanner
+	so.Architecture = &platform
+	r, err := so.Scan(ref)
+	if err != nil {
+		return "", fmt.Errorf("copa: error scanning platform %s of image %s :: %w", platform, ref, err)
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := platformReport(report, platform)
+	if err := os.WriteFile(path, b, os.ModePerm); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// patch runs the patch of the image within the rate limit of its source registry, as Buildkit pulls the image itself
+func (o PatchOption) patch(ctx context.Context, i registry.Image, patch func() error) error {
+	release, err := o.Sources.Throttle(ctx, i.Registry)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return patch()
+}
@@ -0,0 +1,95 @@
+package cosign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/schollz/progressbar/v3"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/attest"
+	"github.com/sigstore/cosign/v2/pkg/cosign/attestation"
+)
+
+// Predicate types of the documents attached to images, as given to 'cosign verify-attestation --type'
+const (
+	PredicateSPDX      = "spdxjson"
+	PredicateCycloneDX = "cyclonedx"
+	PredicateVuln      = "vuln"
+)
+
+// Predicate is a document attached to an image as a signed in-toto attestation
+type Predicate struct {
+	// Ref is the image in the registry, referenced by digest
+	Ref string
+	// Path of the predicate document
+	Path string
+	Type string
+}
+
+// VulnPredicate wraps a Trivy scan report in the Cosign vulnerability predicate
+func VulnPredicate(report any, scanned time.Time) ([]byte, error) {
+	return json.MarshalIndent(attestation.CosignVulnPredicate{
+		Scanner: attestation.Scanner{
+			URI:    "pkg:github/aquasecurity/trivy",
+			Result: report,
+		},
+		Metadata: attestation.Metadata{
+			ScanStartedOn:  scanned,
+			ScanFinishedOn: scanned,
+		},
+	}, "", "  ")
+}
+
+// Attest attaches the predicates to the images as in-toto attestations signed like the images, replacing earlier attestations of the same type
+func (so SignOption) Attest(ctx context.Context, ps []Predicate) error {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	if so.DryRun {
+		for _, p := range ps {
+			so.Plan.Add(plan.Action{
+				Kind:              plan.AttestImage,
+				Target:            p.Ref,
+				Report:            p.Path,
+				PredicateType:     p.Type,
+				KeyRef:            so.KeyRef,
+				FulcioURL:         so.Sigstore.FulcioURL,
+				RekorURL:          so.Sigstore.RekorURL,
+				OIDCIssuer:        so.Sigstore.OIDCIssuer,
+				IdentityTokenFile: so.Sigstore.IdentityTokenFile,
+				TlogUpload:        so.Sigstore.TlogUpload,
+				Insecure:          so.AllowInsecure,
+				PlainHTTP:         so.AllowHTTPRegistry,
+			})
+		}
+		return nil
+	}
+
+	ro, ko, signOpts, err := so.options()
+	if err != nil {
+		return err
+	}
+
+	bar := terminal.NewBar(len(ps), "Attaching reports...\r", progressbar.OptionSetRenderBlankState(true))
+	for _, p := range ps {
+		ac := attest.AttestCommand{
+			KeyOpts:         ko,
+			RegistryOptions: signOpts.Registry,
+			PredicatePath:   p.Path,
+			PredicateType:   p.Type,
+			Replace:         true,
+			Timeout:         ro.Timeout,
+			TlogUpload:      signOpts.TlogUpload,
+			RekorEntryType:  "dsse",
+		}
+		if err := ac.Exec(ctx, p.Ref); err != nil {
+			return fmt.Errorf("cosign: error attaching %s attestation to %s :: %w", p.Type, p.Ref, err)
+		}
+		_ = bar.Add(1)
+	}
+	return bar.Finish()
+}
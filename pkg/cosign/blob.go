@@ -0,0 +1,71 @@
+package cosign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/sign"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/verify"
+)
+
+// SignBlob signs the file at path, and writes the signature to '<path>.sig', the certificate of keyless signatures to '<path>.pem',
+// and the Cosign bundle with the signature, the certificate and the transparency log entry to '<path>.bundle'
+func (so SignOption) SignBlob(path string) error {
+	ro, ko, signOpts, err := so.options()
+	if err != nil {
+		return err
+	}
+
+	ko.BundlePath = path + ".bundle"
+	cert := ""
+	if so.KeyRef == "" {
+		cert = path + ".pem"
+	}
+	if _, err := sign.SignBlobCmd(&ro, ko, path, true, path+".sig", cert, signOpts.TlogUpload); err != nil {
+		return fmt.Errorf("cosign: error signing %s :: %w", path, err)
+	}
+	return nil
+}
+
+// VerifyBlob verifies the signature of the file at path written by SignBlob, with the public key or one of the keyless identities.
+// The transparency log entry of the bundle is verified offline. Files signed without a bundle look up the entry in Rekor
+func (vo VerifyOption) VerifyBlob(ctx context.Context, path string) error {
+	url := vo.RekorURL
+	if url == "" {
+		url = options.DefaultRekorURL
+	}
+	cmd := verify.VerifyBlobCmd{
+		KeyOpts:    options.KeyOpts{KeyRef: vo.KeyRef, RekorURL: url},
+		SigRef:     path + ".sig",
+		IgnoreTlog: vo.IgnoreTlog,
+	}
+	if _, err := os.Stat(path + ".bundle"); err == nil {
+		cmd.BundlePath = path + ".bundle"
+	}
+
+	if vo.KeyRef != "" {
+		if err := cmd.Exec(ctx, path); err != nil {
+			return fmt.Errorf("cosign: error verifying the signature of %s :: %w", path, err)
+		}
+		return nil
+	}
+
+	cmd.CertRef = path + ".pem"
+	err := errors.New("no public key or keyless identities")
+	for _, id := range vo.Identities {
+		c := cmd
+		c.CertVerifyOptions = options.CertVerifyOptions{
+			CertOidcIssuer:       id.Issuer,
+			CertOidcIssuerRegexp: id.IssuerRegExp,
+			CertIdentity:         id.Subject,
+			CertIdentityRegexp:   id.SubjectRegExp,
+		}
+		if err = c.Exec(ctx, path); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("cosign: error verifying the signature of %s :: %w", path, err)
+}
@@ -0,0 +1,48 @@
+package cosign
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+)
+
+func TestSignBlob(t *testing.T) {
+	dir := t.TempDir()
+	keys, err := cosign.GenerateKeyPair(func(bool) ([]byte, error) { return []byte("pass"), nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, pub := filepath.Join(dir, "cosign.key"), filepath.Join(dir, "cosign.pub")
+	if err := os.WriteFile(key, keys.PrivateBytes, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pub, keys.PublicBytes, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "index.json")
+	if err := os.WriteFile(path, []byte(`{"schemaVersion":2,"manifests":[]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := (SignOption{KeyRef: key, KeyRefPass: "pass"}).SignBlob(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bundle"); err != nil {
+		t.Errorf("want the bundle written next to the file got %v", err)
+	}
+
+	vo := VerifyOption{KeyRef: pub, IgnoreTlog: true}
+	if err := vo.VerifyBlob(context.Background(), path); err != nil {
+		t.Errorf("want the signature verified got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schemaVersion":2,"manifests":[{}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := vo.VerifyBlob(context.Background(), path); err == nil {
+		t.Error("want an error for a tampered file")
+	}
+}
@@ -2,21 +2,18 @@ package cosign
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/plan"
 	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/k0kubun/go-ansi"
 	"github.com/schollz/progressbar/v3"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/sign"
-	"helm.sh/helm/v3/pkg/chart/loader"
 
 	_ "github.com/sigstore/sigstore/pkg/signature/kms/aws"
 	_ "github.com/sigstore/sigstore/pkg/signature/kms/azure"
@@ -33,6 +30,12 @@ type SignChartOption struct {
 	KeyRefPass        string
 	AllowInsecure     bool
 	AllowHTTPRegistry bool
+	// Sigstore is the deployment used for keyless signing and the transparency log
+	Sigstore Sigstore
+
+	// DryRun records the signatures in Plan instead of signing
+	DryRun bool
+	Plan   *plan.Plan
 }
 
 // cosignAdapter wraps the cosign CLIs native code
@@ -44,23 +47,7 @@ func (so SignChartOption) Run() error {
 		return nil
 	}
 
-	bar := progressbar.NewOptions(len(so.ChartCollection.Charts), progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetDescription("Signing charts...\r"),
-		progressbar.OptionShowDescriptionAtLineEnd(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
+	bar := terminal.NewBar(len(so.ChartCollection.Charts), "Signing charts...\r", progressbar.OptionSetRenderBlankState(true))
 
 	// Sign with cosign
 	timeout := 2 * time.Minute
@@ -92,6 +79,11 @@ func (so SignChartOption) Run() error {
 		},
 	}
 
+	so.Sigstore.apply(&signOpts)
+	if err := so.Sigstore.Setup(context.Background()); err != nil {
+		return err
+	}
+
 	oidcClientSecret, err := signOpts.OIDC.ClientSecret()
 	if err != nil {
 		return err
@@ -122,53 +114,27 @@ func (so SignChartOption) Run() error {
 	}
 
 	for _, r := range so.Registries {
-		refs := []string{}
-		for _, c := range so.ChartCollection.Charts {
-
-			name := fmt.Sprintf("charts/%s", c.Name)
-			d, err := r.Fetch(context.TODO(), name, c.Version)
-			if err != nil {
-				return err
-			}
-
-			ref := fmt.Sprintf("%s/%s@%s", r.URL, name, d.Digest)
-			refs = append(refs, ref)
-
-			// Get remote Helm Chart using Helm SDK
-			path, err := c.Locate()
-			if err != nil {
-				return err
-			}
-
-			// Get detailed information about the chart
-			chartRef, err := loader.Load(path)
-			if err != nil {
-				return err
-			}
+		refs, err := so.ChartCollection.Refs(context.TODO(), r, so.DryRun)
+		if err != nil {
+			return err
+		}
 
-			for _, d := range chartRef.Metadata.Dependencies {
-				if !(d.Repository == "" || strings.HasPrefix(d.Repository, "file://")) {
-					v := d.Version
-					if strings.Contains(v, "*") || strings.Contains(v, "x") {
-						chart := helm.DependencyToChart(d, c)
-
-						// Resolve Globs to latest patch
-						v, err = chart.ResolveVersion()
-						if err != nil {
-							return err
-						}
-					}
-
-					name := fmt.Sprintf("charts/%s", d.Name)
-					d, err := r.Fetch(context.TODO(), name, v)
-					if err != nil {
-						return err
-					}
-
-					ref := fmt.Sprintf("%s/%s@%s", r.URL, name, d.Digest)
-					refs = append(refs, ref)
-				}
+		if so.DryRun {
+			for _, ref := range refs {
+				so.Plan.Add(plan.Action{
+					Kind:              plan.SignChart,
+					Target:            ref,
+					KeyRef:            so.KeyRef,
+					FulcioURL:         so.Sigstore.FulcioURL,
+					RekorURL:          so.Sigstore.RekorURL,
+					OIDCIssuer:        so.Sigstore.OIDCIssuer,
+					IdentityTokenFile: so.Sigstore.IdentityTokenFile,
+					TlogUpload:        so.Sigstore.TlogUpload,
+					Insecure:          so.AllowInsecure,
+					PlainHTTP:         so.AllowHTTPRegistry,
+				})
 			}
+			continue
 		}
 
 		bar.ChangeMax(len(refs))
@@ -1,15 +1,16 @@
 package cosign
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
-	"os"
 	"time"
 
+	"github.com/ChristofferNissen/helmper/pkg/plan"
 	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
-	"github.com/k0kubun/go-ansi"
 	"github.com/schollz/progressbar/v3"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
 	"github.com/sigstore/cosign/v2/cmd/cosign/cli/sign"
@@ -29,8 +30,16 @@ type SignOption struct {
 	KeyRefPass        string
 	AllowInsecure     bool
 	AllowHTTPRegistry bool
+	// Sigstore is the deployment used for keyless signing and the transparency log
+	Sigstore Sigstore
+
+	// DryRun records the signatures in Plan instead of signing
+	DryRun bool
+	Plan   *plan.Plan
 }
 
+var _ registry.Signer = SignOption{}
+
 // cosignAdapter wraps the cosign CLIs native code
 func (so SignOption) Run() error {
 
@@ -40,24 +49,66 @@ func (so SignOption) Run() error {
 		return nil
 	}
 
-	bar := progressbar.NewOptions(len(so.Imgs), progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetRenderBlankState(true),
-		progressbar.OptionSetDescription("Signing images...\r"),
-		progressbar.OptionShowDescriptionAtLineEnd(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
+	if so.DryRun {
+		for _, r := range so.Registries {
+			for _, i := range so.Imgs {
+				if !r.Routes(*i) {
+					continue
+				}
+				name, err := i.ImageName()
+				if err != nil {
+					return err
+				}
+				so.Plan.Add(plan.Action{
+					Kind:              plan.SignImage,
+					Target:            r.Ref(name, i.Tag),
+					KeyRef:            so.KeyRef,
+					FulcioURL:         so.Sigstore.FulcioURL,
+					RekorURL:          so.Sigstore.RekorURL,
+					OIDCIssuer:        so.Sigstore.OIDCIssuer,
+					IdentityTokenFile: so.Sigstore.IdentityTokenFile,
+					TlogUpload:        so.Sigstore.TlogUpload,
+					Insecure:          so.AllowInsecure,
+					PlainHTTP:         so.AllowHTTPRegistry,
+				})
+			}
+		}
+		return nil
+	}
+
+	bar := terminal.NewBar(len(so.Imgs), "Signing images...\r", progressbar.OptionSetRenderBlankState(true))
+
+	ro, ko, signOpts, err := so.options()
+	if err != nil {
+		return err
+	}
 
+	for _, r := range so.Registries {
+		refs := []string{}
+		for _, i := range so.Imgs {
+			if !r.Routes(*i) {
+				continue
+			}
+			name, _ := i.ImageName()
+			ref := r.Ref(name, i.Digest)
+			refs = append(refs, ref)
+		}
+		if len(refs) == 0 {
+			continue
+		}
+		if err := sign.SignCmd(&ro, ko, signOpts, refs); err != nil {
+			return err
+		}
+		_ = bar.Add(len(refs))
+	}
+
+	_ = bar.Finish()
+
+	return nil
+}
+
+// options configures Cosign to sign with the key or keyless, and to upload the signatures to the registries
+func (so SignOption) options() (options.RootOptions, options.KeyOpts, options.SignOptions, error) {
 	// Sign with cosign
 	timeout := 2 * time.Minute
 	ro := options.RootOptions{
@@ -88,9 +139,14 @@ func (so SignOption) Run() error {
 			},
 		},
 	}
+	so.Sigstore.apply(&signOpts)
+	if err := so.Sigstore.Setup(context.Background()); err != nil {
+		return options.RootOptions{}, options.KeyOpts{}, options.SignOptions{}, err
+	}
+
 	oidcClientSecret, err := signOpts.OIDC.ClientSecret()
 	if err != nil {
-		return err
+		return options.RootOptions{}, options.KeyOpts{}, options.SignOptions{}, err
 	}
 	ko := options.KeyOpts{
 		KeyRef:                         signOpts.Key,
@@ -117,20 +173,43 @@ func (so SignOption) Run() error {
 		IssueCertificateForExistingKey: signOpts.IssueCertificate,
 	}
 
-	for _, r := range so.Registries {
-		refs := []string{}
-		for _, i := range so.Imgs {
-			name, _ := i.ImageName()
-			ref := fmt.Sprintf("%s/%s@%s", r.URL, name, i.Digest)
-			refs = append(refs, ref)
-		}
-		if err := sign.SignCmd(&ro, ko, signOpts, refs); err != nil {
-			return err
+	return ro, ko, signOpts, nil
+}
+
+// Sign signs the artifacts referenced by digest, e.g. '0.0.0.0:5000/charts/prometheus@sha256:...', ignoring Imgs and Registries
+func (so SignOption) Sign(as []registry.Artifact) error {
+	if len(as) == 0 {
+		return nil
+	}
+
+	if so.DryRun {
+		for _, a := range as {
+			so.Plan.Add(plan.Action{
+				Kind:              a.SignKind(),
+				Target:            a.Ref,
+				KeyRef:            so.KeyRef,
+				FulcioURL:         so.Sigstore.FulcioURL,
+				RekorURL:          so.Sigstore.RekorURL,
+				OIDCIssuer:        so.Sigstore.OIDCIssuer,
+				IdentityTokenFile: so.Sigstore.IdentityTokenFile,
+				TlogUpload:        so.Sigstore.TlogUpload,
+				Insecure:          so.AllowInsecure,
+				PlainHTTP:         so.AllowHTTPRegistry,
+			})
 		}
-		_ = bar.Add(len(refs))
+		return nil
 	}
 
-	_ = bar.Finish()
+	ro, ko, signOpts, err := so.options()
+	if err != nil {
+		return err
+	}
 
-	return nil
+	refs := registry.Refs(as)
+	bar := terminal.NewBar(len(refs), fmt.Sprintf("Signing %ss...\r", as[0].Kind), progressbar.OptionSetRenderBlankState(true))
+	if err := sign.SignCmd(&ro, ko, signOpts, refs); err != nil {
+		return err
+	}
+	_ = bar.Add(len(refs))
+	return bar.Finish()
 }
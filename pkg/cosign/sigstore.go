@@ -0,0 +1,99 @@
+package cosign
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/v2/pkg/cosign/env"
+	"github.com/sigstore/sigstore/pkg/tuf"
+)
+
+// Sigstore is the Sigstore deployment used for keyless signing and the transparency log, e.g. a private deployment in a disconnected environment.
+// Empty URLs use the public Sigstore instance.
+type Sigstore struct {
+	FulcioURL string
+	RekorURL  string
+
+	// TUFMirror is a TUF repository mirror serving the trust roots, initialized like 'cosign initialize'. TUFRoot is the initial root.json of the mirror
+	TUFMirror string
+	TUFRoot   string
+	// FulcioRoots, RekorPublicKey and CTLogPublicKey are files with the trust roots, used instead of TUF
+	FulcioRoots    string
+	RekorPublicKey string
+	CTLogPublicKey string
+
+	// IdentityToken is the OIDC token exchanged for a signing certificate in keyless mode
+	IdentityToken string
+	// IdentityTokenFile is a file with the OIDC token, e.g. a projected service account token. It is read on every signature, so rotated tokens are picked up
+	IdentityTokenFile string
+	OIDCIssuer        string
+	OIDCClientID      string
+
+	// TlogUpload uploads signatures to the Rekor transparency log
+	TlogUpload bool
+	// InsecureSkipFulcioVerify skips verifying the signed certificate timestamp, for Fulcio deployments without a CT log
+	InsecureSkipFulcioVerify bool
+}
+
+// Setup initializes the trust roots of the Sigstore deployment
+func (s Sigstore) Setup(ctx context.Context) error {
+	if s.TUFMirror != "" {
+		var root []byte
+		if s.TUFRoot != "" {
+			b, err := os.ReadFile(s.TUFRoot)
+			if err != nil {
+				return fmt.Errorf("cosign: error reading TUF root %s :: %w", s.TUFRoot, err)
+			}
+			root = b
+		}
+		if err := tuf.Initialize(ctx, s.TUFMirror, root); err != nil {
+			return fmt.Errorf("cosign: error initializing TUF root from mirror %s :: %w", s.TUFMirror, err)
+		}
+	}
+
+	// Cosign reads trust roots given as files from the environment
+	roots := map[env.Variable]string{
+		env.VariableSigstoreRootFile:           s.FulcioRoots,
+		env.VariableSigstoreRekorPublicKey:     s.RekorPublicKey,
+		env.VariableSigstoreCTLogPublicKeyFile: s.CTLogPublicKey,
+	}
+	for k, v := range roots {
+		if v == "" {
+			continue
+		}
+		if err := os.Setenv(k.String(), v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// apply sets the Sigstore deployment in the sign options
+func (s Sigstore) apply(o *options.SignOptions) {
+	o.Fulcio.URL = options.DefaultFulcioURL
+	if s.FulcioURL != "" {
+		o.Fulcio.URL = s.FulcioURL
+	}
+	o.Rekor.URL = options.DefaultRekorURL
+	if s.RekorURL != "" {
+		o.Rekor.URL = s.RekorURL
+	}
+	o.Fulcio.IdentityToken = os.ExpandEnv(s.IdentityToken)
+	if o.Fulcio.IdentityToken == "" {
+		// Cosign reads the token from the file when given a path
+		o.Fulcio.IdentityToken = os.ExpandEnv(s.IdentityTokenFile)
+	}
+	o.Fulcio.InsecureSkipFulcioVerify = s.InsecureSkipFulcioVerify
+	o.OIDC.Issuer = options.DefaultOIDCIssuerURL
+	if s.OIDCIssuer != "" {
+		o.OIDC.Issuer = s.OIDCIssuer
+	}
+	o.OIDC.ClientID = "sigstore"
+	if s.OIDCClientID != "" {
+		o.OIDC.ClientID = s.OIDCClientID
+	}
+	o.TlogUpload = s.TlogUpload
+}
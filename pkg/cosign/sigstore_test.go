@@ -0,0 +1,56 @@
+package cosign
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+)
+
+func TestSigstoreApply(t *testing.T) {
+	o := options.SignOptions{}
+	Sigstore{}.apply(&o)
+	if o.Fulcio.URL != options.DefaultFulcioURL || o.Rekor.URL != options.DefaultRekorURL {
+		t.Errorf("want public Sigstore instance got '%s' and '%s'", o.Fulcio.URL, o.Rekor.URL)
+	}
+
+	t.Setenv("SIGSTORE_ID_TOKEN", "token")
+	Sigstore{
+		FulcioURL:     "https://fulcio.internal",
+		RekorURL:      "https://rekor.internal",
+		IdentityToken: "${SIGSTORE_ID_TOKEN}",
+		TlogUpload:    true,
+	}.apply(&o)
+	if o.Fulcio.URL != "https://fulcio.internal" || o.Rekor.URL != "https://rekor.internal" {
+		t.Errorf("want private Sigstore instance got '%s' and '%s'", o.Fulcio.URL, o.Rekor.URL)
+	}
+	if o.Fulcio.IdentityToken != "token" {
+		t.Errorf("want identity token 'token' got '%s'", o.Fulcio.IdentityToken)
+	}
+	if !o.TlogUpload {
+		t.Error("want tlog upload")
+	}
+
+	// Cosign reads the token from the file
+	Sigstore{IdentityTokenFile: "/var/run/secrets/tokens/sigstore"}.apply(&o)
+	if o.Fulcio.IdentityToken != "/var/run/secrets/tokens/sigstore" {
+		t.Errorf("want identity token file got '%s'", o.Fulcio.IdentityToken)
+	}
+}
+
+func TestSigstoreSetup(t *testing.T) {
+	t.Setenv("SIGSTORE_ROOT_FILE", "")
+	t.Setenv("SIGSTORE_REKOR_PUBLIC_KEY", "")
+
+	s := Sigstore{FulcioRoots: "/etc/sigstore/fulcio.pem", RekorPublicKey: "/etc/sigstore/rekor.pub"}
+	if err := s.Setup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v := os.Getenv("SIGSTORE_ROOT_FILE"); v != s.FulcioRoots {
+		t.Errorf("want '%s' got '%s'", s.FulcioRoots, v)
+	}
+	if v := os.Getenv("SIGSTORE_REKOR_PUBLIC_KEY"); v != s.RekorPublicKey {
+		t.Errorf("want '%s' got '%s'", s.RekorPublicKey, v)
+	}
+}
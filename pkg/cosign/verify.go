@@ -0,0 +1,168 @@
+package cosign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/fulcio"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/options"
+	"github.com/sigstore/cosign/v2/cmd/cosign/cli/rekor"
+	"github.com/sigstore/cosign/v2/pkg/cosign"
+	ociremote "github.com/sigstore/cosign/v2/pkg/oci/remote"
+	sigs "github.com/sigstore/cosign/v2/pkg/signature"
+	"golang.org/x/sync/errgroup"
+)
+
+// Identity is a keyless signing identity accepted on source images. Either the exact value or the regular expression must be set for the issuer and the subject
+type Identity struct {
+	Issuer        string
+	IssuerRegExp  string
+	Subject       string
+	SubjectRegExp string
+}
+
+// Verified is the result of verifying the signatures of a source image. Err is the reason the image is not Signed
+type Verified struct {
+	Image  string
+	Signed bool
+	Err    error
+}
+
+// Unsigned reports whether the image has no signature at all, as opposed to signatures not matching the key or identities
+func (v Verified) Unsigned() bool {
+	var notFound *cosign.ErrNoSignaturesFound
+	return errors.As(v.Err, &notFound)
+}
+
+// VerifyOption verifies the Cosign signatures of images in their source registries, with a public key or keyless identities
+type VerifyOption struct {
+	Imgs []*registry.Image
+
+	// KeyRef is the public key the images are signed with. Keyless signatures are verified against Identities when empty
+	KeyRef     string
+	Identities []Identity
+	// RekorURL is the transparency log the signatures are looked up in. Defaults to the public Sigstore instance
+	RekorURL   string
+	IgnoreTlog bool
+
+	// Concurrency limits the number of images verified in parallel. Zero or less is unlimited
+	Concurrency int
+}
+
+// checkOpts configures Cosign to verify signatures with the key or identities
+func (vo VerifyOption) checkOpts(ctx context.Context) (*cosign.CheckOpts, error) {
+	co := &cosign.CheckOpts{
+		ClaimVerifier: cosign.SimpleClaimVerifier,
+		RegistryClientOpts: []ociremote.Option{
+			ociremote.WithRemoteOptions(remote.WithAuthFromKeychain(authn.DefaultKeychain)),
+		},
+		IgnoreTlog: vo.IgnoreTlog,
+	}
+
+	if !vo.IgnoreTlog {
+		url := vo.RekorURL
+		if url == "" {
+			url = options.DefaultRekorURL
+		}
+		client, err := rekor.NewClient(url)
+		if err != nil {
+			return nil, fmt.Errorf("cosign: error connecting to Rekor at %s :: %w", url, err)
+		}
+		co.RekorClient = client
+		if co.RekorPubKeys, err = cosign.GetRekorPubs(ctx); err != nil {
+			return nil, fmt.Errorf("cosign: error getting Rekor public keys :: %w", err)
+		}
+	}
+
+	if vo.KeyRef != "" {
+		verifier, err := sigs.PublicKeyFromKeyRef(ctx, vo.KeyRef)
+		if err != nil {
+			return nil, fmt.Errorf("cosign: error loading public key %s :: %w", vo.KeyRef, err)
+		}
+		co.SigVerifier = verifier
+		return co, nil
+	}
+
+	var err error
+	if co.RootCerts, err = fulcio.GetRoots(); err != nil {
+		return nil, fmt.Errorf("cosign: error getting Fulcio roots :: %w", err)
+	}
+	if co.IntermediateCerts, err = fulcio.GetIntermediates(); err != nil {
+		return nil, fmt.Errorf("cosign: error getting Fulcio intermediates :: %w", err)
+	}
+	if co.CTLogPubKeys, err = cosign.GetCTLogPubs(ctx); err != nil {
+		return nil, fmt.Errorf("cosign: error getting CT log public keys :: %w", err)
+	}
+	for _, id := range vo.Identities {
+		co.Identities = append(co.Identities, cosign.Identity{
+			Issuer:        id.Issuer,
+			IssuerRegExp:  id.IssuerRegExp,
+			Subject:       id.Subject,
+			SubjectRegExp: id.SubjectRegExp,
+		})
+	}
+	return co, nil
+}
+
+// Run verifies the signatures of every image. Images without valid signatures are reported in the results, and do not stop the other verifications
+func (vo VerifyOption) Run(ctx context.Context) ([]Verified, error) {
+	if len(vo.Imgs) == 0 {
+		return nil, nil
+	}
+
+	co, err := vo.checkOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	bar := terminal.NewBar(len(vo.Imgs), "Verifying source signatures...\r")
+
+	var mu sync.Mutex
+	res := make([]Verified, 0, len(vo.Imgs))
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	if vo.Concurrency > 0 {
+		eg.SetLimit(vo.Concurrency)
+	}
+	for _, i := range vo.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return nil, err
+		}
+		eg.Go(func() error {
+			v := Verified{Image: ref}
+			r, err := name.ParseReference(ref)
+			if err != nil {
+				return err
+			}
+			if _, _, err := cosign.VerifyImageSignatures(egCtx, r, co); err != nil {
+				slog.Debug("source image signature not verified", slog.String("image", ref), slog.String("error", err.Error()))
+				v.Err = err
+			} else {
+				v.Signed = true
+			}
+
+			mu.Lock()
+			res = append(res, v)
+			mu.Unlock()
+			_ = bar.Add(1)
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	_ = bar.Finish()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Image < res[j].Image })
+	return res, nil
+}
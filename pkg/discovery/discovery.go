@@ -0,0 +1,333 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/blang/semver/v4"
+	"helm.sh/helm/v3/pkg/repo"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Discovery finds the charts deployed by Flux HelmReleases and ArgoCD Applications
+type Discovery struct {
+	// Manifests are the files of the resources, or glob patterns of them, e.g. 'clusters/prod/*.yaml'
+	Manifests []string
+	// Cluster lists the resources in the cluster of the kubeconfig
+	Cluster bool
+	// Kubeconfig and Context select the cluster. Empty uses the default kubeconfig, or the service account in a pod
+	Kubeconfig string
+	Context    string
+	// Namespaces to list the resources in. Empty lists all namespaces
+	Namespaces []string
+}
+
+// Enabled reports if any resources are discovered
+func (d Discovery) Enabled() bool {
+	return len(d.Manifests) > 0 || d.Cluster
+}
+
+var resources = []schema.GroupVersionResource{
+	{Group: "helm.toolkit.fluxcd.io", Version: "v2", Resource: "helmreleases"},
+	{Group: "source.toolkit.fluxcd.io", Version: "v1", Resource: "helmrepositories"},
+	{Group: "source.toolkit.fluxcd.io", Version: "v1beta2", Resource: "ocirepositories"},
+	{Group: "argoproj.io", Version: "v1alpha1", Resource: "applications"},
+}
+
+// Charts returns the charts deployed by the resources in the manifests and the cluster
+func (d Discovery) Charts(ctx context.Context) ([]helm.Chart, error) {
+	objs, err := d.read()
+	if err != nil {
+		return nil, err
+	}
+	if d.Cluster {
+		listed, err := d.list(ctx)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, listed...)
+	}
+	return Parse(objs), nil
+}
+
+// read returns the resources in the manifests
+func (d Discovery) read() ([]unstructured.Unstructured, error) {
+	res := []unstructured.Unstructured{}
+	for _, m := range d.Manifests {
+		fs, err := filepath.Glob(m)
+		if err != nil {
+			return nil, fmt.Errorf("discovery: invalid manifest pattern %s :: %w", m, err)
+		}
+		if len(fs) == 0 {
+			return nil, fmt.Errorf("discovery: no manifests match %s", m)
+		}
+		sort.Strings(fs)
+		for _, f := range fs {
+			objs, err := decode(f)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, objs...)
+		}
+	}
+	return res, nil
+}
+
+// decode returns the resources in a multi-document YAML or JSON file
+func decode(file string) ([]unstructured.Unstructured, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: error reading manifest %s :: %w", file, err)
+	}
+	defer f.Close()
+
+	res := []unstructured.Unstructured{}
+	dec := yaml.NewYAMLOrJSONDecoder(f, 4096)
+	for {
+		obj := map[string]any{}
+		if err := dec.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return res, nil
+			}
+			return nil, fmt.Errorf("discovery: error decoding manifest %s :: %w", file, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+		res = append(res, unstructured.Unstructured{Object: obj})
+	}
+}
+
+// client connects to the cluster of the kubeconfig
+func (d Discovery) client() (dynamic.Interface, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = d.Kubeconfig
+	conf, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: d.Context}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("discovery: error loading kubeconfig :: %w", err)
+	}
+	client, err := dynamic.NewForConfig(conf)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: error creating kubernetes client :: %w", err)
+	}
+	return client, nil
+}
+
+// namespaces returns the namespaces to list resources in
+func (d Discovery) namespaces() []string {
+	if len(d.Namespaces) == 0 {
+		return []string{metav1.NamespaceAll}
+	}
+	return d.Namespaces
+}
+
+// list returns the resources in the cluster. Resources whose custom resource definition is not installed are skipped
+func (d Discovery) list(ctx context.Context) ([]unstructured.Unstructured, error) {
+	client, err := d.client()
+	if err != nil {
+		return nil, err
+	}
+	res := []unstructured.Unstructured{}
+	for _, r := range resources {
+		for _, ns := range d.namespaces() {
+			l, err := client.Resource(r).Namespace(ns).List(ctx, metav1.ListOptions{})
+			if apierrors.IsNotFound(err) {
+				slog.Debug("Resource not found in cluster", slog.String("resource", r.String()))
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("discovery: error listing %s :: %w", r.Resource, err)
+			}
+			res = append(res, l.Items...)
+		}
+	}
+	return res, nil
+}
+
+// Parse returns the charts deployed by the HelmReleases and Applications in the resources. The HelmRepositories and OCIRepositories
+// the HelmReleases reference must be in the resources. Releases of charts in Git repositories or buckets are skipped
+func Parse(objs []unstructured.Unstructured) []helm.Chart {
+	sources := map[string]unstructured.Unstructured{}
+	for _, o := range objs {
+		if g := o.GroupVersionKind().Group; g == "source.toolkit.fluxcd.io" {
+			sources[key(o.GetKind(), o.GetNamespace(), o.GetName())] = o
+		}
+	}
+
+	res := []helm.Chart{}
+	seen := map[string]bool{}
+	add := func(c helm.Chart) {
+		k := c.Repo.URL + "/" + c.Name + "@" + c.Version
+		if seen[k] {
+			return
+		}
+		seen[k] = true
+		res = append(res, c)
+	}
+	for _, o := range objs {
+		switch {
+		case o.GetKind() == "HelmRelease" && o.GroupVersionKind().Group == "helm.toolkit.fluxcd.io":
+			c, ok := release(o, sources)
+			if ok {
+				add(c)
+			}
+		case o.GetKind() == "Application" && o.GroupVersionKind().Group == "argoproj.io":
+			for _, c := range application(o) {
+				add(c)
+			}
+		}
+	}
+	return res
+}
+
+func key(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// release returns the chart of a Flux HelmRelease, from a HelmRepository with spec.chart or from an OCIRepository with spec.chartRef
+func release(o unstructured.Unstructured, sources map[string]unstructured.Unstructured) (helm.Chart, bool) {
+	id := key(o.GetKind(), o.GetNamespace(), o.GetName())
+	ref, ok, _ := unstructured.NestedStringMap(o.Object, "spec", "chartRef")
+	if !ok {
+		ref, _, _ = unstructured.NestedStringMap(o.Object, "spec", "chart", "spec", "sourceRef")
+	}
+	ns := ref["namespace"]
+	if ns == "" {
+		ns = o.GetNamespace()
+	}
+	src, ok := sources[key(ref["kind"], ns, ref["name"])]
+	if !ok {
+		slog.Warn("Skipping HelmRelease, its source is not a HelmRepository or OCIRepository found in the resources", slog.String("release", id), slog.String("source", key(ref["kind"], ns, ref["name"])))
+		return helm.Chart{}, false
+	}
+	url, _, _ := unstructured.NestedString(src.Object, "spec", "url")
+
+	// the newest release in the history is the version deployed
+	deployed := ""
+	if history, _, _ := unstructured.NestedSlice(o.Object, "status", "history"); len(history) > 0 {
+		if h, ok := history[0].(map[string]any); ok {
+			deployed, _, _ = unstructured.NestedString(h, "chartVersion")
+		}
+	}
+
+	switch src.GetKind() {
+	case "HelmRepository":
+		name, _, _ := unstructured.NestedString(o.Object, "spec", "chart", "spec", "chart")
+		version, _, _ := unstructured.NestedString(o.Object, "spec", "chart", "spec", "version")
+		return chart(name, version, deployed, src.GetName(), url), true
+	case "OCIRepository":
+		version, _, _ := unstructured.NestedString(src.Object, "spec", "ref", "tag")
+		if semver, _, _ := unstructured.NestedString(src.Object, "spec", "ref", "semver"); semver != "" {
+			version = semver
+		}
+		return chart(path.Base(url), version, deployed, src.GetName(), url), true
+	}
+	slog.Warn("Skipping HelmRelease, its source is not a HelmRepository or OCIRepository", slog.String("release", id), slog.String("kind", src.GetKind()))
+	return helm.Chart{}, false
+}
+
+// application returns the charts of the Helm sources of an ArgoCD Application. Sources in Git repositories are skipped
+func application(o unstructured.Unstructured) []helm.Chart {
+	// the revisions synced are in the order of the sources
+	srcs, _, _ := unstructured.NestedSlice(o.Object, "spec", "sources")
+	revisions, _, _ := unstructured.NestedStringSlice(o.Object, "status", "sync", "revisions")
+	if s, ok, _ := unstructured.NestedMap(o.Object, "spec", "source"); ok {
+		srcs = append(srcs, s)
+		r, _, _ := unstructured.NestedString(o.Object, "status", "sync", "revision")
+		revisions = append(make([]string, len(srcs)-1), r)
+	}
+
+	res := []helm.Chart{}
+	for n, s := range srcs {
+		m, ok := s.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _, _ := unstructured.NestedString(m, "chart")
+		url, _, _ := unstructured.NestedString(m, "repoURL")
+		if name == "" || url == "" {
+			continue
+		}
+		// ArgoCD configures the OCI registries of charts without a scheme
+		if !strings.Contains(url, "://") {
+			url = "oci://" + url
+		}
+		version, _, _ := unstructured.NestedString(m, "targetRevision")
+		deployed := ""
+		if n < len(revisions) {
+			deployed = revisions[n]
+		}
+		res = append(res, chart(name, version, deployed, repoName(url), url))
+	}
+	return res
+}
+
+// chart returns the chart with the repository. Releases with a version range deploy one version of the range: the version deployed,
+// as reported in the status of cluster resources, or else the latest version of the range. Releases without a version deploy the latest version of the chart
+func chart(name, version, deployed, repoName, url string) helm.Chart {
+	c := helm.Chart{
+		Name:    name,
+		Version: version,
+		Repo:    repo.Entry{Name: repoName, URL: url},
+	}
+	if exact(c.Version) {
+		return c
+	}
+	if exact(deployed) {
+		c.Version = deployed
+		return c
+	}
+	if c.Version == "" {
+		c.Version = "*"
+	}
+	c.Resolve = helm.ResolveLatest
+	return c
+}
+
+// exact reports whether the version is a single version, not a range
+func exact(version string) bool {
+	_, err := semver.Parse(strings.TrimPrefix(version, "v"))
+	return err == nil
+}
+
+var invalid = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
+
+// repoName names the repository after its URL, e.g. 'charts-bitnami-com-bitnami' for https://charts.bitnami.com/bitnami
+func repoName(url string) string {
+	if _, u, ok := strings.Cut(url, "://"); ok {
+		url = u
+	}
+	return strings.Trim(invalid.ReplaceAllString(url, "-"), "-")
+}
+
+// Merge adds the discovered charts not already in the charts
+func Merge(charts []helm.Chart, discovered []helm.Chart) []helm.Chart {
+	seen := map[string]bool{}
+	for _, c := range charts {
+		seen[c.Name+"@"+c.Version] = true
+	}
+	for _, c := range discovered {
+		if seen[c.Name+"@"+c.Version] {
+			continue
+		}
+		seen[c.Name+"@"+c.Version] = true
+		charts = append(charts, c)
+	}
+	return charts
+}
@@ -0,0 +1,205 @@
+package discovery
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"helm.sh/helm/v3/pkg/repo"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const flux = `apiVersion: source.toolkit.fluxcd.io/v1
+kind: HelmRepository
+metadata:
+  name: prometheus-community
+  namespace: flux-system
+spec:
+  url: https://prometheus-community.github.io/helm-charts
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: prometheus
+  namespace: monitoring
+spec:
+  chart:
+    spec:
+      chart: prometheus
+      version: 25.8.0
+      sourceRef:
+        kind: HelmRepository
+        name: prometheus-community
+        namespace: flux-system
+---
+apiVersion: source.toolkit.fluxcd.io/v1beta2
+kind: OCIRepository
+metadata:
+  name: podinfo
+  namespace: apps
+spec:
+  url: oci://ghcr.io/stefanprodan/charts/podinfo
+  ref:
+    semver: ">=6.0.0"
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: podinfo
+  namespace: apps
+spec:
+  chartRef:
+    kind: OCIRepository
+    name: podinfo
+status:
+  history:
+  - chartName: podinfo
+    chartVersion: 6.5.4
+  - chartName: podinfo
+    chartVersion: 6.5.3
+---
+apiVersion: helm.toolkit.fluxcd.io/v2
+kind: HelmRelease
+metadata:
+  name: internal
+  namespace: apps
+spec:
+  chart:
+    spec:
+      chart: ./charts/internal
+      sourceRef:
+        kind: GitRepository
+        name: apps
+`
+
+const argo = `apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: cert-manager
+  namespace: argocd
+spec:
+  source:
+    repoURL: https://charts.jetstack.io
+    chart: cert-manager
+    targetRevision: v1.14.4
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: envoy
+  namespace: argocd
+spec:
+  sources:
+  - repoURL: docker.io/envoyproxy
+    chart: gateway-helm
+  - repoURL: https://github.com/org/config.git
+    path: envoy
+    targetRevision: main
+---
+apiVersion: argoproj.io/v1alpha1
+kind: Application
+metadata:
+  name: loki
+  namespace: argocd
+spec:
+  source:
+    repoURL: https://grafana.github.io/helm-charts
+    chart: loki
+    targetRevision: 5.x
+`
+
+func TestCharts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "flux.yaml"), []byte(flux), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "argo.yaml"), []byte(argo), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	charts, err := Discovery{Manifests: []string{filepath.Join(dir, "*.yaml")}}.Charts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []helm.Chart{
+		{Name: "cert-manager", Version: "v1.14.4", Repo: repo.Entry{Name: "charts-jetstack-io", URL: "https://charts.jetstack.io"}},
+		{Name: "gateway-helm", Version: "*", Resolve: helm.ResolveLatest, Repo: repo.Entry{Name: "docker-io-envoyproxy", URL: "oci://docker.io/envoyproxy"}},
+		{Name: "loki", Version: "5.x", Resolve: helm.ResolveLatest, Repo: repo.Entry{Name: "grafana-github-io-helm-charts", URL: "https://grafana.github.io/helm-charts"}},
+		{Name: "prometheus", Version: "25.8.0", Repo: repo.Entry{Name: "prometheus-community", URL: "https://prometheus-community.github.io/helm-charts"}},
+		{Name: "podinfo", Version: "6.5.4", Repo: repo.Entry{Name: "podinfo", URL: "oci://ghcr.io/stefanprodan/charts/podinfo"}},
+	}
+	if !reflect.DeepEqual(charts, want) {
+		t.Errorf("got %+v, want %+v", charts, want)
+	}
+
+	if _, err := (Discovery{Manifests: []string{filepath.Join(dir, "*.json")}}).Charts(context.Background()); err == nil {
+		t.Error("expected an error for manifests matching no files")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	charts := []helm.Chart{{Name: "prometheus", Version: "25.8.0"}}
+	got := Merge(charts, []helm.Chart{{Name: "prometheus", Version: "25.8.0"}, {Name: "loki", Version: "5.38.0"}})
+	want := []helm.Chart{{Name: "prometheus", Version: "25.8.0"}, {Name: "loki", Version: "5.38.0"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPodImages(t *testing.T) {
+	pod := func(ns, name string, images ...string) unstructured.Unstructured {
+		cs := []any{}
+		for _, i := range images {
+			cs = append(cs, map[string]any{"name": "c", "image": i})
+		}
+		return unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Pod",
+			"metadata":   map[string]any{"namespace": ns, "name": name},
+			"spec": map[string]any{
+				"initContainers": []any{map[string]any{"name": "init", "image": "busybox"}},
+				"containers":     cs,
+			},
+		}}
+	}
+	is := PodImages([]unstructured.Unstructured{
+		pod("monitoring", "prometheus-0", "quay.io/prometheus/prometheus:v2.48.0"),
+		pod("monitoring", "prometheus-1", "quay.io/prometheus/prometheus:v2.48.0", "not a reference"),
+	})
+
+	got := map[string][]string{}
+	for i, paths := range is {
+		ref, err := i.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[ref] = paths
+	}
+	want := map[string][]string{
+		"docker.io/library/busybox:latest":      {"cluster:monitoring/Pod/prometheus-0", "cluster:monitoring/Pod/prometheus-1"},
+		"quay.io/prometheus/prometheus:v2.48.0": {"cluster:monitoring/Pod/prometheus-0", "cluster:monitoring/Pod/prometheus-1"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestApplicationRevisions(t *testing.T) {
+	o := unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "argoproj.io/v1alpha1",
+		"kind":       "Application",
+		"metadata":   map[string]any{"namespace": "argocd", "name": "monitoring"},
+		"spec": map[string]any{"sources": []any{
+			map[string]any{"repoURL": "https://github.com/org/config.git", "path": "monitoring", "targetRevision": "main"},
+			map[string]any{"repoURL": "https://prometheus-community.github.io/helm-charts", "chart": "prometheus", "targetRevision": ">=25.0.0"},
+		}},
+		"status": map[string]any{"sync": map[string]any{"revisions": []any{"4f1c2e9", "25.8.0"}}},
+	}}
+	charts := application(o)
+	if len(charts) != 1 || charts[0].Version != "25.8.0" || charts[0].Resolve != "" {
+		t.Errorf("want the deployed version, got %+v", charts)
+	}
+}
@@ -0,0 +1,5 @@
+/*
+Package discovery derives the charts to import from the GitOps resources deploying them, the Flux HelmReleases and the ArgoCD Applications
+in manifests or a live cluster, and the images of the pods running in a cluster, keeping the mirror in sync with what the clusters actually deploy.
+*/
+package discovery
@@ -0,0 +1,78 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/distribution/reference"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var pods = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// running selects the running pods. Completed and failed pods, e.g. of finished jobs, keep the images they ran, which are no longer used
+const running = "status.phase=Running"
+
+// Images returns the images of the running pods in the namespaces of the cluster. Their paths are the pods running them,
+// prefixed with 'cluster:' and the namespace, e.g. 'cluster:monitoring/Pod/prometheus-0'
+func (d Discovery) Images(ctx context.Context) (map[*registry.Image][]string, error) {
+	client, err := d.client()
+	if err != nil {
+		return nil, err
+	}
+	objs := []unstructured.Unstructured{}
+	for _, ns := range d.namespaces() {
+		l, err := client.Resource(pods).Namespace(ns).List(ctx, metav1.ListOptions{FieldSelector: running})
+		if err != nil {
+			return nil, fmt.Errorf("discovery: error listing pods :: %w", err)
+		}
+		objs = append(objs, l.Items...)
+	}
+	return PodImages(objs), nil
+}
+
+// PodImages returns the images of the containers, init containers and ephemeral containers of the pods.
+// References without a tag are imported as latest, like the cluster pulls them
+func PodImages(objs []unstructured.Unstructured) map[*registry.Image][]string {
+	images := map[string]*registry.Image{}
+	res := map[*registry.Image][]string{}
+	for _, o := range objs {
+		path := "cluster:" + o.GetNamespace() + "/Pod/" + o.GetName()
+		for _, field := range []string{"initContainers", "containers", "ephemeralContainers"} {
+			cs, _, _ := unstructured.NestedSlice(o.Object, "spec", field)
+			for _, c := range cs {
+				m, ok := c.(map[string]any)
+				if !ok {
+					continue
+				}
+				s, _, _ := unstructured.NestedString(m, "image")
+				ref, err := reference.ParseDockerRef(s)
+				if err != nil {
+					slog.Warn("Skipping image of pod", slog.String("pod", path), slog.String("image", s), slog.String("error", err.Error()))
+					continue
+				}
+				i, ok := images[ref.String()]
+				if !ok {
+					img, err := registry.RefToImage(ref.String())
+					if err != nil {
+						continue
+					}
+					i = &img
+					images[ref.String()] = i
+				}
+				if !slices.Contains(res[i], path) {
+					res[i] = append(res[i], path)
+				}
+				if !slices.Contains(i.Workloads, "Pod") {
+					i.Workloads = append(i.Workloads, "Pod")
+				}
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,4 @@
+/*
+Package events emits machine-readable progress events of a run as JSON lines, so external UIs and the Kubernetes operator can track the stages and the images of a run without parsing logs.
+*/
+package events
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+)
+
+type Type string
+
+const (
+	RunStarted     Type = "run.started"
+	RunCompleted   Type = "run.completed"
+	RunFailed      Type = "run.failed"
+	StageStarted   Type = "stage.started"
+	StageCompleted Type = "stage.completed"
+	StageFailed    Type = "stage.failed"
+	ItemCompleted  Type = "item.completed"
+	ItemFailed     Type = "item.failed"
+)
+
+// Event is a transition of the run, a stage or an item of a stage, e.g. an image pushed to the registries
+type Event struct {
+	Time time.Time `json:"time"`
+	Type Type      `json:"type"`
+	// Job is the name of the job of 'helmper batch' the event belongs to
+	Job   string `json:"job,omitempty"`
+	Stage string `json:"stage,omitempty"`
+	// Item is the chart or image reference the event is about, and Step what happened to it: discovered, scanned, pushed, patched or signed
+	Item string `json:"item,omitempty"`
+	Step string `json:"step,omitempty"`
+	// Done and Total count the items of the stage processed so far
+	Done  int    `json:"done,omitempty"`
+	Total int    `json:"total,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Emitter writes events as JSON lines. A nil emitter discards the events. It is safe to use concurrently
+type Emitter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	fn     func(Event)
+	closer io.Closer
+	failed bool
+}
+
+// Func returns an emitter calling f with every event, one at a time, e.g. to stream the events to clients
+func Func(f func(Event)) *Emitter {
+	return &Emitter{fn: f}
+}
+
+// New returns an emitter writing to w
+func New(w io.Writer) *Emitter {
+	return &Emitter{w: w}
+}
+
+// Job returns an emitter adding the name of the job to the events, and emitting them with e. The jobs of 'helmper batch' share e
+func (e *Emitter) Job(name string) *Emitter {
+	if e == nil {
+		return nil
+	}
+	return Func(func(ev Event) {
+		ev.Job = name
+		e.Emit(ev)
+	})
+}
+
+// Open returns an emitter writing to the target: '-' for stderr, so the events are not mixed with the tables written to stdout,
+// 'unix:///path' for a Unix socket, or a file events are appended to
+func Open(target string) (*Emitter, error) {
+	switch {
+	case target == "-":
+		return New(terminal.Stderr), nil
+	case strings.HasPrefix(target, "unix://"):
+		c, err := net.Dial("unix", strings.TrimPrefix(target, "unix://"))
+		if err != nil {
+			return nil, fmt.Errorf("events: error connecting to %s :: %w", target, err)
+		}
+		return &Emitter{w: c, closer: c}, nil
+	default:
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("events: error opening %s :: %w", target, err)
+		}
+		return &Emitter{w: f, closer: f}, nil
+	}
+}
+
+// Emit writes the event. A failure to write is logged once, and does not fail the run
+func (e *Emitter) Emit(ev Event) {
+	if e == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if e.fn != nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.fn(ev)
+		return
+	}
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.w.Write(append(b, '\n')); err != nil && !e.failed {
+		e.failed = true
+		slog.Warn("could not emit progress events", slog.String("error", err.Error()))
+	}
+}
+
+func (e *Emitter) Close() error {
+	if e == nil || e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
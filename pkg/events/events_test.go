@@ -0,0 +1,95 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestEmit(t *testing.T) {
+	var buf bytes.Buffer
+	e := New(&buf)
+	e.Emit(Event{Type: StageStarted, Stage: "import images", Total: 2})
+	e.Emit(Event{Type: ItemCompleted, Stage: "import images", Item: "docker.io/library/nginx:1.25", Done: 1, Total: 2})
+
+	var evs []Event
+	s := bufio.NewScanner(&buf)
+	for s.Scan() {
+		var ev Event
+		if err := json.Unmarshal(s.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		evs = append(evs, ev)
+	}
+	if len(evs) != 2 || evs[1].Item != "docker.io/library/nginx:1.25" || evs[1].Done != 1 || evs[0].Time.IsZero() {
+		t.Errorf("unexpected events %+v", evs)
+	}
+
+	// a nil emitter discards the events
+	var nilEmitter *Emitter
+	nilEmitter.Emit(Event{Type: RunStarted})
+}
+
+func TestFunc(t *testing.T) {
+	var evs []Event
+	e := Func(func(ev Event) { evs = append(evs, ev) })
+	e.Emit(Event{Type: RunStarted})
+	e.Emit(Event{Type: ItemCompleted, Stage: "scan", Item: "docker.io/library/nginx:1.25", Step: "scanned"})
+	if len(evs) != 2 || evs[1].Step != "scanned" || evs[0].Time.IsZero() {
+		t.Errorf("unexpected events %+v", evs)
+	}
+	if err := e.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOpenSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	lines := make(chan string, 1)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		s := bufio.NewScanner(c)
+		if s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+
+	e, err := Open("unix://" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Emit(Event{Type: RunStarted})
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ev Event
+	if err := json.Unmarshal([]byte(<-lines), &ev); err != nil || ev.Type != RunStarted {
+		t.Errorf("want run.started got %+v (%v)", ev, err)
+	}
+}
+
+func TestJob(t *testing.T) {
+	var evs []Event
+	e := Func(func(ev Event) { evs = append(evs, ev) })
+	e.Job("team-a").Emit(Event{Type: RunStarted})
+	e.Job("team-b").Emit(Event{Type: RunStarted})
+	if len(evs) != 2 || evs[0].Job != "team-a" || evs[1].Job != "team-b" || evs[0].Time.IsZero() {
+		t.Errorf("unexpected events %+v", evs)
+	}
+
+	var nilEmitter *Emitter
+	nilEmitter.Job("team-a").Emit(Event{Type: RunStarted})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io/fs"
 	"log"
 	"log/slog"
 	"net/url"
@@ -12,13 +13,11 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/ChristofferNissen/helmper/pkg/registry"
 	"github.com/ChristofferNissen/helmper/pkg/util/file"
 	"golang.org/x/xerrors"
 	"gopkg.in/yaml.v3"
-	"oras.land/oras-go/v2/registry/remote"
-	"oras.land/oras-go/v2/registry/remote/auth"
-	"oras.land/oras-go/v2/registry/remote/credentials"
-	"oras.land/oras-go/v2/registry/remote/retry"
+	helmregistry "helm.sh/helm/v3/pkg/registry"
 
 	"github.com/blang/semver/v4"
 	"helm.sh/helm/v3/pkg/action"
@@ -42,6 +41,15 @@ type Images struct {
 		FromValuePath string `json:"fromValuePath"`
 		To            string `json:"to"`
 	} `json:"modify"`
+	// Paths select values holding images the detection misses, e.g. images in environment variables
+	Paths []ImagePath `json:"paths"`
+}
+
+// ImagePath selects the values holding image references with a path like 'controller.extraEnv[*].value'.
+// Pattern extracts the references from the values, e.g. '--image=(\S+)', using the first group if it has one
+type ImagePath struct {
+	Path    string `json:"path"`
+	Pattern string `json:"pattern"`
 }
 
 type Chart struct {
@@ -52,9 +60,33 @@ type Chart struct {
 	Parent         *Chart
 	Images         *Images `json:"images"`
 	PlainHTTP      bool    `json:"plainHTTP"`
-	DepsCount      int
+	// Resolve is how a version range is resolved: 'all' (default) imports every matching version, 'latest' only the newest
+	// and 'newer' the versions newer than the newest version already in the registries
+	Resolve string `json:"resolve"`
+	// Latest limits the versions imported from the range to the newest N. Zero imports all of them
+	Latest int `json:"latest"`
+	// When is a condition including the chart in the run only on the clusters it matches. See Included
+	When string `json:"when"`
+	// CRDs includes the companion '<name>-crds' chart of the chart, if its repository has one. See CRDChart
+	CRDs bool `json:"crds"`
+	// CRDsChart overrides the companion chart included with CRDs, e.g. 'prometheus-operator-crds'
+	CRDsChart CRDsChart `json:"crdsChart"`
+	// Group is the stage the chart is imported in, when the charts are grouped
+	Group string `json:"group"`
+	// Preset is the built-in preset the chart is configured with, e.g. 'argo-cd' or 'argo-cd@v1'. See WithPreset
+	Preset    string `json:"preset"`
+	DepsCount int
+	// Source are the settings of the registry hosting OCI charts, e.g. credentials and proxy. Set by the pipeline from the source registries
+	Source registry.Source `json:"-"`
 }
 
+const (
+	// Version range resolution modes
+	ResolveAll    = "all"
+	ResolveLatest = "latest"
+	ResolveNewer  = "newer"
+)
+
 func DependencyToChart(d *chart.Dependency, p Chart) Chart {
 	return Chart{
 		Name: d.Name,
@@ -70,6 +102,14 @@ func DependencyToChart(d *chart.Dependency, p Chart) Chart {
 	}
 }
 
+// Root returns the chart the dependency belongs to, or the chart itself
+func (c Chart) Root() Chart {
+	for c.Parent != nil {
+		c = *c.Parent
+	}
+	return c
+}
+
 // AddChartRepositoryToHelmRepositoryFile adds repository to Helm repository.yml to enable querying/pull
 func (c Chart) AddToHelmRepositoryFile() (bool, error) {
 	config := cli.New()
@@ -133,51 +173,20 @@ func VersionsInRange(r semver.Range, c Chart) ([]string, error) {
 func (c Chart) ResolveVersions() ([]string, error) {
 
 	prefixV := strings.Contains(c.Version, "v")
-	version := strings.ReplaceAll(c.Version, "v", "")
+	constraint := strings.ReplaceAll(c.Version, "v", "")
+	if constraint == "*" {
+		// every version of the chart
+		constraint = ">=0.0.0"
+	}
 
-	r, err := semver.ParseRange(version)
+	r, err := semver.ParseRange(constraint)
 	if err != nil {
 		// not a semver range
 		return nil, err
 	}
 
-	if strings.HasPrefix(c.Repo.URL, "oci://") {
-		ref := strings.TrimPrefix(strings.TrimSuffix(c.Repo.URL, "/")+"/"+c.Name, "oci://")
-
-		repo, err := remote.NewRepository(ref)
-		if err != nil {
-			return []string{}, err
-		}
-
-		repo.PlainHTTP = c.PlainHTTP
-
-		// prepare authentication using Docker credentials
-		storeOpts := credentials.StoreOptions{}
-		credStore, err := credentials.NewStoreFromDocker(storeOpts)
-		if err != nil {
-			return []string{}, err
-		}
-		repo.Client = &auth.Client{
-			Client:     retry.DefaultClient,
-			Cache:      auth.NewCache(),
-			Credential: credentials.Credential(credStore), // Use the credentials store
-		}
-
-		vs := []semver.Version{}
-		err = repo.Tags(context.TODO(), "", func(tags []string) error {
-			for _, t := range tags {
-				s, err := semver.ParseTolerant(t)
-				if err != nil {
-					// non semver tag
-					continue
-				}
-				vs = append(vs, s)
-			}
-
-			semver.Sort(vs)
-
-			return nil
-		})
+	if c.IsOCI() {
+		vs, err := c.ociVersions(context.TODO())
 		if err != nil {
 			return []string{}, err
 		}
@@ -216,58 +225,108 @@ func (c Chart) ResolveVersions() ([]string, error) {
 	return VersionsInRange(r, c)
 }
 
-func (c Chart) ResolveVersion() (string, error) {
-
-	v := strings.ReplaceAll(c.Version, "*", "x")
-	r, err := semver.ParseRange(v)
-	if err != nil {
-		return "", err
+// pick returns the semantic versions newer than after, newest first, limited to the newest n. Zero n keeps all of them
+func pick(vs []string, n int, after *semver.Version) []string {
+	type version struct {
+		s  string
+		sv semver.Version
 	}
-
-	if strings.HasPrefix(c.Repo.URL, "oci://") {
-		ref := strings.TrimPrefix(strings.TrimSuffix(c.Repo.URL, "/")+"/"+c.Name, "oci://")
-
-		repo, err := remote.NewRepository(ref)
+	res := []version{}
+	for _, v := range vs {
+		sv, err := semver.ParseTolerant(v)
 		if err != nil {
-			return "", err
+			continue
 		}
+		if after != nil && !sv.GT(*after) {
+			continue
+		}
+		res = append(res, version{v, sv})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].sv.GT(res[j].sv) })
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
 
-		repo.PlainHTTP = c.PlainHTTP
+	out := make([]string, 0, len(res))
+	for _, v := range res {
+		out = append(out, v.s)
+	}
+	return out
+}
 
-		// prepare authentication using Docker credentials
-		storeOpts := credentials.StoreOptions{}
-		credStore, err := credentials.NewStoreFromDocker(storeOpts)
+// present returns the newest version of the chart already imported to the registries, or nil if there is none
+func (c Chart) present(ctx context.Context, registries []registry.Registry) *semver.Version {
+	var res *semver.Version
+	for _, r := range registries {
+		imported := Chart{
+			Name:      c.Name,
+			Repo:      repo.Entry{URL: "oci://" + r.URL + "/charts"},
+			PlainHTTP: r.PlainHTTP,
+		}
+		vs, err := imported.ociVersions(ctx)
 		if err != nil {
-			return "", err
+			// not imported yet
+			slog.Debug("could not list imported chart versions", slog.String("chart", imported.OCIReference()), slog.String("error", err.Error()))
+			continue
 		}
-		repo.Client = &auth.Client{
-			Client:     retry.DefaultClient,
-			Cache:      auth.NewCache(),
-			Credential: credentials.Credential(credStore), // Use the credentials store
+		if len(vs) > 0 && (res == nil || vs[len(vs)-1].GT(*res)) {
+			res = &vs[len(vs)-1]
 		}
+	}
+	return res
+}
 
-		vs := []semver.Version{}
-		err = repo.Tags(context.TODO(), "", func(tags []string) error {
-			for _, t := range tags {
-				s, err := semver.ParseTolerant(t)
-				if err != nil {
-					// non semver tag
-					continue
-				}
+// Versions resolves the version of the chart to the versions to import, according to Resolve and Latest.
+// With Resolve 'newer' only the versions newer than the newest version already imported to the registries are kept
+func (c Chart) Versions(ctx context.Context, registries []registry.Registry) ([]string, error) {
+	vs, err := c.ResolveVersions()
+	if err != nil {
+		// resolve Glob version
+		v, err := c.ResolveVersion()
+		if err != nil {
+			return nil, err
+		}
+		return []string{v}, nil
+	}
 
-				if r(s) {
-					vs = append(vs, s)
-				}
-			}
+	n := c.Latest
+	var after *semver.Version
+	switch c.Resolve {
+	case ResolveLatest:
+		n = 1
+	case ResolveNewer:
+		after = c.present(ctx, registries)
+	}
+	if n == 0 && after == nil {
+		return vs, nil
+	}
 
-			semver.Sort(vs)
+	res := pick(vs, n, after)
+	slog.Debug("Resolved chart versions", slog.String("chart", c.Name), slog.String("range", c.Version), slog.Any("versions", res))
+	return res, nil
+}
+
+func (c Chart) ResolveVersion() (string, error) {
+
+	v := strings.ReplaceAll(c.Version, "*", "x")
+	r, err := semver.ParseRange(v)
+	if err != nil {
+		return "", err
+	}
 
-			return nil
-		})
+	if c.IsOCI() {
+		all, err := c.ociVersions(context.TODO())
 		if err != nil {
 			return "", err
 		}
 
+		vs := []semver.Version{}
+		for _, s := range all {
+			if r(s) {
+				vs = append(vs, s)
+			}
+		}
+
 		if len(vs) > 0 {
 			return vs[len(vs)-1].String(), nil
 		}
@@ -315,54 +374,18 @@ func (c Chart) ResolveVersion() (string, error) {
 func (c Chart) LatestVersion() (string, error) {
 	config := cli.New()
 
-	if strings.HasPrefix(c.Repo.URL, "oci://") {
-
-		ref := strings.TrimPrefix(strings.TrimSuffix(c.Repo.URL, "/")+"/"+c.Name, "oci://")
-
-		repo, err := remote.NewRepository(ref)
+	if c.IsOCI() {
+		vs, err := c.ociVersions(context.TODO())
 		if err != nil {
 			return "", err
 		}
-
-		repo.PlainHTTP = c.PlainHTTP
-
-		// prepare authentication using Docker credentials
-		storeOpts := credentials.StoreOptions{}
-		credStore, err := credentials.NewStoreFromDocker(storeOpts)
-		if err != nil {
-			return "", err
-		}
-		repo.Client = &auth.Client{
-			Client:     retry.DefaultClient,
-			Cache:      auth.NewCache(),
-			Credential: credentials.Credential(credStore), // Use the credentials store
+		if len(vs) == 0 {
+			return "", xerrors.Errorf("no semver tags found for chart %s", c.OCIReference())
 		}
 
-		vPrefix := strings.Contains(c.Version, "v")
-		l := c.Version
-		err = repo.Tags(context.TODO(), "", func(tags []string) error {
-			vs := []semver.Version{}
-
-			for _, t := range tags {
-				s, err := semver.ParseTolerant(t)
-				if err != nil {
-					// non semver tag
-					continue
-				}
-				vs = append(vs, s)
-			}
-
-			semver.Sort(vs)
-			l = vs[len(vs)-1].String()
-
-			if vPrefix {
-				l = "v" + l
-			}
-
-			return nil
-		})
-		if err != nil {
-			return "", err
+		l := vs[len(vs)-1].String()
+		if strings.Contains(c.Version, "v") {
+			l = "v" + l
 		}
 
 		return l, nil
@@ -400,13 +423,13 @@ func (c Chart) LatestVersion() (string, error) {
 
 func (c Chart) pullTar() (string, error) {
 
-	if strings.HasPrefix(c.Repo.URL, "oci://") {
+	if c.IsOCI() {
 
 		settings := cli.New()
 
 		helmCacheHome := settings.EnvVars()["HELM_CACHE_HOME"]
 
-		ref := strings.TrimSuffix(c.Repo.URL, "/") + "/" + c.Name
+		ref := "oci://" + c.OCIReference()
 
 		version, vPrefix := strings.CutPrefix(c.Version, "v")
 		if vPrefix {
@@ -552,36 +575,80 @@ func (c Chart) CountDependencies() (int, error) {
 	return len(chartRef.Metadata.Dependencies), nil
 }
 
-func (c Chart) Push(registry string, insecure bool, plainHTTP bool) (string, error) {
+// PackageSize returns the size in bytes of the chart package, or of the chart directory for subcharts unpacked in their parent
+func (c Chart) PackageSize() (int64, error) {
+	path, err := c.Locate()
+	if err != nil {
+		return 0, err
+	}
 
-	settings := cli.New()
+	var size int64
+	err = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
 
-	HelmDriver := "configmap"
-	actionConfig := new(action.Configuration)
-	if err := actionConfig.Init(settings.RESTClientGetter(), settings.Namespace(), HelmDriver, slog.Info); err != nil {
-		slog.Error(fmt.Sprintf("%+v", err))
-		return "", err
+// registryClient creates a Helm registry client for the registry reading the credentials from credentialsFile, or the Helm credentials if empty
+func registryClient(r registry.Registry, credentialsFile string) (*helmregistry.Client, error) {
+	clientOpts := []helmregistry.ClientOption{
+		helmregistry.ClientOptEnableCache(true),
+	}
+	if credentialsFile != "" {
+		clientOpts = append(clientOpts, helmregistry.ClientOptCredentialsFile(credentialsFile))
+	}
+	if r.PlainHTTP {
+		clientOpts = append(clientOpts, helmregistry.ClientOptPlainHTTP())
+	}
+	if r.Insecure || r.CAFile != "" || r.CertFile != "" {
+		client, err := r.HTTPClient()
+		if err != nil {
+			return nil, err
+		}
+		clientOpts = append(clientOpts, helmregistry.ClientOptHTTPClient(client))
+	}
+	return helmregistry.NewClient(clientOpts...)
+}
+
+// pushOpts configures the push action. Helm only reads the default Helm credentials when pushing, so a registry client is created for any other credentials file
+func pushOpts(actionConfig *action.Configuration, r registry.Registry, credentialsFile string) ([]action.PushOpt, error) {
+	if credentialsFile != "" {
+		client, err := registryClient(r, credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		actionConfig.RegistryClient = client
 	}
 
+	return []action.PushOpt{
+		action.WithPushConfig(actionConfig),
+		action.WithTLSClientConfig(os.ExpandEnv(r.CertFile), os.ExpandEnv(r.KeyFile), os.ExpandEnv(r.CAFile)),
+		action.WithInsecureSkipTLSVerify(r.Insecure),
+		action.WithPlainHTTP(r.PlainHTTP),
+	}, nil
+}
+
+// Push the chart to the registry at url. credentialsFile is a Docker config file with the credentials for the registry, or empty to use the Helm credentials
+func (c Chart) Push(url string, insecure bool, plainHTTP bool, credentialsFile string) (string, error) {
 	path, err := c.pullTar()
 	if err != nil {
 		return "", err
 	}
 	defer os.Remove(path)
 
-	opts := []action.PushOpt{
-		action.WithPushConfig(actionConfig),
-		action.WithInsecureSkipTLSVerify(insecure),
-		action.WithPlainHTTP(plainHTTP),
-	}
-	push := action.NewPushWithOpts(opts...)
-	push.Settings = settings
-
-	out, res := push.Run(path, registry)
-	return out, res
+	return pushPackage(path, url, registry.Registry{Insecure: insecure, PlainHTTP: plainHTTP}, credentialsFile)
 }
 
-func (c Chart) PushAndModify(registry string, insecure bool, plainHTTP bool) (string, error) {
+// pushPackage pushes the packaged chart at path to url in the registry
+func pushPackage(path string, url string, r registry.Registry, credentialsFile string) (string, error) {
 
 	settings := cli.New()
 
@@ -592,6 +659,33 @@ func (c Chart) PushAndModify(registry string, insecure bool, plainHTTP bool) (st
 		return "", err
 	}
 
+	opts, err := pushOpts(actionConfig, r, credentialsFile)
+	if err != nil {
+		return "", err
+	}
+	push := action.NewPushWithOpts(opts...)
+	push.Settings = settings
+
+	out, res := push.Run(path, url)
+	return out, res
+}
+
+// PushAndModify pushes the chart with the image references in the values replaced by the registry, and the pinned images referenced by digest.
+// With flatten, the images are referenced without the path of their source repository. Image references are found by the keys of the patterns,
+// so without patterns only the repositories of the dependencies are replaced
+func (c Chart) PushAndModify(url string, insecure bool, plainHTTP bool, credentialsFile string, flatten bool, pins []Pin, patterns Patterns) (string, error) {
+	path, err := c.Modify(url, url, flatten, pins, patterns)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(path)
+
+	return pushPackage(path, url, registry.Registry{Insecure: insecure, PlainHTTP: plainHTTP}, credentialsFile)
+}
+
+// Modify packages the chart with the repositories of the dependencies replaced by the repository, and the image references in the values
+// replaced by the registry like PushAndModify. It returns the path of the package, which the caller removes
+func (c Chart) Modify(repository string, registry string, flatten bool, pins []Pin, patterns Patterns) (string, error) {
 	path, err := c.pullTar()
 	if err != nil {
 		return "", err
@@ -622,19 +716,11 @@ func (c Chart) PushAndModify(registry string, insecure bool, plainHTTP bool) (st
 			slog.Debug("Leaving embedded chart as is", slog.String("Chart", d.Name))
 		case d.Repository != "":
 
-			// Change dependency ref to registry being imported to
-			d.Repository = registry
-
-			if strings.Contains(d.Version, "*") || strings.Contains(d.Version, "x") {
-				chart := DependencyToChart(d, c)
+			// the version imported with the chart, as OCI dependencies can not use globs in version
+			d.Version = dependencyVersion(chartRef, d, c)
 
-				// OCI dependencies can not use globs in version
-				// Resolve Globs to latest patch
-				v, err := chart.ResolveVersion()
-				if err == nil {
-					d.Version = v
-				}
-			}
+			// Change dependency ref to repository being imported to
+			d.Repository = repository
 		}
 
 	}
@@ -661,7 +747,8 @@ func (c Chart) PushAndModify(registry string, insecure bool, plainHTTP bool) (st
 	}
 
 	// Image References in values.yaml
-	replaceImageReferences(chartRef.Values, registry)
+	replaceImageReferences(chartRef.Values, registry, flatten, patterns)
+	pinImages(chartRef.Values, pins, patterns)
 	for _, r := range chartRef.Raw {
 		if r.Name == "values.yaml" {
 			d, _ := yaml.Marshal(chartRef.Values)
@@ -670,22 +757,7 @@ func (c Chart) PushAndModify(registry string, insecure bool, plainHTTP bool) (st
 	}
 
 	// Save Helm Chart to Filesystem before push
-	path, err = chartutil.Save(chartRef, "/tmp/")
-	if err != nil {
-		return "", err
-	}
-
-	// Push Modified Helm Chart
-	opts := []action.PushOpt{
-		action.WithPushConfig(actionConfig),
-		action.WithInsecureSkipTLSVerify(insecure),
-		action.WithPlainHTTP(plainHTTP),
-	}
-	push := action.NewPushWithOpts(opts...)
-	push.Settings = settings
-
-	out, res := push.Run(path, registry)
-	return out, res
+	return chartutil.Save(chartRef, os.TempDir())
 }
 
 func (c Chart) Pull() (string, error) {
@@ -758,9 +830,9 @@ func (c Chart) Locate() (string, error) {
 	helmCacheHome := config.EnvVars()["HELM_CACHE_HOME"]
 
 	switch {
-	case strings.HasPrefix(c.Repo.URL, "oci://"):
+	case c.IsOCI():
 
-		ref := strings.TrimSuffix(c.Repo.URL, "/") + "/" + c.Name
+		ref := "oci://" + c.OCIReference()
 
 		co := action.ChartPathOptions{
 			CaFile:                c.Repo.CAFile,
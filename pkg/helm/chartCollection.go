@@ -1,11 +1,15 @@
 package helm
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"log/slog"
 	"strings"
 
+	"github.com/ChristofferNissen/helmper/pkg/registry"
 	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli"
 )
 
@@ -15,7 +19,7 @@ type ChartCollection struct {
 
 func (collection ChartCollection) pull() error {
 	for _, chart := range collection.Charts {
-		if strings.HasPrefix(chart.Repo.URL, "oci://") {
+		if chart.IsOCI() {
 			continue
 		}
 		if _, err := chart.Pull(); err != nil {
@@ -27,7 +31,7 @@ func (collection ChartCollection) pull() error {
 
 func (collection ChartCollection) addToHelmRepositoryConfig() error {
 	for _, c := range collection.Charts {
-		if strings.HasPrefix(c.Repo.URL, "oci://") {
+		if c.IsOCI() {
 			continue
 		}
 		_, err := c.AddToHelmRepositoryFile()
@@ -75,16 +79,10 @@ func (collection ChartCollection) SetupHelm(setters ...Option) (ChartCollection,
 	// Expand collection if semantic version range
 	res := []Chart{}
 	for _, c := range collection.Charts {
-		vs, err := c.ResolveVersions()
+		vs, err := c.Versions(context.TODO(), args.Registries)
 		if err != nil {
-			// resolve Glob version
-			v, err := c.ResolveVersion()
-			if err != nil {
-				slog.Info("version is not semver. skipping this version", slog.String("name", c.Name), slog.String("version", c.Version))
-				continue
-			}
-			c.Version = v
-			res = append(res, c)
+			slog.Info("version is not semver. skipping this version", slog.String("name", c.Name), slog.String("version", c.Version))
+			continue
 		}
 
 		for _, v := range vs {
@@ -95,6 +93,12 @@ func (collection ChartCollection) SetupHelm(setters ...Option) (ChartCollection,
 	}
 	collection.Charts = res
 
+	// Include the CRD charts of the charts
+	collection.Charts, err = collection.withCRDCharts(context.TODO())
+	if err != nil {
+		return ChartCollection{}, err
+	}
+
 	// Pull Helm Charts
 	err = collection.pull()
 	if err != nil {
@@ -106,3 +110,93 @@ func (collection ChartCollection) SetupHelm(setters ...Option) (ChartCollection,
 
 	return collection, nil
 }
+
+// withCRDCharts adds the companion CRD charts of the charts configured with CRDs, unless they are configured already
+func (collection ChartCollection) withCRDCharts(ctx context.Context) ([]Chart, error) {
+	res := collection.Charts
+	seen := map[string]bool{}
+	for _, c := range collection.Charts {
+		seen[c.Name+":"+c.Version] = true
+	}
+	for _, c := range collection.Charts {
+		if !c.CRDs {
+			continue
+		}
+		crds, ok, err := c.CRDChart(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("helm: error looking up CRD chart of %s :: %w", c.Name, err)
+		}
+		if !ok {
+			slog.Info("no CRD chart found", slog.String("chart", c.Name), slog.String("version", c.Version))
+			continue
+		}
+		if seen[crds.Name+":"+crds.Version] {
+			continue
+		}
+		seen[crds.Name+":"+crds.Version] = true
+		slog.Info("including CRD chart", slog.String("chart", c.Name), slog.String("crds", crds.Name), slog.String("version", crds.Version))
+		res = append(res, crds)
+	}
+	return res, nil
+}
+
+// Refs returns the references of the charts and their remote dependencies in the registry, by digest.
+// In dry-run the charts are not in the registry, so they are referenced by tag
+func (collection ChartCollection) Refs(ctx context.Context, r registry.Registry, dryRun bool) ([]string, error) {
+	resolve := func(name string, version string) (string, error) {
+		if dryRun {
+			return fmt.Sprintf("%s/%s:%s", r.URL, name, registry.OCITag(version)), nil
+		}
+		d, err := r.Fetch(ctx, name, registry.OCITag(version))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s/%s@%s", r.URL, name, d.Digest), nil
+	}
+
+	refs := []string{}
+	for _, c := range collection.Charts {
+		if root := c.Root(); !r.Route.Chart(root.Name, root.Version) {
+			continue
+		}
+		ref, err := resolve(fmt.Sprintf("charts/%s", c.Name), c.Version)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+
+		// Get remote Helm Chart using Helm SDK
+		path, err := c.Locate()
+		if err != nil {
+			return nil, err
+		}
+
+		// Get detailed information about the chart
+		chartRef, err := loader.Load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range chartRef.Metadata.Dependencies {
+			if !(d.Repository == "" || strings.HasPrefix(d.Repository, "file://")) {
+				v := d.Version
+				if strings.Contains(v, "*") || strings.Contains(v, "x") {
+					chart := DependencyToChart(d, c)
+
+					// Resolve Globs to latest patch
+					v, err = chart.ResolveVersion()
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				ref, err := resolve(fmt.Sprintf("charts/%s", d.Name), v)
+				if err != nil {
+					return nil, err
+				}
+				refs = append(refs, ref)
+			}
+		}
+	}
+	return refs, nil
+}
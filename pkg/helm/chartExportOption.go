@@ -0,0 +1,80 @@
+package helm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// ChartExportOption stores the charts and their dependencies in a bundle instead of pushing them to registries
+type ChartExportOption struct {
+	ChartCollection *ChartCollection
+	Bundle          *registry.Bundle
+}
+
+// export the packaged chart to the bundle
+func (c Chart) export(ctx context.Context, b *registry.Bundle) error {
+	path, err := c.pullTar()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	chartRef, err := loader.Load(path)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(chartRef.Metadata)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.AddChart(ctx, c.Name, c.Version, config, data)
+	return err
+}
+
+func (opt ChartExportOption) Run(ctx context.Context, setters ...Option) error {
+
+	// Default Options
+	args := &Options{
+		Verbose:    false,
+		Update:     false,
+		K8SVersion: "1.27.16",
+	}
+
+	for _, setter := range setters {
+		setter(args)
+	}
+
+	charts, err := withDependencies(opt.ChartCollection, args.Update)
+	if err != nil {
+		return err
+	}
+
+	bar := terminal.NewBar(len(charts), "Exporting charts...\r")
+
+	for _, c := range charts {
+		if c.Name == "images" {
+			continue
+		}
+
+		if err := c.export(ctx, opt.Bundle); err != nil {
+			return fmt.Errorf("helm: error exporting chart %s to bundle %s :: %w", c.Name, opt.Bundle.Path, err)
+		}
+		slog.Debug("Exported chart to bundle", slog.String("chart", c.Name), slog.String("version", c.Version))
+
+		_ = bar.Add(1)
+	}
+
+	return bar.Finish()
+}
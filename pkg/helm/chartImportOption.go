@@ -5,129 +5,217 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"sort"
 	"strings"
 
+	"github.com/ChristofferNissen/helmper/pkg/plan"
 	"github.com/ChristofferNissen/helmper/pkg/registry"
-	"github.com/k0kubun/go-ansi"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
 	"github.com/schollz/progressbar/v3"
 )
 
+// validate pushed chart against the OCI specification, if the registry requires conformant content
+func validate(ctx context.Context, r registry.Registry, c Chart) error {
+	if !r.Strict {
+		return nil
+	}
+	return r.Validate(ctx, "charts/"+c.Name, registry.OCITag(c.Version))
+}
+
+// withDependencies returns the charts and their remote dependencies, including the dependencies of dependencies.
+// Dependencies come before the charts depending on them
+func withDependencies(collection *ChartCollection, update bool) ([]Chart, error) {
+	charts := []Chart{}
+	// We need all dependencies for the chart to be available in the registry to do 'helm dep up', so disabled dependencies are imported too
+	seen := map[string]bool{}
+	for _, c := range collection.Charts {
+
+		_, chartRef, _, err := c.Read(update)
+		if err != nil {
+			return nil, err
+		}
+
+		c.DepsCount = len(chartRef.Metadata.Dependencies)
+		charts = append(charts, transitiveDependencies(chartRef, c, seen)...)
+		charts = append(charts, c)
+	}
+
+	return charts, nil
+}
+
 type ChartImportOption struct {
 	Registries      []registry.Registry
 	ChartCollection *ChartCollection
 	All             bool
 	ModifyRegistry  bool
+	// PinImages are the images of each chart to reference by digest in the values of the modified charts. Requires ModifyRegistry
+	PinImages ChartData
+	// RewriteDependencies replaces the repositories of the dependencies with the registry, also without ModifyRegistry
+	RewriteDependencies bool
+
+	// OnFallback is called when a chart is pushed to the fallback of a registry instead of the registry, with the chart as
+	// 'charts/<name>:<version>'
+	OnFallback func(registry.Fallback)
+
+	// DryRun records the pushes in Plan instead of performing them
+	DryRun bool
+	Plan   *plan.Plan
 }
 
-func (opt ChartImportOption) Run(ctx context.Context, setters ...Option) error {
+// pushTo pushes the chart with every pusher of the registry, or to the fallback of the registry when a push fails
+func (opt ChartImportOption) pushTo(ctx context.Context, c Chart, r registry.Registry, credentialsFiles map[string]string, args *Options) error {
+	push := func(r registry.Registry) error {
+		for _, pusher := range Pushers(r, credentialsFiles[r.URL]) {
+			if err := opt.push(ctx, c, r, pusher, args); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-	// Default Options
-	args := &Options{
-		Verbose:    false,
-		Update:     false,
-		K8SVersion: "1.27.16",
+	err := push(r)
+	if err == nil || r.Fallback == nil || opt.DryRun {
+		return err
+	}
+	if ferr := push(*r.Fallback); ferr != nil {
+		return fmt.Errorf("%w, and to the fallback registry %s :: %w", err, r.Fallback.URL, ferr)
+	}
+	slog.Warn("pushed chart to the fallback registry", slog.String("chart", c.Name), slog.String("version", c.Version), slog.String("registry", r.URL), slog.String("fallback", r.Fallback.URL), slog.String("error", err.Error()))
+	if opt.OnFallback != nil {
+		opt.OnFallback(registry.Fallback{Image: "charts/" + c.Name + ":" + c.Version, Registry: r.URL, Fallback: r.Fallback.URL, Err: err})
 	}
+	return nil
+}
 
-	for _, setter := range setters {
-		setter(args)
+// pins returns the images of the chart pinned to their digest in the registry. Images not present in the registry keep the digest they were pinned to at the source
+func (opt ChartImportOption) pins(ctx context.Context, c Chart, r registry.Registry) []Pin {
+	pins := []Pin{}
+	for chart, m := range opt.PinImages {
+		if chart.Name != c.Name || chart.Version != c.Version {
+			continue
+		}
+		for i, paths := range m {
+			digest := i.Digest
+			if name, err := i.ImageName(); err == nil {
+				tag, _, _ := strings.Cut(i.Tag, "@")
+				if d, err := r.Fetch(ctx, name, tag); err == nil {
+					digest = d.Digest.String()
+				}
+			}
+			if digest == "" {
+				slog.Debug("image has no digest. leaving reference as is", slog.String("chart", c.Name), slog.String("repository", i.Repository), slog.String("tag", i.Tag))
+				continue
+			}
+			pins = append(pins, Pin{Paths: paths, Tag: i.Tag, Digest: digest, Retagged: i.Retagged})
+		}
 	}
+	return pins
+}
 
-	charts := []Chart{}
-	for _, c := range opt.ChartCollection.Charts {
+// push pushes the chart with the pusher of the registry, modifying it first if configured
+func (opt ChartImportOption) push(ctx context.Context, c Chart, r registry.Registry, pusher ChartPusher, args *Options) error {
+	if !opt.All {
+		exists, err := pusher.Exists(ctx, c.Name, c.Version)
+		if err != nil {
+			return err
+		}
+		if exists {
+			slog.Info("Chart already present in registry. Skipping import", slog.String("chart", c.Name), slog.String("repository", pusher.URL()), slog.String("version", c.Version))
+			return nil
+		}
+	}
+
+	if opt.DryRun {
+		a := plan.Action{
+			Kind:      plan.PushChart,
+			Source:    c.Name,
+			Version:   c.Version,
+			Repo:      c.Repo.URL,
+			Target:    pusher.URL(),
+			Insecure:  r.Insecure,
+			PlainHTTP: r.PlainHTTP,
+		}
+		if h, ok := pusher.(HTTPPusher); ok {
+			a.RepositoryType, a.Insecure, a.PlainHTTP = h.Repository.Type, h.Repository.Insecure, false
+		}
+		opt.Plan.Add(a)
+		return nil
+	}
 
-		_, chartRef, _, err := c.Read(args.Update)
+	var path string
+	var err error
+	if opt.ModifyRegistry || opt.RewriteDependencies {
+		// only the dependencies are rewritten without ModifyRegistry
+		pins, patterns := []Pin(nil), Patterns{}
+		if opt.ModifyRegistry {
+			pins, patterns = opt.pins(ctx, c, r), DefaultPatterns().With(args.Patterns)
+		}
+		path, err = c.Modify(pusher.URL(), "oci://"+r.URL+"/charts", r.Flatten, pins, patterns)
+		if err != nil {
+			return fmt.Errorf("helm: error modifying chart %s for %s :: %w", c.Name, pusher.URL(), err)
+		}
+	} else {
+		path, err = c.pullTar()
 		if err != nil {
 			return err
 		}
+	}
+	defer os.Remove(path)
 
-		c.DepsCount = len(chartRef.Metadata.Dependencies)
-		charts = append(charts, c)
+	return pusher.Push(ctx, c, path)
+}
+
+func (opt ChartImportOption) Run(ctx context.Context, setters ...Option) error {
 
-		for _, d := range chartRef.Metadata.Dependencies {
+	// Default Options
+	args := &Options{
+		Verbose:    false,
+		Update:     false,
+		K8SVersion: "1.27.16",
+	}
 
-			// We need all dependencies for the chart to be available in the registry to do 'helm dpt up'
-			// if !ConditionMet(d.Condition, values) {
-			// 	slog.Debug("Skipping disabled chart", slog.String("chart", d.Name), slog.String("condition", d.Condition))
-			// 	continue
-			// }
+	for _, setter := range setters {
+		setter(args)
+	}
 
-			// only import remote charts
-			if d.Repository == "" || strings.HasPrefix(d.Repository, "file://") {
-				// Embedded in parent chart
-				slog.Debug("Skipping embedded chart", slog.String("chart", d.Name), slog.String("parent", c.Name))
-				continue
-			}
+	charts, err := withDependencies(opt.ChartCollection, args.Update)
+	if err != nil {
+		return err
+	}
 
-			chart := DependencyToChart(d, c)
+	bar := terminal.NewBar(len(charts), "Pushing charts...\r", progressbar.OptionSetElapsedTime(true))
 
-			// Resolve Globs to latest patch
-			if strings.Contains(chart.Version, "*") {
-				v, err := chart.ResolveVersion()
-				if err == nil {
-					chart.Version = v
-				}
+	// Helm reads credentials from files only
+	credentialsFiles := make(map[string]string, len(opt.Registries))
+	for _, r := range opt.Registries {
+		rs := []registry.Registry{r}
+		if r.Fallback != nil {
+			rs = append(rs, *r.Fallback)
+		}
+		for _, r := range rs {
+			f, cleanup, err := r.CredentialsFile()
+			if err != nil {
+				return err
 			}
-
-			charts = append(charts, chart)
+			defer cleanup()
+			credentialsFiles[r.URL] = f
 		}
 	}
 
-	// Sort charts according to least dependencies
-	sort.Slice(charts, func(i, j int) bool { return charts[i].DepsCount < charts[j].DepsCount })
-
-	bar := progressbar.NewOptions(len(charts),
-		progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetElapsedTime(true),
-		progressbar.OptionSetDescription("Pushing charts...\r"),
-		progressbar.OptionShowDescriptionAtLineEnd(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
-
 	for _, c := range charts {
 
 		if c.Name == "images" {
 			continue
 		}
 
+		root := c.Root()
 		for _, r := range opt.Registries {
-			registryURL := "oci://" + r.URL + "/charts"
-			if !opt.All {
-				_, err := r.Exist(ctx, "charts/"+c.Name, c.Version)
-				if err == nil {
-					slog.Info("Chart already present in registry. Skipping import", slog.String("chart", "charts/"+c.Name), slog.String("registry", "oci://"+r.URL), slog.String("version", c.Version))
-					continue
-				}
-				slog.Debug(err.Error())
-			}
-
-			if opt.ModifyRegistry {
-				res, err := c.PushAndModify(registryURL, r.Insecure, r.PlainHTTP)
-				if err != nil {
-					return fmt.Errorf("helm: error pushing and modifying chart %s to registry %s :: %w", c.Name, registryURL, err)
-				}
-				slog.Debug(res)
-
+			if !r.Route.Chart(root.Name, root.Version) {
+				slog.Debug("chart not routed to registry", slog.String("chart", c.Name), slog.String("registry", r.Name))
 				continue
 			}
-
-			res, err := c.Push(registryURL, r.Insecure, r.PlainHTTP)
-			if err != nil {
-				return fmt.Errorf("helm: error pushing chart %s to registry %s :: %w", c.Name, registryURL, err)
+			if err := opt.pushTo(ctx, c, r, credentialsFiles, args); err != nil {
+				return err
 			}
-			slog.Debug(res)
-
 		}
 
 		_ = bar.Add(1)
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"log"
 	"log/slog"
-	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/ChristofferNissen/helmper/pkg/registry"
-	"github.com/k0kubun/go-ansi"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/util/tracing"
 	"github.com/schollz/progressbar/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/xerrors"
 	"helm.sh/helm/v3/pkg/chart"
@@ -32,16 +36,21 @@ func IdentifyImportCandidates(ctx context.Context, registries []registry.Registr
 
 	for c, imageMap := range chartImageValuesMap {
 
-		if all || func(rs []registry.Registry) bool {
+		// dependencies follow the routes of the charts depending on them
+		root := c.Root()
+		routed := slices.DeleteFunc(slices.Clone(registries), func(r registry.Registry) bool {
+			return !r.Route.Chart(root.Name, root.Version)
+		})
+		if len(routed) > 0 && (all || func(rs []registry.Registry) bool {
 			importChart := false
-			registryChartStatusMap := registry.Exists(ctx, fmt.Sprintf("charts/%s", c.Name), c.Version, rs)
+			registryChartStatusMap := registry.Exists(ctx, fmt.Sprintf("charts/%s", c.Name), registry.OCITag(c.Version), rs)
 			// loop over registries
 			for _, r := range rs {
 				existsInRegistry := registryChartStatusMap[r.URL]
 				importChart = importChart || !existsInRegistry
 			}
 			return importChart
-		}(registries) {
+		}(routed)) {
 			if c.Name != "images" {
 				cs = append(cs, c)
 			}
@@ -71,7 +80,7 @@ func IdentifyImportCandidates(ctx context.Context, registries []registry.Registr
 					importImage = importImage || !imageExistsInRegistry
 				}
 				return importImage
-			}(registries) {
+			}(i.RoutedTo(registries)) {
 				imgs = append(imgs, *i)
 			}
 		}
@@ -88,18 +97,30 @@ type chartInfo struct {
 
 type imageInfo struct {
 	available  bool
+	skipped    bool
 	chart      *Chart
 	image      *registry.Image
 	collection *[]string
 }
 
+// tracer traces the parsing of charts. Spans are only exported when tracing is enabled
+var tracer = otel.Tracer("github.com/ChristofferNissen/helmper/pkg/helm")
+
 type ChartOption struct {
 	ChartCollection *ChartCollection
 	IdentifyImages  bool
 	UseCustomValues bool
+	// RenderedOnly skips images not referenced by any workload in the chart rendered with the values
+	RenderedOnly bool
+	// Skipped collects the images skipped by RenderedOnly, if set
+	Skipped *ChartData
+	// RenderedImages adds the images referenced in the rendered chart but not found in the values, e.g. hardcoded in templates
+	RenderedImages bool
+	// Sources are the settings of the registries the images are looked up in
+	Sources registry.Sources
 }
 
-func determineTag(ctx context.Context, img *registry.Image, plainHTTP bool) bool {
+func determineTag(ctx context.Context, ss registry.Sources, img *registry.Image, plainHTTP bool) bool {
 
 	reg, repo, name := img.Elements()
 	ref := fmt.Sprintf("%s/%s/%s", reg, repo, name)
@@ -109,12 +130,12 @@ func determineTag(ctx context.Context, img *registry.Image, plainHTTP bool) bool
 		tag = img.Digest
 	}
 
-	available, _ := registry.Exist(ctx, ref, tag, plainHTTP)
+	available, _ := registry.Exist(ctx, ss, ref, tag, plainHTTP)
 	if available {
 		return true
 	}
 
-	available, _ = registry.Exist(ctx, ref, "v"+img.Tag, plainHTTP)
+	available, _ = registry.Exist(ctx, ss, ref, "v"+img.Tag, plainHTTP)
 	if available {
 		img.Tag = "v" + img.Tag
 		return true
@@ -189,6 +210,7 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 	for _, setter := range setters {
 		setter(args)
 	}
+	patterns := DefaultPatterns().With(args.Patterns)
 
 	eg, egCtx := errgroup.WithContext(ctx)
 
@@ -204,37 +226,12 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 				return nil
 			}
 
-			bar := progressbar.NewOptions(len(charts.Charts),
-				progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-				progressbar.OptionEnableColorCodes(true),
-				progressbar.OptionShowCount(),
-				progressbar.OptionOnCompletion(func() {
-					fmt.Fprint(os.Stderr, "\n")
-				}),
-				progressbar.OptionSetWidth(15),
-				progressbar.OptionSetElapsedTime(true),
-				progressbar.OptionSetDescription("Parsing charts...\r"),
-				progressbar.OptionShowDescriptionAtLineEnd(),
-				progressbar.OptionSetTheme(progressbar.Theme{
-					Saucer:        "[green]=[reset]",
-					SaucerHead:    "[green]>[reset]",
-					SaucerPadding: " ",
-					BarStart:      "[",
-					BarEnd:        "]",
-				}))
-
-			for _, c := range charts.Charts {
+			bar := terminal.NewBar(len(charts.Charts), "Parsing charts...\r", progressbar.OptionSetElapsedTime(true))
 
-				path, chartRef, values, err := c.Read(args.Update)
-				if err != nil {
-					return err
-				}
+			// subCharts passes on the enabled dependencies of the chart, and their dependencies, with the values of the chart
+			var subCharts func(chartRef *chart.Chart, c Chart, path string, values map[string]any) error
+			subCharts = func(chartRef *chart.Chart, c Chart, path string, values map[string]any) error {
 				bar.ChangeMax(bar.GetMax() + len(chartRef.Metadata.Dependencies))
-
-				_ = bar.Add(1)
-				channel <- &chartInfo{chartRef, &c}
-
-				// Look at SubCharts if they are enabled (chart dependency condition satisfied in values.yaml)
 				for _, d := range chartRef.Metadata.Dependencies {
 
 					// subchart enabled in main chart?
@@ -257,14 +254,50 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 					if err != nil {
 						return err
 					}
-					chartRef, err := loader.Load(scPath)
+					scRef, err := loader.Load(scPath)
 					if err != nil {
 						return err
 					}
 
 					_ = bar.Add(1)
-					channel <- &chartInfo{chartRef, &subChart}
+					channel <- &chartInfo{scRef, &subChart}
+
+					// the values of the subchart are the section of the parent chart values, over the subchart defaults
+					key := d.Name
+					if d.Alias != "" {
+						key = d.Alias
+					}
+					scValues := map[string]any{}
+					if vs, ok := values[key].(map[string]any); ok {
+						for k, v := range vs {
+							scValues[k] = v
+						}
+					}
+					if err := subCharts(scRef, subChart, scPath, chartutil.CoalesceTables(scValues, scRef.Values)); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			for _, c := range charts.Charts {
+
+				_, span := tracer.Start(egCtx, "helm.parse", trace.WithAttributes(
+					attribute.String("chart", c.Name),
+					attribute.String("version", c.Version),
+				))
+				path, chartRef, values, err := c.Read(args.Update)
+				tracing.End(span, err)
+				if err != nil {
+					return err
+				}
+
+				_ = bar.Add(1)
+				channel <- &chartInfo{chartRef, &c}
 
+				// Look at SubCharts if they are enabled (chart dependency condition satisfied in values.yaml)
+				if err := subCharts(chartRef, c, path, values); err != nil {
+					return err
 				}
 			}
 
@@ -317,13 +350,37 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 				}
 
 				// find images and validate according to values
-				imageMap := findImageReferences(chart.Values, values, co.UseCustomValues)
+				imageMap := findImageReferences(chart.Values, values, co.UseCustomValues, patterns)
+				if c.Images != nil && len(c.Images.Paths) > 0 {
+					selected, err := selectImages(chart.Values, values, c.Images.Paths)
+					if err != nil {
+						return fmt.Errorf("helm: error selecting images of chart %s :: %w", c.Name, err)
+					}
+					for i, ps := range selected {
+						imageMap[i] = ps
+					}
+				}
 
 				// check that images are available from registries
 				if imageMap == nil {
 					return nil
 				}
 
+				// workload kinds using the images, for prioritizing by runtime exposure
+				ws := map[string][]string{}
+				manifest, err := render(chart, values, args.K8SVersion, args.APIVersions)
+				rendered := err == nil
+				if rendered {
+					ws = workloads(manifest)
+					if co.RenderedImages {
+						for i, ps := range manifestOnlyImages(imageMap, manifest) {
+							imageMap[i] = ps
+						}
+					}
+				} else {
+					slog.Debug("could not render chart. workloads will not be recorded for its images", slog.String("chart", c.Name), slog.String("error", err.Error()))
+				}
+
 				eg, egCtx := errgroup.WithContext(egCtx)
 				for i, helmValuePaths := range imageMap {
 					func(i *registry.Image, helmValuePaths []string) {
@@ -334,6 +391,7 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 							i.Registry = reg
 							i.Repository = fmt.Sprintf("%s/%s", repo, name)
 
+							inferred := i.Tag == ""
 							if i.Tag == "" {
 								switch name {
 								case "kubectl":
@@ -344,12 +402,23 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 								}
 							}
 
+							// images found in the rendered chart know the resources referencing them
+							if len(i.Workloads) == 0 {
+								i.Workloads = workloadsOf(ws, *i)
+							}
+							i.Confidence = confidence(len(i.Workloads) > 0, inferred)
+							// images of components disabled by the values are not rendered
+							if co.RenderedOnly && rendered && len(i.Workloads) == 0 {
+								channel <- &imageInfo{false, true, c, i, &helmValuePaths}
+								return nil
+							}
+
 							plainHTTP := strings.Contains(i.Registry, "localhost") || strings.Contains(i.Registry, "0.0.0.0")
 
-							available := determineTag(egCtx, i, plainHTTP)
+							available := determineTag(egCtx, co.Sources, i, plainHTTP)
 
 							// send availability response
-							channel <- &imageInfo{available, c, i, &helmValuePaths}
+							channel <- &imageInfo{available, false, c, i, &helmValuePaths}
 
 							return nil
 						})
@@ -373,6 +442,17 @@ func (co ChartOption) Run(ctx context.Context, setters ...Option) (ChartData, er
 		chartImageHelmValuesMap := make(ChartData)
 
 		for i := range imgs {
+			if i.skipped {
+				str, _ := i.image.String()
+				slog.Info("Image not rendered with the values. will be excluded from import...", slog.String("image", str), slog.String("chart", i.chart.Name))
+				if co.Skipped != nil {
+					if (*co.Skipped)[*i.chart] == nil {
+						(*co.Skipped)[*i.chart] = make(map[*registry.Image][]string)
+					}
+					(*co.Skipped)[*i.chart][i.image] = *i.collection
+				}
+				continue
+			}
 			if !i.available {
 				str, _ := i.image.String()
 				slog.Info("Image not available. will be excluded from import...", slog.String("image", str))
@@ -1,8 +1,10 @@
 package helm
 
 import (
+	"reflect"
 	"testing"
 
+	"github.com/blang/semver/v4"
 	"helm.sh/helm/v3/pkg/repo"
 )
 
@@ -73,3 +75,25 @@ func TestResolveVersions2(t *testing.T) {
 	}
 
 }
+
+func TestPick(t *testing.T) {
+	after := semver.MustParse("1.9.3")
+	tests := []struct {
+		vs    []string
+		n     int
+		after *semver.Version
+		want  []string
+	}{
+		{[]string{"1.2.0", "1.10.0", "1.9.3"}, 1, nil, []string{"1.10.0"}},
+		{[]string{"v1.0.0", "v2.1.0", "v1.5.0"}, 2, nil, []string{"v2.1.0", "v1.5.0"}},
+		{[]string{"latest", "0.1.0"}, 0, nil, []string{"0.1.0"}},
+		{[]string{"1.2.0", "1.10.0", "1.9.3"}, 0, &after, []string{"1.10.0"}},
+		{[]string{"1.2.0", "1.9.3"}, 5, &after, []string{}},
+	}
+	for _, tt := range tests {
+		got := pick(tt.vs, tt.n, tt.after)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: want %v got %v", tt.vs, tt.want, got)
+		}
+	}
+}
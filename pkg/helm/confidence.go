@@ -0,0 +1,60 @@
+package helm
+
+import (
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"gopkg.in/yaml.v3"
+)
+
+// confidence of an image found in the values. Images referenced by a rendered workload are exact, even with an inferred tag,
+// as rendering confirms the reference
+func confidence(rendered bool, inferred bool) registry.Confidence {
+	switch {
+	case rendered:
+		return registry.ConfidenceExact
+	case inferred:
+		return registry.ConfidenceInferred
+	default:
+		return registry.ConfidenceHeuristic
+	}
+}
+
+// OverrideValuesYAML returns the override values of the images as YAML, like OverrideValues. Values of images that should be
+// reviewed before applying, by their confidence, are commented with it
+func OverrideValuesYAML(images map[*registry.Image][]string, r registry.Registry, patterns Patterns) ([]byte, error) {
+	values, err := OverrideValues(images, r, patterns)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := doc.Encode(values); err != nil {
+		return nil, err
+	}
+
+	for i, paths := range images {
+		if !i.Confidence.Review() {
+			continue
+		}
+		for _, p := range paths {
+			if n := valueNode(&doc, keys(p)); n != nil {
+				n.LineComment = "helmper: " + i.Confidence.String() + " confidence, review before applying"
+			}
+		}
+	}
+	return yaml.Marshal(&doc)
+}
+
+// valueNode returns the node of the value at the keys in the mapping, or nil
+func valueNode(n *yaml.Node, ks []string) *yaml.Node {
+	if len(ks) == 0 {
+		return n
+	}
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for j := 0; j+1 < len(n.Content); j += 2 {
+		if n.Content[j].Value == ks[0] {
+			return valueNode(n.Content[j+1], ks[1:])
+		}
+	}
+	return nil
+}
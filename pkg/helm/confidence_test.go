@@ -0,0 +1,47 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestConfidence(t *testing.T) {
+	tests := []struct {
+		rendered, inferred bool
+		want               registry.Confidence
+	}{
+		{true, false, registry.ConfidenceExact},
+		{true, true, registry.ConfidenceExact},
+		{false, false, registry.ConfidenceHeuristic},
+		{false, true, registry.ConfidenceInferred},
+	}
+	for _, tt := range tests {
+		if got := confidence(tt.rendered, tt.inferred); got != tt.want {
+			t.Errorf("rendered %t inferred %t: want %s got %s", tt.rendered, tt.inferred, tt.want, got)
+		}
+	}
+}
+
+func TestOverrideValuesYAML(t *testing.T) {
+	images := map[*registry.Image][]string{
+		{Registry: "registry.k8s.io", Repository: "ingress-nginx/controller", Tag: "v1.11.2", Confidence: registry.ConfidenceExact}: {
+			".controller.image.registry", ".controller.image.repository", ".controller.image.tag",
+		},
+		{Registry: "docker.io", Repository: "library/busybox", Tag: "1.36", Confidence: registry.ConfidenceInferred}: {
+			".sidecar.image",
+		},
+	}
+
+	b, err := OverrideValuesYAML(images, registry.Registry{URL: "registry.example.com"}, DefaultPatterns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		commented := strings.Contains(line, "# helmper: inferred (40) confidence")
+		if strings.Contains(line, "busybox") != commented {
+			t.Errorf("unexpected line %q in\n%s", line, b)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package helm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// crdsSuffix is the suffix of the companion chart holding the CRDs of a chart, e.g. 'prometheus-operator-crds'
+const crdsSuffix = "-crds"
+
+// CRDsChart is the companion chart holding the CRDs of a chart, when it is not '<name>-crds' at the version of the chart
+type CRDsChart struct {
+	Name string `json:"name"`
+	// Version of the companion chart. Empty is the version of the chart for '<name>-crds', and the newest version otherwise
+	Version string `json:"version"`
+}
+
+// crdCharts are the companion charts of the charts not named '<name>-crds', which are versioned apart from the chart
+var crdCharts = map[string]string{
+	"kube-prometheus-stack": "prometheus-operator-crds",
+}
+
+// crdChart returns the companion chart holding the CRDs of the chart, in the same repository. Without a version, the newest
+// version of the companion chart is looked up
+func (c Chart) crdChart() Chart {
+	entry := c.Repo
+	if c.IsOCI() {
+		// the repository URL may point to the chart itself
+		ref := strings.TrimSuffix(c.Repo.URL, "/")
+		if path.Base(ref) == c.Name {
+			entry.URL = strings.TrimSuffix(ref, "/"+c.Name)
+		}
+	}
+	name, version := c.Name+crdsSuffix, c.Version
+	if n, ok := crdCharts[c.Name]; ok {
+		name, version = n, ""
+	}
+	if c.CRDsChart.Name != "" {
+		name, version = c.CRDsChart.Name, ""
+	}
+	if c.CRDsChart.Version != "" {
+		version = c.CRDsChart.Version
+	}
+	return Chart{
+		Name:      name,
+		Version:   version,
+		Repo:      entry,
+		PlainHTTP: c.PlainHTTP,
+		Source:    c.Source,
+		Resolve:   ResolveAll,
+		Group:     c.Group,
+	}
+}
+
+// inIndex looks up the version of the chart in the index of the Helm repository, or its newest version without a version
+func (c Chart) inIndex(index *repo.IndexFile) (string, bool) {
+	v, err := index.Get(c.Name, c.Version)
+	if err != nil {
+		return "", false
+	}
+	return v.Version, true
+}
+
+// CRDChart looks up the companion chart of the chart in its repository: '<name>-crds' at the same version, the known companion
+// chart of the chart, e.g. 'prometheus-operator-crds' of kube-prometheus-stack, or the configured CRDsChart.
+// Many charts (cert-manager, kube-prometheus-stack) ship their CRDs separately, and installs fail without them
+func (c Chart) CRDChart(ctx context.Context) (Chart, bool, error) {
+	if strings.HasSuffix(c.Name, crdsSuffix) {
+		return Chart{}, false, nil
+	}
+	crds := c.crdChart()
+
+	if crds.IsOCI() {
+		if crds.Version == "" {
+			vs, err := crds.ociVersions(ctx)
+			if err != nil || len(vs) == 0 {
+				slog.Debug("no CRD chart found", slog.String("chart", crds.OCIReference()), slog.Any("error", err))
+				return Chart{}, false, nil
+			}
+			crds.Version = vs[len(vs)-1].String()
+		}
+		r, err := crds.ociRepository()
+		if err != nil {
+			return Chart{}, false, err
+		}
+		if _, err := r.Resolve(ctx, registry.OCITag(crds.Version)); err != nil {
+			// no companion chart
+			slog.Debug("no CRD chart found", slog.String("chart", crds.OCIReference()), slog.String("version", crds.Version), slog.String("error", err.Error()))
+			return Chart{}, false, nil
+		}
+		return crds, true, nil
+	}
+
+	indexPath := fmt.Sprintf("%s/%s-index.yaml", cli.New().RepositoryCache, c.Repo.Name)
+	index, err := repo.LoadIndexFile(indexPath)
+	if err != nil {
+		return Chart{}, false, err
+	}
+	v, ok := crds.inIndex(index)
+	crds.Version = v
+	return crds, ok, nil
+}
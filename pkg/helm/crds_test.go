@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestCRDChart(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://prometheus-community.github.io/helm-charts", "https://prometheus-community.github.io/helm-charts"},
+		{"oci://ghcr.io/org", "oci://ghcr.io/org"},
+		{"oci://ghcr.io/org/prometheus-operator/", "oci://ghcr.io/org"},
+	}
+	for _, tt := range tests {
+		c := Chart{Name: "prometheus-operator", Version: "0.73.0", Repo: repo.Entry{Name: "prometheus", URL: tt.url}}
+		crds := c.crdChart()
+		if crds.Name != "prometheus-operator-crds" || crds.Version != "0.73.0" {
+			t.Errorf("want prometheus-operator-crds:0.73.0 got %s:%s", crds.Name, crds.Version)
+		}
+		if crds.Repo.URL != tt.want {
+			t.Errorf("want repository '%s' got '%s'", tt.want, crds.Repo.URL)
+		}
+	}
+
+	index := repo.NewIndexFile()
+	if err := index.MustAdd(&chart.Metadata{APIVersion: chart.APIVersionV2, Name: "prometheus-operator-crds", Version: "0.73.0"}, "prometheus-operator-crds-0.73.0.tgz", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	c := Chart{Name: "prometheus-operator", Repo: repo.Entry{Name: "prometheus"}}
+	for v, want := range map[string]bool{"0.73.0": true, "0.74.0": false} {
+		c.Version = v
+		if _, got := c.crdChart().inIndex(index); got != want {
+			t.Errorf("%s: want %t got %t", v, want, got)
+		}
+	}
+
+	// the companion chart of kube-prometheus-stack is versioned apart from the chart, so its newest version is looked up
+	c = Chart{Name: "kube-prometheus-stack", Version: "61.3.0", Repo: repo.Entry{Name: "prometheus"}}
+	crds := c.crdChart()
+	if crds.Name != "prometheus-operator-crds" || crds.Version != "" {
+		t.Errorf("want the newest prometheus-operator-crds got %s:%s", crds.Name, crds.Version)
+	}
+	if v, ok := crds.inIndex(index); !ok || v != "0.73.0" {
+		t.Errorf("want the newest version 0.73.0 got %s %t", v, ok)
+	}
+
+	c = Chart{Name: "cert-manager", Version: "v1.15.0", CRDsChart: CRDsChart{Name: "cert-manager-crds-bundle", Version: "1.0.0"}}
+	if crds := c.crdChart(); crds.Name != "cert-manager-crds-bundle" || crds.Version != "1.0.0" {
+		t.Errorf("want the configured CRD chart got %s:%s", crds.Name, crds.Version)
+	}
+}
@@ -0,0 +1,77 @@
+package helm
+
+import (
+	"log/slog"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+)
+
+// lockedVersion returns the version of the dependency in the Chart.lock of the chart, or "" if the chart has no lock
+func lockedVersion(chartRef *chart.Chart, d *chart.Dependency) string {
+	if chartRef.Lock == nil {
+		return ""
+	}
+	for _, l := range chartRef.Lock.Dependencies {
+		if l.Name == d.Name && l.Repository == d.Repository {
+			return l.Version
+		}
+	}
+	return ""
+}
+
+// remoteDependency reports if the dependency is pulled from a repository, and not embedded in the chart
+func remoteDependency(d *chart.Dependency) bool {
+	return d.Repository != "" && !strings.HasPrefix(d.Repository, "file://")
+}
+
+// dependencyVersion returns the version of the dependency to import: the version in the Chart.lock of the chart,
+// or the newest version matching a glob like '1.2.*', as OCI dependencies can not use globs
+func dependencyVersion(chartRef *chart.Chart, d *chart.Dependency, c Chart) string {
+	if v := lockedVersion(chartRef, d); v != "" {
+		return v
+	}
+	if strings.Contains(d.Version, "*") || strings.Contains(d.Version, "x") {
+		if v, err := DependencyToChart(d, c).ResolveVersion(); err == nil {
+			return v
+		}
+	}
+	return d.Version
+}
+
+// transitiveDependencies returns the remote dependencies of the chart and their remote dependencies, at the versions to import.
+// Dependencies come before the charts depending on them, so they are in the registry when the charts are modified
+func transitiveDependencies(chartRef *chart.Chart, c Chart, seen map[string]bool) []Chart {
+	res := []Chart{}
+	for _, d := range chartRef.Metadata.Dependencies {
+		if !remoteDependency(d) {
+			// Embedded in parent chart
+			slog.Debug("Skipping embedded chart", slog.String("chart", d.Name), slog.String("parent", c.Name))
+			continue
+		}
+
+		dc := DependencyToChart(d, c)
+		dc.Version = dependencyVersion(chartRef, d, c)
+		key := dc.Repo.URL + "/" + dc.Name + ":" + dc.Version
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		path, err := dc.Locate()
+		if err == nil {
+			var dcRef *chart.Chart
+			if dcRef, err = loader.Load(path); err == nil {
+				dc.DepsCount = len(dcRef.Metadata.Dependencies)
+				res = append(res, transitiveDependencies(dcRef, dc, seen)...)
+			}
+		}
+		if err != nil {
+			// the dependency is still imported, as the chart needs it
+			slog.Warn("could not read dependency. its dependencies are not imported", slog.String("chart", dc.Name), slog.String("version", dc.Version), slog.String("parent", c.Name), slog.String("error", err.Error()))
+		}
+		res = append(res, dc)
+	}
+	return res
+}
@@ -0,0 +1,36 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestDependencyVersion(t *testing.T) {
+	redis := &chart.Dependency{Name: "redis", Version: "19.x.x", Repository: "https://charts.bitnami.com/bitnami"}
+	common := &chart.Dependency{Name: "common", Version: "2.20.3", Repository: "oci://registry-1.docker.io/bitnamicharts"}
+	local := &chart.Dependency{Name: "local", Version: "0.1.0", Repository: "file://charts/local"}
+	chartRef := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "app", Dependencies: []*chart.Dependency{redis, common, local}},
+		Lock: &chart.Lock{Dependencies: []*chart.Dependency{
+			{Name: "redis", Version: "19.6.4", Repository: "https://charts.bitnami.com/bitnami"},
+			// another repository than the dependency
+			{Name: "common", Version: "2.19.0", Repository: "https://charts.bitnami.com/bitnami"},
+		}},
+	}
+	c := Chart{Name: "app", Version: "1.0.0"}
+
+	if got := dependencyVersion(chartRef, redis, c); got != "19.6.4" {
+		t.Errorf("want the locked version got %s", got)
+	}
+	if got := dependencyVersion(chartRef, common, c); got != "2.20.3" {
+		t.Errorf("want the version of the dependency got %s", got)
+	}
+
+	if remoteDependency(local) || !remoteDependency(redis) || !remoteDependency(common) {
+		t.Error("want only dependencies with a repository to be remote")
+	}
+	if deps := transitiveDependencies(&chart.Chart{Metadata: &chart.Metadata{Dependencies: []*chart.Dependency{local}}}, c, map[string]bool{}); len(deps) != 0 {
+		t.Errorf("want no embedded dependencies got %v", deps)
+	}
+}
@@ -0,0 +1,28 @@
+package helm
+
+import (
+	"path"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+// AnnotationLicense is the Artifact Hub annotation with the SPDX identifier of the license of a chart
+const AnnotationLicense = "artifacthub.io/license"
+
+// License returns the license of the chart from its Artifact Hub annotation. Without the annotation,
+// the content of the LICENSE file of the chart is returned to be classified instead, if the chart has one
+func License(ch *chart.Chart) (string, []byte) {
+	if ch.Metadata != nil {
+		if l := strings.TrimSpace(ch.Metadata.Annotations[AnnotationLicense]); l != "" {
+			return l, nil
+		}
+	}
+	for _, f := range ch.Files {
+		name := strings.ToUpper(strings.TrimSuffix(f.Name, path.Ext(f.Name)))
+		if name == "LICENSE" || name == "LICENCE" || name == "COPYING" {
+			return "", f.Data
+		}
+	}
+	return "", nil
+}
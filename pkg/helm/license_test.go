@@ -0,0 +1,27 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestLicense(t *testing.T) {
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{Name: "cert-manager", Annotations: map[string]string{AnnotationLicense: "Apache-2.0"}},
+		Files:    []*chart.File{{Name: "LICENSE", Data: []byte("MIT License")}},
+	}
+	if l, f := License(ch); l != "Apache-2.0" || f != nil {
+		t.Errorf("want 'Apache-2.0' from the annotation got '%s'", l)
+	}
+
+	ch.Metadata.Annotations = nil
+	if l, f := License(ch); l != "" || string(f) != "MIT License" {
+		t.Errorf("want the LICENSE file got '%s' '%s'", l, f)
+	}
+
+	ch.Files = []*chart.File{{Name: "README.md"}}
+	if l, f := License(ch); l != "" || f != nil {
+		t.Errorf("want no license got '%s' '%s'", l, f)
+	}
+}
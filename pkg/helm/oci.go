@@ -0,0 +1,95 @@
+package helm
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"github.com/blang/semver/v4"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// IsOCI reports if the chart is hosted in an OCI registry
+func (c Chart) IsOCI() bool {
+	return strings.HasPrefix(c.Repo.URL, "oci://")
+}
+
+// OCIReference is the reference of the chart in the OCI registry without the oci:// scheme.
+// The repository URL may either point to the chart (oci://ghcr.io/org/chart) or to the path containing it (oci://ghcr.io/org)
+func (c Chart) OCIReference() string {
+	ref := strings.TrimSuffix(strings.TrimPrefix(c.Repo.URL, "oci://"), "/")
+	if path.Base(ref) == c.Name {
+		return ref
+	}
+	return ref + "/" + c.Name
+}
+
+// ociRepository connects to the repository of the chart in the OCI registry, with the settings of the source registry if any
+func (c Chart) ociRepository() (*remote.Repository, error) {
+	if c.Source.Host != "" {
+		repo, err := c.Source.Repository(c.OCIReference())
+		if err != nil {
+			return nil, err
+		}
+		repo.PlainHTTP = repo.PlainHTTP || c.PlainHTTP
+		return repo, nil
+	}
+
+	repo, err := remote.NewRepository(c.OCIReference())
+	if err != nil {
+		return nil, err
+	}
+
+	repo.PlainHTTP = c.PlainHTTP
+
+	// prepare authentication using Docker and Helm credentials
+	credStore, err := registry.ChartCredentialStore()
+	if err != nil {
+		return nil, err
+	}
+	repo.Client = &auth.Client{
+		Header:     version.Header(),
+		Client:     retry.DefaultClient,
+		Cache:      auth.NewCache(),
+		Credential: credentials.Credential(credStore), // Use the credentials store
+	}
+
+	return repo, nil
+}
+
+// tagToVersion converts an OCI tag to a chart version. Helm replaces '+' with '_' as '+' is not allowed in OCI tags
+func tagToVersion(tag string) string {
+	return strings.ReplaceAll(tag, "_", "+")
+}
+
+// ociVersions lists the semver versions of the chart from the tags in the OCI registry, sorted ascending
+func (c Chart) ociVersions(ctx context.Context) ([]semver.Version, error) {
+	repo, err := c.ociRepository()
+	if err != nil {
+		return nil, err
+	}
+
+	vs := []semver.Version{}
+	err = repo.Tags(ctx, "", func(tags []string) error {
+		for _, t := range tags {
+			s, err := semver.ParseTolerant(tagToVersion(t))
+			if err != nil {
+				// non semver tag
+				continue
+			}
+			vs = append(vs, s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	semver.Sort(vs)
+	return vs, nil
+}
@@ -0,0 +1,36 @@
+package helm
+
+import (
+	"testing"
+
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+func TestOCIReference(t *testing.T) {
+	for url, expected := range map[string]string{
+		"oci://ghcr.io/org":                        "ghcr.io/org/chart",
+		"oci://ghcr.io/org/":                       "ghcr.io/org/chart",
+		"oci://ghcr.io/org/chart":                  "ghcr.io/org/chart",
+		"oci://registry-1.docker.io/bitnamicharts": "registry-1.docker.io/bitnamicharts/chart",
+	} {
+		c := Chart{
+			Name: "chart",
+			Repo: repo.Entry{URL: url},
+		}
+		if !c.IsOCI() {
+			t.Errorf("want '%s' to be OCI", url)
+		}
+		actual := c.OCIReference()
+		if actual != expected {
+			t.Errorf("want '%s' got '%s'", expected, actual)
+		}
+	}
+}
+
+func TestTagToVersion(t *testing.T) {
+	expected := "1.2.3+build.1"
+	actual := tagToVersion("1.2.3_build.1")
+	if actual != expected {
+		t.Errorf("want '%s' got '%s'", expected, actual)
+	}
+}
@@ -1,9 +1,19 @@
 package helm
 
+import (
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
 type Options struct {
 	Verbose    bool
 	Update     bool
 	K8SVersion string
+	// APIVersions are the API versions available in the cluster in addition to the built-in ones, e.g. 'monitoring.coreos.com/v1/ServiceMonitor'
+	APIVersions []string
+	// Registries are the registries the charts are imported to
+	Registries []registry.Registry
+	// Patterns extend the keys of the values images are detected by
+	Patterns Patterns
 }
 
 type Option func(*Options)
@@ -25,3 +35,21 @@ func K8SVersion(v string) Option {
 		args.K8SVersion = v
 	}
 }
+
+func APIVersions(vs []string) Option {
+	return func(args *Options) {
+		args.APIVersions = vs
+	}
+}
+
+func Registries(rs []registry.Registry) Option {
+	return func(args *Options) {
+		args.Registries = rs
+	}
+}
+
+func ImagePatterns(p Patterns) Option {
+	return func(args *Options) {
+		args.Patterns = p
+	}
+}
@@ -0,0 +1,73 @@
+package helm
+
+import (
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// lastKey of a value path like '.controller.image.repository'
+func lastKey(path string) string {
+	ks := keys(path)
+	if len(ks) == 0 {
+		return ""
+	}
+	return ks[len(ks)-1]
+}
+
+// OverrideValues returns values pointing the images found at the value paths to the registry, for deploying the imported charts without editing their values.
+// The parts of the image references are told apart by the patterns the images were found with, e.g. 'imageRegistry' holds the registry
+func OverrideValues(images map[*registry.Image][]string, r registry.Registry, patterns Patterns) (map[string]any, error) {
+	values := map[string]any{}
+	registryURL := r.URL
+
+	for i, paths := range images {
+		name, err := i.ImageName()
+		if err != nil {
+			return nil, err
+		}
+		name = r.Target(name)
+
+		hasRegistry, hasTag := false, false
+		for _, p := range paths {
+			switch patterns.role(lastKey(p)) {
+			case roleRegistry:
+				hasRegistry = true
+			case roleTag:
+				hasTag = true
+			}
+		}
+
+		// charts with a registry value prefix the repository with it
+		repository := registryURL + "/" + name
+		if hasRegistry {
+			repository = name
+		}
+
+		for _, p := range paths {
+			// values files replace lists as a whole, so values in lists are not overridden
+			if strings.Contains(p, "[") || strings.HasPrefix(p, manifestPath) {
+				continue
+			}
+			switch patterns.role(lastKey(p)) {
+			case roleRegistry:
+				setValue(values, p, registryURL)
+			case roleRepository:
+				setValue(values, p, repository)
+			case roleTag:
+				if i.Retagged {
+					setValue(values, p, i.Tag)
+				}
+			case roleImage:
+				// the image value holds the full reference
+				ref := repository
+				if !hasTag && i.Tag != "" {
+					ref += ":" + i.Tag
+				}
+				setValue(values, p, ref)
+			}
+		}
+	}
+
+	return values, nil
+}
@@ -0,0 +1,102 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestOverrideValues(t *testing.T) {
+	images := map[*registry.Image][]string{
+		{Registry: "registry.k8s.io", Repository: "ingress-nginx/controller", Tag: "v1.11.2"}: {
+			".controller.image.registry", ".controller.image.repository", ".controller.image.tag",
+		},
+		{Registry: "quay.io", Repository: "prometheus/prometheus", Tag: "v2.48.0"}: {
+			".server.image.repository", ".server.image.tag",
+		},
+		{Registry: "docker.io", Repository: "library/busybox", Tag: "1.36"}: {
+			".sidecar.image",
+		},
+	}
+
+	values, err := OverrideValues(images, registry.Registry{URL: "registry.example.com/mirror"}, DefaultPatterns())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]any{
+		".controller.image.registry":   "registry.example.com/mirror",
+		".controller.image.repository": "ingress-nginx/controller",
+		".controller.image.tag":        nil,
+		".server.image.repository":     "registry.example.com/mirror/prometheus/prometheus",
+		".sidecar.image":               "registry.example.com/mirror/library/busybox:1.36",
+	}
+	for path, want := range tests {
+		if got := getValue(values, path); got != want {
+			t.Errorf("%s: want '%v' got '%v'", path, want, got)
+		}
+	}
+
+	patched := map[*registry.Image][]string{
+		{Registry: "quay.io", Repository: "prometheus/prometheus-patched", Tag: "v2.48.0-patched", Retagged: true}: {
+			".server.image.repository", ".server.image.tag",
+		},
+	}
+	values, err = OverrideValues(patched, registry.Registry{URL: "registry.example.com/mirror"}, DefaultPatterns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = map[string]any{
+		".server.image.repository": "registry.example.com/mirror/prometheus/prometheus-patched",
+		".server.image.tag":        "v2.48.0-patched",
+	}
+	for path, want := range tests {
+		if got := getValue(values, path); got != want {
+			t.Errorf("patched %s: want '%v' got '%v'", path, want, got)
+		}
+	}
+
+	values, err = OverrideValues(images, registry.Registry{URL: "registry.example.com/mirror", Flatten: true}, DefaultPatterns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests = map[string]any{
+		".controller.image.repository": "controller",
+		".server.image.repository":     "registry.example.com/mirror/prometheus",
+		".sidecar.image":               "registry.example.com/mirror/busybox:1.36",
+	}
+	for path, want := range tests {
+		if got := getValue(values, path); got != want {
+			t.Errorf("flatten %s: want '%v' got '%v'", path, want, got)
+		}
+	}
+}
+
+func TestOverrideValuesPatterns(t *testing.T) {
+	images := map[*registry.Image][]string{
+		{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.2.4"}: {
+			".image.imageRegistry", ".image.imageRepository", ".image.imageTag",
+		},
+		{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"}: {
+			".proxy.imageName", ".proxy.imageVersion",
+		},
+	}
+	patterns := DefaultPatterns().With(Patterns{Image: []string{"imageName"}, Tag: []string{"imageVersion"}})
+	values, err := OverrideValues(images, registry.Registry{URL: "registry.example.com"}, patterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]any{
+		".image.imageRegistry":   "registry.example.com",
+		".image.imageRepository": "bitnami/redis",
+		".image.imageTag":        nil,
+		".proxy.imageName":       "registry.example.com/library/nginx",
+		".proxy.imageVersion":    nil,
+	}
+	for path, want := range tests {
+		if got := getValue(values, path); got != want {
+			t.Errorf("%s: want '%v' got '%v'", path, want, got)
+		}
+	}
+}
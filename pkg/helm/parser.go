@@ -2,6 +2,7 @@ package helm
 
 import (
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/ChristofferNissen/helmper/pkg/registry"
@@ -28,10 +29,31 @@ func ConditionMet(condition string, values map[string]any) bool {
 	return enabled
 }
 
-// traverse helm chart values data structure
-func findImageReferencesAcc(data map[string]any, values map[string]any, useCustomValues bool, acc string) map[*registry.Image][]string {
+// traverse helm chart values data structure. Images are found by the keys of the patterns, in sections and in the sections of lists, e.g. 'initContainers[0].image'
+func findImageReferencesAcc(data map[string]any, values map[string]any, useCustomValues bool, patterns Patterns, acc string) map[*registry.Image][]string {
 	res := make(map[*registry.Image][]string)
 
+	// nested yaml object, only parsed if enabled
+	nested := func(v map[string]any, vs map[string]any, path string) {
+		enabled := true
+		for k1, v1 := range v {
+			if k1 == "enabled" {
+				switch value := v1.(type) {
+				case string:
+					enabled = value == "true"
+				case bool:
+					enabled = ConditionMet(k1, vs)
+				}
+			}
+		}
+		if !enabled {
+			return
+		}
+		for k, v := range findImageReferencesAcc(v, vs, useCustomValues, patterns, path) {
+			res[k] = v
+		}
+	}
+
 	i := registry.Image{}
 	for k, v := range data {
 		switch v := v.(type) {
@@ -43,113 +65,49 @@ func findImageReferencesAcc(data map[string]any, values map[string]any, useCusto
 				i.UseDigest = v
 			}
 		case string:
-			found := true
-
-			switch k {
-			case "registry":
-				switch useCustomValues {
-				case true:
-					s, ok := values[k].(string)
-					if ok {
-						i.Registry = s
-					} else {
-						i.Registry = v
-					}
-				case false:
-					i.Registry = v
-				}
-			case "repository":
-				switch useCustomValues {
-				case true:
-					s, ok := values[k].(string)
-					if ok {
-						i.Repository = s
-					} else {
-						i.Repository = v
-					}
-				case false:
-					i.Repository = v
-				}
-			case "image":
-				switch useCustomValues {
-				case true:
-					s, ok := values[k].(string)
-					if ok {
-						i.Repository = s
-					} else {
-						i.Repository = v
-					}
-				case false:
-					i.Repository = v
-				}
-			case "tag":
-				switch useCustomValues {
-				case true:
-					s, ok := values[k].(string)
-					if ok {
-						i.Tag = s
-					} else {
-						i.Tag = v
-					}
-				case false:
-					i.Tag = v
-				}
-			case "digest":
-				switch useCustomValues {
-				case true:
-					s, ok := values[k].(string)
-					if ok {
-						i.Digest = s
-					} else {
-						i.Digest = v
-					}
-				case false:
-					i.Digest = v
-				}
-			case "sha":
-				switch useCustomValues {
-				case true:
-					s, ok := values[k].(string)
-					if ok {
-						i.Digest = s
-					} else {
-						i.Digest = v
-					}
-				case false:
-					i.Digest = v
-				}
-			default:
-				found = false
+			role := patterns.role(k)
+			if role == "" {
+				continue
+			}
+			if s, ok := values[k].(string); ok && useCustomValues {
+				v = s
 			}
 
-			if found {
-				res[&i] = append(res[&i], fmt.Sprintf("%s.%s", acc, k))
+			switch role {
+			case roleRegistry:
+				i.Registry = v
+			case roleRepository, roleImage:
+				i.Repository = v
+			case roleTag:
+				i.Tag = v
+			case roleDigest:
+				i.Digest = v
 			}
+			res[&i] = append(res[&i], fmt.Sprintf("%s.%s", acc, k))
 
 		// nested yaml object
 		case map[string]any:
-			// same path in yaml
-
-			// Only parsed enabled sections
-			enabled := true
-			for k1, v1 := range v {
-				if k1 == "enabled" {
-					switch value := v1.(type) {
-					case string:
-						enabled = value == "true"
-					case bool:
-						enabled = ConditionMet(k1, values[k].(map[string]any))
-					}
-				}
+			vs, ok := values[k].(map[string]any)
+			if !ok {
+				vs = map[string]any{}
 			}
-
-			// if enabled, parse nested section
-			if enabled {
-				path := ternary.Ternary(acc == "", k, fmt.Sprintf("%s.%s", acc, k))
-				nestedRes := findImageReferencesAcc(v, values[k].(map[string]any), useCustomValues, path)
-				for k, v := range nestedRes {
-					res[k] = v
+			nested(v, vs, ternary.Ternary(acc == "", k, fmt.Sprintf("%s.%s", acc, k)))
+
+		// list of yaml objects, e.g. init containers or sidecars
+		case []any:
+			vl, _ := values[k].([]any)
+			for n, e := range v {
+				m, ok := e.(map[string]any)
+				if !ok {
+					continue
 				}
+				vs := map[string]any{}
+				if n < len(vl) {
+					if em, ok := vl[n].(map[string]any); ok {
+						vs = em
+					}
+				}
+				nested(m, vs, fmt.Sprintf("%s[%d]", ternary.Ternary(acc == "", k, fmt.Sprintf("%s.%s", acc, k)), n))
 			}
 		}
 	}
@@ -157,20 +115,27 @@ func findImageReferencesAcc(data map[string]any, values map[string]any, useCusto
 	return res
 }
 
-func findImageReferences(data map[string]any, values map[string]any, useCustomValues bool) map[*registry.Image][]string {
-	return findImageReferencesAcc(data, values, useCustomValues, "")
+func findImageReferences(data map[string]any, values map[string]any, useCustomValues bool, patterns Patterns) map[*registry.Image][]string {
+	return findImageReferencesAcc(data, values, useCustomValues, patterns, "")
 }
 
 // traverse helm chart values data structure
-func replaceImageReferences(data map[string]any, reg string) {
+func replaceImageReferences(data map[string]any, reg string, flatten bool, patterns Patterns) {
 
 	// For images we do not use the prefix and suffix of the registry
 	reg, _ = strings.CutPrefix(reg, "oci://")
 	reg, _ = strings.CutSuffix(reg, "/charts")
 
-	_, ok := data["registry"].(string)
-	if ok {
-		data["registry"] = reg
+	for _, rk := range patterns.Registry {
+		if _, ok := data[rk].(string); !ok {
+			continue
+		}
+		data[rk] = reg
+		for _, k := range patterns.Repository {
+			if repository, ok := data[k].(string); ok && flatten {
+				data[k] = path.Base(repository)
+			}
+		}
 		return
 	}
 
@@ -182,6 +147,11 @@ func replaceImageReferences(data map[string]any, reg string) {
 		r := ref.(reference.Named)
 		dom := reference.Domain(r)
 
+		if flatten {
+			// keep the tag and digest of the reference
+			return reg + "/" + path.Base(reference.Path(r)) + strings.TrimPrefix(ref.String(), r.Name())
+		}
+
 		containsDomain := strings.Contains(val, dom)
 		if containsDomain {
 			return strings.Replace(ref.String(), dom, reg, 1)
@@ -193,23 +163,25 @@ func replaceImageReferences(data map[string]any, reg string) {
 		}
 	}
 
-	image, ok := data["image"].(string)
-	if ok {
-		data["image"] = f(image)
-		return
-	}
-
-	repository, ok := data["repository"].(string)
-	if ok {
-		data["repository"] = f(repository)
-		return
+	for _, k := range append(append([]string{}, patterns.Image...), patterns.Repository...) {
+		if v, ok := data[k].(string); ok {
+			data[k] = f(v)
+			return
+		}
 	}
 
-	for k, v := range data {
-		switch v.(type) {
+	for _, v := range data {
+		switch v := v.(type) {
 		// nested yaml object
 		case map[string]any:
-			replaceImageReferences(data[k].(map[string]any), reg)
+			replaceImageReferences(v, reg, flatten, patterns)
+		// list of yaml objects, e.g. init containers or sidecars
+		case []any:
+			for _, e := range v {
+				if m, ok := e.(map[string]any); ok {
+					replaceImageReferences(m, reg, flatten, patterns)
+				}
+			}
 		}
 	}
 }
@@ -1,6 +1,11 @@
 package helm
 
-import "testing"
+import (
+	"sort"
+	"testing"
+
+	"reflect"
+)
 
 func TestConditionMet(t *testing.T) {
 	type input struct {
@@ -73,3 +78,81 @@ func TestConditionMet(t *testing.T) {
 	}
 
 }
+
+func TestReplaceImageReferencesFlatten(t *testing.T) {
+	values := map[string]any{
+		"controller": map[string]any{"image": map[string]any{"registry": "registry.k8s.io", "repository": "ingress-nginx/controller"}},
+		"server":     map[string]any{"image": map[string]any{"repository": "quay.io/prometheus/prometheus:v2.48.0"}},
+		"sidecar":    map[string]any{"image": "busybox:1.36"},
+	}
+	replaceImageReferences(values, "oci://myregistry.io/mirror/charts", true, DefaultPatterns())
+
+	tests := map[string]any{
+		".controller.image.registry":   "myregistry.io/mirror",
+		".controller.image.repository": "controller",
+		".server.image.repository":     "myregistry.io/mirror/prometheus:v2.48.0",
+		".sidecar.image":               "myregistry.io/mirror/busybox:1.36",
+	}
+	for path, want := range tests {
+		if got := getValue(values, path); got != want {
+			t.Errorf("%s: want '%v' got '%v'", path, want, got)
+		}
+	}
+}
+
+func TestFindImageReferences(t *testing.T) {
+	values := map[string]any{
+		"controller": map[string]any{
+			"image": map[string]any{"registry": "registry.k8s.io", "repository": "ingress-nginx/controller", "tag": "v1.11.2"},
+			"initContainers": []any{
+				map[string]any{"name": "init", "image": "busybox:1.36"},
+				"not-a-section",
+			},
+		},
+		"exporter": map[string]any{"imageRepository": "quay.io/prometheus/node-exporter", "imageTag": "v1.8.2"},
+		"worker":   map[string]any{"img": "ghcr.io/org/worker", "version": "2.0.0"},
+		"disabled": map[string]any{"enabled": "false", "image": "ghcr.io/org/disabled:1.0"},
+	}
+
+	find := func(patterns Patterns) map[string][]string {
+		res := map[string][]string{}
+		for i, paths := range findImageReferences(values, values, false, patterns) {
+			res[i.Registry+"|"+i.Repository+"|"+i.Tag] = paths
+		}
+		return res
+	}
+
+	got := find(DefaultPatterns())
+	want := map[string][]string{
+		"registry.k8s.io|ingress-nginx/controller|v1.11.2": {"controller.image.registry", "controller.image.repository", "controller.image.tag"},
+		"|busybox:1.36|": {"controller.initContainers[0].image"},
+		"|quay.io/prometheus/node-exporter|v1.8.2": {"exporter.imageRepository", "exporter.imageTag"},
+	}
+	for k, paths := range got {
+		sort.Strings(paths)
+		got[k] = paths
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	got = find(DefaultPatterns().With(Patterns{Image: []string{"img"}, Tag: []string{"version"}}))
+	if paths, ok := got["|ghcr.io/org/worker|2.0.0"]; !ok || len(paths) != 2 {
+		t.Errorf("want image of the extended patterns, got %v", got)
+	}
+}
+
+func TestReplaceImageReferencesPatterns(t *testing.T) {
+	values := map[string]any{
+		"initContainers": []any{map[string]any{"image": "busybox:1.36"}},
+		"exporter":       map[string]any{"imageRegistry": "quay.io", "imageRepository": "prometheus/node-exporter"},
+	}
+	replaceImageReferences(values, "oci://myregistry.io/charts", false, DefaultPatterns())
+
+	if got := values["initContainers"].([]any)[0].(map[string]any)["image"]; got != "myregistry.io/library/busybox:1.36" {
+		t.Errorf("want the image in the list replaced, got '%v'", got)
+	}
+	if got := getValue(values, ".exporter.imageRegistry"); got != "myregistry.io" {
+		t.Errorf("want the registry of the pattern replaced, got '%v'", got)
+	}
+}
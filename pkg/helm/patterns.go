@@ -0,0 +1,71 @@
+package helm
+
+import "slices"
+
+// Patterns are the keys of the values holding the parts of image references. Images are detected by the keys in a section
+// of the values, e.g. a 'repository' and a 'tag' next to each other
+type Patterns struct {
+	Registry   []string `json:"registry"`
+	Repository []string `json:"repository"`
+	// Image are the keys holding a repository or a full image reference, e.g. 'busybox:1.36'
+	Image  []string `json:"image"`
+	Tag    []string `json:"tag"`
+	Digest []string `json:"digest"`
+}
+
+// Roles of the keys of image references
+const (
+	roleRegistry   = "registry"
+	roleRepository = "repository"
+	roleImage      = "image"
+	roleTag        = "tag"
+	roleDigest     = "digest"
+)
+
+// DefaultPatterns are the keys of the common layouts of image references in values
+func DefaultPatterns() Patterns {
+	return Patterns{
+		Registry:   []string{"registry", "imageRegistry"},
+		Repository: []string{"repository", "imageRepository"},
+		Image:      []string{"image"},
+		Tag:        []string{"tag", "imageTag"},
+		Digest:     []string{"digest", "sha", "imageDigest"},
+	}
+}
+
+// With returns the patterns extended with the keys of o
+func (p Patterns) With(o Patterns) Patterns {
+	add := func(ks []string, os []string) []string {
+		res := append([]string{}, ks...)
+		for _, k := range os {
+			if !slices.Contains(res, k) {
+				res = append(res, k)
+			}
+		}
+		return res
+	}
+	return Patterns{
+		Registry:   add(p.Registry, o.Registry),
+		Repository: add(p.Repository, o.Repository),
+		Image:      add(p.Image, o.Image),
+		Tag:        add(p.Tag, o.Tag),
+		Digest:     add(p.Digest, o.Digest),
+	}
+}
+
+// role returns the part of the image reference the key holds, or "" if the key is not in the patterns
+func (p Patterns) role(key string) string {
+	switch {
+	case slices.Contains(p.Registry, key):
+		return roleRegistry
+	case slices.Contains(p.Repository, key):
+		return roleRepository
+	case slices.Contains(p.Image, key):
+		return roleImage
+	case slices.Contains(p.Tag, key):
+		return roleTag
+	case slices.Contains(p.Digest, key):
+		return roleDigest
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package helm
+
+import (
+	"strings"
+)
+
+// Pin references an image found at the value paths by digest
+type Pin struct {
+	Paths  []string
+	Tag    string
+	Digest string
+	// Retagged sets the tag value too, for images referenced by another tag in the registries than in the chart
+	Retagged bool
+}
+
+// keys of a value path like '.controller.image.tag'
+func keys(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool { return r == '.' })
+}
+
+func getValue(values map[string]any, path string) any {
+	ks := keys(path)
+	pos := values
+	for _, k := range ks[:len(ks)-1] {
+		m, ok := pos[k].(map[string]any)
+		if !ok {
+			return nil
+		}
+		pos = m
+	}
+	return pos[ks[len(ks)-1]]
+}
+
+// setValue sets the value at the path, creating missing sections. Sections of subcharts override the values of the subchart
+func setValue(values map[string]any, path string, v any) {
+	ks := keys(path)
+	pos := values
+	for _, k := range ks[:len(ks)-1] {
+		m, ok := pos[k].(map[string]any)
+		if !ok {
+			m = map[string]any{}
+			pos[k] = m
+		}
+		pos = m
+	}
+	pos[ks[len(ks)-1]] = v
+}
+
+// pinImages rewrites the values to reference the images by digest. The digest is set in the digest value of the image if the chart has one,
+// and otherwise appended to the tag or the image reference ('tag@digest'), which charts concatenating repository and tag render as a valid reference
+func pinImages(values map[string]any, pins []Pin, patterns Patterns) {
+	for _, p := range pins {
+		var digestPath, tagPath, imagePath string
+		for _, path := range p.Paths {
+			ks := keys(path)
+			// values files replace lists as a whole, so values in lists are not pinned
+			if len(ks) == 0 || strings.HasPrefix(path, manifestPath) || strings.Contains(path, "[") {
+				continue
+			}
+			switch patterns.role(ks[len(ks)-1]) {
+			case roleDigest:
+				digestPath = path
+			case roleTag:
+				tagPath = path
+			case roleImage:
+				imagePath = path
+			}
+		}
+
+		tag, _, _ := strings.Cut(p.Tag, "@")
+		switch {
+		case digestPath != "":
+			setValue(values, digestPath, p.Digest)
+			if p.Retagged && tagPath != "" && tag != "" {
+				setValue(values, tagPath, tag)
+			}
+		case tagPath != "" && tag != "":
+			setValue(values, tagPath, tag+"@"+p.Digest)
+		case imagePath != "":
+			if s, ok := getValue(values, imagePath).(string); ok && !strings.Contains(s, "@") {
+				setValue(values, imagePath, s+"@"+p.Digest)
+			}
+		}
+	}
+}
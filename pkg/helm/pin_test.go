@@ -0,0 +1,47 @@
+package helm
+
+import (
+	"testing"
+)
+
+func TestPinImages(t *testing.T) {
+	values := map[string]any{
+		"controller": map[string]any{
+			"image": map[string]any{
+				"repository": "ingress-nginx/controller",
+				"tag":        "v1.11.2",
+				"digest":     "",
+			},
+		},
+		"webhook": map[string]any{
+			"image": map[string]any{
+				"repository": "ingress-nginx/kube-webhook-certgen",
+				"tag":        "v1.4.3",
+			},
+		},
+		"sidecar": map[string]any{
+			"image": "registry.example.com/busybox:1.36",
+		},
+	}
+
+	pinImages(values, []Pin{
+		{Paths: []string{".controller.image.repository", ".controller.image.tag", ".controller.image.digest"}, Tag: "v1.11.2", Digest: "sha256:aaa"},
+		{Paths: []string{".webhook.image.repository", ".webhook.image.tag"}, Tag: "v1.4.3", Digest: "sha256:bbb"},
+		{Paths: []string{".sidecar.image"}, Tag: "1.36", Digest: "sha256:ccc"},
+		// subchart values are overridden from the parent chart
+		{Paths: []string{".postgresql.image.tag"}, Tag: "16.4.0", Digest: "sha256:ddd"},
+	}, DefaultPatterns())
+
+	tests := map[string]string{
+		".controller.image.digest": "sha256:aaa",
+		".controller.image.tag":    "v1.11.2",
+		".webhook.image.tag":       "v1.4.3@sha256:bbb",
+		".sidecar.image":           "registry.example.com/busybox:1.36@sha256:ccc",
+		".postgresql.image.tag":    "16.4.0@sha256:ddd",
+	}
+	for path, want := range tests {
+		if got := getValue(values, path); got != want {
+			t.Errorf("%s: want '%s' got '%v'", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package helm
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+const (
+	// Reasons an image in the values of a chart is not pinned
+	ReasonMovingTag = "moving tag"
+	ReasonNoDigest  = "no digest"
+)
+
+// Unpinned is an image the values of a chart reference by a moving tag or without a digest
+type Unpinned struct {
+	Chart   string
+	Version string
+	Image   string
+	Paths   []string
+	Reason  string
+}
+
+// CheckPinning returns the images referenced by a moving tag in the values of the charts, sorted by chart and image.
+// With requireDigest, every image referenced without a digest is returned. Images from the configuration are not checked
+func CheckPinning(data ChartData, requireDigest bool) []Unpinned {
+	res := []Unpinned{}
+	for c, m := range data {
+		if c.Name == "images" {
+			continue
+		}
+		for i, paths := range m {
+			// digests are parsed into the digest, or left in the tag, e.g. 'v1.8.0@sha256:...'
+			if i.Digest != "" || strings.Contains(i.Tag, "@") {
+				continue
+			}
+			reason := ""
+			switch {
+			case registry.MovingTag(i.Tag):
+				reason = ReasonMovingTag
+			case requireDigest:
+				reason = ReasonNoDigest
+			default:
+				continue
+			}
+			ref, err := i.String()
+			if err != nil {
+				ref = i.Registry + "/" + i.Repository + ":" + i.Tag
+			}
+			ps := append([]string{}, paths...)
+			sort.Strings(ps)
+			res = append(res, Unpinned{Chart: c.Name, Version: c.Version, Image: ref, Paths: ps, Reason: reason})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Chart != res[j].Chart {
+			return res[i].Chart < res[j].Chart
+		}
+		if res[i].Version != res[j].Version {
+			return res[i].Version < res[j].Version
+		}
+		return res[i].Image < res[j].Image
+	})
+	return res
+}
@@ -0,0 +1,34 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestCheckPinning(t *testing.T) {
+	data := ChartData{
+		Chart{Name: "prometheus", Version: "25.0.0"}: {
+			&registry.Image{Registry: "quay.io", Repository: "prometheus/prometheus", Tag: "v2.51.0"}:                              {"server.image"},
+			&registry.Image{Registry: "quay.io", Repository: "prometheus-operator/prometheus-config-reloader", Tag: "latest"}:      {"configmapReload.image"},
+			&registry.Image{Registry: "docker.io", Repository: "library/busybox", Tag: "1", Digest: "sha256:abc", UseDigest: true}: {"initChown.image"},
+			&registry.Image{Registry: "quay.io", Repository: "prometheus/node-exporter", Tag: "v1.8.0@sha256:4cb2"}:                {"nodeExporter.image"},
+		},
+		Chart{Name: "images", Version: "0.0.0"}: {
+			&registry.Image{Registry: "docker.io", Repository: "library/nginx", Tag: "latest"}: {},
+		},
+	}
+
+	want := []Unpinned{
+		{Chart: "prometheus", Version: "25.0.0", Image: "quay.io/prometheus-operator/prometheus-config-reloader:latest", Paths: []string{"configmapReload.image"}, Reason: ReasonMovingTag},
+	}
+	if got := CheckPinning(data, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+
+	want = append(want, Unpinned{Chart: "prometheus", Version: "25.0.0", Image: "quay.io/prometheus/prometheus:v2.51.0", Paths: []string{"server.image"}, Reason: ReasonNoDigest})
+	if got := CheckPinning(data, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+}
@@ -0,0 +1,131 @@
+package helm
+
+import (
+	"embed"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed presets/*.yaml
+var presetFiles embed.FS
+
+// Preset is a built-in configuration of a common upstream chart, with the value paths of the images its detection misses
+// and the recommended excludes. Presets are versioned, so their changes do not change the imports of existing configurations
+type Preset struct {
+	Name        string `json:"name"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Images      Images `json:"images"`
+	CRDs        bool   `json:"crds"`
+}
+
+// Presets returns the built-in presets, sorted by name and version
+func Presets() ([]Preset, error) {
+	es, err := presetFiles.ReadDir("presets")
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Preset, 0, len(es))
+	for _, e := range es {
+		b, err := presetFiles.ReadFile("presets/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+		var p Preset
+		if err := yaml.UnmarshalStrict(b, &p); err != nil {
+			return nil, fmt.Errorf("helm: invalid preset %s :: %w", e.Name(), err)
+		}
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Version < res[j].Version
+	})
+	return res, nil
+}
+
+// LookupPreset returns the preset by its name, e.g. 'argo-cd', or name and version, e.g. 'argo-cd@v1'. Without a version, the newest version is returned
+func LookupPreset(ref string) (Preset, error) {
+	name, v, versioned := strings.Cut(ref, "@")
+	version := 0
+	if versioned {
+		n, err := strconv.Atoi(strings.TrimPrefix(v, "v"))
+		if err != nil {
+			return Preset{}, fmt.Errorf("helm: invalid version '%s' of preset %s", v, name)
+		}
+		version = n
+	}
+
+	ps, err := Presets()
+	if err != nil {
+		return Preset{}, err
+	}
+	var res *Preset
+	names := []string{}
+	for _, p := range ps {
+		names = append(names, fmt.Sprintf("%s@v%d", p.Name, p.Version))
+		if p.Name == name && (version == 0 || p.Version == version) {
+			res = &p
+		}
+	}
+	if res == nil {
+		return Preset{}, fmt.Errorf("helm: unknown preset '%s', available presets are %s", ref, strings.Join(names, ", "))
+	}
+	return *res, nil
+}
+
+// imageRef and imageModify are the entries of the excludes and modifications of Images
+type (
+	imageRef = struct {
+		Ref string `json:"ref"`
+	}
+	imageModify = struct {
+		From          string `json:"from"`
+		FromValuePath string `json:"fromValuePath"`
+		To            string `json:"to"`
+	}
+)
+
+// merge returns the entries of the preset followed by the entries of the chart, where the entries of the chart replace the entries of the preset with the same key
+func merge[T any](preset []T, chart []T, key func(T) string) []T {
+	overridden := map[string]bool{}
+	for _, e := range chart {
+		overridden[key(e)] = true
+	}
+	res := []T{}
+	for _, e := range preset {
+		if !overridden[key(e)] {
+			res = append(res, e)
+		}
+	}
+	return append(res, chart...)
+}
+
+// WithPreset returns the chart with the configuration of its preset, if it has one. The configuration of the chart overrides the preset:
+// excludes, modifications and value paths of the chart replace those of the preset with the same reference or path
+func (c Chart) WithPreset() (Chart, error) {
+	if c.Preset == "" {
+		return c, nil
+	}
+	p, err := LookupPreset(c.Preset)
+	if err != nil {
+		return c, err
+	}
+
+	images := p.Images
+	if c.Images != nil {
+		images.Exclude = merge(p.Images.Exclude, c.Images.Exclude, func(e imageRef) string { return e.Ref })
+		images.ExcludeCopacetic = merge(p.Images.ExcludeCopacetic, c.Images.ExcludeCopacetic, func(e imageRef) string { return e.Ref })
+		images.Modify = merge(p.Images.Modify, c.Images.Modify, func(e imageModify) string { return e.From + "|" + e.FromValuePath })
+		images.Paths = merge(p.Images.Paths, c.Images.Paths, func(e ImagePath) string { return e.Path })
+	}
+	c.Images = &images
+	c.CRDs = c.CRDs || p.CRDs
+	return c, nil
+}
@@ -0,0 +1,67 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	ps, err := Presets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, p := range ps {
+		names = append(names, p.Name)
+		for _, ip := range p.Images.Paths {
+			if _, err := parsePath(ip.Path); err != nil {
+				t.Errorf("%s: %v", p.Name, err)
+			}
+		}
+	}
+	want := []string{"argo-cd", "cert-manager", "ingress-nginx", "kube-prometheus-stack"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+
+	for _, ref := range []string{"argo-cd", "argo-cd@v1", "argo-cd@1"} {
+		if p, err := LookupPreset(ref); err != nil || p.Version != 1 {
+			t.Errorf("%s: got %v, %v", ref, p, err)
+		}
+	}
+	for _, ref := range []string{"linkerd", "argo-cd@v9", "argo-cd@latest"} {
+		if _, err := LookupPreset(ref); err == nil {
+			t.Errorf("%s: want error", ref)
+		}
+	}
+}
+
+func TestWithPreset(t *testing.T) {
+	c := Chart{Name: "ingress-nginx", Preset: "ingress-nginx", Images: &Images{
+		Exclude: []imageRef{{Ref: "registry.k8s.io/ingress-nginx/opentelemetry"}},
+		Paths:   []ImagePath{{Path: "controller.extraContainers[*].image", Pattern: "(\\S+)"}},
+	}}
+	c, err := c.WithPreset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excludes := []string{}
+	for _, e := range c.Images.Exclude {
+		excludes = append(excludes, e.Ref)
+	}
+	if want := []string{"registry.k8s.io/defaultbackend-amd64", "registry.k8s.io/ingress-nginx/opentelemetry"}; !reflect.DeepEqual(excludes, want) {
+		t.Errorf("got excludes %v, want %v", excludes, want)
+	}
+	want := []ImagePath{{Path: "controller.extraInitContainers[*].image"}, {Path: "controller.extraContainers[*].image", Pattern: "(\\S+)"}}
+	if !reflect.DeepEqual(c.Images.Paths, want) {
+		t.Errorf("got paths %v, want %v", c.Images.Paths, want)
+	}
+	if len(c.Images.ExcludeCopacetic) != 2 {
+		t.Errorf("want the copacetic excludes of the preset, got %v", c.Images.ExcludeCopacetic)
+	}
+
+	if c, err := (Chart{Name: "kube-prometheus-stack", Preset: "kube-prometheus-stack"}).WithPreset(); err != nil || !c.CRDs || c.Images == nil {
+		t.Errorf("want the preset without chart configuration, got %+v, %v", c, err)
+	}
+}
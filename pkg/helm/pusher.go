@@ -0,0 +1,165 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"helm.sh/helm/v3/pkg/repo"
+	"sigs.k8s.io/yaml"
+)
+
+// ChartPusher pushes packaged charts to a chart repository
+type ChartPusher interface {
+	// URL of the repository, which the dependencies of modified charts are pointed to
+	URL() string
+	// Exists reports whether the version of the chart is in the repository
+	Exists(ctx context.Context, name string, version string) (bool, error)
+	// Push pushes the packaged chart at path
+	Push(ctx context.Context, c Chart, path string) error
+}
+
+// Pushers returns the chart repositories the charts are pushed to for the registry. credentialsFile is a Docker config file with the
+// credentials for the registry, or empty to use the Helm credentials
+func Pushers(r registry.Registry, credentialsFile string) []ChartPusher {
+	ps := []ChartPusher{}
+	if r.OCICharts() {
+		ps = append(ps, OCIPusher{Registry: r, CredentialsFile: credentialsFile})
+	}
+	if r.ChartRepository != nil {
+		ps = append(ps, HTTPPusher{Repository: *r.ChartRepository})
+	}
+	return ps
+}
+
+// OCIPusher pushes charts to the 'charts/' repositories of an OCI registry
+type OCIPusher struct {
+	Registry        registry.Registry
+	CredentialsFile string
+}
+
+var _ ChartPusher = OCIPusher{}
+
+func (p OCIPusher) URL() string {
+	return "oci://" + p.Registry.URL + "/charts"
+}
+
+func (p OCIPusher) Exists(ctx context.Context, name string, version string) (bool, error) {
+	if _, err := p.Registry.Exist(ctx, "charts/"+name, registry.OCITag(version)); err != nil {
+		slog.Debug(err.Error())
+		return false, nil
+	}
+	return true, nil
+}
+
+func (p OCIPusher) Push(ctx context.Context, c Chart, path string) error {
+	if err := p.Registry.EnsureRepository(ctx, "charts/"+c.Name); err != nil {
+		return err
+	}
+	res, err := pushPackage(path, p.URL(), p.Registry, p.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("helm: error pushing chart %s to registry %s :: %w", c.Name, p.URL(), err)
+	}
+	slog.Debug(res)
+	if _, err := p.Registry.Annotate(ctx, "charts/"+c.Name, registry.OCITag(c.Version)); err != nil {
+		return err
+	}
+	return validate(ctx, p.Registry, c)
+}
+
+// HTTPPusher uploads charts to a classic chart repository with the upload API of its type, e.g. ChartMuseum
+type HTTPPusher struct {
+	Repository registry.ChartRepository
+}
+
+var _ ChartPusher = HTTPPusher{}
+
+func (p HTTPPusher) URL() string {
+	return strings.TrimSuffix(p.Repository.URL, "/")
+}
+
+func (p HTTPPusher) client() *http.Client {
+	if !p.Repository.Insecure {
+		return http.DefaultClient
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &http.Client{Transport: t}
+}
+
+// do sends the request with the credentials of the repository
+func (p HTTPPusher) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", version.UserAgent())
+	a := p.Repository.Auth
+	switch {
+	case a.Token != "":
+		req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(a.Token))
+	case a.Username != "":
+		req.SetBasicAuth(os.ExpandEnv(a.Username), os.ExpandEnv(a.Password))
+	}
+	return p.client().Do(req)
+}
+
+// Exists looks up the version of the chart in the index of the repository
+func (p HTTPPusher) Exists(ctx context.Context, name string, version string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL()+"/index.yaml", nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := p.do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return false, nil
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("helm: error reading index of chart repository %s :: %s", p.URL(), resp.Status)
+	}
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+	idx := repo.IndexFile{}
+	if err := yaml.Unmarshal(b, &idx); err != nil {
+		return false, fmt.Errorf("helm: error reading index of chart repository %s :: %w", p.URL(), err)
+	}
+	return idx.Has(name, version), nil
+}
+
+// Push posts the package to the API of ChartMuseum, or puts it next to the index of Nexus and Artifactory repositories
+func (p HTTPPusher) Push(ctx context.Context, c Chart, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	method, url := http.MethodPut, p.URL()+"/"+fmt.Sprintf("%s-%s.tgz", c.Name, c.Version)
+	if p.Repository.Type == "chartmuseum" {
+		method, url = http.MethodPost, p.URL()+"/api/charts"
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	resp, err := p.do(req)
+	if err != nil {
+		return fmt.Errorf("helm: error uploading chart %s to chart repository %s :: %w", c.Name, p.URL(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("helm: error uploading chart %s to chart repository %s :: %s %s", c.Name, p.URL(), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package helm
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestHTTPPusher(t *testing.T) {
+	uploads := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "admin" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/index.yaml":
+			_, _ = io.WriteString(w, "apiVersion: v1\nentries:\n  loki:\n  - name: loki\n    version: 5.38.0\n")
+		case r.Method == http.MethodPost || r.Method == http.MethodPut:
+			b, _ := io.ReadAll(r.Body)
+			uploads[r.Method+" "+r.URL.Path] = string(b)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "prometheus-25.8.0.tgz")
+	if err := os.WriteFile(path, []byte("chart"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := Chart{Name: "prometheus", Version: "25.8.0"}
+
+	for typ, want := range map[string]string{"chartmuseum": "POST /api/charts", "nexus": "PUT /prometheus-25.8.0.tgz"} {
+		p := HTTPPusher{Repository: registry.ChartRepository{Type: typ, URL: srv.URL + "/", Auth: registry.Auth{Username: "admin", Password: "secret"}}}
+
+		if ok, err := p.Exists(ctx, "loki", "5.38.0"); err != nil || !ok {
+			t.Errorf("%s: want loki 5.38.0 to exist, got %v %v", typ, ok, err)
+		}
+		if ok, err := p.Exists(ctx, "prometheus", "25.8.0"); err != nil || ok {
+			t.Errorf("%s: want prometheus 25.8.0 to be missing, got %v %v", typ, ok, err)
+		}
+		if err := p.Push(ctx, c, path); err != nil {
+			t.Fatal(err)
+		}
+		if uploads[want] != "chart" {
+			t.Errorf("%s: want upload %s, got %v", typ, want, uploads)
+		}
+	}
+
+	p := HTTPPusher{Repository: registry.ChartRepository{Type: "artifactory", URL: srv.URL}}
+	if err := p.Push(ctx, c, path); err == nil {
+		t.Error("want error for an upload without credentials")
+	}
+}
+
+func TestPushers(t *testing.T) {
+	r := registry.Registry{URL: "0.0.0.0:5000"}
+	if ps := Pushers(r, ""); len(ps) != 1 || ps[0].URL() != "oci://0.0.0.0:5000/charts" {
+		t.Errorf("want the registry only, got %v", ps)
+	}
+	r.ChartRepository = &registry.ChartRepository{Type: "chartmuseum", URL: "https://charts.internal", OCI: true}
+	if ps := Pushers(r, ""); len(ps) != 2 || ps[1].URL() != "https://charts.internal" {
+		t.Errorf("want the registry and the chart repository, got %v", ps)
+	}
+}
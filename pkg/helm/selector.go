@@ -0,0 +1,151 @@
+package helm
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/distribution/reference"
+)
+
+// segment of a value path, a key, an index or a wildcard matching every key or element
+type segment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parsePath parses a path like '$.controller.extraEnv[*].value' or 'sidecars[0].image'. '*' matches every key, '[*]' every element
+func parsePath(p string) ([]segment, error) {
+	p = strings.TrimPrefix(strings.TrimPrefix(p, "$"), ".")
+	if p == "" {
+		return nil, fmt.Errorf("helm: empty value path")
+	}
+
+	res := []segment{}
+	for _, part := range strings.Split(p, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		switch {
+		case key == "*":
+			res = append(res, segment{wildcard: true})
+		case key != "":
+			res = append(res, segment{key: key})
+		case len(res) == 0 || rest == "":
+			return nil, fmt.Errorf("helm: invalid value path '%s'", p)
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("helm: unclosed index in value path '%s'", p)
+			}
+			if idx == "*" {
+				res = append(res, segment{isIndex: true, wildcard: true})
+			} else {
+				n, err := strconv.Atoi(idx)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("helm: invalid index '%s' in value path '%s'", idx, p)
+				}
+				res = append(res, segment{isIndex: true, index: n})
+			}
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("helm: invalid value path '%s'", p)
+			}
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return res, nil
+}
+
+// selectValues returns the string values at the segments, by their path, e.g. '.controller.extraEnv[1].value'
+func selectValues(v any, segs []segment, acc string, res map[string]string) {
+	if len(segs) == 0 {
+		if s, ok := v.(string); ok {
+			res[acc] = s
+		}
+		return
+	}
+
+	s := segs[0]
+	switch v := v.(type) {
+	case map[string]any:
+		if s.isIndex {
+			return
+		}
+		for k, e := range v {
+			if s.wildcard || k == s.key {
+				selectValues(e, segs[1:], acc+"."+k, res)
+			}
+		}
+	case []any:
+		if !s.isIndex {
+			return
+		}
+		for n, e := range v {
+			if s.wildcard || n == s.index {
+				selectValues(e, segs[1:], fmt.Sprintf("%s[%d]", acc, n), res)
+			}
+		}
+	}
+}
+
+// selectImages returns the images at the paths in the values, and the value paths they are found at.
+// Values of the chart are used where the custom values have none
+func selectImages(chartValues map[string]any, values map[string]any, paths []ImagePath) (map[*registry.Image][]string, error) {
+	res := map[*registry.Image][]string{}
+	for _, p := range paths {
+		segs, err := parsePath(p.Path)
+		if err != nil {
+			return nil, err
+		}
+		var pattern *regexp.Regexp
+		if p.Pattern != "" {
+			if pattern, err = regexp.Compile(p.Pattern); err != nil {
+				return nil, fmt.Errorf("helm: invalid pattern '%s' of value path '%s' :: %w", p.Pattern, p.Path, err)
+			}
+		}
+
+		found := map[string]string{}
+		selectValues(chartValues, segs, "", found)
+		selectValues(values, segs, "", found)
+
+		for path, v := range found {
+			refs := []string{v}
+			if pattern != nil {
+				refs = []string{}
+				for _, m := range pattern.FindAllStringSubmatch(v, -1) {
+					refs = append(refs, m[len(m)-1])
+				}
+			}
+			for _, ref := range refs {
+				i, err := selectedImage(strings.TrimSpace(ref))
+				if err != nil {
+					slog.Warn("value is not an image reference", slog.String("path", path), slog.String("value", ref))
+					continue
+				}
+				res[&i] = []string{path}
+			}
+		}
+	}
+	return res, nil
+}
+
+// selectedImage parses the image reference of a selected value. Tags are optional, like in the detected values
+func selectedImage(ref string) (registry.Image, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return registry.Image{}, err
+	}
+	i := registry.Image{Registry: reference.Domain(named), Repository: reference.Path(named)}
+	if t, ok := named.(reference.Tagged); ok {
+		i.Tag = t.Tag()
+	}
+	if d, ok := named.(reference.Digested); ok {
+		i.Digest = d.Digest().String()
+		i.UseDigest = true
+	}
+	return i, nil
+}
@@ -0,0 +1,51 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectImages(t *testing.T) {
+	chartValues := map[string]any{
+		"controller": map[string]any{
+			"extraEnv": []any{
+				map[string]any{"name": "SIDECAR_IMAGE", "value": "quay.io/org/sidecar:v1.2.0"},
+				map[string]any{"name": "LOG_LEVEL", "value": "info level"},
+			},
+			"args": []any{"--reloader-image=ghcr.io/org/reloader:v0.7.0", "--v=2"},
+		},
+		"crd": map[string]any{"template": "nginx"},
+	}
+	values := map[string]any{
+		"crd": map[string]any{"template": "busybox:1.36"},
+	}
+
+	res, err := selectImages(chartValues, values, []ImagePath{
+		{Path: "$.controller.extraEnv[*].value"},
+		{Path: "controller.args[*]", Pattern: `--reloader-image=(\S+)`},
+		{Path: "*.template"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+	for i, ps := range res {
+		ref := i.Registry + "/" + i.Repository + ":" + i.Tag
+		got[ref] = ps
+	}
+	want := map[string][]string{
+		"quay.io/org/sidecar:v1.2.0":     {".controller.extraEnv[0].value"},
+		"ghcr.io/org/reloader:v0.7.0":    {".controller.args[0]"},
+		"docker.io/library/busybox:1.36": {".crd.template"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	for _, p := range []string{"", "a[0", "a[x]", "a[0]b"} {
+		if _, err := parsePath(p); err == nil {
+			t.Errorf("want error for path '%s'", p)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package helm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/util/file"
+	"github.com/distribution/reference"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+// Verification is the result of verifying a chart imported to a registry
+type Verification struct {
+	Chart    Chart
+	Registry string
+	// Lint, Render and Test are the errors of 'helm lint', 'helm template' and 'helm test'. Test is nil when not run
+	Lint   error
+	Render error
+	Test   error
+	Tested bool
+	// Missing are the images referenced by the rendered chart that are not in the registry
+	Missing []string
+}
+
+// OK reports whether the chart can be deployed from the registry alone
+func (v Verification) OK() bool {
+	return v.Lint == nil && v.Render == nil && v.Test == nil && len(v.Missing) == 0
+}
+
+// VerifyOption verifies that the imported charts lint, render and reference only images in the registries, using nothing but the artifacts in the registries
+type VerifyOption struct {
+	Registries []registry.Registry
+	Charts     ChartCollection
+	// Data are the images found in each chart, pointed to the registry through the values when the chart itself is not modified
+	Data           ChartData
+	ModifyRegistry bool
+	// Patterns extend the keys of the values the images were found by
+	Patterns    Patterns
+	K8SVersion  string
+	APIVersions []string
+
+	// Kubeconfig of a disposable cluster (e.g. kind) to install the charts in and run 'helm test'. Empty skips 'helm test'
+	Kubeconfig string
+	Namespace  string
+	Timeout    time.Duration
+}
+
+// manifestImages returns the images referenced by the containers of the workloads in the manifests
+func manifestImages(manifest string) []string {
+	seen := map[string]bool{}
+	for _, m := range releaseutil.SplitManifests(manifest) {
+		var w workload
+		if err := yaml.Unmarshal([]byte(m), &w); err != nil || w.Kind == "" {
+			continue
+		}
+		spec := w.podSpec()
+		for _, c := range append(spec.Containers, spec.InitContainers...) {
+			if c.Image != "" {
+				seen[c.Image] = true
+			}
+		}
+	}
+
+	res := make([]string, 0, len(seen))
+	for i := range seen {
+		res = append(res, i)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// mirrored returns the repository and tag or digest of the image in the registry, or false if the image points elsewhere
+func mirrored(ref string, registryURL string) (string, string, bool) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", "", false
+	}
+	name, ok := strings.CutPrefix(named.Name(), strings.TrimSuffix(registryURL, "/")+"/")
+	if !ok {
+		return "", "", false
+	}
+
+	switch r := named.(type) {
+	case reference.Digested:
+		return name, r.Digest().String(), true
+	case reference.Tagged:
+		return name, r.Tag(), true
+	default:
+		return name, "latest", true
+	}
+}
+
+// pullMirrored pulls the packaged chart from the registry
+func pullMirrored(r registry.Registry, c Chart) ([]byte, error) {
+	credentialsFile, cleanup, err := r.CredentialsFile()
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	client, err := registryClient(r, credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Pull(fmt.Sprintf("%s/charts/%s:%s", r.URL, c.Name, registry.OCITag(c.Version)))
+	if err != nil {
+		return nil, err
+	}
+	return res.Chart.Data, nil
+}
+
+// values are the values of the chart deployed from the registry
+func (opt VerifyOption) values(c Chart, chartRef *chart.Chart, r registry.Registry) (map[string]any, error) {
+	values := chartRef.Values
+	if file.Exists(c.ValuesFilePath) {
+		vs, err := chartutil.ReadValuesFile(c.ValuesFilePath)
+		if err != nil {
+			return nil, err
+		}
+		values = vs.AsMap()
+	}
+
+	if !opt.ModifyRegistry {
+		for dc, imgs := range opt.Data {
+			if dc.Name != c.Name || dc.Version != c.Version {
+				continue
+			}
+			overrides, err := OverrideValues(imgs, r, DefaultPatterns().With(opt.Patterns))
+			if err != nil {
+				return nil, err
+			}
+			values = chartutil.CoalesceTables(overrides, values)
+		}
+	}
+
+	return values, nil
+}
+
+// lint the packaged chart, like 'helm lint'
+func lint(archive []byte, name string, values map[string]any) error {
+	dir, err := os.MkdirTemp("", "helmper-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, name+".tgz")
+	if err := os.WriteFile(path, archive, 0o644); err != nil {
+		return err
+	}
+
+	res := action.NewLint().Run([]string{path}, values)
+	return errors.Join(res.Errors...)
+}
+
+// test installs the chart in the cluster, runs 'helm test' and uninstalls the release again
+func (opt VerifyOption) test(chartRef *chart.Chart, values map[string]any) error {
+	settings := cli.New()
+	settings.KubeConfig = opt.Kubeconfig
+
+	cfg := new(action.Configuration)
+	if err := cfg.Init(settings.RESTClientGetter(), opt.Namespace, "secret", slog.Debug); err != nil {
+		return err
+	}
+
+	install := action.NewInstall(cfg)
+	install.ReleaseName = "helmper-verify-" + chartRef.Name()
+	if len(install.ReleaseName) > 53 {
+		install.ReleaseName = install.ReleaseName[:53]
+	}
+	install.Namespace = opt.Namespace
+	install.CreateNamespace = true
+	install.Wait = true
+	install.Timeout = opt.Timeout
+	if _, err := install.Run(chartRef, values); err != nil {
+		return fmt.Errorf("install failed :: %w", err)
+	}
+	defer func() {
+		if _, err := action.NewUninstall(cfg).Run(install.ReleaseName); err != nil {
+			slog.Warn("could not uninstall verification release", slog.String("release", install.ReleaseName), slog.String("error", err.Error()))
+		}
+	}()
+
+	t := action.NewReleaseTesting(cfg)
+	t.Namespace = opt.Namespace
+	t.Timeout = opt.Timeout
+	if _, err := t.Run(install.ReleaseName); err != nil {
+		return fmt.Errorf("test failed :: %w", err)
+	}
+	return nil
+}
+
+// verify the chart in the registry
+func (opt VerifyOption) verify(ctx context.Context, r registry.Registry, c Chart) (Verification, error) {
+	v := Verification{Chart: c, Registry: r.URL}
+
+	archive, err := pullMirrored(r, c)
+	if err != nil {
+		return v, fmt.Errorf("helm: error pulling chart %s:%s from %s :: %w", c.Name, c.Version, r.URL, err)
+	}
+	chartRef, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return v, fmt.Errorf("helm: error loading chart %s:%s from %s :: %w", c.Name, c.Version, r.URL, err)
+	}
+	values, err := opt.values(c, chartRef, r)
+	if err != nil {
+		return v, fmt.Errorf("helm: error reading values of chart %s:%s :: %w", c.Name, c.Version, err)
+	}
+
+	v.Lint = lint(archive, c.Name, values)
+
+	manifest, err := render(chartRef, values, opt.K8SVersion, opt.APIVersions)
+	if err != nil {
+		v.Render = err
+		return v, nil
+	}
+	for _, ref := range manifestImages(manifest) {
+		name, tag, ok := mirrored(ref, r.URL)
+		if !ok {
+			v.Missing = append(v.Missing, ref)
+			continue
+		}
+		if exists, _ := r.Exist(ctx, name, tag); !exists {
+			v.Missing = append(v.Missing, ref)
+		}
+	}
+
+	if opt.Kubeconfig != "" && v.OK() {
+		v.Tested = true
+		v.Test = opt.test(chartRef, values)
+	}
+
+	return v, nil
+}
+
+// Run verifies every chart in every registry
+func (opt VerifyOption) Run(ctx context.Context) ([]Verification, error) {
+	if opt.Namespace == "" {
+		opt.Namespace = "helmper-verify"
+	}
+	if opt.Timeout == 0 {
+		opt.Timeout = 5 * time.Minute
+	}
+
+	vs := []Verification{}
+	for _, r := range opt.Registries {
+		for _, c := range opt.Charts.Charts {
+			v, err := opt.verify(ctx, r, c)
+			if err != nil {
+				return nil, err
+			}
+			vs = append(vs, v)
+		}
+	}
+	return vs, nil
+}
@@ -0,0 +1,34 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestManifestImages(t *testing.T) {
+	want := []string{"busybox:1.36", "docker.io/bitnami/nginx:1.25.3", "quay.io/prometheus/prometheus:v2.48.0"}
+	if got := manifestImages(manifest); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestMirrored(t *testing.T) {
+	tests := []struct {
+		ref  string
+		name string
+		tag  string
+		ok   bool
+	}{
+		{"0.0.0.0:5000/bitnami/nginx:1.25.3", "bitnami/nginx", "1.25.3", true},
+		{"0.0.0.0:5000/bitnami/nginx@sha256:0000000000000000000000000000000000000000000000000000000000000000", "bitnami/nginx", "sha256:0000000000000000000000000000000000000000000000000000000000000000", true},
+		{"0.0.0.0:5000/busybox", "busybox", "latest", true},
+		{"docker.io/bitnami/nginx:1.25.3", "", "", false},
+		{"0.0.0.0:5001/bitnami/nginx:1.25.3", "", "", false},
+	}
+	for _, tt := range tests {
+		name, tag, ok := mirrored(tt.ref, "0.0.0.0:5000")
+		if name != tt.name || tag != tt.tag || ok != tt.ok {
+			t.Errorf("%s: want (%s, %s, %v) got (%s, %s, %v)", tt.ref, tt.name, tt.tag, tt.ok, name, tag, ok)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+)
+
+// Conditions are the values the 'when' condition of a chart is evaluated against
+type Conditions struct {
+	// Vars are the variables of the configuration, overridden by the --var flags
+	Vars map[string]string
+	// KubeVersion is the Kubernetes version of the run, e.g. '1.27.16'
+	KubeVersion string
+	// Arch is the platform images are imported for, e.g. 'linux/amd64'. Empty when all platforms are imported
+	Arch string
+}
+
+// Included evaluates the 'when' condition of the chart. The condition is a Go template with the Sprig functions,
+// like Helm templates, and the braces may be left out, e.g. 'eq .Vars.cni "cilium"'.
+// Charts without a condition are always included
+func (c Chart) Included(cond Conditions) (bool, error) {
+	if strings.TrimSpace(c.When) == "" {
+		return true, nil
+	}
+
+	text := c.When
+	if !strings.Contains(text, "{{") {
+		text = "{{ " + text + " }}"
+	}
+	t, err := template.New(c.Name).Funcs(sprig.TxtFuncMap()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return false, fmt.Errorf("helm: error parsing condition of chart %s :: %w", c.Name, err)
+	}
+	if cond.Vars == nil {
+		cond.Vars = map[string]string{}
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, cond); err != nil {
+		return false, fmt.Errorf("helm: error evaluating condition of chart %s :: %w", c.Name, err)
+	}
+	res := strings.TrimSpace(b.String())
+	if res == "" {
+		return false, nil
+	}
+	ok, err := strconv.ParseBool(res)
+	if err != nil {
+		return false, fmt.Errorf("helm: condition of chart %s evaluated to '%s', not true or false", c.Name, res)
+	}
+	return ok, nil
+}
@@ -0,0 +1,37 @@
+package helm
+
+import "testing"
+
+func TestIncluded(t *testing.T) {
+	cond := Conditions{
+		Vars:        map[string]string{"cni": "cilium"},
+		KubeVersion: "1.27.16",
+		Arch:        "linux/arm64",
+	}
+
+	tests := []struct {
+		when string
+		want bool
+	}{
+		{"", true},
+		{`eq .Vars.cni "cilium"`, true},
+		{`{{ eq .Vars.cni "calico" }}`, false},
+		{`semverCompare ">=1.28-0" .KubeVersion`, false},
+		{`and (eq .Vars.cni "cilium") (hasSuffix "arm64" .Arch)`, true},
+		{`.Vars.monitoring`, false},
+		{`{{ if .Vars.cni }}true{{ end }}`, true},
+	}
+	for _, tt := range tests {
+		got, err := Chart{Name: "cilium", When: tt.when}.Included(cond)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.when, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: want %t got %t", tt.when, tt.want, got)
+		}
+	}
+
+	if _, err := (Chart{Name: "cilium", When: `.Vars.cni`}).Included(cond); err == nil {
+		t.Error("want error for a condition that is not true or false")
+	}
+}
@@ -0,0 +1,261 @@
+package helm
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/distribution/reference"
+	"gopkg.in/yaml.v3"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/releaseutil"
+)
+
+type container struct {
+	Image string `yaml:"image"`
+}
+
+type podSpec struct {
+	Containers     []container `yaml:"containers"`
+	InitContainers []container `yaml:"initContainers"`
+}
+
+type podTemplate struct {
+	Spec podSpec `yaml:"spec"`
+}
+
+// workload is the part of a Kubernetes workload manifest referencing images
+type workload struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		podSpec     `yaml:",inline"`
+		Template    podTemplate `yaml:"template"`
+		JobTemplate struct {
+			Spec struct {
+				Template podTemplate `yaml:"template"`
+			} `yaml:"spec"`
+		} `yaml:"jobTemplate"`
+	} `yaml:"spec"`
+}
+
+func (w workload) podSpec() podSpec {
+	switch w.Kind {
+	case "Pod":
+		return w.Spec.podSpec
+	case "CronJob":
+		return w.Spec.JobTemplate.Spec.Template.Spec
+	default:
+		return w.Spec.Template.Spec
+	}
+}
+
+// render the chart templates client side, like 'helm template --kube-version --api-versions'
+func render(chartRef *chart.Chart, values map[string]any, k8sVersion string, apiVersions []string) (string, error) {
+	client := action.NewInstall(&action.Configuration{})
+	client.DryRun = true
+	client.ClientOnly = true
+	client.Replace = true
+	client.ReleaseName = chartRef.Name()
+	client.Namespace = "default"
+
+	kv, err := chartutil.ParseKubeVersion(k8sVersion)
+	if err != nil {
+		return "", err
+	}
+	client.KubeVersion = kv
+	client.APIVersions = chartutil.VersionSet(apiVersions)
+
+	rel, err := client.Run(chartRef, values)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(rel.Manifest)
+	// hooks are often Jobs
+	for _, h := range rel.Hooks {
+		sb.WriteString("\n---\n")
+		sb.WriteString(h.Manifest)
+	}
+	return sb.String(), nil
+}
+
+// imageKey identifies an image by registry and repository, as tags are often defaulted in templates
+func imageKey(ref string) (string, bool) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", false
+	}
+	return named.Name(), true
+}
+
+// workloads maps the images referenced in the manifests to the workload kinds using them. Images in init containers are recorded as '<Kind> (init)'
+func workloads(manifest string) map[string][]string {
+	seen := map[string]map[string]bool{}
+	add := func(image string, kind string) {
+		key, ok := imageKey(image)
+		if !ok {
+			return
+		}
+		if seen[key] == nil {
+			seen[key] = map[string]bool{}
+		}
+		seen[key][kind] = true
+	}
+
+	for _, m := range releaseutil.SplitManifests(manifest) {
+		var w workload
+		if err := yaml.Unmarshal([]byte(m), &w); err != nil || w.Kind == "" {
+			continue
+		}
+		spec := w.podSpec()
+		for _, c := range spec.Containers {
+			add(c.Image, w.Kind)
+		}
+		for _, c := range spec.InitContainers {
+			add(c.Image, fmt.Sprintf("%s (init)", w.Kind))
+		}
+	}
+
+	res := make(map[string][]string, len(seen))
+	for image, kinds := range seen {
+		for k := range kinds {
+			res[image] = append(res[image], k)
+		}
+		sort.Strings(res[image])
+	}
+	return res
+}
+
+// workloadsOf returns the workload kinds referencing the image in the rendered chart
+func workloadsOf(m map[string][]string, i registry.Image) []string {
+	ref, err := i.String()
+	if err != nil {
+		return nil
+	}
+	key, ok := imageKey(ref)
+	if !ok {
+		return nil
+	}
+	return m[key]
+}
+
+// renderedImages maps the images referenced in the manifests to the resources referencing them, e.g. 'Deployment/nginx'.
+// Besides the containers of workloads, every 'image' field of other resources is searched, e.g. of custom resources
+func renderedImages(manifest string) map[string][]string {
+	res := map[string][]string{}
+	add := func(image string, source string) {
+		if _, ok := imageKey(image); !ok || image == "" {
+			return
+		}
+		for _, s := range res[image] {
+			if s == source {
+				return
+			}
+		}
+		res[image] = append(res[image], source)
+	}
+
+	for _, m := range releaseutil.SplitManifests(manifest) {
+		var doc map[string]any
+		if err := yaml.Unmarshal([]byte(m), &doc); err != nil || doc == nil {
+			continue
+		}
+		kind, _ := doc["kind"].(string)
+		// the data of config maps and secrets is not pulled by the cluster
+		if kind == "" || kind == "ConfigMap" || kind == "Secret" {
+			continue
+		}
+		name := ""
+		if md, ok := doc["metadata"].(map[string]any); ok {
+			name, _ = md["name"].(string)
+		}
+		source := kind + "/" + name
+
+		var w workload
+		if err := yaml.Unmarshal([]byte(m), &w); err == nil {
+			spec := w.podSpec()
+			if len(spec.Containers)+len(spec.InitContainers) > 0 {
+				for _, c := range append(spec.Containers, spec.InitContainers...) {
+					add(c.Image, source)
+				}
+				continue
+			}
+		}
+		imageFields(doc, func(image string) { add(image, source) })
+	}
+	for _, ss := range res {
+		sort.Strings(ss)
+	}
+	return res
+}
+
+// imageFields calls f with the value of every 'image' field holding an image reference with a tag, digest or path
+func imageFields(v any, f func(string)) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if s, ok := e.(string); ok && k == "image" && strings.ContainsAny(s, ":/@") {
+				f(s)
+				continue
+			}
+			imageFields(e, f)
+		}
+	case []any:
+		for _, e := range v {
+			imageFields(e, f)
+		}
+	}
+}
+
+// manifestPath prefixes the paths of images found only in the rendered manifests, which are not value paths
+const manifestPath = "manifest:"
+
+// manifestOnlyImages returns the images referenced in the rendered manifest that are not among the images found in the values.
+// Their paths and workloads are the resources referencing them, e.g. 'manifest:Deployment/nginx'
+func manifestOnlyImages(found map[*registry.Image][]string, manifest string) map[*registry.Image][]string {
+	known := map[string]bool{}
+	for i := range found {
+		if ref, err := i.String(); err == nil {
+			if key, ok := imageKey(ref); ok {
+				known[key] = true
+			}
+		}
+	}
+
+	res := map[*registry.Image][]string{}
+	for ref, sources := range renderedImages(manifest) {
+		key, _ := imageKey(ref)
+		if known[key] {
+			continue
+		}
+		i, err := selectedImage(ref)
+		if err != nil {
+			continue
+		}
+		// rendered references without a tag are pulled as latest
+		if i.Tag == "" && i.Digest == "" {
+			i.Tag = "latest"
+		}
+		paths := make([]string, 0, len(sources))
+		for _, s := range sources {
+			paths = append(paths, manifestPath+s)
+			kind, _, _ := strings.Cut(s, "/")
+			if !slices.Contains(i.Workloads, kind) {
+				i.Workloads = append(i.Workloads, kind)
+			}
+		}
+		res[&i] = paths
+	}
+	return res
+}
+
+// ManifestImages returns the images referenced in the manifests, with the resources referencing them as paths,
+// e.g. 'manifest:Deployment/nginx'
+func ManifestImages(manifest string) map[*registry.Image][]string {
+	return manifestOnlyImages(nil, manifest)
+}
@@ -0,0 +1,163 @@
+package helm
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+const manifest = `---
+apiVersion: apps/v1
+kind: Deployment
+spec:
+  template:
+    spec:
+      initContainers:
+      - image: busybox:1.36
+      containers:
+      - image: docker.io/bitnami/nginx:1.25.3
+---
+apiVersion: batch/v1
+kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - image: busybox:1.36
+---
+apiVersion: v1
+kind: Pod
+spec:
+  containers:
+  - image: quay.io/prometheus/prometheus:v2.48.0
+---
+apiVersion: v1
+kind: ConfigMap
+data:
+  image: ignored:1.0
+`
+
+func TestWorkloads(t *testing.T) {
+	ws := workloads(manifest)
+
+	tests := []struct {
+		ref  string
+		want []string
+	}{
+		{ref: "docker.io/library/busybox:1.36", want: []string{"CronJob", "Deployment (init)"}},
+		{ref: "docker.io/bitnami/nginx:1.25.3", want: []string{"Deployment"}},
+		{ref: "quay.io/prometheus/prometheus:v2.48.0", want: []string{"Pod"}},
+		{ref: "docker.io/library/ignored:1.0", want: nil},
+	}
+
+	for _, tt := range tests {
+		i, err := registry.RefToImage(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := workloadsOf(ws, i); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "test", Version: "0.1.0"},
+		Templates: []*chart.File{{
+			Name: "templates/daemonset.yaml",
+			Data: []byte(`apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  template:
+    spec:
+      containers:
+      - image: {{ .Values.image }}
+`),
+		}},
+	}
+
+	m, err := render(c, map[string]any{"image": "busybox:1.36"}, "1.27.16", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws := workloads(m)
+	if got := ws["docker.io/library/busybox"]; !reflect.DeepEqual(got, []string{"DaemonSet"}) {
+		t.Errorf("got %v", ws)
+	}
+}
+
+func TestRenderAPIVersions(t *testing.T) {
+	c := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "test", Version: "0.1.0"},
+		Templates: []*chart.File{{
+			Name: "templates/pod.yaml",
+			Data: []byte(`{{- if .Capabilities.APIVersions.Has "monitoring.coreos.com/v1/ServiceMonitor" }}
+apiVersion: v1
+kind: Pod
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  containers:
+  - image: busybox:1.36
+{{- end }}
+`),
+		}},
+	}
+
+	m, err := render(c, nil, "1.27.16", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(workloads(m)) != 0 {
+		t.Errorf("want no workloads without the API version, got %v", workloads(m))
+	}
+
+	m, err = render(c, nil, "1.27.16", []string{"monitoring.coreos.com/v1/ServiceMonitor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := workloads(m)["docker.io/library/busybox"]; !ok {
+		t.Errorf("want busybox workload with the API version, got %v", workloads(m))
+	}
+}
+
+func TestManifestOnlyImages(t *testing.T) {
+	m := manifest + `---
+apiVersion: monitoring.coreos.com/v1
+kind: Alertmanager
+metadata:
+  name: main
+spec:
+  image: quay.io/prometheus/alertmanager:v0.27.0
+  replicas: 1
+`
+	nginx, err := registry.RefToImage("docker.io/bitnami/nginx:1.25.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := manifestOnlyImages(map[*registry.Image][]string{&nginx: {"image"}}, m)
+
+	got := map[string][]string{}
+	for i, paths := range res {
+		ref, err := i.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[ref] = paths
+	}
+	want := map[string][]string{
+		"docker.io/library/busybox:1.36":          {"manifest:CronJob/", "manifest:Deployment/"},
+		"quay.io/prometheus/prometheus:v2.48.0":   {"manifest:Pod/"},
+		"quay.io/prometheus/alertmanager:v0.27.0": {"manifest:Alertmanager/main"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package hooks runs user configured shell commands and HTTP webhooks after the stages of a run, with the charts and images of the stage as a JSON payload, e.g. to notify downstream systems of newly imported images.
+*/
+package hooks
@@ -0,0 +1,120 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/redact"
+)
+
+// Stages hooks run after
+const (
+	StageParse  = "parse"
+	StageImport = "import"
+	StagePatch  = "patch"
+	StageSign   = "sign"
+)
+
+// Stages are the stages hooks can run after, in the order of a run
+var Stages = []string{StageParse, StageImport, StagePatch, StageSign}
+
+// Payload is the JSON document hooks receive, on stdin for commands and as the body for webhooks
+type Payload struct {
+	Stage string    `json:"stage"`
+	Time  time.Time `json:"time"`
+	// Charts are the charts of the stage as '<name>:<version>', and Images the image references
+	Charts []string `json:"charts"`
+	Images []string `json:"images"`
+}
+
+// Hook is a shell command or webhook run after a stage. Environment variables are expanded in the URL and the headers
+type Hook struct {
+	Name    string
+	Stage   string
+	Command []string
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+	// FailOnError fails the run if the hook fails. Failed hooks are only logged otherwise
+	FailOnError bool
+}
+
+func (h Hook) exec(ctx context.Context, b []byte) error {
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Env = append(os.Environ(), "HELMPER_STAGE="+h.Stage)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hooks: command of hook %s failed: %s :: %w", h.Name, bytes.TrimSpace(out), err)
+	}
+	return nil
+}
+
+func (h Hook) post(ctx context.Context, b []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.ExpandEnv(h.URL), bytes.NewReader(b))
+	if err != nil {
+		return redact.URLError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range h.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("hooks: error posting hook %s :: %w", h.Name, redact.URLError(err))
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("hooks: webhook of hook %s responded with status %s", h.Name, res.Status)
+	}
+	return nil
+}
+
+// Run runs the hook with the payload
+func (h Hook) Run(ctx context.Context, p Payload) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if len(h.Command) > 0 {
+		return h.exec(ctx, b)
+	}
+	return h.post(ctx, b)
+}
+
+// Run runs the hooks of the stage in order. Failed hooks are logged, and the first error of a hook failing on errors is returned
+func Run(ctx context.Context, hs []Hook, p Payload) error {
+	if p.Time.IsZero() {
+		p.Time = time.Now().UTC()
+	}
+	for _, h := range hs {
+		if h.Stage != p.Stage {
+			continue
+		}
+		if err := h.Run(ctx, p); err != nil {
+			if h.FailOnError {
+				return err
+			}
+			slog.Warn("hook failed", slog.String("hook", h.Name), slog.String("stage", p.Stage), slog.String("error", err.Error()))
+			continue
+		}
+		slog.Debug("ran hook", slog.String("hook", h.Name), slog.String("stage", p.Stage))
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+var payload = Payload{Stage: StageImport, Charts: []string{"prometheus:25.8.0"}, Images: []string{"quay.io/prometheus/prometheus:v2.48.0"}}
+
+func TestRunCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload.json")
+	hs := []Hook{
+		{Name: "write", Stage: StageImport, Command: []string{"sh", "-c", `cat > "$0"; echo "$HELMPER_STAGE" >> "$0"`, path}},
+		{Name: "other stage", Stage: StagePatch, Command: []string{"false"}, FailOnError: true},
+	}
+	if err := Run(context.Background(), hs, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p Payload
+	if err := json.NewDecoder(bytes.NewReader(b)).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Stage != StageImport || !slices.Equal(p.Images, payload.Images) || p.Time.IsZero() {
+		t.Errorf("unexpected payload %+v", p)
+	}
+}
+
+func TestRunWebhook(t *testing.T) {
+	var got Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+	t.Setenv("HOOK_TOKEN", "secret")
+
+	hs := []Hook{{Name: "notify", Stage: StageImport, URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer ${HOOK_TOKEN}"}}}
+	if err := Run(context.Background(), hs, payload); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got.Charts, payload.Charts) {
+		t.Errorf("unexpected payload %+v", got)
+	}
+}
+
+func TestRunFailOnError(t *testing.T) {
+	hs := []Hook{{Name: "fail", Stage: StageImport, Command: []string{"false"}}}
+	if err := Run(context.Background(), hs, payload); err != nil {
+		t.Errorf("want failed hooks only logged got %v", err)
+	}
+	hs[0].FailOnError = true
+	if err := Run(context.Background(), hs, payload); err == nil {
+		t.Error("want error for a failed hook failing on errors")
+	}
+}
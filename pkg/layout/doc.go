@@ -0,0 +1,4 @@
+/*
+Package layout places the files Helmper writes during a run (scan reports, patched image tars) in per-chart and per-version folders, and keeps an index of which chart and image each file belongs to.
+*/
+package layout
@@ -0,0 +1,120 @@
+package layout
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// IndexFile is written to the root of every output folder
+const IndexFile = "index.json"
+
+// Unassigned is the folder used for files of images not assigned to a chart
+const Unassigned = "_unassigned"
+
+type Owner struct {
+	Chart   string `json:"chart"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	Owner
+	Image string `json:"image"`
+	Kind  string `json:"kind"`
+	// Path relative to the output folder
+	Path string `json:"path"`
+}
+
+// Layout is safe to use concurrently
+type Layout struct {
+	mu      sync.Mutex
+	owners  map[string]Owner
+	entries map[string]map[string]Entry
+}
+
+func New() *Layout {
+	return &Layout{
+		owners:  make(map[string]Owner),
+		entries: make(map[string]map[string]Entry),
+	}
+}
+
+// Assign places the files of image ref in the folder of the chart. Images shared between charts stay with the first chart assigned
+func (l *Layout) Assign(ref string, chart string, version string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.owners[ref]; ok {
+		return
+	}
+	l.owners[ref] = Owner{Chart: chart, Version: version}
+}
+
+func clean(s string) string {
+	return strings.NewReplacer(":", "_", "@", "_").Replace(s)
+}
+
+// Path returns the path of a file of the given kind for image ref below root, i.e.
+// <root>/<chart>/<version>/<kind>/<image name>/<tag><ext>. The parent folder is created
+func (l *Layout) Path(root string, kind string, ref string, name string, tag string, ext string) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	o, ok := l.owners[ref]
+	if !ok {
+		o = Owner{Chart: Unassigned}
+	}
+
+	rel := filepath.Join(o.Chart, o.Version, kind, filepath.FromSlash(name), clean(tag)+ext)
+	p := filepath.Join(root, rel)
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	if _, ok := l.entries[root]; !ok {
+		l.entries[root] = make(map[string]Entry)
+	}
+	l.entries[root][rel] = Entry{
+		Owner: o,
+		Image: ref,
+		Kind:  kind,
+		Path:  filepath.ToSlash(rel),
+	}
+
+	return p, nil
+}
+
+// Entries returns the files placed below root sorted by path
+func (l *Layout) Entries(root string) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	es := make([]Entry, 0, len(l.entries[root]))
+	for _, e := range l.entries[root] {
+		es = append(es, e)
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].Path < es[j].Path })
+	return es
+}
+
+// WriteIndex writes the index of every output folder with files placed in it
+func (l *Layout) WriteIndex() error {
+	l.mu.Lock()
+	roots := make([]string, 0, len(l.entries))
+	for root := range l.entries {
+		roots = append(roots, root)
+	}
+	l.mu.Unlock()
+
+	for _, root := range roots {
+		b, err := json.MarshalIndent(l.Entries(root), "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(root, IndexFile), b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package layout
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	root := t.TempDir()
+
+	l := New()
+	l.Assign("docker.io/prom/prometheus:v2.48.0", "prometheus", "25.8.0")
+	l.Assign("docker.io/prom/prometheus:v2.48.0", "kube-prometheus-stack", "55.0.0")
+
+	p, err := l.Path(root, "prescan", "docker.io/prom/prometheus:v2.48.0", "prom/prometheus", "v2.48.0", ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := filepath.Join(root, "prometheus", "25.8.0", "prescan", "prom", "prometheus", "v2.48.0.json")
+	if p != expected {
+		t.Errorf("want '%s' got '%s'", expected, p)
+	}
+	if _, err := os.Stat(filepath.Dir(p)); err != nil {
+		t.Errorf("want parent folder to exist got '%v'", err)
+	}
+
+	p, err = l.Path(root, "tar", "ghcr.io/org/app@sha256:abc", "org/app", "1.0@sha256:abc", ".tar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = filepath.Join(root, Unassigned, "tar", "org", "app", "1.0_sha256_abc.tar")
+	if p != expected {
+		t.Errorf("want '%s' got '%s'", expected, p)
+	}
+}
+
+func TestWriteIndex(t *testing.T) {
+	root := t.TempDir()
+
+	l := New()
+	l.Assign("docker.io/library/busybox:latest", "images", "0.0.0")
+	for _, kind := range []string{"prescan", "postscan", "prescan"} {
+		if _, err := l.Path(root, kind, "docker.io/library/busybox:latest", "library/busybox", "latest", ".json"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.WriteIndex(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	es := []Entry{}
+	if err := json.Unmarshal(b, &es); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 2
+	if len(es) != expected {
+		t.Fatalf("want '%d' got '%d'", expected, len(es))
+	}
+	if es[0].Path != "images/0.0.0/postscan/library/busybox/latest.json" {
+		t.Errorf("want '%s' got '%s'", "images/0.0.0/postscan/library/busybox/latest.json", es[0].Path)
+	}
+	if es[0].Chart != "images" {
+		t.Errorf("want '%s' got '%s'", "images", es[0].Chart)
+	}
+}
@@ -0,0 +1,129 @@
+package lock
+
+import (
+	"sort"
+)
+
+type Change string
+
+const (
+	Added   Change = "added"
+	Removed Change = "removed"
+	// Updated artifacts have a single version or tag replaced by another
+	Updated Change = "updated"
+	// Changed artifacts have the same version or tag, but a different digest in a registry
+	Changed Change = "changed"
+)
+
+// Difference is a change of a chart or image between two lockfiles
+type Difference struct {
+	// Kind is 'chart' or 'image'
+	Kind   string `json:"kind" yaml:"kind"`
+	Name   string `json:"name" yaml:"name"`
+	Change Change `json:"change" yaml:"change"`
+	// From and To are the chart versions or image tags. From is empty for added and To for removed artifacts
+	From string `json:"from,omitempty" yaml:"from,omitempty"`
+	To   string `json:"to,omitempty" yaml:"to,omitempty"`
+	// Registry, FromDigest and ToDigest are set for changed artifacts
+	Registry   string `json:"registry,omitempty" yaml:"registry,omitempty"`
+	FromDigest string `json:"fromDigest,omitempty" yaml:"fromDigest,omitempty"`
+	ToDigest   string `json:"toDigest,omitempty" yaml:"toDigest,omitempty"`
+}
+
+// entry is a chart or image in a lockfile
+type entry struct {
+	name    string
+	version string
+	digests map[string]string
+}
+
+// diffEntries compares the versions of each named entry. A single removed and added version of a name is reported as updated
+func diffEntries(kind string, old []entry, new []entry) []Difference {
+	index := func(es []entry) map[string]map[string]entry {
+		m := map[string]map[string]entry{}
+		for _, e := range es {
+			if m[e.name] == nil {
+				m[e.name] = map[string]entry{}
+			}
+			m[e.name][e.version] = e
+		}
+		return m
+	}
+	o, n := index(old), index(new)
+
+	names := map[string]bool{}
+	for name := range o {
+		names[name] = true
+	}
+	for name := range n {
+		names[name] = true
+	}
+
+	res := []Difference{}
+	for name := range names {
+		removed, added := []string{}, []string{}
+		for v, oe := range o[name] {
+			ne, ok := n[name][v]
+			if !ok {
+				removed = append(removed, v)
+				continue
+			}
+			for r, d := range ne.digests {
+				if od, ok := oe.digests[r]; ok && od != d {
+					res = append(res, Difference{Kind: kind, Name: name, Change: Changed, From: v, To: v, Registry: r, FromDigest: od, ToDigest: d})
+				}
+			}
+		}
+		for v := range n[name] {
+			if _, ok := o[name][v]; !ok {
+				added = append(added, v)
+			}
+		}
+
+		if len(removed) == 1 && len(added) == 1 {
+			res = append(res, Difference{Kind: kind, Name: name, Change: Updated, From: removed[0], To: added[0]})
+			continue
+		}
+		for _, v := range removed {
+			res = append(res, Difference{Kind: kind, Name: name, Change: Removed, From: v})
+		}
+		for _, v := range added {
+			res = append(res, Difference{Kind: kind, Name: name, Change: Added, To: v})
+		}
+	}
+	return res
+}
+
+// Diff returns the charts and images added, removed, updated or changed from the old to the new lockfile, sorted by kind and name
+func Diff(old *Lock, new *Lock) []Difference {
+	charts := func(l *Lock) []entry {
+		es := make([]entry, 0, len(l.Charts))
+		for _, c := range l.Charts {
+			es = append(es, entry{c.Name, c.Version, c.Digests})
+		}
+		return es
+	}
+	images := func(l *Lock) []entry {
+		es := make([]entry, 0, len(l.Images))
+		for _, i := range l.Images {
+			es = append(es, entry{i.Name, i.Tag, i.Digests})
+		}
+		return es
+	}
+
+	res := append(diffEntries("chart", charts(old), charts(new)), diffEntries("image", images(old), images(new))...)
+	sort.Slice(res, func(i, j int) bool {
+		a, b := res[i], res[j]
+		switch {
+		case a.Kind != b.Kind:
+			return a.Kind < b.Kind
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.From+a.To != b.From+b.To:
+			return a.From+a.To < b.From+b.To
+		default:
+			return a.Registry < b.Registry
+		}
+	})
+	return res
+}
@@ -0,0 +1,45 @@
+package lock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Lock{
+		Charts: []Chart{
+			{Name: "prometheus", Version: "25.0.0", Digests: map[string]string{"registry.internal": "sha256:a"}},
+			{Name: "loki", Version: "5.0.0"},
+		},
+		Images: []Image{
+			{Name: "library/nginx", Tag: "1.25", Digests: map[string]string{"registry.internal": "sha256:b"}},
+			{Name: "library/redis", Tag: "7.0"},
+		},
+	}
+	new := &Lock{
+		Charts: []Chart{
+			{Name: "prometheus", Version: "25.1.0", Digests: map[string]string{"registry.internal": "sha256:c"}},
+			{Name: "grafana", Version: "7.0.0"},
+		},
+		Images: []Image{
+			{Name: "library/nginx", Tag: "1.25", Digests: map[string]string{"registry.internal": "sha256:d"}},
+			{Name: "library/redis", Tag: "7.0"},
+			{Name: "library/redis", Tag: "7.2"},
+		},
+	}
+
+	want := []Difference{
+		{Kind: "chart", Name: "grafana", Change: Added, To: "7.0.0"},
+		{Kind: "chart", Name: "loki", Change: Removed, From: "5.0.0"},
+		{Kind: "chart", Name: "prometheus", Change: Updated, From: "25.0.0", To: "25.1.0"},
+		{Kind: "image", Name: "library/nginx", Change: Changed, From: "1.25", To: "1.25", Registry: "registry.internal", FromDigest: "sha256:b", ToDigest: "sha256:d"},
+		{Kind: "image", Name: "library/redis", Change: Added, To: "7.2"},
+	}
+	if got := Diff(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v got %+v", want, got)
+	}
+
+	if got := Diff(new, new); len(got) != 0 {
+		t.Errorf("want no differences got %+v", got)
+	}
+}
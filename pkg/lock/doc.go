@@ -0,0 +1,4 @@
+/*
+Package lock implements the Helmper lockfile. The lockfile pins every chart and image of a run to the digests present in the target registries, making imports reproducible and comparable between runs.
+*/
+package lock
@@ -0,0 +1,111 @@
+package lock
+
+import (
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const APIVersion = "helmper.io/v1"
+
+type Chart struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version"`
+	Repo    string `yaml:"repo"`
+	// Digests maps registry URL to the digest of the chart in that registry
+	Digests map[string]string `yaml:"digests"`
+}
+
+type Image struct {
+	// Source is the upstream image reference
+	Source string `yaml:"source"`
+	Name   string `yaml:"name"`
+	Tag    string `yaml:"tag"`
+	// Digests maps registry URL to the digest of the image in that registry
+	Digests map[string]string `yaml:"digests"`
+}
+
+type Lock struct {
+	APIVersion string    `yaml:"apiVersion"`
+	Generated  time.Time `yaml:"generated"`
+	// GeneratedBy is the Helmper version that wrote the lockfile
+	GeneratedBy string  `yaml:"generatedBy,omitempty"`
+	Charts      []Chart `yaml:"charts"`
+	Images      []Image `yaml:"images"`
+}
+
+func New() *Lock {
+	return &Lock{
+		APIVersion: APIVersion,
+		Generated:  time.Now().UTC(),
+		Charts:     []Chart{},
+		Images:     []Image{},
+	}
+}
+
+func (l *Lock) AddChart(c Chart) {
+	for i, e := range l.Charts {
+		if e.Name == c.Name && e.Version == c.Version {
+			for k, v := range c.Digests {
+				l.Charts[i].Digests[k] = v
+			}
+			return
+		}
+	}
+	l.Charts = append(l.Charts, c)
+}
+
+func (l *Lock) AddImage(img Image) {
+	for i, e := range l.Images {
+		if e.Name == img.Name && e.Tag == img.Tag {
+			for k, v := range img.Digests {
+				l.Images[i].Digests[k] = v
+			}
+			return
+		}
+	}
+	l.Images = append(l.Images, img)
+}
+
+// sort entries to produce stable output
+func (l *Lock) sort() {
+	sort.Slice(l.Charts, func(i, j int) bool {
+		if l.Charts[i].Name == l.Charts[j].Name {
+			return l.Charts[i].Version < l.Charts[j].Version
+		}
+		return l.Charts[i].Name < l.Charts[j].Name
+	})
+	sort.Slice(l.Images, func(i, j int) bool {
+		if l.Images[i].Name == l.Images[j].Name {
+			return l.Images[i].Tag < l.Images[j].Tag
+		}
+		return l.Images[i].Name < l.Images[j].Name
+	})
+}
+
+func Load(path string) (*Lock, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Lock{}
+	if err := yaml.Unmarshal(b, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *Lock) Write(path string) error {
+	l.sort()
+
+	b, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0644)
+}
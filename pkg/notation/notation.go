@@ -0,0 +1,136 @@
+package notation
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/notaryproject/notation-core-go/signature/cose"
+	"github.com/notaryproject/notation-core-go/signature/jws"
+	"github.com/notaryproject/notation-go"
+	notationregistry "github.com/notaryproject/notation-go/registry"
+	"github.com/notaryproject/notation-go/signer"
+)
+
+const (
+	// Signature envelope formats
+	FormatJWS  = "jws"
+	FormatCOSE = "cose"
+)
+
+// MediaType returns the media type of the signature envelope format
+func MediaType(format string) (string, error) {
+	switch format {
+	case FormatJWS, "":
+		return jws.MediaTypeEnvelope, nil
+	case FormatCOSE:
+		return cose.MediaTypeEnvelope, nil
+	default:
+		return "", fmt.Errorf("notation: unsupported signature format '%s'", format)
+	}
+}
+
+// SignOption signs artifacts in the registries with Notation, using a private key and its certificate chain
+type SignOption struct {
+	Registries []registry.Registry
+
+	// KeyPath is the PEM encoded private key and CertPath the PEM encoded certificate chain, leaf certificate first
+	KeyPath  string
+	CertPath string
+	// Format is the signature envelope format, 'jws' (default) or 'cose'
+	Format string
+	// Expiry of the signatures. Zero never expires
+	Expiry time.Duration
+
+	// DryRun records the signatures in Plan instead of signing
+	DryRun bool
+	Plan   *plan.Plan
+}
+
+var _ registry.Signer = SignOption{}
+
+// locate finds the registry of the reference and splits it into the repository name and the digest
+func (so SignOption) locate(ref string) (registry.Registry, string, string, error) {
+	for _, r := range so.Registries {
+		rest, ok := strings.CutPrefix(ref, r.URL+"/")
+		if !ok {
+			continue
+		}
+		name, digest, ok := strings.Cut(rest, "@")
+		if !ok {
+			name, digest, _ = strings.Cut(rest, ":")
+		}
+		return r, name, digest, nil
+	}
+	return registry.Registry{}, "", "", fmt.Errorf("notation: no registry configured for '%s'", ref)
+}
+
+// Sign signs the artifacts referenced by digest, and pushes the signatures to their registries as OCI referrers
+func (so SignOption) Sign(as []registry.Artifact) error {
+	if len(as) == 0 {
+		return nil
+	}
+
+	if so.DryRun {
+		for _, a := range as {
+			r, _, _, err := so.locate(a.Ref)
+			if err != nil {
+				return err
+			}
+			so.Plan.Add(plan.Action{
+				Kind:            a.SignKind(),
+				Target:          a.Ref,
+				Signer:          "notation",
+				SignatureFormat: so.Format,
+				Insecure:        r.Insecure,
+				PlainHTTP:       r.PlainHTTP,
+			})
+		}
+		return nil
+	}
+
+	mediaType, err := MediaType(so.Format)
+	if err != nil {
+		return err
+	}
+	s, err := signer.NewFromFiles(so.KeyPath, so.CertPath)
+	if err != nil {
+		return fmt.Errorf("notation: error loading signing key %s and certificate %s :: %w", so.KeyPath, so.CertPath, err)
+	}
+
+	bar := terminal.NewBar(len(as), "Signing with Notation...\r")
+	ctx := context.Background()
+	for _, a := range as {
+		ref := a.Ref
+		r, name, digest, err := so.locate(ref)
+		if err != nil {
+			return err
+		}
+		repo, err := r.Repository(name)
+		if err != nil {
+			return err
+		}
+
+		_, err = notation.Sign(ctx, s, notationregistry.NewRepository(repo), notation.SignOptions{
+			SignerSignOptions: notation.SignerSignOptions{
+				SignatureMediaType: mediaType,
+				ExpiryDuration:     so.Expiry,
+				SigningAgent:       "helmper",
+			},
+			ArtifactReference: digest,
+		})
+		if err != nil {
+			return fmt.Errorf("notation: error signing %s :: %w", ref, err)
+		}
+		slog.Debug("signed with notation", slog.String("ref", ref))
+		_ = bar.Add(1)
+	}
+	_ = bar.Finish()
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package notation
+
+import (
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+func TestLocate(t *testing.T) {
+	so := SignOption{Registries: []registry.Registry{{URL: "0.0.0.0:5000"}, {URL: "registry.internal/mirror"}}}
+
+	tests := []struct {
+		ref    string
+		url    string
+		name   string
+		digest string
+	}{
+		{"0.0.0.0:5000/charts/prometheus@sha256:abc", "0.0.0.0:5000", "charts/prometheus", "sha256:abc"},
+		{"registry.internal/mirror/library/nginx@sha256:def", "registry.internal/mirror", "library/nginx", "sha256:def"},
+		{"0.0.0.0:5000/charts/prometheus:25.8.0", "0.0.0.0:5000", "charts/prometheus", "25.8.0"},
+	}
+	for _, tt := range tests {
+		r, name, digest, err := so.locate(tt.ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.URL != tt.url || name != tt.name || digest != tt.digest {
+			t.Errorf("%s: want (%s, %s, %s) got (%s, %s, %s)", tt.ref, tt.url, tt.name, tt.digest, r.URL, name, digest)
+		}
+	}
+
+	if _, _, _, err := so.locate("docker.io/library/nginx@sha256:abc"); err == nil {
+		t.Error("want error for unknown registry")
+	}
+}
+
+func TestSignDryRun(t *testing.T) {
+	p := plan.New()
+	so := SignOption{
+		Registries: []registry.Registry{{URL: "0.0.0.0:5000", PlainHTTP: true}},
+		Format:     FormatCOSE,
+		DryRun:     true,
+		Plan:       p,
+	}
+	if err := so.Sign(registry.Artifacts(registry.ImageArtifact, "0.0.0.0:5000/library/nginx:1.25")); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := p.Actions()[0].Commands()
+	expected := `notation sign --signature-format 'cose' --insecure-registry "$(crane digest --full-ref '0.0.0.0:5000/library/nginx:1.25' --insecure)"`
+	if len(cmds) != 1 || cmds[0] != expected {
+		t.Errorf("want '%s' got '%v'", expected, cmds)
+	}
+}
+
+func TestMediaType(t *testing.T) {
+	for _, f := range []string{"", FormatJWS, FormatCOSE} {
+		if _, err := MediaType(f); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := MediaType("x509"); err == nil {
+		t.Error("want error for unsupported format")
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package plan records the actions Helmper intends to take against registries (pushing charts, copying images and signing artifacts) so they can be reported, or rendered as equivalent shell commands, instead of being executed.
+*/
+package plan
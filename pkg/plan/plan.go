@@ -0,0 +1,103 @@
+package plan
+
+import (
+	"sync"
+)
+
+type Kind string
+
+const (
+	PushChart Kind = "push-chart"
+	CopyImage Kind = "copy-image"
+	// CopySibling copies a variant of an image discovered by tag convention, listed apart from the images found in charts for review
+	CopySibling Kind = "copy-sibling"
+	SignChart   Kind = "sign-chart"
+	SignImage   Kind = "sign-image"
+	// PatchImage patches the source image with Copacetic and pushes the result to the target
+	PatchImage Kind = "patch-image"
+	// AttestImage attaches a signed in-toto attestation of the report to the target
+	AttestImage Kind = "attest-image"
+	// WarmImage pulls the source through the pull-through cache at the target without storing it
+	WarmImage Kind = "warm-image"
+	// ReplicateImage lets Harbor replicate the source to the target with a replication rule
+	ReplicateImage Kind = "replicate-image"
+	// LoadArtifact pushes a chart or image from a bundle (OCI image layout) to the target
+	LoadArtifact Kind = "load-artifact"
+)
+
+type Action struct {
+	Kind Kind
+	// Source is the artifact the action reads from. For charts this is the
+	// chart name, for images the full source reference.
+	Source string
+	// Target is the reference the action writes to
+	Target string
+
+	// Chart specific. RepositoryType is the upload API of the classic chart repository the chart is uploaded to, e.g. 'chartmuseum'.
+	// Empty pushes the chart to the OCI registry
+	Version        string
+	Repo           string
+	RepositoryType string
+
+	// Image specific. Platforms of multi-arch images are copied as a new index
+	Architecture *string
+	Platforms    []string
+	// Referrers copies the OCI referrers of the image, e.g. signatures and SBOMs
+	Referrers bool
+
+	// Sign specific. Signer is 'notation' for Notation signatures in the SignatureFormat envelope, and empty for Cosign signatures
+	Signer          string
+	SignatureFormat string
+	// Keyless signing when KeyRef is empty
+	KeyRef     string
+	FulcioURL  string
+	RekorURL   string
+	TlogUpload bool
+	// OIDCIssuer and IdentityTokenFile are the OIDC issuer and the file with the identity token for keyless signing
+	OIDCIssuer        string
+	IdentityTokenFile string
+
+	// Attest specific. The predicate is read from Report
+	PredicateType string
+
+	// Patch specific
+	Report   string
+	Buildkit string
+
+	Insecure  bool
+	PlainHTTP bool
+}
+
+// Plan is safe to use concurrently
+type Plan struct {
+	mu      sync.Mutex
+	actions []Action
+}
+
+func New() *Plan {
+	return &Plan{actions: make([]Action, 0)}
+}
+
+// Add records the action. Adding to a nil plan is a no-op
+func (p *Plan) Add(a Action) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.actions = append(p.actions, a)
+}
+
+func (p *Plan) Actions() []Action {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	res := make([]Action, len(p.actions))
+	copy(res, p.actions)
+	return res
+}
+
+func (p *Plan) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.actions)
+}
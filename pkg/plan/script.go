@@ -0,0 +1,242 @@
+package plan
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const scriptHeader = `#!/usr/bin/env bash
+# Generated by helmper in dry-run mode.
+# Review the commands below before executing them.
+set -euo pipefail
+`
+
+// quote a value for safe use in a POSIX shell
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
+
+func chartCommands(a Action) []string {
+	var pull string
+	switch {
+	case strings.HasPrefix(a.Repo, "oci://"):
+		ref := strings.TrimSuffix(a.Repo, "/")
+		// the repository may point to the chart itself
+		if path.Base(ref) != a.Source {
+			ref += "/" + a.Source
+		}
+		pull = fmt.Sprintf("helm pull %s --version %s", quote(ref), quote(a.Version))
+	default:
+		pull = fmt.Sprintf("helm pull %s --repo %s --version %s", quote(a.Source), quote(a.Repo), quote(a.Version))
+	}
+
+	file := fmt.Sprintf("%s-%s.tgz", a.Source, a.Version)
+	if a.RepositoryType != "" {
+		// classic chart repositories are uploaded to with curl, reading the credentials from ~/.netrc
+		upload := fmt.Sprintf("curl --fail --netrc-optional --upload-file %s %s", quote(file), quote(a.Target+"/"+file))
+		if a.RepositoryType == "chartmuseum" {
+			upload = fmt.Sprintf("curl --fail --netrc-optional --data-binary %s %s", quote("@"+file), quote(a.Target+"/api/charts"))
+		}
+		if a.Insecure {
+			upload += " --insecure"
+		}
+		return []string{pull, upload}
+	}
+
+	push := fmt.Sprintf("helm push %s %s", quote(file), quote(a.Target))
+	if a.PlainHTTP {
+		push += " --plain-http"
+	}
+	if a.Insecure {
+		push += " --insecure-skip-tls-verify"
+	}
+
+	return []string{pull, push}
+}
+
+func imageCommand(a Action) string {
+	if a.Referrers && len(a.Platforms) == 0 {
+		return referrersCommand(a)
+	}
+	cmd := fmt.Sprintf("crane copy %s %s", quote(a.Source), quote(a.Target))
+	switch {
+	case a.Architecture != nil:
+		cmd += " --platform " + quote(*a.Architecture)
+	case len(a.Platforms) > 0:
+		cmd = fmt.Sprintf("crane index filter %s -t %s", quote(a.Source), quote(a.Target))
+		for _, p := range a.Platforms {
+			cmd += " --platform " + quote(p)
+		}
+	}
+	if a.PlainHTTP || a.Insecure {
+		cmd += " --insecure"
+	}
+	return cmd
+}
+
+// referrersCommand copies the image with its referrers. Artifacts cosign attaches by tag are not copied
+func referrersCommand(a Action) string {
+	cmd := fmt.Sprintf("oras cp -r %s %s", quote(a.Source), quote(a.Target))
+	if a.Architecture != nil {
+		cmd += " --platform " + quote(*a.Architecture)
+	}
+	if a.PlainHTTP {
+		cmd += " --to-plain-http"
+	}
+	if a.Insecure {
+		cmd += " --to-insecure"
+	}
+	return cmd
+}
+
+func warmCommand(a Action) string {
+	cmd := fmt.Sprintf("crane pull %s /dev/null", quote(a.Target))
+	if a.Architecture != nil {
+		cmd += " --platform " + quote(*a.Architecture)
+	}
+	if a.PlainHTTP || a.Insecure {
+		cmd += " --insecure"
+	}
+	return cmd
+}
+
+func signCommand(a Action) string {
+	if a.Signer == "notation" {
+		return notationCommand(a)
+	}
+	return cosignCommand(a, "cosign sign --yes")
+}
+
+// notationCommand signs the target resolved to its digest with the default Notation key, as keys are referenced by name in the Notation CLI
+func notationCommand(a Action) string {
+	digest := "crane digest --full-ref " + quote(a.Target)
+	if a.PlainHTTP || a.Insecure {
+		digest += " --insecure"
+	}
+
+	cmd := "notation sign"
+	if a.SignatureFormat != "" {
+		cmd += " --signature-format " + quote(a.SignatureFormat)
+	}
+	if a.PlainHTTP {
+		cmd += " --insecure-registry"
+	}
+	return fmt.Sprintf(`%s "$(%s)"`, cmd, digest)
+}
+
+func attestCommand(a Action) string {
+	return cosignCommand(a, fmt.Sprintf("cosign attest --yes --replace --type %s --predicate %s", quote(a.PredicateType), quote(a.Report)))
+}
+
+// cosignCommand completes the cosign command with the signing flags of the action, and the target resolved to its digest
+func cosignCommand(a Action, cosign string) string {
+	digest := "crane digest --full-ref " + quote(a.Target)
+	if a.PlainHTTP || a.Insecure {
+		digest += " --insecure"
+	}
+
+	cmd := fmt.Sprintf("%s --tlog-upload=%t", cosign, a.TlogUpload)
+	if a.KeyRef != "" {
+		cmd += " --key " + quote(a.KeyRef)
+	}
+	if a.FulcioURL != "" {
+		cmd += " --fulcio-url " + quote(a.FulcioURL)
+	}
+	if a.RekorURL != "" {
+		cmd += " --rekor-url " + quote(a.RekorURL)
+	}
+	if a.OIDCIssuer != "" {
+		cmd += " --oidc-issuer " + quote(a.OIDCIssuer)
+	}
+	if a.IdentityTokenFile != "" {
+		cmd += " --identity-token " + quote(a.IdentityTokenFile)
+	}
+	if a.PlainHTTP {
+		cmd += " --allow-http-registry"
+	}
+	if a.Insecure {
+		cmd += " --allow-insecure-registry"
+	}
+	return fmt.Sprintf(`%s "$(%s)"`, cmd, digest)
+}
+
+// splitTag splits a reference like 'docker.io/library/nginx:1.25@sha256:...' into its repository and tag
+func splitTag(ref string) (string, string) {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+func patchCommands(a Action) []string {
+	// copa writes the patched image to the repository of the source image, tagged '<tag>-patched' unless tagged explicitly
+	repository, _ := splitTag(a.Source)
+	_, tag := splitTag(a.Target)
+	patched := repository + ":" + tag
+
+	patch := fmt.Sprintf("copa patch --image %s --report %s --format openvex --tag %s", quote(a.Source), quote(a.Report), quote(tag))
+	if a.Buildkit != "" {
+		patch += " --addr " + quote(a.Buildkit)
+	}
+	return []string{
+		patch,
+		fmt.Sprintf("docker tag %s %s", quote(patched), quote(a.Target)),
+		fmt.Sprintf("docker push %s", quote(a.Target)),
+	}
+}
+
+func loadCommand(a Action) string {
+	cmd := fmt.Sprintf("oras cp --from-oci-layout %s %s", quote(a.Source), quote(a.Target))
+	if a.PlainHTTP {
+		cmd += " --to-plain-http"
+	}
+	if a.Insecure {
+		cmd += " --to-insecure"
+	}
+	return cmd
+}
+
+// Commands returns the shell commands equivalent to the action
+func (a Action) Commands() []string {
+	switch a.Kind {
+	case PushChart:
+		return chartCommands(a)
+	case CopyImage, CopySibling:
+		return []string{imageCommand(a)}
+	case WarmImage:
+		return []string{warmCommand(a)}
+	case PatchImage:
+		return patchCommands(a)
+	case SignChart, SignImage:
+		return []string{signCommand(a)}
+	case AttestImage:
+		return []string{attestCommand(a)}
+	case LoadArtifact:
+		return []string{loadCommand(a)}
+	default:
+		return []string{}
+	}
+}
+
+// WriteScript renders the plan as an executable shell script using crane, helm, copa, docker, oras and cosign
+func (p *Plan) WriteScript(w io.Writer) error {
+	if _, err := io.WriteString(w, scriptHeader); err != nil {
+		return err
+	}
+
+	for _, a := range p.Actions() {
+		if _, err := fmt.Fprintf(w, "\n# %s %s\n", a.Kind, a.Target); err != nil {
+			return err
+		}
+		for _, c := range a.Commands() {
+			if _, err := fmt.Fprintln(w, c); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package plan
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	expected := `'it'"'"'s'`
+	actual := quote("it's")
+	if actual != expected {
+		t.Errorf("want '%s' got '%s'", expected, actual)
+	}
+}
+
+func TestWriteScript(t *testing.T) {
+	arch := "linux/amd64"
+	p := New()
+	p.Add(Action{
+		Kind:    PushChart,
+		Source:  "prometheus",
+		Version: "25.8.0",
+		Repo:    "https://prometheus-community.github.io/helm-charts",
+		Target:  "oci://0.0.0.0:5000/charts",
+	})
+	p.Add(Action{
+		Kind:         CopyImage,
+		Source:       "quay.io/prometheus/prometheus:v2.48.0",
+		Target:       "0.0.0.0:5000/prometheus/prometheus:v2.48.0",
+		Architecture: &arch,
+		PlainHTTP:    true,
+	})
+	p.Add(Action{
+		Kind:      CopyImage,
+		Source:    "docker.io/library/nginx:1.25",
+		Target:    "0.0.0.0:5000/library/nginx:1.25",
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+	})
+	p.Add(Action{
+		Kind:     PatchImage,
+		Source:   "docker.io/library/nginx:1.25",
+		Target:   "0.0.0.0:5000/library/nginx:1.25",
+		Report:   "nginx.json",
+		Buildkit: "tcp://0.0.0.0:8888",
+	})
+	p.Add(Action{
+		Kind:   SignImage,
+		Target: "0.0.0.0:5000/prometheus/prometheus:v2.48.0",
+		KeyRef: "cosign.key",
+	})
+	p.Add(Action{
+		Kind:      CopyImage,
+		Source:    "ghcr.io/fluxcd/source-controller:v1.3.0",
+		Target:    "0.0.0.0:5000/fluxcd/source-controller:v1.3.0",
+		Referrers: true,
+		PlainHTTP: true,
+	})
+	p.Add(Action{
+		Kind:      LoadArtifact,
+		Source:    "bundle:charts/prometheus:25.8.0",
+		Target:    "0.0.0.0:5000/charts/prometheus:25.8.0",
+		PlainHTTP: true,
+	})
+
+	var buf bytes.Buffer
+	if err := p.WriteScript(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+
+	expected := []string{
+		"helm pull 'prometheus' --repo 'https://prometheus-community.github.io/helm-charts' --version '25.8.0'",
+		"helm push 'prometheus-25.8.0.tgz' 'oci://0.0.0.0:5000/charts'",
+		"crane copy 'quay.io/prometheus/prometheus:v2.48.0' '0.0.0.0:5000/prometheus/prometheus:v2.48.0' --platform 'linux/amd64' --insecure",
+		"crane index filter 'docker.io/library/nginx:1.25' -t '0.0.0.0:5000/library/nginx:1.25' --platform 'linux/amd64' --platform 'linux/arm64'",
+		"oras cp -r 'ghcr.io/fluxcd/source-controller:v1.3.0' '0.0.0.0:5000/fluxcd/source-controller:v1.3.0' --to-plain-http",
+		"copa patch --image 'docker.io/library/nginx:1.25' --report 'nginx.json' --format openvex --tag '1.25' --addr 'tcp://0.0.0.0:8888'",
+		"docker tag 'docker.io/library/nginx:1.25' '0.0.0.0:5000/library/nginx:1.25'",
+		"docker push '0.0.0.0:5000/library/nginx:1.25'",
+		`cosign sign --yes --tlog-upload=false --key 'cosign.key' "$(crane digest --full-ref '0.0.0.0:5000/prometheus/prometheus:v2.48.0')"`,
+		"oras cp --from-oci-layout 'bundle:charts/prometheus:25.8.0' '0.0.0.0:5000/charts/prometheus:25.8.0' --to-plain-http",
+	}
+	for _, e := range expected {
+		if !strings.Contains(s, e) {
+			t.Errorf("want script to contain '%s' got '%s'", e, s)
+		}
+	}
+}
+
+func TestSignCommandKeyless(t *testing.T) {
+	cmds := Action{
+		Kind:              SignImage,
+		Target:            "registry.internal/library/nginx:1.25",
+		FulcioURL:         "https://fulcio.internal",
+		RekorURL:          "https://rekor.internal",
+		OIDCIssuer:        "https://dex.internal",
+		IdentityTokenFile: "/var/run/secrets/tokens/sigstore",
+		TlogUpload:        true,
+	}.Commands()
+
+	expected := `cosign sign --yes --tlog-upload=true --fulcio-url 'https://fulcio.internal' --rekor-url 'https://rekor.internal' --oidc-issuer 'https://dex.internal' --identity-token '/var/run/secrets/tokens/sigstore' "$(crane digest --full-ref 'registry.internal/library/nginx:1.25')"`
+	if len(cmds) != 1 || cmds[0] != expected {
+		t.Errorf("want '%s' got '%v'", expected, cmds)
+	}
+}
+
+func TestAttestCommand(t *testing.T) {
+	cmds := Action{
+		Kind:          AttestImage,
+		Target:        "0.0.0.0:5000/library/nginx@sha256:0a1b",
+		Report:        ".out/reports/nginx/1.25.spdx.json",
+		PredicateType: "spdxjson",
+		KeyRef:        "cosign.key",
+		PlainHTTP:     true,
+	}.Commands()
+
+	expected := `cosign attest --yes --replace --type 'spdxjson' --predicate '.out/reports/nginx/1.25.spdx.json' --tlog-upload=false --key 'cosign.key' --allow-http-registry "$(crane digest --full-ref '0.0.0.0:5000/library/nginx@sha256:0a1b' --insecure)"`
+	if len(cmds) != 1 || cmds[0] != expected {
+		t.Errorf("want '%s' got '%v'", expected, cmds)
+	}
+}
+
+func TestWarmCommand(t *testing.T) {
+	arch := "linux/amd64"
+	cmds := Action{
+		Kind:         WarmImage,
+		Source:       "docker.io/library/nginx:1.25",
+		Target:       "harbor.internal/dockerhub/library/nginx:1.25",
+		Architecture: &arch,
+	}.Commands()
+
+	expected := `crane pull 'harbor.internal/dockerhub/library/nginx:1.25' /dev/null --platform 'linux/amd64'`
+	if len(cmds) != 1 || cmds[0] != expected {
+		t.Errorf("want '%s' got '%v'", expected, cmds)
+	}
+}
+
+func TestChartUploadCommand(t *testing.T) {
+	cmds := Action{
+		Kind:           PushChart,
+		Source:         "loki",
+		Version:        "5.38.0",
+		Repo:           "https://grafana.github.io/helm-charts",
+		Target:         "https://charts.internal",
+		RepositoryType: "chartmuseum",
+	}.Commands()
+
+	expected := `curl --fail --netrc-optional --data-binary '@loki-5.38.0.tgz' 'https://charts.internal/api/charts'`
+	if len(cmds) != 2 || cmds[1] != expected {
+		t.Errorf("want '%s' got '%v'", expected, cmds)
+	}
+}
+
+func TestPatchCommandsRetagged(t *testing.T) {
+	cmds := Action{
+		Kind:   PatchImage,
+		Source: "docker.io/library/nginx:1.25@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+		Target: "registry.internal:5000/library/nginx:1.25-patched",
+		Report: "nginx.json",
+	}.Commands()
+
+	expected := []string{
+		"copa patch --image 'docker.io/library/nginx:1.25@sha256:0000000000000000000000000000000000000000000000000000000000000000' --report 'nginx.json' --format openvex --tag '1.25-patched'",
+		"docker tag 'docker.io/library/nginx:1.25-patched' 'registry.internal:5000/library/nginx:1.25-patched'",
+		"docker push 'registry.internal:5000/library/nginx:1.25-patched'",
+	}
+	if strings.Join(cmds, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("want %v got %v", expected, cmds)
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package policy evaluates Rego policies against the charts and images Helmper discovers, to decide whether they are imported, patched and signed.
+*/
+package policy
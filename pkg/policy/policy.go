@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/open-policy-agent/opa/rego"
+)
+
+// Query is the document the policies define their rules in, i.e. policies are in 'package helmper'
+const Query = "data.helmper"
+
+// Chart is the input of the policies for charts
+type Chart struct {
+	Name        string   `json:"name"`
+	Version     string   `json:"version"`
+	Repo        string   `json:"repo"`
+	Maintainers []string `json:"maintainers"`
+}
+
+// Image is the input of the policies for images. Chart is the chart the image is found in, and Scan the number of
+// vulnerabilities by severity, e.g. 'CRITICAL', once the image is scanned
+type Image struct {
+	Registry   string         `json:"registry"`
+	Repository string         `json:"repository"`
+	Tag        string         `json:"tag"`
+	Digest     string         `json:"digest"`
+	Chart      *Chart         `json:"chart,omitempty"`
+	Scan       map[string]int `json:"scan,omitempty"`
+}
+
+// Decision of the policies. Charts and images are skipped if any 'deny' rule matches, with the messages of the rules as
+// reasons. Patch and Sign are nil if the policies do not define the 'patch' and 'sign' rules
+type Decision struct {
+	Deny  []string
+	Patch *bool
+	Sign  *bool
+}
+
+// Skip reports whether the chart or image is not imported
+func (d Decision) Skip() bool {
+	return len(d.Deny) > 0
+}
+
+// Policy is a set of compiled Rego policies
+type Policy struct {
+	query rego.PreparedEvalQuery
+}
+
+// Load compiles the Rego policies in the files and directories
+func Load(ctx context.Context, paths []string) (*Policy, error) {
+	q, err := rego.New(
+		rego.Query(Query),
+		rego.Load(paths, nil),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("policy: error compiling policies %v :: %w", paths, err)
+	}
+	return &Policy{query: q}, nil
+}
+
+// EvalChart evaluates the policies for the chart, with 'chart' as input.kind
+func (p *Policy) EvalChart(ctx context.Context, c Chart) (Decision, error) {
+	if c.Maintainers == nil {
+		c.Maintainers = []string{}
+	}
+	return p.eval(ctx, map[string]any{"kind": "chart", "chart": c})
+}
+
+// EvalImage evaluates the policies for the image, with 'image' as input.kind
+func (p *Policy) EvalImage(ctx context.Context, i Image) (Decision, error) {
+	return p.eval(ctx, map[string]any{"kind": "image", "image": i})
+}
+
+func (p *Policy) eval(ctx context.Context, input map[string]any) (Decision, error) {
+	rs, err := p.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return Decision{}, fmt.Errorf("policy: error evaluating policies :: %w", err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return Decision{}, nil
+	}
+	doc, ok := rs[0].Expressions[0].Value.(map[string]any)
+	if !ok {
+		return Decision{}, nil
+	}
+	return decision(doc)
+}
+
+// decision reads the rules of the evaluated document
+func decision(doc map[string]any) (Decision, error) {
+	d := Decision{}
+
+	switch deny := doc["deny"].(type) {
+	case nil:
+	case bool:
+		if deny {
+			d.Deny = []string{"denied"}
+		}
+	case []any:
+		for _, m := range deny {
+			d.Deny = append(d.Deny, fmt.Sprint(m))
+		}
+		sort.Strings(d.Deny)
+	default:
+		return Decision{}, fmt.Errorf("policy: the rule 'deny' must be a set of messages or a boolean, got %T", deny)
+	}
+
+	for name, v := range map[string]**bool{"patch": &d.Patch, "sign": &d.Sign} {
+		switch b := doc[name].(type) {
+		case nil:
+		case bool:
+			*v = &b
+		default:
+			return Decision{}, fmt.Errorf("policy: the rule '%s' must be a boolean, got %T", name, b)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const rules = `
+package helmper
+
+import rego.v1
+
+deny contains msg if {
+	input.kind == "image"
+	input.image.registry == "docker.io"
+	msg := sprintf("%s is pulled from Docker Hub", [input.image.repository])
+}
+
+deny contains msg if {
+	input.kind == "image"
+	input.image.scan.CRITICAL > 0
+	msg := "image has critical vulnerabilities"
+}
+
+deny contains msg if {
+	input.kind == "chart"
+	count(input.chart.maintainers) == 0
+	msg := sprintf("chart %s has no maintainers", [input.chart.name])
+}
+
+default patch := true
+
+patch := false if input.image.repository == "distroless/static"
+
+sign := false if startswith(input.image.tag, "dev-")
+`
+
+func TestPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.rego")
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	p, err := Load(ctx, []string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := p.EvalImage(ctx, Image{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Skip() || !slices.Equal(d.Deny, []string{"library/nginx is pulled from Docker Hub"}) || d.Patch == nil || !*d.Patch || d.Sign != nil {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	d, err = p.EvalImage(ctx, Image{Registry: "gcr.io", Repository: "distroless/static", Tag: "dev-1", Scan: map[string]int{"CRITICAL": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(d.Deny, []string{"image has critical vulnerabilities"}) || *d.Patch || d.Sign == nil || *d.Sign {
+		t.Errorf("unexpected decision %+v", d)
+	}
+
+	d, err = p.EvalChart(ctx, Chart{Name: "nginx", Version: "1.0.0", Maintainers: []string{"Bitnami"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Skip() {
+		t.Errorf("want the chart admitted got %+v", d)
+	}
+	if d, _ := p.EvalChart(ctx, Chart{Name: "orphan"}); !d.Skip() {
+		t.Errorf("want the chart without maintainers skipped got %+v", d)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "helmper.rego")
+	if err := os.WriteFile(path, []byte("package helmper\n\ndeny contains"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(context.Background(), []string{path}); err == nil {
+		t.Error("want error for an invalid policy")
+	}
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// acrUsername is the username ACR expects with refresh tokens
+const acrUsername = "00000000-0000-0000-0000-000000000000"
+
+// acrScopes are the Entra ID scopes exchanged for ACR refresh tokens in each Azure cloud
+var acrScopes = map[string]string{
+	".azurecr.io": "https://management.azure.com/.default",
+	".azurecr.cn": "https://management.chinacloudapi.cn/.default",
+	".azurecr.us": "https://management.usgovcloudapi.net/.default",
+}
+
+// azureToken obtains an Entra ID access token using the default Azure credential chain (environment, workload identity, managed identity)
+var azureToken = func(ctx context.Context, scope string) (azcore.AccessToken, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return azcore.AccessToken{}, err
+	}
+	return cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{scope}})
+}
+
+// acrScope returns the Entra ID scope of the Azure cloud the host belongs to
+func acrScope(host string) (string, bool) {
+	for suffix, scope := range acrScopes {
+		if strings.HasSuffix(host, suffix) {
+			return scope, true
+		}
+	}
+	return "", false
+}
+
+// isACR reports whether the host is an Azure Container Registry
+func isACR(host string) bool {
+	_, ok := acrScope(host)
+	return ok
+}
+
+// acrCredential exchanges an Entra ID access token for an ACR refresh token, like 'az acr login' does
+func acrCredential(ctx context.Context, r Registry) (auth.Credential, time.Time, error) {
+	scope, ok := acrScope(r.Host())
+	if !ok {
+		scope = acrScopes[".azurecr.io"]
+	}
+	t, err := azureToken(ctx, scope)
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {r.Host()},
+		"access_token": {t.Token},
+	}
+	if tenant := os.Getenv("AZURE_TENANT_ID"); tenant != "" {
+		form.Set("tenant", tenant)
+	}
+
+	scheme := "https"
+	if r.PlainHTTP {
+		scheme = "http"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s://%s/oauth2/exchange", scheme, r.Host()), strings.NewReader(form.Encode()))
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client, err := r.HTTPClient()
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return auth.EmptyCredential, time.Time{}, fmt.Errorf("token exchange failed with status %s", resp.Status)
+	}
+
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	if body.RefreshToken == "" {
+		return auth.EmptyCredential, time.Time{}, fmt.Errorf("no refresh token returned")
+	}
+
+	// ACR refresh tokens are valid for 3 hours, but not longer than the access token they were exchanged for
+	return auth.Credential{Username: acrUsername, RefreshToken: body.RefreshToken}, t.ExpiresOn, nil
+}
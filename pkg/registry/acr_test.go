@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+func TestIsACR(t *testing.T) {
+	tests := map[string]bool{
+		"myregistry.azurecr.io":  true,
+		"myregistry.azurecr.cn":  true,
+		"myregistry.azurecr.us":  true,
+		"azurecr.io.example.com": false,
+		"ghcr.io":                false,
+	}
+	for host, want := range tests {
+		if got := isACR(host); got != want {
+			t.Errorf("%s: want %v got %v", host, want, got)
+		}
+	}
+}
+
+func TestACRCredential(t *testing.T) {
+	orig := azureToken
+	azureToken = func(ctx context.Context, scope string) (azcore.AccessToken, error) {
+		return azcore.AccessToken{Token: "entra", ExpiresOn: time.Now().Add(time.Hour)}, nil
+	}
+	t.Cleanup(func() { azureToken = orig })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/exchange" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != "access_token" || r.Form.Get("access_token") != "entra" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"refresh_token": "refresh"})
+	}))
+	defer srv.Close()
+
+	r := Registry{URL: strings.TrimPrefix(srv.URL, "http://"), PlainHTTP: true}
+	c, _, err := acrCredential(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != acrUsername || c.RefreshToken != "refresh" {
+		t.Errorf("unexpected credential %v", c)
+	}
+}
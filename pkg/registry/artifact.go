@@ -0,0 +1,52 @@
+package registry
+
+import "github.com/ChristofferNissen/helmper/pkg/plan"
+
+// ArtifactKind is the kind of an artifact signed or published by the pipeline
+type ArtifactKind string
+
+const (
+	ChartArtifact  ArtifactKind = "chart"
+	ImageArtifact  ArtifactKind = "image"
+	SBOMArtifact   ArtifactKind = "sbom"
+	ReportArtifact ArtifactKind = "report"
+)
+
+// Artifact is a chart or image signed by the signers, or a report or SBOM published to the sinks
+type Artifact struct {
+	Kind ArtifactKind
+	// Ref is the reference of the artifact in the registry, by digest once pushed, e.g. '0.0.0.0:5000/charts/prometheus@sha256:...'
+	Ref string
+	// Source is where the artifact is imported from, e.g. the source image. Empty for artifacts created by the pipeline
+	Source string
+	// Path is the local file of artifacts written by the pipeline, e.g. reports and SBOMs
+	Path string
+	// Subject is the reference of the artifact this artifact describes, e.g. the image of an SBOM
+	Subject string
+}
+
+// SignKind is the plan action signing the artifact
+func (a Artifact) SignKind() plan.Kind {
+	if a.Kind == ChartArtifact {
+		return plan.SignChart
+	}
+	return plan.SignImage
+}
+
+// Artifacts returns artifacts of the kind for the references
+func Artifacts(kind ArtifactKind, refs ...string) []Artifact {
+	as := make([]Artifact, 0, len(refs))
+	for _, ref := range refs {
+		as = append(as, Artifact{Kind: kind, Ref: ref})
+	}
+	return as
+}
+
+// Refs returns the references of the artifacts
+func Refs(as []Artifact) []string {
+	refs := make([]string, 0, len(as))
+	for _, a := range as {
+		refs = append(refs, a.Ref)
+	}
+	return refs
+}
@@ -0,0 +1,19 @@
+package registry
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+)
+
+func TestArtifacts(t *testing.T) {
+	as := append(Artifacts(ChartArtifact, "0.0.0.0:5000/charts/prometheus:25.8.0"), Artifacts(ImageArtifact, "0.0.0.0:5000/library/nginx:1.25")...)
+
+	if got := Refs(as); !slices.Equal(got, []string{"0.0.0.0:5000/charts/prometheus:25.8.0", "0.0.0.0:5000/library/nginx:1.25"}) {
+		t.Errorf("unexpected refs %v", got)
+	}
+	if as[0].SignKind() != plan.SignChart || as[1].SignKind() != plan.SignImage {
+		t.Errorf("unexpected sign kinds %s %s", as[0].SignKind(), as[1].SignKind())
+	}
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+// PruneBlobCache removes the blobs of the blob cache in the folder not used within maxAge, and returns the number of blobs removed.
+// Blobs are used when they are added to the cache or served from it. Zero keeps every blob
+func PruneBlobCache(folder string, maxAge time.Duration) (int, error) {
+	if folder == "" || maxAge <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-maxAge)
+	removed := 0
+	err := filepath.WalkDir(filepath.Join(folder, "blobs"), func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if fi.ModTime().After(cutoff) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if err != nil {
+		return removed, fmt.Errorf("registry: error pruning blob cache %s :: %w", folder, err)
+	}
+	return removed, nil
+}
+
+// manifestMediaTypes are not cached, as they are small and fetched by tag
+var manifestMediaTypes = []string{
+	v1.MediaTypeImageManifest,
+	v1.MediaTypeImageIndex,
+	"application/vnd.docker.distribution.manifest.v2+json",
+	mediaTypeDockerManifestList,
+}
+
+// cachedRepository serves the blobs of the repository from the blob cache, adding the blobs it fetches to the cache
+type cachedRepository struct {
+	*remote.Repository
+	cache  *oci.Storage
+	folder string
+}
+
+// cached wraps the source repository with the blob cache of the registry, if enabled
+func (r Registry) cached(repo *remote.Repository) (oras.ReadOnlyGraphTarget, error) {
+	if r.BlobCache == "" {
+		return repo, nil
+	}
+	s, err := oci.NewStorage(r.BlobCache)
+	if err != nil {
+		return nil, err
+	}
+	return cachedRepository{Repository: repo, cache: s, folder: r.BlobCache}, nil
+}
+
+// touch marks the blob as used, so PruneBlobCache keeps it
+func (c cachedRepository) touch(target v1.Descriptor) {
+	now := time.Now()
+	_ = os.Chtimes(filepath.Join(c.folder, "blobs", target.Digest.Algorithm().String(), target.Digest.Encoded()), now, now)
+}
+
+func (c cachedRepository) Fetch(ctx context.Context, target v1.Descriptor) (io.ReadCloser, error) {
+	if slices.Contains(manifestMediaTypes, target.MediaType) {
+		return c.Repository.Fetch(ctx, target)
+	}
+	if ok, err := c.cache.Exists(ctx, target); err == nil && ok {
+		slog.Debug("blob served from cache", slog.String("digest", target.Digest.String()))
+		c.touch(target)
+		return c.cache.Fetch(ctx, target)
+	}
+
+	rc, err := c.Repository.Fetch(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// the blob is verified against its digest while stored
+	if err := c.cache.Push(ctx, target, rc); err != nil && !errors.Is(err, errdef.ErrAlreadyExists) {
+		return nil, err
+	}
+	return c.cache.Fetch(ctx, target)
+}
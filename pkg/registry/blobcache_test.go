@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+func TestBlobCache(t *testing.T) {
+	layer := []byte("layer")
+	desc := content.NewDescriptorFromBytes(v1.MediaTypeImageLayerGzip, layer)
+
+	var pulls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/blobs/"+desc.Digest.String()) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		pulls.Add(1)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(layer)
+	}))
+	defer srv.Close()
+
+	r := Registry{BlobCache: t.TempDir()}
+
+	for range 2 {
+		repo, err := remote.NewRepository(strings.TrimPrefix(srv.URL, "http://") + "/library/busybox")
+		if err != nil {
+			t.Fatal(err)
+		}
+		repo.PlainHTTP = true
+		src, err := r.cached(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc, err := src.Fetch(context.Background(), desc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != string(layer) {
+			t.Errorf("want the layer, got %q", b)
+		}
+	}
+	if n := pulls.Load(); n != 1 {
+		t.Errorf("want the layer pulled once, got %d", n)
+	}
+
+	// the layer was just used, so it is kept
+	if n, err := PruneBlobCache(r.BlobCache, time.Hour); err != nil || n != 0 {
+		t.Errorf("want no blobs pruned, got %d %v", n, err)
+	}
+	blob := filepath.Join(r.BlobCache, "blobs", "sha256", desc.Digest.Encoded())
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(blob, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := PruneBlobCache(r.BlobCache, time.Hour); err != nil || n != 1 {
+		t.Errorf("want the unused blob pruned, got %d %v", n, err)
+	}
+	if n, err := PruneBlobCache(t.TempDir(), time.Hour); err != nil || n != 0 {
+		t.Errorf("want an empty cache pruned without error, got %d %v", n, err)
+	}
+}
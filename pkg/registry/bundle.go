@@ -0,0 +1,300 @@
+package registry
+
+import (
+	"archive/tar"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+)
+
+const (
+	// Media types of Helm charts stored in OCI registries
+	ChartConfigMediaType = "application/vnd.cncf.helm.config.v1+json"
+	ChartLayerMediaType  = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+)
+
+// Bundle is an OCI image layout on the local filesystem holding charts and images, used to move them across an air gap.
+// Paths ending in '.tar' are read and written as a single tar archive of the layout.
+// Artifacts are tagged '<name>:<tag>' with the name they have in the registries.
+type Bundle struct {
+	Path string
+	// Sources are the settings of the registries the images are pulled from
+	Sources Sources
+
+	dir   string
+	store *oci.Store
+}
+
+func isTar(path string) bool {
+	return strings.HasSuffix(path, ".tar")
+}
+
+// OpenBundle opens the bundle at path, creating it if it does not exist
+func OpenBundle(path string) (*Bundle, error) {
+	b := &Bundle{Path: path, dir: path}
+
+	if isTar(path) {
+		dir, err := os.MkdirTemp("", "helmper-bundle")
+		if err != nil {
+			return nil, err
+		}
+		b.dir = dir
+
+		if _, err := os.Stat(path); err == nil {
+			if err := untar(path, dir); err != nil {
+				os.RemoveAll(dir)
+				return nil, fmt.Errorf("registry: error reading bundle %s :: %w", path, err)
+			}
+		}
+	}
+
+	store, err := oci.New(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("registry: error opening bundle %s :: %w", path, err)
+	}
+	b.store = store
+
+	return b, nil
+}
+
+// Dir is the directory holding the OCI image layout of the bundle
+func (b *Bundle) Dir() string {
+	return b.dir
+}
+
+// Index is the index of the layout, which references all charts and images of the bundle by digest. Signing the index signs the bundle
+func (b *Bundle) Index() string {
+	return filepath.Join(b.dir, "index.json")
+}
+
+// Sign saves the index of the bundle and signs it with sign, which writes the signature next to the index, so it is part of the bundle
+func (b *Bundle) Sign(sign func(index string) error) error {
+	if err := b.store.SaveIndex(); err != nil {
+		return err
+	}
+	return sign(b.Index())
+}
+
+// AddImage copies the image from the source registry into the bundle
+func (b *Bundle) AddImage(ctx context.Context, sourceURL string, name string, tag string, arch *string) (v1.Descriptor, error) {
+	source, err := b.Sources.Repository(sourceURL, name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	opts, err := copyOptions(arch)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	// Copy by digest when the image is pinned ('tag@digest'), but keep the tag in the bundle
+	srcRef, dstRef := tag, tag
+	if t, d, ok := strings.Cut(tag, "@"); ok {
+		srcRef, dstRef = d, t
+	}
+
+	desc, err := oras.Copy(ctx, source, srcRef, b.store, name+":"+dstRef, opts)
+	if err != nil {
+		return v1.Descriptor{}, redHatAuthError(sourceURL, err)
+	}
+	return desc, nil
+}
+
+// AddChart stores the packaged chart in the bundle as 'charts/<name>:<version>', the same way Helm pushes charts to OCI registries
+func (b *Bundle) AddChart(ctx context.Context, name string, version string, config []byte, chart []byte) (v1.Descriptor, error) {
+	configDesc, err := oras.PushBytes(ctx, b.store, ChartConfigMediaType, config)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	layerDesc, err := oras.PushBytes(ctx, b.store, ChartLayerMediaType, chart)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	desc, err := oras.PackManifest(ctx, b.store, oras.PackManifestVersion1_1, "", oras.PackManifestOptions{
+		ConfigDescriptor: &configDesc,
+		Layers:           []v1.Descriptor{layerDesc},
+	})
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	ref := fmt.Sprintf("charts/%s:%s", name, OCITag(version))
+	if err := b.store.Tag(ctx, desc, ref); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// Refs lists the '<name>:<tag>' references of the artifacts in the bundle
+func (b *Bundle) Refs(ctx context.Context) ([]string, error) {
+	refs := []string{}
+	err := b.store.Tags(ctx, "", func(tags []string) error {
+		refs = append(refs, tags...)
+		return nil
+	})
+	return refs, err
+}
+
+// splitRef splits a bundle reference into the name and tag of the artifact
+func splitRef(ref string) (string, string, error) {
+	i := strings.LastIndex(ref, ":")
+	if i <= 0 || i == len(ref)-1 {
+		return "", "", fmt.Errorf("registry: invalid bundle reference '%s'", ref)
+	}
+	return ref[:i], ref[i+1:], nil
+}
+
+// Copy pushes the artifact with the bundle reference to the registry
+func (b *Bundle) Copy(ctx context.Context, ref string, r Registry) (v1.Descriptor, error) {
+	name, tag, err := splitRef(ref)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	target, err := r.Repository(name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := r.EnsureRepository(ctx, name); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	desc, err := oras.Copy(ctx, b.store, ref, target, tag, oras.DefaultCopyOptions)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	if r.Strict {
+		if err := r.Validate(ctx, name, tag); err != nil {
+			return v1.Descriptor{}, err
+		}
+	}
+
+	return desc, nil
+}
+
+// Close writes the tar archive of the bundle, if the bundle is an archive, and removes the temporary layout
+func (b *Bundle) Close(write bool) error {
+	if !isTar(b.Path) {
+		return nil
+	}
+	defer os.RemoveAll(b.dir)
+
+	if !write {
+		return nil
+	}
+	if err := b.store.SaveIndex(); err != nil {
+		return err
+	}
+	if err := writeTar(b.dir, b.Path); err != nil {
+		return fmt.Errorf("registry: error writing bundle %s :: %w", b.Path, err)
+	}
+	return nil
+}
+
+// writeTar archives the files in dir to path
+func writeTar(dir string, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// untar extracts the tar archive at path into dir
+func untar(path string, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path '%s' in archive", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		name string
+		tag  string
+		err  bool
+	}{
+		{ref: "charts/nginx:18.1.0", name: "charts/nginx", tag: "18.1.0"},
+		{ref: "library/busybox:1.36", name: "library/busybox", tag: "1.36"},
+		{ref: "busybox", err: true},
+		{ref: "busybox:", err: true},
+	}
+
+	for _, tt := range tests {
+		name, tag, err := splitRef(tt.ref)
+		if (err != nil) != tt.err {
+			t.Fatalf("%s: unexpected error %v", tt.ref, err)
+		}
+		if name != tt.name || tag != tt.tag {
+			t.Errorf("%s: got %s %s, want %s %s", tt.ref, name, tag, tt.name, tt.tag)
+		}
+	}
+}
+
+func TestBundleArchive(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+
+	b, err := OpenBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddChart(ctx, "nginx", "1.2.3+build.1", []byte(`{"name":"nginx"}`), []byte("chart")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(true); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = OpenBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(false)
+
+	refs, err := b.Refs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(refs) != 1 || refs[0] != "charts/nginx:1.2.3_build.1" {
+		t.Errorf("unexpected refs %v", refs)
+	}
+}
+
+func TestBundleSign(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+
+	b, err := OpenBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.AddChart(ctx, "nginx", "1.2.3", []byte(`{"name":"nginx"}`), []byte("chart")); err != nil {
+		t.Fatal(err)
+	}
+	// the signature written next to the index is archived with the bundle
+	err = b.Sign(func(index string) error {
+		return os.WriteFile(index+".sig", []byte("signature"), 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(true); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err = OpenBundle(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close(false)
+	if _, err := os.Stat(b.Index() + ".sig"); err != nil {
+		t.Errorf("want the signature in the bundle got %v", err)
+	}
+}
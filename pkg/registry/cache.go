@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/errdef"
+)
+
+// Cache is a pull-through cache registry (e.g. a Harbor proxy cache project or an ECR pull through cache rule) proxying the upstream registry.
+// The image 'docker.io/library/nginx:1.25' is pulled through the cache 'harbor.internal/dockerhub' as 'harbor.internal/dockerhub/library/nginx:1.25'
+type Cache struct {
+	Registry
+	// Upstream is the host of the proxied registry, e.g. 'docker.io'
+	Upstream string
+}
+
+// dockerHub are the hosts of Docker Hub
+var dockerHub = []string{"docker.io", "index.docker.io", "registry-1.docker.io"}
+
+func normalizeHost(host string) string {
+	for _, h := range dockerHub {
+		if host == h {
+			return "docker.io"
+		}
+	}
+	return host
+}
+
+// Proxies reports whether the image is pulled from the upstream registry of the cache
+func (c Cache) Proxies(i Image) bool {
+	return normalizeHost(i.Registry) == normalizeHost(c.Upstream)
+}
+
+// pullReference is the tag or, for pinned images, the digest to pull the image by
+func pullReference(i Image) string {
+	if i.UseDigest && i.Digest != "" {
+		return i.Digest
+	}
+	if _, d, ok := strings.Cut(i.Tag, "@"); ok {
+		return d
+	}
+	return i.Tag
+}
+
+// Ref is the reference of the image in the cache
+func (c Cache) Ref(i Image) string {
+	ref := pullReference(i)
+	sep := ":"
+	if strings.Contains(ref, ":") {
+		sep = "@"
+	}
+	return fmt.Sprintf("%s/%s%s%s", c.URL, i.Repository, sep, ref)
+}
+
+// discard is a copy target dropping all content, so copying to it reads every manifest and blob of the source once
+type discard struct {
+	seen sync.Map
+}
+
+func (d *discard) Fetch(_ context.Context, desc v1.Descriptor) (io.ReadCloser, error) {
+	return nil, fmt.Errorf("%s: %w", desc.Digest, errdef.ErrNotFound)
+}
+
+func (d *discard) Push(_ context.Context, desc v1.Descriptor, r io.Reader) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return err
+	}
+	d.seen.Store(desc.Digest, true)
+	return nil
+}
+
+func (d *discard) Exists(_ context.Context, desc v1.Descriptor) (bool, error) {
+	_, ok := d.seen.Load(desc.Digest)
+	return ok, nil
+}
+
+func (d *discard) Resolve(_ context.Context, ref string) (v1.Descriptor, error) {
+	return v1.Descriptor{}, fmt.Errorf("%s: %w", ref, errdef.ErrNotFound)
+}
+
+func (d *discard) Tag(context.Context, v1.Descriptor, string) error {
+	return nil
+}
+
+// Warm pulls the image, limited to the platform if any, through the cache without storing it, so the cache fetches and keeps every layer
+func (c Cache) Warm(ctx context.Context, i Image, arch *string) (v1.Descriptor, error) {
+	source, err := c.Repository(i.Repository)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	opts, err := copyOptions(arch)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	ref := pullReference(i)
+	desc, err := oras.Copy(ctx, source, ref, &discard{}, ref, opts)
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("registry: error pulling %s through cache :: %w", c.Ref(i), err)
+	}
+	return desc, nil
+}
@@ -0,0 +1,27 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestCache(t *testing.T) {
+	c := Cache{Registry: Registry{URL: "harbor.internal/dockerhub"}, Upstream: "index.docker.io"}
+
+	tests := []struct {
+		image   Image
+		proxies bool
+		ref     string
+	}{
+		{Image{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"}, true, "harbor.internal/dockerhub/library/nginx:1.25"},
+		{Image{Registry: "docker.io", Repository: "bitnami/redis", Tag: "7.2", Digest: "sha256:0a1b", UseDigest: true}, true, "harbor.internal/dockerhub/bitnami/redis@sha256:0a1b"},
+		{Image{Registry: "quay.io", Repository: "prometheus/prometheus", Tag: "v2.48.0"}, false, "harbor.internal/dockerhub/prometheus/prometheus:v2.48.0"},
+	}
+	for _, tt := range tests {
+		if got := c.Proxies(tt.image); got != tt.proxies {
+			t.Errorf("%s: want proxies %v got %v", tt.image.Repository, tt.proxies, got)
+		}
+		if got := c.Ref(tt.image); got != tt.ref {
+			t.Errorf("want '%s' got '%s'", tt.ref, got)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package registry
+
+// ChartRepository is a classic Helm chart repository the charts are uploaded to over HTTP, e.g. ChartMuseum
+type ChartRepository struct {
+	// Type is the upload API of the repository: 'chartmuseum', 'nexus' or 'artifactory'
+	Type     string
+	URL      string
+	Auth     Auth
+	Insecure bool
+	// OCI pushes the charts to the registry as OCI artifacts too
+	OCI bool
+}
+
+// OCICharts reports whether the charts are pushed to the registry as OCI artifacts
+func (r Registry) OCICharts() bool {
+	return r.ChartRepository == nil || r.ChartRepository.OCI
+}
@@ -0,0 +1,41 @@
+package registry
+
+import "fmt"
+
+// Confidence of the mapping of an image to the value paths of a chart it was found at
+type Confidence string
+
+const (
+	// ConfidenceExact images are referenced by a workload in the chart rendered with the values
+	ConfidenceExact Confidence = "exact"
+	// ConfidenceHeuristic images are found by the keys of the values, e.g. 'repository' and 'tag', but not in the rendered chart
+	ConfidenceHeuristic Confidence = "heuristic"
+	// ConfidenceInferred images are missing parts in the values, e.g. the tag is taken from the app version of the chart
+	ConfidenceInferred Confidence = "inferred"
+)
+
+// Score of the confidence from 0 to 100
+func (c Confidence) Score() int {
+	switch c {
+	case ConfidenceExact:
+		return 100
+	case ConfidenceHeuristic:
+		return 70
+	case ConfidenceInferred:
+		return 40
+	default:
+		return 0
+	}
+}
+
+// Review reports if the value paths of the image should be reviewed before applying rewritten values
+func (c Confidence) Review() bool {
+	return c == ConfidenceHeuristic || c == ConfidenceInferred
+}
+
+func (c Confidence) String() string {
+	if c == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s (%d)", string(c), c.Score())
+}
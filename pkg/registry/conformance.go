@@ -0,0 +1,286 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/xerrors"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+const (
+	dockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerConfig       = "application/vnd.docker.container.image.v1+json"
+	dockerLayer        = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	dockerForeignLayer = "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"
+
+	HelmConfig     = "application/vnd.cncf.helm.config.v1+json"
+	HelmChart      = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	HelmProvenance = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+// OCI equivalents of docker media types
+var dockerToOCI = map[string]string{
+	dockerManifest:     v1.MediaTypeImageManifest,
+	dockerManifestList: v1.MediaTypeImageIndex,
+	dockerConfig:       v1.MediaTypeImageConfig,
+	dockerLayer:        v1.MediaTypeImageLayerGzip,
+	dockerForeignLayer: "application/vnd.oci.image.layer.nondistributable.v1.tar+gzip",
+}
+
+// OCITag converts a chart version to a valid OCI tag. OCI tags do not allow '+', so Helm replaces it with '_' when pushing charts
+func OCITag(version string) string {
+	return strings.ReplaceAll(version, "+", "_")
+}
+
+func toOCI(mediaType string) string {
+	if mt, ok := dockerToOCI[mediaType]; ok {
+		return mt
+	}
+	return mediaType
+}
+
+func pushJSON(ctx context.Context, s content.Storage, mediaType string, v any) (v1.Descriptor, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc := content.NewDescriptorFromBytes(mediaType, b)
+
+	exists, err := s.Exists(ctx, desc)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if !exists {
+		if err := s.Push(ctx, desc, bytes.NewReader(b)); err != nil {
+			return v1.Descriptor{}, err
+		}
+	}
+
+	return desc, nil
+}
+
+// annotate marks a manifest as written by this version of Helmper
+func annotate(a map[string]string) map[string]string {
+	if a == nil {
+		a = make(map[string]string)
+	}
+	a[version.Annotation] = version.Version
+	return a
+}
+
+// annotateTag replaces the manifest of the tag in the repository with a copy marked as written by this version of Helmper, and
+// returns its descriptor. Only manifests created by Helmper are annotated, as the copy has another digest than the original
+func annotateTag(ctx context.Context, repo *remote.Repository, tag string) (v1.Descriptor, error) {
+	desc, rc, err := repo.FetchReference(ctx, tag)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	defer rc.Close()
+	b, err := content.ReadAll(rc, desc)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	// the manifest is decoded generically, so fields unknown to the image spec are kept
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return v1.Descriptor{}, err
+	}
+	a := map[string]string{}
+	if raw, ok := m["annotations"]; ok {
+		if err := json.Unmarshal(raw, &a); err != nil {
+			return v1.Descriptor{}, err
+		}
+	}
+	if a[version.Annotation] == version.Version {
+		return desc, nil
+	}
+	if m["annotations"], err = json.Marshal(annotate(a)); err != nil {
+		return v1.Descriptor{}, err
+	}
+	if b, err = json.Marshal(m); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	annotated := content.NewDescriptorFromBytes(desc.MediaType, b)
+	if err := repo.PushReference(ctx, annotated, bytes.NewReader(b), tag); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return annotated, nil
+}
+
+// Annotate marks the manifest of the tag in the named repository of the registry as written by this version of Helmper,
+// e.g. after pushing a chart or a patched image. It returns the descriptor of the annotated manifest. Images copied from their
+// source must not be annotated, so their digests, signatures and SBOMs stay the ones of the source
+func (r Registry) Annotate(ctx context.Context, name string, tag string) (v1.Descriptor, error) {
+	repo, err := r.Repository(name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc, err := annotateTag(ctx, repo, tag)
+	if err != nil {
+		return v1.Descriptor{}, fmt.Errorf("registry: error annotating %s/%s:%s :: %w", r.URL, r.Target(name), tag, err)
+	}
+	return desc, nil
+}
+
+// convertToOCI rewrites the docker media types of the manifests rooted at desc to their OCI equivalents.
+// The converted manifests are pushed to the storage, and the descriptor of the new root is returned.
+func convertToOCI(ctx context.Context, s content.Storage, desc v1.Descriptor) (v1.Descriptor, error) {
+	switch desc.MediaType {
+	case dockerManifestList, v1.MediaTypeImageIndex:
+		b, err := content.FetchAll(ctx, s, desc)
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		var index v1.Index
+		if err := json.Unmarshal(b, &index); err != nil {
+			return v1.Descriptor{}, err
+		}
+
+		for i, m := range index.Manifests {
+			exists, err := s.Exists(ctx, m)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			if !exists {
+				// platform not copied
+				continue
+			}
+			d, err := convertToOCI(ctx, s, m)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			d.Platform = m.Platform
+			d.Annotations = m.Annotations
+			index.Manifests[i] = d
+		}
+		index.MediaType = v1.MediaTypeImageIndex
+		index.Annotations = annotate(index.Annotations)
+
+		return pushJSON(ctx, s, v1.MediaTypeImageIndex, index)
+
+	case dockerManifest:
+		b, err := content.FetchAll(ctx, s, desc)
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		var manifest v1.Manifest
+		if err := json.Unmarshal(b, &manifest); err != nil {
+			return v1.Descriptor{}, err
+		}
+
+		manifest.MediaType = v1.MediaTypeImageManifest
+		manifest.Annotations = annotate(manifest.Annotations)
+		manifest.Config.MediaType = toOCI(manifest.Config.MediaType)
+		for i, l := range manifest.Layers {
+			manifest.Layers[i].MediaType = toOCI(l.MediaType)
+		}
+
+		return pushJSON(ctx, s, v1.MediaTypeImageManifest, manifest)
+
+	default:
+		return desc, nil
+	}
+}
+
+// validate the manifest is served with the correct content type and only references OCI media types
+func validate(ctx context.Context, repo *remote.Repository, desc v1.Descriptor, b []byte) error {
+	var m struct {
+		MediaType string          `json:"mediaType"`
+		Config    v1.Descriptor   `json:"config"`
+		Layers    []v1.Descriptor `json:"layers"`
+		Manifests []v1.Descriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	if m.MediaType != "" && m.MediaType != desc.MediaType {
+		return xerrors.Errorf("manifest %s served with content type %s but declares media type %s", desc.Digest, desc.MediaType, m.MediaType)
+	}
+
+	switch desc.MediaType {
+	case v1.MediaTypeImageIndex:
+		for _, d := range m.Manifests {
+			if _, ok := dockerToOCI[d.MediaType]; ok {
+				return xerrors.Errorf("index %s references manifest %s with docker media type %s", desc.Digest, d.Digest, d.MediaType)
+			}
+
+			rc, err := repo.Fetch(ctx, d)
+			if err != nil {
+				if errors.Is(err, errdef.ErrNotFound) {
+					// platform not copied
+					continue
+				}
+				return err
+			}
+			cb, err := content.ReadAll(rc, d)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := validate(ctx, repo, d, cb); err != nil {
+				return err
+			}
+		}
+	case v1.MediaTypeImageManifest:
+		if _, ok := dockerToOCI[m.Config.MediaType]; ok {
+			return xerrors.Errorf("manifest %s references config with docker media type %s", desc.Digest, m.Config.MediaType)
+		}
+		for _, l := range m.Layers {
+			if _, ok := dockerToOCI[l.MediaType]; ok {
+				return xerrors.Errorf("manifest %s references layer with docker media type %s", desc.Digest, l.MediaType)
+			}
+		}
+
+		// Helm charts
+		if m.Config.MediaType == HelmConfig {
+			for _, l := range m.Layers {
+				if l.MediaType != HelmChart && l.MediaType != HelmProvenance {
+					return xerrors.Errorf("chart manifest %s contains unexpected layer media type %s", desc.Digest, l.MediaType)
+				}
+			}
+		}
+	default:
+		return xerrors.Errorf("manifest %s has non OCI media type %s", desc.Digest, desc.MediaType)
+	}
+
+	return nil
+}
+
+// Validate fetches the manifest of the reference through the OCI distribution manifests endpoint and validates it against the OCI specification
+func (r Registry) Validate(ctx context.Context, name string, reference string) error {
+	repo, err := r.Repository(name)
+	if err != nil {
+		return err
+	}
+
+	desc, rc, err := repo.FetchReference(ctx, reference)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		return err
+	}
+
+	if err := validate(ctx, repo, desc, b); err != nil {
+		return fmt.Errorf("registry: %s/%s:%s is not OCI conformant :: %w", r.URL, name, reference, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+func TestOCITag(t *testing.T) {
+	expected := "1.0.0_build.1"
+	actual := OCITag("1.0.0+build.1")
+	if actual != expected {
+		t.Errorf("want '%s' got '%s'", expected, actual)
+	}
+}
+
+func TestConvertToOCI(t *testing.T) {
+	ctx := context.TODO()
+	s := memory.New()
+
+	manifest := map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     dockerManifest,
+		"config":        map[string]any{"mediaType": dockerConfig, "digest": "sha256:a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90", "size": 1},
+		"layers":        []map[string]any{{"mediaType": dockerLayer, "digest": "sha256:b1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90", "size": 1}},
+	}
+	b, _ := json.Marshal(manifest)
+	desc := content.NewDescriptorFromBytes(dockerManifest, b)
+	if err := s.Push(ctx, desc, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := convertToOCI(ctx, s, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted.MediaType != v1.MediaTypeImageManifest {
+		t.Errorf("want '%s' got '%s'", v1.MediaTypeImageManifest, converted.MediaType)
+	}
+
+	cb, err := content.FetchAll(ctx, s, converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m v1.Manifest
+	if err := json.Unmarshal(cb, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Config.MediaType != v1.MediaTypeImageConfig {
+		t.Errorf("want '%s' got '%s'", v1.MediaTypeImageConfig, m.Config.MediaType)
+	}
+	if m.Layers[0].MediaType != v1.MediaTypeImageLayerGzip {
+		t.Errorf("want '%s' got '%s'", v1.MediaTypeImageLayerGzip, m.Layers[0].MediaType)
+	}
+	if err := validate(ctx, nil, converted, cb); err != nil {
+		t.Errorf("want converted manifest to validate got '%s'", err)
+	}
+	if err := validate(ctx, nil, desc, b); err == nil {
+		t.Error("want docker manifest to fail validation")
+	}
+}
+
+func TestPushKeepsDigest(t *testing.T) {
+	ctx := context.Background()
+	source := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer source.Close()
+	target := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer target.Close()
+	// sources on localhost are pulled with plain HTTP
+	sourceHost := strings.Replace(strings.TrimPrefix(source.URL, "http://"), "127.0.0.1", "localhost", 1)
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(sourceHost+"/library/nginx:1.25", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+	sourceDigest, err := img.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := Registry{URL: strings.TrimPrefix(target.URL, "http://"), PlainHTTP: true}
+	desc, err := r.Push(ctx, sourceHost, "library/nginx", "1.25", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := r.Repository("library/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagged, rc, err := repo.FetchReference(ctx, "1.25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m v1.Manifest
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// images copied from their source are not annotated, so their signatures and SBOMs still refer to them
+	if _, ok := m.Annotations[version.Annotation]; ok {
+		t.Errorf("want the copied manifest unchanged got %v", m.Annotations)
+	}
+	if tagged.Digest.String() != sourceDigest.String() || desc.Digest != tagged.Digest {
+		t.Errorf("want the source digest %s got %s and %s", sourceDigest, tagged.Digest, desc.Digest)
+	}
+
+	// manifests created by Helmper, e.g. patched images, are annotated, and not rewritten again
+	annotated, err := r.Annotate(ctx, "library/nginx", "1.25")
+	if err != nil || annotated.Digest == desc.Digest {
+		t.Fatalf("want the tag annotated got %s, %v", annotated.Digest, err)
+	}
+	again, err := r.Annotate(ctx, "library/nginx", "1.25")
+	if err != nil || again.Digest != annotated.Digest {
+		t.Errorf("want the annotated manifest kept got %s, %v", again.Digest, err)
+	}
+}
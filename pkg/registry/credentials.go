@@ -0,0 +1,186 @@
+package registry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+)
+
+// Auth holds the credentials configured for a registry. Values may reference environment variables, e.g. '${REGISTRY_PASSWORD}'.
+// When no credentials are configured, Amazon ECR, Azure Container Registry and Google Artifact Registry registries are authenticated with the identity of the environment, and other registries use the Docker and Helm credential stores.
+type Auth struct {
+	Username string
+	Password string
+	// Token is a registry access token
+	Token string
+	// IdentityToken is a refresh token exchanged for access tokens, e.g. from 'az acr login --expose-token'
+	IdentityToken string
+	// CredentialsFile is a Docker config file to read the credentials from
+	CredentialsFile string
+}
+
+func (a Auth) credential() auth.Credential {
+	return auth.Credential{
+		Username:     os.ExpandEnv(a.Username),
+		Password:     os.ExpandEnv(a.Password),
+		AccessToken:  os.ExpandEnv(a.Token),
+		RefreshToken: os.ExpandEnv(a.IdentityToken),
+	}
+}
+
+// Host of the registry, without any repository prefix
+func (r Registry) Host() string {
+	h, _, _ := strings.Cut(r.URL, "/")
+	return h
+}
+
+// credentialHelper obtains short-lived credentials for the registries of a cloud provider from the identity of the environment, e.g. workload identity
+type credentialHelper struct {
+	name string
+	// match reports whether the registry host belongs to the provider
+	match func(host string) bool
+	// get returns the credential and when it expires
+	get func(ctx context.Context, r Registry) (auth.Credential, time.Time, error)
+}
+
+var credentialHelpers = []credentialHelper{
+	{name: "ECR", match: isECR, get: ecrCredential},
+	{name: "ACR", match: isACR, get: acrCredential},
+	{name: "Artifact Registry", match: isGAR, get: garCredential},
+}
+
+type token struct {
+	credential auth.Credential
+	expires    time.Time
+	err        error
+}
+
+// tokens caches the credentials obtained by the credential helpers per registry host. Failures are cached too, so the helpers are only tried once per run
+var tokens sync.Map
+
+// helperCredential returns the credential of the first credential helper matching the registry
+func (r Registry) helperCredential(ctx context.Context) (auth.Credential, bool) {
+	for _, h := range credentialHelpers {
+		if !h.match(r.Host()) {
+			continue
+		}
+
+		if v, ok := tokens.Load(r.Host()); ok {
+			t := v.(token)
+			if t.err != nil {
+				return auth.EmptyCredential, false
+			}
+			if time.Now().Add(5 * time.Minute).Before(t.expires) {
+				return t.credential, true
+			}
+		}
+
+		c, expires, err := h.get(ctx, r)
+		tokens.Store(r.Host(), token{credential: c, expires: expires, err: err})
+		if err != nil {
+			slog.Warn("could not obtain registry token. Using the Docker credential store", slog.String("helper", h.name), slog.String("registry", r.Host()), slog.String("error", err.Error()))
+			return auth.EmptyCredential, false
+		}
+		return c, true
+	}
+	return auth.EmptyCredential, false
+}
+
+// credential for the host of the registry when it is not read from a credentials file or store: the configured credentials, or a token from a credential helper
+func (r Registry) credential() (auth.Credential, bool) {
+	switch {
+	case r.Auth.CredentialsFile != "":
+		return auth.EmptyCredential, false
+	case r.Auth != Auth{}:
+		return r.Auth.credential(), true
+	}
+	return r.helperCredential(context.Background())
+}
+
+// Credentials returns a store with the credentials configured for the registry, or the Docker and Helm credential stores if none are configured
+func (r Registry) Credentials() (credentials.Store, error) {
+	if r.Auth.CredentialsFile != "" {
+		return credentials.NewStore(os.ExpandEnv(r.Auth.CredentialsFile), credentials.StoreOptions{})
+	}
+
+	c, ok := r.credential()
+	if !ok {
+		return CredentialStore()
+	}
+	s := credentials.NewMemoryStore()
+	if err := s.Put(context.Background(), r.Host(), c); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CredentialsFile returns a Docker config file with the credentials configured for the registry, for clients only reading credentials from files (e.g. Helm).
+// The returned function removes the file if it is temporary. The path is empty if no credentials are configured.
+func (r Registry) CredentialsFile() (string, func(), error) {
+	if r.Auth.CredentialsFile != "" {
+		return os.ExpandEnv(r.Auth.CredentialsFile), func() {}, nil
+	}
+
+	c, ok := r.credential()
+	if !ok {
+		return "", func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "helmper-auth")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "config.json")
+	s, err := credentials.NewStore(path, credentials.StoreOptions{AllowPlaintextPut: true})
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	if err := s.Put(context.Background(), r.Host(), c); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return path, cleanup, nil
+}
+
+// HelmRegistryConfig is the path of the credentials file written by 'helm registry login'
+func HelmRegistryConfig() string {
+	return cli.New().RegistryConfig
+}
+
+// CredentialStore reads credentials from the Docker config, falling back to the credentials from 'helm registry login'
+func CredentialStore() (credentials.Store, error) {
+	docker, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return nil, err
+	}
+	helm, err := credentials.NewStore(HelmRegistryConfig(), credentials.StoreOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewStoreWithFallbacks(docker, helm), nil
+}
+
+// ChartCredentialStore reads credentials from 'helm registry login', falling back to the Docker config.
+// Chart credentials are often managed separately from image credentials.
+func ChartCredentialStore() (credentials.Store, error) {
+	docker, err := credentials.NewStoreFromDocker(credentials.StoreOptions{})
+	if err != nil {
+		return nil, err
+	}
+	helm, err := credentials.NewStore(HelmRegistryConfig(), credentials.StoreOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewStoreWithFallbacks(helm, docker), nil
+}
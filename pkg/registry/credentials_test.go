@@ -0,0 +1,126 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeAuth(t *testing.T, path string, host string, user string, pass string) {
+	t.Helper()
+	auth := base64.StdEncoding.EncodeToString([]byte(user + ":" + pass))
+	b := []byte(fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, auth))
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialStores(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("HELM_REGISTRY_CONFIG", filepath.Join(dir, "helm.json"))
+
+	writeAuth(t, filepath.Join(dir, "config.json"), "images.example.com", "docker", "docker")
+	writeAuth(t, filepath.Join(dir, "helm.json"), "charts.example.com", "helm", "helm")
+
+	ctx := context.Background()
+
+	s, err := CredentialStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Get(ctx, "charts.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "helm" {
+		t.Errorf("want '%s' got '%s'", "helm", c.Username)
+	}
+
+	// both configs have credentials for the host
+	writeAuth(t, filepath.Join(dir, "config.json"), "charts.example.com", "docker", "docker")
+
+	s, err = CredentialStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = s.Get(ctx, "charts.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "docker" {
+		t.Errorf("want '%s' got '%s'", "docker", c.Username)
+	}
+
+	// chart credentials take precedence for charts
+	s, err = ChartCredentialStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = s.Get(ctx, "charts.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "helm" {
+		t.Errorf("want '%s' got '%s'", "helm", c.Username)
+	}
+}
+
+func TestRegistryCredentials(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	t.Setenv("REGISTRY_PASSWORD", "secret")
+	writeAuth(t, filepath.Join(dir, "ci.json"), "registry.example.com", "ci", "ci")
+
+	ctx := context.Background()
+
+	r := Registry{URL: "registry.example.com/mirror", Auth: Auth{Username: "user", Password: "${REGISTRY_PASSWORD}"}}
+	if r.Host() != "registry.example.com" {
+		t.Errorf("unexpected host %s", r.Host())
+	}
+	s, err := r.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Get(ctx, "registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "user" || c.Password != "secret" {
+		t.Errorf("unexpected credential %v", c)
+	}
+
+	// Helm reads the credentials from a Docker config file
+	path, cleanup, err := r.CredentialsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := base64.StdEncoding.EncodeToString([]byte("user:secret")); !strings.Contains(string(b), want) {
+		t.Errorf("want credentials file to contain %s, got %s", want, b)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("want temporary credentials file to be removed")
+	}
+
+	r = Registry{URL: "registry.example.com", Auth: Auth{CredentialsFile: filepath.Join(dir, "ci.json")}}
+	s, err = r.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = s.Get(ctx, "registry.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "ci" {
+		t.Errorf("want '%s' got '%s'", "ci", c.Username)
+	}
+}
@@ -0,0 +1,138 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// ecrHost matches private Amazon ECR registries, e.g. '123456789012.dkr.ecr.eu-west-1.amazonaws.com'
+var ecrHost = regexp.MustCompile(`^(\d{12})\.dkr\.ecr(?:-fips)?\.([a-z0-9-]+)\.amazonaws\.com(?:\.cn)?$`)
+
+// ecrAPI is the part of the ECR client used by Helmper
+type ecrAPI interface {
+	GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput, optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error)
+	DescribeRepositories(ctx context.Context, params *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error)
+	CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error)
+}
+
+// newECRClient connects to ECR in the region using the default AWS credential chain (environment, shared config, instance roles)
+var newECRClient = func(ctx context.Context, region string) (ecrAPI, error) {
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	return ecr.NewFromConfig(cfg), nil
+}
+
+// ECR returns the AWS account and region of the registry, if it is a private Amazon ECR registry
+func (r Registry) ECR() (string, string, bool) {
+	m := ecrHost.FindStringSubmatch(r.Host())
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// isECR reports whether the host is a private Amazon ECR registry
+func isECR(host string) bool {
+	return ecrHost.MatchString(host)
+}
+
+// ecrCredential obtains an authorization token for the ECR registry through the AWS SDK. Tokens are valid for 12 hours
+func ecrCredential(ctx context.Context, r Registry) (auth.Credential, time.Time, error) {
+	account, region, _ := r.ECR()
+	api, err := newECRClient(ctx, region)
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	out, err := api.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{
+		RegistryIds: []string{account},
+	})
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	if len(out.AuthorizationData) == 0 || out.AuthorizationData[0].AuthorizationToken == nil {
+		return auth.EmptyCredential, time.Time{}, fmt.Errorf("no authorization token returned")
+	}
+
+	data := out.AuthorizationData[0]
+	b, err := base64.StdEncoding.DecodeString(aws.ToString(data.AuthorizationToken))
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	username, password, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return auth.EmptyCredential, time.Time{}, fmt.Errorf("malformed authorization token")
+	}
+
+	expires := time.Now().Add(12 * time.Hour)
+	if data.ExpiresAt != nil {
+		expires = *data.ExpiresAt
+	}
+	return auth.Credential{Username: username, Password: password}, expires, nil
+}
+
+// repositoryPath is the path of the named repository in the registry, including any prefix in the registry URL
+func (r Registry) repositoryPath(name string) string {
+	name = r.Target(name)
+	_, prefix, _ := strings.Cut(r.URL, "/")
+	if prefix == "" {
+		return name
+	}
+	return strings.Trim(prefix, "/") + "/" + name
+}
+
+// EnsureRepository creates the named repository if it does not exist, as ECR rejects pushes to missing repositories.
+// For Harbor registries with HarborProjects, it creates the project of the repository instead. It does nothing for other registries.
+func (r Registry) EnsureRepository(ctx context.Context, name string) error {
+	if r.HarborProjects.Create || r.HarborProjects.Quota {
+		return r.ensureHarborProject(ctx, name)
+	}
+
+	account, region, ok := r.ECR()
+	if !ok {
+		return nil
+	}
+
+	api, err := newECRClient(ctx, region)
+	if err != nil {
+		return fmt.Errorf("registry: error connecting to ECR in %s :: %w", region, err)
+	}
+
+	repo := r.repositoryPath(name)
+	_, err = api.DescribeRepositories(ctx, &ecr.DescribeRepositoriesInput{
+		RegistryId:      aws.String(account),
+		RepositoryNames: []string{repo},
+	})
+	var notFound *types.RepositoryNotFoundException
+	switch {
+	case err == nil:
+		return nil
+	case !errors.As(err, &notFound):
+		return fmt.Errorf("registry: error looking up ECR repository %s :: %w", repo, err)
+	}
+
+	_, err = api.CreateRepository(ctx, &ecr.CreateRepositoryInput{
+		RegistryId:     aws.String(account),
+		RepositoryName: aws.String(repo),
+	})
+	var exists *types.RepositoryAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return fmt.Errorf("registry: error creating ECR repository %s :: %w", repo, err)
+	}
+	slog.Info("created ECR repository", slog.String("registry", r.Host()), slog.String("repository", repo))
+
+	return nil
+}
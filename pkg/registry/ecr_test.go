@@ -0,0 +1,127 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecr"
+	"github.com/aws/aws-sdk-go-v2/service/ecr/types"
+)
+
+type fakeECR struct {
+	repositories map[string]bool
+	tokens       int
+}
+
+func (f *fakeECR) GetAuthorizationToken(ctx context.Context, params *ecr.GetAuthorizationTokenInput, optFns ...func(*ecr.Options)) (*ecr.GetAuthorizationTokenOutput, error) {
+	f.tokens++
+	token := base64.StdEncoding.EncodeToString([]byte("AWS:password"))
+	return &ecr.GetAuthorizationTokenOutput{
+		AuthorizationData: []types.AuthorizationData{{
+			AuthorizationToken: aws.String(token),
+			ExpiresAt:          aws.Time(time.Now().Add(12 * time.Hour)),
+		}},
+	}, nil
+}
+
+func (f *fakeECR) DescribeRepositories(ctx context.Context, params *ecr.DescribeRepositoriesInput, optFns ...func(*ecr.Options)) (*ecr.DescribeRepositoriesOutput, error) {
+	if !f.repositories[params.RepositoryNames[0]] {
+		return nil, &types.RepositoryNotFoundException{}
+	}
+	return &ecr.DescribeRepositoriesOutput{}, nil
+}
+
+func (f *fakeECR) CreateRepository(ctx context.Context, params *ecr.CreateRepositoryInput, optFns ...func(*ecr.Options)) (*ecr.CreateRepositoryOutput, error) {
+	f.repositories[aws.ToString(params.RepositoryName)] = true
+	return &ecr.CreateRepositoryOutput{}, nil
+}
+
+func withFakeECR(t *testing.T) *fakeECR {
+	f := &fakeECR{repositories: map[string]bool{}}
+	orig := newECRClient
+	newECRClient = func(ctx context.Context, region string) (ecrAPI, error) {
+		return f, nil
+	}
+	t.Cleanup(func() {
+		newECRClient = orig
+		tokens.Range(func(k, _ any) bool {
+			tokens.Delete(k)
+			return true
+		})
+	})
+	return f
+}
+
+func TestECR(t *testing.T) {
+	tests := []struct {
+		url     string
+		account string
+		region  string
+		ok      bool
+	}{
+		{"123456789012.dkr.ecr.eu-west-1.amazonaws.com", "123456789012", "eu-west-1", true},
+		{"123456789012.dkr.ecr-fips.us-east-1.amazonaws.com/mirror", "123456789012", "us-east-1", true},
+		{"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", "123456789012", "cn-north-1", true},
+		{"public.ecr.aws/org", "", "", false},
+		{"myregistry.azurecr.io", "", "", false},
+	}
+	for _, tt := range tests {
+		account, region, ok := Registry{URL: tt.url}.ECR()
+		if account != tt.account || region != tt.region || ok != tt.ok {
+			t.Errorf("%s: want (%s, %s, %v) got (%s, %s, %v)", tt.url, tt.account, tt.region, tt.ok, account, region, ok)
+		}
+	}
+}
+
+func TestECRCredentials(t *testing.T) {
+	f := withFakeECR(t)
+	r := Registry{URL: "123456789012.dkr.ecr.eu-west-1.amazonaws.com"}
+
+	s, err := r.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Get(context.Background(), r.Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "AWS" || c.Password != "password" {
+		t.Errorf("unexpected credential %v", c)
+	}
+
+	// tokens are cached until they expire
+	if _, err := r.Credentials(); err != nil {
+		t.Fatal(err)
+	}
+	if f.tokens != 1 {
+		t.Errorf("want 1 token request got %d", f.tokens)
+	}
+}
+
+func TestEnsureRepository(t *testing.T) {
+	f := withFakeECR(t)
+	ctx := context.Background()
+
+	r := Registry{URL: "123456789012.dkr.ecr.eu-west-1.amazonaws.com/mirror"}
+	if err := r.EnsureRepository(ctx, "charts/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.repositories["mirror/charts/nginx"] {
+		t.Errorf("want repository 'mirror/charts/nginx' to be created, got %v", f.repositories)
+	}
+	// existing repositories are left alone
+	if err := r.EnsureRepository(ctx, "charts/nginx"); err != nil {
+		t.Fatal(err)
+	}
+
+	// other registries are not touched
+	if err := (Registry{URL: "0.0.0.0:5000"}).EnsureRepository(ctx, "library/nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.repositories) != 1 {
+		t.Errorf("want 1 repository got %d", len(f.repositories))
+	}
+}
@@ -0,0 +1,51 @@
+package registry
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+)
+
+// ExportOption copies images into a bundle instead of pushing them to registries
+type ExportOption struct {
+	Imgs   []*Image
+	Bundle *Bundle
+
+	Architecture *string
+}
+
+func (eo ExportOption) Run(ctx context.Context) error {
+
+	slog.Debug("exporting images to bundle..", slog.String("bundle", eo.Bundle.Path))
+
+	bar := terminal.NewBar(len(eo.Imgs), "Exporting images...\r")
+
+	for _, i := range eo.Imgs {
+		name, err := i.ImageName()
+		if err != nil {
+			return err
+		}
+		// copy pinned images by digest
+		ref := i.Tag
+		if i.UseDigest && i.Digest != "" {
+			ref, err = i.TagOrDigest()
+			if err != nil {
+				return err
+			}
+		}
+		manifest, err := eo.Bundle.AddImage(ctx, i.Registry, name, ref, eo.Architecture)
+		if err != nil {
+			return err
+		}
+		i.Digest = manifest.Digest.String()
+
+		_ = bar.Add(1)
+	}
+
+	_ = bar.Finish()
+
+	slog.Debug("all images have been exported to bundle")
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// garUsername is the username Google registries expect with OAuth access tokens
+const garUsername = "oauth2accesstoken"
+
+// googleTokenSource returns the application default credentials (environment, workload identity, metadata server)
+var googleTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+	creds, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/cloud-platform")
+	if err != nil {
+		return nil, err
+	}
+	return creds.TokenSource, nil
+}
+
+// isGAR reports whether the host is a Google Artifact Registry or Container Registry
+func isGAR(host string) bool {
+	return host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev")
+}
+
+// garCredential obtains an OAuth access token from the application default credentials
+func garCredential(ctx context.Context, _ Registry) (auth.Credential, time.Time, error) {
+	ts, err := googleTokenSource(ctx)
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	t, err := ts.Token()
+	if err != nil {
+		return auth.EmptyCredential, time.Time{}, err
+	}
+	return auth.Credential{Username: garUsername, Password: t.AccessToken}, t.Expiry, nil
+}
@@ -0,0 +1,48 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestIsGAR(t *testing.T) {
+	tests := map[string]bool{
+		"gcr.io":                       true,
+		"eu.gcr.io":                    true,
+		"europe-west1-docker.pkg.dev":  true,
+		"europe-west1-pkg.dev.example": false,
+		"123456789012.dkr.ecr.eu-west-1.amazonaws.com": false,
+	}
+	for host, want := range tests {
+		if got := isGAR(host); got != want {
+			t.Errorf("%s: want %v got %v", host, want, got)
+		}
+	}
+}
+
+func TestGARCredentials(t *testing.T) {
+	orig := googleTokenSource
+	googleTokenSource = func(ctx context.Context) (oauth2.TokenSource, error) {
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}), nil
+	}
+	t.Cleanup(func() {
+		googleTokenSource = orig
+		tokens.Delete("europe-west1-docker.pkg.dev")
+	})
+
+	r := Registry{URL: "europe-west1-docker.pkg.dev/project/mirror"}
+	s, err := r.Credentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Get(context.Background(), r.Host())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != garUsername || c.Password != "access" {
+		t.Errorf("unexpected credential %v", c)
+	}
+}
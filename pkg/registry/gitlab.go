@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// GitLab manages the deploy tokens of a GitLab group, allowed to pull from the container registries of the projects of the group
+type GitLab struct {
+	Registry Registry
+	// URL is the base URL of the GitLab instance, e.g. https://gitlab.example.com
+	URL string
+	// Group is the ID or full path of the group, e.g. 'platform/mirror'
+	Group string
+	// Token is an access token of the group with the api scope. Environment variables are expanded
+	Token string
+}
+
+type gitlabDeployToken struct {
+	ID        int64   `json:"id"`
+	Name      string  `json:"name"`
+	Username  string  `json:"username"`
+	Token     string  `json:"token"`
+	ExpiresAt *string `json:"expires_at"`
+	Revoked   bool    `json:"revoked"`
+	Expired   bool    `json:"expired"`
+}
+
+// expires is the time the deploy token expires. The zero time never expires
+func (t gitlabDeployToken) expires() time.Time {
+	if t.ExpiresAt == nil {
+		return time.Time{}
+	}
+	at, err := time.Parse(time.RFC3339, *t.ExpiresAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return at
+}
+
+// do sends the request to the GitLab API, decoding the response into out if set
+func (g GitLab) do(ctx context.Context, method string, p string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(g.URL, "/")+"/api/v4"+p, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("PRIVATE-TOKEN", os.ExpandEnv(g.Token))
+
+	client, err := g.Registry.HTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s failed with status %s: %s", method, p, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// DeployToken returns a deploy token of the group with the name, allowed to read the registries of the group.
+// GitLab only returns the token when it is created, so the previous credential is reused while its deploy token is active, e.g. from
+// the Secret written by the last run. Otherwise a new deploy token is created, and the other deploy tokens with the name are revoked.
+// Duration is the number of days the deploy token is valid, -1 never expires
+func (g GitLab) DeployToken(ctx context.Context, name string, duration int, previous auth.Credential) (auth.Credential, error) {
+	group := "/groups/" + url.PathEscape(g.Group) + "/deploy_tokens"
+
+	tokens := []gitlabDeployToken{}
+	if err := g.do(ctx, http.MethodGet, group+"?active=true", nil, &tokens); err != nil {
+		return auth.EmptyCredential, fmt.Errorf("registry: error listing GitLab deploy tokens of group %s :: %w", g.Group, err)
+	}
+	for _, t := range tokens {
+		if t.Name == name && !t.Revoked && !t.Expired && t.Username == previous.Username && previous.Password != "" && !expiring(t.expires()) {
+			return previous, nil
+		}
+	}
+
+	token := map[string]any{
+		"name":   name,
+		"scopes": []string{"read_registry"},
+	}
+	if duration > 0 {
+		token["expires_at"] = time.Now().AddDate(0, 0, duration).UTC().Format(time.RFC3339)
+	}
+	var created gitlabDeployToken
+	if err := g.do(ctx, http.MethodPost, group, token, &created); err != nil {
+		return auth.EmptyCredential, fmt.Errorf("registry: error creating GitLab deploy token %s in group %s :: %w", name, g.Group, err)
+	}
+	slog.Info("created GitLab deploy token", slog.String("registry", g.Registry.Host()), slog.String("group", g.Group), slog.String("username", created.Username))
+
+	// the replaced tokens are revoked, so only the token in the Secret can pull
+	for _, t := range tokens {
+		if t.Name != name || t.ID == created.ID {
+			continue
+		}
+		if err := g.do(ctx, http.MethodDelete, fmt.Sprintf("%s/%d", group, t.ID), nil, nil); err != nil {
+			slog.Warn("could not revoke replaced GitLab deploy token", slog.String("group", g.Group), slog.String("username", t.Username), slog.String("error", err.Error()))
+		}
+	}
+	return auth.Credential{Username: created.Username, Password: created.Token}, nil
+}
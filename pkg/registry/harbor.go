@@ -0,0 +1,430 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicationRule is a Harbor replication policy pulling the tags of one repository from its source registry into the Harbor project
+type ReplicationRule struct {
+	Name       string   `json:"name"`
+	Source     string   `json:"source"`
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags"`
+	// Namespace is the project, and path in the project, the repository is replicated under
+	Namespace string `json:"namespace"`
+}
+
+var invalidPolicyName = regexp.MustCompile(`[^a-z0-9]+`)
+
+// policyName turns the parts into a valid Harbor policy or endpoint name, e.g. 'helmper-docker-io-library-nginx'
+func policyName(parts ...string) string {
+	n := invalidPolicyName.ReplaceAllString(strings.ToLower(strings.Join(parts, "-")), "-")
+	n = strings.Trim(n, "-")
+	if len(n) > 255 {
+		n = n[:255]
+	}
+	return n
+}
+
+// ReplicationRules returns a replication rule per repository of the images, replicating their tags into the Harbor registry
+func ReplicationRules(imgs []*Image, harbor Registry) ([]ReplicationRule, error) {
+	_, namespace, ok := strings.Cut(harbor.URL, "/")
+	if !ok || namespace == "" {
+		return nil, fmt.Errorf("registry: Harbor replicates into a project, but the registry url '%s' has none, e.g. %s/mirror", harbor.URL, harbor.URL)
+	}
+
+	rules := map[string]*ReplicationRule{}
+	for _, i := range imgs {
+		name, err := i.ImageName()
+		if err != nil {
+			return nil, err
+		}
+		source := normalizeHost(i.Registry)
+		tag, _, _ := strings.Cut(i.Tag, "@")
+
+		key := source + "/" + name
+		r, ok := rules[key]
+		if !ok {
+			r = &ReplicationRule{
+				Name:       policyName("helmper", source, name),
+				Source:     source,
+				Repository: name,
+				Namespace:  namespace,
+			}
+			rules[key] = r
+		}
+		if tag != "" && !contains(r.Tags, tag) {
+			r.Tags = append(r.Tags, tag)
+		}
+	}
+
+	res := make([]ReplicationRule, 0, len(rules))
+	for _, r := range rules {
+		sort.Strings(r.Tags)
+		res = append(res, *r)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func contains(vs []string, v string) bool {
+	for _, s := range vs {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// tagFilter matches the tags of the rule, using the doublestar pattern Harbor supports
+func (r ReplicationRule) tagFilter() string {
+	if len(r.Tags) == 1 {
+		return r.Tags[0]
+	}
+	return "{" + strings.Join(r.Tags, ",") + "}"
+}
+
+// harborEndpoint is the Harbor registry endpoint type and URL of the source registry
+func harborEndpoint(source string) (string, string) {
+	switch source {
+	case "docker.io":
+		return "docker-hub", "https://hub.docker.com"
+	case "ghcr.io":
+		return "github-ghcr", "https://ghcr.io"
+	case "quay.io":
+		return "quay", "https://quay.io"
+	default:
+		return "docker-registry", "https://" + source
+	}
+}
+
+// Harbor applies replication rules through the API of the Harbor instance hosting the registry
+type Harbor struct {
+	Registry Registry
+	// URL is the base URL of the Harbor API. Defaults to the host of the registry
+	URL string
+	// Interval between polls of running replications. Defaults to 10 seconds
+	Interval time.Duration
+}
+
+type harborID struct {
+	ID int64 `json:"id"`
+}
+
+type harborFilter struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type harborPolicy struct {
+	Name                      string         `json:"name"`
+	Description               string         `json:"description"`
+	SrcRegistry               harborID       `json:"src_registry"`
+	DestNamespace             string         `json:"dest_namespace"`
+	DestNamespaceReplaceCount int            `json:"dest_namespace_replace_count"`
+	Filters                   []harborFilter `json:"filters"`
+	Trigger                   struct {
+		Type string `json:"type"`
+	} `json:"trigger"`
+	Enabled  bool `json:"enabled"`
+	Override bool `json:"override"`
+}
+
+func (h Harbor) baseURL() string {
+	if h.URL != "" {
+		return strings.TrimSuffix(h.URL, "/")
+	}
+	scheme := "https"
+	if h.Registry.PlainHTTP {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s", scheme, h.Registry.Host())
+}
+
+// do calls the Harbor API with the credentials of the registry, and returns the id of created resources
+func (h Harbor) do(ctx context.Context, method string, p string, in any, out any) (int64, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, h.baseURL()+"/api/v2.0"+p, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	store, err := h.Registry.Credentials()
+	if err != nil {
+		return 0, err
+	}
+	if c, err := store.Get(ctx, h.Registry.Host()); err == nil && c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client, err := h.Registry.HTTPClient()
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("%s %s failed with status %s: %s", method, p, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return 0, err
+		}
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		return strconv.ParseInt(path.Base(loc), 10, 64)
+	}
+	return 0, nil
+}
+
+// lookup returns the id of the resource with the name in the collection, or zero if there is none
+func (h Harbor) lookup(ctx context.Context, collection string, name string) (int64, error) {
+	res := []struct {
+		ID   int64  `json:"id"`
+		Name string `json:"name"`
+	}{}
+	if _, err := h.do(ctx, http.MethodGet, collection+"?q="+url.QueryEscape("name="+name), nil, &res); err != nil {
+		return 0, err
+	}
+	for _, r := range res {
+		if r.Name == name {
+			return r.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// endpoint returns the id of the Harbor registry endpoint of the source registry, creating it if needed
+func (h Harbor) endpoint(ctx context.Context, source string) (int64, error) {
+	name := policyName("helmper", source)
+	id, err := h.lookup(ctx, "/registries", name)
+	if err != nil || id != 0 {
+		return id, err
+	}
+
+	t, u := harborEndpoint(source)
+	return h.do(ctx, http.MethodPost, "/registries", map[string]any{
+		"name":        name,
+		"type":        t,
+		"url":         u,
+		"description": "Managed by helmper",
+	}, nil)
+}
+
+// Apply creates or updates the replication policies of the rules and starts them. It returns the ids of the started executions
+func (h Harbor) Apply(ctx context.Context, rules []ReplicationRule) ([]int64, error) {
+	endpoints := map[string]int64{}
+	executions := []int64{}
+	for _, r := range rules {
+		src, ok := endpoints[r.Source]
+		if !ok {
+			var err error
+			if src, err = h.endpoint(ctx, r.Source); err != nil {
+				return nil, fmt.Errorf("registry: error creating Harbor endpoint for %s :: %w", r.Source, err)
+			}
+			endpoints[r.Source] = src
+		}
+
+		p := harborPolicy{
+			Name:          r.Name,
+			Description:   "Managed by helmper",
+			SrcRegistry:   harborID{ID: src},
+			DestNamespace: r.Namespace,
+			Filters: []harborFilter{
+				{Type: "name", Value: r.Repository},
+				{Type: "tag", Value: r.tagFilter()},
+			},
+			Enabled:  true,
+			Override: true,
+		}
+		p.Trigger.Type = "manual"
+
+		id, err := h.lookup(ctx, "/replication/policies", r.Name)
+		if err != nil {
+			return nil, fmt.Errorf("registry: error looking up Harbor replication policy %s :: %w", r.Name, err)
+		}
+		if id == 0 {
+			id, err = h.do(ctx, http.MethodPost, "/replication/policies", p, nil)
+		} else {
+			_, err = h.do(ctx, http.MethodPut, fmt.Sprintf("/replication/policies/%d", id), p, nil)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("registry: error applying Harbor replication policy %s :: %w", r.Name, err)
+		}
+
+		e, err := h.do(ctx, http.MethodPost, "/replication/executions", map[string]int64{"policy_id": id}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("registry: error starting Harbor replication policy %s :: %w", r.Name, err)
+		}
+		executions = append(executions, e)
+	}
+	return executions, nil
+}
+
+// Wait waits until the executions have finished, and returns an error if any of them did not succeed
+func (h Harbor) Wait(ctx context.Context, executions []int64) error {
+	interval := h.Interval
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+
+	for _, e := range executions {
+		for {
+			var res struct {
+				Status     string `json:"status"`
+				StatusText string `json:"status_text"`
+			}
+			if _, err := h.do(ctx, http.MethodGet, fmt.Sprintf("/replication/executions/%d", e), nil, &res); err != nil {
+				return fmt.Errorf("registry: error getting Harbor replication execution %d :: %w", e, err)
+			}
+
+			if res.Status == "Succeed" {
+				break
+			}
+			if res.Status != "InProgress" && res.Status != "Pending" && res.Status != "Running" {
+				return fmt.Errorf("registry: Harbor replication execution %d %s: %s", e, strings.ToLower(res.Status), res.StatusText)
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+	}
+	return nil
+}
+
+// HarborProjects creates the Harbor projects images and charts are pushed to, as Harbor rejects pushes to missing projects
+type HarborProjects struct {
+	// Create creates missing projects before the first push to them
+	Create bool
+	// Public makes the created projects public, so images can be pulled without credentials
+	Public bool
+	// Quota fails pushes to projects that have used their storage quota, and warns when they are nearly full
+	Quota bool
+	// URL is the base URL of the Harbor API. Defaults to the host of the registry
+	URL string
+	// Ensured are the projects that have been checked in the run, by host and project, so they are checked once per run.
+	// Without it, the project is checked before every push
+	Ensured *sync.Map
+}
+
+// quotaWarning is the share of the storage quota of a project above which pushes are warned about
+const quotaWarning = 0.9
+
+// harborProject is the Harbor project of the named repository, the first path segment of the repository in the registry.
+// Repositories without a path are in the 'library' project
+func (r Registry) harborProject(name string) string {
+	project, _, ok := strings.Cut(r.repositoryPath(name), "/")
+	if !ok {
+		return "library"
+	}
+	return project
+}
+
+type harborQuota struct {
+	Hard struct {
+		Storage int64 `json:"storage"`
+	} `json:"hard"`
+	Used struct {
+		Storage int64 `json:"storage"`
+	} `json:"used"`
+}
+
+// ensureHarborProject creates the Harbor project of the named repository if it is missing, and checks its storage quota.
+// Every project is only checked once per run
+func (r Registry) ensureHarborProject(ctx context.Context, name string) error {
+	project := r.harborProject(name)
+	key := r.Host() + "/" + project
+	if e := r.HarborProjects.Ensured; e != nil {
+		if _, ok := e.Load(key); ok {
+			return nil
+		}
+	}
+
+	h := Harbor{Registry: r, URL: r.HarborProjects.URL}
+	id, err := h.lookup(ctx, "/projects", project)
+	if err != nil {
+		return fmt.Errorf("registry: error looking up Harbor project %s :: %w", project, err)
+	}
+
+	switch {
+	case id != 0:
+	case !r.HarborProjects.Create:
+		return fmt.Errorf("registry: the Harbor project %s does not exist in %s", project, r.Host())
+	default:
+		_, err := h.do(ctx, http.MethodPost, "/projects", map[string]any{
+			"project_name": project,
+			"metadata":     map[string]string{"public": strconv.FormatBool(r.HarborProjects.Public)},
+		}, nil)
+		if err != nil {
+			// another push may have created the project in the meantime
+			if id, _ := h.lookup(ctx, "/projects", project); id == 0 {
+				return fmt.Errorf("registry: error creating Harbor project %s :: %w", project, err)
+			}
+		} else {
+			slog.Info("created Harbor project", slog.String("registry", r.Host()), slog.String("project", project), slog.Bool("public", r.HarborProjects.Public))
+		}
+	}
+
+	if r.HarborProjects.Quota {
+		var summary struct {
+			Quota harborQuota `json:"quota"`
+		}
+		if _, err := h.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(project)+"/summary", nil, &summary); err != nil {
+			return fmt.Errorf("registry: error getting quota of Harbor project %s :: %w", project, err)
+		}
+		if err := summary.Quota.check(project); err != nil {
+			return err
+		}
+	}
+
+	if e := r.HarborProjects.Ensured; e != nil {
+		e.Store(key, true)
+	}
+	return nil
+}
+
+// check returns an error if the project has used its storage quota, and warns if it is nearly full. A negative quota is unlimited
+func (q harborQuota) check(project string) error {
+	hard, used := q.Hard.Storage, q.Used.Storage
+	switch {
+	case hard < 0:
+		return nil
+	case used >= hard:
+		return fmt.Errorf("registry: the Harbor project %s has used its storage quota (%d of %d bytes)", project, used, hard)
+	case float64(used) >= quotaWarning*float64(hard):
+		slog.Warn("Harbor project is nearly out of storage quota", slog.String("project", project), slog.Int64("used", used), slog.Int64("quota", hard))
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplicationRules(t *testing.T) {
+	imgs := []*Image{
+		{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"},
+		{Registry: "index.docker.io", Repository: "library/nginx", Tag: "1.24"},
+		{Registry: "quay.io", Repository: "prometheus/node-exporter", Tag: "v1.8.0@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80"},
+	}
+
+	rules, err := ReplicationRules(imgs, Registry{URL: "harbor.internal/mirror"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ReplicationRule{
+		{Name: "helmper-docker-io-library-nginx", Source: "docker.io", Repository: "library/nginx", Tags: []string{"1.24", "1.25"}, Namespace: "mirror"},
+		{Name: "helmper-quay-io-prometheus-node-exporter", Source: "quay.io", Repository: "prometheus/node-exporter", Tags: []string{"v1.8.0"}, Namespace: "mirror"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("want %+v got %+v", want, rules)
+	}
+
+	if _, err := ReplicationRules(imgs, Registry{URL: "harbor.internal"}); err == nil {
+		t.Error("want error for a registry without a project")
+	}
+}
+
+func TestHarborApply(t *testing.T) {
+	policies := map[string]harborPolicy{}
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2.0/registries", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"id": 3, "name": "helmper-docker-io"}]`))
+	})
+	mux.HandleFunc("GET /api/v2.0/replication/policies", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("POST /api/v2.0/replication/policies", func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "admin" || p != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var p harborPolicy
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		policies[p.Name] = p
+		w.Header().Set("Location", fmt.Sprintf("/api/v2.0/replication/policies/%d", len(policies)))
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("POST /api/v2.0/replication/executions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/api/v2.0/replication/executions/7")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /api/v2.0/replication/executions/7", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "InProgress"
+		if polls > 1 {
+			status = "Succeed"
+		}
+		_, _ = w.Write([]byte(`{"status": "` + status + `"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	h := Harbor{
+		Registry: Registry{URL: "harbor.internal/mirror", Auth: Auth{Username: "admin", Password: "secret"}},
+		URL:      srv.URL,
+		Interval: time.Millisecond,
+	}
+	rules := []ReplicationRule{{Name: "helmper-docker-io-library-nginx", Source: "docker.io", Repository: "library/nginx", Tags: []string{"1.24", "1.25"}, Namespace: "mirror"}}
+
+	ctx := context.Background()
+	executions, err := h.Apply(ctx, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(executions, []int64{7}) {
+		t.Errorf("want execution 7 got %v", executions)
+	}
+	p := policies["helmper-docker-io-library-nginx"]
+	if p.SrcRegistry.ID != 3 || p.DestNamespace != "mirror" || p.Filters[1].Value != "{1.24,1.25}" {
+		t.Errorf("unexpected policy %+v", p)
+	}
+
+	if err := h.Wait(ctx, executions); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 2 {
+		t.Errorf("want 2 polls got %d", polls)
+	}
+}
+
+func TestEnsureHarborProject(t *testing.T) {
+	created := map[string]map[string]string{}
+	lookups := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2.0/projects", func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		_, _ = w.Write([]byte(`[{"id": 1, "name": "library"}, {"id": 2, "name": "full"}]`))
+	})
+	mux.HandleFunc("POST /api/v2.0/projects", func(w http.ResponseWriter, r *http.Request) {
+		var p struct {
+			Name     string            `json:"project_name"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		created[p.Name] = p.Metadata
+		w.Header().Set("Location", "/api/v2.0/projects/3")
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /api/v2.0/projects/{name}/summary", func(w http.ResponseWriter, r *http.Request) {
+		used := 10
+		if r.PathValue("name") == "full" {
+			used = 100
+		}
+		_, _ = fmt.Fprintf(w, `{"quota": {"hard": {"storage": 100}, "used": {"storage": %d}}}`, used)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	r := Registry{URL: "harbor-ensure.internal", HarborProjects: HarborProjects{Create: true, Public: true, Quota: true, URL: srv.URL, Ensured: &sync.Map{}}}
+	for range 2 {
+		if err := r.EnsureRepository(ctx, "mirror/nginx"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("want the project checked once per run got %d lookups", lookups)
+	}
+	if m, ok := created["mirror"]; !ok || m["public"] != "true" {
+		t.Errorf("want public project mirror created got %v", created)
+	}
+	if err := r.EnsureRepository(ctx, "nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := created["library"]; ok {
+		t.Error("want existing project library not to be created")
+	}
+	if err := r.EnsureRepository(ctx, "full/nginx"); err == nil {
+		t.Error("want error for a project that has used its quota")
+	}
+
+	r = Registry{URL: "harbor-ensure.internal/missing", HarborProjects: HarborProjects{Quota: true, URL: srv.URL}}
+	if err := r.EnsureRepository(ctx, "nginx"); err == nil {
+		t.Error("want error for a missing project without create")
+	}
+}
@@ -55,6 +55,16 @@ type Image struct {
 	Digest     string
 	UseDigest  bool
 	Patch      *bool
+	// Workloads are the workload kinds referencing the image in the rendered charts, e.g. 'Deployment' or 'Job (init)'
+	Workloads []string
+	// Confidence that the image is the one the chart deploys from its value paths. Empty for images not found in charts
+	Confidence Confidence
+	// SiblingOf is the image the image is a variant of, when discovered by tag convention
+	SiblingOf string
+	// Retagged images are referenced by another tag in the registries than in the charts, e.g. patched images, so their tag values are overridden
+	Retagged bool
+	// Registries are the names of the registries the image is routed to. Empty routes the image to every registry
+	Registries []string
 }
 
 func (i Image) TagOrDigest() (string, error) {
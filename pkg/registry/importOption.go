@@ -4,65 +4,176 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
-	"os"
-
-	"github.com/k0kubun/go-ansi"
-	"github.com/schollz/progressbar/v3"
+	"sort"
+	"sync"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"github.com/ChristofferNissen/helmper/pkg/util/tracing"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
+// tracer traces the copies of images. Spans are only exported when tracing is enabled
+var tracer = otel.Tracer("github.com/ChristofferNissen/helmper/pkg/registry")
+
 type ImportOption struct {
 	Imgs       []*Image
 	Registries []Registry
 
 	Architecture *string
-	All          bool
+	// Platforms of multi-arch images copied as a new index, e.g. 'linux/amd64' and 'linux/arm64'. Ignored when Architecture is set
+	Platforms []string
+	// Referrers copies the artifacts attached to the source images, e.g. cosign signatures, SLSA provenance and SBOMs.
+	// Not copied for Platforms, as the new index has another digest than the source
+	Referrers bool
+	All       bool
+
+	// Concurrency limits the number of images copied in parallel. Zero or less is unlimited
+	Concurrency int
+	// Retries is the number of times a failed copy of an image is retried, with exponential backoff
+	Retries int
+	Backoff Backoff
+	// ContinueOnError copies the other images when an image can not be copied, and returns the failed copies in a *FailedError
+	ContinueOnError bool
+
+	// Done is called when an image is present in all registries, and Copied when it was copied to at least one of them.
+	// They are not called in dry-run
+	Done   func(*Image)
+	Copied func(*Image)
+	// OnFallback is called when an image is pushed to the fallback of a registry instead of the registry
+	OnFallback func(Fallback)
+
+	// DryRun records the pushes in Plan instead of performing them
+	DryRun bool
+	Plan   *plan.Plan
+}
+
+// Failure is an image that could not be copied to a registry
+type Failure struct {
+	// Image is the source reference of the image
+	Image    string
+	Registry string
+	Err      error
+}
+
+// Fallback is an image or chart pushed to the fallback of a registry, as the pushes to the registry failed
+type Fallback struct {
+	// Image is the source reference of the image, or 'charts/<name>:<version>' for charts
+	Image    string
+	Registry string
+	Fallback string
+	Err      error
+}
+
+// FailedError is returned by ImportOption and the Patcher with ContinueOnError when images could not be pushed
+type FailedError struct {
+	Failures []Failure
+}
+
+func (e *FailedError) Error() string {
+	return fmt.Sprintf("registry: %d image(s) could not be pushed", len(e.Failures))
 }
 
 func (io ImportOption) Run(ctx context.Context) error {
 
 	slog.Debug("pushing images to registries..")
 
-	bar := progressbar.NewOptions(len(io.Imgs), progressbar.OptionSetWriter(ansi.NewAnsiStdout()), // "github.com/k0kubun/go-ansi"
-		progressbar.OptionEnableColorCodes(true),
-		progressbar.OptionShowCount(),
-		progressbar.OptionOnCompletion(func() {
-			fmt.Fprint(os.Stderr, "\n")
-		}),
-		progressbar.OptionSetWidth(15),
-		progressbar.OptionSetDescription("Pushing images...\r"),
-		progressbar.OptionShowDescriptionAtLineEnd(),
-		progressbar.OptionSetTheme(progressbar.Theme{
-			Saucer:        "[green]=[reset]",
-			SaucerHead:    "[green]>[reset]",
-			SaucerPadding: " ",
-			BarStart:      "[",
-			BarEnd:        "]",
-		}))
+	bar := terminal.NewBar(len(io.Imgs), "Pushing images...\r")
+
+	var mu sync.Mutex
+	failures := []Failure{}
 
 	eg, egCtx := errgroup.WithContext(ctx)
+	if io.Concurrency > 0 {
+		eg.SetLimit(io.Concurrency)
+	}
 	for _, i := range io.Imgs {
-		name, err := i.ImageName()
-		if err != nil {
-			return err
-		}
-		status := Exists(ctx, name, i.Tag, io.Registries)
-
 		func(i *Image) {
 			eg.Go(func() error {
-				for _, reg := range io.Registries {
+				name, err := i.ImageName()
+				if err != nil {
+					return err
+				}
+				registries := i.RoutedTo(io.Registries)
+				status := Exists(egCtx, name, i.Tag, registries)
+				failed, copied := false, false
+
+				for _, reg := range registries {
 					if io.All || !status[reg.GetName()] {
-						name, err := i.ImageName()
-						if err != nil {
-							return err
+						// copy pinned images by digest
+						ref := i.Tag
+						if i.UseDigest && i.Digest != "" {
+							ref, err = i.TagOrDigest()
+							if err != nil {
+								return err
+							}
+						}
+						if io.DryRun {
+							src, err := i.String()
+							if err != nil {
+								return err
+							}
+							kind := plan.CopyImage
+							if i.SiblingOf != "" {
+								kind = plan.CopySibling
+							}
+							io.Plan.Add(plan.Action{
+								Kind:         kind,
+								Source:       src,
+								Target:       reg.Ref(name, i.Tag),
+								Architecture: io.Architecture,
+								Platforms:    io.Platforms,
+								Referrers:    io.Referrers,
+								Insecure:     reg.Insecure,
+								PlainHTTP:    reg.PlainHTTP,
+							})
+							continue
+						}
+						ctx, span := tracer.Start(egCtx, "registry.copy", trace.WithAttributes(
+							attribute.String("image", fmt.Sprintf("%s/%s:%s", i.Registry, name, ref)),
+							attribute.String("registry", reg.URL),
+						))
+						err := io.copy(ctx, reg, i, name, ref)
+						if err != nil && reg.Fallback != nil && ctx.Err() == nil {
+							slog.Warn("could not push image. pushing to the fallback registry", slog.String("image", name), slog.String("registry", reg.URL), slog.String("fallback", reg.Fallback.URL), slog.String("error", err.Error()))
+							if ferr := io.copy(ctx, *reg.Fallback, i, name, ref); ferr != nil {
+								err = fmt.Errorf("%w, and to the fallback registry %s :: %w", err, reg.Fallback.URL, ferr)
+							} else {
+								if io.OnFallback != nil {
+									src, _ := i.String()
+									io.OnFallback(Fallback{Image: src, Registry: reg.URL, Fallback: reg.Fallback.URL, Err: err})
+								}
+								// the image is not done, so it is pushed to the registry again by the next run
+								failed = true
+								err = nil
+							}
+						}
+						tracing.End(span, err)
+						if err != nil && io.ContinueOnError {
+							slog.Warn("could not push image. continuing with the other images", slog.String("image", name), slog.String("registry", reg.URL), slog.String("error", err.Error()))
+							src, _ := i.String()
+							mu.Lock()
+							failures = append(failures, Failure{Image: src, Registry: reg.URL, Err: err})
+							mu.Unlock()
+							failed = true
+							continue
 						}
-						manifest, err := reg.Push(egCtx, i.Registry, name, i.Tag, io.Architecture)
 						if err != nil {
-							return err
+							return fmt.Errorf("registry: error pushing image %s to registry %s :: %w", name, reg.URL, err)
 						}
-						i.Digest = manifest.Digest.String()
+						copied = true
 					}
 				}
+				if !io.DryRun && io.Done != nil && !failed {
+					io.Done(i)
+				}
+				if !io.DryRun && io.Copied != nil && copied {
+					io.Copied(i)
+				}
 
 				_ = bar.Add(1)
 
@@ -79,7 +190,38 @@ func (io ImportOption) Run(ctx context.Context) error {
 
 	_ = bar.Finish()
 
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Image+failures[i].Registry < failures[j].Image+failures[j].Registry
+		})
+		return &FailedError{Failures: failures}
+	}
+
 	slog.Debug("all images have been pushed to registries")
 
 	return nil
 }
+
+// copy copies the image to the registry, retrying failed copies
+func (io ImportOption) copy(ctx context.Context, reg Registry, i *Image, name string, ref string) error {
+	return withRetry(ctx, io.Retries, io.Backoff, func() error {
+		push := reg.Push
+		if io.Architecture == nil && len(io.Platforms) > 0 {
+			push = func(ctx context.Context, sourceURL string, name string, tag string, _ *string) (v1.Descriptor, error) {
+				return reg.PushPlatforms(ctx, sourceURL, name, tag, io.Platforms)
+			}
+		}
+		manifest, err := push(ctx, i.Registry, name, ref, io.Architecture)
+		if err != nil {
+			return err
+		}
+		i.Digest = manifest.Digest.String()
+		// copies of the whole index include the referrers, unless converted for strict registries
+		if io.Referrers && (io.Architecture != nil || len(io.Platforms) > 0 || reg.Strict) {
+			if _, err := reg.CopyReferrers(ctx, i.Registry, name, ref); err != nil {
+				return fmt.Errorf("registry: error copying referrers of image %s :: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
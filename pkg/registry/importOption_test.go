@@ -0,0 +1,97 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestImportContinueOnError(t *testing.T) {
+	// nothing listens on port 1, so every copy fails
+	imgs := []*Image{
+		{Registry: "127.0.0.1:1", Repository: "library/nginx", Tag: "1.25"},
+		{Registry: "127.0.0.1:1", Repository: "library/redis", Tag: "7.2"},
+	}
+	done := 0
+	io := ImportOption{
+		Imgs:            imgs,
+		Registries:      []Registry{{Name: "target", URL: "127.0.0.1:1", PlainHTTP: true}},
+		ContinueOnError: true,
+		Done:            func(*Image) { done++ },
+	}
+
+	err := io.Run(context.Background())
+	var fe *FailedError
+	if !errors.As(err, &fe) {
+		t.Fatalf("want *FailedError got %v", err)
+	}
+	if len(fe.Failures) != 2 || fe.Failures[0].Image != "127.0.0.1:1/library/nginx:1.25" || fe.Failures[0].Registry != "127.0.0.1:1" {
+		t.Errorf("unexpected failures %+v", fe.Failures)
+	}
+	if done != 0 {
+		t.Errorf("want no images done got %d", done)
+	}
+
+	io.ContinueOnError = false
+	if err := io.Run(context.Background()); err == nil || errors.As(err, &fe) {
+		t.Errorf("want the first error got %v", err)
+	}
+}
+
+func TestImportFallback(t *testing.T) {
+	source := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer source.Close()
+	fallback := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer fallback.Close()
+	// sources on localhost are pulled with plain HTTP
+	sourceHost := strings.Replace(strings.TrimPrefix(source.URL, "http://"), "127.0.0.1", "localhost", 1)
+	fallbackHost := strings.TrimPrefix(fallback.URL, "http://")
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(sourceHost+"/library/nginx:1.25", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing listens on port 1, so every copy to the registry fails
+	fs := []Fallback{}
+	done := 0
+	err = ImportOption{
+		Imgs: []*Image{{Registry: sourceHost, Repository: "library/nginx", Tag: "1.25"}},
+		Registries: []Registry{{
+			Name: "target", URL: "127.0.0.1:1", PlainHTTP: true,
+			Fallback: &Registry{Name: "target-fallback", URL: fallbackHost, PlainHTTP: true},
+		}},
+		Done:       func(*Image) { done++ },
+		OnFallback: func(f Fallback) { fs = append(fs, f) },
+	}.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs) != 1 || fs[0].Registry != "127.0.0.1:1" || fs[0].Fallback != fallbackHost || fs[0].Err == nil {
+		t.Errorf("unexpected fallbacks %+v", fs)
+	}
+	if done != 0 {
+		t.Errorf("want the image not done, so the next run pushes it to the registry, got %d", done)
+	}
+
+	r := Registry{URL: fallbackHost, PlainHTTP: true}
+	if ok, err := r.Exist(context.Background(), "library/nginx", "1.25"); err != nil || !ok {
+		t.Errorf("want the image in the fallback registry got %t, %v", ok, err)
+	}
+}
@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+)
+
+// Lineage is the probable base image of an image
+type Lineage struct {
+	// Base is the base image, e.g. 'alpine:3.19'. Empty if it could not be inferred
+	Base string
+	// Source is how the base image was inferred: 'annotation', 'label', 'history', 'os' or 'shared layers'
+	Source string
+	// BaseLayer is the digest of the bottom layer of the image, shared by images built on the same base image
+	BaseLayer string
+}
+
+// baseName drops the default Docker Hub prefixes, so 'docker.io/library/alpine:3.19' is reported as 'alpine:3.19'
+func baseName(ref string) string {
+	ref = strings.TrimPrefix(ref, "docker.io/")
+	return strings.TrimPrefix(ref, "library/")
+}
+
+// InferBase infers the base image from the annotations of the image manifest and the image config.
+// It returns the base image and how it was inferred, or empty strings if the image does not reveal its base
+func InferBase(annotations map[string]string, config v1.Image) (string, string) {
+	if b := annotations[v1.AnnotationBaseImageName]; b != "" {
+		return baseName(b), "annotation"
+	}
+
+	labels := config.Config.Labels
+	if b := labels[v1.AnnotationBaseImageName]; b != "" {
+		return baseName(b), "label"
+	}
+	// Red Hat Universal Base Images label themselves, and the labels are inherited by images built on them
+	if c := labels["com.redhat.component"]; strings.HasPrefix(c, "ubi") && labels["name"] != "" {
+		b := labels["name"]
+		if v := labels["version"]; v != "" {
+			b = b + ":" + v
+		}
+		return b, "label"
+	}
+
+	for _, h := range config.History {
+		if strings.Contains(h.CreatedBy, "bazel build") {
+			return "distroless", "history"
+		}
+	}
+
+	return "", ""
+}
+
+// OSBase names the base image after the operating system detected by a scan, e.g. 'alpine:3.19' for Alpine 3.19.1
+func OSBase(family string, name string) string {
+	if family == "" {
+		return ""
+	}
+	if name == "" {
+		return family
+	}
+
+	parts := strings.Split(name, ".")
+	switch family {
+	case "alpine", "wolfi":
+		if len(parts) > 2 {
+			parts = parts[:2]
+		}
+	case "debian", "redhat", "centos", "rocky", "alma", "oracle", "amazon":
+		parts = parts[:1]
+	}
+	return family + ":" + strings.Join(parts, ".")
+}
+
+// ShareLineage lets images with an unknown base image inherit the base image of images with the same bottom layer
+func ShareLineage(ls map[string]Lineage) {
+	known := map[string]string{}
+	refs := make([]string, 0, len(ls))
+	for ref := range ls {
+		refs = append(refs, ref)
+	}
+	// deterministic when images on the same bottom layer report different base images
+	sort.Strings(refs)
+	for _, ref := range refs {
+		l := ls[ref]
+		if l.Base != "" && l.BaseLayer != "" {
+			if _, ok := known[l.BaseLayer]; !ok {
+				known[l.BaseLayer] = l.Base
+			}
+		}
+	}
+
+	for ref, l := range ls {
+		if l.Base != "" {
+			continue
+		}
+		if b, ok := known[l.BaseLayer]; ok {
+			l.Base = b
+			l.Source = "shared layers"
+			ls[ref] = l
+		}
+	}
+}
+
+// fetchJSON fetches the content of the descriptor and decodes it into v
+func fetchJSON(ctx context.Context, target content.Fetcher, desc v1.Descriptor, v any) error {
+	b, err := content.FetchAll(ctx, target, desc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// Lineage fetches the manifest and config of the image from its source registry and infers its base image.
+// Multi-platform images are resolved to the platform, or linux/amd64 if none is given
+func (i Image) Lineage(ctx context.Context, ss Sources, arch *string) (Lineage, error) {
+	name, err := i.ImageName()
+	if err != nil {
+		return Lineage{}, err
+	}
+	source, err := ss.Repository(i.Registry, name)
+	if err != nil {
+		return Lineage{}, err
+	}
+
+	ref := i.Tag
+	if i.UseDigest && i.Digest != "" {
+		ref = i.Digest
+	}
+
+	platform := "linux/amd64"
+	if arch != nil {
+		platform = *arch
+	}
+	p, err := parsePlatform(platform)
+	if err != nil {
+		return Lineage{}, err
+	}
+
+	desc, err := oras.Resolve(ctx, source, ref, oras.ResolveOptions{TargetPlatform: p})
+	if err != nil {
+		return Lineage{}, fmt.Errorf("registry: error resolving %s/%s:%s :: %w", i.Registry, name, ref, err)
+	}
+
+	var manifest v1.Manifest
+	if err := fetchJSON(ctx, source, desc, &manifest); err != nil {
+		return Lineage{}, fmt.Errorf("registry: error fetching manifest of %s/%s:%s :: %w", i.Registry, name, ref, err)
+	}
+	var config v1.Image
+	if err := fetchJSON(ctx, source, manifest.Config, &config); err != nil {
+		return Lineage{}, fmt.Errorf("registry: error fetching config of %s/%s:%s :: %w", i.Registry, name, ref, err)
+	}
+
+	l := Lineage{}
+	l.Base, l.Source = InferBase(manifest.Annotations, config)
+	if len(manifest.Layers) > 0 {
+		l.BaseLayer = manifest.Layers[0].Digest.String()
+	}
+	return l, nil
+}
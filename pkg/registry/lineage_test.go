@@ -0,0 +1,86 @@
+package registry
+
+import (
+	"testing"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestInferBase(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		config      v1.Image
+		base        string
+		source      string
+	}{
+		{
+			name:        "annotation",
+			annotations: map[string]string{v1.AnnotationBaseImageName: "docker.io/library/alpine:3.19"},
+			base:        "alpine:3.19",
+			source:      "annotation",
+		},
+		{
+			name:   "label",
+			config: v1.Image{Config: v1.ImageConfig{Labels: map[string]string{v1.AnnotationBaseImageName: "cgr.dev/chainguard/static:latest"}}},
+			base:   "cgr.dev/chainguard/static:latest",
+			source: "label",
+		},
+		{
+			name:   "ubi",
+			config: v1.Image{Config: v1.ImageConfig{Labels: map[string]string{"com.redhat.component": "ubi9-minimal-container", "name": "ubi9-minimal", "version": "9.4"}}},
+			base:   "ubi9-minimal:9.4",
+			source: "label",
+		},
+		{
+			name:   "distroless",
+			config: v1.Image{History: []v1.History{{CreatedBy: "bazel build //base:static_root_amd64_debian12"}}},
+			base:   "distroless",
+			source: "history",
+		},
+		{
+			name:   "unknown",
+			config: v1.Image{History: []v1.History{{CreatedBy: "/bin/sh -c #(nop) ADD file:0a1b2c in / "}}},
+		},
+	}
+	for _, tt := range tests {
+		base, source := InferBase(tt.annotations, tt.config)
+		if base != tt.base || source != tt.source {
+			t.Errorf("%s: want (%s, %s) got (%s, %s)", tt.name, tt.base, tt.source, base, source)
+		}
+	}
+}
+
+func TestOSBase(t *testing.T) {
+	tests := []struct {
+		family string
+		name   string
+		want   string
+	}{
+		{"alpine", "3.19.1", "alpine:3.19"},
+		{"debian", "12.5", "debian:12"},
+		{"ubuntu", "22.04", "ubuntu:22.04"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := OSBase(tt.family, tt.name); got != tt.want {
+			t.Errorf("%s %s: want %s got %s", tt.family, tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestShareLineage(t *testing.T) {
+	ls := map[string]Lineage{
+		"a": {Base: "alpine:3.19", Source: "os", BaseLayer: "sha256:1"},
+		"b": {BaseLayer: "sha256:1"},
+		"c": {BaseLayer: "sha256:2"},
+	}
+	ShareLineage(ls)
+
+	if ls["b"].Base != "alpine:3.19" || ls["b"].Source != "shared layers" {
+		t.Errorf("want b to share the base image of a, got %v", ls["b"])
+	}
+	if ls["c"].Base != "" {
+		t.Errorf("want c to have an unknown base image, got %v", ls["c"])
+	}
+}
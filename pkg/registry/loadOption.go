@@ -0,0 +1,71 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+)
+
+// LoadOption pushes the charts and images of a bundle to the registries
+type LoadOption struct {
+	Bundle     *Bundle
+	Registries []Registry
+	All        bool
+
+	// DryRun records the pushes in Plan instead of performing them
+	DryRun bool
+	Plan   *plan.Plan
+}
+
+func (lo LoadOption) Run(ctx context.Context) error {
+
+	refs, err := lo.Bundle.Refs(ctx)
+	if err != nil {
+		return fmt.Errorf("registry: error listing bundle %s :: %w", lo.Bundle.Path, err)
+	}
+
+	slog.Debug("loading bundle into registries..", slog.String("bundle", lo.Bundle.Path), slog.Int("artifacts", len(refs)))
+
+	bar := terminal.NewBar(len(refs), "Loading bundle...\r")
+
+	for _, ref := range refs {
+		name, tag, err := splitRef(ref)
+		if err != nil {
+			return err
+		}
+		status := Exists(ctx, name, tag, lo.Registries)
+
+		for _, r := range lo.Registries {
+			if !lo.All && status[r.URL] {
+				slog.Info("Artifact already present in registry. Skipping load", slog.String("artifact", ref), slog.String("registry", r.URL))
+				continue
+			}
+
+			if lo.DryRun {
+				lo.Plan.Add(plan.Action{
+					Kind:      plan.LoadArtifact,
+					Source:    fmt.Sprintf("%s:%s", lo.Bundle.Path, ref),
+					Target:    r.Ref(name, tag),
+					Insecure:  r.Insecure,
+					PlainHTTP: r.PlainHTTP,
+				})
+				continue
+			}
+
+			if _, err := lo.Bundle.Copy(ctx, ref, r); err != nil {
+				return fmt.Errorf("registry: error loading %s into registry %s :: %w", ref, r.URL, err)
+			}
+		}
+
+		_ = bar.Add(1)
+	}
+
+	_ = bar.Finish()
+
+	slog.Debug("bundle has been loaded into registries")
+
+	return nil
+}
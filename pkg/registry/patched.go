@@ -0,0 +1,65 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/distribution/reference"
+)
+
+// PatchedTag names the images patched by Copacetic in the registries. The zero value pushes them over the original tag
+type PatchedTag struct {
+	// Template of the tag, with the original tag as '{{ .Tag }}' and the date of the run as '{{ .Date }}' (YYYYMMDD), e.g. '{{ .Tag }}-patched'
+	Template string
+	// RepositorySuffix pushes the patched images to '<repository><suffix>' instead of the repository of the image, e.g. '-patched'
+	RepositorySuffix string
+	// Date stamps the tags
+	Date time.Time
+}
+
+// Renames reports whether patched images are pushed under another name than the image
+func (t PatchedTag) Renames() bool {
+	return t.Template != "" || t.RepositorySuffix != ""
+}
+
+// Tag returns the tag of the patched image of the tag
+func (t PatchedTag) Tag(tag string) (string, error) {
+	tag, _, _ = strings.Cut(tag, "@")
+	if t.Template == "" {
+		return tag, nil
+	}
+	tmpl, err := template.New("tag").Option("missingkey=error").Parse(t.Template)
+	if err != nil {
+		return "", fmt.Errorf("registry: error parsing patched tag template '%s' :: %w", t.Template, err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]string{"Tag": tag, "Date": t.Date.Format("20060102")}); err != nil {
+		return "", fmt.Errorf("registry: error rendering patched tag template '%s' :: %w", t.Template, err)
+	}
+	named, err := reference.ParseNormalizedNamed("helmper/patched")
+	if err != nil {
+		return "", err
+	}
+	if _, err := reference.WithTag(named, b.String()); err != nil {
+		return "", fmt.Errorf("registry: patched tag template '%s' renders '%s', which is not a valid tag :: %w", t.Template, b.String(), err)
+	}
+	return b.String(), nil
+}
+
+// Image returns the image as pushed when patched. The digest is the one of the image until the patched image is pushed
+func (t PatchedTag) Image(i Image) (Image, error) {
+	if !t.Renames() {
+		return i, nil
+	}
+	tag, err := t.Tag(i.Tag)
+	if err != nil {
+		return Image{}, err
+	}
+	original, _, _ := strings.Cut(i.Tag, "@")
+	i.Retagged = i.Retagged || tag != original
+	i.Tag = tag
+	i.Repository += t.RepositorySuffix
+	return i, nil
+}
@@ -0,0 +1,35 @@
+package registry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPatchedTag(t *testing.T) {
+	i := Image{Registry: "docker.io", Repository: "library/nginx", Tag: "1.27.0"}
+	date := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		tag      PatchedTag
+		want     Image
+		retagged bool
+	}{
+		{PatchedTag{}, i, false},
+		{PatchedTag{Template: "{{ .Tag }}-patched"}, Image{Registry: "docker.io", Repository: "library/nginx", Tag: "1.27.0-patched"}, true},
+		{PatchedTag{Template: "{{ .Tag }}-{{ .Date }}", Date: date}, Image{Registry: "docker.io", Repository: "library/nginx", Tag: "1.27.0-20240801"}, true},
+		{PatchedTag{RepositorySuffix: "-patched"}, Image{Registry: "docker.io", Repository: "library/nginx-patched", Tag: "1.27.0"}, false},
+	}
+	for _, tt := range tests {
+		got, err := tt.tag.Image(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Repository != tt.want.Repository || got.Tag != tt.want.Tag || got.Retagged != tt.retagged {
+			t.Errorf("%+v: want %s:%s (retagged %v) got %s:%s (retagged %v)", tt.tag, tt.want.Repository, tt.want.Tag, tt.retagged, got.Repository, got.Tag, got.Retagged)
+		}
+	}
+
+	if _, err := (PatchedTag{Template: "{{ .Version }}"}).Tag("1.27.0"); err == nil {
+		t.Error("want error for an unknown template value")
+	}
+}
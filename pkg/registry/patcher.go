@@ -0,0 +1,13 @@
+package registry
+
+import "context"
+
+// Patcher patches the OS packages of images and pushes the patched images to the registries.
+// Copacetic is the default implementation, see copa.PatchOption.
+type Patcher interface {
+	// SupportsOS reports whether images of the OS family and version, e.g. 'debian' and '12.5', can be patched. The family is empty if it could not be detected
+	SupportsOS(family string, version string) bool
+	// Patch patches the images using their vulnerability reports, pushes them to the registries and sets their digest.
+	// Patchers may write the patched images to the output paths, which are removed with the other output files.
+	Patch(ctx context.Context, imgs []*Image, reports map[*Image]string, outputs map[*Image]string) error
+}
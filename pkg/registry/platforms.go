@@ -0,0 +1,231 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+)
+
+const (
+	// mediaTypeDockerManifestList is the Docker equivalent of an OCI image index
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	// annotations of the attestation manifests BuildKit adds to image indexes
+	annotationReferenceType   = "vnd.docker.reference.type"
+	annotationReferenceDigest = "vnd.docker.reference.digest"
+)
+
+// matchPlatform reports whether the platform of the manifest is the wanted platform. The variant is only compared if wanted
+func matchPlatform(p *v1.Platform, want *v1.Platform) bool {
+	if p == nil {
+		return false
+	}
+	return p.OS == want.OS && p.Architecture == want.Architecture && (want.Variant == "" || p.Variant == want.Variant)
+}
+
+// selectPlatforms returns the manifests of an index for the platforms, and the attestation manifests referencing them
+func selectPlatforms(ms []v1.Descriptor, platforms []*v1.Platform) []v1.Descriptor {
+	selected := map[string]bool{}
+	res := []v1.Descriptor{}
+	for _, m := range ms {
+		for _, p := range platforms {
+			if matchPlatform(m.Platform, p) {
+				selected[m.Digest.String()] = true
+				res = append(res, m)
+				break
+			}
+		}
+	}
+	for _, m := range ms {
+		if m.Annotations[annotationReferenceType] == "attestation-manifest" && selected[m.Annotations[annotationReferenceDigest]] {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// PushPlatforms copies the platforms of a multi-arch image to the registry as a new index, e.g. 'linux/amd64' and 'linux/arm64'.
+// Images without an index are copied as they are. Strict registries get the new index and its manifests converted to OCI media types
+func (r Registry) PushPlatforms(ctx context.Context, sourceURL string, name string, tag string, platforms []string) (v1.Descriptor, error) {
+	ps := make([]*v1.Platform, 0, len(platforms))
+	for _, s := range platforms {
+		p, err := parsePlatform(s)
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		ps = append(ps, p)
+	}
+
+	repo, err := r.Sources.Repository(sourceURL, name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	source, err := r.cached(repo)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	target, err := r.Repository(name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := r.EnsureRepository(ctx, name); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	// Copy by digest when the image is pinned ('tag@digest'), but keep the tag in the target
+	srcRef, dstRef := tag, tag
+	if t, d, ok := strings.Cut(tag, "@"); ok {
+		srcRef, dstRef = d, t
+	}
+
+	root, err := source.Resolve(ctx, srcRef)
+	if err != nil {
+		return v1.Descriptor{}, redHatAuthError(sourceURL, err)
+	}
+	if root.MediaType != v1.MediaTypeImageIndex && root.MediaType != mediaTypeDockerManifestList {
+		if r.Strict {
+			return r.pushStrict(ctx, source, sourceURL, srcRef, target, dstRef, oras.DefaultCopyOptions)
+		}
+		return oras.Copy(ctx, source, srcRef, target, dstRef, oras.DefaultCopyOptions)
+	}
+
+	b, err := content.FetchAll(ctx, source, root)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	idx := v1.Index{}
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return v1.Descriptor{}, fmt.Errorf("registry: error reading index of %s/%s:%s :: %w", sourceURL, name, tag, err)
+	}
+	idx.Manifests = selectPlatforms(idx.Manifests, ps)
+	if len(idx.Manifests) == 0 {
+		return v1.Descriptor{}, fmt.Errorf("registry: image %s/%s:%s has none of the platforms %s", sourceURL, name, tag, strings.Join(platforms, ", "))
+	}
+	idx.Annotations = annotate(idx.Annotations)
+
+	// strict registries get the converted index, so the platforms are staged first
+	var dst oras.Target = target
+	if r.Strict {
+		store, done, err := stage()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		defer done()
+		dst = store
+	}
+	for _, m := range idx.Manifests {
+		if err := oras.CopyGraph(ctx, source, dst, m, oras.DefaultCopyGraphOptions); err != nil {
+			return v1.Descriptor{}, err
+		}
+	}
+
+	b, err = json.Marshal(idx)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc := content.NewDescriptorFromBytes(root.MediaType, b)
+	if r.Strict {
+		if err := dst.Push(ctx, desc, bytes.NewReader(b)); err != nil {
+			return v1.Descriptor{}, err
+		}
+		return r.pushConverted(ctx, dst, desc, target, dstRef)
+	}
+	if err := target.PushReference(ctx, desc, bytes.NewReader(b), dstRef); err != nil {
+		return v1.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// formatPlatform formats a platform like 'linux/arm64/v8'
+func formatPlatform(p *v1.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// indexPlatforms returns the wanted platforms of the images in the index, without attestation manifests
+func indexPlatforms(idx v1.Index, wanted []*v1.Platform) []string {
+	res := []string{}
+	for _, m := range selectPlatforms(idx.Manifests, wanted) {
+		if m.Annotations[annotationReferenceType] == "attestation-manifest" {
+			continue
+		}
+		res = append(res, formatPlatform(m.Platform))
+	}
+	return res
+}
+
+// SourcePlatforms returns the platforms of the multi-arch image among the wanted platforms, e.g. 'linux/arm64'. Images without an index have no platforms
+func SourcePlatforms(ctx context.Context, ss Sources, i Image, wanted []string) ([]string, error) {
+	ps := make([]*v1.Platform, 0, len(wanted))
+	for _, s := range wanted {
+		p, err := parsePlatform(s)
+		if err != nil {
+			return nil, err
+		}
+		ps = append(ps, p)
+	}
+
+	name, err := i.ImageName()
+	if err != nil {
+		return nil, err
+	}
+	source, err := ss.Repository(i.Registry, name)
+	if err != nil {
+		return nil, err
+	}
+	ref, _, _ := strings.Cut(i.Tag, "@")
+	if i.UseDigest && i.Digest != "" {
+		ref = i.Digest
+	}
+	root, err := source.Resolve(ctx, ref)
+	if err != nil {
+		return nil, redHatAuthError(i.Registry, err)
+	}
+	if root.MediaType != v1.MediaTypeImageIndex && root.MediaType != mediaTypeDockerManifestList {
+		return nil, nil
+	}
+
+	b, err := content.FetchAll(ctx, source, root)
+	if err != nil {
+		return nil, err
+	}
+	idx := v1.Index{}
+	if err := json.Unmarshal(b, &idx); err != nil {
+		return nil, fmt.Errorf("registry: error reading index of %s/%s:%s :: %w", i.Registry, name, ref, err)
+	}
+	return indexPlatforms(idx, ps), nil
+}
+
+// PushIndex pushes an index of the manifests to the repository the named repository is mirrored to with the tag, assembling a
+// multi-arch image from images pushed for each platform
+func (r Registry) PushIndex(ctx context.Context, name string, tag string, manifests []v1.Descriptor) (v1.Descriptor, error) {
+	target, err := r.Repository(name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	idx := v1.Index{
+		Versioned:   specs.Versioned{SchemaVersion: 2},
+		MediaType:   v1.MediaTypeImageIndex,
+		Manifests:   manifests,
+		Annotations: annotate(nil),
+	}
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc := content.NewDescriptorFromBytes(v1.MediaTypeImageIndex, b)
+	if err := target.PushReference(ctx, desc, bytes.NewReader(b), tag); err != nil {
+		return v1.Descriptor{}, fmt.Errorf("registry: error pushing index %s/%s:%s :: %w", r.URL, r.Target(name), tag, err)
+	}
+	return desc, nil
+}
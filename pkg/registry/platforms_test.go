@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestSelectPlatforms(t *testing.T) {
+	manifest := func(d string, os string, arch string, variant string) v1.Descriptor {
+		return v1.Descriptor{Digest: digest.Digest("sha256:" + d), Platform: &v1.Platform{OS: os, Architecture: arch, Variant: variant}}
+	}
+	amd64 := manifest("a", "linux", "amd64", "")
+	arm64 := manifest("b", "linux", "arm64", "v8")
+	armv7 := manifest("c", "linux", "arm", "v7")
+	attestation := manifest("d", "unknown", "unknown", "")
+	attestation.Annotations = map[string]string{annotationReferenceType: "attestation-manifest", annotationReferenceDigest: "sha256:a"}
+	other := manifest("e", "unknown", "unknown", "")
+	other.Annotations = map[string]string{annotationReferenceType: "attestation-manifest", annotationReferenceDigest: "sha256:c"}
+	ms := []v1.Descriptor{amd64, arm64, armv7, attestation, other}
+
+	amd64P, _ := parsePlatform("linux/amd64")
+	arm64P, _ := parsePlatform("linux/arm64")
+	want := []v1.Descriptor{amd64, arm64, attestation}
+	if got := selectPlatforms(ms, []*v1.Platform{amd64P, arm64P}); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+
+	armv6P, _ := parsePlatform("linux/arm/v6")
+	if got := selectPlatforms(ms, []*v1.Platform{armv6P}); len(got) != 0 {
+		t.Errorf("want no manifests got %v", got)
+	}
+}
+
+func TestIndexPlatforms(t *testing.T) {
+	idx := v1.Index{Manifests: []v1.Descriptor{
+		{Digest: "sha256:a", Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		{Digest: "sha256:b", Platform: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{Digest: "sha256:c", Platform: &v1.Platform{OS: "linux", Architecture: "s390x"}},
+		{Digest: "sha256:d", Platform: &v1.Platform{OS: "unknown", Architecture: "unknown"}, Annotations: map[string]string{annotationReferenceType: "attestation-manifest", annotationReferenceDigest: "sha256:a"}},
+	}}
+	amd64, _ := parsePlatform("linux/amd64")
+	arm64, _ := parsePlatform("linux/arm64")
+	ppc64le, _ := parsePlatform("linux/ppc64le")
+
+	want := []string{"linux/amd64", "linux/arm64/v8"}
+	if got := indexPlatforms(idx, []*v1.Platform{amd64, arm64, ppc64le}); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// Quay manages the robot accounts of a Quay organization, allowed to pull from repositories of the organization
+type Quay struct {
+	Registry Registry
+	// URL is the base URL of the Quay API. Defaults to the host of the registry
+	URL string
+	// Organization owning the repositories and the robot accounts
+	Organization string
+	// Token is an OAuth access token of the organization with the 'Administer Organization' and 'Administer Repositories' scopes.
+	// Environment variables are expanded
+	Token string
+}
+
+// errQuayNotFound is returned for missing Quay resources
+var errQuayNotFound = errors.New("not found")
+
+type quayRobot struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+}
+
+func (q Quay) baseURL() string {
+	if q.URL != "" {
+		return strings.TrimSuffix(q.URL, "/")
+	}
+	return "https://" + q.Registry.Host()
+}
+
+// do sends the request to the Quay API, decoding the response into out if set
+func (q Quay) do(ctx context.Context, method string, p string, in any, out any) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, q.baseURL()+"/api/v1"+p, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+os.ExpandEnv(q.Token))
+
+	client, err := q.Registry.HTTPClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errQuayNotFound
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s failed with status %s: %s", method, p, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// PullRobot creates the robot account of the organization with the name if it is missing, grants it read access to the named
+// repositories, and returns its credential. Quay returns the token of existing robot accounts, so the token is not rotated
+func (q Quay) PullRobot(ctx context.Context, name string, names []string) (auth.Credential, error) {
+	org := url.PathEscape(q.Organization)
+	robotPath := "/organization/" + org + "/robots/" + url.PathEscape(name)
+
+	var robot quayRobot
+	err := q.do(ctx, http.MethodGet, robotPath, nil, &robot)
+	if errors.Is(err, errQuayNotFound) {
+		err = q.do(ctx, http.MethodPut, robotPath, map[string]string{"description": "Managed by helmper"}, &robot)
+		if err == nil {
+			slog.Info("created Quay robot account", slog.String("registry", q.Registry.Host()), slog.String("robot", robot.Name))
+		}
+	}
+	if err != nil {
+		return auth.EmptyCredential, fmt.Errorf("registry: error ensuring Quay robot account %s :: %w", name, err)
+	}
+
+	repos := map[string]bool{}
+	for _, n := range names {
+		repo := q.Registry.repositoryPath(n)
+		owner, rest, ok := strings.Cut(repo, "/")
+		if !ok || owner != q.Organization {
+			return auth.EmptyCredential, fmt.Errorf("registry: repository %s is not in the Quay organization %s", repo, q.Organization)
+		}
+		if repos[rest] {
+			continue
+		}
+		repos[rest] = true
+		p := fmt.Sprintf("/repository/%s/%s/permissions/user/%s", org, rest, url.PathEscape(robot.Name))
+		if err := q.do(ctx, http.MethodPut, p, map[string]string{"role": "read"}, nil); err != nil {
+			return auth.EmptyCredential, fmt.Errorf("registry: error granting Quay robot account %s read access to %s :: %w", robot.Name, repo, err)
+		}
+	}
+	slog.Info("updated Quay robot account", slog.String("registry", q.Registry.Host()), slog.String("robot", robot.Name), slog.Int("repositories", len(repos)))
+	return auth.Credential{Username: robot.Name, Password: robot.Token}, nil
+}
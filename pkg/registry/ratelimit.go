@@ -0,0 +1,225 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+const (
+	// quotaRetries is how often a request is retried when the pull quota of the registry is exhausted
+	quotaRetries = 5
+	// maxQuotaWait caps the wait between the retries
+	maxQuotaWait = 5 * time.Minute
+)
+
+// quotaBackoff is the wait before the first retry of a request exceeding the pull quota, unless the registry sends Retry-After
+var quotaBackoff = 30 * time.Second
+
+// quotaPolicy retries failed requests like the default policy of the retry transport, except for exceeded pull quotas. These are
+// retried by limited with the backoff of the registry, as the transport is retried above limited
+var quotaPolicy retry.Policy = &retry.GenericPolicy{
+	Retryable: func(resp *http.Response, err error) (bool, error) {
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			return false, nil
+		}
+		return retry.DefaultPredicate(resp, err)
+	},
+	Backoff:  retry.DefaultBackoff,
+	MinWait:  200 * time.Millisecond,
+	MaxWait:  3 * time.Second,
+	MaxRetry: 5,
+}
+
+// quota throttles the requests to a registry. The quota of a registry is shared by its clients, and by the scans and patches
+// pulling from the registry outside of them, see Sources.Throttle
+type quota struct {
+	// limiter limits the requests per second. Nil is unlimited
+	limiter *rate.Limiter
+	// slots limits the requests in flight, until their response bodies are closed. Nil is unlimited
+	slots chan struct{}
+	// warned is set once the quota of the registry is almost exhausted
+	warned atomic.Bool
+}
+
+type quotaKey struct {
+	host        string
+	rps         float64
+	concurrency int
+}
+
+// quotas are the quotas by registry and limits
+var quotas sync.Map
+
+func quotaOf(host string, rps float64, concurrency int) *quota {
+	k := quotaKey{host: host, rps: rps, concurrency: concurrency}
+	if q, ok := quotas.Load(k); ok {
+		return q.(*quota)
+	}
+	q := &quota{}
+	if rps > 0 {
+		q.limiter = rate.NewLimiter(rate.Limit(rps), 1)
+	}
+	if concurrency > 0 {
+		q.slots = make(chan struct{}, concurrency)
+	}
+	v, _ := quotas.LoadOrStore(k, q)
+	return v.(*quota)
+}
+
+// acquire takes one of the requests in flight of the quota. The returned func releases it
+func (q *quota) acquire(ctx context.Context) (func(), error) {
+	if q.slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-q.slots }) }, nil
+}
+
+// wait waits for the rate limit of the quota
+func (q *quota) wait(ctx context.Context) error {
+	if q.limiter == nil {
+		return nil
+	}
+	return q.limiter.Wait(ctx)
+}
+
+// Throttle waits for the rate limit of the source registry, and takes one of its concurrent pulls until release is called.
+// It throttles the pulls of clients connecting to the registry themselves, e.g. Trivy and Buildkit
+func (ss Sources) Throttle(ctx context.Context, host string) (release func(), err error) {
+	s := ss.For(host)
+	if s.RequestsPerSecond <= 0 && s.ConcurrentPulls <= 0 {
+		return func() {}, nil
+	}
+	q := quotaOf(s.Host, s.RequestsPerSecond, s.ConcurrentPulls)
+	release, err = q.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := q.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// limited throttles the requests to a registry, and backs off when the pull quota of the registry is exhausted, e.g. the Docker Hub rate limit
+type limited struct {
+	host string
+	base http.RoundTripper
+	*quota
+}
+
+func newLimited(host string, base http.RoundTripper, rps float64, concurrency int) *limited {
+	return &limited{host: host, base: base, quota: quotaOf(host, rps, concurrency)}
+}
+
+func (l *limited) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := l.wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+		resp, err := l.base.RoundTrip(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		l.observe(resp)
+
+		rewind := req.Body == nil || req.GetBody != nil
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= quotaRetries || !rewind {
+			resp.Body = releaser{ReadCloser: resp.Body, release: release}
+			return resp, nil
+		}
+
+		wait := quotaWait(attempt, resp)
+		slog.Warn("pull quota of registry exceeded. backing off..", slog.String("registry", l.host), slog.Duration("wait", wait), slog.Int("attempt", attempt+1))
+		resp.Body.Close()
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				release()
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// observe logs the pull quota the registry reports, and warns once when it is almost exhausted
+func (l *limited) observe(resp *http.Response) {
+	remaining, window, ok := parseQuota(resp.Header.Get("RateLimit-Remaining"))
+	if !ok {
+		return
+	}
+	limit, _, _ := parseQuota(resp.Header.Get("RateLimit-Limit"))
+	slog.Debug("pull quota of registry", slog.String("registry", l.host), slog.Int("remaining", remaining), slog.Int("limit", limit), slog.Duration("window", window))
+	if limit > 0 && remaining <= limit/10 && !l.warned.Swap(true) {
+		slog.Warn("pull quota of registry is almost exhausted. Authenticate or lower the rate limit of the source registry to avoid failed pulls",
+			slog.String("registry", l.host), slog.Int("remaining", remaining), slog.Int("limit", limit), slog.Duration("window", window))
+	}
+}
+
+// parseQuota parses a rate limit header like '76;w=21600', the number of pulls in a window of seconds
+func parseQuota(v string) (int, time.Duration, bool) {
+	count, params, _ := strings.Cut(v, ";")
+	n, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil {
+		return 0, 0, false
+	}
+	var window time.Duration
+	if w, ok := strings.CutPrefix(strings.TrimSpace(params), "w="); ok {
+		if s, err := strconv.Atoi(w); err == nil {
+			window = time.Duration(s) * time.Second
+		}
+	}
+	return n, window, true
+}
+
+// quotaWait is the wait before retrying a request exceeding the pull quota: Retry-After if sent, else doubling from quotaBackoff
+func quotaWait(attempt int, resp *http.Response) time.Duration {
+	wait := quotaBackoff << attempt
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+		wait = time.Duration(s) * time.Second
+	}
+	return min(wait, maxQuotaWait)
+}
+
+// releaser releases the slot of a request when its response body is closed
+type releaser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r releaser) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseQuota(t *testing.T) {
+	tests := []struct {
+		header string
+		n      int
+		window time.Duration
+		ok     bool
+	}{
+		{"76;w=21600", 76, 6 * time.Hour, true},
+		{"100", 100, 0, true},
+		{"", 0, 0, false},
+		{"many;w=60", 0, 0, false},
+	}
+	for _, tt := range tests {
+		n, window, ok := parseQuota(tt.header)
+		if n != tt.n || window != tt.window || ok != tt.ok {
+			t.Errorf("%q: want %d %s %v, got %d %s %v", tt.header, tt.n, tt.window, tt.ok, n, window, ok)
+		}
+	}
+}
+
+func TestLimitedBacksOff(t *testing.T) {
+	quotaBackoff = time.Millisecond
+	defer func() { quotaBackoff = 30 * time.Second }()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", "0;w=21600")
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	l := newLimited("docker.io", http.DefaultTransport, 0, 1)
+	c := &http.Client{Transport: l}
+	for range 2 {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("want the request retried until accepted, got %s", resp.Status)
+		}
+	}
+	if n := requests.Load(); n != 4 {
+		t.Errorf("want 4 requests, got %d", n)
+	}
+	if !l.warned.Load() {
+		t.Error("want a warning for the exhausted quota")
+	}
+}
+
+func TestQuotaWait(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	if got := quotaWait(1, resp); got != 2*quotaBackoff {
+		t.Errorf("want the backoff doubled, got %s", got)
+	}
+	if got := quotaWait(10, resp); got != maxQuotaWait {
+		t.Errorf("want the wait capped, got %s", got)
+	}
+	resp.Header.Set("Retry-After", "7")
+	if got := quotaWait(0, resp); got != 7*time.Second {
+		t.Errorf("want Retry-After, got %s", got)
+	}
+}
+
+func TestQuotaPolicy(t *testing.T) {
+	if d, _ := quotaPolicy.Retry(0, &http.Response{StatusCode: http.StatusTooManyRequests}, nil); d >= 0 {
+		t.Errorf("want exceeded quotas left to the limiter, got a retry after %s", d)
+	}
+	if d, _ := quotaPolicy.Retry(0, &http.Response{StatusCode: http.StatusBadGateway}, nil); d < 0 {
+		t.Error("want server errors retried")
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	ss := NewSources([]Source{{Host: "throttled.example.com", ConcurrentPulls: 1}})
+	release, err := ss.Throttle(context.Background(), "throttled.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := ss.Throttle(ctx, "throttled.example.com"); err == nil {
+		t.Error("want the second pull to wait for the first")
+	}
+
+	release()
+	release, err = ss.Throttle(context.Background(), "throttled.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+}
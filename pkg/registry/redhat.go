@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+)
+
+// Red Hat registries rebuild tags frequently, changing the digest a tag points to
+var redHatRegistries = []string{
+	"registry.redhat.io",
+	"registry.connect.redhat.com",
+	"registry.access.redhat.com",
+}
+
+func IsRedHat(host string) bool {
+	for _, r := range redHatRegistries {
+		if host == r {
+			return true
+		}
+	}
+	return false
+}
+
+// redHatAuthError adds a hint on terms-based authentication to unauthorized errors from registry.redhat.io
+func redHatAuthError(host string, err error) error {
+	var errResp *errcode.ErrorResponse
+	if IsRedHat(host) && errors.As(err, &errResp) && errResp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("registry: %s requires a Terms-Based Registry service account. Create one at https://access.redhat.com/terms-based-registry and log in with 'docker login %s' :: %w", host, host, err)
+	}
+	return err
+}
+
+// PinDigest pins images from Red Hat registries, or every image if all is set, to the digest their tag currently resolves to.
+// Images already pinned are checked to still exist upstream, as rebuilt tags can cause old digests to be removed.
+func PinDigest(ctx context.Context, ss Sources, i *Image, all bool) error {
+	if !all && !IsRedHat(i.Registry) {
+		return nil
+	}
+
+	ref := strings.Join([]string{i.Registry, i.Repository}, "/")
+
+	if i.Digest != "" {
+		_, err := Digest(ctx, ss, ref, i.Digest, false)
+		switch {
+		case errors.Is(err, errdef.ErrNotFound):
+			slog.Warn("pinned digest no longer exists upstream. The tag has likely been rebuilt",
+				slog.String("image", ref),
+				slog.String("tag", i.Tag),
+				slog.String("digest", i.Digest),
+			)
+		case err != nil:
+			return redHatAuthError(i.Registry, err)
+		}
+		i.UseDigest = true
+		return nil
+	}
+
+	if i.Tag == "" {
+		return nil
+	}
+
+	d, err := Digest(ctx, ss, ref, i.Tag, false)
+	if err != nil {
+		return redHatAuthError(i.Registry, err)
+	}
+
+	slog.Debug("pinned image to digest", slog.String("image", ref), slog.String("tag", i.Tag), slog.String("digest", d))
+	i.Digest = d
+	i.UseDigest = true
+
+	return nil
+}
@@ -0,0 +1,18 @@
+package registry
+
+import "testing"
+
+func TestIsRedHat(t *testing.T) {
+	for host, expected := range map[string]bool{
+		"registry.redhat.io":          true,
+		"registry.connect.redhat.com": true,
+		"registry.access.redhat.com":  true,
+		"quay.io":                     false,
+		"docker.io":                   false,
+	} {
+		actual := IsRedHat(host)
+		if actual != expected {
+			t.Errorf("want '%t' got '%t' for '%s'", expected, actual, host)
+		}
+	}
+}
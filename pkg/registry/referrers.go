@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+// cosignSuffixes are the suffixes of the tags cosign attaches signatures, attestations and SBOMs to images with,
+// when the registry does not support referrers
+var cosignSuffixes = []string{".sig", ".att", ".sbom"}
+
+// referrersTag is the tag of the index listing the referrers of the digest in registries without the referrers API, 'sha256-<hex>'
+func referrersTag(d digest.Digest) string {
+	return strings.Replace(d.String(), ":", "-", 1)
+}
+
+// cosignTags returns the tags cosign attaches artifacts of the digest to, e.g. 'sha256-<hex>.sig'
+func cosignTags(d digest.Digest) []string {
+	res := make([]string, 0, len(cosignSuffixes))
+	for _, s := range cosignSuffixes {
+		res = append(res, referrersTag(d)+s)
+	}
+	return res
+}
+
+// listReferrers makes sure the referrers of the subject are listed by the repository. Referrers missing from the referrers API,
+// or from the fallback tag of registries without the API, are added to the index of the fallback tag
+func listReferrers(ctx context.Context, repo *remote.Repository, subject v1.Descriptor, referrers []v1.Descriptor) error {
+	listed := map[digest.Digest]bool{}
+	err := repo.Referrers(ctx, subject, "", func(rs []v1.Descriptor) error {
+		for _, d := range rs {
+			listed[d.Digest] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	missing := slices.DeleteFunc(slices.Clone(referrers), func(d v1.Descriptor) bool { return listed[d.Digest] })
+	if len(missing) == 0 {
+		return nil
+	}
+
+	tag := referrersTag(subject.Digest)
+	idx := v1.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: v1.MediaTypeImageIndex}
+	desc, rc, err := repo.FetchReference(ctx, tag)
+	switch {
+	case err == nil:
+		b, err := content.ReadAll(rc, desc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(b, &idx); err != nil {
+			return fmt.Errorf("registry: error reading referrers index %s :: %w", tag, err)
+		}
+	case !errors.Is(err, errdef.ErrNotFound):
+		return err
+	}
+	for _, d := range missing {
+		if !slices.ContainsFunc(idx.Manifests, func(m v1.Descriptor) bool { return m.Digest == d.Digest }) {
+			idx.Manifests = append(idx.Manifests, d)
+		}
+	}
+
+	b, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	slog.Debug("updated referrers fallback tag", slog.String("tag", tag), slog.Int("referrers", len(idx.Manifests)))
+	return repo.PushReference(ctx, content.NewDescriptorFromBytes(v1.MediaTypeImageIndex, b), bytes.NewReader(b), tag)
+}
+
+// CopyReferrers copies the artifacts attached to the image in the source registry to the registry, e.g. cosign signatures,
+// SLSA provenance and SBOMs. Both OCI referrers and the tags cosign attaches artifacts with are copied.
+// The artifacts are listed by the digest of the image in the source, as the image in the registry may differ, e.g. when converted
+// or limited to platforms. It returns the number of artifacts copied
+func (r Registry) CopyReferrers(ctx context.Context, sourceURL string, name string, ref string) (int, error) {
+	source, err := r.Sources.Repository(sourceURL, name)
+	if err != nil {
+		return 0, err
+	}
+	target, err := r.Repository(name)
+	if err != nil {
+		return 0, err
+	}
+
+	// pinned images are referenced by digest, 'tag@digest'
+	if _, d, ok := strings.Cut(ref, "@"); ok {
+		ref = d
+	}
+	root, err := source.Resolve(ctx, ref)
+	if err != nil {
+		return 0, redHatAuthError(sourceURL, err)
+	}
+	referrers, err := source.Predecessors(ctx, root)
+	if err != nil {
+		return 0, redHatAuthError(sourceURL, err)
+	}
+
+	n := len(referrers)
+	opts := oras.DefaultExtendedCopyGraphOptions
+	// the image is copied by the import, and is not copied again as the subject of its referrers
+	opts.FindSuccessors = func(ctx context.Context, fetcher content.Fetcher, desc v1.Descriptor) ([]v1.Descriptor, error) {
+		ss, err := content.Successors(ctx, fetcher, desc)
+		return slices.DeleteFunc(ss, func(s v1.Descriptor) bool { return s.Digest == root.Digest }), err
+	}
+	// the referrers of the referrers, e.g. the signatures of an SBOM
+	opts.FindPredecessors = func(ctx context.Context, src content.ReadOnlyGraphStorage, desc v1.Descriptor) ([]v1.Descriptor, error) {
+		ps, err := src.Predecessors(ctx, desc)
+		n += len(ps)
+		return ps, err
+	}
+	for _, d := range referrers {
+		if err := oras.ExtendedCopyGraph(ctx, source, target, d, opts); err != nil {
+			return 0, redHatAuthError(sourceURL, err)
+		}
+	}
+
+	// strict registries are checked to list the referrers, as clients of the image discover them through the registry
+	if r.Strict {
+		if err := listReferrers(ctx, target, root, referrers); err != nil {
+			return n, fmt.Errorf("registry: error listing referrers of image %s :: %w", name, err)
+		}
+	}
+
+	// cosign artifacts attached by tag
+	for _, tag := range cosignTags(root.Digest) {
+		if _, err := source.Resolve(ctx, tag); err != nil {
+			if errors.Is(err, errdef.ErrNotFound) {
+				continue
+			}
+			return n, err
+		}
+		if _, err := oras.Copy(ctx, source, tag, target, tag, oras.DefaultCopyOptions); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	slog.Debug("copied referrers", slog.String("image", name), slog.String("digest", root.Digest.String()), slog.Int("artifacts", n))
+	return n, nil
+}
@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+)
+
+func TestCosignTags(t *testing.T) {
+	d := digest.Digest("sha256:9d4b0f6a3e1f")
+	want := []string{"sha256-9d4b0f6a3e1f.sig", "sha256-9d4b0f6a3e1f.att", "sha256-9d4b0f6a3e1f.sbom"}
+	if got := cosignTags(d); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestListReferrers(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer srv.Close()
+
+	r := Registry{URL: strings.TrimPrefix(srv.URL, "http://"), PlainHTTP: true}
+	repo, err := r.Repository("library/nginx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := oras.PushBytes(ctx, repo, v1.MediaTypeImageManifest, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signature is pushed without a subject, so the registry does not list it
+	sig, err := oras.PackManifest(ctx, repo, oras.PackManifestVersion1_1, "application/vnd.dev.cosign.artifact.sig.v1+json", oras.PackManifestOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if err := listReferrers(ctx, repo, subject, []v1.Descriptor{sig}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	desc, rc, err := repo.FetchReference(ctx, referrersTag(subject.Digest))
+	if err != nil {
+		t.Fatalf("want the referrers fallback tag :: %v", err)
+	}
+	defer rc.Close()
+	b, err := content.ReadAll(rc, desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx v1.Index
+	if err := json.Unmarshal(b, &idx); err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Manifests) != 1 || idx.Manifests[0].Digest != sig.Digest {
+		t.Errorf("want the signature listed once got %+v", idx.Manifests)
+	}
+}
@@ -2,16 +2,21 @@ package registry
 
 import (
 	"context"
+	"os"
+	"path"
+	"sort"
 	"strings"
 
+	"github.com/ChristofferNissen/helmper/pkg/version"
 	v1_spec "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/opencontainers/go-digest"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/content/oci"
 	"oras.land/oras-go/v2/registry/remote"
 	"oras.land/oras-go/v2/registry/remote/auth"
 	"oras.land/oras-go/v2/registry/remote/credentials"
-	"oras.land/oras-go/v2/registry/remote/retry"
 )
 
 type Registry struct {
@@ -19,6 +24,30 @@ type Registry struct {
 	URL       string
 	Insecure  bool
 	PlainHTTP bool
+	// Strict registries only accept OCI conformant content (e.g. Zot)
+	Strict bool
+	// Flatten drops the path of the source repositories of images, e.g. 'prometheus' for 'quay.io/prometheus/prometheus'. See Target
+	Flatten bool
+	// HarborProjects creates missing Harbor projects and checks their quota before pushes
+	HarborProjects HarborProjects
+	// Auth are the credentials for the registry. Empty uses the Docker and Helm credential stores
+	Auth Auth
+	// Fallback is the registry images are pushed to when pushes to the registry fail after the retries, e.g. during maintenance
+	Fallback *Registry
+	// ChartRepository is the classic chart repository the charts are uploaded to instead of the registry. Nil pushes the charts to the registry
+	ChartRepository *ChartRepository
+	// Route restricts the charts and images pushed to the registry
+	Route Route
+	// CAFile is a PEM bundle of certificate authorities trusted for the registry besides the system ones
+	CAFile string
+	// CertFile and KeyFile are the client certificate presented to registries requiring mutual TLS
+	CertFile string
+	KeyFile  string
+	// Sources are the settings of the registries the images are pulled from. Set by the pipeline from the source registries
+	Sources Sources
+	// BlobCache is the folder the layers and configs pulled from the source registries are kept in, so they are not downloaded
+	// again by later pulls and runs. Empty disables the cache
+	BlobCache string
 }
 
 type Exister interface {
@@ -45,72 +74,190 @@ func (r Registry) GetName() string {
 	return r.Name
 }
 
+// parsePlatform parses a platform like 'linux/amd64'
+func parsePlatform(arch string) (*v1.Platform, error) {
+	v, err := v1_spec.ParsePlatform(arch)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Platform{
+		Architecture: v.Architecture,
+		OS:           v.OS,
+		OSVersion:    v.OSVersion,
+		OSFeatures:   v.OSFeatures,
+		Variant:      v.Variant,
+	}, nil
+}
+
+// copyOptions limits the copy to the platform, if any
+func copyOptions(arch *string) (oras.CopyOptions, error) {
+	opts := oras.DefaultCopyOptions
+	if arch != nil {
+		p, err := parsePlatform(*arch)
+		if err != nil {
+			return oras.CopyOptions{}, err
+		}
+		opts.WithTargetPlatform(p)
+	}
+	return opts, nil
+}
+
 func (r Registry) Push(ctx context.Context, sourceURL string, name string, tag string, arch *string) (v1.Descriptor, error) {
 
-	// prepare authentication using Docker credentials
-	storeOpts := credentials.StoreOptions{}
-	credStore, err := credentials.NewStoreFromDocker(storeOpts)
+	// 1. Connect to a remote repository
+	source, err := r.Sources.Repository(sourceURL, name)
 	if err != nil {
 		return v1.Descriptor{}, err
 	}
 
-	// 1. Connect to a remote repository
-	ref := strings.Join([]string{sourceURL, name}, "/")
-	source, err := remote.NewRepository(ref)
+	// 3. Connect to our target repository
+	target, err := r.Repository(name)
 	if err != nil {
 		return v1.Descriptor{}, err
 	}
-	source.Client = &auth.Client{
-		Client:     retry.DefaultClient,
-		Cache:      auth.NewCache(),
-		Credential: credentials.Credential(credStore), // Use the credentials store
+	if err := r.EnsureRepository(ctx, name); err != nil {
+		return v1.Descriptor{}, err
 	}
-	// Determine HTTP or HTTPS. Allow HTTP if local reference
-	source.PlainHTTP = strings.Contains(sourceURL, "localhost") || strings.Contains(sourceURL, "0.0.0.0")
 
-	// 3. Connect to our target repository
-	image := strings.Join([]string{r.URL, name}, "/")
-	target, err := remote.NewRepository(image)
+	opts, err := copyOptions(arch)
 	if err != nil {
 		return v1.Descriptor{}, err
 	}
-	// prepare authentication using Docker credentials
-	target.Client = &auth.Client{
-		Client:     retry.DefaultClient,
-		Cache:      auth.NewCache(),
-		Credential: credentials.Credential(credStore), // Use the credentials store
+
+	// Copy by digest when the image is pinned ('tag@digest'), but keep the tag in the target
+	srcRef, dstRef := tag, tag
+	if t, d, ok := strings.Cut(tag, "@"); ok {
+		srcRef, dstRef = d, t
 	}
-	// todo: check if user specified auth
-	target.PlainHTTP = r.PlainHTTP
 
-	opts := oras.DefaultCopyOptions
-	if arch != nil {
-		v, err := v1_spec.ParsePlatform(*arch)
+	src, err := r.cached(source)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	if r.Strict {
+		return r.pushStrict(ctx, src, sourceURL, srcRef, target, dstRef, opts)
+	}
+
+	// without a platform, the whole index is copied with the referrers of the image, e.g. signatures and SBOMs
+	if arch == nil {
+		manifest, err := oras.ExtendedCopy(ctx, src, srcRef, target, dstRef, oras.DefaultExtendedCopyOptions)
 		if err != nil {
-			return v1.Descriptor{}, err
+			return v1.Descriptor{}, redHatAuthError(sourceURL, err)
 		}
-		opts.WithTargetPlatform(
-			&v1.Platform{
-				Architecture: v.Architecture,
-				OS:           v.OS,
-				OSVersion:    v.OSVersion,
-				OSFeatures:   v.OSFeatures,
-				Variant:      v.Variant,
-			},
-		)
+		return manifest, nil
 	}
 
-	manifest, err := oras.Copy(ctx, source, tag, target, tag, opts)
+	manifest, err := oras.Copy(ctx, src, srcRef, target, dstRef, opts)
+	if err != nil {
+		return v1.Descriptor{}, redHatAuthError(sourceURL, err)
+	}
+
+	return manifest, nil
+}
+
+// stage opens a temporary OCI layout the images are converted in before they are pushed to strict registries, so large images
+// are not held in memory. The returned func removes the layout
+func stage() (*oci.Store, func(), error) {
+	dir, err := os.MkdirTemp("", "helmper-strict")
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := oci.New(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	return store, func() { os.RemoveAll(dir) }, nil
+}
+
+// pushStrict converts docker media types to OCI before pushing, and validates the result in the target registry
+func (r Registry) pushStrict(ctx context.Context, source oras.ReadOnlyTarget, sourceURL string, srcRef string, target *remote.Repository, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+	store, done, err := stage()
 	if err != nil {
 		return v1.Descriptor{}, err
 	}
+	defer done()
+
+	desc, err := oras.Copy(ctx, source, srcRef, store, dstRef, opts)
+	if err != nil {
+		return v1.Descriptor{}, redHatAuthError(sourceURL, err)
+	}
+	return r.pushConverted(ctx, store, desc, target, dstRef)
+}
+
+// pushConverted converts the staged image to OCI media types, pushes it to the target and validates the result in the target registry
+func (r Registry) pushConverted(ctx context.Context, store oras.Target, desc v1.Descriptor, target *remote.Repository, dstRef string) (v1.Descriptor, error) {
+	desc, err := convertToOCI(ctx, store, desc)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := store.Tag(ctx, desc, dstRef); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	manifest, err := oras.Copy(ctx, store, dstRef, target, dstRef, oras.DefaultCopyOptions)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	if err := r.Validate(ctx, target.Reference.Repository, dstRef); err != nil {
+		return v1.Descriptor{}, err
+	}
 
 	return manifest, nil
 }
 
-func (r Registry) Fetch(ctx context.Context, name string, tag string) (*v1.Descriptor, error) {
-	// 1. Connect to a remote repository
-	ref := strings.Join([]string{r.URL, name}, "/")
+// Target returns the repository the named repository is mirrored to in the registry. Flattened registries drop the path
+// of image repositories, e.g. 'prometheus' for 'prometheus/prometheus'. The charts and artifacts of Helmper keep their repositories
+func (r Registry) Target(name string) string {
+	if !r.Flatten || strings.HasPrefix(name, "charts/") || strings.HasPrefix(name, "helmper/") {
+		return name
+	}
+	return path.Base(name)
+}
+
+// Collisions returns the repositories in the registry that more than one source repository of the images is mirrored to,
+// with the source repositories. Only flattened registries have collisions
+func (r Registry) Collisions(imgs []Image) map[string][]string {
+	sources := map[string]map[string]bool{}
+	for _, i := range imgs {
+		name, err := i.ImageName()
+		if err != nil {
+			continue
+		}
+		t := r.Target(name)
+		if sources[t] == nil {
+			sources[t] = map[string]bool{}
+		}
+		sources[t][i.Registry+"/"+name] = true
+	}
+
+	res := map[string][]string{}
+	for t, m := range sources {
+		if len(m) < 2 {
+			continue
+		}
+		for s := range m {
+			res[t] = append(res[t], s)
+		}
+		sort.Strings(res[t])
+	}
+	return res
+}
+
+// Ref references the named repository in the registry by tag, or by digest if the reference is a digest
+func (r Registry) Ref(name string, reference string) string {
+	sep := ":"
+	if _, err := digest.Parse(reference); err == nil {
+		sep = "@"
+	}
+	return r.URL + "/" + r.Target(name) + sep + reference
+}
+
+// Repository connects to the repository the named repository is mirrored to in the registry
+func (r Registry) Repository(name string) (*remote.Repository, error) {
+	ref := strings.Join([]string{r.URL, r.Target(name)}, "/")
 	repo, err := remote.NewRepository(ref)
 	if err != nil {
 		return nil, err
@@ -118,19 +265,60 @@ func (r Registry) Fetch(ctx context.Context, name string, tag string) (*v1.Descr
 
 	repo.PlainHTTP = r.PlainHTTP
 
-	// prepare authentication using Docker credentials
-	storeOpts := credentials.StoreOptions{}
-	credStore, err := credentials.NewStoreFromDocker(storeOpts)
+	// prepare authentication using the credentials of the registry
+	credStore, err := r.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	client, err := r.HTTPClient()
 	if err != nil {
 		return nil, err
 	}
 	repo.Client = &auth.Client{
-		Client:     retry.DefaultClient,
+		Header:     version.Header(),
+		Client:     client,
 		Cache:      auth.NewCache(),
 		Credential: credentials.Credential(credStore), // Use the credentials store
 	}
 
-	// 2. Copy from the remote repository to the OCI layout store
+	return repo, nil
+}
+
+// PushArtifact stores the data as a single layer OCI artifact in the named repository of the registry
+func (r Registry) PushArtifact(ctx context.Context, name string, tag string, artifactType string, mediaType string, data []byte) (v1.Descriptor, error) {
+	repo, err := r.Repository(name)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := r.EnsureRepository(ctx, name); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	layer, err := oras.PushBytes(ctx, repo, mediaType, data)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	desc, err := oras.PackManifest(ctx, repo, oras.PackManifestVersion1_1, artifactType, oras.PackManifestOptions{
+		Layers: []v1.Descriptor{layer},
+	})
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if err := repo.Tag(ctx, desc, tag); err != nil {
+		return v1.Descriptor{}, err
+	}
+
+	return desc, nil
+}
+
+func (r Registry) Fetch(ctx context.Context, name string, tag string) (*v1.Descriptor, error) {
+	// 1. Connect to a remote repository
+	repo, err := r.Repository(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Resolve the reference to a descriptor
 	d, err := repo.Resolve(ctx, tag)
 	if err != nil {
 		return nil, err
@@ -144,26 +332,11 @@ func (r Registry) Pull(ctx context.Context, name string, tag string) (*v1.Descri
 	store := memory.New()
 
 	// 1. Connect to a remote repository
-	ref := strings.Join([]string{r.URL, name}, "/")
-	repo, err := remote.NewRepository(ref)
+	repo, err := r.Repository(name)
 	if err != nil {
 		return nil, err
 	}
 
-	repo.PlainHTTP = r.PlainHTTP
-
-	// prepare authentication using Docker credentials
-	storeOpts := credentials.StoreOptions{}
-	credStore, err := credentials.NewStoreFromDocker(storeOpts)
-	if err != nil {
-		return nil, err
-	}
-	repo.Client = &auth.Client{
-		Client:     retry.DefaultClient,
-		Cache:      auth.NewCache(),
-		Credential: credentials.Credential(credStore), // Use the credentials store
-	}
-
 	// 2. Copy from the remote repository to the OCI layout store
 	d, err := oras.Copy(ctx, repo, tag, store, tag, oras.DefaultCopyOptions)
 	if err != nil {
@@ -174,7 +347,13 @@ func (r Registry) Pull(ctx context.Context, name string, tag string) (*v1.Descri
 }
 
 func (r Registry) Exist(ctx context.Context, name string, tag string) (bool, error) {
-	return Exist(ctx, strings.Join([]string{r.URL, name}, "/"), tag, r.PlainHTTP)
+	repo, err := r.Repository(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = oras.Fetch(ctx, repo, tag, oras.DefaultFetchOptions)
+	return err == nil, err
 }
 
 func Exists(ctx context.Context, ref string, tag string, registries []Registry) map[string]bool {
@@ -195,29 +374,28 @@ func Exists(ctx context.Context, ref string, tag string, registries []Registry)
 	return m
 }
 
-func Exist(ctx context.Context, reference string, tag string, plainHTTP bool) (bool, error) {
+// Digest resolves the digest of the tag in the repository, with the settings of its source registry
+func Digest(ctx context.Context, ss Sources, reference string, tag string, plainHTTP bool) (string, error) {
+	repo, err := ss.open(reference, plainHTTP)
+	if err != nil {
+		return "", err
+	}
 
-	// 1. Connect to a remote repository
-	repo, err := remote.NewRepository(reference)
+	d, err := repo.Resolve(ctx, tag)
 	if err != nil {
-		return false, err
+		return "", err
 	}
 
-	repo.PlainHTTP = plainHTTP
+	return d.Digest.String(), nil
+}
 
-	// prepare authentication using Docker credentials
-	storeOpts := credentials.StoreOptions{}
-	credStore, err := credentials.NewStoreFromDocker(storeOpts)
+// Exist reports whether the tag exists in the repository, with the settings of its source registry
+func Exist(ctx context.Context, ss Sources, reference string, tag string, plainHTTP bool) (bool, error) {
+	repo, err := ss.open(reference, plainHTTP)
 	if err != nil {
 		return false, err
 	}
-	repo.Client = &auth.Client{
-		Client:     retry.DefaultClient,
-		Cache:      auth.NewCache(),
-		Credential: credentials.Credential(credStore), // Use the credentials store
-	}
 
-	// 2. Copy from the remote repository to the OCI layout store
 	opts := oras.DefaultFetchOptions
 	_, _, err = oras.Fetch(ctx, repo, tag, opts)
 	return err == nil, err
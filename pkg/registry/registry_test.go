@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	r := Registry{URL: "myregistry.io/mirror", Flatten: true}
+	tests := map[string]string{
+		"prometheus/prometheus":    "prometheus",
+		"ingress-nginx/controller": "controller",
+		"busybox":                  "busybox",
+		"charts/prometheus":        "charts/prometheus",
+		"helmper/attestations":     "helmper/attestations",
+	}
+	for name, want := range tests {
+		if got := r.Target(name); got != want {
+			t.Errorf("%s: want '%s' got '%s'", name, want, got)
+		}
+	}
+	if got := (Registry{URL: "myregistry.io"}).Target("prometheus/prometheus"); got != "prometheus/prometheus" {
+		t.Errorf("want the source repository got '%s'", got)
+	}
+
+	if got := r.Ref("prometheus/prometheus", "v2.48.0"); got != "myregistry.io/mirror/prometheus:v2.48.0" {
+		t.Errorf("want reference by tag got '%s'", got)
+	}
+	d := "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	if got := r.Ref("prometheus/prometheus", d); got != "myregistry.io/mirror/prometheus@"+d {
+		t.Errorf("want reference by digest got '%s'", got)
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	imgs := []Image{
+		{Registry: "docker.io", Repository: "bitnami/nginx", Tag: "1.25"},
+		{Registry: "docker.io", Repository: "library/nginx", Tag: "1.25"},
+		{Registry: "docker.io", Repository: "library/nginx", Tag: "1.26"},
+		{Registry: "quay.io", Repository: "prometheus/prometheus", Tag: "v2.48.0"},
+	}
+
+	if cs := (Registry{URL: "myregistry.io"}).Collisions(imgs); len(cs) != 0 {
+		t.Errorf("want no collisions got %v", cs)
+	}
+	want := map[string][]string{"nginx": {"docker.io/bitnami/nginx", "docker.io/library/nginx"}}
+	if cs := (Registry{URL: "myregistry.io", Flatten: true}).Collisions(imgs); !reflect.DeepEqual(cs, want) {
+		t.Errorf("want %v got %v", want, cs)
+	}
+}
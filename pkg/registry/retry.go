@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// backoff is the delay before the first retry, unless configured. The delay is doubled after each attempt
+var backoff = time.Second
+
+// Backoff configures the delays between retries
+type Backoff struct {
+	// Initial is the delay before the first retry. Defaults to 1 second
+	Initial time.Duration
+	// Max caps the delay between retries. Zero is unlimited
+	Max time.Duration
+}
+
+// withRetry runs fn, retrying up to retries times with exponential backoff until it succeeds or the context is done
+func withRetry(ctx context.Context, retries int, b Backoff, fn func() error) error {
+	delay := b.Initial
+	if delay <= 0 {
+		delay = backoff
+	}
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= retries {
+			return err
+		}
+		if b.Max > 0 && delay > b.Max {
+			delay = b.Max
+		}
+		slog.Debug("retrying after error", slog.Int("attempt", attempt+1), slog.Duration("delay", delay), slog.String("error", err.Error()))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
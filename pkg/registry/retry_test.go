@@ -0,0 +1,46 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	backoff = time.Millisecond
+
+	calls := 0
+	err := withRetry(context.Background(), 3, Backoff{}, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("want success after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = withRetry(context.Background(), 2, Backoff{}, func() error {
+		calls++
+		return errors.New("permanent")
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("want error after 3 calls, got %v after %d calls", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = withRetry(ctx, 5, Backoff{}, func() error { return errors.New("transient") })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want context canceled, got %v", err)
+	}
+
+	start := time.Now()
+	_ = withRetry(context.Background(), 3, Backoff{Initial: 2 * time.Millisecond, Max: 3 * time.Millisecond}, func() error { return errors.New("transient") })
+	if d := time.Since(start); d < 8*time.Millisecond || d > time.Second {
+		t.Errorf("want delays of 2ms, 3ms and 3ms, took %s", d)
+	}
+}
@@ -0,0 +1,66 @@
+package registry
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rewrite maps the repositories matching From to To, e.g. 'docker.io/library/*' to 'registry.local/dockerhub/*'.
+// From is a glob where '*' matches any part of the repository, including '/', and every '*' in To is replaced by the
+// part matched by the '*' at the same position in From. With Regex, From is a regular expression and To may reference
+// its groups, e.g. '$1'
+type Rewrite struct {
+	From  string
+	To    string
+	Regex bool
+}
+
+// compile returns the anchored expression of From and the template of To
+func (r Rewrite) compile() (*regexp.Regexp, string, error) {
+	if r.Regex {
+		re, err := regexp.Compile("^(?:" + r.From + ")$")
+		if err != nil {
+			return nil, "", fmt.Errorf("registry: the rewrite '%s' is not a regular expression :: %w", r.From, err)
+		}
+		return re, r.To, nil
+	}
+
+	from := strings.Count(r.From, "*")
+	if to := strings.Count(r.To, "*"); to > from {
+		return nil, "", fmt.Errorf("registry: the rewrite to '%s' has %d wildcards, but '%s' only has %d", r.To, to, r.From, from)
+	}
+	re := regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(r.From), `\*`, "(.*)") + "$")
+
+	var tmpl strings.Builder
+	n := 0
+	for _, c := range strings.ReplaceAll(r.To, "$", "$$") {
+		if c == '*' {
+			n++
+			tmpl.WriteString("${" + strconv.Itoa(n) + "}")
+			continue
+		}
+		tmpl.WriteRune(c)
+	}
+	return re, tmpl.String(), nil
+}
+
+// Validate returns an error if From can not be compiled
+func (r Rewrite) Validate() error {
+	_, _, err := r.compile()
+	return err
+}
+
+// Apply rewrites the repository, given with its registry, e.g. 'docker.io/library/nginx'. It reports if the rewrite matched
+func (r Rewrite) Apply(repository string) (string, bool, error) {
+	re, tmpl, err := r.compile()
+	if err != nil {
+		return "", false, err
+	}
+	m := re.FindStringSubmatchIndex(repository)
+	if m == nil {
+		return repository, false, nil
+	}
+	return string(re.ExpandString(nil, tmpl, repository, m)), true, nil
+}
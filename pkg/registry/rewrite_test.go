@@ -0,0 +1,37 @@
+package registry
+
+import "testing"
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		rewrite Rewrite
+		in      string
+		want    string
+		match   bool
+	}{
+		{Rewrite{From: "docker.io/library/*", To: "registry.local/dockerhub/*"}, "docker.io/library/nginx", "registry.local/dockerhub/nginx", true},
+		{Rewrite{From: "docker.io/library/*", To: "registry.local/dockerhub/*"}, "docker.io/bitnami/nginx", "docker.io/bitnami/nginx", false},
+		{Rewrite{From: "quay.io/*", To: "registry.local/quay/*"}, "quay.io/prometheus/prometheus", "registry.local/quay/prometheus/prometheus", true},
+		{Rewrite{From: "ghcr.io/*/charts/*", To: "registry.local/*-*"}, "ghcr.io/org/charts/app", "registry.local/org-app", true},
+		{Rewrite{From: `registry\.k8s\.io/(.+)`, To: "registry.local/k8s/$1", Regex: true}, "registry.k8s.io/ingress-nginx/controller", "registry.local/k8s/ingress-nginx/controller", true},
+		{Rewrite{From: `registry\.k8s\.io/(.+)`, To: "registry.local/k8s/$1", Regex: true}, "myregistry.k8s.io/pause", "myregistry.k8s.io/pause", false},
+	}
+	for _, tt := range tests {
+		got, match, err := tt.rewrite.Apply(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want || match != tt.match {
+			t.Errorf("%s -> %s on %s: want %s (%t) got %s (%t)", tt.rewrite.From, tt.rewrite.To, tt.in, tt.want, tt.match, got, match)
+		}
+	}
+
+	for _, r := range []Rewrite{
+		{From: "docker.io/*", To: "registry.local/*/*"},
+		{From: "docker.io/(", To: "registry.local/", Regex: true},
+	} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("want error for %s -> %s", r.From, r.To)
+		}
+	}
+}
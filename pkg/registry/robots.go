@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+// harborRobotPrefix is the prefix Harbor adds to the names of robot accounts
+const harborRobotPrefix = "robot$"
+
+// robotRefresh is how long before their expiry the secrets of robot accounts and deploy tokens are refreshed
+const robotRefresh = 7 * 24 * time.Hour
+
+// expiring reports whether a credential expiring at the time must be refreshed. The zero time never expires
+func expiring(at time.Time) bool {
+	return !at.IsZero() && time.Until(at) < robotRefresh
+}
+
+type harborAccess struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+}
+
+type harborPermission struct {
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace"`
+	Access    []harborAccess `json:"access"`
+}
+
+type harborRobot struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Level       string             `json:"level"`
+	Duration    int                `json:"duration"`
+	Disable     bool               `json:"disable"`
+	Permissions []harborPermission `json:"permissions"`
+}
+
+// HarborProjectsOf returns the sorted Harbor projects of the named repositories
+func (r Registry) HarborProjectsOf(names []string) []string {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, n := range names {
+		p := r.harborProject(n)
+		if !seen[p] {
+			seen[p] = true
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// PullRobot creates or updates the system robot account with the name, allowed to pull from the projects, and returns its credential.
+// Harbor only returns the secret when it is created, so the previous credential of an existing robot account is reused, e.g. from the
+// Secret written by the last run. A new secret is generated if there is none, or the robot account expires soon.
+// Duration is the number of days the robot account is valid, -1 never expires
+func (h Harbor) PullRobot(ctx context.Context, name string, projects []string, duration int, previous auth.Credential) (auth.Credential, error) {
+	robot := harborRobot{
+		Name:        name,
+		Description: "Managed by helmper",
+		Level:       "system",
+		Duration:    duration,
+		Permissions: []harborPermission{},
+	}
+	for _, p := range projects {
+		robot.Permissions = append(robot.Permissions, harborPermission{
+			Kind:      "project",
+			Namespace: p,
+			Access: []harborAccess{
+				{Resource: "repository", Action: "pull"},
+				{Resource: "artifact", Action: "read"},
+			},
+		})
+	}
+
+	existing := []struct {
+		ID        int64  `json:"id"`
+		Name      string `json:"name"`
+		ExpiresAt int64  `json:"expires_at"`
+	}{}
+	if _, err := h.do(ctx, http.MethodGet, "/robots?q="+url.QueryEscape("name="+harborRobotPrefix+name), nil, &existing); err != nil {
+		return auth.EmptyCredential, fmt.Errorf("registry: error looking up Harbor robot account %s :: %w", name, err)
+	}
+	var (
+		id      int64
+		expires time.Time
+	)
+	for _, r := range existing {
+		if r.Name == harborRobotPrefix+name {
+			id = r.ID
+			// -1 never expires
+			if r.ExpiresAt > 0 {
+				expires = time.Unix(r.ExpiresAt, 0)
+			}
+		}
+	}
+
+	var res struct {
+		Name   string `json:"name"`
+		Secret string `json:"secret"`
+	}
+	if id == 0 {
+		if _, err := h.do(ctx, http.MethodPost, "/robots", robot, &res); err != nil {
+			return auth.EmptyCredential, fmt.Errorf("registry: error creating Harbor robot account %s :: %w", name, err)
+		}
+		slog.Info("created Harbor robot account", slog.String("registry", h.Registry.Host()), slog.String("robot", res.Name), slog.Int("projects", len(projects)))
+		return auth.Credential{Username: res.Name, Password: res.Secret}, nil
+	}
+
+	// updates require the full name of the robot account
+	robot.Name = harborRobotPrefix + name
+	if _, err := h.do(ctx, http.MethodPut, fmt.Sprintf("/robots/%d", id), robot, nil); err != nil {
+		return auth.EmptyCredential, fmt.Errorf("registry: error updating Harbor robot account %s :: %w", name, err)
+	}
+	if previous.Username == robot.Name && previous.Password != "" && !expiring(expires) {
+		slog.Info("updated Harbor robot account", slog.String("registry", h.Registry.Host()), slog.String("robot", robot.Name), slog.Int("projects", len(projects)))
+		return previous, nil
+	}
+	if _, err := h.do(ctx, http.MethodPatch, fmt.Sprintf("/robots/%d", id), map[string]string{"secret": ""}, &res); err != nil {
+		return auth.EmptyCredential, fmt.Errorf("registry: error refreshing the secret of Harbor robot account %s :: %w", name, err)
+	}
+	slog.Info("refreshed the secret of Harbor robot account", slog.String("registry", h.Registry.Host()), slog.String("robot", robot.Name), slog.Int("projects", len(projects)))
+	return auth.Credential{Username: robot.Name, Password: res.Secret}, nil
+}
+
+// DockerConfigJSON returns the Docker config holding the credentials by registry host, as used by kubernetes.io/dockerconfigjson Secrets
+func DockerConfigJSON(creds map[string]auth.Credential) ([]byte, error) {
+	type entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+	auths := map[string]entry{}
+	for host, c := range creds {
+		auths[host] = entry{
+			Username: c.Username,
+			Password: c.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(c.Username + ":" + c.Password)),
+		}
+	}
+	return json.Marshal(map[string]any{"auths": auths})
+}
+
+// ParseDockerConfigJSON returns the credentials by registry host of the Docker config, e.g. of a kubernetes.io/dockerconfigjson Secret
+func ParseDockerConfigJSON(b []byte) (map[string]auth.Credential, error) {
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+	res := make(map[string]auth.Credential, len(config.Auths))
+	for host, e := range config.Auths {
+		res[host] = auth.Credential{Username: e.Username, Password: e.Password}
+	}
+	return res, nil
+}
@@ -0,0 +1,188 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/auth"
+)
+
+func TestPullRobot(t *testing.T) {
+	robots := `[]`
+	var got harborRobot
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v2.0/robots", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(robots))
+	})
+	mux.HandleFunc("POST /api/v2.0/robots", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 4, "name": "robot$helmper-pull", "secret": "s1"}`))
+	})
+	mux.HandleFunc("PUT /api/v2.0/robots/4", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+	})
+	mux.HandleFunc("PATCH /api/v2.0/robots/4", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"secret": "s2"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	r := Registry{URL: "harbor.internal"}
+	projects := r.HarborProjectsOf([]string{"prometheus/prometheus", "nginx", "charts/prometheus", "prometheus/node-exporter"})
+	if want := []string{"charts", "library", "prometheus"}; !reflect.DeepEqual(projects, want) {
+		t.Fatalf("want projects %v got %v", want, projects)
+	}
+
+	ctx := context.Background()
+	h := Harbor{Registry: r, URL: srv.URL}
+	c, err := h.PullRobot(ctx, "helmper-pull", projects, -1, auth.EmptyCredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "robot$helmper-pull" || c.Password != "s1" {
+		t.Errorf("unexpected credential %+v", c)
+	}
+	if got.Name != "helmper-pull" || len(got.Permissions) != 3 || got.Permissions[2].Namespace != "prometheus" || got.Permissions[0].Access[0].Action != "pull" {
+		t.Errorf("unexpected robot %+v", got)
+	}
+
+	// the secret of the last run is reused
+	robots = `[{"id": 4, "name": "robot$helmper-pull", "expires_at": -1}]`
+	c, err = h.PullRobot(ctx, "helmper-pull", projects[:1], -1, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "s1" || got.Name != "robot$helmper-pull" || len(got.Permissions) != 1 {
+		t.Errorf("unexpected update %+v %+v", c, got)
+	}
+
+	// without the secret of the last run, or near expiry, the secret is refreshed
+	c, err = h.PullRobot(ctx, "helmper-pull", projects, -1, auth.EmptyCredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "s2" {
+		t.Errorf("want refreshed secret, got %+v", c)
+	}
+	robots = fmt.Sprintf(`[{"id": 4, "name": "robot$helmper-pull", "expires_at": %d}]`, time.Now().Add(time.Hour).Unix())
+	c, err = h.PullRobot(ctx, "helmper-pull", projects, 30, auth.Credential{Username: "robot$helmper-pull", Password: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Password != "s2" {
+		t.Errorf("want refreshed secret near expiry, got %+v", c)
+	}
+}
+
+func TestDeployToken(t *testing.T) {
+	tokens := `[]`
+	deleted := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v4/groups/platform%2Fmirror/deploy_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "gl" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(tokens))
+	})
+	mux.HandleFunc("POST /api/v4/groups/platform%2Fmirror/deploy_tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id": 2, "name": "helmper-pull", "username": "gitlab+deploy-token-2", "token": "t2"}`))
+	})
+	mux.HandleFunc("DELETE /api/v4/groups/platform%2Fmirror/deploy_tokens/{id}", func(w http.ResponseWriter, r *http.Request) {
+		deleted = append(deleted, r.PathValue("id"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	g := GitLab{Registry: Registry{URL: "registry.gitlab.internal"}, URL: srv.URL, Group: "platform/mirror", Token: "gl"}
+
+	tokens = `[{"id": 1, "name": "helmper-pull", "username": "gitlab+deploy-token-1"}]`
+	previous := auth.Credential{Username: "gitlab+deploy-token-1", Password: "t1"}
+	c, err := g.DeployToken(ctx, "helmper-pull", -1, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != previous || len(deleted) != 0 {
+		t.Errorf("want the previous token reused, got %+v and deleted %v", c, deleted)
+	}
+
+	c, err = g.DeployToken(ctx, "helmper-pull", 30, auth.EmptyCredential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Username != "gitlab+deploy-token-2" || c.Password != "t2" || !reflect.DeepEqual(deleted, []string{"1"}) {
+		t.Errorf("unexpected token %+v and deleted %v", c, deleted)
+	}
+}
+
+func TestQuayPullRobot(t *testing.T) {
+	created := false
+	granted := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/organization/mirror/robots/helmper-pull", func(w http.ResponseWriter, r *http.Request) {
+		if !created {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name": "mirror+helmper-pull", "token": "q1"}`))
+	})
+	mux.HandleFunc("PUT /api/v1/organization/mirror/robots/helmper-pull", func(w http.ResponseWriter, r *http.Request) {
+		created = true
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"name": "mirror+helmper-pull", "token": "q1"}`))
+	})
+	mux.HandleFunc("PUT /api/v1/repository/mirror/{repo...}", func(w http.ResponseWriter, r *http.Request) {
+		granted = append(granted, r.PathValue("repo"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	q := Quay{Registry: Registry{URL: "quay.internal/mirror"}, URL: srv.URL, Organization: "mirror", Token: "q"}
+	for range 2 {
+		granted = nil
+		c, err := q.PullRobot(ctx, "helmper-pull", []string{"nginx", "charts/prometheus", "nginx"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Username != "mirror+helmper-pull" || c.Password != "q1" {
+			t.Errorf("unexpected credential %+v", c)
+		}
+		want := []string{"nginx/permissions/user/mirror+helmper-pull", "charts/prometheus/permissions/user/mirror+helmper-pull"}
+		if !reflect.DeepEqual(granted, want) {
+			t.Errorf("want %v granted, got %v", want, granted)
+		}
+	}
+}
+
+func TestDockerConfigJSON(t *testing.T) {
+	b, err := DockerConfigJSON(map[string]auth.Credential{"harbor.internal": {Username: "robot$pull", Password: "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"auths":{"harbor.internal":{"username":"robot$pull","password":"secret","auth":"cm9ib3QkcHVsbDpzZWNyZXQ="}}}`
+	if string(b) != want {
+		t.Errorf("want %s got %s", want, b)
+	}
+
+	creds, err := ParseDockerConfigJSON(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := creds["harbor.internal"]; c.Username != "robot$pull" || c.Password != "secret" {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"path"
+	"slices"
+
+	"github.com/blang/semver/v4"
+)
+
+// Route restricts the charts and images pushed to a registry. The zero value routes everything to the registry
+type Route struct {
+	// Charts are glob patterns of the chart names routed to the registry, e.g. 'prometheus-*'. Images of the charts follow them
+	Charts []string
+	// Images are glob patterns of the images routed to the registry regardless of their charts, without tag, e.g. 'docker.io/library/*'
+	Images []string
+	// Releases routes only release versions of charts, no pre-releases such as '1.2.0-rc.1'
+	Releases bool
+}
+
+// All reports whether everything is routed to the registry
+func (r Route) All() bool {
+	return len(r.Charts) == 0 && len(r.Images) == 0 && !r.Releases
+}
+
+func match(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(p string) bool {
+		ok, _ := path.Match(p, name)
+		return ok
+	})
+}
+
+// Chart reports whether the version of the chart is routed to the registry
+func (r Route) Chart(name string, version string) bool {
+	if r.Releases {
+		if v, err := semver.ParseTolerant(version); err == nil && len(v.Pre) > 0 {
+			return false
+		}
+	}
+	return len(r.Charts) == 0 && len(r.Images) == 0 || match(r.Charts, name)
+}
+
+// Image reports whether the image is routed to the registry by its image patterns. ref is the image without tag, e.g. 'docker.io/library/busybox'
+func (r Route) Image(ref string) bool {
+	return match(r.Images, ref)
+}
+
+// Routes reports whether the image is routed to the registry
+func (r Registry) Routes(i Image) bool {
+	return len(i.Registries) == 0 || slices.Contains(i.Registries, r.Name)
+}
+
+// RoutedTo returns the registries the image is routed to
+func (i Image) RoutedTo(rs []Registry) []Registry {
+	if len(i.Registries) == 0 {
+		return rs
+	}
+	return slices.DeleteFunc(slices.Clone(rs), func(r Registry) bool {
+		return !r.Routes(i)
+	})
+}
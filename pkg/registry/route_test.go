@@ -0,0 +1,44 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestRouteChart(t *testing.T) {
+	tests := []struct {
+		route   Route
+		name    string
+		version string
+		want    bool
+	}{
+		{Route{}, "prometheus", "25.0.0", true},
+		{Route{Charts: []string{"prometheus-*"}}, "prometheus", "25.0.0", false},
+		{Route{Charts: []string{"prometheus-*"}}, "prometheus-node-exporter", "4.0.0", true},
+		{Route{Releases: true}, "prometheus", "25.0.0", true},
+		{Route{Releases: true}, "prometheus", "25.0.0-rc.1", false},
+		{Route{Images: []string{"docker.io/*"}}, "prometheus", "25.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := tt.route.Chart(tt.name, tt.version); got != tt.want {
+			t.Errorf("%+v: want %v for %s %s, got %v", tt.route, tt.want, tt.name, tt.version, got)
+		}
+	}
+}
+
+func TestRoutedTo(t *testing.T) {
+	rs := []Registry{{Name: "prod"}, {Name: "dev"}}
+
+	if got := (Image{}).RoutedTo(rs); len(got) != 2 {
+		t.Errorf("want every registry for images without routes, got %v", got)
+	}
+	got := Image{Registries: []string{"dev"}}.RoutedTo(rs)
+	if len(got) != 1 || got[0].Name != "dev" {
+		t.Errorf("want the dev registry, got %v", got)
+	}
+	if len(rs) != 2 || rs[0].Name != "prod" {
+		t.Errorf("want the registries unchanged, got %v", rs)
+	}
+	if !(Route{Images: []string{"docker.io/library/*"}}).Image("docker.io/library/busybox") {
+		t.Error("want busybox routed by the image pattern")
+	}
+}
@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Variants are the conventional tag suffixes of image variants, e.g. '1.25-alpine' or '1.25-alpine3.19', and of per-architecture tags
+var Variants = []string{
+	"alpine", "debian", "bookworm", "bullseye", "ubuntu", "jammy", "noble", "slim", "distroless", "ubi", "fips",
+	"amd64", "arm64", "arm", "ppc64le", "s390x",
+}
+
+// variantSuffix matches a variant suffix at the end of a tag, optionally followed by the version of the variant
+func variantSuffix(variants []string) *regexp.Regexp {
+	qs := make([]string, 0, len(variants))
+	for _, v := range variants {
+		qs = append(qs, regexp.QuoteMeta(v))
+	}
+	return regexp.MustCompile(`-(?:` + strings.Join(qs, "|") + `)[0-9.]*$`)
+}
+
+// baseTag strips the variant suffixes of the tag, e.g. '1.25' for '1.25-fips-alpine3.19'
+func baseTag(tag string, suffix *regexp.Regexp) string {
+	for {
+		t := suffix.ReplaceAllString(tag, "")
+		if t == tag || t == "" {
+			return tag
+		}
+		tag = t
+	}
+}
+
+// SiblingTags returns the tags in tags that are variants of the same base tag as tag, e.g. '1.25' and '1.25-debian' for '1.25-alpine'
+func SiblingTags(tag string, tags []string, variants []string) []string {
+	suffix := variantSuffix(variants)
+	base := baseTag(tag, suffix)
+
+	res := []string{}
+	for _, t := range tags {
+		if t != tag && baseTag(t, suffix) == base {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// Siblings lists the tags of the image in its source registry, and returns the variants of its tag by the conventional suffixes and variants
+func (i Image) Siblings(ctx context.Context, ss Sources, variants []string) ([]Image, error) {
+	if i.Tag == "" {
+		return nil, nil
+	}
+	name, err := i.ImageName()
+	if err != nil {
+		return nil, err
+	}
+	source, err := ss.Repository(i.Registry, name)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := i.String()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	err = source.Tags(ctx, "", func(ts []string) error {
+		tags = append(tags, ts...)
+		return nil
+	})
+	if err != nil {
+		return nil, redHatAuthError(i.Registry, err)
+	}
+
+	res := []Image{}
+	for _, t := range SiblingTags(i.Tag, tags, slices.Concat(Variants, variants)) {
+		res = append(res, Image{
+			Registry:   i.Registry,
+			Repository: i.Repository,
+			Tag:        t,
+			Patch:      i.Patch,
+			SiblingOf:  ref,
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,28 @@
+package registry
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSiblingTags(t *testing.T) {
+	tags := []string{"1.25", "1.25-alpine", "1.25-alpine3.19", "1.25-perl", "1.25-fips-alpine", "1.25-arm64", "1.26-alpine", "latest", "alpine"}
+	tests := []struct {
+		tag  string
+		want []string
+	}{
+		{"1.25-alpine", []string{"1.25", "1.25-alpine3.19", "1.25-fips-alpine", "1.25-arm64"}},
+		{"1.25", []string{"1.25-alpine", "1.25-alpine3.19", "1.25-fips-alpine", "1.25-arm64"}},
+		{"1.26-alpine", []string{}},
+		{"latest", []string{}},
+	}
+	for _, tt := range tests {
+		if got := SiblingTags(tt.tag, tags, Variants); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: want %v got %v", tt.tag, tt.want, got)
+		}
+	}
+
+	if got := SiblingTags("1.25", tags, []string{"perl"}); !slices.Equal(got, []string{"1.25-perl"}) {
+		t.Errorf("want the configured variants got %v", got)
+	}
+}
@@ -0,0 +1,7 @@
+package registry
+
+// Signer signs artifacts in the registries, referenced by digest, e.g. '0.0.0.0:5000/charts/prometheus@sha256:...'.
+// Cosign is the default implementation, see cosign.SignOption. Notation is the alternative, see notation.SignOption
+type Signer interface {
+	Sign(as []Artifact) error
+}
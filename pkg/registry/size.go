@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/sync/errgroup"
+	"oras.land/oras-go/v2"
+)
+
+// sizeConcurrency is the number of image sizes fetched at once by Sizes
+const sizeConcurrency = 8
+
+// ImageSize is the number of bytes pulled for an image: its config and its compressed layers
+type ImageSize struct {
+	Config int64
+	Layers []int64
+}
+
+// Total is the number of bytes pulled for the image
+func (s ImageSize) Total() int64 {
+	size := s.Config
+	for _, l := range s.Layers {
+		size += l
+	}
+	return size
+}
+
+// Largest is the size of the largest layer of the image
+func (s ImageSize) Largest() int64 {
+	var res int64
+	for _, l := range s.Layers {
+		res = max(res, l)
+	}
+	return res
+}
+
+// manifestSize is the number of bytes pulled for the manifest, i.e. its config and compressed layers
+func manifestSize(m v1.Manifest) ImageSize {
+	size := ImageSize{Config: m.Config.Size, Layers: make([]int64, 0, len(m.Layers))}
+	for _, l := range m.Layers {
+		size.Layers = append(size.Layers, l.Size)
+	}
+	return size
+}
+
+// Sizes fetches the sizes of the images by reference concurrently. Images whose size can not be fetched are left out
+func Sizes(ctx context.Context, ss Sources, imgs map[string]*Image) map[string]ImageSize {
+	var mu sync.Mutex
+	res := make(map[string]ImageSize, len(imgs))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(sizeConcurrency)
+	for ref, i := range imgs {
+		eg.Go(func() error {
+			s, err := i.Size(egCtx, ss)
+			if err != nil {
+				slog.Debug("Could not determine size of image", slog.String("image", ref), slog.Any("error", err))
+				return nil
+			}
+			mu.Lock()
+			res[ref] = s
+			mu.Unlock()
+			return nil
+		})
+	}
+	_ = eg.Wait()
+	return res
+}
+
+// Size fetches the manifest of the image from its source registry and returns the number of bytes pulled for it.
+// Multi-platform images are resolved to linux/amd64
+func (i Image) Size(ctx context.Context, ss Sources) (ImageSize, error) {
+	name, err := i.ImageName()
+	if err != nil {
+		return ImageSize{}, err
+	}
+	source, err := ss.Repository(i.Registry, name)
+	if err != nil {
+		return ImageSize{}, err
+	}
+
+	ref := i.Tag
+	if i.UseDigest && i.Digest != "" {
+		ref = i.Digest
+	}
+
+	desc, err := source.Resolve(ctx, ref)
+	if err != nil {
+		return ImageSize{}, fmt.Errorf("registry: error resolving %s/%s:%s :: %w", i.Registry, name, ref, err)
+	}
+	if desc.MediaType == v1.MediaTypeImageIndex || desc.MediaType == mediaTypeDockerManifestList {
+		p, err := parsePlatform("linux/amd64")
+		if err != nil {
+			return ImageSize{}, err
+		}
+		desc, err = oras.Resolve(ctx, source, ref, oras.ResolveOptions{TargetPlatform: p})
+		if err != nil {
+			return ImageSize{}, fmt.Errorf("registry: error resolving %s/%s:%s :: %w", i.Registry, name, ref, err)
+		}
+	}
+
+	var manifest v1.Manifest
+	if err := fetchJSON(ctx, source, desc, &manifest); err != nil {
+		return ImageSize{}, fmt.Errorf("registry: error fetching manifest of %s/%s:%s :: %w", i.Registry, name, ref, err)
+	}
+	return manifestSize(manifest), nil
+}
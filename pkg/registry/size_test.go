@@ -0,0 +1,59 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+func TestImageSize(t *testing.T) {
+	source := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	defer source.Close()
+	// sources on localhost are pulled with plain HTTP
+	sourceHost := strings.Replace(strings.TrimPrefix(source.URL, "http://"), "127.0.0.1", "localhost", 1)
+
+	img, err := random.Image(256, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := name.ParseReference(sourceHost+"/library/nginx:1.25", name.Insecure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, img); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := img.Manifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, largest := m.Config.Size, int64(0)
+	for _, l := range m.Layers {
+		want += l.Size
+		largest = max(largest, l.Size)
+	}
+
+	i := &Image{Registry: sourceHost, Repository: "library/nginx", Tag: "1.25"}
+	got, err := i.Size(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total() != want || len(got.Layers) != 3 || got.Largest() != largest {
+		t.Errorf("want %d bytes in 3 layers got %+v", want, got)
+	}
+
+	missing := &Image{Registry: sourceHost, Repository: "library/missing", Tag: "1.0"}
+	sizes := Sizes(context.Background(), nil, map[string]*Image{"nginx": i, "missing": missing})
+	if len(sizes) != 1 || sizes["nginx"].Total() != want {
+		t.Errorf("want only the size of nginx got %+v", sizes)
+	}
+}
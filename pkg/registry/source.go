@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+)
+
+// Source holds the settings for pulling images from a source registry, e.g. a private upstream behind a proxy
+type Source struct {
+	// Host of the registry, e.g. 'docker.io' or 'registry.internal:5000'
+	Host string
+	// Auth are the credentials for the registry. Empty uses the Docker and Helm credential stores
+	Auth Auth
+	// CAFile is a PEM bundle of certificate authorities trusted for the registry besides the system ones
+	CAFile    string
+	Insecure  bool
+	PlainHTTP bool
+	// Proxy is the URL of the HTTP(S) proxy the registry is reached through. Empty uses the proxy of the environment, e.g. HTTPS_PROXY
+	Proxy string
+	// RequestsPerSecond limits the requests to the registry. Zero is unlimited
+	RequestsPerSecond float64
+	// ConcurrentPulls limits the requests in flight to the registry, e.g. layer downloads. Zero is unlimited
+	ConcurrentPulls int
+}
+
+// Source returns the settings for pulling from the registry, e.g. for scanning the images pushed to it
+func (r Registry) Source() Source {
+	return Source{Host: r.Host(), Auth: r.Auth, CAFile: r.CAFile, Insecure: r.Insecure, PlainHTTP: r.PlainHTTP}
+}
+
+// Sources are the settings of the source registries by host. Nil pulls every registry with the defaults
+type Sources map[string]Source
+
+// NewSources returns the settings of the source registries
+func NewSources(ss []Source) Sources {
+	m := make(Sources, len(ss))
+	for _, s := range ss {
+		m[s.Host] = s
+	}
+	return m
+}
+
+// For returns the settings of the source registry, or the defaults if none are configured
+func (ss Sources) For(host string) Source {
+	if s, ok := ss.Lookup(host); ok {
+		return s
+	}
+	return Source{Host: host}
+}
+
+// Lookup returns the settings configured for the source registry. Settings for any Docker Hub host apply to all of them
+func (ss Sources) Lookup(host string) (Source, bool) {
+	if s, ok := ss[host]; ok {
+		return s, true
+	}
+	if slices.Contains(dockerHub, host) {
+		for _, h := range dockerHub {
+			if s, ok := ss[h]; ok {
+				return s, true
+			}
+		}
+	}
+	return Source{}, false
+}
+
+// Validate returns an error if the CA bundle or the proxy of the source can not be used
+func (s Source) Validate() error {
+	_, err := s.client()
+	return err
+}
+
+// client returns the HTTP client for the registry, with the CA bundle and the proxy of the source
+func (s Source) client() (*http.Client, error) {
+	return transport{
+		host:        s.Host,
+		caFile:      s.CAFile,
+		insecure:    s.Insecure,
+		proxy:       s.Proxy,
+		rps:         s.RequestsPerSecond,
+		concurrency: s.ConcurrentPulls,
+	}.client()
+}
+
+// credential returns the configured credentials of the source, or the Docker and Helm credential stores if none are configured
+func (s Source) credential() (auth.CredentialFunc, error) {
+	switch {
+	case s.Auth.CredentialsFile != "":
+		store, err := credentials.NewStore(os.ExpandEnv(s.Auth.CredentialsFile), credentials.StoreOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return credentials.Credential(store), nil
+	case s.Auth != Auth{}:
+		// the client only talks to the source, and Docker Hub is served from other hosts than docker.io
+		c := s.Auth.credential()
+		return func(context.Context, string) (auth.Credential, error) { return c, nil }, nil
+	}
+	store, err := CredentialStore()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.Credential(store), nil
+}
+
+// Repository connects to the repository of the image in the source registry, e.g. 'ghcr.io' and 'org/app'
+func (ss Sources) Repository(sourceURL string, name string) (*remote.Repository, error) {
+	return ss.For(sourceURL).Repository(strings.Join([]string{sourceURL, name}, "/"))
+}
+
+// Repository connects to the repository of the reference with the settings of the source, e.g. 'ghcr.io/org/chart'
+func (s Source) Repository(reference string) (*remote.Repository, error) {
+	credential, err := s.credential()
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	repo, err := remote.NewRepository(reference)
+	if err != nil {
+		return nil, err
+	}
+	repo.Client = &auth.Client{
+		Header:     version.Header(),
+		Client:     client,
+		Cache:      auth.NewCache(),
+		Credential: credential,
+	}
+	// Determine HTTP or HTTPS. Allow HTTP if configured or local reference
+	host := repo.Reference.Registry
+	repo.PlainHTTP = s.PlainHTTP || strings.Contains(host, "localhost") || strings.Contains(host, "0.0.0.0")
+
+	return repo, nil
+}
+
+// open connects to the repository of the reference in its source registry, e.g. 'ghcr.io/org/app'
+func (ss Sources) open(reference string, plainHTTP bool) (*remote.Repository, error) {
+	host, name, _ := strings.Cut(reference, "/")
+	repo, err := ss.Repository(host, name)
+	if err != nil {
+		return nil, err
+	}
+	repo.PlainHTTP = repo.PlainHTTP || plainHTTP
+	return repo, nil
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	ss := NewSources([]Source{{Host: "docker.io", Auth: Auth{Username: "user", Password: "secret"}}, {Host: "registry.internal:5000", PlainHTTP: true}})
+
+	if s := ss.For("registry-1.docker.io"); s.Auth.Username != "user" {
+		t.Errorf("want the docker.io settings for registry-1.docker.io, got %+v", s)
+	}
+	if s := ss.For("quay.io"); s.Host != "quay.io" || s.PlainHTTP {
+		t.Errorf("want no settings for quay.io, got %+v", s)
+	}
+
+	repo, err := ss.Repository("registry.internal:5000", "team/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !repo.PlainHTTP {
+		t.Error("want plain HTTP for registry.internal:5000")
+	}
+
+	c, err := ss.For("docker.io").credential()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cred, _ := c(context.Background(), "registry-1.docker.io"); cred.Username != "user" || cred.Password != "secret" {
+		t.Errorf("want the configured credentials, got %+v", cred)
+	}
+}
+
+func TestSourceValidate(t *testing.T) {
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(ca, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source Source
+		ok     bool
+	}{
+		{Source{Host: "docker.io"}, true},
+		{Source{Host: "docker.io", Proxy: "http://proxy.internal:3128"}, true},
+		{Source{Host: "docker.io", Proxy: "proxy"}, false},
+		{Source{Host: "docker.io", CAFile: ca}, false},
+		{Source{Host: "docker.io", CAFile: filepath.Join(t.TempDir(), "missing.pem")}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.source.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v: want ok %v, got %v", tt.source, tt.ok, err)
+		}
+	}
+}
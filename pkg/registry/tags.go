@@ -0,0 +1,23 @@
+package registry
+
+import "regexp"
+
+// movingTags are tags conventionally moved to new builds, besides major-only versions
+var movingTags = map[string]bool{
+	"latest":   true,
+	"stable":   true,
+	"edge":     true,
+	"nightly":  true,
+	"dev":      true,
+	"main":     true,
+	"master":   true,
+	"mainline": true,
+	"lts":      true,
+}
+
+var majorOnly = regexp.MustCompile(`^v?[0-9]+$`)
+
+// MovingTag reports whether the tag is likely moved to new builds, e.g. 'latest', 'stable' or a major-only version like 'v1'
+func MovingTag(tag string) bool {
+	return movingTags[tag] || majorOnly.MatchString(tag)
+}
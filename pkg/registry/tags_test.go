@@ -0,0 +1,22 @@
+package registry
+
+import "testing"
+
+func TestMovingTag(t *testing.T) {
+	tests := map[string]bool{
+		"latest":      true,
+		"stable":      true,
+		"v1":          true,
+		"3":           true,
+		"v1.2":        false,
+		"1.25.3":      false,
+		"v2.48.0":     false,
+		"":            false,
+		"3.19-alpine": false,
+	}
+	for tag, want := range tests {
+		if got := MovingTag(tag); got != want {
+			t.Errorf("%s: want %v got %v", tag, want, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package registry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"oras.land/oras-go/v2/registry/remote/retry"
+)
+
+// transport are the settings of the HTTP connections to a registry
+type transport struct {
+	host     string
+	caFile   string
+	certFile string
+	keyFile  string
+	insecure bool
+	proxy    string
+	// rps and concurrency limit the requests per second and the requests in flight. Zero is unlimited
+	rps         float64
+	concurrency int
+}
+
+// cachedClient is the HTTP client of a transport, and when its CA bundle and client certificate files were last modified
+type cachedClient struct {
+	client   *http.Client
+	modified [3]time.Time
+}
+
+// clients caches the HTTP clients per transport, so connections are reused. A rotated CA bundle or client certificate, e.g. renewed by
+// cert-manager in a long-running 'helmper serve', has another modification time, so a new client replaces the cached one
+var clients sync.Map
+
+// modified returns when the files were last modified. Missing files have the zero time, and fail when loaded
+func modified(files ...string) [3]time.Time {
+	var res [3]time.Time
+	for n, f := range files {
+		if f == "" {
+			continue
+		}
+		if fi, err := os.Stat(os.ExpandEnv(f)); err == nil {
+			res[n] = fi.ModTime()
+		}
+	}
+	return res
+}
+
+// client returns the retrying HTTP client for the registry, trusting the CA bundle and presenting the client certificate, if any.
+// Requests are rate limited if configured, and back off when the pull quota is exceeded for Docker Hub and rate limited registries
+func (t transport) client() (*http.Client, error) {
+	limit := t.rps > 0 || t.concurrency > 0 || slices.Contains(dockerHub, t.host)
+	if t.caFile == "" && t.certFile == "" && t.keyFile == "" && t.proxy == "" && !t.insecure && !limit {
+		return retry.DefaultClient, nil
+	}
+	mod := modified(t.caFile, t.certFile, t.keyFile)
+	if c, ok := clients.Load(t); ok && c.(cachedClient).modified == mod {
+		return c.(cachedClient).client, nil
+	}
+
+	ht := http.DefaultTransport.(*http.Transport).Clone()
+	ht.TLSClientConfig = &tls.Config{InsecureSkipVerify: t.insecure}
+	if t.caFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := os.ReadFile(os.ExpandEnv(t.caFile))
+		if err != nil {
+			return nil, fmt.Errorf("registry: error reading CA bundle of registry %s :: %w", t.host, err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("registry: the CA bundle %s of registry %s has no PEM certificates", t.caFile, t.host)
+		}
+		ht.TLSClientConfig.RootCAs = pool
+	}
+	if t.certFile != "" || t.keyFile != "" {
+		if t.certFile == "" || t.keyFile == "" {
+			return nil, fmt.Errorf("registry: the client certificate of registry %s needs both a certificate and a key file", t.host)
+		}
+		cert, err := tls.LoadX509KeyPair(os.ExpandEnv(t.certFile), os.ExpandEnv(t.keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("registry: error loading client certificate of registry %s :: %w", t.host, err)
+		}
+		ht.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	if t.proxy != "" {
+		u, err := url.Parse(os.ExpandEnv(t.proxy))
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("registry: the proxy '%s' of registry %s is not a URL, e.g. http://proxy.internal:3128", t.proxy, t.host)
+		}
+		ht.Proxy = http.ProxyURL(u)
+	}
+
+	// the retries of failed requests are throttled too
+	rt := retry.NewTransport(ht)
+	if limit {
+		rt = retry.NewTransport(newLimited(t.host, ht, t.rps, t.concurrency))
+		rt.Policy = func() retry.Policy { return quotaPolicy }
+	}
+	c := &http.Client{Transport: rt}
+	if old, ok := clients.Swap(t, cachedClient{client: c, modified: mod}); ok {
+		old.(cachedClient).client.CloseIdleConnections()
+	}
+	return c, nil
+}
+
+// HTTPClient returns the HTTP client for the registry, with its CA bundle and client certificate
+func (r Registry) HTTPClient() (*http.Client, error) {
+	return transport{
+		host:     r.Host(),
+		caFile:   r.CAFile,
+		certFile: r.CertFile,
+		keyFile:  r.KeyFile,
+		insecure: r.Insecure,
+	}.client()
+}
+
+// ValidateTLS returns an error if the CA bundle or the client certificate of the registry can not be loaded
+func (r Registry) ValidateTLS() error {
+	_, err := r.HTTPClient()
+	return err
+}
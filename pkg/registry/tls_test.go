@@ -0,0 +1,137 @@
+package registry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeClientCertificate writes a self-signed client certificate and its key to dir
+func writeClientCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "helmper"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: k}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, certFile, keyFile
+}
+
+func TestHTTPClientMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	client, certFile, keyFile := writeClientCertificate(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(client)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(r Registry) error {
+		c, err := r.HTTPClient()
+		if err != nil {
+			return err
+		}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+
+	if err := get(Registry{URL: srv.Listener.Addr().String(), CAFile: caFile, CertFile: certFile, KeyFile: keyFile}); err != nil {
+		t.Errorf("want the request accepted with the CA bundle and client certificate, got %v", err)
+	}
+	if err := get(Registry{URL: srv.Listener.Addr().String(), CAFile: caFile}); err == nil {
+		t.Error("want the request rejected without client certificate")
+	}
+	if err := get(Registry{URL: srv.Listener.Addr().String(), CertFile: certFile, KeyFile: keyFile}); err == nil {
+		t.Error("want the server certificate untrusted without the CA bundle")
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	_, certFile, _ := writeClientCertificate(t, t.TempDir())
+
+	tests := []struct {
+		registry Registry
+		ok       bool
+	}{
+		{Registry{URL: "registry.internal"}, true},
+		{Registry{URL: "registry.internal", CertFile: certFile}, false},
+		{Registry{URL: "registry.internal", CAFile: filepath.Join(t.TempDir(), "missing.pem")}, false},
+		{Registry{URL: "registry.internal", CAFile: certFile}, true},
+	}
+	for _, tt := range tests {
+		if err := tt.registry.ValidateTLS(); (err == nil) != tt.ok {
+			t.Errorf("%+v: want ok %v, got %v", tt.registry, tt.ok, err)
+		}
+	}
+}
+
+func TestHTTPClientRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, certFile, keyFile := writeClientCertificate(t, dir)
+	r := Registry{URL: "registry.internal", CertFile: certFile, KeyFile: keyFile}
+
+	first, err := r.HTTPClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := r.HTTPClient(); c != first {
+		t.Error("want the client reused while the certificate is unchanged")
+	}
+
+	// a renewed certificate has another modification time
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(certFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := r.HTTPClient(); c == first {
+		t.Error("want a new client for the renewed certificate")
+	}
+}
@@ -0,0 +1,193 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tool is an external dependency of the pipeline, distributed as an image or an OCI artifact
+type Tool struct {
+	// Name is what the tool is used for, e.g. 'trivy-db'
+	Name string `yaml:"name"`
+	// Ref is the reference of the tool in its source registry. Tools are pinned by the digest copied into the bundle, or by the
+	// digest of the reference, e.g. 'docker.io/moby/buildkit:v0.15.1-rootless@sha256:...'
+	Ref string `yaml:"ref"`
+	// Artifact tools are not images, so they are copied regardless of the platform
+	Artifact bool `yaml:"artifact"`
+}
+
+// DefaultTools are the versions of the Trivy databases, the Buildkit image and the tooling images Copacetic patches with.
+// The tags of the databases and the base images move, so the bundle pins them to the digest exported, see PinTools
+var DefaultTools = []Tool{
+	{Name: "trivy-db", Ref: "ghcr.io/aquasecurity/trivy-db:2", Artifact: true},
+	{Name: "trivy-java-db", Ref: "ghcr.io/aquasecurity/trivy-java-db:1", Artifact: true},
+	// the rootless image started by import.copacetic.buildkitd.container
+	{Name: "buildkit", Ref: "docker.io/moby/buildkit:v0.15.1-rootless"},
+	{Name: "copa-debian-11", Ref: "docker.io/library/debian:11-slim"},
+	{Name: "copa-debian-12", Ref: "docker.io/library/debian:12-slim"},
+	{Name: "copa-rpm", Ref: "mcr.microsoft.com/cbl-mariner/base/core:2.0"},
+}
+
+// Tool names the pipeline is configured with
+const (
+	TrivyDBTool  = "trivy-db"
+	BuildkitTool = "buildkit"
+)
+
+// trivyEnv are the Trivy server environment variables selecting the database repositories
+var trivyEnv = map[string]string{
+	TrivyDBTool:     "TRIVY_DB_REPOSITORY",
+	"trivy-java-db": "TRIVY_JAVA_DB_REPOSITORY",
+}
+
+// image is the tool as an image, split into its source registry, name and tag
+func (t Tool) image() (Image, string, error) {
+	i, err := RefToImage(t.Ref)
+	if err != nil {
+		return Image{}, "", fmt.Errorf("registry: error parsing tool %s reference '%s' :: %w", t.Name, t.Ref, err)
+	}
+	name, err := i.ImageName()
+	if err != nil {
+		return Image{}, "", err
+	}
+	return i, name, nil
+}
+
+// AddTools copies the tools into the bundle under the name they have in the registries, e.g. 'aquasecurity/trivy-db:2'
+func (b *Bundle) AddTools(ctx context.Context, tools []Tool, arch *string) error {
+	for _, t := range tools {
+		i, name, err := t.image()
+		if err != nil {
+			return err
+		}
+		a := arch
+		if t.Artifact {
+			a = nil
+		}
+		ref, err := i.TagOrDigest()
+		if err != nil {
+			return err
+		}
+		if _, err := b.AddImage(ctx, i.Registry, name, ref, a); err != nil {
+			return fmt.Errorf("registry: error adding tool %s (%s) to bundle :: %w", t.Name, t.Ref, err)
+		}
+	}
+	return nil
+}
+
+// PinTools returns the tools pinned to the digest of their artifact in the bundle, so the tools loaded from the bundle are
+// referenced by digest even though their tags move. Tools must have a tag, as the bundle holds them by tag
+func (b *Bundle) PinTools(ctx context.Context, tools []Tool) ([]Tool, error) {
+	res := make([]Tool, 0, len(tools))
+	for _, t := range tools {
+		i, name, err := t.image()
+		if err != nil {
+			return nil, err
+		}
+		desc, err := b.store.Resolve(ctx, name+":"+i.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("registry: tool %s (%s) is not in the bundle :: %w", t.Name, t.Ref, err)
+		}
+		// the bundle holds the platform manifest of images exported for an architecture, not the pinned index
+		t.Ref = fmt.Sprintf("%s/%s:%s@%s", i.Registry, i.Repository, i.Tag, desc.Digest)
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// TrivyDBs returns the Trivy databases among the tools
+func TrivyDBs(tools []Tool) []Tool {
+	res := []Tool{}
+	for _, t := range tools {
+		if _, ok := trivyEnv[t.Name]; ok {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// ToolRef returns the reference of the tool in the registry, e.g. 'registry.internal/aquasecurity/trivy-db:2'
+func (r Registry) ToolRef(t Tool) (string, error) {
+	i, name, err := t.image()
+	if err != nil {
+		return "", err
+	}
+	ref, err := i.TagOrDigest()
+	if err != nil {
+		return "", err
+	}
+	return r.Ref(name, ref), nil
+}
+
+// PushTool copies the tool from its source registry to the registry under the name it has in the registries
+func (r Registry) PushTool(ctx context.Context, t Tool, arch *string) error {
+	i, name, err := t.image()
+	if err != nil {
+		return err
+	}
+	if t.Artifact {
+		arch = nil
+	}
+	ref, err := i.TagOrDigest()
+	if err != nil {
+		return err
+	}
+	if _, err := r.Push(ctx, i.Registry, name, ref, arch); err != nil {
+		return fmt.Errorf("registry: error pushing tool %s (%s) to %s :: %w", t.Name, t.Ref, r.Name, err)
+	}
+	return nil
+}
+
+// TrivyEnv returns the environment of the Trivy server to download its databases from the tools loaded into the registry
+func TrivyEnv(tools []Tool, r Registry) (string, error) {
+	lines := []string{}
+	for _, t := range tools {
+		env, ok := trivyEnv[t.Name]
+		if !ok {
+			continue
+		}
+		ref, err := r.ToolRef(t)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%s=%s", env, ref))
+	}
+	if r.Insecure || r.PlainHTTP {
+		lines = append(lines, "TRIVY_INSECURE=true")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// BuildkitConfig returns a buildkitd.toml mirroring the source registries of the image tools to the registry,
+// so Buildkit pulls the Copacetic tooling images from the tools loaded into the registry
+func BuildkitConfig(tools []Tool, r Registry) (string, error) {
+	hosts := map[string]bool{}
+	for _, t := range tools {
+		if t.Artifact {
+			continue
+		}
+		i, _, err := t.image()
+		if err != nil {
+			return "", err
+		}
+		hosts[normalizeHost(i.Registry)] = true
+	}
+	sorted := make([]string, 0, len(hosts))
+	for h := range hosts {
+		sorted = append(sorted, h)
+	}
+	sort.Strings(sorted)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Generated by helmper: pull the tooling images from %s\n", r.URL)
+	for _, h := range sorted {
+		fmt.Fprintf(&sb, "\n[registry.%q]\n  mirrors = [%q]\n", h, r.URL)
+	}
+	if r.Insecure || r.PlainHTTP {
+		fmt.Fprintf(&sb, "\n[registry.%q]\n  http = %t\n  insecure = %t\n", r.Host(), r.PlainHTTP, r.Insecure)
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"oras.land/oras-go/v2"
+)
+
+func TestTrivyEnv(t *testing.T) {
+	env, err := TrivyEnv(DefaultTools, Registry{URL: "registry.internal/tools"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "TRIVY_DB_REPOSITORY=registry.internal/tools/aquasecurity/trivy-db:2\nTRIVY_JAVA_DB_REPOSITORY=registry.internal/tools/aquasecurity/trivy-java-db:1\n"
+	if env != want {
+		t.Errorf("want %q got %q", want, env)
+	}
+}
+
+func TestBuildkitConfig(t *testing.T) {
+	c, err := BuildkitConfig(DefaultTools, Registry{URL: "0.0.0.0:5000/tools", PlainHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"[registry.\"docker.io\"]\n  mirrors = [\"0.0.0.0:5000/tools\"]",
+		"[registry.\"mcr.microsoft.com\"]\n  mirrors = [\"0.0.0.0:5000/tools\"]",
+		"[registry.\"0.0.0.0:5000\"]\n  http = true",
+	} {
+		if !strings.Contains(c, want) {
+			t.Errorf("want %q in\n%s", want, c)
+		}
+	}
+	if strings.Contains(c, "ghcr.io") {
+		t.Errorf("artifacts are not pulled by Buildkit\n%s", c)
+	}
+}
+
+func TestTrivyDBs(t *testing.T) {
+	dbs := TrivyDBs(DefaultTools)
+	if len(dbs) != 2 {
+		t.Fatalf("want 2 databases got %d", len(dbs))
+	}
+	ref, err := Registry{URL: "registry.internal/tools"}.ToolRef(dbs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "registry.internal/tools/aquasecurity/trivy-db:2"; ref != want {
+		t.Errorf("want %s got %s", want, ref)
+	}
+}
+
+func TestPinTools(t *testing.T) {
+	ctx := context.Background()
+	b, err := OpenBundle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, err := oras.PushBytes(ctx, b.store, "application/vnd.aquasec.trivy.config.v1+json", []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.store.Tag(ctx, desc, "aquasecurity/trivy-db:2"); err != nil {
+		t.Fatal(err)
+	}
+
+	tools, err := b.PinTools(ctx, DefaultTools[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := Registry{URL: "registry.internal/tools"}.ToolRef(tools[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "registry.internal/tools/aquasecurity/trivy-db:2@" + desc.Digest.String(); ref != want {
+		t.Errorf("want %s got %s", want, ref)
+	}
+	if DefaultTools[0].Ref != "ghcr.io/aquasecurity/trivy-db:2" {
+		t.Error("defaults must not be modified")
+	}
+
+	if _, err := b.PinTools(ctx, DefaultTools[1:2]); err == nil {
+		t.Error("want an error for a tool missing from the bundle")
+	}
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/ChristofferNissen/helmper/pkg/plan"
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+	"golang.org/x/sync/errgroup"
+)
+
+// Warmed is the result of pulling an image through a cache. Cache is empty if no cache proxies the registry of the image
+type Warmed struct {
+	Image  string
+	Cache  string
+	Digest string
+	Err    error
+}
+
+// WarmOption pulls the images through the pull-through caches proxying their registries, without pushing them anywhere
+type WarmOption struct {
+	Imgs   []*Image
+	Caches []Cache
+
+	Architecture *string
+
+	// Concurrency limits the number of images pulled in parallel. Zero or less is unlimited
+	Concurrency int
+	// Retries is the number of times a failed pull of an image is retried, with exponential backoff
+	Retries int
+	Backoff Backoff
+
+	// DryRun records the pulls in Plan instead of performing them
+	DryRun bool
+	Plan   *plan.Plan
+}
+
+// Run pulls every image through the first cache proxying its registry. Failed pulls are reported in the results, and do not stop the other pulls
+func (wo WarmOption) Run(ctx context.Context) ([]Warmed, error) {
+	slog.Debug("pulling images through pull-through caches..")
+
+	bar := terminal.NewBar(len(wo.Imgs), "Warming caches...\r")
+
+	var mu sync.Mutex
+	res := make([]Warmed, 0, len(wo.Imgs))
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	if wo.Concurrency > 0 {
+		eg.SetLimit(wo.Concurrency)
+	}
+	for _, i := range wo.Imgs {
+		ref, err := i.String()
+		if err != nil {
+			return nil, err
+		}
+
+		var cache *Cache
+		for _, c := range wo.Caches {
+			if c.Proxies(*i) {
+				cache = &c
+				break
+			}
+		}
+
+		if cache == nil {
+			slog.Debug("no pull-through cache proxies the registry of the image", slog.String("image", ref))
+			// the pulls started earlier append concurrently
+			mu.Lock()
+			res = append(res, Warmed{Image: ref})
+			mu.Unlock()
+			_ = bar.Add(1)
+			continue
+		}
+
+		if wo.DryRun {
+			wo.Plan.Add(plan.Action{
+				Kind:         plan.WarmImage,
+				Source:       ref,
+				Target:       cache.Ref(*i),
+				Architecture: wo.Architecture,
+				Insecure:     cache.Insecure,
+				PlainHTTP:    cache.PlainHTTP,
+			})
+			_ = bar.Add(1)
+			continue
+		}
+
+		eg.Go(func() error {
+			w := Warmed{Image: ref, Cache: cache.URL}
+			w.Err = withRetry(egCtx, wo.Retries, wo.Backoff, func() error {
+				desc, err := cache.Warm(egCtx, *i, wo.Architecture)
+				if err != nil {
+					return err
+				}
+				w.Digest = desc.Digest.String()
+				return nil
+			})
+			if w.Err != nil {
+				slog.Error("error warming cache", slog.String("image", ref), slog.String("cache", cache.URL), slog.String("error", w.Err.Error()))
+			}
+
+			mu.Lock()
+			res = append(res, w)
+			mu.Unlock()
+			_ = bar.Add(1)
+			return nil
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	_ = bar.Finish()
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Image < res[j].Image })
+	return res, nil
+}
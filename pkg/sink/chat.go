@@ -0,0 +1,157 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxListed is the number of new images and failures listed in chat messages, the rest are counted
+const maxListed = 10
+
+// Slack posts a message with the summary of the run to a Slack incoming webhook. Reports and notifications are not sent, as the message already describes the run
+type Slack struct {
+	Webhook
+}
+
+var _ Sink = Slack{}
+
+// Teams posts an Adaptive Card with the summary of the run to a Microsoft Teams incoming webhook or workflow. Reports and notifications are not sent
+type Teams struct {
+	Webhook
+}
+
+var _ Sink = Teams{}
+
+// title is the headline of chat messages about the run
+func title(s Summary) string {
+	if s.Error != "" {
+		return fmt.Sprintf("helmper %s run failed", s.Version)
+	}
+	return fmt.Sprintf("helmper %s run completed", s.Version)
+}
+
+// list is the items as a markdown list, cut after maxListed items
+func list(items []string) string {
+	var b strings.Builder
+	for i, item := range items {
+		if i == maxListed {
+			fmt.Fprintf(&b, "\n- and %d more", len(items)-maxListed)
+			break
+		}
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "- `%s`", item)
+	}
+	return b.String()
+}
+
+// sections describe the run in markdown, with headings in the bold markup of the chat
+func sections(s Summary, bold string) []string {
+	h := func(t string) string { return bold + t + bold }
+	ss := []string{}
+	if s.Error != "" {
+		ss = append(ss, fmt.Sprintf("%s\n%s", h("Error"), s.Error))
+	}
+	ss = append(ss, fmt.Sprintf("%s\n%d charts and %d images, %d new", h("Imported"), len(s.Charts), s.Images, len(s.New)))
+	if len(s.New) > 0 {
+		ss = append(ss, fmt.Sprintf("%s\n%s", h("New images"), list(s.New)))
+	}
+	ss = append(ss, fmt.Sprintf("%s\n%d images, %d vulnerabilities fixed, %d left", h("Patched"), s.Patched, s.Fixed, s.Vulnerabilities))
+	if len(s.Failures) > 0 {
+		ss = append(ss, fmt.Sprintf("%s\n%s", h("Failures"), list(s.Failures)))
+	}
+	return ss
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type string     `json:"type"`
+	Text *slackText `json:"text,omitempty"`
+}
+
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+func (s Slack) WriteSummary(ctx context.Context, sum Summary) error {
+	m := slackMessage{
+		Text:   sum.String(),
+		Blocks: []slackBlock{{Type: "header", Text: &slackText{Type: "plain_text", Text: title(sum)}}},
+	}
+	for _, t := range sections(sum, "*") {
+		// Slack lists are plain lines
+		t = strings.ReplaceAll(t, "\n- ", "\n• ")
+		m.Blocks = append(m.Blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: t}})
+	}
+	return s.post(ctx, m)
+}
+
+func (Slack) WriteReport(context.Context, string, io.Reader) error {
+	return nil
+}
+
+func (Slack) Notify(context.Context, string) error {
+	return nil
+}
+
+type teamsBlock struct {
+	Type   string `json:"type"`
+	Text   string `json:"text"`
+	Wrap   bool   `json:"wrap"`
+	Size   string `json:"size,omitempty"`
+	Weight string `json:"weight,omitempty"`
+	Color  string `json:"color,omitempty"`
+}
+
+type teamsCard struct {
+	Schema  string       `json:"$schema"`
+	Type    string       `json:"type"`
+	Version string       `json:"version"`
+	Body    []teamsBlock `json:"body"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+func (t Teams) WriteSummary(ctx context.Context, s Summary) error {
+	heading := teamsBlock{Type: "TextBlock", Text: title(s), Wrap: true, Size: "Large", Weight: "Bolder"}
+	if s.Error != "" || len(s.Failures) > 0 {
+		heading.Color = "Attention"
+	}
+	card := teamsCard{
+		Schema:  "http://adaptivecards.io/schemas/adaptive-card.json",
+		Type:    "AdaptiveCard",
+		Version: "1.4",
+		Body:    []teamsBlock{heading},
+	}
+	for _, text := range sections(s, "**") {
+		card.Body = append(card.Body, teamsBlock{Type: "TextBlock", Text: text, Wrap: true})
+	}
+	return t.post(ctx, teamsMessage{
+		Type:        "message",
+		Attachments: []teamsAttachment{{ContentType: "application/vnd.microsoft.card.adaptive", Content: card}},
+	})
+}
+
+func (Teams) WriteReport(context.Context, string, io.Reader) error {
+	return nil
+}
+
+func (Teams) Notify(context.Context, string) error {
+	return nil
+}
@@ -0,0 +1,90 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSlack(t *testing.T) {
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	s := summary
+	s.New = []string{"quay.io/prometheus/prometheus:v2.48.0"}
+	s.Failures = []string{"docker.io/library/nginx:1.25 to myregistry.io: unauthorized"}
+	if err := (Slack{Webhook: Webhook{URL: srv.URL}}).WriteSummary(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Text != s.String() || len(got.Blocks) != 5 || got.Blocks[0].Type != "header" {
+		t.Fatalf("unexpected message %+v", got)
+	}
+	if text := got.Blocks[2].Text.Text; text != "*New images*\n• `quay.io/prometheus/prometheus:v2.48.0`" {
+		t.Errorf("unexpected new images %q", text)
+	}
+}
+
+func TestTeams(t *testing.T) {
+	var got teamsMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	s := summary
+	s.Error = "unauthorized"
+	if err := (Teams{Webhook: Webhook{URL: srv.URL}}).WriteSummary(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got.Attachments) != 1 || got.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+		t.Fatalf("unexpected message %+v", got)
+	}
+	body := got.Attachments[0].Content.Body
+	if len(body) != 4 || body[0].Color != "Attention" || !strings.HasPrefix(body[1].Text, "**Error**") {
+		t.Errorf("unexpected card %+v", body)
+	}
+}
+
+func TestList(t *testing.T) {
+	items := []string{}
+	for i := range 12 {
+		items = append(items, fmt.Sprintf("image-%d", i))
+	}
+	l := list(items)
+	if !strings.HasSuffix(l, "- `image-9`\n- and 2 more") || strings.Contains(l, "image-10") {
+		t.Errorf("unexpected list %q", l)
+	}
+}
+
+func TestWants(t *testing.T) {
+	unchanged := Summary{Images: 3}
+	tests := []struct {
+		when string
+		s    Summary
+		want bool
+	}{
+		{"", unchanged, true},
+		{WhenChanges, unchanged, false},
+		{WhenChanges, Summary{New: []string{"nginx:1.25"}}, true},
+		{WhenFailure, Summary{Patched: 1}, false},
+		{WhenFailure, Summary{Error: "unauthorized"}, true},
+	}
+	for _, tt := range tests {
+		if got := (Config{When: tt.when}).Wants(tt.s); got != tt.want {
+			t.Errorf("when %q for %+v: want %v got %v", tt.when, tt.s, tt.want, got)
+		}
+	}
+}
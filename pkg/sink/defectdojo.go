@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// DefectDojo re-imports the Trivy report of every image into the product of the image, so findings are tracked across runs.
+// Products, engagements and product types are created as needed. SBOMs, summaries and notifications are not sent
+type DefectDojo struct {
+	URL string
+	// Token is the API v2 key. Environment variables are expanded
+	Token    string
+	Projects []registry.Rewrite
+	// Engagement the reports are imported into. Defaults to 'helmper'
+	Engagement string
+	// ProductType of created products. Defaults to 'helmper'
+	ProductType string
+
+	client *http.Client
+}
+
+var (
+	_ Sink              = DefectDojo{}
+	_ ImageReportWriter = DefectDojo{}
+)
+
+func (d DefectDojo) WriteImageReport(ctx context.Context, r ImageReport, body io.Reader) error {
+	if r.Kind != KindVulnerabilities {
+		return nil
+	}
+	product, version, err := project(r.Image, d.Projects)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for k, v := range map[string]string{
+		"scan_type":           "Trivy Scan",
+		"product_name":        product,
+		"product_type_name":   withDefault(d.ProductType, "helmper"),
+		"engagement_name":     withDefault(d.Engagement, "helmper"),
+		"test_title":          r.Image,
+		"version":             version,
+		"auto_create_context": "true",
+		"close_old_findings":  "true",
+	} {
+		if err := w.WriteField(k, v); err != nil {
+			return err
+		}
+	}
+	f, err := w.CreateFormFile("file", path.Base(product)+".json")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(os.ExpandEnv(d.URL), "/")+"/api/v2/reimport-scan/", &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", "Token "+os.ExpandEnv(d.Token))
+
+	res, err := apiClient(d.client).Do(req)
+	if err != nil {
+		return fmt.Errorf("sink: error uploading report of %s to DefectDojo :: %w", r.Image, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("sink: DefectDojo responded with status %s to the report of %s: %s", res.Status, r.Image, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (DefectDojo) WriteSummary(context.Context, Summary) error {
+	return nil
+}
+
+func (DefectDojo) WriteReport(context.Context, string, io.Reader) error {
+	return nil
+}
+
+func (DefectDojo) Notify(context.Context, string) error {
+	return nil
+}
+
+func withDefault(v string, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
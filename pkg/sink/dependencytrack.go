@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// DependencyTrack uploads the CycloneDX SBOM of every image to the project and version of the image, creating them as needed.
+// Dependency-Track only accepts CycloneDX, so other SBOMs, vulnerability reports, summaries and notifications are not sent
+type DependencyTrack struct {
+	URL string
+	// Token is the API key. Environment variables are expanded
+	Token    string
+	Projects []registry.Rewrite
+
+	client *http.Client
+}
+
+var (
+	_ Sink              = DependencyTrack{}
+	_ ImageReportWriter = DependencyTrack{}
+)
+
+func (d DependencyTrack) WriteImageReport(ctx context.Context, r ImageReport, body io.Reader) error {
+	if r.Kind != KindSBOM {
+		return nil
+	}
+	bom, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	var format struct {
+		BOMFormat string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(bom, &format); err != nil || format.BOMFormat != "CycloneDX" {
+		slog.Debug("skipping SBOM that is not CycloneDX JSON for Dependency-Track", slog.String("image", r.Image))
+		return nil
+	}
+
+	name, version, err := project(r.Image, d.Projects)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]any{
+		"projectName":    name,
+		"projectVersion": version,
+		"autoCreate":     true,
+		"bom":            base64.StdEncoding.EncodeToString(bom),
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(os.ExpandEnv(d.URL), "/")+"/api/v1/bom", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", os.ExpandEnv(d.Token))
+
+	res, err := apiClient(d.client).Do(req)
+	if err != nil {
+		return fmt.Errorf("sink: error uploading SBOM of %s to Dependency-Track :: %w", r.Image, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("sink: Dependency-Track responded with status %s to the SBOM of %s: %s", res.Status, r.Image, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+func (DependencyTrack) WriteSummary(context.Context, Summary) error {
+	return nil
+}
+
+func (DependencyTrack) WriteReport(context.Context, string, io.Reader) error {
+	return nil
+}
+
+func (DependencyTrack) Notify(context.Context, string) error {
+	return nil
+}
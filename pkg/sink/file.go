@@ -0,0 +1,60 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes the summary to 'summary.json' and the reports to 'reports/' in the folder, and appends notifications to 'notifications.log'
+type File struct {
+	Path string
+}
+
+var _ Sink = File{}
+
+func (f File) WriteSummary(_ context.Context, s Summary) error {
+	if err := os.MkdirAll(f.Path, 0o755); err != nil {
+		return fmt.Errorf("sink: error creating folder %s :: %w", f.Path, err)
+	}
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(f.Path, "summary.json"), b, 0o644)
+}
+
+func (f File) WriteReport(_ context.Context, name string, r io.Reader) error {
+	path := filepath.Join(f.Path, "reports", filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("sink: error creating folder %s :: %w", filepath.Dir(path), err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (f File) Notify(_ context.Context, msg string) error {
+	if err := os.MkdirAll(f.Path, 0o755); err != nil {
+		return fmt.Errorf("sink: error creating folder %s :: %w", f.Path, err)
+	}
+	out, err := os.OpenFile(filepath.Join(f.Path, "notifications.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(out, "%s %s\n", time.Now().UTC().Format(time.RFC3339), msg); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/distribution/reference"
+)
+
+// project returns the project and version the reports of the image are uploaded to, from the first matching rule.
+// The version is the tag of the image, or its digest
+func project(image string, rules []registry.Rewrite) (string, string, error) {
+	ref, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", "", err
+	}
+	name, version := ref.Name(), ""
+	if t, ok := ref.(reference.Tagged); ok {
+		version = t.Tag()
+	} else if d, ok := ref.(reference.Digested); ok {
+		version = d.Digest().String()
+	}
+
+	for _, r := range rules {
+		p, ok, err := r.Apply(name)
+		if err != nil {
+			return "", "", err
+		}
+		if ok {
+			return p, version, nil
+		}
+	}
+	return name, version, nil
+}
+
+// apiClient is the HTTP client of the security tool sinks, or the default with a timeout for uploads
+func apiClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: 2 * time.Minute}
+}
@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/s3client"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3API is the part of the S3 client used by the sink
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3 stores the summary as '<prefix>/summary.json', the reports under '<prefix>/reports/' and every notification as an object under '<prefix>/notifications/'
+type S3 struct {
+	Bucket string
+	Prefix string
+
+	api s3API
+}
+
+var _ Sink = S3{}
+
+// newS3 connects to S3 in the region using the default AWS credential chain (environment, shared config, instance roles)
+func newS3(ctx context.Context, bucket string, prefix string, region string) (S3, error) {
+	api, err := s3client.New(ctx, region)
+	if err != nil {
+		return S3{}, fmt.Errorf("sink: error loading AWS configuration :: %w", err)
+	}
+	return S3{Bucket: bucket, Prefix: prefix, api: api}, nil
+}
+
+func (s S3) put(ctx context.Context, key string, contentType string, r io.Reader) error {
+	// the SDK requires a seekable body to sign the request
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	key = path.Join(s.Prefix, key)
+	_, err = s.api.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(b),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("sink: error writing s3://%s/%s :: %w", s.Bucket, key, err)
+	}
+	return nil
+}
+
+func (s S3) WriteSummary(ctx context.Context, sum Summary) error {
+	b, err := json.MarshalIndent(sum, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.put(ctx, "summary.json", "application/json", bytes.NewReader(b))
+}
+
+func (s S3) WriteReport(ctx context.Context, name string, r io.Reader) error {
+	return s.put(ctx, path.Join("reports", name), "application/json", r)
+}
+
+func (s S3) Notify(ctx context.Context, msg string) error {
+	key := path.Join("notifications", time.Now().UTC().Format("20060102T150405.000000000Z")+".txt")
+	return s.put(ctx, key, "text/plain", bytes.NewReader([]byte(msg)))
+}
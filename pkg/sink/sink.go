@@ -0,0 +1,156 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+)
+
+// Summary of a run
+type Summary struct {
+	Version string `json:"version" yaml:"version"`
+	Commit  string `json:"commit" yaml:"commit"`
+	// Date is when the Helmper binary was built
+	Date string    `json:"date" yaml:"date"`
+	Time time.Time `json:"time" yaml:"time"`
+	// Charts are the imported charts as '<name>:<version>'
+	Charts  []string `json:"charts" yaml:"charts"`
+	Images  int      `json:"images" yaml:"images"`
+	Patched int      `json:"patched" yaml:"patched"`
+	// Vulnerabilities is the number of vulnerabilities left in the images after patching, and Fixed the number fixed by patching
+	Vulnerabilities int `json:"vulnerabilities" yaml:"vulnerabilities"`
+	Fixed           int `json:"fixed" yaml:"fixed"`
+	// New are the images copied to the registries by the run, and Failures the images that could not be pushed
+	New      []string `json:"new,omitempty" yaml:"new,omitempty"`
+	Failures []string `json:"failures,omitempty" yaml:"failures,omitempty"`
+	// Error is set if the run failed
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// String is a one-line description of the run, used for notifications
+func (s Summary) String() string {
+	if s.Error != "" {
+		return fmt.Sprintf("helmper %s run failed: %s", s.Version, s.Error)
+	}
+	msg := fmt.Sprintf("helmper %s imported %d charts (%s) and %d images (%d new), patched %d images, %d vulnerabilities fixed, %d left",
+		s.Version, len(s.Charts), strings.Join(s.Charts, ", "), s.Images, len(s.New), s.Patched, s.Fixed, s.Vulnerabilities)
+	if len(s.Failures) > 0 {
+		msg += fmt.Sprintf(", %d images failed", len(s.Failures))
+	}
+	return msg
+}
+
+// Changed reports whether the run imported new images, patched images or failed
+func (s Summary) Changed() bool {
+	return len(s.New) > 0 || s.Patched > 0 || len(s.Failures) > 0 || s.Error != ""
+}
+
+// Sink is a destination for the summary and reports of runs. Sinks ignore what they cannot store
+type Sink interface {
+	// WriteSummary stores the summary of the run
+	WriteSummary(ctx context.Context, s Summary) error
+	// WriteReport stores a report, e.g. a Trivy report or an SBOM, under the relative path name
+	WriteReport(ctx context.Context, name string, r io.Reader) error
+	// Notify sends a short message about the run
+	Notify(ctx context.Context, msg string) error
+}
+
+// ImageReportWriter is implemented by sinks storing the reports of every image in a project of the image, e.g. security tools.
+// They are given every report with the image it describes, in addition to WriteReport
+type ImageReportWriter interface {
+	WriteImageReport(ctx context.Context, r ImageReport, body io.Reader) error
+}
+
+// Kinds of image reports
+const (
+	KindVulnerabilities = "vulnerabilities"
+	KindSBOM            = "sbom"
+)
+
+// ImageReport is a report about an image, e.g. the Trivy report or the SBOM of 'docker.io/library/nginx:1.25'
+type ImageReport struct {
+	Image string
+	Kind  string
+}
+
+const (
+	TypeFile            = "file"
+	TypeS3              = "s3"
+	TypeWebhook         = "webhook"
+	TypeStdout          = "stdout"
+	TypeDefectDojo      = "defectdojo"
+	TypeDependencyTrack = "dependencytrack"
+	TypeSlack           = "slack"
+	TypeTeams           = "teams"
+)
+
+// When sinks receive runs
+const (
+	WhenAlways  = "always"
+	WhenChanges = "changes"
+	WhenFailure = "failure"
+)
+
+// Config selects and configures a sink
+type Config struct {
+	Type string
+	// Path is the folder of file sinks
+	Path string
+	// Bucket, Prefix and Region locate the objects of S3 sinks
+	Bucket string
+	Prefix string
+	Region string
+	// URL and Headers configure webhook, Slack and Teams sinks. URL is also the base URL of DefectDojo and Dependency-Track
+	URL     string
+	Headers map[string]string
+	// Token is the API key of DefectDojo and Dependency-Track
+	Token string
+	// Projects map the repositories of images to the projects their reports are uploaded to. The first matching rule applies,
+	// images without a match are uploaded to a project named after their repository
+	Projects []registry.Rewrite
+	// Engagement and ProductType are the DefectDojo engagement and product type of the products created for images
+	Engagement  string
+	ProductType string
+	// When the sink receives runs: always, on changes (new or patched images, failures) or on failures. Defaults to always
+	When string
+}
+
+// Wants reports whether the sink receives the run
+func (c Config) Wants(s Summary) bool {
+	switch c.When {
+	case WhenChanges:
+		return s.Changed()
+	case WhenFailure:
+		return s.Error != "" || len(s.Failures) > 0
+	default:
+		return true
+	}
+}
+
+// New creates the sink selected by the configuration
+func New(ctx context.Context, c Config) (Sink, error) {
+	switch c.Type {
+	case TypeFile:
+		return File{Path: c.Path}, nil
+	case TypeS3:
+		return newS3(ctx, c.Bucket, c.Prefix, c.Region)
+	case TypeWebhook:
+		return Webhook{URL: c.URL, Headers: c.Headers}, nil
+	case TypeSlack:
+		return Slack{Webhook: Webhook{URL: c.URL, Headers: c.Headers}}, nil
+	case TypeTeams:
+		return Teams{Webhook: Webhook{URL: c.URL, Headers: c.Headers}}, nil
+	case TypeStdout:
+		return Stdout{}, nil
+	case TypeDefectDojo:
+		return DefectDojo{URL: c.URL, Token: c.Token, Projects: c.Projects, Engagement: c.Engagement, ProductType: c.ProductType}, nil
+	case TypeDependencyTrack:
+		return DependencyTrack{URL: c.URL, Token: c.Token, Projects: c.Projects}, nil
+	default:
+		return nil, fmt.Errorf("sink: unsupported sink type '%s'", c.Type)
+	}
+}
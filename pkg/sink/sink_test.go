@@ -0,0 +1,200 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+var summary = Summary{Version: "v0.1.0", Charts: []string{"prometheus:25.8.0"}, Images: 3, Patched: 1, Vulnerabilities: 2}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	f := File{Path: t.TempDir()}
+
+	if err := f.WriteSummary(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.WriteReport(ctx, "prometheus/25.8.0/postscan/nginx.json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Notify(ctx, "done"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(f.Path, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Summary
+	if err := json.Unmarshal(b, &s); err != nil || s.Images != 3 {
+		t.Errorf("unexpected summary %s", b)
+	}
+	if _, err := os.Stat(filepath.Join(f.Path, "reports", "prometheus", "25.8.0", "postscan", "nginx.json")); err != nil {
+		t.Error(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(f.Path, "notifications.log")); !strings.HasSuffix(string(b), " done\n") {
+		t.Errorf("unexpected notifications %q", b)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var got []webhookMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var m webhookMessage
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			t.Error(err)
+		}
+		got = append(got, m)
+	}))
+	defer srv.Close()
+
+	t.Setenv("WEBHOOK_TOKEN", "token")
+	w := Webhook{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer ${WEBHOOK_TOKEN}"}}
+	ctx := context.Background()
+	if err := w.WriteSummary(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Notify(ctx, "done"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the summary already holds the message, so notifications are not posted again
+	if len(got) != 1 || got[0].Summary == nil || got[0].Text != summary.String() {
+		t.Errorf("unexpected messages %+v", got)
+	}
+
+	if err := (Webhook{URL: srv.URL}).WriteSummary(ctx, summary); err == nil {
+		t.Error("want error on unauthorized")
+	}
+
+	err := (Webhook{URL: "http://127.0.0.1:1/services/T000/B000/XXXX"}).WriteSummary(ctx, summary)
+	if err == nil || strings.Contains(err.Error(), "XXXX") {
+		t.Errorf("want error without the webhook path, got %v", err)
+	}
+}
+
+type fakeS3 struct {
+	objects map[string]string
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = string(b)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestS3(t *testing.T) {
+	f := &fakeS3{objects: map[string]string{}}
+	s := S3{Bucket: "reports", Prefix: "helmper/prod", api: f}
+	ctx := context.Background()
+
+	if err := s.WriteSummary(ctx, summary); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteReport(ctx, "nginx.json", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := f.objects["reports/helmper/prod/summary.json"]; !ok {
+		t.Errorf("want summary object got %v", f.objects)
+	}
+	if f.objects["reports/helmper/prod/reports/nginx.json"] != "{}" {
+		t.Errorf("want report object got %v", f.objects)
+	}
+}
+
+func TestProject(t *testing.T) {
+	rules := []registry.Rewrite{{From: "quay.io/prometheus/*", To: "prometheus"}}
+	for image, want := range map[string][2]string{
+		"quay.io/prometheus/node-exporter:v1.8.0": {"prometheus", "v1.8.0"},
+		"nginx:1.25": {"docker.io/library/nginx", "1.25"},
+		"ghcr.io/org/app@sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80": {"ghcr.io/org/app", "sha256:4cb2b9019f1757be8482419002cb7afe028fdba35d47958829e4cfeaf6246d80"},
+	} {
+		p, v, err := project(image, rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != want[0] || v != want[1] {
+			t.Errorf("%s: want %v got %s %s", image, want, p, v)
+		}
+	}
+}
+
+func TestDefectDojo(t *testing.T) {
+	fields := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/reimport-scan/" || r.Header.Get("Authorization") != "Token key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+		}
+		for k, v := range r.MultipartForm.Value {
+			fields[k] = v[0]
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	d := DefectDojo{URL: srv.URL, Token: "key"}
+	if err := d.WriteImageReport(ctx, ImageReport{Image: "docker.io/library/nginx:1.25", Kind: KindVulnerabilities}, strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if fields["scan_type"] != "Trivy Scan" || fields["product_name"] != "docker.io/library/nginx" || fields["version"] != "1.25" || fields["engagement_name"] != "helmper" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	d.Token = "wrong"
+	if err := d.WriteImageReport(ctx, ImageReport{Image: "nginx:1.25", Kind: KindSBOM}, strings.NewReader("{}")); err != nil {
+		t.Errorf("want SBOMs to be skipped got %v", err)
+	}
+	if err := d.WriteImageReport(ctx, ImageReport{Image: "nginx:1.25", Kind: KindVulnerabilities}, strings.NewReader("{}")); err == nil {
+		t.Error("want error for a rejected upload")
+	}
+}
+
+func TestDependencyTrack(t *testing.T) {
+	var got map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/v1/bom" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	d := DependencyTrack{URL: srv.URL, Token: "key", Projects: []registry.Rewrite{{From: "docker.io/library/*", To: "dockerhub-*"}}}
+	if err := d.WriteImageReport(ctx, ImageReport{Image: "nginx:1.25", Kind: KindSBOM}, strings.NewReader(`{"spdxVersion": "SPDX-2.3"}`)); err != nil || got != nil {
+		t.Errorf("want SPDX SBOMs to be skipped got %v %v", err, got)
+	}
+	if err := d.WriteImageReport(ctx, ImageReport{Image: "nginx:1.25", Kind: KindSBOM}, strings.NewReader(`{"bomFormat": "CycloneDX"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got["projectName"] != "dockerhub-nginx" || got["projectVersion"] != "1.25" || got["autoCreate"] != true {
+		t.Errorf("unexpected upload %v", got)
+	}
+}
@@ -0,0 +1,34 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/terminal"
+)
+
+// Stdout prints the summary as JSON and the notifications. Reports are only listed by name
+type Stdout struct{}
+
+var _ Sink = Stdout{}
+
+func (Stdout) WriteSummary(_ context.Context, s Summary) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(terminal.Stdout, string(b))
+	return err
+}
+
+func (Stdout) WriteReport(_ context.Context, name string, _ io.Reader) error {
+	_, err := fmt.Fprintf(terminal.Stdout, "report: %s\n", name)
+	return err
+}
+
+func (Stdout) Notify(_ context.Context, msg string) error {
+	_, err := fmt.Fprintln(terminal.Stdout, msg)
+	return err
+}
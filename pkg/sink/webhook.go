@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/redact"
+)
+
+// Webhook posts the summary as JSON to the URL. The 'text' field holds a one-line message, so Slack and Teams incoming webhooks work as-is.
+// Reports and notifications are not sent, as the summary already holds the message of the run
+type Webhook struct {
+	URL string
+	// Headers are added to every request, e.g. for authorization. Environment variables are expanded in the URL and the headers
+	Headers map[string]string
+
+	client *http.Client
+}
+
+var _ Sink = Webhook{}
+
+type webhookMessage struct {
+	Text    string   `json:"text"`
+	Summary *Summary `json:"summary,omitempty"`
+}
+
+func (w Webhook) post(ctx context.Context, m any) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	url := os.ExpandEnv(w.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return redact.URLError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	client := w.client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sink: error posting to webhook :: %w", redact.URLError(err))
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("sink: webhook responded with status %s", res.Status)
+	}
+	return nil
+}
+
+func (w Webhook) WriteSummary(ctx context.Context, s Summary) error {
+	return w.post(ctx, webhookMessage{Text: s.String(), Summary: &s})
+}
+
+func (Webhook) WriteReport(context.Context, string, io.Reader) error {
+	return nil
+}
+
+func (Webhook) Notify(context.Context, string) error {
+	return nil
+}
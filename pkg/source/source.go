@@ -0,0 +1,88 @@
+package source
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ChristofferNissen/helmper/pkg/helm"
+	"github.com/ChristofferNissen/helmper/pkg/registry"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// Source is an input of images besides the charts: a kustomization directory or plain manifests
+type Source struct {
+	Name string
+	// Kustomize is the directory of the kustomization, built like 'kustomize build'
+	Kustomize string
+	// Manifests are the files of the manifests, or glob patterns of them, e.g. 'deploy/*.yaml'
+	Manifests []string
+}
+
+// Render returns the manifests of the source as a multi-document YAML stream
+func (s Source) Render() (string, error) {
+	if s.Kustomize != "" {
+		k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+		rm, err := k.Run(filesys.MakeFsOnDisk(), s.Kustomize)
+		if err != nil {
+			return "", fmt.Errorf("source: error building kustomization %s :: %w", s.Kustomize, err)
+		}
+		b, err := rm.AsYaml()
+		if err != nil {
+			return "", fmt.Errorf("source: error rendering kustomization %s :: %w", s.Kustomize, err)
+		}
+		return string(b), nil
+	}
+
+	files, err := s.files()
+	if err != nil {
+		return "", err
+	}
+	docs := make([]string, 0, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return "", fmt.Errorf("source: error reading manifest %s :: %w", f, err)
+		}
+		docs = append(docs, string(b))
+	}
+	return strings.Join(docs, "\n---\n"), nil
+}
+
+// files returns the files of the manifests, with the glob patterns expanded, in order
+func (s Source) files() ([]string, error) {
+	res := []string{}
+	for _, m := range s.Manifests {
+		fs, err := filepath.Glob(m)
+		if err != nil {
+			return nil, fmt.Errorf("source: invalid manifest pattern %s :: %w", m, err)
+		}
+		if len(fs) == 0 {
+			return nil, fmt.Errorf("source: no manifests match %s", m)
+		}
+		sort.Strings(fs)
+		res = append(res, fs...)
+	}
+	return res, nil
+}
+
+// Images returns the images referenced in the manifests of the source. Their paths are the resources referencing them,
+// prefixed with the name of the source, e.g. 'monitoring:Deployment/nginx'
+func (s Source) Images() (map[*registry.Image][]string, error) {
+	manifest, err := s.Render()
+	if err != nil {
+		return nil, err
+	}
+	res := helm.ManifestImages(manifest)
+	for i, paths := range res {
+		for j, p := range paths {
+			_, r, _ := strings.Cut(p, ":")
+			paths[j] = s.Name + ":" + r
+		}
+		res[i] = paths
+	}
+	return res, nil
+}
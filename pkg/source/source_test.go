@@ -0,0 +1,92 @@
+package source
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const deployment = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: nginx
+spec:
+  template:
+    spec:
+      containers:
+      - name: nginx
+        image: docker.io/bitnami/nginx:1.25.3
+`
+
+func images(t *testing.T, s Source) map[string][]string {
+	t.Helper()
+	is, err := s.Images()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := map[string][]string{}
+	for i, paths := range is {
+		ref, err := i.String()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[ref] = paths
+	}
+	return res
+}
+
+func TestManifests(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deployment.yaml"), []byte(deployment), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "job.yaml"), []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: busybox:1.36
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := images(t, Source{Name: "web", Manifests: []string{filepath.Join(dir, "*.yaml")}})
+	want := map[string][]string{
+		"docker.io/bitnami/nginx:1.25.3": {"web:Deployment/nginx"},
+		"docker.io/library/busybox:1.36": {"web:Job/migrate"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if _, err := (Source{Name: "web", Manifests: []string{filepath.Join(dir, "*.yml")}}).Images(); err == nil {
+		t.Error("want error for a pattern without manifests")
+	}
+}
+
+func TestKustomize(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deployment.yaml"), []byte(deployment), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "kustomization.yaml"), []byte(`resources:
+- deployment.yaml
+namePrefix: prod-
+images:
+- name: docker.io/bitnami/nginx
+  newTag: 1.27.0
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := images(t, Source{Name: "web", Kustomize: dir})
+	want := map[string][]string{"docker.io/bitnami/nginx:1.27.0": {"web:Deployment/prod-nginx"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	TypeFile     = "file"
+	TypeBolt     = "bolt"
+	TypePostgres = "postgres"
+	TypeS3       = "s3"
+)
+
+// Backend persists the records of a state store
+type Backend interface {
+	// Load returns all records
+	Load(ctx context.Context) ([]Record, error)
+	// Apply upserts the records and deletes the records with the keys, leaving other records untouched
+	Apply(ctx context.Context, put []Record, deleted []string) error
+	// Close releases the connections of the backend
+	Close() error
+}
+
+// Config selects and configures a backend
+type Config struct {
+	Type string
+	// Path is the file of file and bolt backends
+	Path string
+	// DSN is the connection string of postgres backends, e.g. 'postgres://helmper@db:5432/helmper'
+	DSN string
+	// Bucket, Prefix and Region locate the objects of S3 backends
+	Bucket string
+	Prefix string
+	Region string
+}
+
+// New returns the backend of the configuration
+func New(ctx context.Context, c Config) (Backend, error) {
+	switch c.Type {
+	case TypeFile, "":
+		return File{Path: c.Path}, nil
+	case TypeBolt:
+		return Bolt{Path: c.Path}, nil
+	case TypePostgres:
+		return newPostgres(c.DSN)
+	case TypeS3:
+		return newS3(ctx, c.Bucket, c.Prefix, c.Region)
+	default:
+		return nil, fmt.Errorf("store: unsupported backend '%s'", c.Type)
+	}
+}
+
+// File stores the records as a JSON array. Concurrent runners must not share the file
+type File struct {
+	Path string
+}
+
+var _ Backend = File{}
+
+func (f File) Load(_ context.Context) ([]Record, error) {
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rs := []Record{}
+	if err := json.Unmarshal(b, &rs); err != nil {
+		return nil, fmt.Errorf("store: error reading state store %s :: %w", f.Path, err)
+	}
+	return rs, nil
+}
+
+func (f File) Close() error {
+	return nil
+}
+
+// Apply merges the changes into the file as it is now, and replaces the file atomically
+func (f File) Apply(ctx context.Context, put []Record, deleted []string) error {
+	rs, err := f.Load(ctx)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]Record, len(rs)+len(put))
+	for _, r := range rs {
+		m[r.Key()] = r
+	}
+	for _, r := range put {
+		m[r.Key()] = r
+	}
+	for _, k := range deleted {
+		delete(m, k)
+	}
+
+	rs = make([]Record, 0, len(m))
+	for _, r := range m {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Key() < rs[j].Key() })
+	b, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for k := range f.objects {
+		if strings.HasPrefix(k, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(k)})
+		}
+	}
+	sort.Slice(out.Contents, func(i, j int) bool { return *out.Contents[i].Key < *out.Contents[j].Key })
+	return out, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(f.objects[aws.ToString(params.Key)]))}, nil
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	b, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Key)] = b
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// two runners sharing the backend only overwrite the records they changed
+func testBackend(t *testing.T, b Backend) {
+	ctx := context.Background()
+	a, err := OpenBackend(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Put(Record{Kind: Image, Registry: "0.0.0.0:5000", Name: "library/busybox", Reference: "latest", Digest: "sha256:abc"})
+	a.Put(Record{Kind: Chart, Registry: "0.0.0.0:5000", Name: "charts/loki", Reference: "5.38.0", Digest: "sha256:def"})
+	if err := a.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	r1, err := OpenBackend(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := OpenBackend(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r1.Put(Record{Kind: Image, Registry: "0.0.0.0:5000", Name: "library/nginx", Reference: "1.25", Digest: "sha256:123"})
+	r2.Delete(Key(Chart, "0.0.0.0:5000", "charts/loki", "5.38.0"))
+	if err := r1.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := OpenBackend(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []string{}
+	for _, r := range s.Records() {
+		keys = append(keys, r.Key())
+	}
+	want := "image/0.0.0.0:5000/library/busybox:latest,image/0.0.0.0:5000/library/nginx:1.25"
+	if got := strings.Join(keys, ","); got != want {
+		t.Errorf("want %s got %s", want, got)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	testBackend(t, File{Path: filepath.Join(t.TempDir(), "state.json")})
+}
+
+func TestBoltBackend(t *testing.T) {
+	testBackend(t, Bolt{Path: filepath.Join(t.TempDir(), "state.db")})
+}
+
+func TestS3Backend(t *testing.T) {
+	f := &fakeS3{objects: map[string][]byte{}}
+	testBackend(t, S3{Bucket: "helmper", Prefix: "state", api: f})
+	if _, ok := f.objects["state/records/image%2F0.0.0.0:5000%2Flibrary%2Fnginx:1.25.json"]; !ok {
+		t.Errorf("unexpected objects %v", f.objects)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var recordsBucket = []byte("records")
+
+// Bolt stores the records in a BoltDB file, locked while in use, so runners on the same host can share it
+type Bolt struct {
+	Path string
+}
+
+var _ Backend = Bolt{}
+
+func (b Bolt) open() (*bolt.DB, error) {
+	db, err := bolt.Open(b.Path, 0644, &bolt.Options{Timeout: time.Minute})
+	if err != nil {
+		return nil, fmt.Errorf("store: error opening state store %s :: %w", b.Path, err)
+	}
+	return db, nil
+}
+
+// Close does nothing, as the file is only opened, and locked, while loading and applying
+func (b Bolt) Close() error {
+	return nil
+}
+
+func (b Bolt) Load(_ context.Context) ([]Record, error) {
+	db, err := b.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rs := []Record{}
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("store: error reading record %s :: %w", k, err)
+			}
+			rs = append(rs, r)
+			return nil
+		})
+	})
+	return rs, err
+}
+
+func (b Bolt) Apply(_ context.Context, put []Record, deleted []string) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(recordsBucket)
+		if err != nil {
+			return err
+		}
+		for _, r := range put {
+			v, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(r.Key()), v); err != nil {
+				return err
+			}
+		}
+		for _, k := range deleted {
+			if err := bucket.Delete([]byte(k)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,4 @@
+/*
+Package store implements the Helmper state store. The state store keeps a record of every artifact Helmper has imported to a registry, including the digest pushed and whether the artifact was patched or signed.
+*/
+package store
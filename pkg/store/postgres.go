@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// Postgres stores every record as a row of the helmper_state table, created if missing, so runners on any host can share it
+type Postgres struct {
+	db *sql.DB
+}
+
+var _ Backend = Postgres{}
+
+func newPostgres(dsn string) (Postgres, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return Postgres{}, fmt.Errorf("store: error connecting to postgres :: %w", err)
+	}
+	return Postgres{db: db}, nil
+}
+
+// Close closes the connections to the database
+func (p Postgres) Close() error {
+	return p.db.Close()
+}
+
+func (p Postgres) migrate(ctx context.Context) error {
+	_, err := p.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS helmper_state (key TEXT PRIMARY KEY, record JSONB NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("store: error creating table helmper_state :: %w", err)
+	}
+	return nil
+}
+
+func (p Postgres) Load(ctx context.Context) ([]Record, error) {
+	if err := p.migrate(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := p.db.QueryContext(ctx, `SELECT record FROM helmper_state`)
+	if err != nil {
+		return nil, fmt.Errorf("store: error reading state store :: %w", err)
+	}
+	defer rows.Close()
+
+	rs := []Record{}
+	for rows.Next() {
+		var b []byte
+		if err := rows.Scan(&b); err != nil {
+			return nil, err
+		}
+		var r Record
+		if err := json.Unmarshal(b, &r); err != nil {
+			return nil, fmt.Errorf("store: error reading record :: %w", err)
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+
+func (p Postgres) Apply(ctx context.Context, put []Record, deleted []string) error {
+	if err := p.migrate(ctx); err != nil {
+		return err
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, r := range put {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO helmper_state (key, record) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET record = EXCLUDED.record`, r.Key(), b); err != nil {
+			return fmt.Errorf("store: error writing record %s :: %w", r.Key(), err)
+		}
+	}
+	for _, k := range deleted {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM helmper_state WHERE key = $1`, k); err != nil {
+			return fmt.Errorf("store: error deleting record %s :: %w", k, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Stage is a step of a run completed for an image
+type Stage string
+
+const (
+	Pushed  Stage = "pushed"
+	Patched Stage = "patched"
+	Signed  Stage = "signed"
+)
+
+// Progress is the stages completed for the images of a run. It is saved on every change, so a failed run can be resumed. It is safe to use concurrently
+type Progress struct {
+	mu   sync.Mutex
+	path string
+	// images maps the source reference of each image to the digest in the registries at each completed stage
+	images map[string]map[Stage]string
+}
+
+// NewProgress returns empty progress saved to the file at path
+func NewProgress(path string) *Progress {
+	return &Progress{
+		path:   path,
+		images: make(map[string]map[Stage]string),
+	}
+}
+
+// OpenProgress reads the progress saved to the file at path. Empty progress is returned if the file does not exist
+func OpenProgress(path string) (*Progress, error) {
+	p := NewProgress(path)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &p.images); err != nil {
+		return nil, fmt.Errorf("store: error reading progress %s :: %w", path, err)
+	}
+	return p, nil
+}
+
+// Done returns the digest of the image recorded when the stage was completed
+func (p *Progress) Done(ref string, s Stage) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, ok := p.images[ref][s]
+	return d, ok
+}
+
+// Len returns the number of images with at least one completed stage
+func (p *Progress) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.images)
+}
+
+// Complete records the stage as completed for the image and saves the progress
+func (p *Progress) Complete(ref string, s Stage, digest string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.images[ref] == nil {
+		p.images[ref] = make(map[Stage]string)
+	}
+	p.images[ref][s] = digest
+	return p.save()
+}
+
+// save replaces the file atomically
+func (p *Progress) save() error {
+	b, err := json.MarshalIndent(p.images, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
+
+// Remove deletes the file, once the run has completed
+func (p *Progress) Remove() error {
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
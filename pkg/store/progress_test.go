@@ -0,0 +1,43 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProgressResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out", "progress.json")
+
+	p := NewProgress(path)
+	if err := p.Complete("docker.io/library/nginx:1.25", Pushed, "sha256:abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Complete("docker.io/library/nginx:1.25", Signed, "sha256:abc"); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := OpenProgress(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, ok := p.Done("docker.io/library/nginx:1.25", Pushed); !ok || d != "sha256:abc" {
+		t.Errorf("want pushed 'sha256:abc' got '%s' (%t)", d, ok)
+	}
+	if _, ok := p.Done("docker.io/library/nginx:1.25", Patched); ok {
+		t.Error("want not patched")
+	}
+	if _, ok := p.Done("docker.io/library/redis:7.2", Pushed); ok {
+		t.Error("want not pushed")
+	}
+
+	if err := p.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("want progress removed got %v", err)
+	}
+	if p, err = OpenProgress(path); err != nil || p.Len() != 0 {
+		t.Errorf("want empty progress got %d (%v)", p.Len(), err)
+	}
+}
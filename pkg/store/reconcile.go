@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+type Problem string
+
+const (
+	// artifact is recorded in the state store but not present in the registry
+	RecordedMissing Problem = "recorded but missing"
+	// artifact is expected (lockfile) but not present in the registry
+	ExpectedMissing Problem = "expected but missing"
+	// digest in registry differs from the recorded digest
+	DigestMismatch Problem = "digest mismatch"
+	// artifact is present in the registry but not recorded in the state store
+	Unrecorded Problem = "unrecorded"
+)
+
+type Inconsistency struct {
+	Record  Record
+	Problem Problem
+	// Actual digest found in the registry
+	Actual string
+}
+
+// Resolver looks up the digest of the artifact described by the record in its registry
+type Resolver func(ctx context.Context, r Record) (digest string, exists bool, err error)
+
+// Reconcile cross-checks the records in the store and the expected records against the registries
+func (s *Store) Reconcile(ctx context.Context, expected []Record, resolve Resolver) ([]Inconsistency, error) {
+	res := []Inconsistency{}
+	seen := map[string]bool{}
+
+	for _, r := range s.Records() {
+		seen[r.Key()] = true
+
+		digest, exists, err := resolve(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !exists:
+			res = append(res, Inconsistency{Record: r, Problem: RecordedMissing})
+		case r.Digest != "" && digest != r.Digest:
+			res = append(res, Inconsistency{Record: r, Problem: DigestMismatch, Actual: digest})
+		}
+	}
+
+	for _, r := range expected {
+		if seen[r.Key()] {
+			continue
+		}
+		seen[r.Key()] = true
+
+		digest, exists, err := resolve(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case !exists:
+			res = append(res, Inconsistency{Record: r, Problem: ExpectedMissing})
+		case r.Digest != "" && digest != r.Digest:
+			res = append(res, Inconsistency{Record: r, Problem: DigestMismatch, Actual: digest})
+		default:
+			res = append(res, Inconsistency{Record: r, Problem: Unrecorded, Actual: digest})
+		}
+	}
+
+	return res, nil
+}
+
+// Repair updates the store so it reflects the registries. Artifacts expected but missing from the registries can not be repaired by the store.
+func (s *Store) Repair(is []Inconsistency) int {
+	count := 0
+	for _, i := range is {
+		switch i.Problem {
+		case RecordedMissing:
+			s.Delete(i.Record.Key())
+		case DigestMismatch, Unrecorded:
+			r := i.Record
+			r.Digest = i.Actual
+			r.Updated = time.Time{}
+			s.Put(r)
+		default:
+			continue
+		}
+		count++
+	}
+	return count
+}
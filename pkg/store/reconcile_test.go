@@ -0,0 +1,67 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	missing := Record{Kind: Image, Registry: "r", Name: "missing", Reference: "1", Digest: "sha256:a"}
+	changed := Record{Kind: Image, Registry: "r", Name: "changed", Reference: "1", Digest: "sha256:b"}
+	ok := Record{Kind: Image, Registry: "r", Name: "ok", Reference: "1", Digest: "sha256:c"}
+	s.Put(missing)
+	s.Put(changed)
+	s.Put(ok)
+
+	unrecorded := Record{Kind: Chart, Registry: "r", Name: "charts/unrecorded", Reference: "1.0.0"}
+	absent := Record{Kind: Chart, Registry: "r", Name: "charts/absent", Reference: "1.0.0"}
+
+	registry := map[string]string{
+		changed.Key():    "sha256:new",
+		ok.Key():         "sha256:c",
+		unrecorded.Key(): "sha256:d",
+	}
+	resolve := func(_ context.Context, r Record) (string, bool, error) {
+		d, exists := registry[r.Key()]
+		return d, exists, nil
+	}
+
+	is, err := s.Reconcile(context.TODO(), []Record{ok, unrecorded, absent}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]Problem{
+		missing.Key():    RecordedMissing,
+		changed.Key():    DigestMismatch,
+		unrecorded.Key(): Unrecorded,
+		absent.Key():     ExpectedMissing,
+	}
+	if len(is) != len(expected) {
+		t.Fatalf("want '%d' inconsistencies got '%d'", len(expected), len(is))
+	}
+	for _, i := range is {
+		if expected[i.Record.Key()] != i.Problem {
+			t.Errorf("want '%s' got '%s' for %s", expected[i.Record.Key()], i.Problem, i.Record.Key())
+		}
+	}
+
+	repaired := s.Repair(is)
+	if repaired != 3 {
+		t.Errorf("want '%d' got '%d'", 3, repaired)
+	}
+
+	is, err = s.Reconcile(context.TODO(), []Record{ok, unrecorded}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(is) != 0 {
+		t.Errorf("want no inconsistencies after repair got '%d'", len(is))
+	}
+}
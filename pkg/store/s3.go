@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+
+	"github.com/ChristofferNissen/helmper/pkg/util/s3client"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// s3API is the part of the S3 client used by the backend
+type s3API interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// S3 stores every record as an object under '<prefix>/records/', so runners on any host can share it without overwriting each other's records
+type S3 struct {
+	Bucket string
+	Prefix string
+
+	api s3API
+}
+
+var _ Backend = S3{}
+
+// newS3 connects to S3 in the region using the default AWS credential chain (environment, shared config, instance roles)
+func newS3(ctx context.Context, bucket string, prefix string, region string) (S3, error) {
+	api, err := s3client.New(ctx, region)
+	if err != nil {
+		return S3{}, fmt.Errorf("store: error loading AWS configuration :: %w", err)
+	}
+	return S3{Bucket: bucket, Prefix: prefix, api: api}, nil
+}
+
+// key of the object of the record. Record keys contain '/' and ':', so they are escaped into a single path segment
+func (s S3) key(k string) string {
+	return path.Join(s.Prefix, "records", url.PathEscape(k)+".json")
+}
+
+// Close does nothing, as the S3 client is shared
+func (s S3) Close() error {
+	return nil
+}
+
+func (s S3) Load(ctx context.Context) ([]Record, error) {
+	rs := []Record{}
+	p := s3.NewListObjectsV2Paginator(s.api, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(path.Join(s.Prefix, "records") + "/"),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("store: error listing s3://%s/%s :: %w", s.Bucket, s.Prefix, err)
+		}
+		for _, o := range page.Contents {
+			out, err := s.api.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.Bucket), Key: o.Key})
+			if err != nil {
+				return nil, fmt.Errorf("store: error reading s3://%s/%s :: %w", s.Bucket, aws.ToString(o.Key), err)
+			}
+			b, err := io.ReadAll(out.Body)
+			out.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			var r Record
+			if err := json.Unmarshal(b, &r); err != nil {
+				return nil, fmt.Errorf("store: error reading s3://%s/%s :: %w", s.Bucket, aws.ToString(o.Key), err)
+			}
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
+
+func (s S3) Apply(ctx context.Context, put []Record, deleted []string) error {
+	for _, r := range put {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		key := s.key(r.Key())
+		if _, err := s.api.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(s.Bucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(b),
+			ContentType: aws.String("application/json"),
+		}); err != nil {
+			return fmt.Errorf("store: error writing s3://%s/%s :: %w", s.Bucket, key, err)
+		}
+	}
+	for _, k := range deleted {
+		key := s.key(k)
+		if _, err := s.api.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(s.Bucket), Key: aws.String(key)}); err != nil {
+			return fmt.Errorf("store: error deleting s3://%s/%s :: %w", s.Bucket, key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Kind string
+
+const (
+	Chart Kind = "chart"
+	Image Kind = "image"
+)
+
+type Record struct {
+	Kind     Kind   `json:"kind"`
+	Registry string `json:"registry"`
+	Name     string `json:"name"`
+	// Reference is the tag of an image or the version of a chart
+	Reference string `json:"reference"`
+	Digest    string `json:"digest"`
+	Source    string `json:"source,omitempty"`
+	// SourceDigest is the digest of the source image a patched image was patched from, so rebuilt source tags are patched again
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	Patched      bool   `json:"patched,omitempty"`
+	Signed       bool   `json:"signed,omitempty"`
+	// Vulnerabilities found in the image when it was last scanned
+	Vulnerabilities []string `json:"vulnerabilities,omitempty"`
+	// Fixed are the fixable vulnerabilities of the source image a patched image was patched for
+	Fixed   []string  `json:"fixed,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+func (r Record) Key() string {
+	return Key(r.Kind, r.Registry, r.Name, r.Reference)
+}
+
+// Patches reports whether the record is of an image patched for all the vulnerabilities, so patching it again for them changes nothing
+func (r Record) Patches(ids []string) bool {
+	if !r.Patched {
+		return false
+	}
+	for _, id := range ids {
+		if !slices.Contains(r.Fixed, id) {
+			return false
+		}
+	}
+	return true
+}
+
+func Key(kind Kind, registry string, name string, reference string) string {
+	return fmt.Sprintf("%s/%s/%s:%s", kind, registry, name, reference)
+}
+
+// Store is a state store persisted by a backend. It is safe to use concurrently
+type Store struct {
+	mu      sync.Mutex
+	backend Backend
+	records map[string]Record
+	// changes since the store was opened, applied to the backend on Save so concurrent runners only overwrite the records they changed
+	put     map[string]bool
+	deleted map[string]bool
+}
+
+// Open reads the file backed state store at path. A new store is returned if the file does not exist
+func Open(path string) (*Store, error) {
+	return OpenBackend(context.Background(), File{Path: path})
+}
+
+// OpenBackend reads the records of the backend
+func OpenBackend(ctx context.Context, b Backend) (*Store, error) {
+	s := &Store{
+		backend: b,
+		records: make(map[string]Record),
+		put:     make(map[string]bool),
+		deleted: make(map[string]bool),
+	}
+
+	rs, err := b.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		s.records[r.Key()] = r
+	}
+
+	return s, nil
+}
+
+// Close closes the backend of the store. Changes not saved are lost
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
+func (s *Store) Put(r Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Updated.IsZero() {
+		r.Updated = time.Now().UTC()
+	}
+	s.records[r.Key()] = r
+	s.put[r.Key()] = true
+	delete(s.deleted, r.Key())
+}
+
+func (s *Store) Get(key string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.records[key]
+	return r, ok
+}
+
+func (s *Store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	delete(s.put, key)
+	s.deleted[key] = true
+}
+
+// Records returns all records sorted by key
+func (s *Store) Records() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rs := make([]Record, 0, len(s.records))
+	for _, r := range s.records {
+		rs = append(rs, r)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Key() < rs[j].Key() })
+	return rs
+}
+
+// Affected returns the image records with at least one of the vulnerability ids
+func (s *Store) Affected(ids []string) []Record {
+	rs := []Record{}
+	for _, r := range s.Records() {
+		if r.Kind != Image {
+			continue
+		}
+		for _, v := range r.Vulnerabilities {
+			if slices.Contains(ids, v) {
+				rs = append(rs, r)
+				break
+			}
+		}
+	}
+	return rs
+}
+
+// Save applies the records put and deleted since the store was opened to the backend
+func (s *Store) Save() error {
+	s.mu.Lock()
+	put := make([]Record, 0, len(s.put))
+	for k := range s.put {
+		put = append(put, s.records[k])
+	}
+	deleted := make([]string, 0, len(s.deleted))
+	for k := range s.deleted {
+		deleted = append(deleted, k)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(put, func(i, j int) bool { return put[i].Key() < put[j].Key() })
+	sort.Strings(deleted)
+	if err := s.backend.Apply(context.Background(), put, deleted); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	clear(s.put)
+	clear(s.deleted)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(Record{Kind: Image, Registry: "0.0.0.0:5000", Name: "library/busybox", Reference: "latest", Digest: "sha256:abc"})
+	s.Put(Record{Kind: Chart, Registry: "0.0.0.0:5000", Name: "charts/loki", Reference: "5.38.0", Digest: "sha256:def"})
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 2
+	if len(s.Records()) != expected {
+		t.Fatalf("want '%d' got '%d'", expected, len(s.Records()))
+	}
+
+	r, ok := s.Get(Key(Image, "0.0.0.0:5000", "library/busybox", "latest"))
+	if !ok {
+		t.Fatal("want record got none")
+	}
+	if r.Digest != "sha256:abc" {
+		t.Errorf("want '%s' got '%s'", "sha256:abc", r.Digest)
+	}
+
+	s.Delete(r.Key())
+	if _, ok := s.Get(r.Key()); ok {
+		t.Error("want record to be deleted")
+	}
+}
+
+func TestStoreAffected(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put(Record{Kind: Image, Registry: "0.0.0.0:5000", Name: "library/busybox", Reference: "latest", Vulnerabilities: []string{"CVE-2024-0001", "CVE-2024-0002"}})
+	s.Put(Record{Kind: Image, Registry: "0.0.0.0:5000", Name: "library/alpine", Reference: "3.19", Vulnerabilities: []string{"CVE-2024-0003"}})
+	s.Put(Record{Kind: Chart, Registry: "0.0.0.0:5000", Name: "charts/loki", Reference: "5.38.0"})
+
+	rs := s.Affected([]string{"CVE-2024-0002"})
+	if len(rs) != 1 {
+		t.Fatalf("want '%d' got '%d'", 1, len(rs))
+	}
+	if rs[0].Name != "library/busybox" {
+		t.Errorf("want '%s' got '%s'", "library/busybox", rs[0].Name)
+	}
+
+	if rs := s.Affected([]string{"CVE-2023-9999"}); len(rs) != 0 {
+		t.Errorf("want '%d' got '%d'", 0, len(rs))
+	}
+}
+
+func TestRecordPatches(t *testing.T) {
+	r := Record{Kind: Image, Patched: true, Fixed: []string{"CVE-2024-0001", "CVE-2024-0002"}}
+
+	tests := []struct {
+		ids  []string
+		want bool
+	}{
+		{[]string{"CVE-2024-0001"}, true},
+		{[]string{}, true},
+		{[]string{"CVE-2024-0002", "CVE-2024-0003"}, false},
+	}
+	for _, tt := range tests {
+		if got := r.Patches(tt.ids); got != tt.want {
+			t.Errorf("%v: want '%v' got '%v'", tt.ids, tt.want, got)
+		}
+	}
+
+	r.Patched = false
+	if r.Patches([]string{"CVE-2024-0001"}) {
+		t.Error("want images that are not patched to be patched again")
+	}
+}
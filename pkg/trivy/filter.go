@@ -0,0 +1,40 @@
+package trivy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	dbTypes "github.com/aquasecurity/trivy-db/pkg/types"
+	"github.com/aquasecurity/trivy/pkg/result"
+	"github.com/aquasecurity/trivy/pkg/types"
+	"github.com/aquasecurity/trivy/pkg/vex"
+)
+
+// filter removes the vulnerabilities accepted in the ignore file, and the vulnerabilities the VEX documents state do not affect the image.
+// The removed vulnerabilities are kept in the ModifiedFindings of the results, so the decisions are part of the report
+func (opts ScanOption) filter(ctx context.Context, report *types.Report) error {
+	if opts.IgnoreFile == "" && len(opts.VEX) == 0 {
+		return nil
+	}
+
+	before := len(VulnerabilityIDs(*report))
+	sources := make([]vex.Source, 0, len(opts.VEX))
+	for _, v := range opts.VEX {
+		sources = append(sources, vex.Source{Type: vex.TypeFile, FilePath: v})
+	}
+	err := result.Filter(ctx, *report, result.FilterOptions{
+		// every severity is kept, the severity gate applies its own threshold
+		Severities: []dbTypes.Severity{dbTypes.SeverityUnknown, dbTypes.SeverityLow, dbTypes.SeverityMedium, dbTypes.SeverityHigh, dbTypes.SeverityCritical},
+		IgnoreFile: opts.IgnoreFile,
+		CacheDir:   opts.cacheDir(),
+		VEXSources: sources,
+	})
+	if err != nil {
+		return fmt.Errorf("trivy: error filtering the vulnerabilities of %s :: %w", report.ArtifactName, err)
+	}
+	if removed := before - len(VulnerabilityIDs(*report)); removed > 0 {
+		slog.Info("removed accepted vulnerabilities from result", slog.Int("count", removed), slog.String("image", report.ArtifactName))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package trivy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aquasecurity/trivy/pkg/fanal/artifact"
+	ftypes "github.com/aquasecurity/trivy/pkg/fanal/types"
+	"github.com/aquasecurity/trivy/pkg/types"
+	packageurl "github.com/package-url/packageurl-go"
+)
+
+func filterReport() types.Report {
+	purl := func(name string) ftypes.PkgIdentifier {
+		p := packageurl.NewPackageURL(packageurl.TypeDebian, "debian", name, "3.0.11", packageurl.Qualifiers{{Key: "distro", Value: "debian-12"}}, "")
+		return ftypes.PkgIdentifier{UID: name, PURL: p}
+	}
+	vuln := func(id, name, severity string) types.DetectedVulnerability {
+		v := types.DetectedVulnerability{VulnerabilityID: id, PkgID: name, PkgName: name, PkgIdentifier: purl(name)}
+		v.Severity = severity
+		return v
+	}
+	return types.Report{
+		ArtifactName: "docker.io/library/nginx:1.25.3",
+		ArtifactType: artifact.TypeContainerImage,
+		Results: types.Results{{
+			Target: "docker.io/library/nginx:1.25.3 (debian 12.4)",
+			Class:  types.ClassOSPkg,
+			Type:   ftypes.Debian,
+			Packages: []ftypes.Package{
+				{ID: "openssl", Name: "openssl", Version: "3.0.11", Identifier: purl("openssl")},
+				{ID: "zlib", Name: "zlib", Version: "3.0.11", Identifier: purl("zlib")},
+			},
+			Vulnerabilities: []types.DetectedVulnerability{
+				vuln("CVE-2024-0727", "openssl", "HIGH"),
+				vuln("CVE-2023-45853", "zlib", "CRITICAL"),
+				vuln("CVE-2023-5678", "openssl", "MEDIUM"),
+			},
+		}},
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir := t.TempDir()
+	ignore := filepath.Join(dir, ".trivyignore")
+	if err := os.WriteFile(ignore, []byte("# accepted until the next release\nCVE-2023-45853\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	doc := filepath.Join(dir, "openvex.json")
+	if err := os.WriteFile(doc, []byte(`{
+  "@context": "https://openvex.dev/ns/v0.2.0",
+  "@id": "https://example.com/vex/nginx",
+  "author": "platform team",
+  "timestamp": "2024-02-01T00:00:00Z",
+  "version": 1,
+  "statements": [
+    {
+      "vulnerability": {"name": "CVE-2024-0727"},
+      "products": [{"@id": "pkg:deb/debian/openssl@3.0.11?distro=debian-12"}],
+      "status": "not_affected",
+      "justification": "vulnerable_code_not_in_execute_path"
+    }
+  ]
+}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := filterReport()
+	if err := (ScanOption{IgnoreFile: ignore, VEX: []string{doc}}).filter(context.Background(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := VulnerabilityIDs(report), []string{"CVE-2023-5678"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+	if n := len(report.Results[0].ModifiedFindings); n != 2 {
+		t.Errorf("want the 2 accepted vulnerabilities in the modified findings, got %d", n)
+	}
+
+	if err := (ScanOption{VEX: []string{filepath.Join(dir, "missing.json")}}).filter(context.Background(), &report); err == nil {
+		t.Error("want error for a missing VEX document")
+	}
+}
@@ -0,0 +1,81 @@
+package trivy
+
+import (
+	"bytes"
+	"sort"
+
+	ftypes "github.com/aquasecurity/trivy/pkg/fanal/types"
+	"github.com/aquasecurity/trivy/pkg/licensing"
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+// License is a license found in an image, by its SPDX identifier if known
+type License struct {
+	Name string `json:"name" yaml:"name"`
+	// Category is the category of the license, e.g. 'notice' or 'restricted'. See LicenseCategory
+	Category string `json:"category" yaml:"category"`
+	// Packages is the number of packages and license files under the license
+	Packages int `json:"packages" yaml:"packages"`
+}
+
+// categories are the license categories of 'trivy image --scanners license'
+var categories = map[ftypes.LicenseCategory][]string{
+	ftypes.CategoryForbidden:    licensing.ForbiddenLicenses,
+	ftypes.CategoryRestricted:   licensing.RestrictedLicenses,
+	ftypes.CategoryReciprocal:   licensing.ReciprocalLicenses,
+	ftypes.CategoryNotice:       licensing.NoticeLicenses,
+	ftypes.CategoryUnencumbered: licensing.UnencumberedLicenses,
+}
+
+// LicenseCategory normalizes the license to its SPDX identifier, e.g. 'Apache License 2.0' to 'Apache-2.0', and returns its category.
+// The category is 'unknown' for licenses that are not SPDX identifiers Trivy categorizes
+func LicenseCategory(name string) (string, string) {
+	spdx := licensing.Normalize(name)
+	s := licensing.NewScanner(categories)
+	c, _ := s.Scan(spdx)
+	return spdx, string(c)
+}
+
+// ClassifyLicense returns the SPDX identifier of the license text, e.g. a LICENSE file, or an empty string if it is not recognized
+func ClassifyLicense(name string, text []byte) (string, error) {
+	f, err := licensing.Classify(name, bytes.NewReader(text), 0.9)
+	if err != nil {
+		return "", err
+	}
+	if f == nil || len(f.Findings) == 0 {
+		return "", nil
+	}
+	return f.Findings[0].Name, nil
+}
+
+// Licenses scans the image for the licenses of its OS and language packages, and of the license files in the image
+func (opts ScanOption) Licenses(reference string) ([]License, error) {
+	r, err := opts.scan(reference, types.ScanOptions{
+		PkgTypes:          []string{types.PkgTypeOS, types.PkgTypeLibrary},
+		Scanners:          types.Scanners{types.LicenseScanner},
+		LicenseCategories: categories,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ReportLicenses(r), nil
+}
+
+// ReportLicenses counts the packages and license files of every license in the report, sorted by license
+func ReportLicenses(report types.Report) []License {
+	counts := map[string]int{}
+	for _, r := range report.Results {
+		for _, l := range r.Licenses {
+			spdx, _ := LicenseCategory(l.Name)
+			counts[spdx]++
+		}
+	}
+
+	res := make([]License, 0, len(counts))
+	for name, n := range counts {
+		_, c := LicenseCategory(name)
+		res = append(res, License{Name: name, Category: c, Packages: n})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
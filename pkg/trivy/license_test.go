@@ -0,0 +1,24 @@
+package trivy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+func TestReportLicenses(t *testing.T) {
+	report := types.Report{Results: types.Results{
+		{Class: types.ClassLicense, Licenses: []types.DetectedLicense{{PkgName: "openssl", Name: "Apache-2.0"}, {PkgName: "bash", Name: "GPL-3.0"}}},
+		{Class: types.ClassLicenseFile, Licenses: []types.DetectedLicense{{FilePath: "LICENSE", Name: "Apache License 2.0"}, {FilePath: "NOTICE", Name: "Acme Proprietary"}}},
+	}}
+
+	want := []License{
+		{Name: "Acme Proprietary", Category: "unknown", Packages: 1},
+		{Name: "Apache-2.0", Category: "notice", Packages: 2},
+		{Name: "GPL-3.0", Category: "restricted", Packages: 1},
+	}
+	if got := ReportLicenses(report); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
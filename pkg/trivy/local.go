@@ -0,0 +1,148 @@
+package trivy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	tdb "github.com/aquasecurity/trivy-db/pkg/db"
+	tcache "github.com/aquasecurity/trivy/pkg/cache"
+	"github.com/aquasecurity/trivy/pkg/db"
+	"github.com/aquasecurity/trivy/pkg/fanal/applier"
+	ftypes "github.com/aquasecurity/trivy/pkg/fanal/types"
+	"github.com/aquasecurity/trivy/pkg/scanner/langpkg"
+	"github.com/aquasecurity/trivy/pkg/scanner/local"
+	"github.com/aquasecurity/trivy/pkg/scanner/ospkg"
+	"github.com/aquasecurity/trivy/pkg/vulnerability"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Local reports if the images are scanned in-process instead of by a Trivy server, as no server is configured
+func (opts ScanOption) Local() bool {
+	return opts.TrivyServer == ""
+}
+
+// cacheDir is the folder of the vulnerability database, shared with the Trivy CLI by default
+func (opts ScanOption) cacheDir() string {
+	if opts.CacheDir != "" {
+		return opts.CacheDir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "trivy")
+}
+
+var (
+	// dbMu serializes checking, downloading and switching the vulnerability database
+	dbMu sync.Mutex
+	// dbUse is held for reading by the scans using the database, so it is not closed under them
+	dbUse sync.RWMutex
+	// dbDir is the folder of the vulnerability database opened by the process. Trivy opens one database per process.
+	// It is changed holding dbMu and dbUse
+	dbDir string
+)
+
+// dbDir is the folder of the vulnerability database of the scans
+func (opts ScanOption) dbDir() string {
+	if opts.DBPath != "" {
+		return opts.DBPath
+	}
+	return db.Dir(opts.cacheDir())
+}
+
+// initDB downloads the vulnerability database to the cache folder, unless the cached database is up to date, and opens it.
+// A pre-downloaded database in DBPath is opened without downloading. The cached database is checked for updates on every scan,
+// so long-running processes like 'helmper serve' pick up new vulnerabilities, and the database of another folder replaces the open one
+func (opts ScanOption) initDB(ctx context.Context) error {
+	dbMu.Lock()
+	defer dbMu.Unlock()
+
+	dir := opts.dbDir()
+	if opts.DBPath != "" {
+		return switchDB(dir)
+	}
+
+	repository := db.DefaultRepository
+	if opts.DBRepository != "" {
+		repository = opts.DBRepository
+	}
+	ref, err := name.ParseReference(repository)
+	if err != nil {
+		return fmt.Errorf("trivy: invalid database repository %s :: %w", repository, err)
+	}
+	client := db.NewClient(dir, true, db.WithDBRepository(ref))
+	// the metadata of the database tells when the next update is published, so checking does not reach the repository
+	update, err := client.NeedsUpdate(ctx, "", false)
+	if err != nil {
+		return fmt.Errorf("trivy: error checking the vulnerability database :: %w", err)
+	}
+	if !update {
+		return switchDB(dir)
+	}
+
+	slog.Info("Downloading the Trivy vulnerability database", slog.String("repository", ref.String()), slog.String("folder", dir))
+	dbUse.Lock()
+	defer dbUse.Unlock()
+	closeDB()
+	if err := client.Download(ctx, dir, ftypes.RegistryOptions{Insecure: opts.Insecure}); err != nil {
+		return fmt.Errorf("trivy: error downloading the vulnerability database :: %w", err)
+	}
+	return openDB(dir)
+}
+
+// switchDB opens the vulnerability database in the folder, closing the database of another folder once no scan uses it
+func switchDB(dir string) error {
+	if dbDir == dir {
+		return nil
+	}
+	dbUse.Lock()
+	defer dbUse.Unlock()
+	closeDB()
+	return openDB(dir)
+}
+
+// closeDB closes the open vulnerability database, if any
+func closeDB() {
+	if dbDir == "" {
+		return
+	}
+	if err := db.Close(); err != nil {
+		slog.Warn("could not close the Trivy vulnerability database", slog.String("folder", dbDir), slog.String("error", err.Error()))
+	}
+	dbDir = ""
+}
+
+// openDB opens the vulnerability database in the folder
+func openDB(dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, "trivy.db")); err != nil {
+		return fmt.Errorf("trivy: no vulnerability database in %s :: %w", dir, err)
+	}
+	if err := db.Init(dir); err != nil {
+		return fmt.Errorf("trivy: error opening the vulnerability database :: %w", err)
+	}
+	dbDir = dir
+	return nil
+}
+
+// localScanner scans the image layers in memory against the local vulnerability database. Release must be called once the scan is done
+func (opts ScanOption) localScanner(ctx context.Context) (local.Scanner, tcache.ArtifactCache, func(), error) {
+	for {
+		if err := opts.initDB(ctx); err != nil {
+			return local.Scanner{}, nil, nil, err
+		}
+		dbUse.RLock()
+		// scans of another folder may have replaced the database in between. dbDir only changes under both locks
+		if dbDir == opts.dbDir() {
+			break
+		}
+		dbUse.RUnlock()
+	}
+	cache := tcache.NewMemoryCache()
+	s := local.NewScanner(applier.NewApplier(cache), ospkg.NewScanner(), langpkg.NewScanner(), vulnerability.NewClient(tdb.Config{}))
+	return s, cache, dbUse.RUnlock, nil
+}
@@ -0,0 +1,27 @@
+package trivy
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	if !(ScanOption{}).Local() || (ScanOption{TrivyServer: "http://trivy:4954"}).Local() {
+		t.Error("want in-process scans only without a Trivy server")
+	}
+	if dir := (ScanOption{CacheDir: "/var/cache/trivy"}).cacheDir(); dir != "/var/cache/trivy" {
+		t.Errorf("got cache folder %s", dir)
+	}
+	if dir := (ScanOption{}).cacheDir(); filepath.Base(dir) != "trivy" {
+		t.Errorf("want the cache folder of the Trivy CLI, got %s", dir)
+	}
+}
+
+func TestDBPath(t *testing.T) {
+	err := ScanOption{DBPath: t.TempDir()}.initDB(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "no vulnerability database") {
+		t.Errorf("want error for a folder without a database, got %v", err)
+	}
+}
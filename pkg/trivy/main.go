@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"strings"
 
+	"github.com/ChristofferNissen/helmper/pkg/registry"
 	tcache "github.com/aquasecurity/trivy/pkg/cache"
 	"github.com/aquasecurity/trivy/pkg/fanal/analyzer"
 	"github.com/aquasecurity/trivy/pkg/fanal/artifact"
@@ -14,20 +17,91 @@ import (
 	"github.com/aquasecurity/trivy/pkg/rpc/client"
 	"github.com/aquasecurity/trivy/pkg/scanner"
 	"github.com/aquasecurity/trivy/pkg/types"
+	rpc "github.com/aquasecurity/trivy/rpc/scanner"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 
 	_ "modernc.org/sqlite" // sqlite driver for RPM DB and Java DB
 )
 
 type ScanOption struct {
-	DockerHost    string
-	TrivyServer   string
-	Insecure      bool
+	DockerHost string
+	// TrivyServer is the address of the Trivy server. Empty scans the images in-process, see Local
+	TrivyServer string
+	Insecure    bool
+	// CacheDir is the folder the vulnerability database is downloaded to when scanning in-process. Empty uses the cache folder of the Trivy CLI
+	CacheDir string
+	// DBRepository is the OCI repository of the vulnerability database, e.g. a mirror in an air-gapped environment. Empty uses ghcr.io/aquasecurity/trivy-db
+	DBRepository string
+	// DBPath is the folder of a pre-downloaded vulnerability database (trivy.db and metadata.json), used as is without downloading updates
+	DBPath string
+	// CAFile, CertFile and KeyFile configure TLS with a private CA and client certificates for the Trivy server
+	CAFile        string
+	CertFile      string
+	KeyFile       string
 	IgnoreUnfixed bool
-	Architecture  *string
+	// IgnoreFile is a .trivyignore file, in the plain or YAML format, with the accepted vulnerabilities
+	IgnoreFile string
+	// VEX are OpenVEX (or CycloneDX and CSAF VEX) documents with the vulnerabilities not affecting the images
+	VEX          []string
+	Architecture *string
+	// Sources are the settings of the registries the images are pulled from. Only the credentials and Insecure apply, as Trivy
+	// connects to the registries itself through the proxy of the environment
+	Sources registry.Sources
 }
 
+// registryOptions are the options for pulling the image, with the credentials of its source registry if configured
+func (opts ScanOption) registryOptions(reference string, platform ftypes.Platform) ftypes.RegistryOptions {
+	ro := ftypes.RegistryOptions{
+		Insecure: opts.Insecure,
+		Platform: platform,
+	}
+	host, _, _ := strings.Cut(reference, "/")
+	s, ok := opts.Sources.Lookup(host)
+	if !ok {
+		return ro
+	}
+	ro.Insecure = ro.Insecure || s.Insecure
+	if s.Auth.Username != "" {
+		ro.Credentials = []ftypes.Credential{{Username: os.ExpandEnv(s.Auth.Username), Password: os.ExpandEnv(s.Auth.Password)}}
+	}
+	ro.RegistryToken = os.ExpandEnv(s.Auth.Token)
+	return ro
+}
+
+// Scan scans the image for vulnerabilities in OS packages
 func (opts ScanOption) Scan(reference string) (types.Report, error) {
+	report, err := opts.scan(reference, types.ScanOptions{
+		PkgTypes:            []string{types.PkgTypeOS},
+		Scanners:            types.AllScanners,
+		ImageConfigScanners: types.AllImageConfigScanners,
+		ScanRemovedPackages: false,
+		// ListAllPackages:     false,
+		FilePatterns:   nil,
+		IncludeDevDeps: false,
+	})
+	if err != nil {
+		return types.Report{}, err
+	}
+
+	if opts.IgnoreUnfixed {
+		ignoreUnfixed(&report)
+	}
+	if err := opts.filter(context.TODO(), &report); err != nil {
+		return types.Report{}, err
+	}
+
+	return report, nil
+}
+
+// SBOM lists the OS and language packages of the image, for writing a software bill of materials with WriteSBOM
+func (opts ScanOption) SBOM(reference string) (types.Report, error) {
+	return opts.scan(reference, types.ScanOptions{
+		PkgTypes: []string{types.PkgTypeOS, types.PkgTypeLibrary},
+		Scanners: types.Scanners{types.SBOMScanner},
+	})
+}
+
+func (opts ScanOption) scan(reference string, scanOptions types.ScanOptions) (types.Report, error) {
 
 	platform := ftypes.Platform{}
 	if opts.Architecture != nil {
@@ -37,34 +111,51 @@ func (opts ScanOption) Scan(reference string) (types.Report, error) {
 		}
 	}
 
-	clientScanner := client.NewScanner(client.ScannerOption{
-		RemoteURL: opts.TrivyServer,
-		Insecure:  opts.Insecure,
-	}, []client.Option(nil)...)
+	var (
+		driver scanner.Driver
+		cache  tcache.ArtifactCache
+	)
+	if opts.Local() {
+		s, c, release, err := opts.localScanner(context.TODO())
+		if err != nil {
+			return types.Report{}, err
+		}
+		defer release()
+		driver, cache = s, c
+	} else {
+		httpClient, err := opts.httpClient()
+		if err != nil {
+			return types.Report{}, err
+		}
+		driver = client.NewScanner(client.ScannerOption{
+			RemoteURL: opts.TrivyServer,
+			Insecure:  opts.Insecure,
+		}, client.WithRPCClient(rpc.NewScannerProtobufClient(opts.TrivyServer, httpClient)))
+		cache = newRemoteCache(opts.TrivyServer, httpClient)
+	}
 
+	// Trivy pulls the image itself, within the rate limit of the source registry
+	host, _, _ := strings.Cut(reference, "/")
+	release, err := opts.Sources.Throttle(context.TODO(), host)
+	if err != nil {
+		return types.Report{}, err
+	}
+	defer release()
+
+	registryOptions := opts.registryOptions(reference, platform)
 	typesImage, cleanup, err := image.NewContainerImage(context.TODO(), reference, ftypes.ImageOptions{
-		RegistryOptions: ftypes.RegistryOptions{
-			Insecure: opts.Insecure,
-			Platform: platform,
-		},
+		RegistryOptions: registryOptions,
 		DockerOptions: ftypes.DockerOptions{
 			Host: opts.DockerHost,
 		},
 		ImageSources: []ftypes.ImageSource{ftypes.RemoteImageSource},
 	})
 	if err != nil {
-		slog.Error("NewContainerImage failed: %v", err)
+		slog.Error("NewContainerImage failed", slog.String("error", err.Error()))
 		return types.Report{}, err
 	}
 	defer cleanup()
 
-	cache := tcache.NewRemoteCache(
-		tcache.RemoteOptions{
-			ServerAddr: opts.TrivyServer,
-			Insecure:   opts.Insecure,
-		})
-	// cache := tcache.NopCache(remoteCache)
-
 	artifactArtifact, err := image2.NewArtifact(typesImage, cache, artifact.Option{
 		DisabledAnalyzers: []analyzer.Type{
 			analyzer.TypeJar,
@@ -81,10 +172,7 @@ func (opts ScanOption) Scan(reference string) (types.Report, error) {
 		SBOMSources:  nil,
 		RekorURL:     "https://rekor.sigstore.dev",
 		ImageOption: ftypes.ImageOptions{
-			RegistryOptions: ftypes.RegistryOptions{
-				Insecure: opts.Insecure,
-				Platform: platform,
-			},
+			RegistryOptions: registryOptions,
 			DockerOptions: ftypes.DockerOptions{
 				Host: opts.DockerHost,
 			},
@@ -92,29 +180,17 @@ func (opts ScanOption) Scan(reference string) (types.Report, error) {
 		},
 	})
 	if err != nil {
-		slog.Error("NewArtifact failed: %v", err)
+		slog.Error("NewArtifact failed", slog.String("error", err.Error()))
 		return types.Report{}, err
 	}
 
-	scannerScanner := scanner.NewScanner(clientScanner, artifactArtifact)
-	report, err := scannerScanner.ScanArtifact(context.TODO(), types.ScanOptions{
-		PkgTypes:            []string{types.PkgTypeOS},
-		Scanners:            types.AllScanners,
-		ImageConfigScanners: types.AllImageConfigScanners,
-		ScanRemovedPackages: false,
-		// ListAllPackages:     false,
-		FilePatterns:   nil,
-		IncludeDevDeps: false,
-	})
+	scannerScanner := scanner.NewScanner(driver, artifactArtifact)
+	report, err := scannerScanner.ScanArtifact(context.TODO(), scanOptions)
 	if err != nil {
 		slog.Error(fmt.Sprintf("ScanArtifact failed: %v", err), slog.Any("report", report))
 		return types.Report{}, err
 	}
 
-	if opts.IgnoreUnfixed {
-		ignoreUnfixed(&report)
-	}
-
 	return report, nil
 
 }
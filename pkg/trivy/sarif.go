@@ -0,0 +1,35 @@
+package trivy
+
+import (
+	"context"
+	"io"
+
+	"github.com/aquasecurity/trivy/pkg/report"
+	"github.com/aquasecurity/trivy/pkg/types"
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// Aggregate merges the reports of several images into one report. Only the targets of OS packages name their image,
+// so the targets of other results are prefixed with the repository of the image, as their paths are only unique within the image
+func Aggregate(reports []types.Report) types.Report {
+	res := types.Report{SchemaVersion: 2, ArtifactName: "helmper"}
+	for _, r := range reports {
+		prefix := r.ArtifactName
+		if ref, err := name.ParseReference(r.ArtifactName); err == nil {
+			prefix = ref.Context().RepositoryStr()
+		}
+		for _, result := range r.Results {
+			if result.Class != types.ClassOSPkg {
+				result.Target = prefix + "/" + result.Target
+			}
+			res.Results = append(res.Results, result)
+		}
+	}
+	return res
+}
+
+// WriteSARIF writes the reports as one aggregated SARIF log, e.g. for GitHub Code Scanning
+func WriteSARIF(ctx context.Context, w io.Writer, reports []types.Report) error {
+	sw := report.SarifWriter{Output: w}
+	return sw.Write(ctx, Aggregate(reports))
+}
@@ -0,0 +1,48 @@
+package trivy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	vuln := func(id string) types.DetectedVulnerability {
+		v := types.DetectedVulnerability{VulnerabilityID: id, PkgName: "openssl", InstalledVersion: "3.0.0"}
+		v.Severity = "HIGH"
+		return v
+	}
+	reports := []types.Report{
+		{ArtifactName: "docker.io/library/nginx:1.25", Results: types.Results{
+			{Target: "docker.io/library/nginx:1.25 (debian 12.5)", Class: types.ClassOSPkg, Vulnerabilities: []types.DetectedVulnerability{vuln("CVE-1")}},
+		}},
+		{ArtifactName: "quay.io/prometheus/prometheus:v2.48.0", Results: types.Results{
+			{Target: "bin/prometheus", Class: types.ClassLangPkg, Vulnerabilities: []types.DetectedVulnerability{vuln("CVE-2")}},
+		}},
+	}
+
+	if got := Aggregate(reports).Results[1].Target; got != "prometheus/prometheus/bin/prometheus" {
+		t.Errorf("unexpected target %s", got)
+	}
+
+	var b bytes.Buffer
+	if err := WriteSARIF(context.Background(), &b, reports); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID string `json:"ruleId"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Results) != 2 {
+		t.Errorf("want 1 run with 2 results got %s", b.String())
+	}
+}
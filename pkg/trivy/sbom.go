@@ -0,0 +1,50 @@
+package trivy
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ChristofferNissen/helmper/pkg/version"
+	"github.com/aquasecurity/trivy/pkg/report/cyclonedx"
+	"github.com/aquasecurity/trivy/pkg/report/spdx"
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+// SBOM formats
+const (
+	FormatSPDX      = "spdx"
+	FormatCycloneDX = "cyclonedx"
+)
+
+// SBOMExtension is the file extension of SBOM documents in the format
+func SBOMExtension(format string) (string, error) {
+	switch format {
+	case FormatSPDX:
+		return ".spdx.json", nil
+	case FormatCycloneDX:
+		return ".cdx.json", nil
+	default:
+		return "", fmt.Errorf("trivy: unsupported SBOM format '%s'", format)
+	}
+}
+
+// WriteSBOM writes the report from SBOM as an SPDX or CycloneDX JSON document
+func WriteSBOM(ctx context.Context, w io.Writer, report types.Report, format string) error {
+	var writer interface {
+		Write(ctx context.Context, report types.Report) error
+	}
+	switch format {
+	case FormatSPDX:
+		writer = spdx.NewWriter(w, version.Version, types.FormatSPDXJSON)
+	case FormatCycloneDX:
+		writer = cyclonedx.NewWriter(w, version.Version)
+	default:
+		return fmt.Errorf("trivy: unsupported SBOM format '%s'", format)
+	}
+
+	if err := writer.Write(ctx, report); err != nil {
+		return fmt.Errorf("trivy: error writing %s SBOM :: %w", format, err)
+	}
+	return nil
+}
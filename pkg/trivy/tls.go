@@ -0,0 +1,101 @@
+package trivy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	tcache "github.com/aquasecurity/trivy/pkg/cache"
+	"github.com/aquasecurity/trivy/pkg/fanal/types"
+	"github.com/aquasecurity/trivy/pkg/rpc"
+	rpcCache "github.com/aquasecurity/trivy/rpc/cache"
+)
+
+// tlsConfig configures the connection to the Trivy server. CAFile replaces the system roots, and CertFile and KeyFile authenticate the client (mTLS)
+func (opts ScanOption) tlsConfig() (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+	if opts.CAFile != "" {
+		b, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("trivy: error reading CA file %s :: %w", opts.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("trivy: no certificates found in CA file %s", opts.CAFile)
+		}
+		c.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("trivy: error loading client certificate %s and key %s :: %w", opts.CertFile, opts.KeyFile, err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
+
+// httpClient connects to the Trivy server
+func (opts ScanOption) httpClient() (*http.Client, error) {
+	c, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: c,
+		},
+	}, nil
+}
+
+// remoteCache is the Trivy remote cache using our own HTTP client, as Trivy only supports skipping TLS verification
+type remoteCache struct {
+	client rpcCache.Cache
+}
+
+var _ tcache.ArtifactCache = remoteCache{}
+
+func newRemoteCache(addr string, client *http.Client) remoteCache {
+	return remoteCache{client: rpcCache.NewCacheProtobufClient(addr, client)}
+}
+
+func (c remoteCache) PutArtifact(imageID string, artifactInfo types.ArtifactInfo) error {
+	return rpc.Retry(func() error {
+		_, err := c.client.PutArtifact(context.Background(), rpc.ConvertToRPCArtifactInfo(imageID, artifactInfo))
+		return err
+	})
+}
+
+func (c remoteCache) PutBlob(diffID string, blobInfo types.BlobInfo) error {
+	return rpc.Retry(func() error {
+		_, err := c.client.PutBlob(context.Background(), rpc.ConvertToRPCPutBlobRequest(diffID, blobInfo))
+		return err
+	})
+}
+
+func (c remoteCache) MissingBlobs(imageID string, layerIDs []string) (bool, []string, error) {
+	var res *rpcCache.MissingBlobsResponse
+	err := rpc.Retry(func() error {
+		var err error
+		res, err = c.client.MissingBlobs(context.Background(), rpc.ConvertToMissingBlobsRequest(imageID, layerIDs))
+		return err
+	})
+	if err != nil {
+		return false, nil, err
+	}
+	return res.MissingArtifact, res.MissingBlobIds, nil
+}
+
+func (c remoteCache) DeleteBlobs(blobIDs []string) error {
+	return rpc.Retry(func() error {
+		_, err := c.client.DeleteBlobs(context.Background(), rpc.ConvertToDeleteBlobsRequest(blobIDs))
+		return err
+	})
+}
@@ -1,6 +1,11 @@
 package trivy
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
+	dbTypes "github.com/aquasecurity/trivy-db/pkg/types"
 	"github.com/aquasecurity/trivy/pkg/types"
 )
 
@@ -15,3 +20,79 @@ func ContainsOsPkgs(rs types.Results) bool {
 	}
 	return false
 }
+
+// VulnerabilityIDs returns the unique IDs (e.g. CVE-2024-1234) of all vulnerabilities in the report
+func VulnerabilityIDs(report types.Report) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			if seen[v.VulnerabilityID] {
+				continue
+			}
+			seen[v.VulnerabilityID] = true
+			ids = append(ids, v.VulnerabilityID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// AtOrAbove returns the unique IDs of the vulnerabilities in the report with the severity or higher, e.g. 'HIGH' returns HIGH and CRITICAL vulnerabilities
+func AtOrAbove(report types.Report, severity string) ([]string, error) {
+	threshold, err := dbTypes.NewSeverity(strings.ToUpper(severity))
+	if err != nil {
+		return nil, fmt.Errorf("trivy: %w", err)
+	}
+
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			s, err := dbTypes.NewSeverity(v.Severity)
+			if err != nil || s < threshold || seen[v.VulnerabilityID] {
+				continue
+			}
+			seen[v.VulnerabilityID] = true
+			ids = append(ids, v.VulnerabilityID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Severities counts the unique vulnerabilities in the report by severity, e.g. 'CRITICAL'
+func Severities(report types.Report) map[string]int {
+	seen := map[string]bool{}
+	res := map[string]int{}
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			if seen[v.VulnerabilityID] {
+				continue
+			}
+			seen[v.VulnerabilityID] = true
+			res[v.Severity]++
+		}
+	}
+	return res
+}
+
+// FixableOSVulnerabilityIDs returns the unique IDs of the vulnerabilities in operating system packages with a fixed version, which Copacetic patches
+func FixableOSVulnerabilityIDs(report types.Report) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, r := range report.Results {
+		if r.Class != types.ClassOSPkg {
+			continue
+		}
+		for _, v := range r.Vulnerabilities {
+			if v.FixedVersion == "" || seen[v.VulnerabilityID] {
+				continue
+			}
+			seen[v.VulnerabilityID] = true
+			ids = append(ids, v.VulnerabilityID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,65 @@
+package trivy
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/aquasecurity/trivy/pkg/types"
+)
+
+func TestAtOrAbove(t *testing.T) {
+	vuln := func(id, severity string) types.DetectedVulnerability {
+		v := types.DetectedVulnerability{VulnerabilityID: id}
+		v.Severity = severity
+		return v
+	}
+	report := types.Report{Results: types.Results{
+		{Vulnerabilities: []types.DetectedVulnerability{vuln("CVE-1", "LOW"), vuln("CVE-2", "HIGH")}},
+		{Vulnerabilities: []types.DetectedVulnerability{vuln("CVE-3", "CRITICAL"), vuln("CVE-2", "HIGH"), vuln("CVE-4", "UNKNOWN")}},
+	}}
+
+	tests := []struct {
+		severity string
+		want     []string
+	}{
+		{"CRITICAL", []string{"CVE-3"}},
+		{"high", []string{"CVE-2", "CVE-3"}},
+		{"LOW", []string{"CVE-1", "CVE-2", "CVE-3"}},
+	}
+	for _, tt := range tests {
+		got, err := AtOrAbove(report, tt.severity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: want %v got %v", tt.severity, tt.want, got)
+		}
+	}
+
+	if _, err := AtOrAbove(report, "SEVERE"); err == nil {
+		t.Error("want error for unknown severity")
+	}
+
+	want := map[string]int{"LOW": 1, "HIGH": 1, "CRITICAL": 1, "UNKNOWN": 1}
+	if got := Severities(report); !maps.Equal(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
+
+func TestFixableOSVulnerabilityIDs(t *testing.T) {
+	report := types.Report{Results: types.Results{
+		{Class: types.ClassOSPkg, Vulnerabilities: []types.DetectedVulnerability{
+			{VulnerabilityID: "CVE-2", FixedVersion: "1.2.4"},
+			{VulnerabilityID: "CVE-1", FixedVersion: "3.0.1"},
+			{VulnerabilityID: "CVE-3"},
+		}},
+		{Class: types.ClassLangPkg, Vulnerabilities: []types.DetectedVulnerability{
+			{VulnerabilityID: "CVE-4", FixedVersion: "0.9.0"},
+		}},
+	}}
+	want := []string{"CVE-1", "CVE-2"}
+	if got := FixableOSVulnerabilityIDs(report); !slices.Equal(got, want) {
+		t.Errorf("want %v got %v", want, got)
+	}
+}
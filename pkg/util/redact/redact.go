@@ -0,0 +1,24 @@
+package redact
+
+import (
+	"errors"
+	"net/url"
+)
+
+// URL returns the scheme and host of the URL. The path, query and user info are dropped, as webhooks often carry their secret there, e.g. Slack incoming webhooks
+func URL(u string) string {
+	p, err := url.Parse(u)
+	if err != nil || p.Host == "" {
+		return "<redacted>"
+	}
+	return p.Scheme + "://" + p.Host + "/<redacted>"
+}
+
+// URLError redacts the URL of the *url.Error the HTTP client wraps its errors in, so logs and summaries do not leak the URL
+func URLError(err error) error {
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	return &url.Error{Op: ue.Op, URL: URL(ue.URL), Err: ue.Err}
+}
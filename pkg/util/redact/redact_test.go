@@ -0,0 +1,23 @@
+package redact
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestURLError(t *testing.T) {
+	err := URLError(&url.Error{Op: "Post", URL: "https://hooks.slack.com/services/T000/B000/XXXX?token=secret", Err: errors.New("connection refused")})
+	if strings.Contains(err.Error(), "XXXX") || strings.Contains(err.Error(), "secret") {
+		t.Errorf("URL not redacted: %s", err)
+	}
+	if want := `Post "https://hooks.slack.com/<redacted>": connection refused`; err.Error() != want {
+		t.Errorf("want %s got %s", want, err)
+	}
+
+	other := errors.New("other")
+	if URLError(other) != other {
+		t.Error("want other errors unchanged")
+	}
+}
@@ -0,0 +1,30 @@
+package s3client
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// clients are the S3 clients by region, shared by the state store and the sinks of a run
+var clients sync.Map
+
+// New returns the S3 client of the region using the default AWS credential chain (environment, shared config, instance roles).
+// An empty region uses the region of the AWS configuration. Clients are safe to use concurrently, so one client is shared per region
+func New(ctx context.Context, region string) (*s3.Client, error) {
+	if c, ok := clients.Load(region); ok {
+		return c.(*s3.Client), nil
+	}
+	opts := []func(*config.LoadOptions) error{}
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	c, _ := clients.LoadOrStore(region, s3.NewFromConfig(cfg))
+	return c.(*s3.Client), nil
+}
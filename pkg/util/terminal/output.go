@@ -0,0 +1,78 @@
+package terminal
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/k0kubun/go-ansi"
+	"github.com/schollz/progressbar/v3"
+)
+
+// coordinator serialises all writes to the terminal, so progress bars, tables
+// and log lines written from concurrent stages don't interleave. Progress bars
+// redraw their line in place; any other output first clears a partly drawn bar
+// line, and the bar is redrawn on its next update.
+type coordinator struct {
+	mu sync.Mutex
+	// a progress bar line without trailing newline is on screen
+	dirty bool
+}
+
+type writer struct {
+	c   *coordinator
+	w   io.Writer
+	bar bool
+}
+
+func (w writer) Write(p []byte) (int, error) {
+	w.c.mu.Lock()
+	defer w.c.mu.Unlock()
+
+	if !w.bar && w.c.dirty {
+		if _, err := io.WriteString(w.w, "\r\033[K"); err != nil {
+			return 0, err
+		}
+		w.c.dirty = false
+	}
+
+	n, err := w.w.Write(p)
+	if w.bar && n > 0 {
+		w.c.dirty = p[n-1] != '\n'
+	}
+	return n, err
+}
+
+var output = &coordinator{}
+
+var (
+	// Stdout is the coordinated writer for standard output
+	Stdout io.Writer = writer{c: output, w: os.Stdout}
+	// Stderr is the coordinated writer for standard error
+	Stderr io.Writer = writer{c: output, w: os.Stderr}
+
+	bars io.Writer = writer{c: output, w: ansi.NewAnsiStdout(), bar: true}
+)
+
+// NewBar returns a progress bar drawn through the output coordinator
+func NewBar(max int, description string, options ...progressbar.Option) *progressbar.ProgressBar {
+	opts := []progressbar.Option{
+		progressbar.OptionSetWriter(bars),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			_, _ = io.WriteString(bars, "\n")
+		}),
+		progressbar.OptionSetWidth(15),
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionShowDescriptionAtLineEnd(),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "[green]=[reset]",
+			SaucerHead:    "[green]>[reset]",
+			SaucerPadding: " ",
+			BarStart:      "[",
+			BarEnd:        "]",
+		}),
+	}
+	return progressbar.NewOptions(max, append(opts, options...)...)
+}
@@ -0,0 +1,38 @@
+package terminal
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriterClearsBarLine(t *testing.T) {
+	c := &coordinator{}
+	var buf bytes.Buffer
+	bar := writer{c: c, w: &buf, bar: true}
+	out := writer{c: c, w: &buf}
+
+	_, _ = bar.Write([]byte("\r[=> ] 1/2"))
+	_, _ = out.Write([]byte("line\n"))
+	_, _ = out.Write([]byte("next\n"))
+
+	want := "\r[=> ] 1/2\r\033[Kline\nnext\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWriterFinishedBar(t *testing.T) {
+	c := &coordinator{}
+	var buf bytes.Buffer
+	bar := writer{c: c, w: &buf, bar: true}
+	out := writer{c: c, w: &buf}
+
+	_, _ = bar.Write([]byte("\r[==] 2/2"))
+	_, _ = bar.Write([]byte("\n"))
+	_, _ = out.Write([]byte("line\n"))
+
+	want := "\r[==] 2/2\nline\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -13,21 +13,21 @@ func PrintGreen(text string) {
 	colorReset := "\033[0m"
 	colorGreen := "\033[32m"
 
-	fmt.Printf("%s%s%s\n", string(colorGreen), text, string(colorReset))
+	fmt.Fprintf(Stdout, "%s%s%s\n", string(colorGreen), text, string(colorReset))
 }
 
 func PrintRed(text string) {
 	colorReset := "\033[0m"
 	colorRed := "\033[31m"
 
-	fmt.Printf("%s%s%s\n", string(colorRed), text, string(colorReset))
+	fmt.Fprintf(Stdout, "%s%s%s\n", string(colorRed), text, string(colorReset))
 }
 
 func PrintYellow(text string) {
 	colorReset := "\033[0m"
 	colorYellow := "\033[33m"
 
-	fmt.Printf("%s%s%s\n", string(colorYellow), text, string(colorReset))
+	fmt.Fprintf(Stdout, "%s%s%s\n", string(colorYellow), text, string(colorReset))
 }
 
 func LogYellow(text string) {
@@ -0,0 +1,4 @@
+/*
+Package version exposes the version, commit and build date of Helmper. The values are set at build time with -ldflags.
+*/
+package version
@@ -0,0 +1,56 @@
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+)
+
+// set with -ldflags "-X github.com/ChristofferNissen/helmper/pkg/version.Version=..."
+var (
+	Version = "dev"
+	Commit  = "none"
+	Date    = "unknown"
+)
+
+// Annotation is added to the OCI manifests written by Helmper
+const Annotation = "io.helmper.version"
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+	}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("version %s (commit %s, built at %s)", i.Version, i.Commit, i.Date)
+}
+
+func (i Info) JSON() ([]byte, error) {
+	return json.MarshalIndent(i, "", "  ")
+}
+
+// UserAgent used for requests to registries
+func UserAgent() string {
+	return fmt.Sprintf("helmper/%s", Version)
+}
+
+// Header with the Helmper User-Agent, for use with oras auth clients
+func Header() http.Header {
+	h := http.Header{}
+	h.Set("User-Agent", UserAgent())
+	return h
+}
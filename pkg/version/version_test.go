@@ -0,0 +1,33 @@
+package version
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	Version = "v0.1.0"
+	defer func() { Version = "dev" }()
+
+	i := Get()
+	expected := "version v0.1.0 (commit none, built at unknown)"
+	if i.String() != expected {
+		t.Errorf("want '%s' got '%s'", expected, i.String())
+	}
+
+	b, err := i.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := Info{}
+	if err := json.Unmarshal(b, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual != i {
+		t.Errorf("want '%v' got '%v'", i, actual)
+	}
+
+	if UserAgent() != "helmper/v0.1.0" {
+		t.Errorf("want '%s' got '%s'", "helmper/v0.1.0", UserAgent())
+	}
+}